@@ -0,0 +1,500 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	actionABNew      = "ab-new"
+	actionABApply    = "ab-apply"
+	actionABDiscard  = "ab-discard"
+	actionABRemove   = "ab-remove"
+	abCallback       = "ab-split"
+	abDialogCallback = "ab-split-dialog"
+
+	// Modos de divisão do tráfego
+	abModePercent = "percent"
+	abModeHeader  = "header"
+	abModeCookie  = "cookie"
+
+	// abACLPrefix é o prefixo das ACLs escritas pelo BOT no haproxy.cfg,
+	// usado para encontrar as regras de A/B
+	abACLPrefix = "slackbot_ab_"
+
+	// abPendingTTL é o tempo que a regra revisada espera pela aplicação
+	abPendingTTL = 30 * time.Minute
+)
+
+var (
+	abNamePattern    = regexp.MustCompile(`^[a-z0-9-]{1,30}$`)
+	abTokenPattern   = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+	abACLPattern     = regexp.MustCompile(`^\s*acl ` + abACLPrefix + `(\S+) (?:rand\(100\) lt (\d+)|req\.hdr\(([^)]+)\) -m str (\S+)|req\.cook\(([^)]+)\) -m str (\S+))\s*$`)
+	abBackendPattern = regexp.MustCompile(`^\s*use_backend (\S+) if ` + abACLPrefix + `(\S+)\s*$`)
+)
+
+// ABRule é uma regra de A/B no haproxy.cfg do LB: o tráfego do frontend que
+// passa na condição (porcentagem, header ou cookie) vai para o backend
+// alternativo
+type ABRule struct {
+	Name     string
+	Frontend string
+	Mode     string
+	Key      string
+	Value    string
+	Percent  int
+	Backend  string
+}
+
+func (r ABRule) aclName() string {
+	return abACLPrefix + r.Name
+}
+
+// Lines são as linhas da regra dentro do frontend
+func (r ABRule) Lines() []string {
+	var condition string
+	switch r.Mode {
+	case abModePercent:
+		condition = fmt.Sprintf("rand(100) lt %d", r.Percent)
+	case abModeHeader:
+		condition = fmt.Sprintf("req.hdr(%s) -m str %s", r.Key, r.Value)
+	case abModeCookie:
+		condition = fmt.Sprintf("req.cook(%s) -m str %s", r.Key, r.Value)
+	}
+
+	return []string{
+		fmt.Sprintf("    acl %s %s", r.aclName(), condition),
+		fmt.Sprintf("    use_backend %s if %s", r.Backend, r.aclName()),
+	}
+}
+
+// Description é a regra em texto, ex.: 10% do tráfego do frontend 80 para api-v2
+func (r ABRule) Description() string {
+	var match string
+	switch r.Mode {
+	case abModePercent:
+		match = fmt.Sprintf("%d%% do tráfego", r.Percent)
+	case abModeHeader:
+		match = fmt.Sprintf("requisições com o header `%s: %s`", r.Key, r.Value)
+	case abModeCookie:
+		match = fmt.Sprintf("requisições com o cookie `%s=%s`", r.Key, r.Value)
+	}
+
+	return fmt.Sprintf("`%s`: %s do frontend `%s` para o backend `%s`", r.Name, match, r.Frontend, r.Backend)
+}
+
+// ParseABRules lê as regras de A/B escritas pelo BOT no haproxy.cfg
+func ParseABRules(config string) []ABRule {
+	var rules []ABRule
+	backends := map[string]string{}
+	frontend := ""
+
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "frontend ") {
+			frontend = strings.TrimSpace(strings.TrimPrefix(line, "frontend "))
+			continue
+		}
+
+		if match := abBackendPattern.FindStringSubmatch(line); match != nil {
+			backends[match[2]] = match[1]
+			continue
+		}
+
+		match := abACLPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		rule := ABRule{Name: match[1], Frontend: frontend}
+		switch {
+		case match[2] != "":
+			rule.Mode = abModePercent
+			rule.Percent, _ = strconv.Atoi(match[2])
+		case match[3] != "":
+			rule.Mode, rule.Key, rule.Value = abModeHeader, match[3], match[4]
+		default:
+			rule.Mode, rule.Key, rule.Value = abModeCookie, match[5], match[6]
+		}
+		rules = append(rules, rule)
+	}
+
+	for i := range rules {
+		rules[i].Backend = backends[rules[i].Name]
+	}
+
+	return rules
+}
+
+// AddABRule escreve a regra no frontend do haproxy.cfg, criando a seção do
+// frontend quando ela não existe. As regras ficam antes das demais linhas
+// do frontend, para valerem antes do backend padrão
+func AddABRule(config string, rule ABRule) string {
+	lines := strings.Split(strings.TrimRight(config, "\n"), "\n")
+	if config == "" {
+		lines = nil
+	}
+
+	header := "frontend " + rule.Frontend
+	for i, line := range lines {
+		if strings.TrimSpace(line) == header {
+			result := append([]string{}, lines[:i+1]...)
+			result = append(result, rule.Lines()...)
+			result = append(result, lines[i+1:]...)
+			return strings.Join(result, "\n") + "\n"
+		}
+	}
+
+	if len(lines) > 0 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, header)
+	lines = append(lines, rule.Lines()...)
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// RemoveABRule tira as linhas da regra do haproxy.cfg e as seções de
+// frontend que ficaram vazias
+func RemoveABRule(config string, name string) string {
+	acl := abACLPrefix + name
+
+	var kept []string
+	for _, line := range strings.Split(config, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && ((fields[0] == "acl" && fields[1] == acl) || (fields[0] == "use_backend" && fields[len(fields)-1] == acl)) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	var result []string
+	for i, line := range kept {
+		if strings.HasPrefix(line, "frontend ") {
+			empty := true
+			for _, next := range kept[i+1:] {
+				if strings.TrimSpace(next) == "" {
+					continue
+				}
+				empty = !strings.HasPrefix(next, " ") && !strings.HasPrefix(next, "\t")
+				break
+			}
+			if empty {
+				continue
+			}
+		}
+		result = append(result, line)
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// abPending é a regra revisada esperando o clique em Aplicar
+type abPending struct {
+	LB      string
+	Rule    ABRule
+	Created time.Time
+}
+
+var (
+	abPendingRules = map[string]*abPending{}
+	abPendingMutex sync.Mutex
+)
+
+// abRulesAttachment lista as regras de A/B do LB, com o botão de nova regra
+// e o de remover cada uma
+func abRulesAttachment(lbID string, config string) slack.Attachment {
+	rules := ParseABRules(config)
+
+	attachment := slack.Attachment{
+		Title:      fmt.Sprintf(":twisted_rightwards_arrows: A/B do LB `%s`", lbID),
+		Color:      "#0C648A",
+		CallbackID: abCallback,
+		Actions: []slack.AttachmentAction{
+			{Name: actionABNew, Text: "Nova regra", Type: "button", Style: "primary", Value: lbID},
+		},
+	}
+
+	if len(rules) == 0 {
+		attachment.Text = "Nenhuma regra de A/B. O tráfego segue só o Canary e as regras do LB"
+		return attachment
+	}
+
+	var lines []string
+	for _, rule := range rules {
+		lines = append(lines, "• "+rule.Description())
+
+		// O Slack aceita no máximo 5 botões por mensagem
+		if len(attachment.Actions) < 5 {
+			attachment.Actions = append(attachment.Actions, slack.AttachmentAction{
+				Name:  actionABRemove,
+				Text:  fmt.Sprintf("Remover %s", rule.Name),
+				Type:  "button",
+				Style: "danger",
+				Value: lbID + "|" + rule.Name,
+				Confirm: &slack.ConfirmationField{
+					Title:       "Tem certeza disso?",
+					Text:        fmt.Sprintf("Deseja mesmo remover a regra %s? Todo o tráfego dela volta para o backend padrão :thinking_face:", rule.Name),
+					OkText:      "Sim",
+					DismissText: "Não",
+				},
+			})
+		}
+	}
+	attachment.Text = strings.Join(lines, "\n")
+
+	return attachment
+}
+
+// slackABSplit mostra as regras de A/B do LB, com o botão que abre o
+// formulário de nova regra
+func (s *SlackListener) slackABSplit(ev *slack.MessageEvent) {
+	args := strings.Fields(ev.Msg.Text)
+
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", abSplit), false))
+		return
+	}
+
+	lbID := args[2]
+	if !s.allowTargetArg(ev.Channel, lbID) {
+		return
+	}
+
+	lb, err := rancherListener.GetLoadBalancer(lbID)
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: LoadBalancer `%s` não encontrado", lbID), false))
+		return
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(abRulesAttachment(lbID, lb.LbConfig.Config)))
+}
+
+// actionABNewFunction abre o formulário da nova regra de A/B
+func actionABNewFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	lbID := message.Actions[0].Value
+
+	dialog := slack.Dialog{
+		CallbackID:  abDialogCallback,
+		Title:       "Nova regra de A/B",
+		SubmitLabel: "Revisar",
+		State:       lbID,
+		Elements: []slack.DialogElement{
+			&slack.TextInputElement{
+				DialogInput: slack.DialogInput{Type: "text", Label: "Nome", Name: "name", Placeholder: "checkout-v2"},
+				Hint:        "Letras minúsculas, números e -",
+			},
+			&slack.TextInputElement{
+				DialogInput: slack.DialogInput{Type: "text", Label: "Frontend", Name: "frontend"},
+				Hint:        "Porta do frontend no haproxy.cfg, ex.: 80",
+				Value:       "80",
+			},
+			&slack.DialogInputSelect{
+				DialogInput: slack.DialogInput{Type: slack.InputTypeSelect, Label: "Dividir por", Name: "mode"},
+				Value:       abModePercent,
+				Options: []slack.DialogSelectOption{
+					{Label: "Porcentagem do tráfego", Value: abModePercent},
+					{Label: "Header", Value: abModeHeader},
+					{Label: "Cookie", Value: abModeCookie},
+				},
+			},
+			&slack.TextInputElement{
+				DialogInput: slack.DialogInput{Type: "text", Label: "Condição", Name: "match", Placeholder: "10"},
+				Hint:        "Porcentagem: 10 | Header: X-Beta=1 | Cookie: variant=b",
+			},
+			&slack.TextInputElement{
+				DialogInput: slack.DialogInput{Type: "text", Label: "Backend alternativo", Name: "backend"},
+				Hint:        "Nome do backend no haproxy.cfg que recebe o tráfego",
+			},
+		},
+	}
+
+	if err := getAPIConnection().client.OpenDialog(message.TriggerID, dialog); err != nil {
+		CheckErr("Erro ao abrir o dialog de A/B", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// dialogError é o erro de um campo do formulário, mostrado pelo Slack
+// embaixo do campo
+type dialogError struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// parseABSubmission valida o formulário da nova regra
+func parseABSubmission(submission map[string]string, config string) (ABRule, []dialogError) {
+	rule := ABRule{
+		Name:     strings.TrimSpace(submission["name"]),
+		Frontend: strings.TrimSpace(submission["frontend"]),
+		Mode:     submission["mode"],
+		Backend:  strings.TrimSpace(submission["backend"]),
+	}
+
+	var errs []dialogError
+
+	if !abNamePattern.MatchString(rule.Name) {
+		errs = append(errs, dialogError{Name: "name", Error: "Use letras minúsculas, números e -"})
+	}
+	for _, existing := range ParseABRules(config) {
+		if existing.Name == rule.Name {
+			errs = append(errs, dialogError{Name: "name", Error: "Já existe uma regra com esse nome"})
+		}
+	}
+
+	if port, err := strconv.Atoi(rule.Frontend); err != nil || port <= 0 || port > 65535 {
+		errs = append(errs, dialogError{Name: "frontend", Error: "Informe a porta do frontend"})
+	}
+
+	if !abTokenPattern.MatchString(rule.Backend) {
+		errs = append(errs, dialogError{Name: "backend", Error: "Nome de backend inválido"})
+	}
+
+	match := strings.TrimSpace(submission["match"])
+	switch rule.Mode {
+	case abModePercent:
+		percent, err := parsePercent(match)
+		if err != nil || percent == 0 {
+			errs = append(errs, dialogError{Name: "match", Error: "Informe uma porcentagem de 1 a 100"})
+		}
+		rule.Percent = percent
+	case abModeHeader, abModeCookie:
+		kv := strings.SplitN(match, "=", 2)
+		if len(kv) != 2 || !abTokenPattern.MatchString(kv[0]) || !abTokenPattern.MatchString(kv[1]) {
+			errs = append(errs, dialogError{Name: "match", Error: "Use nome=valor, sem espaços"})
+		} else {
+			rule.Key, rule.Value = kv[0], kv[1]
+		}
+	default:
+		errs = append(errs, dialogError{Name: "mode", Error: "Escolha como dividir o tráfego"})
+	}
+
+	return rule, errs
+}
+
+// abDialogSubmission valida a nova regra e envia a revisão, com as linhas
+// que serão escritas no haproxy.cfg e os botões de aplicar e descartar
+func abDialogSubmission(submission DialogSubmission, w http.ResponseWriter) {
+	lbID := submission.State
+	config := rancherListener.HaproxyConfig(lbID)
+
+	rule, errs := parseABSubmission(submission.Submission, config)
+	if len(errs) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]dialogError{"errors": errs})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	ID := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	abPendingMutex.Lock()
+	for key, pending := range abPendingRules {
+		if time.Since(pending.Created) > abPendingTTL {
+			delete(abPendingRules, key)
+		}
+	}
+	abPendingRules[ID] = &abPending{LB: lbID, Rule: rule, Created: time.Now()}
+	abPendingMutex.Unlock()
+
+	getAPIConnection().client.PostMessage(submission.Channel.ID, slack.MsgOptionAttachments(slack.Attachment{
+		Title:      fmt.Sprintf("Revisão da regra de A/B no LB `%s`", lbID),
+		Text:       fmt.Sprintf("%s\n```frontend %s\n%s```", rule.Description(), rule.Frontend, strings.Join(rule.Lines(), "\n")),
+		Color:      "#0C648A",
+		CallbackID: abCallback,
+		Actions: []slack.AttachmentAction{
+			{Name: actionABApply, Text: "Aplicar", Type: "button", Style: "primary", Value: ID},
+			{Name: actionABDiscard, Text: "Descartar", Type: "button", Value: ID},
+		},
+	}))
+}
+
+// takeABPending retira a regra revisada, nil quando ela não existe mais
+func takeABPending(ID string) *abPending {
+	abPendingMutex.Lock()
+	defer abPendingMutex.Unlock()
+
+	pending, ok := abPendingRules[ID]
+	delete(abPendingRules, ID)
+	if !ok || time.Since(pending.Created) > abPendingTTL {
+		return nil
+	}
+
+	return pending
+}
+
+// actionABApplyFunction escreve a regra no haproxy.cfg do LB, com o botão
+// de desfazer
+func actionABApplyFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	pending := takeABPending(message.Actions[0].Value)
+	if pending == nil {
+		respondWithoutActions(w, message.OriginalMessage, ":hourglass: Essa revisão expirou, crie a regra de novo", "")
+		return
+	}
+
+	lb, err := rancherListener.GetLoadBalancer(pending.LB)
+	if err != nil {
+		respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: LoadBalancer `%s` não encontrado", pending.LB), "")
+		return
+	}
+	previousCfg := lb.LbConfig.Config
+
+	resp := rancherListener.SetHaproxyCfg(pending.LB, AddABRule(previousCfg, pending.Rule))
+	if resp == "" || resp == "error" {
+		respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao escrever a regra no haproxy.cfg do LB `%s`", pending.LB), "")
+		return
+	}
+
+	log.Printf("[INFO] Regra de A/B %s aplicada no LB %s pelo usuário %s\n", pending.Rule.Name, pending.LB, message.User.Name)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":white_check_mark: Regra aplicada por @%s", message.User.Name), "")
+	sendMessageWithUndo(fmt.Sprintf("Regra de A/B %s aplicada no LB `%s` por %s", pending.Rule.Description(), pending.LB, message.User.Name), undoHaproxyCfg(pending.LB, previousCfg))
+}
+
+func actionABDiscardFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	takeABPending(message.Actions[0].Value)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Regra descartada por @%s", message.User.Name), "")
+}
+
+// actionABRemoveFunction tira a regra do haproxy.cfg do LB, com o botão de
+// desfazer
+func actionABRemoveFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	value := strings.SplitN(message.Actions[0].Value, "|", 2)
+	if len(value) != 2 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	lbID, name := value[0], value[1]
+
+	previousCfg := rancherListener.HaproxyConfig(lbID)
+	newCfg := RemoveABRule(previousCfg, name)
+	if newCfg == previousCfg {
+		respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: A regra `%s` não está mais no LB `%s`", name, lbID), "")
+		return
+	}
+
+	resp := rancherListener.SetHaproxyCfg(lbID, newCfg)
+	if resp == "error" {
+		respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao remover a regra do haproxy.cfg do LB `%s`", lbID), "")
+		return
+	}
+
+	log.Printf("[INFO] Regra de A/B %s removida do LB %s pelo usuário %s\n", name, lbID, message.User.Name)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":wastebasket: Regra `%s` removida por @%s", name, message.User.Name), "")
+	sendMessageWithUndo(fmt.Sprintf("Regra de A/B `%s` removida do LB `%s` por %s", name, lbID, message.User.Name), undoHaproxyCfg(lbID, previousCfg))
+}
@@ -0,0 +1,295 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// AdminAPIToken é o token (Bearer) da API admin, usada por pipelines e outras
+// ferramentas para executar as ações do BOT. Vazio desliga a API
+var AdminAPIToken string
+
+// adminAPIUserHeader é o header com quem executou a ação pela API, usado no
+// audit e nos avisos do canal
+const adminAPIUserHeader = "X-Admin-User"
+
+// adminService é o serviço retornado pela API admin
+type adminService struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Image    string `json:"image,omitempty"`
+	State    string `json:"state"`
+	Replicas int    `json:"replicas"`
+	Ready    int    `json:"ready"`
+}
+
+// adminJob é o job retornado pela API admin
+type adminJob struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	User       string    `json:"user"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+// adminCommandRequest é o body do POST /api/v1/commands
+type adminCommandRequest struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Env     string   `json:"env"`
+}
+
+// adminMaintenanceRequest é o body da troca do modo de manutenção
+type adminMaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// RegisterAdminAPI adiciona as rotas da API admin (/api/v1) no router,
+// quando o ADMIN_API_TOKEN está configurado
+func RegisterAdminAPI(router *mux.Router) {
+	if AdminAPIToken == "" {
+		return
+	}
+
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Use(AdminAuthMiddleware)
+
+	api.HandleFunc("/services", AdminListServices).Methods("GET")
+	api.HandleFunc("/services/{service}/restart", AdminRestartService).Methods("POST")
+	api.HandleFunc("/commands", AdminExecuteCommand).Methods("POST")
+	api.HandleFunc("/jobs/{id}", AdminGetJob).Methods("GET")
+	api.HandleFunc("/audit", AdminQueryAudit).Methods("GET")
+	api.HandleFunc("/maintenance", AdminGetMaintenance).Methods("GET")
+	api.HandleFunc("/maintenance", AdminSetMaintenance).Methods("PUT")
+	api.HandleFunc("/validate", AdminValidateCompose).Methods("POST")
+	RegisterSandboxAPI(api)
+
+	log.Println("[INFO] API admin disponível em /api/v1")
+}
+
+// AdminAuthMiddleware aceita só as requisições com o ADMIN_API_TOKEN no
+// header Authorization (Bearer)
+func AdminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(AdminAPIToken)) != 1 {
+			log.Printf("[INFO] Requisição sem token válido na API admin: %s %s\n", r.Method, r.URL.Path)
+			adminError(w, http.StatusUnauthorized, "token inválido")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminUser é quem executou a ação pela API (header X-Admin-User)
+func adminUser(r *http.Request) string {
+	if user := strings.TrimSpace(r.Header.Get(adminAPIUserHeader)); user != "" {
+		return user
+	}
+
+	return "api"
+}
+
+func adminJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func adminError(w http.ResponseWriter, status int, message string) {
+	adminJSON(w, status, map[string]string{"error": message})
+}
+
+// adminAudit registra a chamada da API no audit
+func adminAudit(r *http.Request, action string, value string, status int) {
+	RecordAudit(AuditEntry{
+		Source: auditSourceAPI,
+		User:   adminUser(r),
+		Action: action,
+		Value:  value,
+		Status: status,
+	})
+}
+
+// AdminListServices lista os serviços do ambiente (?env=)
+func AdminListServices(w http.ResponseWriter, r *http.Request) {
+	o, err := orchestratorFor(r.URL.Query().Get("env"))
+	if err != nil {
+		adminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	workloads, err := o.ListServices()
+	if err != nil {
+		adminError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	services := []adminService{}
+	for _, workload := range workloads {
+		services = append(services, adminService{
+			ID:       workload.ID,
+			Name:     workload.Name,
+			Image:    workload.Image,
+			State:    workload.State,
+			Replicas: workload.Replicas,
+			Ready:    workload.Ready,
+		})
+	}
+
+	adminJSON(w, http.StatusOK, services)
+}
+
+// AdminRestartService coloca o restart do serviço (nome ou ID) do ambiente
+// (?env=) na fila de jobs. O resultado é avisado no canal, como no Slack
+func AdminRestartService(w http.ResponseWriter, r *http.Request) {
+	job, err := ExecuteRemoteCommand(RemoteCommand{
+		Command: restartService,
+		Args:    []string{mux.Vars(r)["service"]},
+		Env:     r.URL.Query().Get("env"),
+		User:    adminUser(r),
+		Source:  auditSourceAPI,
+	})
+	if err != nil {
+		adminError(w, remoteErrorStatus(err), err.Error())
+		return
+	}
+
+	adminJSON(w, http.StatusAccepted, adminJobFrom(job))
+}
+
+// AdminExecuteCommand coloca o comando na fila de jobs, com os mesmos
+// argumentos do Slack (ex.: {"command": "scale-service", "args": ["payments", "3"]})
+func AdminExecuteCommand(w http.ResponseWriter, r *http.Request) {
+	var req adminCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Command == "" {
+		adminError(w, http.StatusBadRequest, "body inválido, esperado {\"command\": \"...\", \"args\": [...], \"env\": \"...\"}")
+		return
+	}
+
+	job, err := ExecuteRemoteCommand(RemoteCommand{
+		Command: req.Command,
+		Args:    req.Args,
+		Env:     req.Env,
+		User:    adminUser(r),
+		Source:  auditSourceAPI,
+	})
+	if err != nil {
+		adminError(w, remoteErrorStatus(err), err.Error())
+		return
+	}
+
+	adminJSON(w, http.StatusAccepted, adminJobFrom(job))
+}
+
+// remoteErrorStatus é o status HTTP do erro do ExecuteRemoteCommand
+func remoteErrorStatus(err error) int {
+	if _, invalid := err.(*InvalidArgsError); invalid {
+		return http.StatusBadRequest
+	}
+
+	if err == ErrMaintenance {
+		return http.StatusLocked
+	}
+
+	return http.StatusServiceUnavailable
+}
+
+// adminJobFrom converte o job para a resposta da API
+func adminJobFrom(job *Job) adminJob {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	return adminJob{
+		ID:         job.ID,
+		Name:       job.Name,
+		User:       job.User,
+		Status:     job.Status,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+}
+
+// AdminGetJob retorna o status do job, para acompanhar as ações enfileiradas
+func AdminGetJob(w http.ResponseWriter, r *http.Request) {
+	ID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		adminError(w, http.StatusBadRequest, "ID do job inválido")
+		return
+	}
+
+	job, ok := FindJob(ID)
+	if !ok {
+		adminError(w, http.StatusNotFound, fmt.Sprintf("job #%d não encontrado", ID))
+		return
+	}
+
+	adminJSON(w, http.StatusOK, adminJobFrom(job))
+}
+
+// AdminQueryAudit consulta o audit (?user=&action=&source=&tenant=&since=1h&limit=)
+func AdminQueryAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := AuditFilter{
+		User:   query.Get("user"),
+		Action: query.Get("action"),
+		Source: query.Get("source"),
+		Tenant: query.Get("tenant"),
+		Limit:  100,
+	}
+
+	if since := query.Get("since"); since != "" {
+		duration, err := time.ParseDuration(since)
+		if err != nil {
+			adminError(w, http.StatusBadRequest, "since deve ser uma duração, ex.: 1h")
+			return
+		}
+		filter.Since = time.Now().Add(-duration)
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			adminError(w, http.StatusBadRequest, "limit deve ser um número maior que zero")
+			return
+		}
+		filter.Limit = n
+	}
+
+	adminJSON(w, http.StatusOK, QueryAudit(filter))
+}
+
+// AdminGetMaintenance retorna o estado do modo de manutenção
+func AdminGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	adminJSON(w, http.StatusOK, CurrentMaintenance())
+}
+
+// AdminSetMaintenance liga ou desliga o modo de manutenção, avisando no canal
+func AdminSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req adminMaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		adminError(w, http.StatusBadRequest, "body inválido, esperado {\"enabled\": true, \"reason\": \"...\"}")
+		return
+	}
+
+	current := SetMaintenance(req.Enabled, req.Reason, adminUser(r))
+	adminAudit(r, "maintenance", strconv.FormatBool(req.Enabled), http.StatusOK)
+
+	adminJSON(w, http.StatusOK, current)
+}
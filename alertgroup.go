@@ -0,0 +1,118 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// AlertGroupWindow é a janela de agrupamento dos alertas: os alertas
+// relacionados que chegam até esse tempo depois do último vão para a thread
+// da primeira mensagem, 0 desliga o agrupamento
+var AlertGroupWindow = 5 * time.Minute
+
+// alertThread é a mensagem de um grupo de alertas relacionados, com os
+// alertas seguintes na thread
+type alertThread struct {
+	TS          string
+	Attachments []slack.Attachment
+	Keys        map[string]int
+	Alerts      int
+	Repeats     int
+	First       time.Time
+	Last        time.Time
+}
+
+// summary é o attachment com a contagem do grupo, atualizado a cada alerta
+func (t *alertThread) summary() slack.Attachment {
+	text := fmt.Sprintf(":package: *%d alertas* agrupados desde %s, o último às %s", t.Alerts, localTime(t.First, "15:04"), localTime(t.Last, "15:04:05"))
+	if t.Repeats > 0 {
+		text += fmt.Sprintf(" | %d repetidos ignorados", t.Repeats)
+	}
+	if t.Alerts > 1 {
+		text += "\nOs demais alertas estão na thread"
+	}
+
+	return slack.Attachment{Text: text, Color: "#0C648A"}
+}
+
+var (
+	alertThreads      = map[string]*alertThread{}
+	alertThreadsMutex sync.Mutex
+)
+
+// PostAlert envia um alerta no canal do BOT agrupando os relacionados: o
+// primeiro alerta do grupo (groupKey) vira a mensagem principal, os seguintes
+// dentro do AlertGroupWindow vão para a thread dela e os idênticos (mesmo
+// dedupKey) são só contados. A mensagem principal é atualizada com as
+// contagens. Retorna o ts da mensagem quando o alerta abriu uma nova mensagem
+// no canal, ou vazio
+func PostAlert(groupKey string, dedupKey string, critical bool, attachments []slack.Attachment, options ...slack.MsgOption) string {
+	api := getAPIConnection()
+	channel := api.channelID
+
+	// No horário silencioso os alertas informativos vão para o resumo
+	if !critical && InQuietHours(channel, time.Now()) {
+		PostNotification(channel, critical, attachments, options...)
+		return ""
+	}
+
+	if AlertGroupWindow <= 0 {
+		_, ts, err := api.client.PostMessage(channel, append([]slack.MsgOption{slack.MsgOptionAttachments(attachments...)}, options...)...)
+		if err != nil {
+			CheckErr("Erro ao enviar o alerta "+groupKey, err)
+		}
+		return ts
+	}
+
+	alertThreadsMutex.Lock()
+	defer alertThreadsMutex.Unlock()
+
+	now := time.Now()
+	for key, thread := range alertThreads {
+		if now.Sub(thread.Last) > AlertGroupWindow {
+			delete(alertThreads, key)
+		}
+	}
+
+	thread, ok := alertThreads[groupKey]
+	if !ok {
+		_, ts, err := api.client.PostMessage(channel, append([]slack.MsgOption{slack.MsgOptionAttachments(attachments...)}, options...)...)
+		if err != nil {
+			CheckErr("Erro ao enviar o alerta "+groupKey, err)
+			return ""
+		}
+
+		alertThreads[groupKey] = &alertThread{TS: ts, Attachments: attachments, Keys: map[string]int{dedupKey: 1}, Alerts: 1, First: now, Last: now}
+		return ts
+	}
+
+	thread.Last = now
+
+	if thread.Keys[dedupKey] > 0 {
+		thread.Keys[dedupKey]++
+		thread.Repeats++
+		log.Printf("[INFO] Alerta repetido %s no grupo %s (%d vezes)\n", dedupKey, groupKey, thread.Keys[dedupKey])
+	} else {
+		thread.Keys[dedupKey] = 1
+		thread.Alerts++
+
+		options = append([]slack.MsgOption{slack.MsgOptionTS(thread.TS), slack.MsgOptionAttachments(attachments...)}, options...)
+		if _, _, err := api.client.PostMessage(channel, options...); err != nil {
+			CheckErr("Erro ao enviar o alerta na thread do grupo "+groupKey, err)
+		}
+	}
+
+	summary := append(append([]slack.Attachment{}, thread.Attachments...), thread.summary())
+	if _, _, _, err := api.client.UpdateMessage(channel, thread.TS, slack.MsgOptionAttachments(summary...)); err != nil {
+		CheckErr("Erro ao atualizar a contagem do grupo de alertas "+groupKey, err)
+	}
+
+	return ""
+}
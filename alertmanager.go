@@ -0,0 +1,391 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	alertmanagerCallback = "alertmanager"
+
+	actionAlertAck     = "alert-ack"
+	actionAlertSilence = "alert-silence"
+	actionAlertLogs    = "alert-logs"
+	actionAlertRestart = "alert-restart"
+
+	// alertmanagerMaxAlerts é a quantidade máxima de alertas mostrados por mensagem
+	alertmanagerMaxAlerts = 10
+)
+
+var (
+	// AlertmanagerURL é a URL do Alertmanager, usada para criar os silences
+	AlertmanagerURL string
+
+	// AlertmanagerToken é o token que o Alertmanager deve enviar no webhook
+	AlertmanagerToken string
+
+	// AlertmanagerSilenceDuration é o tempo padrão dos silences criados pelo BOT
+	AlertmanagerSilenceDuration = time.Hour
+
+	// AlertmanagerContainerLabel é a label do alerta que tem o ID do container
+	// do Rancher, usada nos botões de logs e restart
+	AlertmanagerContainerLabel = "rancher_container_id"
+)
+
+// AlertmanagerAlert é um alerta enviado pelo Alertmanager no webhook
+type AlertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// AlertmanagerPayload é o corpo do webhook do Alertmanager
+type AlertmanagerPayload struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	Status            string              `json:"status"`
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []AlertmanagerAlert `json:"alerts"`
+}
+
+var (
+	alertGroups      = map[string]*AlertmanagerPayload{}
+	alertGroupsTimes = map[string]time.Time{}
+	alertGroupsMutex sync.Mutex
+)
+
+// storeAlertGroup guarda o grupo de alertas para ser usado pelos botões,
+// limpando os grupos com mais de um dia
+func storeAlertGroup(payload *AlertmanagerPayload) string {
+	alertGroupsMutex.Lock()
+	defer alertGroupsMutex.Unlock()
+
+	for id, t := range alertGroupsTimes {
+		if time.Since(t) > 24*time.Hour {
+			delete(alertGroups, id)
+			delete(alertGroupsTimes, id)
+		}
+	}
+
+	id := fmt.Sprintf("%d", time.Now().UnixNano())
+	alertGroups[id] = payload
+	alertGroupsTimes[id] = time.Now()
+
+	return id
+}
+
+func getAlertGroup(id string) *AlertmanagerPayload {
+	alertGroupsMutex.Lock()
+	defer alertGroupsMutex.Unlock()
+
+	return alertGroups[id]
+}
+
+// AlertmanagerWebhook é o end-point que recebe os webhooks do Alertmanager
+// e envia os alertas agrupados no canal do BOT
+func AlertmanagerWebhook(w http.ResponseWriter, r *http.Request) {
+	if !ValidWebhookToken(r, AlertmanagerToken) {
+		log.Println("[ERROR] Token inválido no webhook do Alertmanager")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var payload AlertmanagerPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("[ERROR] Erro ao ler o webhook do Alertmanager: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	id := storeAlertGroup(&payload)
+
+	for _, alert := range payload.Alerts {
+		if alert.Status == "firing" {
+			RecordDigestAlert("Alertmanager", alert.Labels["alertname"])
+		}
+	}
+
+	// Alertas críticos mencionam quem está de plantão, os demais respeitam o
+	// horário silencioso
+	var options []slack.MsgOption
+	critical := payload.Status == "firing" && strings.ToLower(payload.CommonLabels["severity"]) == "critical"
+	if critical {
+		options = withOncallMention(options...)
+	}
+
+	groupKey := alertmanagerGroupKey(&payload)
+	ts := PostAlert(groupKey, alertmanagerDedupKey(&payload), critical, alertmanagerAttachments(&payload, id), options...)
+
+	// Os alertas disparados sem reconhecimento são escalonados conforme a
+	// severidade, os resolvidos param o escalonamento
+	if payload.Status == "resolved" {
+		ResolveEscalation("alertmanager:" + groupKey)
+	} else {
+		summary := payload.CommonLabels["alertname"]
+		if summary == "" {
+			summary = formatLabels(payload.GroupLabels)
+		}
+		TrackEscalation("alertmanager:"+groupKey, getAPIConnection().channelID, ts, payload.CommonLabels["severity"], summary)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// alertmanagerGroupKey agrupa os webhooks pelo nome do alerta, ou pelo grupo
+// do Alertmanager quando o grupo tem alertas com nomes diferentes
+func alertmanagerGroupKey(payload *AlertmanagerPayload) string {
+	if name := payload.CommonLabels["alertname"]; name != "" {
+		return "alertmanager:" + name
+	}
+
+	return "alertmanager:" + payload.GroupKey
+}
+
+// alertmanagerDedupKey identifica os webhooks idênticos (ex.: os reenvios do
+// repeat_interval): o mesmo status com os mesmos alertas
+func alertmanagerDedupKey(payload *AlertmanagerPayload) string {
+	var fingerprints []string
+	for _, alert := range payload.Alerts {
+		fingerprint := alert.Fingerprint
+		if fingerprint == "" {
+			fingerprint = formatLabels(alert.Labels)
+		}
+		fingerprints = append(fingerprints, alert.Status+":"+fingerprint)
+	}
+	sort.Strings(fingerprints)
+
+	return payload.Status + "|" + strings.Join(fingerprints, ",")
+}
+
+// alertColor retorna a cor da mensagem de acordo com o status e a severidade
+func alertColor(status string, severity string) string {
+	if status == "resolved" {
+		return "#36A64F"
+	}
+
+	switch strings.ToLower(severity) {
+	case "critical", "error", "page":
+		return "#D50200"
+	case "warning":
+		return "#FFA500"
+	}
+
+	return "#0C648A"
+}
+
+// alertmanagerAttachments monta a mensagem do grupo de alertas, um attachment
+// por alerta e um último com os botões de ação
+func alertmanagerAttachments(payload *AlertmanagerPayload, id string) []slack.Attachment {
+	firing := 0
+	for _, alert := range payload.Alerts {
+		if alert.Status == "firing" {
+			firing++
+		}
+	}
+
+	title := fmt.Sprintf("[%s:%d] %s", strings.ToUpper(payload.Status), firing, formatLabels(payload.GroupLabels))
+	attachments := []slack.Attachment{
+		{
+			Title:     title,
+			TitleLink: payload.ExternalURL,
+			Text:      payload.CommonAnnotations["summary"],
+			Color:     alertColor(payload.Status, payload.CommonLabels["severity"]),
+		},
+	}
+
+	var containers []string
+
+	for i, alert := range payload.Alerts {
+		if containerID := alert.Labels[AlertmanagerContainerLabel]; containerID != "" {
+			containers = append(containers, containerID)
+		}
+
+		if i >= alertmanagerMaxAlerts {
+			continue
+		}
+
+		text := alert.Annotations["description"]
+		if text == "" {
+			text = alert.Annotations["summary"]
+		}
+
+		attachments = append(attachments, slack.Attachment{
+			Title:     alert.Labels["alertname"],
+			TitleLink: alert.GeneratorURL,
+			Text:      text,
+			Color:     alertColor(alert.Status, alert.Labels["severity"]),
+			Footer:    fmt.Sprintf("%s | desde %s (há %s)", formatLabels(alert.Labels), localTime(alert.StartsAt, "02/01 15:04"), formatDuration(time.Since(alert.StartsAt))),
+		})
+	}
+
+	if len(payload.Alerts) > alertmanagerMaxAlerts {
+		attachments = append(attachments, slack.Attachment{
+			Text: fmt.Sprintf("_... e mais %d alertas_", len(payload.Alerts)-alertmanagerMaxAlerts),
+		})
+	}
+
+	if payload.Status == "resolved" {
+		return attachments
+	}
+
+	actions := []slack.AttachmentAction{
+		{Name: actionAlertAck, Text: "Reconhecer", Type: "button", Style: "primary", Value: id},
+		{Name: actionAlertSilence, Text: fmt.Sprintf("Silenciar %s", AlertmanagerSilenceDuration), Type: "button", Value: id},
+		{Name: actionAlertSilenceCustom, Text: "Silenciar...", Type: "button", Value: id},
+	}
+
+	// Os botões de logs e restart aparecem apenas se o alerta for de um único container
+	if len(containers) == 1 {
+		actions = append(actions,
+			slack.AttachmentAction{Name: actionAlertLogs, Text: "Logs do container", Type: "button", Value: containers[0]},
+			slack.AttachmentAction{
+				Name:  actionAlertRestart,
+				Text:  "Reiniciar container",
+				Type:  "button",
+				Style: "danger",
+				Value: containers[0],
+				Confirm: &slack.ConfirmationField{
+					Title:       "Tem certeza disso?",
+					Text:        fmt.Sprintf("Deseja mesmo reiniciar o container %s? :thinking_face:", containers[0]),
+					OkText:      "Sim",
+					DismissText: "Não",
+				},
+			},
+		)
+	}
+
+	// Os botões de ticket e incidente ficam em outro attachment, o Slack
+	// permite no máximo 5 botões por attachment
+	return append(attachments,
+		slack.Attachment{
+			CallbackID: alertmanagerCallback,
+			Color:      "#0C648A",
+			Actions:    actions,
+		},
+		slack.Attachment{
+			CallbackID: alertmanagerCallback,
+			Color:      "#0C648A",
+			Actions:    alertActions(""),
+		},
+	)
+}
+
+// formatLabels formata as labels em ordem alfabética no formato chave=valor
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, labels[key]))
+	}
+
+	return strings.Join(pairs, ", ")
+}
+
+// CreateAlertmanagerSilence é a função que cria um silence no Alertmanager com
+// as labels passadas, retornando o ID do silence
+func CreateAlertmanagerSilence(labels map[string]string, duration time.Duration, createdBy string, comment string) (string, error) {
+	return CreateSilence(labelMatchers(labels), duration, createdBy, comment)
+}
+
+// respondWithoutActions responde a interação tirando os botões da mensagem
+// original e adicionando um campo com o resultado da ação
+func respondWithoutActions(w http.ResponseWriter, original slack.Message, title string, value string) {
+	for i := range original.Attachments {
+		original.Attachments[i].Actions = []slack.AttachmentAction{}
+	}
+
+	if len(original.Attachments) == 0 {
+		original.Attachments = []slack.Attachment{{}}
+	}
+
+	last := &original.Attachments[len(original.Attachments)-1]
+	last.Fields = append(last.Fields, slack.AttachmentField{
+		Title: title,
+		Value: value,
+		Short: false,
+	})
+
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&original)
+}
+
+func actionAlertAckFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	log.Printf("[INFO] Alerta reconhecido pelo usuário %s\n", message.User.Name)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":eyes: Reconhecido por @%s", message.User.Name), "")
+}
+
+func actionAlertSilenceFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	payload := getAlertGroup(message.Actions[0].Value)
+	if payload == nil {
+		responseMessage(w, message.OriginalMessage, ":x: Grupo de alertas não encontrado, silencie pelo Alertmanager", "")
+		return
+	}
+
+	labels := payload.GroupLabels
+	if len(labels) == 0 {
+		labels = payload.CommonLabels
+	}
+
+	id, err := CreateAlertmanagerSilence(labels, AlertmanagerSilenceDuration, message.User.Name, "Silenciado pelo Slack")
+	if err != nil {
+		CheckErr("Erro ao criar silence no Alertmanager", err)
+		respondWithoutActions(w, message.OriginalMessage, ":x: Erro ao criar o silence no Alertmanager", err.Error())
+		return
+	}
+
+	log.Printf("[INFO] Silence %s criado pelo usuário %s\n", id, message.User.Name)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":mute: Silenciado por @%s durante %s", message.User.Name, AlertmanagerSilenceDuration), fmt.Sprintf("Silence `%s`, para expirar: `%s %s`", id, silenceExpire, id))
+}
+
+func actionAlertLogsFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	containerID := message.Actions[0].Value
+
+	job, err := EnqueueJob("logs do container "+containerID, message.User.Name, func() error {
+		if _, err := UploadContainerLogs(containerID, LogsOptions{Lines: defaultLogsLines}); err != nil {
+			return fmt.Errorf("erro ao enviar os logs do container %s: %s", containerID, err)
+		}
+		return nil
+	})
+	interactionJob(w, job, err)
+	if err != nil {
+		sendMessage(queuedJobMessage(job, err))
+	}
+}
+
+func actionAlertRestartFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	containerID := message.Actions[0].Value
+	if err := interactionRancher(w).RestartContainer(containerID); err != nil {
+		CheckErr("Erro ao reiniciar o container "+containerID+" pelo alerta", err)
+		interactionFailed(w)
+		respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao reiniciar o container `%s`, por @%s", containerID, message.User.Name), err.Error())
+		return
+	}
+
+	log.Printf("[INFO] Container %s reiniciado pelo alerta, usuário %s\n", containerID, message.User.Name)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":arrows_counterclockwise: Container `%s` reiniciado por @%s", containerID, message.User.Name), "")
+}
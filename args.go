@@ -0,0 +1,285 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// argKind é o tipo de um argumento posicional, usado na validação
+type argKind int
+
+const (
+	argText argKind = iota
+	argInt
+	argPercent
+)
+
+// ArgSpec é um argumento posicional de um comando
+type ArgSpec struct {
+	Name     string
+	Kind     argKind
+	Optional bool
+}
+
+// CommandSpec são os argumentos aceitos por um comando: os posicionais, em
+// ordem, e as opções no formato chave=valor (nil não verifica as opções)
+type CommandSpec struct {
+	Args    []ArgSpec
+	Options []string
+}
+
+// logsOptions são as opções aceitas pelos comandos de logs
+var logsOptions = []string{"lines", "tail", "since", "from", "to", "tz", "grep", "context", "stream"}
+
+// commandSpecs são os argumentos dos comandos validados antes da execução,
+// com a mensagem de uso do comando (Commands) quando estão errados
+var commandSpecs = map[string]CommandSpec{
+	restartService:   {Args: []ArgSpec{{Name: "serviço", Optional: true}}, Options: []string{}},
+	scaleService:     {Args: []ArgSpec{{Name: "serviço"}, {Name: "quantidade", Kind: argInt}}, Options: []string{}},
+	upgradeService:   {Args: []ArgSpec{{Name: "serviço"}, {Name: "nova-imagem"}}, Options: []string{}},
+	getServiceInfo:   {Args: []ArgSpec{{Name: "serviço", Optional: true}}, Options: []string{}},
+	canaryUpdate:     {Args: []ArgSpec{{Name: "id-do-LB"}, {Name: "peso-nova-versao", Kind: argPercent}, {Name: "peso-antiga-versao", Kind: argPercent}}, Options: []string{}},
+	canaryActivate:   {Args: []ArgSpec{{Name: "id-do-LB", Optional: true}}, Options: []string{}},
+	canaryDisable:    {Args: []ArgSpec{{Name: "id-do-LB", Optional: true}}, Options: []string{}},
+	serviceLogs:      {Args: []ArgSpec{{Name: "serviço", Optional: true}}, Options: logsOptions},
+	logsContainer:    {Args: []ArgSpec{{Name: "container", Optional: true}}, Options: logsOptions},
+	streamLogs:       {Options: []string{"duration"}},
+	auditExport:      {Args: []ArgSpec{{Name: "período"}}, Options: []string{"format"}},
+	blueGreen:        {Args: []ArgSpec{{Name: "serviço"}, {Name: "id-do-LB"}, {Name: "imagem"}}, Options: []string{}},
+	abSplit:          {Args: []ArgSpec{{Name: "id-do-LB"}}, Options: []string{}},
+	lbStats:          {Args: []ArgSpec{{Name: "id-do-LB"}}, Options: []string{}},
+	restartContainer: {Args: []ArgSpec{{Name: "container", Optional: true}}, Options: []string{"drain"}},
+	rollingRestart:   {Args: []ArgSpec{{Name: "serviço"}}, Options: []string{"batch"}},
+	compareEnvs:      {Args: []ArgSpec{{Name: "ambiente"}, {Name: "outro-ambiente"}, {Name: "stack"}}, Options: []string{}},
+	capacity:         {Args: []ArgSpec{}, Options: []string{}},
+	imageGC:          {Args: []ArgSpec{{Name: "host", Optional: true}}, Options: []string{"dangling"}},
+	stackGraph:       {Args: []ArgSpec{{Name: "stack"}}, Options: []string{}},
+	serviceStats:     {Args: []ArgSpec{{Name: "serviço"}}, Options: []string{"duration"}},
+	silenceExpire:    {Args: []ArgSpec{{Name: "id-do-silence"}}, Options: []string{}},
+	inspectContainer: {Args: []ArgSpec{{Name: "container", Optional: true}}, Options: []string{}},
+	quotaOverride:    {Args: []ArgSpec{{Name: "time"}, {Name: "cota"}, {Name: "quantidade"}}, Options: []string{}},
+	validateConfig:   {Args: []ArgSpec{{Name: "serviço"}, {Name: "nova-imagem", Optional: true}}, Options: []string{}},
+	stackSnapshot:    {Args: []ArgSpec{{Name: "stack"}}, Options: []string{}},
+	stackRestore:     {Args: []ArgSpec{{Name: "stack"}, {Name: "id-do-snapshot", Optional: true}}, Options: []string{}},
+	cloneStack:       {Args: []ArgSpec{{Name: "ambiente-origem"}, {Name: "ambiente-destino"}, {Name: "stack"}}, Options: []string{}},
+}
+
+// commandGroups mapeiam a forma "grupo ação" (ex.: canary enable) para os
+// comandos do BOT, os mesmos usados pelos menus e botões
+var commandGroups = map[string]map[string]string{
+	"canary": {
+		"enable":  canaryActivate,
+		"disable": canaryDisable,
+		"info":    canaryInfo,
+		"update":  canaryUpdate,
+		"list":    haproxyList,
+	},
+	"service": {
+		"info":    getServiceInfo,
+		"logs":    serviceLogs,
+		"restart": restartService,
+		"scale":   scaleService,
+		"upgrade": upgradeService,
+		"list":    listService,
+	},
+	"container": {
+		"logs":    logsContainer,
+		"restart": restartContainer,
+		"stream":  streamLogs,
+		"inspect": inspectContainer,
+	},
+	"terraform": {
+		"plan": terraformPlan,
+	},
+	"audit": {
+		"export": auditExport,
+	},
+	"rolling": {
+		"restart": rollingRestart,
+	},
+	"silence": {
+		"create": silenceCreate,
+		"list":   silenceList,
+		"expire": silenceExpire,
+	},
+	"quota": {
+		"status":   quotaStatus,
+		"override": quotaOverride,
+	},
+	"lb": {
+		"ab":    abSplit,
+		"list":  haproxyList,
+		"stats": lbStats,
+	},
+}
+
+// CommandArgs é o comando mencionado já separado em argumentos posicionais e
+// opções (chave=valor ou --chave valor)
+type CommandArgs struct {
+	Command    string
+	Positional []string
+	Options    map[string]string
+	Flags      []string
+}
+
+// ParseCommandArgs separa o texto após a menção ao BOT. A forma "grupo ação"
+// (ex.: canary enable lb-edge) é trocada pelo comando (enable-canary) e as
+// opções --chave=valor e --chave valor viram chave=valor. As flags --dry-run e
+// --apply são mantidas para o parseDryRun
+func ParseCommandArgs(words []string) CommandArgs {
+	args := CommandArgs{Options: map[string]string{}}
+	if len(words) == 0 {
+		return args
+	}
+
+	args.Command = words[0]
+	words = words[1:]
+
+	if group, ok := commandGroups[args.Command]; ok && len(words) > 0 {
+		if command, ok := group[strings.ToLower(words[0])]; ok {
+			args.Command = command
+			words = words[1:]
+		}
+	}
+
+	spec := commandSpecs[args.Command]
+
+	for i := 0; i < len(words); i++ {
+		// O Slack pode trocar o "--" por um travessão
+		word := strings.Replace(words[i], "—", "--", 1)
+
+		switch {
+		case word == "":
+		// Aceitando também o formato "from 14:00 to 14:30"
+		case containsString(spec.Options, word) && i+1 < len(words):
+			args.Options[word] = words[i+1]
+			i++
+		case word == flagDryRun || word == flagApply:
+			args.Flags = append(args.Flags, word)
+		case strings.HasPrefix(word, "--"):
+			kv := strings.SplitN(strings.TrimPrefix(word, "--"), "=", 2)
+			if len(kv) == 1 && i+1 < len(words) && !strings.HasPrefix(words[i+1], "--") {
+				kv = append(kv, words[i+1])
+				i++
+			}
+			if len(kv) == 1 {
+				kv = append(kv, "true")
+			}
+			args.Options[kv[0]] = kv[1]
+		case strings.Contains(word, "=") && !strings.HasPrefix(word, "<"):
+			kv := strings.SplitN(word, "=", 2)
+			args.Options[kv[0]] = kv[1]
+		default:
+			args.Positional = append(args.Positional, words[i])
+		}
+	}
+
+	// canary enable lb-edge 25% ativa o Canary com 25% na nova versão
+	if args.Command == canaryActivate && len(args.Positional) == 2 {
+		if weight, err := parsePercent(args.Positional[1]); err == nil {
+			args.Command = canaryUpdate
+			args.Positional = []string{args.Positional[0], strconv.Itoa(weight), strconv.Itoa(100 - weight)}
+		}
+	}
+
+	return args
+}
+
+// Text monta o texto do comando no formato lido pelos comandos (posicionais
+// seguidos de chave=valor), com a menção ao BOT
+func (args CommandArgs) Text(botID string) string {
+	words := []string{fmt.Sprintf("<@%s>", botID), args.Command}
+	words = append(words, args.Positional...)
+
+	// Mantendo a ordem das opções dos logs (ex.: from antes do to)
+	for _, key := range logsOptions {
+		if value, ok := args.Options[key]; ok {
+			words = append(words, key+"="+value)
+		}
+	}
+	for key, value := range args.Options {
+		if !containsString(logsOptions, key) {
+			words = append(words, key+"="+value)
+		}
+	}
+
+	return strings.Join(append(words, args.Flags...), " ")
+}
+
+// parsePercent lê um peso de 0 a 100, com ou sem o % (ex.: 25%)
+func parsePercent(value string) (int, error) {
+	percent, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("`%s` não é uma porcentagem de 0 a 100", value)
+	}
+
+	return percent, nil
+}
+
+// Validate confere os argumentos com o commandSpecs do comando, retornando o
+// erro com o uso correto. Os pesos (ex.: 25%) são normalizados para o número
+func (args *CommandArgs) Validate() error {
+	spec, ok := commandSpecs[args.Command]
+	if !ok {
+		return nil
+	}
+
+	required := 0
+	for _, arg := range spec.Args {
+		if !arg.Optional {
+			required++
+		}
+	}
+
+	switch {
+	case len(args.Positional) < required:
+		return args.usageError(fmt.Sprintf("faltou o argumento `%s`", spec.Args[len(args.Positional)].Name))
+	case len(args.Positional) > len(spec.Args) && spec.Args != nil:
+		return args.usageError(fmt.Sprintf("argumentos a mais: `%s`", strings.Join(args.Positional[len(spec.Args):], " ")))
+	}
+
+	for i, value := range args.Positional {
+		if i >= len(spec.Args) {
+			break
+		}
+
+		arg := spec.Args[i]
+		switch arg.Kind {
+		case argInt:
+			if n, err := strconv.Atoi(value); err != nil || n < 0 {
+				return args.usageError(fmt.Sprintf("`%s` deve ser um número maior ou igual a zero, recebido `%s`", arg.Name, value))
+			}
+		case argPercent:
+			percent, err := parsePercent(value)
+			if err != nil {
+				return args.usageError(fmt.Sprintf("`%s`: %s", arg.Name, err))
+			}
+			args.Positional[i] = strconv.Itoa(percent)
+		}
+	}
+
+	if spec.Options != nil {
+		for key := range args.Options {
+			if !containsString(spec.Options, key) {
+				return args.usageError(fmt.Sprintf("opção desconhecida `%s`", key))
+			}
+		}
+	}
+
+	return nil
+}
+
+// usageError é o erro de argumentos com o uso do comando, do Commands
+func (args CommandArgs) usageError(reason string) error {
+	for _, cmd := range Commands {
+		if cmd.Cmd == args.Command {
+			return fmt.Errorf("Erro na chamada do comando, %s. Uso: %s\n_%s_", reason, commandExample(cmd), cmd.Lint)
+		}
+	}
+
+	return fmt.Errorf("Erro na chamada do comando, %s", reason)
+}
@@ -0,0 +1,99 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCommandArgs(t *testing.T) {
+	tests := []struct {
+		text       string
+		command    string
+		positional []string
+		options    map[string]string
+		flags      []string
+	}{
+		{"scale-service payments 3", scaleService, []string{"payments", "3"}, map[string]string{}, nil},
+		{"service scale payments 3", scaleService, []string{"payments", "3"}, map[string]string{}, nil},
+		{"canary enable lb-edge 25%", canaryUpdate, []string{"lb-edge", "25", "75"}, map[string]string{}, nil},
+		{"canary enable lb-edge", canaryActivate, []string{"lb-edge"}, map[string]string{}, nil},
+		{"logs-service payments lines=50", serviceLogs, []string{"payments"}, map[string]string{"lines": "50"}, nil},
+		{"logs-service payments from 14:00 to 14:30", serviceLogs, []string{"payments"}, map[string]string{"from": "14:00", "to": "14:30"}, nil},
+		{"logs-service payments --grep timeout", serviceLogs, []string{"payments"}, map[string]string{"grep": "timeout"}, nil},
+		{"logs-service payments —lines=10", serviceLogs, []string{"payments"}, map[string]string{"lines": "10"}, nil},
+		{"restart-container 1i5 --drain", restartContainer, []string{"1i5"}, map[string]string{"drain": "true"}, nil},
+		{"upgrade-service payments docker:payments:1.5 --dry-run", upgradeService, []string{"payments", "docker:payments:1.5"}, map[string]string{}, []string{flagDryRun}},
+	}
+
+	for _, test := range tests {
+		args := ParseCommandArgs(strings.Fields(test.text))
+
+		if args.Command != test.command {
+			t.Errorf("%q: comando %s, esperado %s", test.text, args.Command, test.command)
+		}
+		if !reflect.DeepEqual(args.Positional, test.positional) {
+			t.Errorf("%q: posicionais %v, esperado %v", test.text, args.Positional, test.positional)
+		}
+		if !reflect.DeepEqual(args.Options, test.options) {
+			t.Errorf("%q: opções %v, esperado %v", test.text, args.Options, test.options)
+		}
+		if !reflect.DeepEqual(args.Flags, test.flags) {
+			t.Errorf("%q: flags %v, esperado %v", test.text, args.Flags, test.flags)
+		}
+	}
+}
+
+func TestParseCommandArgsEmpty(t *testing.T) {
+	args := ParseCommandArgs(nil)
+	if args.Command != "" || len(args.Positional) != 0 || args.Options == nil {
+		t.Errorf("ParseCommandArgs sem palavras retornou %+v", args)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		text string
+		err  string
+	}{
+		{"scale-service payments 3", ""},
+		{"scale-service payments", "faltou o argumento `quantidade`"},
+		{"scale-service payments -1", "deve ser um número maior ou igual a zero"},
+		{"scale-service payments três", "deve ser um número maior ou igual a zero"},
+		{"scale-service payments 3 4", "argumentos a mais: `4`"},
+		{"scale-service payments 3 lines=10", "opção desconhecida `lines`"},
+		{"update-canary lb-edge 90% 10", ""},
+		{"update-canary lb-edge 190 10", "não é uma porcentagem de 0 a 100"},
+		{"logs-service", ""},
+		{"logs-service payments since=1h", ""},
+		{"comando-sem-spec qualquer coisa=1", ""},
+	}
+
+	for _, test := range tests {
+		args := ParseCommandArgs(strings.Fields(test.text))
+		err := args.Validate()
+
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%q: erro inesperado %s", test.text, err)
+		case test.err != "" && err == nil:
+			t.Errorf("%q: sem erro, esperado %q", test.text, test.err)
+		case test.err != "" && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%q: erro %q, esperado %q", test.text, err, test.err)
+		}
+	}
+}
+
+func TestValidateNormalizesPercent(t *testing.T) {
+	args := ParseCommandArgs(strings.Fields("update-canary lb-edge 90% 10%"))
+	if err := args.Validate(); err != nil {
+		t.Fatalf("Validate: %s", err)
+	}
+
+	if !reflect.DeepEqual(args.Positional, []string{"lb-edge", "90", "10"}) {
+		t.Errorf("pesos normalizados %v, esperado [lb-edge 90 10]", args.Positional)
+	}
+}
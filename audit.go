@@ -0,0 +1,251 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// Origens das entradas do audit
+const (
+	auditSourceSlack = "slack"
+	auditSourceAPI   = "api"
+	auditSourceJob   = "job"
+)
+
+// AuditLogSize é a quantidade de entradas do audit mantidas em memória para
+// as consultas, as mais antigas são descartadas
+var AuditLogSize = 1000
+
+// AuditAdmins são os usuários (IDs, nomes ou @papel do RBAC_ROLES) que podem
+// exportar o audit
+var AuditAdmins = []string{"@admin"}
+
+// AuditEntry é uma ação executada pelo BOT: comando, botão, menu, chamada
+// da API admin ou o fim de um deploy (Service e Duration)
+type AuditEntry struct {
+	At       time.Time     `json:"at"`
+	Source   string        `json:"source"`
+	User     string        `json:"user"`
+	Action   string        `json:"action"`
+	Value    string        `json:"value,omitempty"`
+	Channel  string        `json:"channel,omitempty"`
+	Tenant   string        `json:"tenant,omitempty"`
+	Status   int           `json:"status,omitempty"`
+	Service  string        `json:"service,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// AuditFilter são os filtros da consulta ao audit. Campos vazios não filtram
+type AuditFilter struct {
+	User   string
+	Action string
+	Source string
+	Tenant string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+var (
+	auditLog   []AuditEntry
+	auditMutex sync.Mutex
+)
+
+// RecordAudit registra a ação no log e no audit consultável
+func RecordAudit(entry AuditEntry) {
+	if entry.At.IsZero() {
+		entry.At = time.Now()
+	}
+	if tenant := TenantForChannel(entry.Channel); entry.Tenant == "" && tenant != nil {
+		entry.Tenant = tenant.Name
+	}
+
+	log.Printf("[AUDIT] origem=%s usuário=%s ação=%s valor=%q canal=%s status=%d\n", entry.Source, entry.User, entry.Action, entry.Value, entry.Channel, entry.Status)
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	auditLog = append(auditLog, entry)
+	if AuditLogSize > 0 && len(auditLog) > AuditLogSize {
+		auditLog = append([]AuditEntry{}, auditLog[len(auditLog)-AuditLogSize:]...)
+	}
+}
+
+// QueryAudit retorna as entradas do audit que passam no filtro, a mais
+// recente primeiro
+func QueryAudit(filter AuditFilter) []AuditEntry {
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	entries := []AuditEntry{}
+	for i := len(auditLog) - 1; i >= 0; i-- {
+		entry := auditLog[i]
+
+		switch {
+		case filter.User != "" && !strings.EqualFold(entry.User, filter.User):
+			continue
+		case filter.Action != "" && entry.Action != filter.Action:
+			continue
+		case filter.Source != "" && entry.Source != filter.Source:
+			continue
+		case filter.Tenant != "" && entry.Tenant != filter.Tenant:
+			continue
+		case !filter.Since.IsZero() && entry.At.Before(filter.Since):
+			continue
+		case !filter.Until.IsZero() && !entry.At.Before(filter.Until):
+			continue
+		}
+
+		entries = append(entries, entry)
+		if filter.Limit > 0 && len(entries) >= filter.Limit {
+			break
+		}
+	}
+
+	return entries
+}
+
+// auditRelativeRange é o período relativo do audit export, ex.: 7d, 12h
+var auditRelativeRange = regexp.MustCompile(`^(\d+)([dh])$`)
+
+// parseAuditRange lê o período do audit export: relativo (7d, 12h), um dia
+// (2024-03-12) ou um intervalo de dias (2024-03-01..2024-03-12), com as
+// datas no MessagesTimezone. Retorna o início e o fim (exclusivo)
+func parseAuditRange(value string, now time.Time) (time.Time, time.Time, error) {
+	if match := auditRelativeRange.FindStringSubmatch(value); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		unit := time.Hour
+		if match[2] == "d" {
+			unit = 24 * time.Hour
+		}
+
+		return now.Add(-time.Duration(n) * unit), now, nil
+	}
+
+	days := strings.SplitN(value, "..", 2)
+	if len(days) == 1 {
+		days = append(days, days[0])
+	}
+
+	start, err := time.ParseInLocation("2006-01-02", days[0], MessagesTimezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("período `%s` inválido, use 7d, 12h, 2024-03-12 ou 2024-03-01..2024-03-12", value)
+	}
+
+	end, err := time.ParseInLocation("2006-01-02", days[1], MessagesTimezone)
+	if err != nil || end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("período `%s` inválido, use 7d, 12h, 2024-03-12 ou 2024-03-01..2024-03-12", value)
+	}
+
+	return start, end.AddDate(0, 0, 1), nil
+}
+
+// auditCSV é a exportação do audit em CSV, uma linha por entrada
+func auditCSV(entries []AuditEntry) []byte {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	writer.Write([]string{"at", "source", "user", "action", "value", "channel", "tenant", "status", "service", "duration_seconds"})
+	for _, entry := range entries {
+		duration := ""
+		if entry.Duration > 0 {
+			duration = strconv.FormatFloat(entry.Duration.Seconds(), 'f', 0, 64)
+		}
+
+		writer.Write([]string{
+			entry.At.Format(time.RFC3339),
+			entry.Source,
+			entry.User,
+			entry.Action,
+			entry.Value,
+			entry.Channel,
+			entry.Tenant,
+			strconv.Itoa(entry.Status),
+			entry.Service,
+			duration,
+		})
+	}
+	writer.Flush()
+
+	return buf.Bytes()
+}
+
+// slackAuditExport envia no canal a exportação (CSV ou JSON) do audit no
+// período, a entrada mais antiga primeiro. Só para os AuditAdmins; nos canais
+// dos times também para o @admin do time, com só as entradas do time
+func (s *SlackListener) slackAuditExport(ev *slack.MessageEvent) {
+	userName := ev.Msg.User
+	if info, err := s.client.GetUserInfo(ev.Msg.User); err == nil && info.Name != "" {
+		userName = info.Name
+	}
+
+	filter := AuditFilter{}
+	allowed := userAllowed(AuditAdmins, ev.Msg.User, userName)
+	if tenant := TenantForChannel(ev.Channel); tenant != nil {
+		filter.Tenant = tenant.Name
+		allowed = tenant.Allowed(AuditAdmins, ev.Msg.User, userName)
+	}
+
+	if !allowed {
+		log.Printf("[INFO] Usuário %s sem permissão para exportar o audit\n", userName)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: @%s não tem permissão para `%s` (%s)", userName, auditExport, formatPermissions(AuditAdmins)), false))
+		return
+	}
+
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+
+	format := strings.ToLower(args.Options["format"])
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Formato `%s` inválido, use `csv` ou `json`", format), false))
+		return
+	}
+
+	since, until, err := parseAuditRange(args.Positional[0], time.Now())
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	filter.Since, filter.Until = since, until
+	entries := QueryAudit(filter)
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	content := auditCSV(entries)
+	if format == "json" {
+		content, _ = json.MarshalIndent(entries, "", "  ")
+	}
+
+	period := fmt.Sprintf("%s a %s", localTime(since, "02/01/2006 15:04"), localTime(until, "02/01/2006 15:04"))
+	log.Printf("[INFO] Audit de %s exportado (%d entradas, %s) por %s\n", period, len(entries), format, userName)
+
+	_, err = s.client.UploadFile(slack.FileUploadParameters{
+		Content:        string(content),
+		Filetype:       format,
+		Filename:       fmt.Sprintf("audit-%s-%s.%s", localTime(since, "20060102"), localTime(until, "20060102"), format),
+		Title:          fmt.Sprintf("Audit de %s", period),
+		InitialComment: fmt.Sprintf(":ledger: Audit de %s: %d entradas, exportado por @%s", period, len(entries), userName),
+		Channels:       []string{ev.Channel},
+	})
+	if err != nil {
+		CheckErr("Erro ao enviar a exportação do audit", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao enviar a exportação do audit: %s", err), false))
+	}
+}
@@ -0,0 +1,303 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	actionBatchSelect = "batch-select"
+	actionBatchRun    = "batch-run"
+	actionBatchCancel = "batch-cancel"
+
+	batchRestart    = "restart"
+	batchLogs       = "logs"
+	batchDeactivate = "deactivate"
+
+	batchServices   = "services"
+	batchContainers = "containers"
+
+	// batchMaxOptions é a quantidade máxima de opções do multi_static_select
+	batchMaxOptions = 100
+)
+
+// batchActionNames são os nomes das ações mostrados nas mensagens
+var batchActionNames = map[string]string{
+	batchRestart:    "Reiniciar",
+	batchLogs:       "Buscar os logs de",
+	batchDeactivate: "Desativar",
+}
+
+// batchProgressNames descrevem o andamento de cada ação na mensagem de progresso
+var batchProgressNames = map[string]string{
+	batchRestart:    "reiniciados",
+	batchLogs:       "com os logs enviados",
+	batchDeactivate: "desativados",
+}
+
+// kitBlock é um bloco do Block Kit montado como JSON, para os elementos
+// que a biblioteca do Slack ainda não tem (ex.: multi_static_select)
+type kitBlock map[string]interface{}
+
+func (b kitBlock) BlockType() slack.MessageBlockType {
+	return slack.MessageBlockType(fmt.Sprint(b["type"]))
+}
+
+func plainText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "plain_text", "text": text}
+}
+
+// batchTargets lista os serviços ou containers que podem ser escolhidos
+func batchTargets(kind string) ([]map[string]interface{}, error) {
+	var options []map[string]interface{}
+	add := func(id string, name string) {
+		if len(options) < batchMaxOptions {
+			options = append(options, map[string]interface{}{"text": plainText(truncateOption(name)), "value": id})
+		}
+	}
+
+	if kind == batchContainers {
+		if orchestrator.Name() != "rancher" {
+			return nil, fmt.Errorf("a ação em containers só está disponível no Rancher")
+		}
+
+		containers, err := rancherListener.ListContainers()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, container := range containers {
+			add(container.ID, container.Name)
+		}
+
+		return options, nil
+	}
+
+	for _, service := range serviceIndex.Services() {
+		add(service.ID, service.Name)
+	}
+
+	return options, nil
+}
+
+// truncateOption corta o texto da opção no limite de 75 caracteres do Slack
+func truncateOption(text string) string {
+	if len(text) > 75 {
+		return text[:72] + "..."
+	}
+
+	return text
+}
+
+// slackBatch envia a seleção múltipla de serviços ou containers para
+// executar a mesma ação em todos de uma vez
+func (s *SlackListener) slackBatch(ev *slack.MessageEvent) {
+	args := strings.Fields(ev.Msg.Text)
+
+	if len(args) < 3 || batchActionNames[args[2]] == "" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s restart|logs|deactivate services|containers", batch), false))
+		return
+	}
+
+	action, kind := args[2], batchServices
+	if len(args) > 3 {
+		kind = args[3]
+	}
+
+	if kind != batchServices && kind != batchContainers {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText("O tipo deve ser `services` ou `containers`", false))
+		return
+	}
+
+	if action == batchDeactivate && kind == batchServices && orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText("A desativação de serviços só está disponível no Rancher, use o `scale-service` com 0 instâncias", false))
+		return
+	}
+
+	options, err := batchTargets(kind)
+	if err != nil {
+		CheckErr("Erro ao listar os alvos do batch", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao listar os %s: %s", kind, err), false))
+		return
+	}
+
+	if len(options) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Nenhum item encontrado em %s", kind), false))
+		return
+	}
+
+	text := fmt.Sprintf("*%s* os %s selecionados", batchActionNames[action], map[string]string{batchServices: "serviços", batchContainers: "containers"}[kind])
+
+	blocks := []slack.Block{
+		kitBlock{
+			"type": "section",
+			"text": map[string]interface{}{"type": "mrkdwn", "text": text},
+			"accessory": map[string]interface{}{
+				"type":        "multi_static_select",
+				"action_id":   actionBatchSelect,
+				"placeholder": plainText("Selecione"),
+				"options":     options,
+			},
+		},
+		kitBlock{
+			"type": "actions",
+			"elements": []map[string]interface{}{
+				{
+					"type":      "button",
+					"action_id": actionBatchRun,
+					"text":      plainText("Executar"),
+					"style":     "danger",
+					"value":     action + "|" + kind,
+					"confirm": map[string]interface{}{
+						"title":   plainText("Tem certeza?"),
+						"text":    plainText("A ação será executada em todos os itens selecionados"),
+						"confirm": plainText("Sim"),
+						"deny":    plainText("Não"),
+					},
+				},
+				{
+					"type":      "button",
+					"action_id": actionBatchCancel,
+					"text":      plainText("Cancelar"),
+				},
+			},
+		},
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...))
+}
+
+// runBatchTarget executa a ação em um serviço ou container
+func runBatchTarget(ctx context.Context, action string, kind string, ID string, user string) error {
+	switch {
+	case action == batchRestart && kind == batchServices:
+		if err := orchestrator.RestartService(ID); err != nil {
+			return err
+		}
+		RecordChange(ChangeEvent{Kind: "restart", ServiceID: ID, User: user})
+		return nil
+	case action == batchRestart:
+		return rancherListener.RestartContainer(ID)
+	case action == batchLogs && kind == batchServices:
+		return UploadServiceLogs(ctx, ID, LogsOptions{Lines: defaultLogsLines}, nil)
+	case action == batchLogs:
+		_, err := UploadContainerLogs(ID, LogsOptions{Lines: defaultLogsLines})
+		return err
+	case action == batchDeactivate && kind == batchServices:
+		if err := rancherListener.DeactivateService(ID); err != nil {
+			return rancherFailure(cacheServices, fmt.Errorf("erro ao desativar o serviço %s: %w", ID, err))
+		}
+		RecordChange(ChangeEvent{Kind: "deactivate", ServiceID: ID, User: user})
+		return nil
+	case action == batchDeactivate:
+		if _, err := rancherListener.StopContainer(ID); err != nil {
+			return fmt.Errorf("erro ao parar o container %s: %w", ID, err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("ação %s não suportada", action)
+}
+
+func actionBatchSelectFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	// A seleção é lida do state da mensagem quando o Executar é clicado
+	w.WriteHeader(http.StatusOK)
+}
+
+func actionBatchRunFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	api := getAPIConnection()
+	action := message.Actions[0]
+
+	parts := strings.SplitN(action.Value, "|", 2)
+	if len(parts) != 2 {
+		return
+	}
+
+	var targets []string
+	for _, option := range action.SelectedOptions {
+		targets = append(targets, option.Value)
+	}
+
+	if len(targets) == 0 {
+		postEphemeral(message.Channel.ID, message.User.ID, msgBatchSelectTarget)
+		return
+	}
+
+	name := fmt.Sprintf("%s em %d %s", parts[0], len(targets), parts[1])
+	user := message.User.Name
+	channel, ts := message.Channel.ID, message.MessageTs
+
+	title := fmt.Sprintf("*%s* %d %s, solicitado por @%s", batchActionNames[parts[0]], len(targets), parts[1], user)
+	api.client.UpdateMessage(channel, ts, slack.MsgOptionText(":hourglass_flowing_sand: "+title, false), slack.MsgOptionBlocks([]slack.Block{}...))
+
+	job, err := EnqueueJobContext("batch "+name, user, func(ctx context.Context) error {
+		progress := ResumeProgress(channel, ts, title, JobFromContext(ctx))
+
+		var lines, deactivated []string
+		done, failed := 0, 0
+
+		for i, target := range targets {
+			progress.Update(i, len(targets), batchProgressNames[parts[0]])
+
+			// Cancelado: os alvos restantes não são executados
+			if ctx.Err() != nil {
+				lines = append(lines, fmt.Sprintf(":no_entry_sign: %d não executados (cancelado)", len(targets)-i))
+				break
+			}
+
+			if err := runBatchTarget(ctx, parts[0], parts[1], target, user); err != nil {
+				CheckErr(fmt.Sprintf("Erro no batch %s em %s", parts[0], target), err)
+				lines = append(lines, fmt.Sprintf(":x: `%s`: %s", target, err))
+				failed++
+				continue
+			}
+
+			lines = append(lines, fmt.Sprintf(":white_check_mark: `%s`", target))
+			done++
+
+			if parts[0] == batchDeactivate {
+				deactivated = append(deactivated, target)
+			}
+		}
+
+		log.Printf("[INFO] Batch %s executado pelo usuário %s, %d falhas\n", name, user, failed)
+
+		summary := fmt.Sprintf("%d com sucesso, %d com erro\n%s", done, failed, strings.Join(lines, "\n"))
+		if len(deactivated) > 0 {
+			// O desfazer volta só os que foram desativados
+			progress.FinishWithUndo(done == len(targets), summary, undoBatchDeactivate(parts[1], deactivated))
+		} else {
+			progress.Finish(done == len(targets), summary)
+		}
+
+		if done+failed < len(targets) {
+			return fmt.Errorf("%d de %d executados", done+failed, len(targets))
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d de %d falharam", failed, len(targets))
+		}
+
+		return nil
+	})
+	interactionJob(w, job, err)
+	if err != nil {
+		sendMessage(queuedJobMessage(job, err))
+	}
+}
+
+func actionBatchCancelFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	getAPIConnection().client.DeleteMessage(message.Channel.ID, message.MessageTs)
+}
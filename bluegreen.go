@@ -0,0 +1,446 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	actionBlueGreenSwitch     = "blue-green-switch"
+	actionBlueGreenSwitchBack = "blue-green-switch-back"
+	actionBlueGreenCleanup    = "blue-green-cleanup"
+	actionBlueGreenCancel     = "blue-green-cancel"
+	blueGreenCallback         = "blue-green"
+
+	// blueGreenTTL é o tempo que os botões do blue/green continuam válidos
+	blueGreenTTL = 24 * time.Hour
+)
+
+// BlueGreen é um deploy blue/green em andamento: a cor nova (Candidate)
+// sobe ao lado da atual (Live) e o LB só troca de uma para a outra na
+// confirmação
+type BlueGreen struct {
+	ID            string
+	LB            string
+	LiveID        string
+	LiveName      string
+	CandidateID   string
+	CandidateName string
+	Image         string
+	User          string
+	Started       time.Time
+
+	// Switched indica se o tráfego do LB já está na cor nova. Só é alterado
+	// por quem reservou o blue/green (busy), com o blueGreensMutex travado
+	Switched bool
+
+	// busy indica que um dos botões está em andamento, para dois cliques
+	// (ex.: trocar e cancelar) não agirem ao mesmo tempo
+	busy bool
+}
+
+var (
+	blueGreens      = map[string]*BlueGreen{}
+	blueGreensMutex sync.Mutex
+)
+
+// blueGreenColors separa o nome do serviço na base e na cor (blue ou
+// green). Serviços sem a cor no nome são o blue
+func blueGreenColors(name string) (string, string) {
+	for _, color := range []string{"blue", "green"} {
+		if strings.HasSuffix(name, "-"+color) {
+			return strings.TrimSuffix(name, "-"+color), color
+		}
+	}
+
+	return name, "blue"
+}
+
+// blueGreenCandidateName é o nome da outra cor do serviço, ex.:
+// payments e payments-blue viram payments-green
+func blueGreenCandidateName(name string) string {
+	base, color := blueGreenColors(name)
+	if color == "blue" {
+		return base + "-green"
+	}
+
+	return base + "-blue"
+}
+
+// blueGreenColor é a cor do serviço, para os botões
+func blueGreenColor(name string) string {
+	_, color := blueGreenColors(name)
+	return color
+}
+
+func (s *SlackListener) slackBlueGreen(ev *slack.MessageEvent) {
+	args := strings.Fields(ev.Msg.Text)
+
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", blueGreen), false))
+		return
+	}
+
+	serviceID, ok := s.resolveServiceArg(ev.Channel, args[2])
+	if !ok {
+		return
+	}
+	lbID, image := args[3], args[4]
+	if !s.allowTargetArg(ev.Channel, lbID) {
+		return
+	}
+
+	if !strings.HasPrefix(image, "docker:") {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText("O nome da imagem deve começar com 'docker:'. Ex.: docker:ubuntu:14.04", false))
+		return
+	}
+
+	if err := CheckUpgradePolicy(serviceID, image); err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: Deploy bloqueado: %s", err), false))
+		return
+	}
+
+	service, err := rancherListener.GetService(serviceID)
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao buscar o serviço `%s`: %s", serviceID, err), false))
+		return
+	}
+
+	if _, err := rancherListener.GetLoadBalancer(lbID); err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: LoadBalancer `%s` não encontrado", lbID), false))
+		return
+	}
+
+	candidateName := blueGreenCandidateName(service.Name)
+	if existing, err := serviceIndex.Resolve(candidateName); err == nil && serviceIndex.Name(existing) == candidateName {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: O serviço `%s` (cor anterior) ainda existe, remova-o antes de um novo blue/green", candidateName), false))
+		return
+	}
+
+	if s.dryRun != nil {
+		s.rancher().CloneService(serviceID, candidateName, image)
+		s.finishDryRun(ev, blueGreen)
+		return
+	}
+
+	bg := &BlueGreen{
+		ID:            fmt.Sprintf("%d", time.Now().UnixNano()),
+		LB:            lbID,
+		LiveID:        serviceID,
+		LiveName:      service.Name,
+		CandidateName: candidateName,
+		Image:         image,
+		User:          ev.Msg.User,
+		Started:       time.Now(),
+	}
+
+	channel := ev.Channel
+	job, err := EnqueueJobContext(fmt.Sprintf("blue/green do serviço %s", service.Name), ev.Msg.User, func(ctx context.Context) error {
+		return deployBlueGreen(ctx, channel, bg)
+	})
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(queuedJobMessage(job, err), false))
+	}
+}
+
+// deployBlueGreen sobe a cor nova e espera ela ficar saudável, oferecendo
+// a troca do tráfego. Quando a cor nova não fica saudável ela é removida
+func deployBlueGreen(ctx context.Context, channel string, bg *BlueGreen) error {
+	title := fmt.Sprintf("*Blue/green* do serviço `%s` para `%s`, por @%s", bg.LiveName, bg.Image, bg.User)
+	progress := StartProgress(channel, title, JobFromContext(ctx))
+
+	candidate, err := rancherListener.CloneService(bg.LiveID, bg.CandidateName, bg.Image)
+	if err != nil {
+		err = fmt.Errorf("erro ao criar o serviço %s: %s", bg.CandidateName, err)
+		progress.Finish(false, err.Error())
+		return err
+	}
+	bg.CandidateID = candidate.ID
+
+	log.Printf("[INFO] Serviço %s (%s) criado para o blue/green de %s pelo usuário %s\n", bg.CandidateName, bg.CandidateID, bg.LiveID, bg.User)
+
+	if err := waitServiceHealthy(ctx, bg.CandidateID, progress); err != nil {
+		if removeErr := rancherListener.RemoveService(bg.CandidateID); removeErr != nil {
+			err = fmt.Errorf("o serviço %s não ficou saudável (%s) e não foi removido: %s", bg.CandidateName, err, removeErr)
+		} else {
+			err = fmt.Errorf("o serviço %s não ficou saudável e foi removido: %s", bg.CandidateName, err)
+		}
+		progress.Finish(false, err.Error())
+		RecordDeployAudit(auditDeploy, bg.LiveID, bg.Image, bg.User, bg.Started, err)
+		return err
+	}
+
+	progress.Finish(true, fmt.Sprintf("Serviço `%s` saudável com a imagem `%s`", bg.CandidateName, bg.Image))
+
+	attachment := blueGreenAttachment(bg)
+
+	blueGreensMutex.Lock()
+	blueGreens[bg.ID] = bg
+	blueGreensMutex.Unlock()
+
+	getAPIConnection().client.PostMessage(channel, slack.MsgOptionAttachments(attachment))
+
+	return nil
+}
+
+// waitServiceHealthy acompanha o serviço até ele estar ativo, com todas as
+// instâncias rodando e saudável, o ctx ser cancelado ou passar o
+// UpgradeProgressTimeout
+func waitServiceHealthy(ctx context.Context, serviceID string, progress *Progress) error {
+	deadline := time.Now().Add(UpgradeProgressTimeout)
+
+	for {
+		service, err := rancherListener.GetService(serviceID)
+		if err != nil {
+			return fmt.Errorf("erro ao buscar o serviço %s: %s", serviceID, err)
+		}
+
+		instances, err := rancherListener.ListServiceInstances(serviceID)
+		if err != nil {
+			return fmt.Errorf("erro ao buscar as instâncias do serviço %s: %s", serviceID, err)
+		}
+
+		running := 0
+		for _, instance := range instances {
+			if instance.State == "running" && (instance.HealthState == "" || instance.HealthState == "healthy") {
+				running++
+			}
+		}
+
+		if service.State == "active" && service.HealthState == "healthy" && running >= service.Scale {
+			return nil
+		}
+
+		progress.Update(running, service.Scale, "instâncias saudáveis")
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d/%d instâncias saudáveis em %s", running, service.Scale, UpgradeProgressTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d/%d instâncias saudáveis", running, service.Scale)
+		case <-time.After(upgradePollInterval):
+		}
+	}
+}
+
+// blueGreenAttachment é a mensagem do blue/green com os botões da fase:
+// antes da troca, trocar o tráfego ou cancelar (remove a cor nova); depois,
+// voltar o tráfego ou remover a cor antiga
+func blueGreenAttachment(bg *BlueGreen) slack.Attachment {
+	live, candidate := bg.LiveName, bg.CandidateName
+
+	attachment := slack.Attachment{
+		Title:      fmt.Sprintf(":large_blue_circle: :large_green_circle: Blue/green de `%s` no LB `%s`", bg.LiveName, bg.LB),
+		Color:      "#0C648A",
+		CallbackID: blueGreenCallback,
+	}
+
+	if !bg.Switched {
+		attachment.Text = fmt.Sprintf("O tráfego está no `%s` (%s). O `%s` (%s) está saudável com a imagem `%s`", live, blueGreenColor(live), candidate, blueGreenColor(candidate), bg.Image)
+		attachment.Actions = []slack.AttachmentAction{
+			{
+				Name:  actionBlueGreenSwitch,
+				Text:  fmt.Sprintf("Trocar o tráfego para %s", blueGreenColor(candidate)),
+				Type:  "button",
+				Style: "primary",
+				Value: bg.ID,
+				Confirm: &slack.ConfirmationField{
+					Title:       "Tem certeza disso?",
+					Text:        fmt.Sprintf("Deseja mesmo trocar todo o tráfego do LB %s de %s para %s? :thinking_face:", bg.LB, live, candidate),
+					OkText:      "Sim",
+					DismissText: "Não",
+				},
+			},
+			{
+				Name:  actionBlueGreenCancel,
+				Text:  fmt.Sprintf("Cancelar e remover %s", blueGreenColor(candidate)),
+				Type:  "button",
+				Style: "danger",
+				Value: bg.ID,
+			},
+		}
+
+		return attachment
+	}
+
+	attachment.Color = "good"
+	attachment.Text = fmt.Sprintf("O tráfego está no `%s` (%s). O `%s` (%s) continua rodando para a volta", candidate, blueGreenColor(candidate), live, blueGreenColor(live))
+	attachment.Actions = []slack.AttachmentAction{
+		{
+			Name:  actionBlueGreenSwitchBack,
+			Text:  fmt.Sprintf("Voltar para %s", blueGreenColor(live)),
+			Type:  "button",
+			Style: "danger",
+			Value: bg.ID,
+		},
+		{
+			Name:  actionBlueGreenCleanup,
+			Text:  fmt.Sprintf("Remover %s", blueGreenColor(live)),
+			Type:  "button",
+			Value: bg.ID,
+			Confirm: &slack.ConfirmationField{
+				Title:       "Tem certeza disso?",
+				Text:        fmt.Sprintf("Deseja mesmo remover o serviço %s? Depois disso não é mais possível voltar :scream:", live),
+				OkText:      "Sim",
+				DismissText: "Não",
+			},
+		},
+	}
+
+	return attachment
+}
+
+// blueGreenFromAction busca o blue/green do botão e o reserva para a ação,
+// que só vale com o tráfego na fase switched. Responde quando ele não existe
+// mais, passou do blueGreenTTL, está em outra fase (wrongPhase) ou outro
+// botão dele ainda está em andamento. Quem recebe o blue/green termina com o
+// releaseBlueGreen ou o removeBlueGreen
+func blueGreenFromAction(message slack.AttachmentActionCallback, w http.ResponseWriter, switched bool, wrongPhase string) *BlueGreen {
+	blueGreensMutex.Lock()
+	defer blueGreensMutex.Unlock()
+
+	bg, ok := blueGreens[message.Actions[0].Value]
+	if !ok || time.Since(bg.Started) > blueGreenTTL {
+		delete(blueGreens, message.Actions[0].Value)
+		respondWithoutActions(w, message.OriginalMessage, ":hourglass: Esse blue/green não está mais disponível", "")
+		return nil
+	}
+
+	if bg.busy {
+		respondWithoutActions(w, message.OriginalMessage, ":hourglass_flowing_sand: Outra ação desse blue/green está em andamento", "")
+		return nil
+	}
+
+	if bg.Switched != switched {
+		respondWithoutActions(w, message.OriginalMessage, wrongPhase, "")
+		return nil
+	}
+
+	bg.busy = true
+
+	return bg
+}
+
+// releaseBlueGreen libera o blue/green reservado, com o tráfego na fase
+// switched, e retorna uma cópia para a mensagem, já que depois de liberado
+// outro botão pode alterá-lo
+func releaseBlueGreen(bg *BlueGreen, switched bool) *BlueGreen {
+	blueGreensMutex.Lock()
+	defer blueGreensMutex.Unlock()
+
+	bg.Switched = switched
+	bg.busy = false
+
+	current := *bg
+	return &current
+}
+
+// removeBlueGreen encerra o blue/green reservado
+func removeBlueGreen(bg *BlueGreen) {
+	blueGreensMutex.Lock()
+	defer blueGreensMutex.Unlock()
+
+	delete(blueGreens, bg.ID)
+}
+
+// updateBlueGreenMessage troca a mensagem do botão pela fase atual do
+// blue/green, com o que aconteceu no rodapé
+func updateBlueGreenMessage(message slack.AttachmentActionCallback, attachment slack.Attachment, footer string) {
+	attachment.Footer = footer
+	getAPIConnection().client.UpdateMessage(message.Channel.ID, message.MessageTs, slack.MsgOptionText("", false), slack.MsgOptionAttachments(attachment))
+}
+
+// actionBlueGreenSwitchFunction troca o tráfego do LB para a cor nova
+func actionBlueGreenSwitchFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	bg := blueGreenFromAction(message, w, false, ":x: O tráfego já está na cor nova")
+	if bg == nil {
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := rancherListener.SetLoadBalancerTarget(bg.LB, bg.LiveID, bg.CandidateID); err != nil {
+		updateBlueGreenMessage(message, blueGreenAttachment(releaseBlueGreen(bg, false)), fmt.Sprintf(":x: Erro ao trocar o tráfego: %s", err))
+		return
+	}
+
+	bg = releaseBlueGreen(bg, true)
+
+	log.Printf("[INFO] Tráfego do LB %s trocado de %s para %s pelo usuário %s\n", bg.LB, bg.LiveID, bg.CandidateID, message.User.Name)
+	RecordChange(ChangeEvent{Kind: "upgrade", ServiceID: bg.CandidateID, Image: bg.Image, User: message.User.Name})
+	RecordDeployAudit(auditDeploy, bg.CandidateID, bg.Image, message.User.Name, bg.Started, nil)
+
+	updateBlueGreenMessage(message, blueGreenAttachment(bg), fmt.Sprintf("Tráfego trocado para %s por @%s", bg.CandidateName, message.User.Name))
+}
+
+// actionBlueGreenSwitchBackFunction volta o tráfego do LB para a cor antiga
+func actionBlueGreenSwitchBackFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	bg := blueGreenFromAction(message, w, true, ":x: O tráfego não está na cor nova")
+	if bg == nil {
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	started := time.Now()
+	if _, err := rancherListener.SetLoadBalancerTarget(bg.LB, bg.CandidateID, bg.LiveID); err != nil {
+		RecordDeployAudit(auditRollback, bg.LiveID, "", message.User.Name, started, err)
+		updateBlueGreenMessage(message, blueGreenAttachment(releaseBlueGreen(bg, true)), fmt.Sprintf(":x: Erro ao voltar o tráfego: %s", err))
+		return
+	}
+
+	bg = releaseBlueGreen(bg, false)
+
+	log.Printf("[INFO] Tráfego do LB %s voltou de %s para %s pelo usuário %s\n", bg.LB, bg.CandidateID, bg.LiveID, message.User.Name)
+	RecordChange(ChangeEvent{Kind: "rollback", ServiceID: bg.LiveID, User: message.User.Name})
+	RecordDeployAudit(auditRollback, bg.LiveID, "", message.User.Name, started, nil)
+
+	updateBlueGreenMessage(message, blueGreenAttachment(bg), fmt.Sprintf(":rewind: Tráfego voltou para %s por @%s", bg.LiveName, message.User.Name))
+}
+
+// actionBlueGreenCleanupFunction remove a cor antiga depois da troca,
+// encerrando o blue/green. O próximo blue/green parte da cor nova
+func actionBlueGreenCleanupFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	bg := blueGreenFromAction(message, w, true, ":x: O tráfego não está na cor nova")
+	if bg == nil {
+		return
+	}
+
+	if err := rancherListener.RemoveService(bg.LiveID); err != nil {
+		releaseBlueGreen(bg, true)
+		respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao remover o serviço `%s`: %s", bg.LiveName, err), "")
+		return
+	}
+	removeBlueGreen(bg)
+
+	log.Printf("[INFO] Serviço %s removido ao fim do blue/green pelo usuário %s\n", bg.LiveID, message.User.Name)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":white_check_mark: Blue/green concluído por @%s: tráfego no `%s` e `%s` removido", message.User.Name, bg.CandidateName, bg.LiveName), "")
+}
+
+// actionBlueGreenCancelFunction remove a cor nova antes da troca
+func actionBlueGreenCancelFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	bg := blueGreenFromAction(message, w, false, ":x: O tráfego já está na cor nova, volte antes de cancelar")
+	if bg == nil {
+		return
+	}
+
+	if err := rancherListener.RemoveService(bg.CandidateID); err != nil {
+		releaseBlueGreen(bg, false)
+		respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao remover o serviço `%s`: %s", bg.CandidateName, err), "")
+		return
+	}
+	removeBlueGreen(bg)
+
+	log.Printf("[INFO] Blue/green de %s cancelado pelo usuário %s\n", bg.LiveID, message.User.Name)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Blue/green cancelado por @%s, `%s` removido", message.User.Name, bg.CandidateName), "")
+}
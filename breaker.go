@@ -0,0 +1,191 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+var (
+	// RancherBreakerFailures é a quantidade de falhas seguidas em um endpoint do
+	// Rancher para abrir o circuito
+	RancherBreakerFailures = 5
+
+	// RancherBreakerCooldown é o tempo com o circuito aberto antes de testar se
+	// o endpoint voltou
+	RancherBreakerCooldown = 30 * time.Second
+)
+
+// ErrRancherUnavailable é retornado sem chamar o Rancher enquanto o circuito
+// do endpoint está aberto
+var ErrRancherUnavailable = errors.New("Rancher indisponível no momento, tente novamente em instantes")
+
+// CircuitBreaker é o estado do circuito de um endpoint (services, containers,
+// loadBalancerServices...) da API do Rancher
+type CircuitBreaker struct {
+	Endpoint    string    `json:"endpoint"`
+	State       string    `json:"state"`
+	Failures    int       `json:"failures"`
+	OpenedAt    time.Time `json:"opened_at,omitempty"`
+	Transitions int       `json:"transitions"`
+	probing     bool
+}
+
+var (
+	rancherBreakers      = map[string]*CircuitBreaker{}
+	rancherBreakersMutex sync.Mutex
+)
+
+// rancherEndpoint retorna o endpoint (tipo de recurso) da URL do Rancher
+func (ranchListener *RancherListener) rancherEndpoint(url string) string {
+	path := strings.TrimPrefix(url, fmt.Sprintf("%s/%s/", ranchListener.baseURL, ranchListener.projectID))
+	path = strings.SplitN(path, "?", 2)[0]
+
+	return strings.SplitN(path, "/", 2)[0]
+}
+
+func rancherBreaker(endpoint string) *CircuitBreaker {
+	breaker, ok := rancherBreakers[endpoint]
+	if !ok {
+		breaker = &CircuitBreaker{Endpoint: endpoint, State: breakerClosed}
+		rancherBreakers[endpoint] = breaker
+	}
+
+	return breaker
+}
+
+// RancherBreakerAllow retorna se a chamada no endpoint pode ser feita. Com o
+// circuito aberto só uma chamada de teste passa depois do cooldown
+func RancherBreakerAllow(endpoint string) bool {
+	rancherBreakersMutex.Lock()
+	defer rancherBreakersMutex.Unlock()
+
+	breaker := rancherBreaker(endpoint)
+
+	switch breaker.State {
+	case breakerOpen:
+		if time.Since(breaker.OpenedAt) < RancherBreakerCooldown {
+			return false
+		}
+		breaker.setState(breakerHalfOpen)
+		breaker.probing = true
+		return true
+	case breakerHalfOpen:
+		if breaker.probing {
+			return false
+		}
+		breaker.probing = true
+	}
+
+	return true
+}
+
+// RancherBreakerRecord registra o resultado da chamada no endpoint, abrindo ou
+// fechando o circuito
+func RancherBreakerRecord(endpoint string, success bool) {
+	rancherBreakersMutex.Lock()
+
+	breaker := rancherBreaker(endpoint)
+	breaker.probing = false
+	previous := breaker.State
+
+	if success {
+		breaker.Failures = 0
+		breaker.setState(breakerClosed)
+	} else {
+		breaker.Failures++
+		if breaker.State == breakerHalfOpen || breaker.Failures >= RancherBreakerFailures {
+			breaker.OpenedAt = time.Now()
+			breaker.setState(breakerOpen)
+		}
+	}
+
+	current := breaker.State
+	rancherBreakersMutex.Unlock()
+
+	// Só avisa quando o endpoint cai ou volta, não em cada teste
+	switch {
+	case current == breakerOpen && previous == breakerClosed:
+		log.Printf("[ERROR] Circuito do endpoint %s do Rancher aberto após %d falhas\n", endpoint, RancherBreakerFailures)
+		go sendMessage(fmt.Sprintf(":no_entry: Rancher indisponível no endpoint `%s`, as ações que usam ele vão falhar na hora até ele voltar", endpoint))
+	case current == breakerClosed && previous == breakerHalfOpen:
+		log.Printf("[INFO] Circuito do endpoint %s do Rancher fechado\n", endpoint)
+		go sendNotification(fmt.Sprintf(":white_check_mark: Endpoint `%s` do Rancher voltou a responder", endpoint))
+	}
+}
+
+func (b *CircuitBreaker) setState(state string) {
+	if b.State != state {
+		b.State = state
+		b.Transitions++
+	}
+}
+
+// RancherAvailable retorna se o circuito do endpoint está fechado (ou testando)
+func RancherAvailable(endpoint string) bool {
+	rancherBreakersMutex.Lock()
+	defer rancherBreakersMutex.Unlock()
+
+	breaker, ok := rancherBreakers[endpoint]
+
+	return !ok || breaker.State != breakerOpen
+}
+
+// RancherUnavailableEndpoints retorna os endpoints com o circuito aberto
+func RancherUnavailableEndpoints() []string {
+	rancherBreakersMutex.Lock()
+	defer rancherBreakersMutex.Unlock()
+
+	var endpoints []string
+	for endpoint, breaker := range rancherBreakers {
+		if breaker.State == breakerOpen {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	sort.Strings(endpoints)
+
+	return endpoints
+}
+
+// rancherFailure retorna o ErrRancherUnavailable caso o circuito do endpoint
+// esteja aberto, ou o erro passado
+func rancherFailure(endpoint string, err error) error {
+	if !RancherAvailable(endpoint) {
+		return ErrRancherUnavailable
+	}
+
+	return err
+}
+
+// GetRancherBreakers é a rota que retorna o estado dos circuitos de cada
+// endpoint do Rancher, com a quantidade de mudanças de estado
+func GetRancherBreakers(w http.ResponseWriter, r *http.Request) {
+	rancherBreakersMutex.Lock()
+	breakers := []CircuitBreaker{}
+	for _, breaker := range rancherBreakers {
+		breakers = append(breakers, *breaker)
+	}
+	rancherBreakersMutex.Unlock()
+
+	sort.Slice(breakers, func(i, j int) bool {
+		return breakers[i].Endpoint < breakers[j].Endpoint
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(breakers)
+}
@@ -0,0 +1,116 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testBreaker troca o circuito do endpoint pelo estado passado. Os testes não
+// passam pelas mudanças que avisam no canal (fechado → aberto e testando →
+// fechado), para não chamar o Slack
+func testBreaker(endpoint string, breaker *CircuitBreaker) {
+	rancherBreakersMutex.Lock()
+	defer rancherBreakersMutex.Unlock()
+
+	if breaker == nil {
+		delete(rancherBreakers, endpoint)
+		return
+	}
+	breaker.Endpoint = endpoint
+	rancherBreakers[endpoint] = breaker
+}
+
+func breakerState(endpoint string) CircuitBreaker {
+	rancherBreakersMutex.Lock()
+	defer rancherBreakersMutex.Unlock()
+
+	return *rancherBreakers[endpoint]
+}
+
+func TestRancherBreakerClosed(t *testing.T) {
+	testBreaker("services", nil)
+	defer testBreaker("services", nil)
+
+	for i := 1; i < RancherBreakerFailures; i++ {
+		if !RancherBreakerAllow("services") {
+			t.Fatalf("chamada %d recusada com o circuito fechado", i)
+		}
+		RancherBreakerRecord("services", false)
+	}
+
+	if state := breakerState("services"); state.State != breakerClosed || state.Failures != RancherBreakerFailures-1 {
+		t.Errorf("depois de %d falhas: %s com %d falhas, esperado closed", RancherBreakerFailures-1, state.State, state.Failures)
+	}
+
+	RancherBreakerRecord("services", true)
+	if state := breakerState("services"); state.State != breakerClosed || state.Failures != 0 {
+		t.Errorf("o sucesso não zerou as falhas: %s com %d falhas", state.State, state.Failures)
+	}
+	if !RancherAvailable("services") {
+		t.Error("RancherAvailable false com o circuito fechado")
+	}
+}
+
+func TestRancherBreakerOpen(t *testing.T) {
+	defer testBreaker("containers", nil)
+
+	tests := []struct {
+		name     string
+		breaker  CircuitBreaker
+		allowed  []bool
+		failure  bool
+		state    string
+		reopened bool
+	}{
+		{"aberto no cooldown", CircuitBreaker{State: breakerOpen, OpenedAt: time.Now()}, []bool{false, false}, false, breakerOpen, false},
+		{"uma chamada de teste depois do cooldown", CircuitBreaker{State: breakerOpen, OpenedAt: time.Now().Add(-RancherBreakerCooldown)}, []bool{true, false}, true, breakerOpen, true},
+		{"testando com a chamada em andamento", CircuitBreaker{State: breakerHalfOpen, probing: true}, []bool{false}, true, breakerOpen, true},
+		{"testando sem chamada", CircuitBreaker{State: breakerHalfOpen}, []bool{true, false}, true, breakerOpen, true},
+	}
+
+	for _, test := range tests {
+		breaker := test.breaker
+		testBreaker("containers", &breaker)
+
+		for i, allowed := range test.allowed {
+			if got := RancherBreakerAllow("containers"); got != allowed {
+				t.Errorf("%s: chamada %d permitida = %v, esperado %v", test.name, i+1, got, allowed)
+			}
+		}
+
+		if test.failure {
+			RancherBreakerRecord("containers", false)
+		}
+
+		state := breakerState("containers")
+		if state.State != test.state {
+			t.Errorf("%s: circuito %s, esperado %s", test.name, state.State, test.state)
+		}
+		if test.reopened && time.Since(state.OpenedAt) > time.Second {
+			t.Errorf("%s: a falha no teste não reabriu o cooldown", test.name)
+		}
+		if RancherAvailable("containers") != (test.state != breakerOpen) {
+			t.Errorf("%s: RancherAvailable não segue o circuito %s", test.name, state.State)
+		}
+	}
+}
+
+func TestRancherEndpoint(t *testing.T) {
+	listener := &RancherListener{baseURL: "http://rancher/v2-beta/projects", projectID: "1a5"}
+
+	tests := map[string]string{
+		"http://rancher/v2-beta/projects/1a5/services":                      "services",
+		"http://rancher/v2-beta/projects/1a5/services/1s5":                  "services",
+		"http://rancher/v2-beta/projects/1a5/containers/1i5?action=restart": "containers",
+		"http://rancher/v2-beta/projects/1a5/loadBalancerServices?limit=10": "loadBalancerServices",
+	}
+
+	for url, endpoint := range tests {
+		if got := listener.rancherEndpoint(url); got != endpoint {
+			t.Errorf("rancherEndpoint(%s) = %s, esperado %s", url, got, endpoint)
+		}
+	}
+}
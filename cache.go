@@ -0,0 +1,132 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// Recursos do Rancher guardados no cache
+const (
+	cacheServices      = "services"
+	cacheContainers    = "containers"
+	cacheLoadBalancers = "loadBalancerServices"
+	cacheStacks        = "stacks"
+	cacheHosts         = "hosts"
+)
+
+// RancherCacheTTL é o tempo que as listas do Rancher ficam no cache. Com 0 o
+// cache é desligado
+var RancherCacheTTL = 30 * time.Second
+
+// cacheEntry é uma lista do Rancher guardada no cache
+type cacheEntry struct {
+	value     string
+	fetchedAt time.Time
+	usedAt    time.Time
+	fetch     func() string
+}
+
+// ResourceCache guarda as listas do Rancher usadas nos menus, para eles
+// abrirem na hora sem uma chamada na API a cada uso
+type ResourceCache struct {
+	mutex   sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+var rancherCache = &ResourceCache{entries: map[string]*cacheEntry{}}
+
+// Get retorna a lista do cache ou busca com o fetch caso não exista ou tenha
+// expirado. Só respostas válidas (com data) vão para o cache
+func (c *ResourceCache) Get(key string, fetch func() string) string {
+	if RancherCacheTTL <= 0 {
+		return fetch()
+	}
+
+	now := time.Now()
+
+	c.mutex.Lock()
+	entry, ok := c.entries[key]
+	if ok && now.Sub(entry.fetchedAt) < RancherCacheTTL {
+		entry.usedAt = now
+		value := entry.value
+		c.mutex.Unlock()
+		return value
+	}
+	c.mutex.Unlock()
+
+	value := fetch()
+	c.store(key, value, fetch, now)
+
+	return value
+}
+
+func (c *ResourceCache) store(key string, value string, fetch func() string, usedAt time.Time) {
+	if !gjson.Get(value, "data").IsArray() {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries[key] = &cacheEntry{value: value, fetchedAt: time.Now(), usedAt: usedAt, fetch: fetch}
+}
+
+// Invalidate remove as listas do cache, usado depois de alterações no Rancher
+func (c *ResourceCache) Invalidate(keys ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+}
+
+// RefreshRancherCache atualiza em background as listas usadas recentemente
+// antes delas expirarem. Listas sem uso por 10 TTLs saem do cache
+func RefreshRancherCache() {
+	if RancherCacheTTL <= 0 {
+		return
+	}
+
+	log.Printf("[INFO] Cache do Rancher com TTL de %s\n", RancherCacheTTL)
+
+	for {
+		time.Sleep(RancherCacheTTL / 2)
+
+		rancherCache.mutex.Lock()
+		refresh := map[string]*cacheEntry{}
+		for key, entry := range rancherCache.entries {
+			if time.Since(entry.usedAt) > 10*RancherCacheTTL {
+				delete(rancherCache.entries, key)
+				continue
+			}
+			refresh[key] = entry
+		}
+		rancherCache.mutex.Unlock()
+
+		for key, entry := range refresh {
+			rancherCache.store(key, entry.fetch(), entry.fetch, entry.usedAt)
+		}
+	}
+}
+
+// cacheKey monta a chave do recurso no projeto (environment) do Rancher
+func (ranchListener *RancherListener) cacheKey(resource string) string {
+	return ranchListener.projectID + "/" + resource
+}
+
+// invalidateCache remove os recursos do projeto do cache
+func (ranchListener *RancherListener) invalidateCache(resources ...string) {
+	var keys []string
+	for _, resource := range resources {
+		keys = append(keys, ranchListener.cacheKey(resource))
+	}
+
+	rancherCache.Invalidate(keys...)
+}
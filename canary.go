@@ -0,0 +1,173 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CanaryStateFile é o arquivo onde fica salvo o estado dos Canaries
+// controlados pelo BOT
+var CanaryStateFile = "canary-state.json"
+
+// CanaryState é a estrutura que representa o estado do Canary de um Load Balancer
+type CanaryState struct {
+	LoadBalancer string    `json:"loadBalancer"`
+	Enabled      bool      `json:"enabled"`
+	Weights      []string  `json:"weights"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Status retorna o estado do Canary em forma de texto
+func (c *CanaryState) Status() string {
+	if c.Enabled {
+		return "ativado"
+	}
+
+	return "desativado"
+}
+
+var (
+	canaryStates = map[string]*CanaryState{}
+	canaryMutex  sync.Mutex
+)
+
+// ParseCanaryState é a função que lê o haproxy.cfg e descobre se o Canary
+// está ativo e quais são os pesos configurados. O Canary é lido pela chave
+// weight das linhas dos servers: ativo quando alguma delas não está comentada
+// (o DisableCanary comenta todas), assim comentários soltos no haproxy.cfg não
+// desativam o Canary. Sem nenhum weight vale o resto do haproxy.cfg
+func ParseCanaryState(lb string, config string) *CanaryState {
+	state := &CanaryState{
+		LoadBalancer: lb,
+		UpdatedAt:    time.Now(),
+	}
+
+	var active, commented []string
+	hasContent := false
+
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		isComment := strings.HasPrefix(line, "#")
+		if !isComment {
+			hasContent = true
+		}
+
+		fields := strings.Fields(strings.TrimLeft(line, "#"))
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] != "weight" {
+				continue
+			}
+
+			if isComment {
+				commented = append(commented, fields[i+1])
+			} else {
+				active = append(active, fields[i+1])
+			}
+			break
+		}
+	}
+
+	switch {
+	case len(active) > 0:
+		state.Enabled, state.Weights = true, active
+	case len(commented) > 0:
+		state.Weights = commented
+	default:
+		state.Enabled = hasContent
+	}
+
+	return state
+}
+
+// SaveCanaryState é a função que guarda o estado atual do Canary do LB
+// e persiste no arquivo de estado
+func SaveCanaryState(lb string, config string) {
+	if config == "" || config == "error" {
+		return
+	}
+
+	canaryMutex.Lock()
+	defer canaryMutex.Unlock()
+
+	canaryStates[lb] = ParseCanaryState(lb, config)
+
+	data, err := json.MarshalIndent(canaryStates, "", "  ")
+	CheckErr("Erro ao converter o estado dos Canaries", err)
+
+	err = ioutil.WriteFile(CanaryStateFile, data, 0644)
+	CheckErr("Erro ao salvar o arquivo de estado dos Canaries", err)
+}
+
+// saveCanaryState salva o estado do Canary, exceto em dry-run
+func (ranchListener *RancherListener) saveCanaryState(lb string, config string) {
+	if ranchListener.dryRun == nil {
+		SaveCanaryState(lb, config)
+	}
+}
+
+// LoadCanaryStates é a função que lê o arquivo de estado dos Canaries
+func LoadCanaryStates() {
+	canaryMutex.Lock()
+	defer canaryMutex.Unlock()
+
+	data, err := ioutil.ReadFile(CanaryStateFile)
+	if os.IsNotExist(err) {
+		return
+	}
+	CheckErr("Erro ao ler o arquivo de estado dos Canaries", err)
+
+	err = json.Unmarshal(data, &canaryStates)
+	CheckErr("Erro ao converter o arquivo de estado dos Canaries", err)
+}
+
+// ResumeCanaries é a função chamada na inicialização do BOT, ela compara
+// o estado salvo dos Canaries com o que está no Rancher e avisa no canal. O
+// Canary do BOT é só o haproxy.cfg (ativado/desativado e pesos), sem rampa
+// automática nem monitoramento em andamento para retomar: o que fica no
+// Rancher continua valendo e as diferenças são só avisadas, sem sobrescrever
+// as alterações feitas fora do BOT
+func ResumeCanaries() {
+	LoadCanaryStates()
+
+	canaryMutex.Lock()
+	states := make([]*CanaryState, 0, len(canaryStates))
+	for _, state := range canaryStates {
+		states = append(states, state)
+	}
+	canaryMutex.Unlock()
+
+	if len(states) == 0 {
+		return
+	}
+
+	msg := "*Estado dos Canaries restaurado:*"
+
+	for _, saved := range states {
+		config := rancherListener.HaproxyConfig(saved.LoadBalancer)
+		current := ParseCanaryState(saved.LoadBalancer, config)
+
+		msg += fmt.Sprintf("\n`%s` %s, pesos `%s`", saved.LoadBalancer, saved.Status(), strings.Join(saved.Weights, "/"))
+
+		if current.Enabled != saved.Enabled || strings.Join(current.Weights, "/") != strings.Join(saved.Weights, "/") {
+			log.Printf("[INFO] Canary do LB %s foi alterado fora do BOT\n", saved.LoadBalancer)
+			msg += fmt.Sprintf(" :warning: _no Rancher está %s com pesos `%s`_", current.Status(), strings.Join(current.Weights, "/"))
+		}
+	}
+
+	sendNotification(msg)
+}
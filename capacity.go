@@ -0,0 +1,282 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+// capacityCandidates é a quantidade máxima de serviços sugeridos para
+// mudar de host em cada host acima do limite
+const capacityCandidates = 3
+
+// hostCapacity é o uso e a reserva de CPU e memória de um host
+type hostCapacity struct {
+	ID          string
+	Name        string
+	CPU         float64
+	Memory      float64
+	CPUReserved float64
+	MemReserved float64
+	Containers  int
+	Usage       []containerUsage
+}
+
+// Over retorna se o host passou do limite de CPU ou de memória
+func (h *hostCapacity) Over() bool {
+	return h.CPU >= HostCPUThreshold || h.Memory >= HostMemoryThreshold
+}
+
+// stackCapacity é o consumo somado dos containers de uma stack
+type stackCapacity struct {
+	Name       string
+	CPU        float64
+	Memory     int64
+	Reserved   int64
+	Containers int
+}
+
+// percentOf é o percentual de value em total, zero sem total
+func percentOf(value float64, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+
+	return value * 100 / total
+}
+
+// CapacityReport junta as estatísticas dos hosts, o consumo dos containers
+// (amostrado em paralelo em cada host) e as reservas dos containers
+func CapacityReport() ([]*hostCapacity, []*stackCapacity, error) {
+	containers, err := rancherListener.ListContainers()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	services, err := rancherListener.ListServices()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stacks, err := rancherListener.ListStacks()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stackNames := map[string]string{}
+	for _, stack := range stacks {
+		stackNames[stack.ID] = stack.Name
+	}
+
+	serviceStacks := map[string]string{}
+	for _, service := range services {
+		serviceStacks[service.ID] = stackNames[service.StackID]
+	}
+
+	// Os containers sem serviço ficam na stack "avulsos"
+	containerStacks := map[string]string{}
+	byHost := map[string][]Container{}
+	for _, container := range containers {
+		stack := serviceStacks[container.ServiceID()]
+		if stack == "" {
+			stack = "avulsos"
+		}
+		containerStacks[container.Name] = stack
+
+		if container.State == "running" {
+			byHost[container.HostID] = append(byHost[container.HostID], container)
+		}
+	}
+
+	var hosts []*hostCapacity
+	for _, host := range gjson.Get(rancherListener.ListCachedHosts(), "data").Array() {
+		if host.Get("state").String() != "active" {
+			continue
+		}
+
+		h := &hostCapacity{ID: host.Get("id").String(), Name: host.Get("hostname").String(), Containers: len(byHost[host.Get("id").String()])}
+
+		usage := hostResourceUsage(host)
+		h.CPU, h.Memory = usage[0].Value, usage[1].Value
+
+		// O memTotal vem em MiB e as reservas dos containers em bytes
+		var milliCPU, memory int64
+		for _, container := range byHost[h.ID] {
+			milliCPU += container.MilliCPUReservation
+			memory += container.MemoryReservation
+		}
+		h.CPUReserved = percentOf(float64(milliCPU), float64(host.Get("info.cpuInfo.count").Int()*1000))
+		h.MemReserved = percentOf(float64(memory), host.Get("info.memoryInfo.memTotal").Float()*1024*1024)
+
+		hosts = append(hosts, h)
+	}
+
+	var wg sync.WaitGroup
+	for _, h := range hosts {
+		wg.Add(1)
+		go func(h *hostCapacity) {
+			defer wg.Done()
+			h.Usage = hostTopContainers(h.ID)
+		}(h)
+	}
+	wg.Wait()
+
+	byStack := map[string]*stackCapacity{}
+	stackOf := func(name string) *stackCapacity {
+		if _, ok := byStack[name]; !ok {
+			byStack[name] = &stackCapacity{Name: name}
+		}
+		return byStack[name]
+	}
+
+	for _, h := range hosts {
+		for _, usage := range h.Usage {
+			stack := stackOf(containerStacks[usage.Name])
+			stack.CPU += usage.CPU
+			stack.Memory += usage.Memory
+		}
+	}
+	for _, list := range byHost {
+		for _, container := range list {
+			stack := stackOf(containerStacks[container.Name])
+			stack.Containers++
+			stack.Reserved += container.MemoryReservation
+		}
+	}
+
+	var stackList []*stackCapacity
+	for _, stack := range byStack {
+		stackList = append(stackList, stack)
+	}
+
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+	sort.Slice(stackList, func(i, j int) bool { return stackList[i].Memory > stackList[j].Memory })
+
+	return hosts, stackList, nil
+}
+
+// capacityCandidatesText sugere os containers que mais consomem nos hosts
+// acima do limite para mudar para o host com mais memória livre
+func capacityCandidatesText(hosts []*hostCapacity) string {
+	var target *hostCapacity
+	for _, h := range hosts {
+		if !h.Over() && (target == nil || h.Memory < target.Memory) {
+			target = h
+		}
+	}
+
+	var lines []string
+	for _, h := range hosts {
+		if !h.Over() {
+			continue
+		}
+
+		usage := h.Usage
+		sort.Slice(usage, func(i, j int) bool {
+			if h.CPU >= HostCPUThreshold {
+				return usage[i].CPU > usage[j].CPU
+			}
+			return usage[i].Memory > usage[j].Memory
+		})
+
+		for i, c := range usage {
+			if i == capacityCandidates {
+				break
+			}
+
+			line := fmt.Sprintf("`%s` em `%s` (CPU %.1f%%, memória %d MiB)", c.Name, h.Name, c.CPU, c.Memory>>20)
+			if target != nil {
+				line += fmt.Sprintf(" → `%s`", target.Name)
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// CapacityAttachments monta o relatório: os hosts (os acima do limite em
+// destaque), as stacks que mais consomem e os candidatos a mudar de host
+func CapacityAttachments(hosts []*hostCapacity, stacks []*stackCapacity) []slack.Attachment {
+	hostsAttachment := slack.Attachment{
+		Title: fmt.Sprintf(":bar_chart: Capacidade do ambiente %s", orchestratorEnvironment),
+		Color: "good",
+	}
+
+	over := 0
+	for _, h := range hosts {
+		icon := ":white_check_mark:"
+		if h.Over() {
+			icon = ":warning:"
+			over++
+		}
+
+		hostsAttachment.Fields = append(hostsAttachment.Fields, slack.AttachmentField{
+			Title: fmt.Sprintf("%s %s", icon, h.Name),
+			Value: fmt.Sprintf("CPU %.0f%% (reservado %.0f%%)\nMemória %.0f%% (reservado %.0f%%)\n%d containers", h.CPU, h.CPUReserved, h.Memory, h.MemReserved, h.Containers),
+			Short: true,
+		})
+	}
+
+	hostsAttachment.Footer = fmt.Sprintf("Limites: CPU %.0f%%, memória %.0f%%", HostCPUThreshold, HostMemoryThreshold)
+	if over > 0 {
+		hostsAttachment.Color = "warning"
+		hostsAttachment.Text = fmt.Sprintf("%d de %d hosts acima do limite", over, len(hosts))
+	}
+
+	var lines []string
+	for i, stack := range stacks {
+		if i == digestListSize {
+			lines = append(lines, fmt.Sprintf("e mais %d", len(stacks)-digestListSize))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("`%s`: %.2f cores, %d MiB (reservado %d MiB), %d containers", stack.Name, stack.CPU/100, stack.Memory>>20, stack.Reserved>>20, stack.Containers))
+	}
+
+	attachments := []slack.Attachment{hostsAttachment, {
+		Title: ":package: Consumo por stack",
+		Text:  strings.Join(lines, "\n"),
+		Color: "#0C648A",
+	}}
+
+	if candidates := capacityCandidatesText(hosts); candidates != "" {
+		attachments = append(attachments, slack.Attachment{
+			Title: ":truck: Candidatos a mudar de host",
+			Text:  candidates,
+			Color: "warning",
+		})
+	}
+
+	return attachments
+}
+
+// slackCapacity envia o relatório de capacidade. A amostragem dos
+// containers leva alguns segundos por host, então roda como job
+func (s *SlackListener) slackCapacity(ev *slack.MessageEvent) {
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", capacity), false))
+		return
+	}
+
+	channel := ev.Channel
+	job, err := EnqueueJob("relatório de capacidade", ev.Msg.User, func() error {
+		hosts, stacks, err := CapacityReport()
+		if err != nil {
+			s.client.PostMessage(channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao montar o relatório de capacidade: %s", err), false))
+			return err
+		}
+
+		s.client.PostMessage(channel, slack.MsgOptionAttachments(CapacityAttachments(hosts, stacks)...))
+		return nil
+	})
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(queuedJobMessage(job, err), false))
+	}
+}
@@ -0,0 +1,209 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	// TLSHosts são os hosts (host ou host:porta) com certificados monitorados
+	TLSHosts []string
+
+	// TLSRancherCertificates define se os certificados cadastrados no Rancher
+	// também são monitorados
+	TLSRancherCertificates = true
+
+	// TLSWarnDays é a quantidade de dias antes do vencimento para avisar no canal
+	TLSWarnDays = 30
+
+	// TLSCheckInterval é o intervalo entre as verificações dos certificados
+	TLSCheckInterval = 12 * time.Hour
+)
+
+// Certificate é o vencimento de um certificado monitorado
+type Certificate struct {
+	Name    string
+	Source  string
+	Subject string
+	Expires time.Time
+	Error   string
+}
+
+// DaysLeft retorna quantos dias faltam para o certificado vencer
+func (c Certificate) DaysLeft() int {
+	return int(time.Until(c.Expires).Hours() / 24)
+}
+
+// hostCertificate conecta no host e lê o certificado apresentado. A
+// verificação da cadeia é desligada para ler também certificados inválidos
+func hostCertificate(host string) Certificate {
+	cert := Certificate{Name: host, Source: "host"}
+
+	address := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		address = net.JoinHostPort(host, "443")
+	}
+
+	serverName, _, _ := net.SplitHostPort(address)
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", address, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		cert.Error = err.Error()
+		return cert
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		cert.Error = "nenhum certificado apresentado"
+		return cert
+	}
+
+	cert.Subject = certs[0].Subject.CommonName
+	cert.Expires = certs[0].NotAfter
+
+	return cert
+}
+
+// ListCertificates busca os vencimentos dos hosts configurados e dos
+// certificados do Rancher, ordenados pelo vencimento mais próximo
+func ListCertificates() []Certificate {
+	var certs []Certificate
+
+	for _, host := range TLSHosts {
+		certs = append(certs, hostCertificate(host))
+	}
+
+	if TLSRancherCertificates {
+		for _, c := range gjson.Get(rancherListener.ListCertificates(), "data").Array() {
+			cert := Certificate{
+				Name:    c.Get("name").String(),
+				Source:  "rancher",
+				Subject: c.Get("CN").String(),
+			}
+
+			expires, err := time.Parse(time.RFC3339, c.Get("expiresAt").String())
+			if err != nil {
+				cert.Error = "data de vencimento inválida"
+			}
+			cert.Expires = expires
+
+			certs = append(certs, cert)
+		}
+	}
+
+	// Certificados com erro ficam no fim da lista
+	sort.SliceStable(certs, func(i, j int) bool {
+		if (certs[i].Error == "") != (certs[j].Error == "") {
+			return certs[i].Error == ""
+		}
+
+		return certs[i].Expires.Before(certs[j].Expires)
+	})
+
+	return certs
+}
+
+// WatchCertificates avisa no canal os certificados que vencem em menos de
+// TLSWarnDays dias. O aviso é feito ao entrar no prazo e diariamente na
+// última semana
+func WatchCertificates() {
+	if len(TLSHosts) == 0 && !TLSRancherCertificates {
+		return
+	}
+
+	log.Printf("[INFO] Monitorando o vencimento de %d certificados de hosts\n", len(TLSHosts))
+
+	warned := map[string]time.Time{}
+
+	for {
+		for _, cert := range ListCertificates() {
+			if cert.Error != "" {
+				continue
+			}
+
+			days := cert.DaysLeft()
+			key := cert.Source + "/" + cert.Name
+
+			if days > TLSWarnDays {
+				delete(warned, key)
+				continue
+			}
+
+			if last, ok := warned[key]; ok && (days > 7 || time.Since(last) < 24*time.Hour) {
+				continue
+			}
+
+			warned[key] = time.Now()
+			sendCertificateAlert(cert)
+		}
+
+		time.Sleep(TLSCheckInterval)
+	}
+}
+
+func sendCertificateAlert(cert Certificate) {
+	days := cert.DaysLeft()
+
+	color := "#FFA500"
+	text := fmt.Sprintf(":lock: O certificado `%s` (%s) vence em %d dias, em %s", cert.Name, cert.Source, days, slackDay(cert.Expires))
+	if days <= 7 {
+		color = "#D50200"
+	}
+	if days < 0 {
+		text = fmt.Sprintf(":rotating_light: O certificado `%s` (%s) venceu em %s", cert.Name, cert.Source, slackDay(cert.Expires))
+	}
+
+	// Na última semana o aviso é crítico e ignora o horário silencioso
+	PostNotification(getAPIConnection().channelID, days <= 7, []slack.Attachment{{
+		Title:  "Certificado vencendo",
+		Text:   text,
+		Footer: cert.Subject,
+		Color:  color,
+	}})
+}
+
+// slackCerts lista os vencimentos dos certificados, do mais próximo ao mais distante
+func (s *SlackListener) slackCerts(ev *slack.MessageEvent) {
+	certs := ListCertificates()
+
+	if len(certs) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText("Nenhum certificado monitorado, configure o TLS_HOSTS", false))
+		return
+	}
+
+	var lines []string
+	for _, cert := range certs {
+		if cert.Error != "" {
+			lines = append(lines, fmt.Sprintf(":x: `%s` (%s): %s", cert.Name, cert.Source, cert.Error))
+			continue
+		}
+
+		icon := ":white_check_mark:"
+		days := cert.DaysLeft()
+		switch {
+		case days <= 7:
+			icon = ":red_circle:"
+		case days <= TLSWarnDays:
+			icon = ":warning:"
+		}
+
+		lines = append(lines, fmt.Sprintf("%s `%s` (%s) - %s - %d dias", icon, cert.Name, cert.Source, slackDay(cert.Expires), days))
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(strings.Join(lines, "\n"), false))
+}
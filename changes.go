@@ -0,0 +1,53 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import "fmt"
+
+// ChangeEvent é uma alteração feita em um serviço através do BOT, enviada
+// para as ferramentas de observabilidade configuradas
+type ChangeEvent struct {
+	Kind      string
+	ServiceID string
+	Image     string
+	User      string
+}
+
+// Description é o texto da alteração usado nos eventos
+func (c ChangeEvent) Description() string {
+	text := fmt.Sprintf("%s do serviço %s", c.Kind, c.ServiceID)
+	if c.User != "" {
+		text += " por " + c.User
+	}
+	text += " via Slack"
+
+	if c.Image != "" {
+		text += fmt.Sprintf(" (imagem %s)", c.Image)
+	}
+
+	return text
+}
+
+// RecordChange registra a alteração nas integrações configuradas, sem travar
+// a resposta para o Slack
+func RecordChange(change ChangeEvent) {
+	markBotChange(change.ServiceID)
+
+	if change.Kind == "upgrade" || change.Kind == "rollback" {
+		RecordDigestDeploy("BOT", change.Description())
+	}
+
+	if DatadogEnabled() {
+		go func() {
+			CheckErr("Erro ao enviar o evento para o Datadog", SendDatadogEvent(change))
+		}()
+	}
+
+	// Mudanças de escala não são deploys, então não geram marker no APM
+	if NewRelicEnabled() && change.Kind != "escala" {
+		go func() {
+			CheckErr("Erro ao criar o deployment marker no New Relic", SendNewRelicDeployment(change))
+		}()
+	}
+}
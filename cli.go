@@ -0,0 +1,319 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// cliJobPollInterval é o intervalo entre as consultas do job no --wait
+	cliJobPollInterval = 2 * time.Second
+
+	// cliTimeout é o tempo máximo de cada chamada da CLI na API admin
+	cliTimeout = 30 * time.Second
+)
+
+// cliValueFlags são as flags da CLI que recebem um valor (--env prod ou
+// --env=prod), as demais (ex.: --no-wait) são booleanas
+var cliValueFlags = []string{"env", "user", "url", "token", "since", "action", "source", "limit"}
+
+// cliUsage é a ajuda da CLI
+const cliUsage = `Uso: slack-bot <comando> [argumentos] [flags]
+
+Comandos:
+  services                      lista os serviços
+  <comando do BOT> [argumentos] executa o comando, ex.: restart payments, scale payments 3, canary enable lb-edge 25%%
+  job <id>                      mostra o status do job
+  audit                         consulta o audit (--user, --action, --source, --since 1h, --limit)
+  maintenance [on|off] [motivo] mostra, liga ou desliga o modo de manutenção
+
+Flags:
+  --env <ambiente>   ambiente do orquestrador (padrão: o atual do BOT)
+  --user <nome>      quem executa, mostrado no audit e no canal (padrão: $SLACK_BOT_USER ou $USER)
+  --url <url>        endereço do BOT (padrão: $SLACK_BOT_URL ou http://localhost:8080)
+  --token <token>    token da API admin (padrão: $SLACK_BOT_ADMIN_TOKEN)
+  --no-wait          não espera o job terminar
+
+Comandos do BOT disponíveis: %s
+`
+
+// cliClient é a CLI conversando com a API admin do BOT
+type cliClient struct {
+	url   string
+	token string
+	user  string
+	http  *http.Client
+}
+
+// cliArgs são os argumentos da CLI separados das flags
+type cliArgs struct {
+	positional []string
+	flags      map[string]string
+}
+
+// parseCLIArgs separa os argumentos das flags, em qualquer posição
+func parseCLIArgs(args []string) cliArgs {
+	parsed := cliArgs{flags: map[string]string{}}
+
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			parsed.positional = append(parsed.positional, args[i])
+			continue
+		}
+
+		kv := strings.SplitN(strings.TrimPrefix(args[i], "--"), "=", 2)
+		if len(kv) == 1 && containsString(cliValueFlags, kv[0]) && i+1 < len(args) {
+			kv = append(kv, args[i+1])
+			i++
+		}
+		if len(kv) == 1 {
+			kv = append(kv, "true")
+		}
+
+		parsed.flags[kv[0]] = kv[1]
+	}
+
+	return parsed
+}
+
+// firstNonEmpty retorna o primeiro valor preenchido
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// RunCLI executa o binário como CLI (ex.: slack-bot restart payments --env
+// prod), chamando a API admin do BOT. As ações continuam passando pelo audit
+// e sendo avisadas no canal. Retorna o código de saída
+func RunCLI(args []string) int {
+	parsed := parseCLIArgs(args)
+	if len(parsed.positional) == 0 || parsed.positional[0] == "help" || parsed.flags["help"] != "" {
+		fmt.Printf(cliUsage, strings.Join(RemoteCommandNames(), ", "))
+		return 0
+	}
+
+	client := &cliClient{
+		url:   strings.TrimSuffix(firstNonEmpty(parsed.flags["url"], os.Getenv("SLACK_BOT_URL"), "http://localhost:8080"), "/"),
+		token: firstNonEmpty(parsed.flags["token"], os.Getenv("SLACK_BOT_ADMIN_TOKEN")),
+		user:  firstNonEmpty(parsed.flags["user"], os.Getenv("SLACK_BOT_USER"), os.Getenv("USER")),
+		http:  &http.Client{Timeout: cliTimeout},
+	}
+
+	if client.token == "" {
+		fmt.Fprintln(os.Stderr, "Informe o token da API admin com --token ou SLACK_BOT_ADMIN_TOKEN")
+		return 2
+	}
+
+	var err error
+	command, rest := parsed.positional[0], parsed.positional[1:]
+
+	switch command {
+	case "services":
+		err = client.services(parsed.flags["env"])
+	case "job":
+		if len(rest) != 1 {
+			fmt.Fprintln(os.Stderr, "Uso: slack-bot job <id>")
+			return 2
+		}
+		return client.job(rest[0], parsed.flags["no-wait"] == "")
+	case "audit":
+		err = client.audit(parsed.flags)
+	case "maintenance":
+		err = client.maintenance(rest)
+	default:
+		// Os atalhos do canal (ex.: restart) valem também na CLI
+		if full, ok := shorthandCommands[command]; ok {
+			command = full
+		}
+		return client.execute(command, rest, parsed.flags["env"], parsed.flags["no-wait"] == "")
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Erro:", err)
+		return 1
+	}
+
+	return 0
+}
+
+// do faz a chamada na API admin, decodificando a resposta em out
+func (c *cliClient) do(method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, c.url+"/api/v1"+path, reader)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set(adminAPIUserHeader, c.user)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr map[string]string
+		if json.Unmarshal(content, &apiErr) == nil && apiErr["error"] != "" {
+			return fmt.Errorf("%s (%d)", apiErr["error"], resp.StatusCode)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("API admin não encontrada em %s, verifique a URL e o ADMIN_API_TOKEN do BOT", c.url)
+		}
+		return fmt.Errorf("a API admin respondeu %d", resp.StatusCode)
+	}
+
+	return json.Unmarshal(content, out)
+}
+
+func (c *cliClient) services(env string) error {
+	var services []adminService
+	if err := c.do(GetHTTP, "/services?env="+neturl.QueryEscape(env), nil, &services); err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tNOME\tESTADO\tINSTÂNCIAS\tIMAGEM")
+	for _, service := range services {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d/%d\t%s\n", service.ID, service.Name, service.State, service.Ready, service.Replicas, service.Image)
+	}
+
+	return table.Flush()
+}
+
+// execute executa o comando do BOT e, com o wait, acompanha o job até ele
+// terminar, saindo com erro quando o job falha
+func (c *cliClient) execute(command string, args []string, env string, wait bool) int {
+	var job adminJob
+	err := c.do(PostHTTP, "/commands", adminCommandRequest{Command: command, Args: args, Env: env}, &job)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Erro:", err)
+		return 1
+	}
+
+	fmt.Printf("%s na fila (job #%d), o resultado será enviado no canal\n", strings.Title(job.Name), job.ID)
+	if !wait {
+		return 0
+	}
+
+	return c.job(fmt.Sprint(job.ID), true)
+}
+
+// job mostra o status do job e, com o wait, espera ele terminar
+func (c *cliClient) job(ID string, wait bool) int {
+	last := ""
+	for {
+		var job adminJob
+		if err := c.do(GetHTTP, "/jobs/"+neturl.PathEscape(ID), nil, &job); err != nil {
+			fmt.Fprintln(os.Stderr, "Erro:", err)
+			return 1
+		}
+
+		if job.Status != last {
+			fmt.Printf("Job #%d (%s): %s\n", job.ID, job.Name, job.Status)
+			last = job.Status
+		}
+
+		switch job.Status {
+		case jobDone:
+			return 0
+		case jobFailed, jobCanceled:
+			if job.Error != "" {
+				fmt.Fprintln(os.Stderr, job.Error)
+			}
+			return 1
+		}
+
+		if !wait {
+			return 0
+		}
+
+		time.Sleep(cliJobPollInterval)
+	}
+}
+
+func (c *cliClient) audit(flags map[string]string) error {
+	query := neturl.Values{}
+	for _, key := range []string{"user", "action", "source", "since", "limit"} {
+		if flags[key] != "" {
+			query.Set(key, flags[key])
+		}
+	}
+
+	var entries []AuditEntry
+	if err := c.do(GetHTTP, "/audit?"+query.Encode(), nil, &entries); err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "HORÁRIO\tORIGEM\tUSUÁRIO\tAÇÃO\tVALOR\tSTATUS")
+	for _, entry := range entries {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%d\n", entry.At.Local().Format("02/01 15:04:05"), entry.Source, entry.User, entry.Action, entry.Value, entry.Status)
+	}
+
+	return table.Flush()
+}
+
+func (c *cliClient) maintenance(args []string) error {
+	var current Maintenance
+
+	if len(args) == 0 {
+		if err := c.do(GetHTTP, "/maintenance", nil, &current); err != nil {
+			return err
+		}
+	} else {
+		if args[0] != "on" && args[0] != "off" {
+			return fmt.Errorf("use maintenance on [motivo] ou maintenance off")
+		}
+
+		req := adminMaintenanceRequest{Enabled: args[0] == "on", Reason: strings.Join(args[1:], " ")}
+		if err := c.do(PutHTTP, "/maintenance", req, &current); err != nil {
+			return err
+		}
+	}
+
+	if !current.Enabled {
+		fmt.Println("Modo de manutenção desligado")
+		return nil
+	}
+
+	fmt.Printf("Modo de manutenção ligado por %s desde %s", current.By, current.Since.Local().Format("02/01 15:04"))
+	if current.Reason != "" {
+		fmt.Printf(": %s", current.Reason)
+	}
+	fmt.Println()
+
+	return nil
+}
@@ -0,0 +1,679 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	cloneCallback       = "clone-stack"
+	cloneDialogCallback = "clone-dialog"
+
+	actionCloneApply   = "clone-apply"
+	actionCloneEdit    = "clone-edit"
+	actionCloneDiscard = "clone-discard"
+
+	// clonePendingTTL é o tempo que a revisão do clone aguarda a confirmação
+	clonePendingTTL = 30 * time.Minute
+)
+
+// cloneSecretKey são as variáveis de ambiente que não são copiadas no clone,
+// além das que têm um segredo no valor (as regras de redação dos logs)
+var cloneSecretKey = regexp.MustCompile(`(?i)(password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key|credential)`)
+
+// stackClone é o clone de uma stack aguardando a confirmação: a definição
+// exportada da origem e o que foi alterado no formulário
+type stackClone struct {
+	Stack          string
+	Source         string
+	Target         string
+	Name           string
+	DockerCompose  string
+	RancherCompose string
+	Images         map[string]string
+	Env            map[string]map[string]string
+	Scales         map[string]int
+	User           string
+	Created        time.Time
+}
+
+// cloneResult é o clone montado: os arquivos enviados ao Rancher e o resumo
+// mostrado na revisão
+type cloneResult struct {
+	DockerCompose  string
+	RancherCompose string
+	Services       []string
+	Images         map[string]string
+	Scales         map[string]int
+	Removed        []string
+	Changed        []string
+}
+
+var (
+	clonePending      = map[string]*stackClone{}
+	clonePendingMutex sync.Mutex
+)
+
+// composeServicesMap retorna os serviços do compose lido como mapa: a chave
+// services no formato v2 ou a raiz no v1
+func composeServicesMap(compose map[string]interface{}) map[interface{}]interface{} {
+	if services, ok := compose["services"].(map[interface{}]interface{}); ok {
+		return services
+	}
+
+	services := map[interface{}]interface{}{}
+	for name, service := range compose {
+		if name != "version" {
+			services[name] = service
+		}
+	}
+
+	return services
+}
+
+// composeEnv é o valor de uma variável de ambiente do compose. Set é false
+// nas variáveis sem valor (FOO: no mapa ou FOO na lista), que o Rancher lê do
+// ambiente de quem sobe a stack, diferente de FOO: "" (vazia)
+type composeEnv struct {
+	Value string
+	Set   bool
+}
+
+// serviceEnvironment retorna as variáveis de ambiente do serviço, que no
+// compose podem ser um mapa ou uma lista de CHAVE=valor
+func serviceEnvironment(service map[interface{}]interface{}) map[string]composeEnv {
+	env := map[string]composeEnv{}
+
+	switch value := service["environment"].(type) {
+	case map[interface{}]interface{}:
+		for key, item := range value {
+			if item == nil {
+				env[fmt.Sprintf("%v", key)] = composeEnv{}
+				continue
+			}
+			env[fmt.Sprintf("%v", key)] = composeEnv{Value: fmt.Sprintf("%v", item), Set: true}
+		}
+	case []interface{}:
+		for _, item := range value {
+			parts := strings.SplitN(fmt.Sprintf("%v", item), "=", 2)
+			if len(parts) == 2 {
+				env[parts[0]] = composeEnv{Value: parts[1], Set: true}
+			} else {
+				env[parts[0]] = composeEnv{}
+			}
+		}
+	}
+
+	return env
+}
+
+// composeEnvironment monta as variáveis de ambiente do serviço no formato
+// original do compose (lista ou mapa), mantendo as variáveis sem valor
+func composeEnvironment(env map[string]composeEnv, list bool) interface{} {
+	if list {
+		items := []string{}
+		for key, value := range env {
+			if value.Set {
+				items = append(items, key+"="+value.Value)
+			} else {
+				items = append(items, key)
+			}
+		}
+		sort.Strings(items)
+
+		return items
+	}
+
+	items := map[string]interface{}{}
+	for key, value := range env {
+		if value.Set {
+			items[key] = value.Value
+		} else {
+			items[key] = nil
+		}
+	}
+
+	return items
+}
+
+// cloneSecret retorna se a variável não deve ser copiada para o outro ambiente
+func cloneSecret(key string, value string) bool {
+	return cloneSecretKey.MatchString(key) || RedactText(value) != value
+}
+
+// Render monta o docker-compose e o rancher-compose do clone: sem as
+// variáveis com segredos e com as imagens, variáveis e escalas alteradas
+func (c *stackClone) Render() (*cloneResult, error) {
+	var dockerCompose map[string]interface{}
+	if err := yaml.Unmarshal([]byte(c.DockerCompose), &dockerCompose); err != nil {
+		return nil, fmt.Errorf("erro ao ler o docker-compose da stack `%s`: %s", c.Stack, err)
+	}
+
+	rancherCompose := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(c.RancherCompose), &rancherCompose); err != nil {
+		return nil, fmt.Errorf("erro ao ler o rancher-compose da stack `%s`: %s", c.Stack, err)
+	}
+
+	result := &cloneResult{Images: map[string]string{}, Scales: map[string]int{}}
+	services := composeServicesMap(dockerCompose)
+	scales := composeServicesMap(rancherCompose)
+
+	for key, value := range services {
+		name := fmt.Sprintf("%v", key)
+		service, ok := value.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		result.Services = append(result.Services, name)
+
+		env := map[string]composeEnv{}
+		for envKey, envValue := range serviceEnvironment(service) {
+			if cloneSecret(envKey, envValue.Value) {
+				if _, ok := c.Env[name][envKey]; !ok {
+					result.Removed = append(result.Removed, name+"."+envKey)
+				}
+				continue
+			}
+			env[envKey] = envValue
+		}
+		for envKey, envValue := range c.Env[name] {
+			env[envKey] = composeEnv{Value: envValue, Set: true}
+			result.Changed = append(result.Changed, name+"."+envKey)
+		}
+		if len(env) > 0 {
+			_, list := service["environment"].([]interface{})
+			service["environment"] = composeEnvironment(env, list)
+		} else {
+			delete(service, "environment")
+		}
+
+		if image, ok := c.Images[name]; ok {
+			service["image"] = image
+		}
+		result.Images[name] = strings.TrimPrefix(fmt.Sprintf("%v", service["image"]), "docker:")
+
+		config, ok := scales[name].(map[interface{}]interface{})
+		if !ok {
+			config = map[interface{}]interface{}{}
+			scales[name] = config
+		}
+		if scale, ok := c.Scales[name]; ok {
+			config["scale"] = scale
+		}
+		if scale, err := strconv.Atoi(fmt.Sprintf("%v", config["scale"])); err == nil {
+			result.Scales[name] = scale
+		} else {
+			result.Scales[name] = 1
+		}
+	}
+	sort.Strings(result.Services)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Changed)
+
+	if _, ok := rancherCompose["services"]; ok || rancherCompose["version"] != nil {
+		rancherCompose["services"] = scales
+	} else {
+		rancherCompose = map[string]interface{}{}
+		for name, config := range scales {
+			rancherCompose[fmt.Sprintf("%v", name)] = config
+		}
+	}
+
+	data, err := yaml.Marshal(dockerCompose)
+	if err != nil {
+		return nil, err
+	}
+	result.DockerCompose = string(data)
+
+	data, err = yaml.Marshal(rancherCompose)
+	if err != nil {
+		return nil, err
+	}
+	result.RancherCompose = string(data)
+
+	return result, nil
+}
+
+// PolicyViolations retorna as regras da política que os serviços do clone
+// não cumprem
+func (r *cloneResult) PolicyViolations() []string {
+	var compose ComposeFile
+	if err := yaml.Unmarshal([]byte(r.DockerCompose), &compose); err != nil {
+		return []string{"YAML inválido: " + err.Error()}
+	}
+
+	return ComposePolicyViolations(&compose)
+}
+
+// cloneAttachment é a revisão do clone: os serviços com imagem e escala, as
+// variáveis não copiadas e as alteradas (sem os valores), com os botões
+func cloneAttachment(clone *stackClone, ID string) slack.Attachment {
+	attachment := slack.Attachment{
+		Title:      fmt.Sprintf(":busts_in_silhouette: Clone da stack `%s` de `%s` para `%s` como `%s`", clone.Stack, clone.Source, clone.Target, clone.Name),
+		Color:      "#0C648A",
+		CallbackID: cloneCallback,
+	}
+
+	result, err := clone.Render()
+	if err != nil {
+		attachment.Text = ":x: " + err.Error()
+		attachment.Actions = []slack.AttachmentAction{{Name: actionCloneDiscard, Text: "Descartar", Type: "button", Value: ID}}
+		return attachment
+	}
+
+	var lines []string
+	for _, name := range result.Services {
+		lines = append(lines, fmt.Sprintf("`%s`: `%s` x%d", name, result.Images[name], result.Scales[name]))
+	}
+	attachment.Text = fmt.Sprintf("Pedido por @%s\n%s", clone.User, strings.Join(lines, "\n"))
+
+	if len(result.Removed) > 0 {
+		attachment.Fields = append(attachment.Fields, slack.AttachmentField{Title: "Segredos não copiados", Value: "`" + strings.Join(result.Removed, "`, `") + "`"})
+	}
+	if len(result.Changed) > 0 {
+		attachment.Fields = append(attachment.Fields, slack.AttachmentField{Title: "Variáveis alteradas", Value: "`" + strings.Join(result.Changed, "`, `") + "`"})
+	}
+
+	problems := result.PolicyViolations()
+	if len(problems) > 0 {
+		attachment.Fields = append(attachment.Fields, slack.AttachmentField{Title: "Política", Value: "• " + strings.Join(problems, "\n• ")})
+	}
+
+	if len(problems) == 0 {
+		attachment.Actions = append(attachment.Actions, slack.AttachmentAction{
+			Name: actionCloneApply, Text: "Clonar", Type: "button", Style: "primary", Value: ID,
+			Confirm: &slack.ConfirmationField{Title: "Clonar a stack?", Text: fmt.Sprintf("A stack %s será criada no ambiente %s", clone.Name, clone.Target), OkText: "Clonar", DismissText: "Cancelar"},
+		})
+	}
+	attachment.Actions = append(attachment.Actions,
+		slack.AttachmentAction{Name: actionCloneEdit, Text: "Alterar", Type: "button", Value: ID},
+		slack.AttachmentAction{Name: actionCloneDiscard, Text: "Descartar", Type: "button", Value: ID},
+	)
+	attachment.Footer = "Alterar muda o nome, as imagens, as variáveis (inclusive os segredos) e as escalas do clone"
+
+	return attachment
+}
+
+// checkCloneTarget verifica se o time do canal pode criar a stack no ambiente
+// de destino
+func checkCloneTarget(channel string, name string, target string) error {
+	tenant := TenantForChannel(channel)
+	if tenant == nil {
+		return nil
+	}
+
+	if !tenant.AllowsEnvironment(target) {
+		return fmt.Errorf("o ambiente `%s` não é do time `%s`", target, tenant.Name)
+	}
+	if !tenant.AllowsStack(name) {
+		return fmt.Errorf("a stack `%s` não é do time `%s`", name, tenant.Name)
+	}
+
+	return nil
+}
+
+// storeClonePending guarda o clone para a revisão, retornando o ID
+func storeClonePending(clone *stackClone) string {
+	ID := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	clonePendingMutex.Lock()
+	for key, pending := range clonePending {
+		if time.Since(pending.Created) > clonePendingTTL {
+			delete(clonePending, key)
+		}
+	}
+	clonePending[ID] = clone
+	clonePendingMutex.Unlock()
+
+	return ID
+}
+
+// getClonePending retorna o clone em revisão, nil quando ele expirou. Com
+// take o clone é retirado
+func getClonePending(ID string, take bool) *stackClone {
+	clonePendingMutex.Lock()
+	defer clonePendingMutex.Unlock()
+
+	pending, ok := clonePending[ID]
+	if take {
+		delete(clonePending, ID)
+	}
+	if !ok || time.Since(pending.Created) > clonePendingTTL {
+		return nil
+	}
+
+	return pending
+}
+
+// slackClone exporta a stack do ambiente de origem e envia a revisão do
+// clone no ambiente de destino, sem os segredos
+func (s *SlackListener) slackClone(ev *slack.MessageEvent) {
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+	source, target, stackName := args.Positional[0], args.Positional[1], args.Positional[2]
+
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", cloneStack), false))
+		return
+	}
+
+	if source == target {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText("Os ambientes de origem e destino devem ser diferentes", false))
+		return
+	}
+
+	if tenant := TenantForChannel(ev.Channel); tenant != nil && !tenant.AllowsStack(stackName) {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: A stack `%s` não é do time `%s`", stackName, tenant.Name), false))
+		return
+	}
+	if err := checkCloneTarget(ev.Channel, stackName, target); err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(":no_entry: "+err.Error(), false))
+		return
+	}
+
+	sourceListener, err := rancherForEnvironment(source)
+	if err == nil {
+		_, err = rancherForEnvironment(target)
+	}
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(":x: "+err.Error(), false))
+		return
+	}
+
+	stack, err := findStack(sourceListener, stackName)
+	if err == nil && stack == nil {
+		err = fmt.Errorf("stack `%s` não encontrada no ambiente `%s`", stackName, source)
+	}
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(":x: "+err.Error(), false))
+		return
+	}
+
+	dockerCompose, rancherCompose, err := sourceListener.ExportStackConfig(stack.ID)
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao exportar a stack `%s`: %s", stackName, err), false))
+		return
+	}
+
+	userName := ev.Msg.User
+	if info, err := s.client.GetUserInfo(ev.Msg.User); err == nil && info.Name != "" {
+		userName = info.Name
+	}
+
+	clone := &stackClone{
+		Stack:          stackName,
+		Source:         source,
+		Target:         target,
+		Name:           stackName,
+		DockerCompose:  dockerCompose,
+		RancherCompose: rancherCompose,
+		Images:         map[string]string{},
+		Env:            map[string]map[string]string{},
+		Scales:         map[string]int{},
+		User:           userName,
+		Created:        time.Now(),
+	}
+
+	log.Printf("[INFO] Clone da stack %s de %s para %s pedido por %s\n", stackName, source, target, userName)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(cloneAttachment(clone, storeClonePending(clone))))
+}
+
+// actionCloneEditFunction abre o formulário das alterações do clone, já com
+// os valores atuais e os segredos não copiados para preencher
+func actionCloneEditFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	ID := message.Actions[0].Value
+
+	clone := getClonePending(ID, false)
+	if clone == nil {
+		respondWithoutActions(w, message.OriginalMessage, ":hourglass: Essa revisão expirou, use o clone de novo", "")
+		return
+	}
+
+	result, err := clone.Render()
+	if err != nil {
+		respondWithoutActions(w, message.OriginalMessage, ":x: "+err.Error(), "")
+		return
+	}
+
+	var images, env, scales []string
+	for _, name := range result.Services {
+		images = append(images, fmt.Sprintf("%s=%s", name, result.Images[name]))
+		scales = append(scales, fmt.Sprintf("%s=%d", name, result.Scales[name]))
+	}
+	for _, key := range result.Removed {
+		env = append(env, key+"=")
+	}
+
+	dialog := slack.Dialog{
+		CallbackID:  cloneDialogCallback,
+		Title:       "Alterar o clone",
+		SubmitLabel: "Revisar",
+		State:       ID,
+		Elements: []slack.DialogElement{
+			&slack.TextInputElement{
+				DialogInput: slack.DialogInput{Type: "text", Label: "Nome da stack", Name: "name"},
+				Hint:        fmt.Sprintf("Nome da nova stack no ambiente %s", clone.Target),
+				Value:       clone.Name,
+			},
+			&slack.TextInputElement{
+				DialogInput: slack.DialogInput{Type: "textarea", Label: "Imagens", Name: "images", Optional: true},
+				Hint:        "Uma por linha: serviço=imagem",
+				Value:       strings.Join(images, "\n"),
+			},
+			&slack.TextInputElement{
+				DialogInput: slack.DialogInput{Type: "textarea", Label: "Variáveis", Name: "env", Optional: true, Placeholder: "api.DB_PASSWORD=..."},
+				Hint:        "Uma por linha: serviço.CHAVE=valor. Linhas sem valor são ignoradas",
+				Value:       strings.Join(env, "\n"),
+			},
+			&slack.TextInputElement{
+				DialogInput: slack.DialogInput{Type: "textarea", Label: "Escalas", Name: "scales", Optional: true},
+				Hint:        "Uma por linha: serviço=quantidade",
+				Value:       strings.Join(scales, "\n"),
+			},
+		},
+	}
+
+	if err := getAPIConnection().client.OpenDialog(message.TriggerID, dialog); err != nil {
+		CheckErr("Erro ao abrir o dialog do clone", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// cloneOverrideLines retorna as linhas chave=valor do campo do formulário,
+// ignorando as vazias e as sem valor
+func cloneOverrideLines(text string) ([][2]string, bool) {
+	var lines [][2]string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, false
+		}
+		if key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]); value != "" {
+			lines = append(lines, [2]string{key, value})
+		}
+	}
+
+	return lines, true
+}
+
+// parseCloneSubmission valida o formulário e aplica as alterações no clone
+func parseCloneSubmission(clone *stackClone, submission map[string]string, channel string) []dialogError {
+	result, err := clone.Render()
+	if err != nil {
+		return []dialogError{{Name: "name", Error: err.Error()}}
+	}
+
+	var errs []dialogError
+
+	name := strings.TrimSpace(submission["name"])
+	if !rancherName.MatchString(name) {
+		errs = append(errs, dialogError{Name: "name", Error: "Use letras, números e -"})
+	} else if err := checkCloneTarget(channel, name, clone.Target); err != nil {
+		errs = append(errs, dialogError{Name: "name", Error: err.Error()})
+	} else if listener, err := rancherForEnvironment(clone.Target); err != nil {
+		errs = append(errs, dialogError{Name: "name", Error: err.Error()})
+	} else if stack, err := findStack(listener, name); err != nil || stack != nil {
+		errs = append(errs, dialogError{Name: "name", Error: fmt.Sprintf("Já existe a stack %s em %s", name, clone.Target)})
+	}
+
+	images := map[string]string{}
+	lines, ok := cloneOverrideLines(submission["images"])
+	for _, line := range lines {
+		if !containsString(result.Services, line[0]) {
+			ok = false
+		}
+		images[line[0]] = line[1]
+	}
+	if !ok {
+		errs = append(errs, dialogError{Name: "images", Error: "Use serviço=imagem com os serviços da stack"})
+	}
+
+	env := map[string]map[string]string{}
+	lines, ok = cloneOverrideLines(submission["env"])
+	for _, line := range lines {
+		parts := strings.SplitN(line[0], ".", 2)
+		if len(parts) != 2 || parts[1] == "" || !containsString(result.Services, parts[0]) {
+			ok = false
+			continue
+		}
+		if env[parts[0]] == nil {
+			env[parts[0]] = map[string]string{}
+		}
+		env[parts[0]][parts[1]] = line[1]
+	}
+	if !ok {
+		errs = append(errs, dialogError{Name: "env", Error: "Use serviço.CHAVE=valor com os serviços da stack"})
+	}
+
+	scales := map[string]int{}
+	lines, ok = cloneOverrideLines(submission["scales"])
+	for _, line := range lines {
+		scale, err := strconv.Atoi(line[1])
+		if err != nil || scale < 0 || !containsString(result.Services, line[0]) {
+			ok = false
+			continue
+		}
+		scales[line[0]] = scale
+	}
+	if !ok {
+		errs = append(errs, dialogError{Name: "scales", Error: "Use serviço=quantidade com os serviços da stack"})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	clone.Name, clone.Images, clone.Env, clone.Scales = name, images, env, scales
+	return nil
+}
+
+// cloneDialogSubmission aplica as alterações do formulário e envia a nova
+// revisão do clone
+func cloneDialogSubmission(submission DialogSubmission, w http.ResponseWriter) {
+	clone := getClonePending(submission.State, false)
+	if clone == nil {
+		w.WriteHeader(http.StatusOK)
+		getAPIConnection().client.PostMessage(submission.Channel.ID, slack.MsgOptionText(":hourglass: Essa revisão do clone expirou, use o clone de novo", false))
+		return
+	}
+
+	// As alterações vão para uma nova revisão, a anterior continua válida
+	edited := *clone
+	if errs := parseCloneSubmission(&edited, submission.Submission, submission.Channel.ID); len(errs) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]dialogError{"errors": errs})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	edited.User = submission.User.Name
+	edited.Created = time.Now()
+
+	getAPIConnection().client.PostMessage(submission.Channel.ID, slack.MsgOptionAttachments(cloneAttachment(&edited, storeClonePending(&edited))))
+}
+
+// actionCloneApplyFunction cria a stack no ambiente de destino, como job,
+// com a definição revisada
+func actionCloneApplyFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	clone := getClonePending(message.Actions[0].Value, true)
+	if clone == nil {
+		respondWithoutActions(w, message.OriginalMessage, ":hourglass: Essa revisão expirou, use o clone de novo", "")
+		return
+	}
+
+	if err := checkCloneTarget(message.Channel.ID, clone.Name, clone.Target); err != nil {
+		respondWithoutActions(w, message.OriginalMessage, ":no_entry: "+err.Error(), "")
+		return
+	}
+
+	result, err := clone.Render()
+	if err == nil && len(result.PolicyViolations()) > 0 {
+		err = fmt.Errorf("o clone não passa na política")
+	}
+	listener, envErr := rancherForEnvironment(clone.Target)
+	if err == nil {
+		err = envErr
+	}
+	if err != nil {
+		respondWithoutActions(w, message.OriginalMessage, ":x: "+err.Error(), "")
+		return
+	}
+
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":busts_in_silhouette: Clone iniciado por @%s", message.User.Name), "")
+
+	channel, user := message.Channel.ID, message.User.Name
+	job, err := EnqueueJobContext("clone da stack "+clone.Stack, user, func(ctx context.Context) error {
+		progress := StartProgress(channel, fmt.Sprintf("*Clone* da stack `%s` de `%s` para `%s` como `%s`, por @%s", clone.Stack, clone.Source, clone.Target, clone.Name, user), JobFromContext(ctx))
+
+		progress.Update(0, 0, "criando a stack")
+		stack, err := listener.CreateStack(clone.Name, result.DockerCompose, result.RancherCompose)
+		if err != nil {
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		state, err := finishStack(ctx, listener, stack.ID, progress)
+		if err != nil {
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		text := fmt.Sprintf("stack `%s` (%s) `%s` em `%s`", clone.Name, stack.ID, state, clone.Target)
+		if len(result.Removed) > 0 {
+			text += fmt.Sprintf(". Segredos não copiados: `%s`", strings.Join(result.Removed, "`, `"))
+		}
+
+		log.Printf("[INFO] Stack %s clonada de %s para %s como %s pelo usuário %s\n", clone.Stack, clone.Source, clone.Target, clone.Name, user)
+		progress.Finish(true, text)
+		return nil
+	})
+	interactionJob(w, job, err)
+	if err != nil {
+		sendMessage(queuedJobMessage(job, err))
+	}
+}
+
+func actionCloneDiscardFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	getClonePending(message.Actions[0].Value, true)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Clone descartado por @%s", message.User.Name), "")
+}
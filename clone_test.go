@@ -0,0 +1,103 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestCloneRender(t *testing.T) {
+	LoadRedactionRules()
+
+	clone := &stackClone{
+		Stack: "payments",
+		DockerCompose: strings.Join([]string{
+			"version: '2'",
+			"services:",
+			"  api:",
+			"    image: registry/api:1.0",
+			"    environment:",
+			"      LOG_LEVEL: info",
+			"      DB_PASSWORD: hunter2",
+			"      DATABASE_URL: postgres://app:s3nh4@db/app",
+			"      PROXY:",
+			"      REGION: sa-east-1",
+			"  worker:",
+			"    image: registry/worker:1.0",
+			"    environment:",
+			"    - QUEUE=jobs",
+			"    - API_TOKEN=abc",
+			"    - HOSTNAME",
+		}, "\n"),
+		RancherCompose: strings.Join([]string{
+			"version: '2'",
+			"services:",
+			"  api:",
+			"    scale: 3",
+		}, "\n"),
+		Images: map[string]string{"worker": "registry/worker:2.0"},
+		Env:    map[string]map[string]string{"api": {"REGION": "us-east-1", "DB_PASSWORD": "outra"}},
+		Scales: map[string]int{"worker": 2},
+	}
+
+	result, err := clone.Render()
+	if err != nil {
+		t.Fatalf("Render: %s", err)
+	}
+
+	if !reflect.DeepEqual(result.Services, []string{"api", "worker"}) {
+		t.Errorf("serviços %v, esperado [api worker]", result.Services)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"api.DATABASE_URL", "worker.API_TOKEN"}) {
+		t.Errorf("variáveis removidas %v, esperado [api.DATABASE_URL worker.API_TOKEN]", result.Removed)
+	}
+	if !reflect.DeepEqual(result.Changed, []string{"api.DB_PASSWORD", "api.REGION"}) {
+		t.Errorf("variáveis alteradas %v, esperado [api.DB_PASSWORD api.REGION]", result.Changed)
+	}
+	if !reflect.DeepEqual(result.Images, map[string]string{"api": "registry/api:1.0", "worker": "registry/worker:2.0"}) {
+		t.Errorf("imagens %v", result.Images)
+	}
+	if !reflect.DeepEqual(result.Scales, map[string]int{"api": 3, "worker": 2}) {
+		t.Errorf("escalas %v, esperado api 3 e worker 2", result.Scales)
+	}
+
+	var compose struct {
+		Services map[string]struct {
+			Image       string
+			Environment interface{}
+		}
+	}
+	if err := yaml.Unmarshal([]byte(result.DockerCompose), &compose); err != nil {
+		t.Fatalf("docker-compose do clone inválido: %s", err)
+	}
+
+	// O mapa mantém as variáveis sem valor (PROXY:) e a lista as sem = (HOSTNAME)
+	api := map[interface{}]interface{}{"LOG_LEVEL": "info", "DB_PASSWORD": "outra", "PROXY": nil, "REGION": "us-east-1"}
+	if env := compose.Services["api"].Environment; !reflect.DeepEqual(env, api) {
+		t.Errorf("ambiente do api %v, esperado %v", env, api)
+	}
+	worker := []interface{}{"HOSTNAME", "QUEUE=jobs"}
+	if env := compose.Services["worker"].Environment; !reflect.DeepEqual(env, worker) {
+		t.Errorf("ambiente do worker %v, esperado %v", env, worker)
+	}
+	if image := compose.Services["worker"].Image; image != "registry/worker:2.0" {
+		t.Errorf("imagem do worker %s, esperado registry/worker:2.0", image)
+	}
+
+	if strings.Contains(result.DockerCompose, "hunter2") || strings.Contains(result.DockerCompose, "s3nh4") {
+		t.Errorf("o clone copiou um segredo:\n%s", result.DockerCompose)
+	}
+}
+
+func TestCloneRenderInvalid(t *testing.T) {
+	clone := &stackClone{Stack: "payments", DockerCompose: "services: [", RancherCompose: ""}
+
+	if _, err := clone.Render(); err == nil {
+		t.Error("Render aceitou um docker-compose inválido")
+	}
+}
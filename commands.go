@@ -57,32 +57,56 @@ func CreateCommands() {
 	Commands = append(Commands, Command{
 		Cmd:         logsContainer,
 		Description: "Comando que trará um arquivo com os arquivos de logs do container selecionado",
+		Usage:       "@bot comando `*id-container*` `*lines=N*` `*since=15m*` `*from 14:00 to 14:30*` `*tz=America/Sao_Paulo*` `*grep=padrão*` `*context=N*` `*stream=stdout|stderr|both*`",
+		Lint:        "Aparecerá uma caixa de seleção, onde será selecionado o container que preferir | `lines` traz as últimas N linhas e `since` os logs do último período informado, se nenhum for passado aparecerão botões para escolher | `grep` envia apenas as linhas que batem com o padrão (regex ou texto), com `context` linhas ao redor | `from`/`to` trazem apenas os logs do período, no fuso do `tz` ou do `LOGS_TIMEZONE` | Passando o `id-container` os logs são enviados sem a caixa de seleção | `stream` escolhe se vem apenas o stdout, apenas o stderr ou os dois identificados (padrão)",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         serviceLogs,
+		Description: "Comando que trará um único arquivo com os logs de todos os containers do serviço selecionado, ordenados pela data",
+		Usage:       "@bot comando `*serviço*` `*lines=N*` `*since=15m*` `*from 14:00 to 14:30*` `*grep=padrão*`",
+		Lint:        "Com o serviço (nome ou ID) os logs são enviados direto, sem ele aparecerá uma caixa de seleção, onde será selecionado o serviço | Cada linha do arquivo começa com o nome do container de onde ela veio | Aceita as mesmas opções do `logs-container`",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         streamLogs,
+		Description: "Comando que acompanha os logs do container selecionado em tempo real, enviando em uma thread",
+		Usage:       "@bot comando `*duration=5m*`",
+		Lint:        "Aparecerá uma caixa de seleção, onde será selecionado o container | Para finalizar clique em *Parar*, use o `stop-stream` ou espere a `duration` (limitada ao tempo máximo do stream)",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         stopStream,
+		Description: "Comando que finaliza todos os streams de logs abertos por você",
 		Usage:       "@bot comando",
-		Lint:        "Aparecerá uma caixa de seleção, onde será selecionado o container que preferir",
+		Lint:        "",
 		IsActive:    true,
 	})
 
 	Commands = append(Commands, Command{
 		Cmd:         restartContainer,
 		Description: "Comando que reinicia o container selecionado",
-		Usage:       "@bot comando",
-		Lint:        "Aparecerá uma caixa de seleção, onde será selecionado o container a ser restartado",
+		Usage:       "@bot comando `*--drain*` `*drain=90s*`",
+		Lint:        "Aparecerá uma caixa de seleção, onde será selecionado o container a ser restartado. Com o `--drain` o container sai dos LBs e as sessões abertas terminam antes do restart (`@bot comando id-container --drain` reinicia direto)",
 		IsActive:    true,
 	})
 
 	Commands = append(Commands, Command{
 		Cmd:         getServiceInfo,
 		Description: "Comando que busca informações sobre o serviço selecionado",
-		Usage:       "@bot comando",
-		Lint:        "Aparecerá uma caixa de seleção, onde será selecionado o serviço a ser buscado",
+		Usage:       "@bot comando `*serviço*`",
+		Lint:        "Com o serviço (nome ou ID) as informações são enviadas direto, sem ele aparecerá uma caixa de seleção, onde será selecionado o serviço a ser buscado",
 		IsActive:    true,
 	})
 
 	Commands = append(Commands, Command{
 		Cmd:         upgradeService,
 		Description: "O comando faz o upgrade de um serviço mudando apenas sua imagem",
-		Usage:       "@bot comando `id-serviço` `nova-imagem`",
-		Lint:        "Em `id-serviço` coloque o ID referente ao serviço que você quer enviar a nova imagem e em `nova-imagem` coloque o nome da imagem a ser enviada",
+		Usage:       "@bot comando `serviço` `nova-imagem`",
+		Lint:        "Em `serviço` coloque o nome ou o ID do serviço que você quer enviar a nova imagem e em `nova-imagem` coloque o nome da imagem a ser enviada",
 		IsActive:    true,
 	})
 
@@ -94,6 +118,440 @@ func CreateCommands() {
 		IsActive:    true,
 	})
 
+	Commands = append(Commands, Command{
+		Cmd:         pagerDutyTrigger,
+		Description: "Comando que abre um incidente no PagerDuty para o serviço informado",
+		Usage:       "@bot comando `serviço` `descrição`",
+		Lint:        "O incidente é aberto na integração do serviço (ou na padrão) e a mensagem terá botões para reconhecer e resolver",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         pagerDutyAck,
+		Description: "Comando que reconhece um incidente no PagerDuty",
+		Usage:       "@bot comando `dedup-key`",
+		Lint:        "A `dedup-key` aparece na mensagem do incidente",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         pagerDutyResolve,
+		Description: "Comando que resolve um incidente no PagerDuty",
+		Usage:       "@bot comando `dedup-key`",
+		Lint:        "A `dedup-key` aparece na mensagem do incidente",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         opsgenieCreate,
+		Description: "Comando que cria um alerta no Opsgenie",
+		Usage:       "@bot comando `P1..P5` `mensagem`",
+		Lint:        "A prioridade vai de `P1` (mais crítica) a `P5`",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         opsgenieAck,
+		Description: "Comando que reconhece um alerta no Opsgenie",
+		Usage:       "@bot comando `id-alerta`",
+		Lint:        "Pode ser usado o número curto do alerta (ex.: `42`) ou o ID completo",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         opsgenieClose,
+		Description: "Comando que fecha um alerta no Opsgenie",
+		Usage:       "@bot comando `id-alerta`",
+		Lint:        "Pode ser usado o número curto do alerta (ex.: `42`) ou o ID completo",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         githubWorkflow,
+		Description: "Comando que dispara um workflow do GitHub Actions e acompanha a execução",
+		Usage:       "@bot comando `dono/repositório` `workflow.yml` `ref=branch` `environment=ambiente`",
+		Lint:        "Use `event:tipo` no lugar do workflow para enviar um `repository_dispatch`. Os demais `chave=valor` são enviados como inputs",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         gitlabPipeline,
+		Description: "Comando que cria um pipeline no GitLab CI e acompanha a execução",
+		Usage:       "@bot comando `grupo/projeto` `ref=branch` `VARIAVEL=valor`",
+		Lint:        "As mudanças de status do pipeline e dos jobs são enviadas na thread da mensagem",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         jenkinsBuild,
+		Description: "Comando que lista os jobs do Jenkins e executa o job selecionado",
+		Usage:       "@bot comando",
+		Lint:        "Caso o job tenha parâmetros, eles são pedidos em um formulário. O link do console e o resultado são enviados na thread",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         scanService,
+		Description: "Comando que escaneia as vulnerabilidades da imagem atual de um serviço",
+		Usage:       "@bot comando",
+		Lint:        "A imagem precisa estar no Harbor configurado. O resumo por severidade é enviado quando o scan termina",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         spComponent,
+		Description: "Comando que altera o status de um componente no Statuspage",
+		Usage:       "@bot comando `id-componente` `status`",
+		Lint:        "Status: `operational`, `degraded_performance`, `partial_outage`, `major_outage` ou `under_maintenance`. Pode ser usado o ID do serviço mapeado",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         spIncident,
+		Description: "Comando que cria um incidente no Statuspage",
+		Usage:       "@bot comando `status` `título`",
+		Lint:        "Status: `investigating`, `identified`, `monitoring` ou `resolved`",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         spUpdate,
+		Description: "Comando que atualiza um incidente do Statuspage",
+		Usage:       "@bot comando `id-incidente` `status` `mensagem`",
+		Lint:        "O ID do incidente é enviado na mensagem de criação",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         openIncident,
+		Description: "Comando que cria um canal para o incidente, convida o grupo de plantão e fixa o resumo com as informações do serviço",
+		Usage:       "@bot comando `serviço` `descrição`",
+		Lint:        "Use `-` no lugar do serviço caso o incidente não seja de um serviço. As mensagens de alerta também têm o botão *Abrir incidente*",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         oncall,
+		Description: "Comando que mostra quem está de plantão na rotação",
+		Usage:       "@bot comando `rotação`",
+		Lint:        "Sem a rotação é usada a rotação padrão. As escalas vêm do PagerDuty ou do Opsgenie",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         terraformPlan,
+		Description: "Comando que gera o plan do Terraform de um workspace, com botão para aprovar e aplicar",
+		Usage:       "@bot comando `workspace`",
+		Lint:        "O apply precisa ser aprovado por outra pessoa (ou por um dos aprovadores configurados) e a saída é enviada na thread",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         environment,
+		Description: "Comando que lista os ambientes configurados ou troca o ambiente (orquestrador) usado pelos comandos de serviço",
+		Usage:       "@bot comando `ambiente`",
+		Lint:        "Sem o ambiente são listados os ambientes e o orquestrador de cada um",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         datadogMute,
+		Description: "Comando que silencia os monitores do Datadog com a tag service:<serviço> durante uma manutenção",
+		Usage:       "@bot comando `id-serviço` `duração`",
+		Lint:        "A duração é opcional (ex.: 30m, 2h), o padrão é 1h",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         datadogUnmute,
+		Description: "Comando que reativa os monitores do Datadog do serviço",
+		Usage:       "@bot comando `id-serviço`",
+		Lint:        "Reativa todos os escopos silenciados dos monitores com a tag service:<serviço>",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         uptimeStatus,
+		Description: "Comando que mostra o estado das URLs monitoradas, com pause e resume de cada verificação",
+		Usage:       "@bot comando `pause|resume` `nome`",
+		Lint:        "Sem argumentos lista as verificações. Quedas, lentidão e recuperações são avisadas no canal automaticamente",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         listCerts,
+		Description: "Comando que lista o vencimento dos certificados monitorados, do mais próximo ao mais distante",
+		Usage:       "@bot comando",
+		Lint:        "São listados os hosts configurados e os certificados cadastrados no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         listJobs,
+		Description: "Comando que lista os jobs na fila, em execução e os últimos finalizados",
+		Usage:       "@bot comando",
+		Lint:        "Logs, upgrades pelo botão do registry, canary e restarts de serviço são executados em jobs. Os jobs na fila ou em execução têm o botão *Cancelar*",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         help,
+		Description: "Comando que lista os comandos disponíveis com a descrição, um exemplo de uso e quem pode usar",
+		Usage:       "@bot comando `*nome-comando*`",
+		Lint:        "Com o nome de um comando mostra só os detalhes dele. Também disponível no slash command (`/bot help`) e no botão *Ajuda* das mensagens de comando não encontrado",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         find,
+		Description: "Comando que busca serviços, containers e stacks pelo nome, mesmo com o nome incompleto ou com erros de digitação",
+		Usage:       "@bot comando `busca`",
+		Lint:        "Mostra os 10 resultados mais parecidos com botões de info, logs e restart (serviços e containers) ou de listar os serviços (stacks)",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         batch,
+		Description: "Comando que executa restart, busca de logs ou desativação em vários serviços ou containers de uma vez",
+		Usage:       "@bot comando `restart|logs|deactivate` `*services|containers*`",
+		Lint:        "Aparecerá uma seleção múltipla com os serviços (padrão) ou containers. Ao clicar em *Executar* a mensagem é atualizada com o resultado de cada item",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         whoami,
+		Description: "Comando que mostra os seus papéis, o ambiente atual e os comandos e botões que você pode usar",
+		Usage:       "@bot comando",
+		Lint:        "As permissões vêm do `INTERACTION_PERMISSIONS`, dos plugins e dos papéis do `RBAC_ROLES`",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         showStatus,
+		Description: "Comando que mostra um resumo do ambiente: serviços por estado, containers com problema, hosts fora do ar e Canaries ativos",
+		Usage:       "@bot comando",
+		Lint:        "Os dados vêm do cache do Rancher. O botão *Atualizar* busca os dados atuais e edita a mensagem",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         fav,
+		Description: "Comando que adiciona ou remove um serviço dos seus favoritos",
+		Usage:       "@bot comando `add|remove` `serviço`",
+		Lint:        "Sem argumentos lista os seus favoritos. Os favoritos aparecem primeiro, com uma estrela, nos menus de serviços",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         favorites,
+		Description: "Comando que mostra os seus serviços favoritos com os botões de info, logs e restart",
+		Usage:       "@bot comando",
+		Lint:        "",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         recent,
+		Description: "Comando que mostra os serviços e containers usados por último por você, com os botões de ação",
+		Usage:       "@bot comando",
+		Lint:        "São lembrados os 10 últimos alvos escolhidos nos menus e botões do BOT",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         language,
+		Description: "Comando que mostra ou altera o idioma das mensagens enviadas só para você",
+		Usage:       "@bot comando `pt|en|es|auto`",
+		Lint:        "Sem argumentos mostra o idioma atual. O `auto` volta a usar o idioma do seu Slack",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         upgradeWizard,
+		Description: "Comando que faz o upgrade de um serviço passo a passo: serviço, tag do registry, ritmo, revisão e confirmação",
+		Usage:       "@bot comando `*serviço*`",
+		Lint:        "Com o serviço começa na escolha da tag. Cada passo tem o botão Voltar e o andamento do upgrade aparece na própria mensagem. Só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         blueGreen,
+		Description: "Comando que faz o deploy blue/green: sobe a outra cor do serviço com a nova imagem e troca o tráfego do LB na confirmação",
+		Usage:       "@bot comando `serviço` `id-lb` `nova-imagem`",
+		Lint:        "A cor nova (ex.: payments-green) só recebe tráfego depois de saudável e do clique em Trocar. Depois da troca há os botões de voltar e de remover a cor antiga. Só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         abSplit,
+		Description: "Comando que divide o tráfego de um frontend do LB por porcentagem, header ou cookie para um backend alternativo",
+		Usage:       "@bot comando `id-lb` ou @bot lb ab `id-lb`",
+		Lint:        "Mostra as regras de A/B do LB com os botões de nova regra e de remover. A nova regra é preenchida num formulário e revisada antes de ir para o haproxy.cfg. Só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         lbStats,
+		Description: "Comando que mostra as estatísticas do HAProxy do LB: status dos backends e servers, sessões e taxa de erro",
+		Usage:       "@bot comando `id-lb`",
+		Lint:        "Soma os números de todos os containers do LB. O haproxy.cfg precisa expor a página de estatísticas na `HAPROXY_STATS_PORT`. Só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         rollingRestart,
+		Description: "Comando que reinicia os containers do serviço em lotes, esperando cada lote voltar saudável antes do próximo",
+		Usage:       "@bot comando `serviço` `*batch=2*` ou @bot rolling restart `serviço`",
+		Lint:        "O lote que não volta saudável interrompe o restart e é avisado no canal. Sem o batch usa o `ROLLING_RESTART_BATCH`. Só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         compareEnvs,
+		Description: "Comando que compara os serviços de uma stack em dois ambientes do Rancher: tag da imagem, scale, variáveis de ambiente e saúde",
+		Usage:       "@bot comando `ambiente` `outro-ambiente` `stack`",
+		Lint:        "Ex.: @bot compare staging prod payments. Os ambientes são os do `RANCHER_PROJECTS` e o `default`. Só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         capacity,
+		Description: "Comando que mostra o uso e a reserva de CPU e memória por host e por stack, com os hosts acima do limite e os serviços candidatos a mudar de host",
+		Usage:       "@bot comando",
+		Lint:        "Os limites são o `HOST_CPU_THRESHOLD` e o `HOST_MEMORY_THRESHOLD`. O consumo dos containers é amostrado em cada host, então o relatório leva alguns segundos. Só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         imageGC,
+		Description: "Comando que lista as imagens sem uso em cada host e, depois da confirmação, remove elas, informando o espaço liberado por host",
+		Usage:       "@bot comando `*host*` `*--dangling*`",
+		Lint:        "Primeiro aparece a listagem (dry-run) com o botão *Limpar* | Sem o `host` (nome ou ID) todos os hosts ativos | `--dangling` considera apenas as imagens sem tag, sem ele todas as imagens sem container | Só para os `IMAGE_GC_ADMINS` e só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         stackGraph,
+		Description: "Comando que envia a imagem com o grafo de dependências dos serviços da stack, pelos links e pelos LoadBalancers",
+		Usage:       "@bot comando `stack`",
+		Lint:        "Ex.: @bot graph payments. Mostra também os serviços de outras stacks ligados à stack e quem depende de cada serviço, para conferir antes de um restart. Só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         serviceStats,
+		Description: "Comando que coleta o uso de CPU e memória dos containers do serviço por um período e envia os gráficos",
+		Usage:       "@bot comando `serviço` `*duration=1m*`",
+		Lint:        "Uma linha por container em cada gráfico, com a última amostra e o pico na mensagem | `duration` entre 10s e 10m, padrão `STATS_DURATION` | Roda como job, só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         silenceCreate,
+		Description: "Comando que cria um silence no Alertmanager com os matchers, a duração e o comentário",
+		Usage:       "@bot comando `matchers` `*duration=1h*` `*comentário*`",
+		Lint:        "Ex.: @bot silence create alertname=HighCPU instance=~web.* duration=2h deploy do web | Matchers nome=valor, nome!=valor, nome=~regex ou nome!~regex | Sem o duration usa o `ALERTMANAGER_SILENCE_DURATION`, até 7d",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         silenceList,
+		Description: "Comando que lista os silences ativos e pendentes do Alertmanager, com o botão de expirar em cada um",
+		Usage:       "@bot comando `*matchers*`",
+		Lint:        "Os matchers filtram os silences, ex.: @bot silence list alertname=HighCPU",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         silenceExpire,
+		Description: "Comando que expira um silence do Alertmanager, voltando a enviar os alertas",
+		Usage:       "@bot comando `id-do-silence`",
+		Lint:        "O ID aparece no rodapé do `silence list` e na resposta dos silences criados",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         inspectContainer,
+		Description: "Comando que mostra as portas, IPs, links, labels, volumes e o host de um container, com o botão do JSON",
+		Usage:       "@bot comando `*container*`",
+		Lint:        "Aceita o ID ou o nome do container, sem ele mostra o menu | O JSON vai como snippet na thread, com as variáveis de ambiente escondidas | Só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         validateConfig,
+		Description: "Comando que verifica o upgrade de um serviço contra a política (labels, limites, tag latest e registries), sem alterar nada",
+		Usage:       "@bot comando `serviço` `*nova-imagem*`",
+		Lint:        "Sem a nova imagem verifica a configuração atual | Para validar um docker-compose.yml, envie o arquivo no canal com `validate` no comentário",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         stackSnapshot,
+		Description: "Comando que salva a definição atual de uma stack: serviços, configurações (docker-compose e rancher-compose) e escala",
+		Usage:       "@bot comando `stack`",
+		Lint:        "A resposta traz o ID do snapshot para o `restore` | Só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         stackRestore,
+		Description: "Comando que volta uma stack para um snapshot, mostrando antes o diff com a definição atual",
+		Usage:       "@bot comando `stack` `*id-do-snapshot*`",
+		Lint:        "Sem o ID lista os snapshots da stack | O restore roda só depois da confirmação na prévia | Só no Rancher",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         cloneStack,
+		Description: "Comando que clona uma stack (definições, variáveis sem os segredos e escala) para outro ambiente do Rancher",
+		Usage:       "@bot comando `ambiente-origem` `ambiente-destino` `stack`",
+		Lint:        "Ex.: @bot clone prod staging payments | Na revisão, Alterar muda o nome, as imagens, as variáveis e as escalas | Os ambientes são os do `RANCHER_PROJECTS`",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         quotaStatus,
+		Description: "Comando que mostra o uso das cotas do time do canal, ou de todos os times no canal do BOT",
+		Usage:       "@bot comando",
+		Lint:        "As cotas são configuradas por time no `TENANTS_FILE`",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         quotaOverride,
+		Description: "Comando que libera usos extras de uma cota de um time até o fim do período, ou zera a cota",
+		Usage:       "@bot comando `time` `cota` `quantidade`",
+		Lint:        "Ex.: @bot quota override payments prod-restarts 2 | `reset` no lugar da quantidade zera os usos | Só para os `QUOTA_ADMINS`",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         auditExport,
+		Description: "Comando que exporta o audit de um período em CSV ou JSON, para revisões de compliance",
+		Usage:       "@bot comando `período` `*format=json*`",
+		Lint:        "`período` 7d, 12h, 2024-03-12 ou 2024-03-01..2024-03-12 | Só para os `AUDIT_ADMINS`",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         restartService,
+		Description: "Comando que reinicia todas as instâncias de um serviço",
+		Usage:       "@bot comando `*serviço*`",
+		Lint:        "Sem o serviço aparece um menu para escolher, com o nome ou ID reinicia direto. No Kubernetes equivale ao `kubectl rollout restart` e no Swarm ao `docker service update --force`",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, Command{
+		Cmd:         scaleService,
+		Description: "Comando que altera a quantidade de instâncias de um serviço",
+		Usage:       "@bot comando `serviço` `quantidade`",
+		Lint:        "O serviço pode ser o nome ou o ID. No Kubernetes o ID tem o formato `deployment/nome` ou `statefulset/nome`. No Swarm, serviços globais não podem ser escalados",
+		IsActive:    true,
+	})
+
+	Commands = append(Commands, pluginCommands()...)
+
 	Commands = append(Commands, Command{
 		Cmd:         comandos,
 		Description: "Comando responsável por mostrar os comandos que estão disponíveis no BOT",
@@ -0,0 +1,275 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nlopes/slack"
+)
+
+// RancherProjects são os ambientes (projects) do Rancher acessados com as
+// mesmas chaves, no formato nome:id-do-project (ex.: staging:1a5,prod:1a7).
+// O RANCHER_PROJECT_ID é o ambiente default
+var RancherProjects = map[string]string{}
+
+// WithProject retorna uma cópia do listener apontando para outro project
+// (environment) do Rancher
+func (ranchListener *RancherListener) WithProject(projectID string) *RancherListener {
+	listener := *ranchListener
+	listener.projectID = projectID
+
+	return &listener
+}
+
+// rancherForEnvironment retorna o listener do ambiente do Rancher
+func rancherForEnvironment(name string) (*RancherListener, error) {
+	if projectID, ok := RancherProjects[name]; ok {
+		return rancherListener.WithProject(projectID), nil
+	}
+
+	if name == defaultEnvironment {
+		return rancherListener, nil
+	}
+
+	var names []string
+	for project := range RancherProjects {
+		names = append(names, project)
+	}
+	sort.Strings(names)
+
+	return nil, fmt.Errorf("ambiente `%s` não configurado no RANCHER_PROJECTS (configurados: %s)", name, strings.Join(append(names, defaultEnvironment), ", "))
+}
+
+// stackServices retorna os serviços da stack, pelo nome do serviço
+func stackServices(listener *RancherListener, stackName string) (map[string]Service, error) {
+	stacks, err := listener.ListStacks()
+	if err != nil {
+		return nil, err
+	}
+
+	stackID := ""
+	for _, stack := range stacks {
+		if stack.Name == stackName {
+			stackID = stack.ID
+		}
+	}
+	if stackID == "" {
+		return nil, fmt.Errorf("stack `%s` não encontrada", stackName)
+	}
+
+	services, err := listener.ListServices()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]Service{}
+	for _, service := range services {
+		if service.StackID == stackID {
+			result[service.Name] = service
+		}
+	}
+
+	return result, nil
+}
+
+// serviceDrift é a comparação de um serviço da stack nos dois ambientes
+type serviceDrift struct {
+	Name    string
+	A, B    *Service
+	Fields  []string
+	OnlyInA []string
+	OnlyInB []string
+}
+
+// envKeys são as chaves das variáveis de ambiente do serviço, sem os valores
+func envKeys(service *Service) map[string]bool {
+	keys := map[string]bool{}
+	for key := range service.LaunchConfig.Environment {
+		keys[key] = true
+	}
+
+	return keys
+}
+
+// missingKeys são as chaves de a que não estão em b, em ordem
+func missingKeys(a map[string]bool, b map[string]bool) []string {
+	var missing []string
+	for key := range a {
+		if !b[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing
+}
+
+// compareService compara imagem, scale, chaves das variáveis e saúde
+func compareService(name string, a *Service, b *Service) serviceDrift {
+	drift := serviceDrift{Name: name, A: a, B: b}
+	if a == nil || b == nil {
+		drift.Fields = []string{"serviço"}
+		return drift
+	}
+
+	imageA, tagA := normalizeImage(a.LaunchConfig.ImageUUID)
+	imageB, tagB := normalizeImage(b.LaunchConfig.ImageUUID)
+	if !sameImage(imageA, imageB) || tagA != tagB {
+		drift.Fields = append(drift.Fields, "imagem")
+	}
+	if a.Scale != b.Scale {
+		drift.Fields = append(drift.Fields, "scale")
+	}
+	if a.HealthState != b.HealthState {
+		drift.Fields = append(drift.Fields, "saúde")
+	}
+
+	keysA, keysB := envKeys(a), envKeys(b)
+	drift.OnlyInA = missingKeys(keysA, keysB)
+	drift.OnlyInB = missingKeys(keysB, keysA)
+	if len(drift.OnlyInA) > 0 || len(drift.OnlyInB) > 0 {
+		drift.Fields = append(drift.Fields, "variáveis")
+	}
+
+	return drift
+}
+
+// CompareStacks compara os serviços da stack nos dois ambientes, pelo nome
+func CompareStacks(envA string, envB string, stack string) ([]serviceDrift, error) {
+	var services [2]map[string]Service
+	for i, env := range []string{envA, envB} {
+		listener, err := rancherForEnvironment(env)
+		if err != nil {
+			return nil, err
+		}
+
+		services[i], err = stackServices(listener, stack)
+		if err != nil {
+			return nil, fmt.Errorf("%s no ambiente `%s`", err, env)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, list := range services {
+		for name := range list {
+			names[name] = true
+		}
+	}
+
+	var drifts []serviceDrift
+	for name := range names {
+		var a, b *Service
+		if service, ok := services[0][name]; ok {
+			a = &service
+		}
+		if service, ok := services[1][name]; ok {
+			b = &service
+		}
+		drifts = append(drifts, compareService(name, a, b))
+	}
+
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Name < drifts[j].Name })
+
+	return drifts, nil
+}
+
+// compareCell é o valor do serviço na tabela, - quando ele não existe
+func compareCell(service *Service, value func(*Service) string) string {
+	if service == nil {
+		return "-"
+	}
+
+	return value(service)
+}
+
+// CompareAttachment monta a tabela da comparação, com ! nos serviços com
+// diferença, e a lista das variáveis que só existem em um dos ambientes
+func CompareAttachment(envA string, envB string, stack string, drifts []serviceDrift) slack.Attachment {
+	var buf bytes.Buffer
+	table := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, " \tSERVIÇO\tTAG %s\tTAG %s\tSCALE\tSAÚDE\n", envA, envB)
+
+	tag := func(s *Service) string {
+		_, tag := normalizeImage(s.LaunchConfig.ImageUUID)
+		return tag
+	}
+	scale := func(s *Service) string { return strconv.Itoa(s.Scale) }
+	health := func(s *Service) string { return s.HealthState }
+
+	var drifted int
+	var details []string
+	for _, drift := range drifts {
+		marker := " "
+		if len(drift.Fields) > 0 {
+			marker = "!"
+			drifted++
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s/%s\t%s/%s\n", marker, drift.Name,
+			compareCell(drift.A, tag), compareCell(drift.B, tag),
+			compareCell(drift.A, scale), compareCell(drift.B, scale),
+			compareCell(drift.A, health), compareCell(drift.B, health))
+
+		switch {
+		case drift.A == nil:
+			details = append(details, fmt.Sprintf("`%s`: só existe em %s", drift.Name, envB))
+		case drift.B == nil:
+			details = append(details, fmt.Sprintf("`%s`: só existe em %s", drift.Name, envA))
+		case len(drift.Fields) > 0:
+			line := fmt.Sprintf("`%s`: %s", drift.Name, strings.Join(drift.Fields, ", "))
+			if len(drift.OnlyInA) > 0 {
+				line += fmt.Sprintf(" | só em %s: %s", envA, strings.Join(drift.OnlyInA, ", "))
+			}
+			if len(drift.OnlyInB) > 0 {
+				line += fmt.Sprintf(" | só em %s: %s", envB, strings.Join(drift.OnlyInB, ", "))
+			}
+			details = append(details, line)
+		}
+	}
+	table.Flush()
+
+	attachment := slack.Attachment{
+		Title: fmt.Sprintf(":left_right_arrow: Stack `%s`: %s x %s", stack, envA, envB),
+		Text:  fmt.Sprintf("```%s```", buf.String()),
+		Color: "good",
+	}
+
+	if drifted == 0 {
+		attachment.Footer = "Nenhuma diferença de imagem, scale, variáveis ou saúde"
+		return attachment
+	}
+
+	attachment.Color = "warning"
+	attachment.Fields = []slack.AttachmentField{{
+		Title: fmt.Sprintf("%d de %d serviços com diferença", drifted, len(drifts)),
+		Value: strings.Join(details, "\n"),
+	}}
+
+	return attachment
+}
+
+// slackCompare compara os serviços de uma stack em dois ambientes do Rancher
+func (s *SlackListener) slackCompare(ev *slack.MessageEvent) {
+	args := strings.Fields(ev.Msg.Text)
+	envA, envB, stack := args[2], args[3], args[4]
+
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", compareEnvs), false))
+		return
+	}
+
+	drifts, err := CompareStacks(envA, envB, stack)
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(":x: "+err.Error(), false))
+		return
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(CompareAttachment(envA, envB, stack, drifts)))
+}
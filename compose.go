@@ -0,0 +1,548 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	actionComposeDeploy  = "compose-deploy"
+	actionComposeDiscard = "compose-discard"
+
+	// composePendingTTL é o tempo que o resumo do compose espera pelo deploy
+	composePendingTTL = 30 * time.Minute
+
+	// composeMaxSize é o tamanho máximo do docker-compose.yml enviado
+	composeMaxSize = 256 * 1024
+)
+
+var (
+	// composeFileName são os arquivos enviados no canal tratados como deploy
+	composeFileName = regexp.MustCompile(`(?i)^docker-compose(\.[\w-]+)?\.ya?ml$`)
+
+	// rancherName são os nomes aceitos pelo Rancher nas stacks e serviços
+	rancherName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]*$`)
+
+	// composeStackOption é a stack informada no comentário do upload
+	composeStackOption = regexp.MustCompile(`stack=([\w-]+)`)
+
+	// composeValidateOption no comentário do upload só valida o arquivo
+	composeValidateOption = regexp.MustCompile(`(^|\s)validate(\s|$)`)
+)
+
+// ComposeFile é o docker-compose.yml enviado, só com os campos lidos pelo BOT.
+// O arquivo original é o enviado ao Rancher
+type ComposeFile struct {
+	Version  string                    `yaml:"version"`
+	Services map[string]ComposeService `yaml:"services"`
+}
+
+// ComposeService é um serviço do docker-compose.yml
+type ComposeService struct {
+	Image     string      `yaml:"image"`
+	Build     interface{} `yaml:"build"`
+	Ports     []string    `yaml:"ports"`
+	Links     []string    `yaml:"links"`
+	Volumes   []string    `yaml:"volumes"`
+	Labels    interface{} `yaml:"labels"`
+	MemLimit  interface{} `yaml:"mem_limit"`
+	CPUs      interface{} `yaml:"cpus"`
+	CPUQuota  int64       `yaml:"cpu_quota"`
+	CPUShares int64       `yaml:"cpu_shares"`
+}
+
+// LabelMap retorna as labels do serviço, que no compose podem ser um mapa ou
+// uma lista de chave=valor
+func (c ComposeService) LabelMap() map[string]string {
+	labels := map[string]string{}
+
+	switch value := c.Labels.(type) {
+	case map[interface{}]interface{}:
+		for key, label := range value {
+			labels[fmt.Sprintf("%v", key)] = fmt.Sprintf("%v", label)
+		}
+	case []interface{}:
+		for _, item := range value {
+			parts := strings.SplitN(fmt.Sprintf("%v", item), "=", 2)
+			if len(parts) == 2 {
+				labels[parts[0]] = parts[1]
+			} else {
+				labels[parts[0]] = ""
+			}
+		}
+	}
+
+	return labels
+}
+
+// composeDeploy é o deploy do compose aguardando a confirmação no resumo
+type composeDeploy struct {
+	Stack    string
+	StackID  string
+	FileName string
+	Content  string
+	User     string
+	Created  time.Time
+}
+
+var (
+	composePending      = map[string]*composeDeploy{}
+	composePendingMutex sync.Mutex
+)
+
+// ParseCompose lê e valida o docker-compose.yml: os serviços precisam de
+// imagem (o Rancher não faz build), nomes válidos e links para serviços do
+// arquivo ou de outra stack (stack/serviço). Retorna todos os problemas
+func ParseCompose(content []byte) (*ComposeFile, []string) {
+	var compose ComposeFile
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return nil, []string{"YAML inválido: " + err.Error()}
+	}
+
+	// O formato v1 não tem a chave services, os serviços ficam na raiz
+	if compose.Version == "" && len(compose.Services) == 0 {
+		if err := yaml.Unmarshal(content, &compose.Services); err != nil {
+			return nil, []string{"YAML inválido: " + err.Error()}
+		}
+	}
+
+	if len(compose.Services) == 0 {
+		return nil, []string{"nenhum serviço no arquivo"}
+	}
+
+	if strings.HasPrefix(compose.Version, "3") {
+		return nil, []string{fmt.Sprintf("versão `%s` não suportada, o Rancher aceita o compose v1 e v2", compose.Version)}
+	}
+
+	var problems []string
+	for _, name := range compose.ServiceNames() {
+		service := compose.Services[name]
+
+		if !rancherName.MatchString(name) {
+			problems = append(problems, fmt.Sprintf("`%s`: nome inválido, use letras, números e `-`", name))
+		}
+		if service.Image == "" {
+			if service.Build != nil {
+				problems = append(problems, fmt.Sprintf("`%s`: o Rancher não faz o build, use uma imagem já publicada", name))
+			} else {
+				problems = append(problems, fmt.Sprintf("`%s`: sem imagem", name))
+			}
+		}
+
+		for _, link := range service.Links {
+			target := strings.SplitN(link, ":", 2)[0]
+			if _, ok := compose.Services[target]; !ok && !strings.Contains(target, "/") {
+				problems = append(problems, fmt.Sprintf("`%s`: link para `%s`, que não está no arquivo", name, target))
+			}
+		}
+	}
+
+	return &compose, problems
+}
+
+// ServiceNames retorna os nomes dos serviços em ordem alfabética
+func (c *ComposeFile) ServiceNames() []string {
+	var names []string
+	for name := range c.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// composeStackName é a stack do deploy: o stack=nome do comentário do upload
+// ou o título do arquivo, quando foi trocado
+func composeStackName(file *slack.File) string {
+	if match := composeStackOption.FindStringSubmatch(file.InitialComment.Comment); match != nil {
+		return match[1]
+	}
+
+	title := strings.TrimSuffix(strings.TrimSuffix(file.Title, ".yml"), ".yaml")
+	if title != "" && !composeFileName.MatchString(file.Title) && rancherName.MatchString(title) {
+		return title
+	}
+
+	return ""
+}
+
+// GetStack busca a stack pelo ID
+func (ranchListener *RancherListener) GetStack(ID string) (*Stack, error) {
+	stack := &Stack{}
+	if err := ranchListener.api().Get(ranchListener.context(), "stacks/"+ID, stack); err != nil {
+		return nil, err
+	}
+
+	return stack, nil
+}
+
+// CreateStack cria a stack com o docker-compose e o rancher-compose (pode ser
+// vazio), já iniciando os serviços
+func (ranchListener *RancherListener) CreateStack(name string, dockerCompose string, rancherCompose string) (*Stack, error) {
+	body := map[string]interface{}{"name": name, "dockerCompose": dockerCompose, "rancherCompose": rancherCompose, "startOnCreate": true}
+
+	stack := &Stack{}
+	err := ranchListener.api().Post(ranchListener.context(), "stacks", body, stack)
+	ranchListener.invalidateCache(cacheStacks, cacheServices)
+	if err != nil {
+		return nil, err
+	}
+
+	return stack, nil
+}
+
+// UpgradeStack faz o upgrade da stack para o docker-compose, mantendo o
+// rancher-compose atual (scale, health checks)
+func (ranchListener *RancherListener) UpgradeStack(ID string, dockerCompose string) (*Stack, error) {
+	current, err := ranchListener.GetStack(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ranchListener.UpgradeStackConfig(ID, dockerCompose, current.RancherCompose)
+}
+
+// UpgradeStackConfig faz o upgrade da stack para o docker-compose e o
+// rancher-compose informados
+func (ranchListener *RancherListener) UpgradeStackConfig(ID string, dockerCompose string, rancherCompose string) (*Stack, error) {
+	body := map[string]interface{}{"dockerCompose": dockerCompose, "rancherCompose": rancherCompose}
+
+	stack := &Stack{}
+	err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("stacks/%s?action=upgrade", ID), body, stack)
+	ranchListener.invalidateCache(cacheStacks, cacheServices)
+	if err != nil {
+		return nil, err
+	}
+
+	return stack, nil
+}
+
+// FinishStackUpgrade confirma o upgrade da stack, removendo os containers
+// antigos
+func (ranchListener *RancherListener) FinishStackUpgrade(ID string) error {
+	err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("stacks/%s?action=finishupgrade", ID), nil, &Stack{})
+	ranchListener.invalidateCache(cacheStacks, cacheServices)
+
+	return err
+}
+
+// waitStack acompanha a stack até ela sair do estado de transição (ex.:
+// activating, upgrading), o ctx ser cancelado ou passar o
+// UpgradeProgressTimeout. Retorna o estado final
+func waitStack(ctx context.Context, listener *RancherListener, ID string, progress *Progress) (string, error) {
+	deadline := time.Now().Add(UpgradeProgressTimeout)
+
+	for {
+		stack, err := listener.GetStack(ID)
+		if err != nil {
+			return "", fmt.Errorf("erro ao buscar a stack %s: %s", ID, err)
+		}
+
+		if !strings.HasSuffix(stack.State, "ing") {
+			return stack.State, nil
+		}
+
+		progress.Update(0, 0, fmt.Sprintf("stack `%s`", stack.State))
+
+		if time.Now().After(deadline) {
+			return stack.State, fmt.Errorf("stack em `%s` após %s", stack.State, UpgradeProgressTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return stack.State, fmt.Errorf("stack em `%s`", stack.State)
+		case <-time.After(upgradePollInterval):
+		}
+	}
+}
+
+// finishStack aguarda a stack criada ou em upgrade no ambiente do listener e
+// confirma o upgrade, retornando o estado final
+func finishStack(ctx context.Context, listener *RancherListener, ID string, progress *Progress) (string, error) {
+	state, err := waitStack(ctx, listener, ID, progress)
+	if err != nil {
+		return "", err
+	}
+
+	if state == "upgraded" {
+		if err := listener.FinishStackUpgrade(ID); err != nil {
+			return "", fmt.Errorf("erro ao confirmar o upgrade: %s", err)
+		}
+		state = "active"
+	}
+
+	return state, nil
+}
+
+// composeSummaryAttachment é o resumo do deploy: os serviços do arquivo e,
+// quando a stack existe, o que muda em cada um, com os botões
+func composeSummaryAttachment(deploy *composeDeploy, compose *ComposeFile, ID string) slack.Attachment {
+	current := map[string]string{}
+	if deploy.StackID != "" {
+		services, err := rancherListener.ListServices()
+		CheckErr("Erro ao listar os serviços da stack "+deploy.StackID, err)
+
+		for _, service := range services {
+			if service.StackID == deploy.StackID {
+				current[service.Name] = strings.TrimPrefix(service.LaunchConfig.ImageUUID, "docker:")
+			}
+		}
+	}
+
+	attachment := slack.Attachment{
+		Title:      fmt.Sprintf(":whale: Deploy do `%s` na stack `%s`", deploy.FileName, deploy.Stack),
+		Text:       fmt.Sprintf("Cria a stack `%s` com %d serviços, enviado por <@%s>", deploy.Stack, len(compose.Services), deploy.User),
+		Color:      "#0C648A",
+		CallbackID: actionComposeDeploy,
+	}
+	if deploy.StackID != "" {
+		attachment.Text = fmt.Sprintf("Upgrade da stack `%s` (%s) com %d serviços, enviado por <@%s>", deploy.Stack, deploy.StackID, len(compose.Services), deploy.User)
+	}
+
+	for _, name := range compose.ServiceNames() {
+		service := compose.Services[name]
+
+		value := fmt.Sprintf("`%s`", service.Image)
+		if image, ok := current[name]; deploy.StackID != "" && !ok {
+			value += " (novo)"
+		} else if ok && image != service.Image {
+			value = fmt.Sprintf("`%s` -> `%s`", image, service.Image)
+		} else if ok {
+			value += " (mesma imagem)"
+		}
+		if len(service.Ports) > 0 {
+			value += "\nPortas: " + strings.Join(service.Ports, ", ")
+		}
+
+		attachment.Fields = append(attachment.Fields, slack.AttachmentField{Title: name, Value: value, Short: true})
+	}
+
+	var kept []string
+	for name := range current {
+		if _, ok := compose.Services[name]; !ok {
+			kept = append(kept, name)
+		}
+	}
+	sort.Strings(kept)
+	if len(kept) > 0 {
+		attachment.Footer = fmt.Sprintf("Os serviços da stack fora do arquivo não são removidos: %s", strings.Join(kept, ", "))
+	}
+
+	attachment.Actions = []slack.AttachmentAction{
+		{
+			Name: actionComposeDeploy, Text: "Deploy", Type: "button", Style: "primary", Value: ID,
+			Confirm: &slack.ConfirmationField{Title: "Fazer o deploy?", Text: fmt.Sprintf("A stack %s será alterada no Rancher", deploy.Stack), OkText: "Deploy", DismissText: "Cancelar"},
+		},
+		{Name: actionComposeDiscard, Text: "Descartar", Type: "button", Value: ID},
+	}
+
+	return attachment
+}
+
+// handleFileShared trata os docker-compose.yml enviados no canal do BOT ou
+// dos times: valida o arquivo e envia o resumo do deploy com a confirmação
+func (s *SlackListener) handleFileShared(ev *slack.FileSharedEvent) {
+	if ShuttingDown() {
+		return
+	}
+
+	fileID := ev.FileID
+	if fileID == "" {
+		fileID = ev.File.ID
+	}
+
+	file, _, _, err := s.client.GetFileInfo(fileID, 0, 0)
+	if err != nil {
+		CheckErr("Erro ao buscar o arquivo "+fileID, err)
+		return
+	}
+
+	if file.User == s.botID || !composeFileName.MatchString(file.Name) {
+		return
+	}
+
+	channel := ""
+	for _, candidate := range append(file.Channels, file.Groups...) {
+		if candidate == s.channelID || TenantForChannel(candidate) != nil {
+			channel = candidate
+			break
+		}
+	}
+	if channel == "" {
+		return
+	}
+
+	reply := func(text string) {
+		s.client.PostMessage(channel, slack.MsgOptionText(text, false))
+	}
+
+	// Com validate no comentário o arquivo só é validado, sem o deploy
+	if composeValidateOption.MatchString(file.InitialComment.Comment) {
+		content, err := s.downloadCompose(file)
+		if err != nil {
+			reply(err.Error())
+			return
+		}
+
+		compose, problems := ParseCompose(content)
+		if compose != nil {
+			problems = append(problems, ComposePolicyViolations(compose)...)
+		}
+
+		log.Printf("[INFO] Compose %s validado para %s: %d problemas\n", file.Name, file.User, len(problems))
+		reply(policyResultMessage(fmt.Sprintf("O `%s`", file.Name), problems))
+		return
+	}
+
+	if orchestrator.Name() != "rancher" {
+		reply(fmt.Sprintf("O deploy do `%s` só está disponível no Rancher", file.Name))
+		return
+	}
+
+	stackName := composeStackName(file)
+	if stackName == "" {
+		reply(fmt.Sprintf(":whale: Para o deploy do `%s`, informe a stack no comentário do upload (ex.: `stack=payments`) ou use o nome dela como título do arquivo. Para só validar, comente `validate`", file.Name))
+		return
+	}
+
+	if tenant := TenantForChannel(channel); tenant != nil && !tenant.AllowsStack(stackName) {
+		reply(fmt.Sprintf(":no_entry: A stack `%s` não é do time `%s`", stackName, tenant.Name))
+		return
+	}
+
+	content, err := s.downloadCompose(file)
+	if err != nil {
+		reply(err.Error())
+		return
+	}
+
+	compose, problems := ParseCompose(content)
+	if compose != nil {
+		problems = append(problems, ComposePolicyViolations(compose)...)
+	}
+	if len(problems) > 0 {
+		log.Printf("[INFO] Compose %s enviado por %s recusado: %s\n", file.Name, file.User, strings.Join(problems, "; "))
+		reply(fmt.Sprintf(":x: O `%s` não passou na validação:\n• %s", file.Name, strings.Join(problems, "\n• ")))
+		return
+	}
+
+	deploy := &composeDeploy{Stack: stackName, FileName: file.Name, Content: string(content), User: file.User, Created: time.Now()}
+
+	stacks, err := rancherListener.ListStacks()
+	if err != nil {
+		reply(fmt.Sprintf(":x: Erro ao buscar as stacks: %s", err))
+		return
+	}
+	for _, stack := range stacks {
+		if stack.Name == stackName {
+			deploy.StackID = stack.ID
+		}
+	}
+
+	ID := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	composePendingMutex.Lock()
+	for key, pending := range composePending {
+		if time.Since(pending.Created) > composePendingTTL {
+			delete(composePending, key)
+		}
+	}
+	composePending[ID] = deploy
+	composePendingMutex.Unlock()
+
+	log.Printf("[INFO] Compose %s para a stack %s enviado por %s\n", file.Name, stackName, file.User)
+	s.client.PostMessage(channel, slack.MsgOptionAttachments(composeSummaryAttachment(deploy, compose, ID)))
+}
+
+// downloadCompose baixa o docker-compose.yml enviado, até o composeMaxSize
+func (s *SlackListener) downloadCompose(file *slack.File) ([]byte, error) {
+	if file.Size > composeMaxSize {
+		return nil, fmt.Errorf(":x: O `%s` tem mais de %d KB", file.Name, composeMaxSize/1024)
+	}
+
+	var content bytes.Buffer
+	if err := s.client.GetFile(file.URLPrivateDownload, &content); err != nil {
+		CheckErr("Erro ao baixar o arquivo "+file.Name, err)
+		return nil, fmt.Errorf(":x: Erro ao baixar o `%s`: %s", file.Name, err)
+	}
+
+	return content.Bytes(), nil
+}
+
+// takeComposePending retira o deploy pendente, nil quando ele expirou
+func takeComposePending(ID string) *composeDeploy {
+	composePendingMutex.Lock()
+	defer composePendingMutex.Unlock()
+
+	pending, ok := composePending[ID]
+	delete(composePending, ID)
+	if !ok || time.Since(pending.Created) > composePendingTTL {
+		return nil
+	}
+
+	return pending
+}
+
+// actionComposeDeployFunction cria ou faz o upgrade da stack com o compose
+// enviado, como job, confirmando o upgrade quando a stack termina
+func actionComposeDeployFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	deploy := takeComposePending(message.Actions[0].Value)
+	if deploy == nil {
+		respondWithoutActions(w, message.OriginalMessage, ":hourglass: Esse resumo expirou, envie o arquivo de novo", "")
+		return
+	}
+
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":rocket: Deploy iniciado por @%s", message.User.Name), "")
+
+	channel, user := message.Channel.ID, message.User.Name
+	job, err := EnqueueJobContext("deploy da stack "+deploy.Stack, user, func(ctx context.Context) error {
+		progress := StartProgress(channel, fmt.Sprintf("*Deploy* do `%s` na stack `%s`, por @%s", deploy.FileName, deploy.Stack, user), JobFromContext(ctx))
+
+		var stack *Stack
+		var err error
+		if deploy.StackID == "" {
+			progress.Update(0, 0, "criando a stack")
+			stack, err = rancherListener.CreateStack(deploy.Stack, deploy.Content, "")
+		} else {
+			progress.Update(0, 0, "iniciando o upgrade")
+			stack, err = rancherListener.UpgradeStack(deploy.StackID, deploy.Content)
+		}
+		if err != nil {
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		state, err := finishStack(ctx, rancherListener, stack.ID, progress)
+		if err != nil {
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		log.Printf("[INFO] Deploy do compose %s na stack %s feito pelo usuário %s\n", deploy.FileName, deploy.Stack, user)
+		progress.Finish(true, fmt.Sprintf("stack `%s` (%s) `%s`", deploy.Stack, stack.ID, state))
+		return nil
+	})
+	interactionJob(w, job, err)
+	if err != nil {
+		sendMessage(queuedJobMessage(job, err))
+	}
+}
+
+func actionComposeDiscardFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	takeComposePending(message.Actions[0].Value)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Deploy descartado por @%s", message.User.Name), "")
+}
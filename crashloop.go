@@ -0,0 +1,175 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	crashLoopCallback   = "crash-loop"
+	actionCrashLoopStop = "crash-loop-stop"
+)
+
+var (
+	// CrashLoopMonitor define se os containers do Rancher são monitorados
+	// para detectar restarts em loop
+	CrashLoopMonitor bool
+
+	// CrashLoopRestarts é a quantidade de restarts dentro da janela para
+	// considerar o container em crash loop
+	CrashLoopRestarts = 3
+
+	// CrashLoopWindow é a janela de tempo em que os restarts são contados
+	CrashLoopWindow = 10 * time.Minute
+
+	// CrashLoopInterval é o intervalo entre as verificações dos containers
+	CrashLoopInterval = 30 * time.Second
+)
+
+// crashLoopState guarda os restarts recentes de um container
+type crashLoopState struct {
+	startCount int64
+	restarts   []time.Time
+	alertedAt  time.Time
+}
+
+// recordRestarts registra os novos restarts do container e retorna se ele
+// passou do limite dentro da janela (avisando no máximo uma vez por janela)
+func (c *crashLoopState) recordRestarts(startCount int64, now time.Time) bool {
+	for i := c.startCount; i < startCount; i++ {
+		c.restarts = append(c.restarts, now)
+	}
+	c.startCount = startCount
+
+	var recent []time.Time
+	for _, restart := range c.restarts {
+		if now.Sub(restart) <= CrashLoopWindow {
+			recent = append(recent, restart)
+		}
+	}
+	c.restarts = recent
+
+	if len(c.restarts) < CrashLoopRestarts || now.Sub(c.alertedAt) < CrashLoopWindow {
+		return false
+	}
+
+	c.alertedAt = now
+
+	return true
+}
+
+// WatchCrashLoops acompanha o startCount dos containers do Rancher e avisa no
+// canal quando algum reinicia CrashLoopRestarts vezes dentro da CrashLoopWindow
+func WatchCrashLoops() {
+	if !CrashLoopMonitor {
+		return
+	}
+
+	log.Printf("[INFO] Detectando crash loops (%d restarts em %s)\n", CrashLoopRestarts, CrashLoopWindow)
+
+	states := map[string]*crashLoopState{}
+
+	for {
+		now := time.Now()
+		seen := map[string]bool{}
+
+		containers, err := rancherListener.FetchContainers()
+		if err != nil {
+			// Sem a lista os containers não podem sair do acompanhamento
+			CheckErr("Erro ao buscar os containers", err)
+			time.Sleep(CrashLoopInterval)
+			continue
+		}
+
+		for _, container := range containers {
+			containerID := container.ID
+			startCount := container.StartCount
+			seen[containerID] = true
+
+			state, ok := states[containerID]
+			if !ok {
+				// Na primeira vez só guarda o contador, os restarts antigos não contam
+				states[containerID] = &crashLoopState{startCount: startCount}
+				continue
+			}
+
+			if state.recordRestarts(startCount, now) {
+				go sendCrashLoopAlert(container, len(state.restarts))
+			}
+		}
+
+		// Containers removidos saem do acompanhamento
+		for containerID := range states {
+			if !seen[containerID] {
+				delete(states, containerID)
+			}
+		}
+
+		time.Sleep(CrashLoopInterval)
+	}
+}
+
+// sendCrashLoopAlert avisa o crash loop com os botões de parar o container e
+// abrir incidente, enviando em seguida os últimos logs do container
+func sendCrashLoopAlert(container Container, restarts int) {
+	containerID := container.ID
+	name := container.Name
+	serviceID := container.ServiceID()
+
+	summary := fmt.Sprintf("Container %s reiniciou %d vezes nos últimos %s", name, restarts, CrashLoopWindow)
+	log.Printf("[INFO] Crash loop detectado: %s\n", summary)
+	RecordDigestAlert("crash loop", summary)
+
+	attachment := slack.Attachment{
+		Title:      fmt.Sprintf(":recycle: Crash loop no container %s", name),
+		Text:       summary,
+		Footer:     fmt.Sprintf("Container: %s | Serviço: %s | Estado: %s", containerID, serviceID, container.State),
+		Color:      "#D50200",
+		CallbackID: crashLoopCallback,
+		Actions: []slack.AttachmentAction{
+			{
+				Name:  actionCrashLoopStop,
+				Text:  "Parar container",
+				Type:  "button",
+				Style: "danger",
+				Value: containerID,
+				Confirm: &slack.ConfirmationField{
+					Title:       "Tem certeza disso?",
+					Text:        fmt.Sprintf("Deseja mesmo parar o container %s? :thinking_face:", name),
+					OkText:      "Sim",
+					DismissText: "Não",
+				},
+			},
+			openIncidentAction(serviceID),
+		},
+	}
+
+	api := getAPIConnection()
+	api.client.PostMessage(api.channelID, withOncallMention(slack.MsgOptionAttachments(attachment))...)
+
+	PageCritical(serviceID, summary, map[string]string{"container": containerID})
+
+	if _, err := UploadContainerLogs(containerID, LogsOptions{Lines: 200}); err != nil {
+		CheckErr("Erro ao enviar os logs do container em crash loop", err)
+	}
+}
+
+func actionCrashLoopStopFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	containerID := message.Actions[0].Value
+
+	state, err := rancherListener.StopContainer(containerID)
+	if err != nil {
+		respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao parar o container `%s`: %s", containerID, err), "")
+		return
+	}
+
+	log.Printf("[INFO] Container %s parado pelo usuário %s\n", containerID, message.User.Name)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":octagonal_sign: Container parado por @%s", message.User.Name), fmt.Sprintf("Estado do container: `%s`", state))
+}
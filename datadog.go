@@ -0,0 +1,191 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	// DatadogAPIKey é a API key usada para enviar eventos
+	DatadogAPIKey string
+
+	// DatadogAppKey é a application key, necessária para silenciar monitores
+	DatadogAppKey string
+
+	// DatadogSite é o site da conta (datadoghq.com, datadoghq.eu, us5.datadoghq.com...)
+	DatadogSite = "datadoghq.com"
+
+	// DatadogTags são tags extras enviadas em todos os eventos (ex.: env:production)
+	DatadogTags []string
+
+	// DatadogServiceMap é o mapeamento do ID do serviço para o nome do serviço
+	// no Datadog. Sem o mapeamento é usado o nome do serviço no orquestrador
+	DatadogServiceMap = map[string]string{}
+
+	// DatadogMuteDuration é o tempo padrão que os monitores ficam silenciados
+	DatadogMuteDuration = time.Hour
+)
+
+// DatadogEnabled retorna se a integração com o Datadog está configurada
+func DatadogEnabled() bool {
+	return DatadogAPIKey != ""
+}
+
+func datadogURL(path string) string {
+	return "https://api." + DatadogSite + path
+}
+
+func datadogHeaders() map[string]string {
+	return map[string]string{
+		"DD-API-KEY":         DatadogAPIKey,
+		"DD-APPLICATION-KEY": DatadogAppKey,
+	}
+}
+
+// datadogService retorna o nome do serviço usado nas tags do Datadog
+func datadogService(serviceID string) string {
+	if name, ok := DatadogServiceMap[serviceID]; ok {
+		return name
+	}
+
+	if service, err := orchestrator.GetService(serviceID); err == nil && service.Name != "" {
+		return service.Name
+	}
+
+	return serviceID
+}
+
+// SendDatadogEvent envia a alteração para o event stream do Datadog
+func SendDatadogEvent(change ChangeEvent) error {
+	service := datadogService(change.ServiceID)
+
+	tags := append([]string{
+		"service:" + service,
+		"source:slack-bot",
+		"change:" + change.Kind,
+	}, DatadogTags...)
+
+	event := map[string]interface{}{
+		"title":            fmt.Sprintf("%s de %s", strings.Title(change.Kind), service),
+		"text":             change.Description(),
+		"tags":             tags,
+		"alert_type":       "info",
+		"aggregation_key":  service,
+		"source_type_name": "slack-bot",
+	}
+
+	_, err := HTTPSendJSONRequest(PostHTTP, datadogURL("/api/v1/events"), datadogHeaders(), event)
+
+	return err
+}
+
+// datadogMonitors busca os IDs dos monitores com a tag service:<serviço>
+func datadogMonitors(service string) ([]int64, error) {
+	resp, err := HTTPSendJSONRequest(GetHTTP, datadogURL("/api/v1/monitor?monitor_tags="+url.QueryEscape("service:"+service)), datadogHeaders(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var IDs []int64
+	for _, monitor := range gjson.Parse(resp).Array() {
+		IDs = append(IDs, monitor.Get("id").Int())
+	}
+
+	return IDs, nil
+}
+
+// MuteDatadogMonitors silencia (ou reativa) os monitores do serviço,
+// retornando a quantidade de monitores alterados
+func MuteDatadogMonitors(serviceID string, mute bool, duration time.Duration) (int, error) {
+	if DatadogAppKey == "" {
+		return 0, fmt.Errorf("DATADOG_APP_KEY não configurada")
+	}
+
+	service := datadogService(serviceID)
+
+	IDs, err := datadogMonitors(service)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(IDs) == 0 {
+		return 0, fmt.Errorf("nenhum monitor com a tag service:%s", service)
+	}
+
+	for _, ID := range IDs {
+		if mute {
+			_, err = HTTPSendJSONRequest(PostHTTP, datadogURL(fmt.Sprintf("/api/v1/monitor/%d/mute", ID)), datadogHeaders(), map[string]interface{}{
+				"end": time.Now().Add(duration).Unix(),
+			})
+		} else {
+			_, err = HTTPSendJSONRequest(PostHTTP, datadogURL(fmt.Sprintf("/api/v1/monitor/%d/unmute", ID)), datadogHeaders(), map[string]interface{}{
+				"all_scopes": true,
+			})
+		}
+
+		if err != nil {
+			return 0, fmt.Errorf("erro no monitor %d: %s", ID, err)
+		}
+	}
+
+	return len(IDs), nil
+}
+
+// slackDatadogMute silencia os monitores do serviço durante uma manutenção
+func (s *SlackListener) slackDatadogMute(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) < 3 || len(args) > 4 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s id-serviço [duração]", datadogMute), false))
+		return
+	}
+
+	duration := DatadogMuteDuration
+	if len(args) == 4 {
+		d, err := time.ParseDuration(args[3])
+		if err != nil || d <= 0 {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText("Duração inválida, use o formato 30m, 2h, etc.", false))
+			return
+		}
+		duration = d
+	}
+
+	count, err := MuteDatadogMonitors(args[2], true, duration)
+	if err != nil {
+		CheckErr("Erro ao silenciar os monitores do Datadog", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao silenciar os monitores do serviço `%s`: %s", args[2], err), false))
+		return
+	}
+
+	log.Printf("[INFO] %d monitores do serviço %s silenciados por %s pelo usuário %s\n", count, args[2], duration, ev.Msg.User)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":mute: %d monitores do serviço `%s` silenciados por %s", count, args[2], duration), false))
+}
+
+// slackDatadogUnmute reativa os monitores do serviço
+func (s *SlackListener) slackDatadogUnmute(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) != 3 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s id-serviço", datadogUnmute), false))
+		return
+	}
+
+	count, err := MuteDatadogMonitors(args[2], false, 0)
+	if err != nil {
+		CheckErr("Erro ao reativar os monitores do Datadog", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao reativar os monitores do serviço `%s`: %s", args[2], err), false))
+		return
+	}
+
+	log.Printf("[INFO] %d monitores do serviço %s reativados pelo usuário %s\n", count, args[2], ev.Msg.User)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":loud_sound: %d monitores do serviço `%s` reativados", count, args[2]), false))
+}
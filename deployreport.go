@@ -0,0 +1,286 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// Ações do audit registradas ao fim dos upgrades e rollbacks
+const (
+	auditDeploy   = "deploy"
+	auditRollback = "rollback"
+)
+
+const (
+	// deployReportPeriod é o período coberto pelo relatório semanal
+	deployReportPeriod = 7 * 24 * time.Hour
+
+	// deployReportFields é a quantidade máxima de serviços na mensagem do
+	// relatório, o CSV tem todos
+	deployReportFields = 20
+)
+
+var (
+	// WeeklyReportTime é o horário (HH:MM, no MessagesTimezone) do relatório
+	// semanal de deploys. Vazio desliga o relatório
+	WeeklyReportTime string
+
+	// WeeklyReportDay é o dia da semana do relatório semanal de deploys
+	WeeklyReportDay = time.Monday
+)
+
+// weekdays são os nomes aceitos no WEEKLY_REPORT_DAY
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// RecordDeployAudit registra no audit o fim do upgrade ou rollback do
+// serviço, com a duração e o resultado, usado no relatório semanal
+func RecordDeployAudit(action string, serviceID string, image string, user string, started time.Time, err error) {
+	status := 200
+	if err != nil {
+		status = 500
+	}
+
+	RecordAudit(AuditEntry{
+		Source:   auditSourceJob,
+		User:     user,
+		Action:   action,
+		Value:    image,
+		Status:   status,
+		Service:  serviceID,
+		Duration: time.Since(started),
+	})
+}
+
+// DeployStats são os números de deploy de um serviço no período
+type DeployStats struct {
+	ServiceID string
+	Name      string
+	Upgrades  int
+	Rollbacks int
+	Failed    int
+	Duration  time.Duration
+	Users     map[string]int
+}
+
+// Total é a quantidade de upgrades e rollbacks
+func (d *DeployStats) Total() int {
+	return d.Upgrades + d.Rollbacks
+}
+
+// SuccessRate é o percentual de upgrades e rollbacks sem erro
+func (d *DeployStats) SuccessRate() float64 {
+	if d.Total() == 0 {
+		return 0
+	}
+
+	return float64(d.Total()-d.Failed) * 100 / float64(d.Total())
+}
+
+// MeanDuration é a duração média dos upgrades e rollbacks
+func (d *DeployStats) MeanDuration() time.Duration {
+	if d.Total() == 0 {
+		return 0
+	}
+
+	return d.Duration / time.Duration(d.Total())
+}
+
+// UsersList é quem fez os deploys, quem fez mais primeiro (ex.: alice (3), bob (1))
+func (d *DeployStats) UsersList() string {
+	var users []string
+	for user := range d.Users {
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if d.Users[users[i]] != d.Users[users[j]] {
+			return d.Users[users[i]] > d.Users[users[j]]
+		}
+		return users[i] < users[j]
+	})
+
+	for i, user := range users {
+		users[i] = fmt.Sprintf("%s (%d)", user, d.Users[user])
+	}
+
+	return strings.Join(users, ", ")
+}
+
+// DeployReport monta os números de deploy por serviço a partir do audit, o
+// serviço com mais deploys primeiro
+func DeployReport(since time.Time) []*DeployStats {
+	byService := map[string]*DeployStats{}
+
+	for _, entry := range QueryAudit(AuditFilter{Source: auditSourceJob, Since: since}) {
+		if entry.Action != auditDeploy && entry.Action != auditRollback {
+			continue
+		}
+
+		stats, ok := byService[entry.Service]
+		if !ok {
+			stats = &DeployStats{ServiceID: entry.Service, Name: serviceIndex.Name(entry.Service), Users: map[string]int{}}
+			byService[entry.Service] = stats
+		}
+
+		if entry.Action == auditDeploy {
+			stats.Upgrades++
+		} else {
+			stats.Rollbacks++
+		}
+
+		if entry.Status >= 400 {
+			stats.Failed++
+		}
+
+		user := entry.User
+		if user == "" {
+			user = "desconhecido"
+		}
+
+		stats.Users[user]++
+		stats.Duration += entry.Duration
+	}
+
+	var report []*DeployStats
+	for _, stats := range byService {
+		report = append(report, stats)
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Total() != report[j].Total() {
+			return report[i].Total() > report[j].Total()
+		}
+		return report[i].Name < report[j].Name
+	})
+
+	return report
+}
+
+// DeployReportAttachment é a mensagem do relatório, com um campo por serviço
+func DeployReportAttachment(report []*DeployStats, since time.Time) slack.Attachment {
+	attachment := slack.Attachment{
+		Title: fmt.Sprintf(":bar_chart: Relatório semanal de deploys do ambiente %s", orchestratorEnvironment),
+		Color: "#0C648A",
+	}
+
+	if len(report) == 0 {
+		attachment.Text = fmt.Sprintf("Nenhum upgrade ou rollback pelo BOT desde %s", slackDate(since))
+		return attachment
+	}
+
+	var upgrades, rollbacks, failed int
+	for i, stats := range report {
+		upgrades += stats.Upgrades
+		rollbacks += stats.Rollbacks
+		failed += stats.Failed
+
+		if i < deployReportFields {
+			attachment.Fields = append(attachment.Fields, slack.AttachmentField{
+				Title: stats.Name,
+				Value: fmt.Sprintf("%d upgrades, %d rollbacks\nSucesso: %.0f%%\nDuração média: %s\nPor: %s",
+					stats.Upgrades, stats.Rollbacks, stats.SuccessRate(), formatDuration(stats.MeanDuration()), stats.UsersList()),
+				Short: true,
+			})
+		}
+	}
+
+	attachment.Text = fmt.Sprintf("Desde %s: *%d* upgrades e *%d* rollbacks em %d serviços, %d com erro", slackDate(since), upgrades, rollbacks, len(report), failed)
+	if len(report) > deployReportFields {
+		attachment.Footer = fmt.Sprintf("Mostrando %d de %d serviços, todos estão no CSV", deployReportFields, len(report))
+	}
+	if failed > 0 {
+		attachment.Color = "warning"
+	}
+
+	return attachment
+}
+
+// DeployReportCSV é o relatório em CSV, uma linha por serviço
+func DeployReportCSV(report []*DeployStats) []byte {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	writer.Write([]string{"service_id", "service", "upgrades", "rollbacks", "failed", "success_rate", "mean_duration_seconds", "users"})
+	for _, stats := range report {
+		writer.Write([]string{
+			stats.ServiceID,
+			stats.Name,
+			strconv.Itoa(stats.Upgrades),
+			strconv.Itoa(stats.Rollbacks),
+			strconv.Itoa(stats.Failed),
+			strconv.FormatFloat(stats.SuccessRate(), 'f', 1, 64),
+			strconv.FormatFloat(stats.MeanDuration().Seconds(), 'f', 0, 64),
+			stats.UsersList(),
+		})
+	}
+	writer.Flush()
+
+	return buf.Bytes()
+}
+
+// SendDeployReport envia o relatório de deploys desde o horário no canal,
+// com o CSV em anexo
+func SendDeployReport(channel string, since time.Time) {
+	report := DeployReport(since)
+
+	api := getAPIConnection()
+	api.client.PostMessage(channel, slack.MsgOptionAttachments(DeployReportAttachment(report, since)))
+
+	if len(report) == 0 {
+		return
+	}
+
+	_, err := api.client.UploadFile(slack.FileUploadParameters{
+		Content:  string(DeployReportCSV(report)),
+		Filetype: "csv",
+		Filename: fmt.Sprintf("deploys-%s.csv", localTime(since, "2006-01-02")),
+		Title:    fmt.Sprintf("Deploys desde %s", localTime(since, "02/01/2006")),
+		Channels: []string{channel},
+	})
+	CheckErr("Erro ao enviar o CSV do relatório de deploys", err)
+}
+
+// WatchWeeklyReport envia o relatório semanal de deploys no canal, no
+// WeeklyReportDay às WeeklyReportTime
+func WatchWeeklyReport() {
+	if WeeklyReportTime == "" {
+		return
+	}
+
+	clock, err := parseClock(WeeklyReportTime)
+	if err != nil {
+		CheckErr("Erro ao ler o WEEKLY_REPORT_TIME", err)
+		return
+	}
+
+	log.Printf("[INFO] Relatório semanal de deploys agendado para %s às %s\n", WeeklyReportDay, WeeklyReportTime)
+
+	for {
+		next := nextDigest(time.Now(), clock)
+		for next.Weekday() != WeeklyReportDay {
+			next = nextDigest(next, clock)
+		}
+
+		time.Sleep(time.Until(next))
+		SendDeployReport(getAPIConnection().channelID, next.Add(-deployReportPeriod))
+	}
+}
@@ -0,0 +1,317 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// Seções do resumo diário
+const (
+	digestActions   = "actions"
+	digestDeploys   = "deploys"
+	digestAlerts    = "alerts"
+	digestUnhealthy = "unhealthy"
+)
+
+const (
+	// digestPeriod é o período coberto pelo resumo diário
+	digestPeriod = 24 * time.Hour
+
+	// digestListSize é a quantidade máxima de itens em cada lista do resumo
+	digestListSize = 10
+)
+
+var (
+	// DigestTime é o horário (HH:MM, no MessagesTimezone) do resumo diário no
+	// canal. Vazio desliga o resumo
+	DigestTime string
+
+	// DigestSections são as seções do resumo diário, na ordem em que aparecem
+	DigestSections = []string{digestActions, digestDeploys, digestAlerts, digestUnhealthy}
+)
+
+// digestEvent é um deploy ou alerta guardado para o resumo diário
+type digestEvent struct {
+	At     time.Time
+	Source string
+	Text   string
+}
+
+var (
+	digestDeployEvents []digestEvent
+	digestAlertEvents  []digestEvent
+	digestMutex        sync.Mutex
+)
+
+// appendDigestEvent guarda o evento, descartando os que já saíram do período
+// do resumo
+func appendDigestEvent(events []digestEvent, event digestEvent) []digestEvent {
+	cutoff := time.Now().Add(-digestPeriod)
+
+	kept := events[:0]
+	for _, e := range events {
+		if e.At.After(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+
+	return append(kept, event)
+}
+
+// RecordDigestDeploy guarda o upgrade ou rollback (feito pelo BOT ou
+// detectado no orquestrador) para o resumo diário
+func RecordDigestDeploy(source string, text string) {
+	if DigestTime == "" {
+		return
+	}
+
+	digestMutex.Lock()
+	defer digestMutex.Unlock()
+
+	digestDeployEvents = appendDigestEvent(digestDeployEvents, digestEvent{At: time.Now(), Source: source, Text: text})
+}
+
+// RecordDigestAlert guarda o alerta disparado para o resumo diário
+func RecordDigestAlert(source string, text string) {
+	if DigestTime == "" {
+		return
+	}
+
+	digestMutex.Lock()
+	defer digestMutex.Unlock()
+
+	digestAlertEvents = appendDigestEvent(digestAlertEvents, digestEvent{At: time.Now(), Source: source, Text: text})
+}
+
+// digestEventsSince retorna os eventos a partir do horário
+func digestEventsSince(events *[]digestEvent, since time.Time) []digestEvent {
+	digestMutex.Lock()
+	defer digestMutex.Unlock()
+
+	var result []digestEvent
+	for _, event := range *events {
+		if !event.At.Before(since) {
+			result = append(result, event)
+		}
+	}
+
+	return result
+}
+
+// nextDigest retorna o próximo horário do resumo depois de now
+func nextDigest(now time.Time, clock time.Duration) time.Time {
+	now = now.In(MessagesTimezone)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, MessagesTimezone)
+
+	next := midnight.Add(clock)
+	if !next.After(now) {
+		next = midnight.AddDate(0, 0, 1).Add(clock)
+	}
+
+	return next
+}
+
+// WatchDailyDigest envia o resumo diário no canal no DigestTime
+func WatchDailyDigest() {
+	if DigestTime == "" {
+		return
+	}
+
+	clock, err := parseClock(DigestTime)
+	if err != nil {
+		CheckErr("Erro ao ler o DIGEST_TIME", err)
+		return
+	}
+
+	log.Printf("[INFO] Resumo diário agendado para as %s (%s)\n", DigestTime, strings.Join(DigestSections, ", "))
+
+	for {
+		next := nextDigest(time.Now(), clock)
+		time.Sleep(time.Until(next))
+
+		api := getAPIConnection()
+		api.client.PostMessage(api.channelID, slack.MsgOptionAttachments(DigestAttachments(next.Add(-digestPeriod))...))
+	}
+}
+
+// DigestAttachments monta o resumo a partir do horário, com uma mensagem por
+// seção configurada
+func DigestAttachments(since time.Time) []slack.Attachment {
+	attachments := []slack.Attachment{{
+		Title: fmt.Sprintf(":newspaper: Resumo diário do ambiente %s", orchestratorEnvironment),
+		Text:  fmt.Sprintf("Desde %s", slackDate(since)),
+		Color: "#0C648A",
+	}}
+
+	for _, section := range DigestSections {
+		switch section {
+		case digestActions:
+			attachments = append(attachments, digestActionsAttachment(since))
+		case digestDeploys:
+			attachments = append(attachments, digestEventsAttachment(":rocket: Deploys", "nenhum upgrade ou rollback", digestEventsSince(&digestDeployEvents, since)))
+		case digestAlerts:
+			attachments = append(attachments, digestEventsAttachment(":rotating_light: Alertas", "nenhum alerta disparado", digestEventsSince(&digestAlertEvents, since)))
+		case digestUnhealthy:
+			attachments = append(attachments, digestUnhealthyAttachment())
+		}
+	}
+
+	return attachments
+}
+
+// digestCount é a contagem de um item nas listas do resumo
+type digestCount struct {
+	Name  string
+	Count int
+}
+
+// digestTop retorna os itens mais frequentes, no máximo digestListSize
+func digestTop(counts map[string]int) string {
+	var list []digestCount
+	for name, count := range counts {
+		list = append(list, digestCount{Name: name, Count: count})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Name < list[j].Name
+	})
+
+	var lines []string
+	for i, item := range list {
+		if i == digestListSize {
+			lines = append(lines, fmt.Sprintf("e mais %d", len(list)-digestListSize))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("`%s`: %d", item.Name, item.Count))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// digestActionsAttachment resume as ações executadas pelo BOT (comandos,
+// botões, menus e API) a partir do audit
+func digestActionsAttachment(since time.Time) slack.Attachment {
+	// O fim dos deploys (origem job) aparece na seção de deploys
+	var entries []AuditEntry
+	for _, entry := range QueryAudit(AuditFilter{Since: since}) {
+		if entry.Source != auditSourceJob {
+			entries = append(entries, entry)
+		}
+	}
+
+	attachment := slack.Attachment{Title: fmt.Sprintf(":robot_face: Ações pelo BOT (%d)", len(entries)), Color: "good"}
+
+	if len(entries) == 0 {
+		attachment.Text = "nenhuma ação executada"
+		return attachment
+	}
+
+	actions := map[string]int{}
+	users := map[string]int{}
+	failed := 0
+	for _, entry := range entries {
+		actions[entry.Action]++
+		users[entry.User]++
+		if entry.Status >= 400 {
+			failed++
+		}
+	}
+
+	attachment.Fields = []slack.AttachmentField{
+		{Title: "Ações", Value: digestTop(actions), Short: true},
+		{Title: "Usuários", Value: digestTop(users), Short: true},
+	}
+
+	if failed > 0 {
+		attachment.Color = "warning"
+		attachment.Footer = fmt.Sprintf("%d recusadas ou com erro", failed)
+	}
+
+	return attachment
+}
+
+// digestEventsAttachment lista os deploys ou alertas do período, os mais
+// recentes primeiro, com a contagem por origem
+func digestEventsAttachment(title string, empty string, events []digestEvent) slack.Attachment {
+	attachment := slack.Attachment{Title: fmt.Sprintf("%s (%d)", title, len(events)), Color: "#0C648A"}
+
+	if len(events) == 0 {
+		attachment.Text = empty
+		return attachment
+	}
+
+	sources := map[string]int{}
+	var lines []string
+	for i := len(events) - 1; i >= 0; i-- {
+		sources[events[i].Source]++
+		if len(lines) < digestListSize {
+			lines = append(lines, fmt.Sprintf("%s %s", localTime(events[i].At, "15:04"), events[i].Text))
+		}
+	}
+
+	if len(events) > digestListSize {
+		lines = append(lines, fmt.Sprintf("e mais %d", len(events)-digestListSize))
+	}
+
+	var bySource []string
+	for source, count := range sources {
+		bySource = append(bySource, fmt.Sprintf("%s: %d", source, count))
+	}
+	sort.Strings(bySource)
+
+	attachment.Text = strings.Join(lines, "\n")
+	attachment.Footer = strings.Join(bySource, " | ")
+
+	return attachment
+}
+
+// digestUnhealthyAttachment lista os recursos com problema no momento do
+// resumo, como no status
+func digestUnhealthyAttachment() slack.Attachment {
+	attachment := slack.Attachment{Title: ":hospital: Recursos com problema agora", Color: "good"}
+
+	alert := func(level string) {
+		if level == "danger" || attachment.Color == "good" {
+			attachment.Color = level
+		}
+	}
+
+	services, err := statusServices()
+	if err != nil {
+		CheckErr("Erro ao listar os serviços no resumo diário", err)
+		attachment.Fields = append(attachment.Fields, slack.AttachmentField{Title: "Serviços", Value: fmt.Sprintf(":x: %s", err)})
+		alert("danger")
+	} else {
+		var unhealthy []string
+		for _, service := range services {
+			if service.State == "degraded" || service.State == "error" {
+				unhealthy = append(unhealthy, service.Name)
+			}
+		}
+
+		if len(unhealthy) == 0 {
+			attachment.Fields = append(attachment.Fields, slack.AttachmentField{Title: "Serviços", Value: ":white_check_mark: nenhum com problema", Short: true})
+		} else {
+			alert("danger")
+			attachment.Fields = append(attachment.Fields, slack.AttachmentField{Title: fmt.Sprintf("Serviços com problema (%d)", len(unhealthy)), Value: statusList(unhealthy), Short: true})
+		}
+	}
+
+	if orchestrator.Name() == "rancher" {
+		attachment.Fields = append(attachment.Fields, statusContainers(alert), statusHosts(alert))
+	}
+
+	return attachment
+}
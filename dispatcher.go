@@ -0,0 +1,512 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	// SlackSigningSecret é o Signing Secret do app, usado para verificar a
+	// assinatura das interações. Sem ele é usado o Verification Token
+	SlackSigningSecret string
+
+	// InteractionPermissions é o mapeamento da ação (nome do botão ou
+	// callback_id do menu) para os usuários que podem usá-la, separados por |
+	// (ex.: host-evacuate:U123|fulano)
+	InteractionPermissions = map[string]string{}
+
+	// InteractionRateLimit é a quantidade máxima de interações por usuário a
+	// cada minuto, 0 desliga o limite
+	InteractionRateLimit = 30
+)
+
+// ActionHandler trata uma interação (botão ou opção de menu)
+type ActionHandler func(message slack.AttachmentActionCallback, w http.ResponseWriter)
+
+// interactionWriter leva o contexto da requisição do Slack até os handlers,
+// que recebem só o ResponseWriter
+type interactionWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+
+	// charge são os usos da interação nas cotas do time, devolvidos quando a
+	// ação falha
+	charge *QuotaCharge
+}
+
+// interactionContext retorna o contexto da requisição da interação, cancelado
+// quando o Slack desiste da resposta, ou o botContext fora das interações
+func interactionContext(w http.ResponseWriter) context.Context {
+	if iw, ok := w.(*interactionWriter); ok {
+		return iw.ctx
+	}
+
+	return botContext
+}
+
+// interactionRancher retorna o listener do Rancher com o contexto da
+// interação, para uma chamada pendurada não prender o handler. As chamadas
+// que continuam depois da resposta (jobs, goroutines) usam o rancherListener
+func interactionRancher(w http.ResponseWriter) *RancherListener {
+	return rancherListener.WithContext(interactionContext(w))
+}
+
+// Interaction é a interação recebida do Slack, passada pelos middlewares
+type Interaction struct {
+	Request *http.Request
+	Body    []byte
+	Payload string
+	Message slack.AttachmentActionCallback
+
+	// Tenant é o time dono do canal da interação, nil fora dos canais de times
+	Tenant *Tenant
+
+	// QuotaCharge são os usos contados nas cotas do time pelo QuotaMiddleware
+	QuotaCharge *QuotaCharge
+
+	// Refused é o status da recusa da interação por um middleware (ex.: 403
+	// sem permissão), já que a recusa responde 200 ao Slack com a mensagem
+	Refused int
+}
+
+// refuseInteraction recusa a interação com o status, respondendo a mensagem
+// original sem os botões e com o motivo
+func refuseInteraction(w http.ResponseWriter, in *Interaction, status int, title string) {
+	in.Refused = status
+	respondWithoutActions(w, in.Message.OriginalMessage, title, "")
+}
+
+// Key identifica a ação da interação: o callback_id para menus (select) e o
+// nome do botão nas demais
+func (in *Interaction) Key() string {
+	if in.Message.CallbackID != "" && (len(in.Message.Actions) == 0 || in.Message.Actions[0].Name == actionSelect) {
+		return in.Message.CallbackID
+	}
+
+	if len(in.Message.Actions) > 0 {
+		return in.Message.Actions[0].Name
+	}
+
+	return gjson.Get(in.Payload, "type").String()
+}
+
+// InteractionHandler trata uma interação já lida
+type InteractionHandler func(w http.ResponseWriter, in *Interaction)
+
+// Middleware envolve um InteractionHandler, podendo responder antes dele
+// (ex.: sem permissão) ou agir depois (ex.: métricas)
+type Middleware func(next InteractionHandler) InteractionHandler
+
+// Dispatcher recebe as interações do Slack, passa pelos middlewares e chama o
+// handler registrado para o callback_id (menus) ou nome da ação (botões)
+type Dispatcher struct {
+	selects     map[string]ActionHandler
+	actions     map[string]ActionHandler
+	middlewares []Middleware
+}
+
+// NewDispatcher cria um Dispatcher sem handlers e sem middlewares
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		selects: map[string]ActionHandler{},
+		actions: map[string]ActionHandler{},
+	}
+}
+
+// HandleSelect registra o handler das opções escolhidas no menu do callbackID
+func (d *Dispatcher) HandleSelect(callbackID string, handler ActionHandler) {
+	d.selects[callbackID] = handler
+}
+
+// HandleAction registra o handler dos botões com o nome name
+func (d *Dispatcher) HandleAction(name string, handler ActionHandler) {
+	d.actions[name] = handler
+}
+
+// Use adiciona middlewares, executados na ordem em que foram adicionados
+func (d *Dispatcher) Use(middlewares ...Middleware) {
+	d.middlewares = append(d.middlewares, middlewares...)
+}
+
+func (d *Dispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if ShuttingDown() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read request body: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	values, err := url.ParseQuery(string(buf))
+	if err != nil {
+		log.Printf("[ERROR] Failed to unespace request body: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	in := &Interaction{Request: r, Body: buf, Payload: values.Get("payload")}
+	if gjson.Get(in.Payload, "type").String() == "block_actions" {
+		in.Message = blockActionsCallback(in.Payload)
+	} else if err := json.Unmarshal([]byte(in.Payload), &in.Message); err != nil {
+		log.Printf("[ERROR] Failed to decode json message from slack: %s", in.Payload)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	handler := d.dispatch
+	for i := len(d.middlewares) - 1; i >= 0; i-- {
+		handler = d.middlewares[i](handler)
+	}
+
+	handler(w, in)
+}
+
+// dispatch chama o handler da interação
+func (d *Dispatcher) dispatch(w http.ResponseWriter, in *Interaction) {
+	w = &interactionWriter{ResponseWriter: w, ctx: in.Request.Context(), charge: in.QuotaCharge}
+
+	// O envio de dialogs não tem botões, é tratado pelo callback do dialog
+	if gjson.Get(in.Payload, "type").String() == "dialog_submission" {
+		handleDialogSubmission(in.Payload, w)
+		return
+	}
+
+	// Os plugins tratam as interações com o próprio callback_id
+	if handlePluginInteraction(in.Message, w) {
+		return
+	}
+
+	if len(in.Message.Actions) == 0 {
+		log.Printf("[ERROR] Interação sem ação: %s", in.Message.CallbackID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	action := in.Message.Actions[0]
+
+	handler, ok := d.actions[action.Name]
+	if action.Name == actionSelect {
+		handler, ok = d.selects[in.Message.CallbackID]
+	}
+
+	if !ok {
+		log.Printf("[ERROR] Ação inválida: %s", in.Key())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	handler(in.Message, w)
+}
+
+// blockActionsCallback converte as ações do Block Kit para o formato das
+// ações das mensagens, usado pelos middlewares e handlers: o action_id vira o
+// nome da ação e as opções escolhidas (da ação ou, nos botões, de todos os
+// selects da mensagem) vão para o SelectedOptions
+func blockActionsCallback(payload string) slack.AttachmentActionCallback {
+	p := gjson.Parse(payload)
+	action := p.Get("actions.0")
+
+	callback := slack.AttachmentActionCallback{
+		Token:       p.Get("token").String(),
+		ResponseURL: p.Get("response_url").String(),
+		TriggerID:   p.Get("trigger_id").String(),
+		MessageTs:   p.Get("container.message_ts").String(),
+		ActionTs:    action.Get("action_ts").String(),
+	}
+	callback.User.ID = p.Get("user.id").String()
+	callback.User.Name = p.Get("user.username").String()
+	callback.Channel.ID = p.Get("channel.id").String()
+
+	selected := action.Get("selected_options.#.value").Array()
+	if option := action.Get("selected_option.value"); option.Exists() {
+		// static_select tem uma única opção escolhida
+		selected = append(selected, option)
+	}
+	if len(selected) == 0 {
+		p.Get("state.values").ForEach(func(_, block gjson.Result) bool {
+			block.ForEach(func(_, element gjson.Result) bool {
+				selected = append(selected, element.Get("selected_options.#.value").Array()...)
+				return true
+			})
+			return true
+		})
+	}
+
+	var options []slack.AttachmentActionOption
+	for _, value := range selected {
+		options = append(options, slack.AttachmentActionOption{Value: value.String()})
+	}
+
+	callback.Actions = []slack.AttachmentAction{{
+		Name:            action.Get("action_id").String(),
+		Value:           action.Get("value").String(),
+		SelectedOptions: options,
+	}}
+
+	return callback
+}
+
+// statusRecorder guarda o status da resposta para os middlewares
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// RecoverMiddleware responde 500 em vez de derrubar a requisição caso o
+// handler entre em panic
+func RecoverMiddleware(next InteractionHandler) InteractionHandler {
+	return func(w http.ResponseWriter, in *Interaction) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[ERROR] Panic na interação %s: %v\n%s", in.Key(), r, debug.Stack())
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+
+		next(w, in)
+	}
+}
+
+// VerifyMiddleware aceita apenas interações vindas do Slack, verificando a
+// assinatura (X-Slack-Signature) com o SlackSigningSecret ou, sem ele, o
+// Verification Token
+func VerifyMiddleware(verificationToken string) Middleware {
+	return func(next InteractionHandler) InteractionHandler {
+		return func(w http.ResponseWriter, in *Interaction) {
+			// O replay do sandbox já foi verificado quando foi gravado
+			if sandboxReplay(in.Request) {
+				next(w, in)
+				return
+			}
+
+			if SlackSigningSecret == "" {
+				if in.Message.Token != verificationToken {
+					log.Printf("[ERROR] Invalid token: %s", in.Message.Token)
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				next(w, in)
+				return
+			}
+
+			if !validSlackSignature(in.Request, in.Body) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next(w, in)
+		}
+	}
+}
+
+// validSlackSignature verifica a assinatura (X-Slack-Signature) de uma
+// requisição do Slack com o SlackSigningSecret
+func validSlackSignature(r *http.Request, body []byte) bool {
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+
+	// Assinaturas com mais de 5 minutos podem ser um replay
+	if err != nil || time.Since(time.Unix(sent, 0)) > 5*time.Minute || time.Until(time.Unix(sent, 0)) > 5*time.Minute {
+		log.Printf("[ERROR] Timestamp inválido na requisição do Slack: %s", timestamp)
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(SlackSigningSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature"))) {
+		log.Println("[ERROR] Assinatura inválida na requisição do Slack")
+		return false
+	}
+
+	return true
+}
+
+// RBACMiddleware bloqueia as ações do InteractionPermissions para os usuários
+// que não estão na lista da ação
+func RBACMiddleware(next InteractionHandler) InteractionHandler {
+	return func(w http.ResponseWriter, in *Interaction) {
+		allowed, ok := InteractionPermissions[in.Key()]
+		if !ok {
+			next(w, in)
+			return
+		}
+
+		if userAllowed(strings.Split(allowed, "|"), in.Message.User.ID, in.Message.User.Name) {
+			next(w, in)
+			return
+		}
+
+		log.Printf("[INFO] Usuário %s sem permissão para a ação %s\n", in.Message.User.Name, in.Key())
+		refuseInteraction(w, in, http.StatusForbidden, fmt.Sprintf(":no_entry: @%s não tem permissão para `%s`", in.Message.User.Name, in.Key()))
+	}
+}
+
+var (
+	rateLimits      = map[string][]time.Time{}
+	rateLimitsMutex sync.Mutex
+)
+
+// RateLimitMiddleware limita a quantidade de interações de cada usuário por
+// minuto (InteractionRateLimit)
+func RateLimitMiddleware(next InteractionHandler) InteractionHandler {
+	return func(w http.ResponseWriter, in *Interaction) {
+		if InteractionRateLimit <= 0 {
+			next(w, in)
+			return
+		}
+
+		user := in.Message.User.ID
+		now := time.Now()
+
+		rateLimitsMutex.Lock()
+		var recent []time.Time
+		for _, t := range rateLimits[user] {
+			if now.Sub(t) < time.Minute {
+				recent = append(recent, t)
+			}
+		}
+
+		limited := len(recent) >= InteractionRateLimit
+		if !limited {
+			recent = append(recent, now)
+		}
+		rateLimits[user] = recent
+		rateLimitsMutex.Unlock()
+
+		if limited {
+			log.Printf("[INFO] Usuário %s passou do limite de %d interações por minuto\n", in.Message.User.Name, InteractionRateLimit)
+			w.Header().Set("Retry-After", "60")
+			refuseInteraction(w, in, http.StatusTooManyRequests, fmt.Sprintf(":snail: @%s, muitas ações seguidas, aguarde um minuto", in.Message.User.Name))
+			return
+		}
+
+		next(w, in)
+	}
+}
+
+// AuditMiddleware registra no audit quem executou cada ação, com o valor
+// escolhido e o status da resposta ou da recusa (Refused)
+func AuditMiddleware(next InteractionHandler) InteractionHandler {
+	return func(w http.ResponseWriter, in *Interaction) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next(recorder, in)
+
+		var value string
+		if len(in.Message.Actions) > 0 {
+			value = in.Message.Actions[0].Value
+			if len(in.Message.Actions[0].SelectedOptions) > 0 {
+				value = in.Message.Actions[0].SelectedOptions[0].Value
+			}
+		}
+
+		status := recorder.status
+		if in.Refused != 0 {
+			status = in.Refused
+		}
+
+		RecordAudit(AuditEntry{
+			Source:  auditSourceSlack,
+			User:    in.Message.User.Name,
+			Action:  in.Key(),
+			Value:   value,
+			Channel: in.Message.Channel.ID,
+			Status:  status,
+		})
+	}
+}
+
+// InteractionMetric são os números de uma ação desde que o BOT foi iniciado
+type InteractionMetric struct {
+	Action    string        `json:"action"`
+	Count     int           `json:"count"`
+	Errors    int           `json:"errors"`
+	TotalTime time.Duration `json:"total_time_ns"`
+	MaxTime   time.Duration `json:"max_time_ns"`
+}
+
+var (
+	interactionMetrics      = map[string]*InteractionMetric{}
+	interactionMetricsMutex sync.Mutex
+)
+
+// MetricsMiddleware conta as interações, os erros e o tempo de resposta de
+// cada ação
+func MetricsMiddleware(next InteractionHandler) InteractionHandler {
+	return func(w http.ResponseWriter, in *Interaction) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next(recorder, in)
+
+		elapsed := time.Since(start)
+
+		interactionMetricsMutex.Lock()
+		defer interactionMetricsMutex.Unlock()
+
+		metric, ok := interactionMetrics[in.Key()]
+		if !ok {
+			metric = &InteractionMetric{Action: in.Key()}
+			interactionMetrics[in.Key()] = metric
+		}
+
+		metric.Count++
+		metric.TotalTime += elapsed
+		if elapsed > metric.MaxTime {
+			metric.MaxTime = elapsed
+		}
+		if recorder.status >= 400 {
+			metric.Errors++
+		}
+	}
+}
+
+// GetInteractionMetrics é a rota que retorna as métricas de cada ação
+func GetInteractionMetrics(w http.ResponseWriter, r *http.Request) {
+	interactionMetricsMutex.Lock()
+	metrics := []InteractionMetric{}
+	for _, metric := range interactionMetrics {
+		metrics = append(metrics, *metric)
+	}
+	interactionMetricsMutex.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Action < metrics[j].Action
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics)
+}
@@ -0,0 +1,293 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// restartContainerDrain é o menu do restart com drain (restart-container --drain)
+const restartContainerDrain = "restart-container-drain"
+
+// drainPollInterval é o intervalo entre as verificações das sessões abertas
+const drainPollInterval = 2 * time.Second
+
+// DrainGracePeriod é o tempo máximo esperando as sessões do container nos
+// LBs terminarem antes do restart
+var DrainGracePeriod = 30 * time.Second
+
+// drainTarget é um server de um backend do HAProxy, em um container do LB,
+// que aponta para o container reiniciado
+type drainTarget struct {
+	LB      string
+	IP      string
+	Backend string
+	Server  string
+}
+
+// haproxyServerAction muda o estado do server pela página de estatísticas
+// do HAProxy (drain, ready...), que precisa do "stats admin"
+func haproxyServerAction(client *http.Client, target drainTarget, action string) error {
+	form := neturl.Values{"s": {target.Server}, "b": {target.Backend}, "action": {action}}
+
+	resp, err := client.PostForm(fmt.Sprintf("http://%s:%s%s", target.IP, HaproxyStatsPort, HaproxyStatsPath), form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// O HAProxy responde com um redirect para a página com o resultado (st=)
+	location := resp.Header.Get("Location")
+	if resp.StatusCode >= http.StatusBadRequest || (location != "" && !strings.Contains(location, "st=DONE")) {
+		return fmt.Errorf("o HAProxy recusou o %s do server %s/%s (%d %s), verifique o \"stats admin\"", action, target.Backend, target.Server, resp.StatusCode, location)
+	}
+
+	return nil
+}
+
+// findDrainTargets procura nas estatísticas de todos os LBs os servers que
+// apontam para o IP do container
+func findDrainTargets(client *http.Client, ip string) []drainTarget {
+	var targets []drainTarget
+
+	for _, lb := range rancherListener.GetLoadBalancers() {
+		instances, err := rancherListener.ListServiceInstances(lb.ID)
+		if err != nil {
+			CheckErr("Erro ao buscar os containers do LB "+lb.ID, err)
+			continue
+		}
+
+		for _, instance := range instances {
+			if instance.State != "running" || instance.PrimaryIPAddress == "" {
+				continue
+			}
+
+			stats, err := fetchHaproxyStats(client, instance.PrimaryIPAddress)
+			if err != nil {
+				CheckErr(fmt.Sprintf("Erro ao buscar as estatísticas do HAProxy no container %s", instance.Name), err)
+				continue
+			}
+
+			for _, stat := range stats {
+				if stat.Server != "FRONTEND" && stat.Server != "BACKEND" && strings.HasPrefix(stat.Address, ip+":") {
+					targets = append(targets, drainTarget{LB: lb.ID, IP: instance.PrimaryIPAddress, Backend: stat.Proxy, Server: stat.Server})
+				}
+			}
+		}
+	}
+
+	return targets
+}
+
+// drainSessions soma as sessões abertas nos servers do container
+func drainSessions(client *http.Client, targets []drainTarget) int {
+	sessions := 0
+	stats := map[string][]HaproxyStat{}
+
+	for _, target := range targets {
+		if _, ok := stats[target.IP]; !ok {
+			stats[target.IP], _ = fetchHaproxyStats(client, target.IP)
+		}
+
+		for _, stat := range stats[target.IP] {
+			if stat.Proxy == target.Backend && stat.Server == target.Server {
+				sessions += stat.Sessions
+			}
+		}
+	}
+
+	return sessions
+}
+
+// waitContainerRunning espera o container voltar rodando e saudável, até o
+// ctx ser cancelado ou passar o UpgradeProgressTimeout
+func waitContainerRunning(ctx context.Context, containerID string) error {
+	deadline := time.Now().Add(UpgradeProgressTimeout)
+
+	for {
+		containers, err := rancherListener.FetchContainers()
+		if err != nil {
+			return fmt.Errorf("erro ao buscar o container %s: %s", containerID, err)
+		}
+
+		for _, container := range containers {
+			if container.ID == containerID && container.State == "running" && (container.HealthState == "" || container.HealthState == "healthy") {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("o container %s não voltou saudável em %s", containerID, UpgradeProgressTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("cancelado esperando o container %s voltar", containerID)
+		case <-time.After(upgradePollInterval):
+		}
+	}
+}
+
+// DrainRestartContainer tira o container dos backends dos LBs (drain), espera
+// as sessões abertas terminarem até o grace, reinicia o container e, depois
+// dele voltar saudável, coloca ele de volta nos backends. O container que não
+// está em nenhum LB é reiniciado direto
+func DrainRestartContainer(ctx context.Context, containerID string, grace time.Duration, progress *Progress) error {
+	containers, err := rancherListener.FetchContainers()
+	if err != nil {
+		return fmt.Errorf("erro ao buscar o container %s: %s", containerID, err)
+	}
+
+	var container *Container
+	for i := range containers {
+		if containers[i].ID == containerID {
+			container = &containers[i]
+		}
+	}
+	if container == nil {
+		return fmt.Errorf("container %s não encontrado", containerID)
+	}
+
+	client := &http.Client{
+		Timeout: HaproxyStatsTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	progress.Update(0, 0, "procurando o container nos LBs")
+
+	var targets []drainTarget
+	if container.PrimaryIPAddress != "" {
+		targets = findDrainTargets(client, container.PrimaryIPAddress)
+	}
+
+	if len(targets) == 0 {
+		log.Printf("[INFO] Container %s não está em nenhum LB, reiniciando sem drain\n", containerID)
+		if err := rancherListener.RestartContainer(containerID); err != nil {
+			return fmt.Errorf("erro ao reiniciar o container %s: %s", containerID, err)
+		}
+		return nil
+	}
+
+	// O container volta para os backends mesmo quando o restart falha
+	var drained []drainTarget
+	defer func() {
+		for _, target := range drained {
+			if err := haproxyServerAction(client, target, "ready"); err != nil {
+				CheckErr(fmt.Sprintf("Erro ao colocar o server %s/%s de volta no LB %s", target.Backend, target.Server, target.LB), err)
+				sendMessage(fmt.Sprintf(":warning: O server `%s/%s` do container `%s` ficou em drain no LB `%s`: %s", target.Backend, target.Server, containerID, target.LB, err))
+			}
+		}
+	}()
+
+	for _, target := range targets {
+		if err := haproxyServerAction(client, target, "drain"); err != nil {
+			return err
+		}
+		drained = append(drained, target)
+	}
+
+	deadline := time.Now().Add(grace)
+	for {
+		sessions := drainSessions(client, targets)
+		if sessions == 0 || time.Now().After(deadline) {
+			log.Printf("[INFO] Drain do container %s terminado com %d sessões abertas\n", containerID, sessions)
+			break
+		}
+
+		progress.Update(0, 0, fmt.Sprintf("drain em %d backends, %d sessões abertas", len(targets), sessions))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("cancelado durante o drain, o container %s não foi reiniciado", containerID)
+		case <-time.After(drainPollInterval):
+		}
+	}
+
+	progress.Update(0, 0, "reiniciando o container")
+	if err := rancherListener.RestartContainer(containerID); err != nil {
+		return fmt.Errorf("erro ao reiniciar o container %s: %s", containerID, err)
+	}
+
+	progress.Update(0, 0, "esperando o container voltar saudável")
+	return waitContainerRunning(ctx, containerID)
+}
+
+// drainGrace lê o grace do drain=90s, o DrainGracePeriod quando não informado
+func drainGrace(value string) (time.Duration, error) {
+	if value == "" || value == "true" {
+		return DrainGracePeriod, nil
+	}
+
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace < 0 {
+		return 0, fmt.Errorf("`%s` não é uma duração válida, ex.: drain=90s", value)
+	}
+
+	return grace, nil
+}
+
+// withDrainGrace adiciona o grace no valor de cada opção do menu, como nos
+// logs. Nos menus com as opções buscadas pelo Slack vale o DrainGracePeriod
+func withDrainGrace(options []slack.AttachmentActionOption, grace time.Duration) []slack.AttachmentActionOption {
+	for i := range options {
+		options[i].Value = fmt.Sprintf("%s?drain=%s", options[i].Value, grace)
+	}
+
+	return options
+}
+
+// enqueueDrainRestart coloca o restart com drain na fila, com o progresso
+// no canal
+func enqueueDrainRestart(channel string, ts string, containerID string, grace time.Duration, user string) (*Job, error) {
+	return EnqueueJobContext("restart com drain do container "+containerID, user, func(ctx context.Context) error {
+		title := fmt.Sprintf("*Restart com drain* do container `%s` (grace de %s), por @%s", containerID, formatDuration(grace), user)
+
+		var progress *Progress
+		if ts != "" {
+			progress = ResumeProgress(channel, ts, title, JobFromContext(ctx))
+		} else {
+			progress = StartProgress(channel, title, JobFromContext(ctx))
+		}
+
+		if err := DrainRestartContainer(ctx, containerID, grace, progress); err != nil {
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		log.Printf("[INFO] Container %s reiniciado com drain pelo usuário %s\n", containerID, user)
+		progress.Finish(true, "Container reiniciado e de volta nos LBs")
+
+		return nil
+	})
+}
+
+func actionDrainRestartContainerFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	value := message.Actions[0].SelectedOptions[0].Value
+
+	containerID, grace := value, DrainGracePeriod
+	if parts := strings.SplitN(value, "?drain=", 2); len(parts) == 2 {
+		containerID = parts[0]
+		if parsed, err := drainGrace(parts[1]); err == nil {
+			grace = parsed
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	job, err := enqueueDrainRestart(message.Channel.ID, message.MessageTs, containerID, grace, message.User.Name)
+	interactionJob(w, job, err)
+	if err != nil {
+		sendMessage(queuedJobMessage(job, err))
+	}
+}
@@ -0,0 +1,365 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	flagDryRun = "--dry-run"
+	flagApply  = "--apply"
+
+	// dryRunMaxPayload é o tamanho máximo do payload mostrado no dry-run
+	dryRunMaxPayload = 1500
+)
+
+// DryRunEnvironments são os ambientes em que os comandos que alteram algo
+// rodam em dry-run por padrão, sendo executados apenas com o --apply
+var DryRunEnvironments []string
+
+// dryRunCommands são os comandos que suportam o dry-run
+var dryRunCommands = []string{upgradeService, scaleService, restartService, canaryActivate, canaryDisable, canaryUpdate, rollingRestart}
+
+// dryRunUnsupported são os comandos que alteram algo mas não suportam o
+// dry-run, recusados quando ele está ativo
+var dryRunUnsupported = []string{restartContainer, batch}
+
+// dryRunAliases ligam os campos dos payloads das actions aos campos do
+// recurso atual, para comparar (ex.: o launchConfig do upgrade)
+var dryRunAliases = map[string]string{
+	"inServiceStrategy.launchConfig.": "launchConfig.",
+}
+
+// DryRunCall é uma chamada que seria feita, com o payload e a diferença
+// para o estado atual
+type DryRunCall struct {
+	Method  string `json:"method"`
+	Target  string `json:"target"`
+	Payload string `json:"payload,omitempty"`
+	Diff    string `json:"diff,omitempty"`
+}
+
+// DryRun guarda as chamadas que seriam feitas por um comando em dry-run
+type DryRun struct {
+	mutex sync.Mutex
+	calls []DryRunCall
+}
+
+func (d *DryRun) record(call DryRunCall) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.calls = append(d.calls, call)
+}
+
+// Message descreve as chamadas que o comando faria
+func (d *DryRun) Message(command string) string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	msg := fmt.Sprintf(":mag: *Dry-run* do `%s`, nada foi executado.", command)
+	if len(d.calls) == 0 {
+		return msg + " Nenhuma alteração seria feita."
+	}
+
+	msg += " Chamadas que seriam feitas:"
+	for i, call := range d.calls {
+		msg += fmt.Sprintf("\n*%d.* `%s %s`", i+1, call.Method, call.Target)
+
+		switch {
+		case call.Diff != "":
+			msg += fmt.Sprintf("\n```%s```", call.Diff)
+		case call.Payload != "":
+			msg += fmt.Sprintf("\n```%s```", truncateText(call.Payload, dryRunMaxPayload))
+		}
+	}
+
+	return msg
+}
+
+// truncateText corta o texto no tamanho máximo, avisando o corte
+func truncateText(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+
+	return text[:max] + "\n... (cortado)"
+}
+
+// recordRancher registra a requisição ao Rancher no lugar de enviá-la,
+// comparando o payload com o recurso atual. O recurso atual é retornado
+// como resposta, para o comando seguir como se a chamada tivesse sido feita
+func (d *DryRun) recordRancher(r *RancherListener, url string, method string, data string) string {
+	resourceURL := strings.SplitN(url, "?", 2)[0]
+	current := r.HTTPSendRancherRequest(resourceURL, GetHTTP, "")
+
+	d.record(DryRunCall{
+		Method:  method,
+		Target:  strings.TrimPrefix(url, r.baseURL),
+		Payload: data,
+		Diff:    jsonDiff(current, data),
+	})
+
+	return current
+}
+
+// flattenJSON transforma o JSON em caminho -> valor, os arrays são
+// comparados inteiros
+func flattenJSON(prefix string, value gjson.Result, out map[string]gjson.Result) {
+	if !value.IsObject() {
+		if prefix != "" {
+			out[prefix] = value
+		}
+		return
+	}
+
+	value.ForEach(func(key, item gjson.Result) bool {
+		path := key.String()
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+
+		flattenJSON(path, item, out)
+		return true
+	})
+}
+
+// jsonDiff lista os campos do payload que mudam em relação ao recurso atual
+func jsonDiff(current string, payload string) string {
+	if current == "" || !gjson.Valid(payload) {
+		return ""
+	}
+
+	before, after := map[string]gjson.Result{}, map[string]gjson.Result{}
+	flattenJSON("", gjson.Parse(current), before)
+	flattenJSON("", gjson.Parse(payload), after)
+
+	var paths []string
+	for path := range after {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var lines []string
+	for _, path := range paths {
+		currentPath := path
+		for prefix, alias := range dryRunAliases {
+			if strings.HasPrefix(path, prefix) {
+				currentPath = alias + strings.TrimPrefix(path, prefix)
+			}
+		}
+
+		old, exists := before[currentPath]
+		value := after[path]
+		if exists && old.Raw == value.Raw {
+			continue
+		}
+
+		if strings.Contains(old.String(), "\n") || strings.Contains(value.String(), "\n") {
+			lines = append(lines, fmt.Sprintf("%s:\n%s", path, lineDiff(old.String(), value.String())))
+			continue
+		}
+
+		oldRaw := old.Raw
+		if !exists {
+			oldRaw = "(vazio)"
+		}
+
+		lines = append(lines, fmt.Sprintf("%s: %s -> %s", path, oldRaw, value.Raw))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// lineDiff compara dois textos linha a linha (maior subsequência comum),
+// retornando apenas as linhas removidas (-) e adicionadas (+)
+func lineDiff(before string, after string) string {
+	a, b := strings.Split(before, "\n"), strings.Split(after, "\n")
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, "+ "+b[j])
+			j++
+		default:
+			lines = append(lines, "- "+a[i])
+			i++
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// WithDryRun retorna uma cópia do listener que registra as requisições que
+// alteram algo no dry, sem enviá-las
+func (ranchListener *RancherListener) WithDryRun(dry *DryRun) *RancherListener {
+	listener := *ranchListener
+	listener.dryRun = dry
+
+	return &listener
+}
+
+// dryRunOrchestrator é o orquestrador usado em dry-run: as leituras vão
+// para o orquestrador real e as alterações são registradas. No Rancher as
+// alterações passam pelo listener em dry-run, mostrando as requisições
+type dryRunOrchestrator struct {
+	Orchestrator
+	dry      *DryRun
+	listener *RancherListener
+}
+
+func (d dryRunOrchestrator) RestartService(ID string) error {
+	if d.Name() == "rancher" {
+		return d.listener.RestartService(ID)
+	}
+
+	d.dry.record(DryRunCall{Method: d.Name(), Target: "restart " + ID})
+	return nil
+}
+
+func (d dryRunOrchestrator) ScaleService(ID string, replicas int) error {
+	if d.Name() == "rancher" {
+		d.listener.ScaleService(ID, replicas)
+		return nil
+	}
+
+	call := DryRunCall{Method: d.Name(), Target: fmt.Sprintf("scale %s", ID)}
+	if service, err := d.GetService(ID); err == nil {
+		call.Diff = fmt.Sprintf("replicas: %d -> %d", service.Replicas, replicas)
+	}
+
+	d.dry.record(call)
+	return nil
+}
+
+// parseDryRun tira as flags --dry-run e --apply do texto, retornando se o
+// comando deve rodar em dry-run: com o --dry-run ou, sem o --apply, nos
+// ambientes do DryRunEnvironments
+func parseDryRun(text string) (string, bool, bool) {
+	var words []string
+	dryRun, apply := false, false
+
+	for _, word := range strings.Split(text, " ") {
+		// O Slack pode trocar o "--" por um travessão
+		switch strings.Replace(word, "—", "--", 1) {
+		case flagDryRun:
+			dryRun = true
+		case flagApply:
+			apply = true
+		default:
+			words = append(words, word)
+		}
+	}
+
+	byDefault := !dryRun && !apply && dryRunByDefault()
+
+	return strings.Join(words, " "), dryRun || byDefault, byDefault
+}
+
+// dryRunByDefault informa se o ambiente atual está no DryRunEnvironments
+func dryRunByDefault() bool {
+	for _, env := range DryRunEnvironments {
+		if strings.TrimSpace(env) == orchestratorEnvironment {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withDryRun prepara o comando para rodar em dry-run, retornando false
+// quando o comando altera algo e não suporta o dry-run (e não deve rodar)
+func (s *SlackListener) withDryRun(ev *slack.MessageEvent, command string, byDefault bool) (*SlackListener, bool) {
+	for _, cmd := range dryRunUnsupported {
+		if strings.HasPrefix(command, cmd) {
+			msg := fmt.Sprintf(":no_entry: O `%s` não suporta o %s", cmd, flagDryRun)
+			if byDefault {
+				msg = fmt.Sprintf(":no_entry: O ambiente `%s` roda em dry-run por padrão e o `%s` não suporta o dry-run. Use o %s para executar", orchestratorEnvironment, cmd, flagApply)
+			}
+
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(msg, false))
+			return nil, false
+		}
+	}
+
+	listener := *s
+	for _, cmd := range dryRunCommands {
+		if strings.HasPrefix(command, cmd) {
+			listener.dryRun = &DryRun{}
+		}
+	}
+
+	return &listener, true
+}
+
+// rancher é o listener do Rancher usado pelos comandos, em dry-run quando
+// o comando foi chamado com o --dry-run
+func (s *SlackListener) rancher() *RancherListener {
+	if s.dryRun != nil {
+		return rancherListener.WithDryRun(s.dryRun)
+	}
+
+	return rancherListener
+}
+
+// orchestrator é o orquestrador usado pelos comandos, em dry-run quando o
+// comando foi chamado com o --dry-run
+func (s *SlackListener) orchestrator() Orchestrator {
+	if s.dryRun != nil {
+		return dryRunOrchestrator{Orchestrator: orchestrator, dry: s.dryRun, listener: s.rancher()}
+	}
+
+	return orchestrator
+}
+
+// finishDryRun envia as chamadas que o comando faria, retornando true
+// quando o comando está em dry-run (e deve parar antes de avisar o sucesso)
+func (s *SlackListener) finishDryRun(ev *slack.MessageEvent, command string) bool {
+	if s.dryRun == nil {
+		return false
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(s.dryRun.Message(command), false))
+	return true
+}
+
+// requireDryRunArgs avisa que o menu não roda em dry-run, retornando true
+// quando o comando deve parar
+func (s *SlackListener) requireDryRunArgs(ev *slack.MessageEvent, command string) bool {
+	if s.dryRun == nil {
+		return false
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Em dry-run informe o alvo no comando, ex.: @nome-do-bot %s id %s", command, flagDryRun), false))
+	return true
+}
@@ -0,0 +1,281 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+var (
+	// ECSCluster é o nome (ou ARN) do cluster do ECS
+	ECSCluster = "default"
+
+	// ECSRegion é a região do cluster
+	ECSRegion = "us-east-1"
+
+	// ECSAccessKey é a access key usada no ECS e no CloudWatch Logs. Sem ela é
+	// usada a cadeia padrão de credenciais da AWS (variáveis, IAM role, etc.)
+	ECSAccessKey string
+
+	// ECSSecretKey é a secret key usada no ECS e no CloudWatch Logs
+	ECSSecretKey string
+)
+
+// ecsOrchestrator é a implementação do Orchestrator para o AWS ECS. Os IDs são
+// os nomes (ou ARNs) dos serviços do cluster e os logs vêm do CloudWatch Logs
+type ecsOrchestrator struct {
+	ecs  *ecs.ECS
+	logs *cloudwatchlogs.CloudWatchLogs
+}
+
+func newECSOrchestrator() (*ecsOrchestrator, error) {
+	config := &aws.Config{
+		Region: aws.String(ECSRegion),
+	}
+
+	if ECSAccessKey != "" {
+		config.Credentials = credentials.NewStaticCredentials(ECSAccessKey, ECSSecretKey, "")
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ecsOrchestrator{ecs: ecs.New(sess), logs: cloudwatchlogs.New(sess)}, nil
+}
+
+func (e *ecsOrchestrator) Name() string {
+	return "ecs"
+}
+
+// describeServices busca os serviços, no máximo 10 por chamada (limite da API)
+func (e *ecsOrchestrator) describeServices(IDs []*string) ([]*ecs.Service, error) {
+	var services []*ecs.Service
+
+	for start := 0; start < len(IDs); start += 10 {
+		end := start + 10
+		if end > len(IDs) {
+			end = len(IDs)
+		}
+
+		resp, err := e.ecs.DescribeServices(&ecs.DescribeServicesInput{
+			Cluster:  aws.String(ECSCluster),
+			Services: IDs[start:end],
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		services = append(services, resp.Services...)
+	}
+
+	return services, nil
+}
+
+// taskDefinition retorna o primeiro container da task definition do serviço
+func (e *ecsOrchestrator) taskDefinition(service *ecs.Service) (*ecs.ContainerDefinition, error) {
+	resp, err := e.ecs.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: service.TaskDefinition,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.TaskDefinition == nil || len(resp.TaskDefinition.ContainerDefinitions) == 0 {
+		return nil, fmt.Errorf("task definition %s sem containers", aws.StringValue(service.TaskDefinition))
+	}
+
+	return resp.TaskDefinition.ContainerDefinitions[0], nil
+}
+
+func ecsWorkload(service *ecs.Service) Workload {
+	w := Workload{
+		ID:       aws.StringValue(service.ServiceName),
+		Name:     aws.StringValue(service.ServiceName),
+		Image:    path.Base(aws.StringValue(service.TaskDefinition)),
+		State:    strings.ToLower(aws.StringValue(service.Status)),
+		Replicas: int(aws.Int64Value(service.DesiredCount)),
+		Ready:    int(aws.Int64Value(service.RunningCount)),
+	}
+
+	if service.CreatedAt != nil {
+		w.Created = service.CreatedAt.Format(time.RFC3339)
+	}
+
+	// Com mais de um deployment o serviço ainda está sendo atualizado
+	if len(service.Deployments) > 1 {
+		w.State = "updating"
+	}
+
+	return w
+}
+
+func (e *ecsOrchestrator) ListServices() ([]Workload, error) {
+	var arns []*string
+
+	err := e.ecs.ListServicesPages(&ecs.ListServicesInput{Cluster: aws.String(ECSCluster)}, func(page *ecs.ListServicesOutput, last bool) bool {
+		arns = append(arns, page.ServiceArns...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := e.describeServices(arns)
+	if err != nil {
+		return nil, err
+	}
+
+	var workloads []Workload
+	for _, service := range services {
+		workloads = append(workloads, ecsWorkload(service))
+	}
+
+	return workloads, nil
+}
+
+// service busca um serviço do cluster pelo nome ou ARN
+func (e *ecsOrchestrator) service(ID string) (*ecs.Service, error) {
+	services, err := e.describeServices([]*string{aws.String(ID)})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(services) == 0 {
+		return nil, fmt.Errorf("serviço %s não encontrado no cluster %s", ID, ECSCluster)
+	}
+
+	return services[0], nil
+}
+
+func (e *ecsOrchestrator) GetService(ID string) (*Workload, error) {
+	service, err := e.service(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	w := ecsWorkload(service)
+
+	if container, err := e.taskDefinition(service); err == nil {
+		w.Image = aws.StringValue(container.Image)
+	}
+
+	return &w, nil
+}
+
+// RestartService faz o mesmo que o "aws ecs update-service --force-new-deployment"
+func (e *ecsOrchestrator) RestartService(ID string) error {
+	_, err := e.ecs.UpdateService(&ecs.UpdateServiceInput{
+		Cluster:            aws.String(ECSCluster),
+		Service:            aws.String(ID),
+		ForceNewDeployment: aws.Bool(true),
+	})
+
+	return err
+}
+
+func (e *ecsOrchestrator) ScaleService(ID string, replicas int) error {
+	_, err := e.ecs.UpdateService(&ecs.UpdateServiceInput{
+		Cluster:      aws.String(ECSCluster),
+		Service:      aws.String(ID),
+		DesiredCount: aws.Int64(int64(replicas)),
+	})
+
+	return err
+}
+
+// ServiceLogs busca no CloudWatch Logs os logs das tasks em execução do
+// serviço. O container precisa usar o driver awslogs com awslogs-stream-prefix
+func (e *ecsOrchestrator) ServiceLogs(ID string, opts LogsOptions) ([]byte, int, error) {
+	service, err := e.service(ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	container, err := e.taskDefinition(service)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	logConfig := container.LogConfiguration
+	if logConfig == nil || aws.StringValue(logConfig.LogDriver) != "awslogs" {
+		return nil, 0, fmt.Errorf("o container %s não usa o driver awslogs", aws.StringValue(container.Name))
+	}
+
+	group := aws.StringValue(logConfig.Options["awslogs-group"])
+	prefix := aws.StringValue(logConfig.Options["awslogs-stream-prefix"])
+	if group == "" || prefix == "" {
+		return nil, 0, fmt.Errorf("o container %s não tem awslogs-group e awslogs-stream-prefix configurados", aws.StringValue(container.Name))
+	}
+
+	tasks, err := e.ecs.ListTasks(&ecs.ListTasksInput{
+		Cluster:       aws.String(ECSCluster),
+		ServiceName:   service.ServiceName,
+		DesiredStatus: aws.String("RUNNING"),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(tasks.TaskArns) == 0 {
+		return nil, 0, fmt.Errorf("nenhuma task em execução para o serviço %s", ID)
+	}
+
+	input := cloudwatchlogs.GetLogEventsInput{
+		LogGroupName: aws.String(group),
+		Limit:        aws.Int64(int64(opts.RancherLines())),
+	}
+	if opts.Since > 0 {
+		input.StartTime = aws.Int64(time.Now().Add(-opts.Since).UnixNano() / int64(time.Millisecond))
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var merged []serviceLogLine
+
+	for _, arn := range tasks.TaskArns {
+		wg.Add(1)
+
+		go func(taskID string) {
+			defer wg.Done()
+
+			// O stream do awslogs é prefixo/nome-do-container/id-da-task
+			taskInput := input
+			taskInput.LogStreamName = aws.String(prefix + "/" + aws.StringValue(container.Name) + "/" + taskID)
+
+			resp, err := e.logs.GetLogEvents(&taskInput)
+			if err != nil {
+				CheckErr(fmt.Sprintf("Erro ao buscar os logs da task %s", taskID), err)
+				return
+			}
+
+			var content strings.Builder
+			for _, event := range resp.Events {
+				timestamp := time.Unix(0, aws.Int64Value(event.Timestamp)*int64(time.Millisecond)).UTC()
+				content.WriteString(timestamp.Format(time.RFC3339Nano) + " " + strings.TrimRight(aws.StringValue(event.Message), "\n") + "\n")
+			}
+
+			lines := prefixInstanceLogs(filterLogsContent(content.String(), opts), taskID)
+
+			mutex.Lock()
+			merged = append(merged, lines...)
+			mutex.Unlock()
+		}(path.Base(aws.StringValue(arn)))
+	}
+
+	wg.Wait()
+
+	return mergeServiceLogs(merged), len(tasks.TaskArns), nil
+}
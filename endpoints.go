@@ -4,8 +4,11 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"log"
 	"net/http"
+	"strings"
 )
 
 // Env usado para retornar o objeto env
@@ -16,6 +19,54 @@ type Env struct {
 
 var envs []Env
 
+// secretEnvs são as envs com credenciais, mostradas no /env sem o valor. O
+// /env não tem autenticação
+var secretEnvs = map[string]bool{
+	"RANCHER_ACCESS_KEY":            true,
+	"RANCHER_SECRET_KEY":            true,
+	"SLACK_BOT_TOKEN":               true,
+	"SLACK_BOT_VERIFICATION_TOKEN":  true,
+	"SPLUNK_PASSWORD":               true,
+	"ADMIN_API_TOKEN":               true,
+	"SLACK_SIGNING_SECRET":          true,
+	"LOGS_S3_ACCESS_KEY":            true,
+	"LOGS_S3_SECRET_KEY":            true,
+	"ALERTMANAGER_TOKEN":            true,
+	"GRAFANA_TOKEN":                 true,
+	"GRAFANA_API_KEY":               true,
+	"PAGERDUTY_ROUTING_KEYS":        true,
+	"PAGERDUTY_DEFAULT_ROUTING_KEY": true,
+	"PAGERDUTY_API_KEY":             true,
+	"OPSGENIE_API_KEY":              true,
+	"OPSGENIE_TOKEN":                true,
+	"JIRA_TOKEN":                    true,
+	"GITHUB_TOKEN":                  true,
+	"GITLAB_TOKEN":                  true,
+	"JENKINS_TOKEN":                 true,
+	"REGISTRY_TOKEN":                true,
+	"REGISTRY_PASSWORD":             true,
+	"HARBOR_PASSWORD":               true,
+	"HARBOR_TOKEN":                  true,
+	"STATUSPAGE_API_KEY":            true,
+	"K8S_TOKEN":                     true,
+	"ECS_ACCESS_KEY":                true,
+	"ECS_SECRET_KEY":                true,
+	"DATADOG_API_KEY":               true,
+	"DATADOG_APP_KEY":               true,
+	"NEWRELIC_API_KEY":              true,
+	"LEADER_REDIS_PASSWORD":         true,
+	"INTENT_PARSER_TOKEN":           true,
+}
+
+// NewEnv retorna a env para o /env, sem o valor das secretEnvs
+func NewEnv(key string, value string) Env {
+	if secretEnvs[key] && value != "" {
+		value = redactedText
+	}
+
+	return Env{Key: key, Value: value}
+}
+
 // GetEnvs mostra todas envs
 func GetEnvs(w http.ResponseWriter, r *http.Request) {
 	enableCors(&w)
@@ -31,3 +82,19 @@ func GetCommands(w http.ResponseWriter, r *http.Request) {
 func enableCors(w *http.ResponseWriter) {
 	(*w).Header().Set("Access-Control-Allow-Origin", "*")
 }
+
+// ValidWebhookToken verifica o token enviado nos webhooks, que pode vir no
+// header Authorization (Bearer) ou no parâmetro "token" da URL. Sem token
+// configurado o webhook é recusado, para ninguém postar alertas no canal
+func ValidWebhookToken(r *http.Request, token string) bool {
+	if token == "" {
+		log.Printf("[ERROR] Webhook %s recusado, nenhum token configurado\n", r.URL.Path)
+		return false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(token)) == 1 {
+		return true
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")), []byte(token)) == 1
+}
@@ -0,0 +1,217 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// escalationInterval é o intervalo entre as verificações dos alertas sem
+// reconhecimento
+const escalationInterval = 30 * time.Second
+
+var (
+	// EscalationRemind é o tempo sem reconhecimento, por severidade, até o
+	// alerta ser reenviado mencionando o grupo do plantão (ex.: critical:10m)
+	EscalationRemind = map[string]time.Duration{}
+
+	// EscalationPage é o tempo sem reconhecimento, por severidade, até o
+	// alerta ser enviado para o PagerDuty ou o Opsgenie (ex.: critical:20m)
+	EscalationPage = map[string]time.Duration{}
+
+	// EscalationGroups é o user group do Slack mencionado no reenvio, por
+	// severidade (ex.: critical:S0123ABC). Sem o grupo menciona o plantão
+	EscalationGroups = map[string]string{}
+)
+
+// escalation é um alerta enviado pelo BOT aguardando o reconhecimento
+type escalation struct {
+	Key      string
+	Channel  string
+	TS       string
+	Severity string
+	Summary  string
+	Created  time.Time
+	Reminded bool
+	Paged    bool
+}
+
+var (
+	escalations      = map[string]*escalation{}
+	escalationsMutex sync.Mutex
+)
+
+// ParseEscalationDurations lê o mapeamento severidade:duração das envs de
+// escalonamento
+func ParseEscalationDurations(key string, value string) map[string]time.Duration {
+	durations := map[string]time.Duration{}
+
+	for severity, text := range ParseServiceMap(value) {
+		duration, err := time.ParseDuration(text)
+		if err != nil || duration <= 0 {
+			log.Printf("[ERROR] Duração inválida para a severidade %s na env %s: %s\n", severity, key, text)
+			continue
+		}
+		durations[strings.ToLower(severity)] = duration
+	}
+
+	return durations
+}
+
+// TrackEscalation acompanha o alerta enviado na mensagem ts, caso a
+// severidade tenha escalonamento configurado. O key identifica o alerta na
+// origem, para parar o escalonamento quando ele for resolvido
+func TrackEscalation(key string, channel string, ts string, severity string, summary string) {
+	severity = strings.ToLower(severity)
+	if ts == "" || (EscalationRemind[severity] == 0 && EscalationPage[severity] == 0) {
+		return
+	}
+
+	escalationsMutex.Lock()
+	defer escalationsMutex.Unlock()
+
+	escalations[ts] = &escalation{Key: key, Channel: channel, TS: ts, Severity: severity, Summary: summary, Created: time.Now()}
+	log.Printf("[INFO] Escalonamento do alerta %s (%s) iniciado\n", key, severity)
+}
+
+// AcknowledgeEscalation para o escalonamento do alerta da mensagem ts,
+// reconhecido por um botão ou uma reação
+func AcknowledgeEscalation(ts string, user string) {
+	escalationsMutex.Lock()
+	defer escalationsMutex.Unlock()
+
+	if current, ok := escalations[ts]; ok {
+		delete(escalations, ts)
+		log.Printf("[INFO] Alerta %s reconhecido por %s, escalonamento cancelado\n", current.Key, user)
+	}
+}
+
+// ResolveEscalation para o escalonamento dos alertas resolvidos na origem
+func ResolveEscalation(key string) {
+	escalationsMutex.Lock()
+	defer escalationsMutex.Unlock()
+
+	for ts, current := range escalations {
+		if current.Key == key {
+			delete(escalations, ts)
+			log.Printf("[INFO] Alerta %s resolvido, escalonamento cancelado\n", key)
+		}
+	}
+}
+
+// escalationMention é a menção do reenvio: o user group da severidade ou
+// quem está de plantão
+func escalationMention(severity string) string {
+	for name, group := range EscalationGroups {
+		if strings.EqualFold(name, severity) {
+			return fmt.Sprintf("<!subteam^%s>", group)
+		}
+	}
+
+	return OncallMention()
+}
+
+// escalationPage envia o alerta para a integração de paging configurada,
+// retornando a mensagem para a thread do alerta
+func escalationPage(current *escalation) (string, error) {
+	elapsed := formatDuration(time.Since(current.Created))
+	summary := fmt.Sprintf("[Slack sem reconhecimento há %s] %s", elapsed, current.Summary)
+
+	switch {
+	case PagerDutyEnabled():
+		dedupKey, err := TriggerPagerDuty("", summary, "critical", map[string]string{"severity": current.Severity, "alert": current.Key})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(":rotating_light: Incidente aberto no PagerDuty (dedup_key `%s`) após %s sem reconhecimento", dedupKey, elapsed), nil
+	case OpsgenieAPIKey != "":
+		requestID, err := CreateOpsgenieAlert(summary, "P1", "slack-bot")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(":rotating_light: Alerta aberto no Opsgenie (requisição `%s`) após %s sem reconhecimento", requestID, elapsed), nil
+	}
+
+	return "", fmt.Errorf("nenhuma integração de paging configurada (PagerDuty ou Opsgenie)")
+}
+
+// escalate executa os passos vencidos do escalonamento do alerta, retornando
+// se ele terminou
+func escalate(api *SlackListener, current *escalation, now time.Time) bool {
+	elapsed := now.Sub(current.Created)
+	remind, page := EscalationRemind[current.Severity], EscalationPage[current.Severity]
+
+	if remind > 0 && !current.Reminded && elapsed >= remind {
+		current.Reminded = true
+
+		text := fmt.Sprintf(":alarm_clock: Alerta *%s* sem reconhecimento há %s. Reconheça com um botão ou uma reação na mensagem", current.Summary, formatDuration(elapsed))
+		if mention := escalationMention(current.Severity); mention != "" {
+			text = mention + " " + text
+		}
+
+		_, _, err := api.client.PostMessage(current.Channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(current.TS), slack.MsgOptionBroadcast())
+		if err != nil {
+			CheckErr("Erro ao reenviar o alerta "+current.Key, err)
+		}
+		log.Printf("[INFO] Alerta %s reenviado após %s sem reconhecimento\n", current.Key, formatDuration(elapsed))
+	}
+
+	if page > 0 && !current.Paged && elapsed >= page {
+		current.Paged = true
+
+		text, err := escalationPage(current)
+		if err != nil {
+			CheckErr("Erro ao escalonar o alerta "+current.Key, err)
+			text = ":x: Erro ao escalonar o alerta: " + err.Error()
+		}
+		api.client.PostMessage(current.Channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(current.TS))
+		log.Printf("[INFO] Alerta %s escalonado após %s sem reconhecimento\n", current.Key, formatDuration(elapsed))
+	}
+
+	return (remind == 0 || current.Reminded) && (page == 0 || current.Paged)
+}
+
+// WatchEscalations reenvia e escalona os alertas que não foram reconhecidos
+// no tempo configurado para a severidade
+func WatchEscalations() {
+	if len(EscalationRemind) == 0 && len(EscalationPage) == 0 {
+		return
+	}
+
+	log.Printf("[INFO] Escalonando os alertas sem reconhecimento (reenvio %v, paging %v)\n", EscalationRemind, EscalationPage)
+
+	for {
+		time.Sleep(escalationInterval)
+
+		api := getAPIConnection()
+		now := time.Now()
+
+		escalationsMutex.Lock()
+		for ts, current := range escalations {
+			if escalate(api, current, now) {
+				delete(escalations, ts)
+			}
+		}
+		escalationsMutex.Unlock()
+	}
+}
+
+// EscalationMiddleware considera reconhecido o alerta da mensagem em que
+// algum botão foi clicado
+func EscalationMiddleware(next InteractionHandler) InteractionHandler {
+	return func(w http.ResponseWriter, in *Interaction) {
+		next(w, in)
+
+		if in.Message.MessageTs != "" {
+			AcknowledgeEscalation(in.Message.MessageTs, in.Message.User.Name)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	// RancherEvents define se o BOT acompanha o stream de eventos do Rancher
+	// para avisar alterações feitas fora do BOT
+	RancherEvents bool
+
+	// RancherEventsTimeout é o tempo sem nenhuma mensagem (o Rancher envia
+	// pings) para considerar a conexão perdida e reconectar
+	RancherEventsTimeout = 2 * time.Minute
+)
+
+// botChangeWindow é o tempo em que um evento do Rancher é atribuído a uma
+// alteração feita pelo próprio BOT no serviço
+const botChangeWindow = 5 * time.Minute
+
+var (
+	botChanges      = map[string]time.Time{}
+	botChangesMutex sync.Mutex
+)
+
+// markBotChange registra que o serviço foi alterado pelo BOT, para o stream de
+// eventos não repetir o aviso
+func markBotChange(serviceID string) {
+	botChangesMutex.Lock()
+	defer botChangesMutex.Unlock()
+
+	botChanges[serviceID] = time.Now()
+}
+
+// recentBotChange retorna se o BOT alterou o serviço há pouco tempo
+func recentBotChange(serviceID string) bool {
+	botChangesMutex.Lock()
+	defer botChangesMutex.Unlock()
+
+	changed, ok := botChanges[serviceID]
+	if ok && time.Since(changed) > botChangeWindow {
+		delete(botChanges, serviceID)
+		return false
+	}
+
+	return ok
+}
+
+// serviceSnapshot é o último estado conhecido de um serviço no stream de eventos
+type serviceSnapshot struct {
+	State  string
+	Health string
+	Image  string
+	Scale  int64
+}
+
+// WatchRancherEvents se conecta no WebSocket de eventos do Rancher, reconectando
+// com backoff exponencial (até 1 minuto) quando a conexão cai
+func WatchRancherEvents() {
+	if !RancherEvents {
+		return
+	}
+
+	snapshots := map[string]serviceSnapshot{}
+	backoff := time.Second
+
+	for {
+		start := time.Now()
+
+		err := subscribeRancherEvents(snapshots)
+		if botContext.Err() != nil {
+			return
+		}
+		CheckErr("Conexão com os eventos do Rancher encerrada", err)
+
+		// Uma conexão que ficou de pé por um tempo zera o backoff
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+
+		log.Printf("[INFO] Reconectando nos eventos do Rancher em %s\n", backoff)
+		time.Sleep(backoff)
+
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+func subscribeRancherEvents(snapshots map[string]serviceSnapshot) error {
+	url := fmt.Sprintf("%s/%s/subscribe?eventNames=resource.change&limit=-1", rancherListener.baseURL, rancherListener.projectID)
+	url = strings.Replace(url, "http", "ws", 1)
+
+	header := http.Header{}
+	if rancherListener.accessKey != "" && rancherListener.secretKey != "" {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(rancherListener.accessKey+":"+rancherListener.secretKey)))
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(botContext, url, header)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// No desligamento do BOT a conexão é fechada com o close frame
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		select {
+		case <-botContext.Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	log.Println("[INFO] Conectado nos eventos do Rancher")
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(RancherEventsTimeout))
+
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		event := gjson.ParseBytes(msg)
+		if event.Get("name").String() != "resource.change" {
+			continue
+		}
+
+		resource := event.Get("data.resource")
+		switch resource.Get("type").String() {
+		case "service", "loadBalancerService":
+			rancherListener.invalidateCache(cacheServices, cacheLoadBalancers)
+			handleServiceEvent(resource, snapshots)
+		case "container":
+			rancherListener.invalidateCache(cacheContainers)
+		case "stack":
+			rancherListener.invalidateCache(cacheStacks)
+		}
+	}
+}
+
+// handleServiceEvent compara o serviço com o último estado conhecido e avisa
+// no canal upgrades, mudanças de escala e de saúde
+func handleServiceEvent(service gjson.Result, snapshots map[string]serviceSnapshot) {
+	serviceID := service.Get("id").String()
+
+	current := serviceSnapshot{
+		State:  service.Get("state").String(),
+		Health: service.Get("healthState").String(),
+		Image:  service.Get("launchConfig.imageUuid").String(),
+		Scale:  service.Get("scale").Int(),
+	}
+
+	previous, ok := snapshots[serviceID]
+
+	// Estados de saúde transitórios (initializing, updating-*) não são avisados
+	if current.Health != "healthy" && current.Health != "unhealthy" && current.Health != "degraded" {
+		current.Health = previous.Health
+	}
+
+	snapshots[serviceID] = current
+
+	// O primeiro evento de cada serviço só registra o estado
+	if !ok {
+		return
+	}
+
+	var changes []string
+
+	// Upgrades e escala feitos pelo BOT já foram avisados por ele
+	if !recentBotChange(serviceID) {
+		if current.Image != previous.Image {
+			changes = append(changes, fmt.Sprintf(":rocket: Upgrade de `%s` para `%s`", previous.Image, current.Image))
+			RecordDigestDeploy("Rancher", fmt.Sprintf("upgrade do serviço %s para `%s`", service.Get("name").String(), current.Image))
+		}
+
+		if current.State != previous.State {
+			switch current.State {
+			case "upgraded":
+				changes = append(changes, ":hourglass: Upgrade concluído, aguardando o finish")
+			case "rolling-back":
+				changes = append(changes, ":rewind: Rollback iniciado")
+				RecordDigestDeploy("Rancher", fmt.Sprintf("rollback do serviço %s", service.Get("name").String()))
+			case "inactive":
+				changes = append(changes, ":double_vertical_bar: Serviço parado")
+			case "active":
+				if previous.State == "finishing-upgrade" || previous.State == "rolling-back" || previous.State == "activating" {
+					changes = append(changes, ":white_check_mark: Serviço ativo")
+				}
+			}
+		}
+
+		if current.Scale != previous.Scale {
+			changes = append(changes, fmt.Sprintf(":chart_with_upwards_trend: Escala alterada de %d para %d", previous.Scale, current.Scale))
+		}
+	}
+
+	if current.Health != previous.Health && previous.Health != "" {
+		icon := ":large_green_circle:"
+		switch current.Health {
+		case "unhealthy":
+			icon = ":red_circle:"
+		case "degraded":
+			icon = ":warning:"
+		}
+
+		changes = append(changes, fmt.Sprintf("%s Saúde alterada de `%s` para `%s`", icon, previous.Health, current.Health))
+	}
+
+	if len(changes) == 0 {
+		return
+	}
+
+	log.Printf("[INFO] Alterações no serviço %s recebidas pelo stream de eventos\n", serviceID)
+	sendNotification(fmt.Sprintf("*Serviço `%s` (%s)*\n%s", service.Get("name").String(), serviceID, strings.Join(changes, "\n")))
+}
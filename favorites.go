@@ -0,0 +1,224 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/nlopes/slack"
+)
+
+// FavoritesFile é o arquivo onde ficam salvos os serviços favoritos de
+// cada usuário
+var FavoritesFile = "favorites.json"
+
+// favoriteServices é o mapeamento do usuário (ID do Slack) para os IDs dos seus
+// serviços favoritos, na ordem em que foram adicionados
+var (
+	favoriteServices = map[string][]string{}
+	favoritesLoaded  bool
+	favoritesMutex   sync.Mutex
+)
+
+// loadFavorites lê o arquivo de favoritos na primeira vez que eles são
+// usados. Deve ser chamada com o favoritesMutex travado
+func loadFavorites() {
+	if favoritesLoaded {
+		return
+	}
+	favoritesLoaded = true
+
+	data, err := ioutil.ReadFile(FavoritesFile)
+	if os.IsNotExist(err) {
+		return
+	}
+	CheckErr("Erro ao ler o arquivo de favoritos", err)
+
+	err = json.Unmarshal(data, &favoriteServices)
+	CheckErr("Erro ao converter o arquivo de favoritos", err)
+}
+
+// saveFavorites persiste os favoritos no arquivo. Deve ser chamada com o
+// favoritesMutex travado
+func saveFavorites() {
+	data, err := json.MarshalIndent(favoriteServices, "", "  ")
+	CheckErr("Erro ao converter os favoritos", err)
+
+	err = ioutil.WriteFile(FavoritesFile, data, 0644)
+	CheckErr("Erro ao salvar o arquivo de favoritos", err)
+}
+
+// UserFavorites retorna os IDs dos serviços favoritos do usuário
+func UserFavorites(user string) []string {
+	favoritesMutex.Lock()
+	defer favoritesMutex.Unlock()
+
+	loadFavorites()
+
+	return append([]string{}, favoriteServices[user]...)
+}
+
+// AddFavorite adiciona o serviço aos favoritos do usuário, retornando false
+// quando ele já estava na lista
+func AddFavorite(user string, serviceID string) bool {
+	favoritesMutex.Lock()
+	defer favoritesMutex.Unlock()
+
+	loadFavorites()
+
+	if containsString(favoriteServices[user], serviceID) {
+		return false
+	}
+
+	favoriteServices[user] = append(favoriteServices[user], serviceID)
+	saveFavorites()
+
+	return true
+}
+
+// RemoveFavorite tira o serviço dos favoritos do usuário, retornando false
+// quando ele não estava na lista
+func RemoveFavorite(user string, serviceID string) bool {
+	favoritesMutex.Lock()
+	defer favoritesMutex.Unlock()
+
+	loadFavorites()
+
+	var kept []string
+	for _, ID := range favoriteServices[user] {
+		if ID != serviceID {
+			kept = append(kept, ID)
+		}
+	}
+
+	if len(kept) == len(favoriteServices[user]) {
+		return false
+	}
+
+	if len(kept) == 0 {
+		delete(favoriteServices, user)
+	} else {
+		favoriteServices[user] = kept
+	}
+	saveFavorites()
+
+	return true
+}
+
+// favoritesFirst coloca os serviços favoritos do usuário no topo do menu,
+// marcados com uma estrela. As opções têm o texto no formato "ID | nome"
+func favoritesFirst(user string, options []slack.AttachmentActionOption) []slack.AttachmentActionOption {
+	userFavorites := UserFavorites(user)
+	if len(userFavorites) == 0 {
+		return options
+	}
+
+	var first, rest []slack.AttachmentActionOption
+	for _, option := range options {
+		favorite := false
+		for _, ID := range userFavorites {
+			if strings.HasPrefix(option.Text, ID+" | ") {
+				favorite = true
+				break
+			}
+		}
+
+		if favorite {
+			option.Text = "⭐ " + option.Text
+			first = append(first, option)
+		} else {
+			rest = append(rest, option)
+		}
+	}
+
+	return append(first, rest...)
+}
+
+// slackFav adiciona ou remove um serviço dos favoritos do usuário. Sem
+// argumentos lista os favoritos
+func (s *SlackListener) slackFav(ev *slack.MessageEvent) {
+	args := strings.Fields(ev.Msg.Text)
+	user := ev.Msg.User
+
+	if len(args) < 3 {
+		s.sendFavoritesList(ev)
+		return
+	}
+
+	if len(args) < 4 || (args[2] != "add" && args[2] != "remove") {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s add|remove serviço", fav), false))
+		return
+	}
+
+	serviceID, ok := s.resolveServiceArg(ev.Channel, args[3])
+	if !ok {
+		return
+	}
+
+	name := serviceIndex.Name(serviceID)
+
+	if args[2] == "add" {
+		if !AddFavorite(user, serviceID) {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("O serviço `%s` já está nos seus favoritos", name), false))
+			return
+		}
+
+		log.Printf("[INFO] Serviço %s adicionado aos favoritos do usuário %s\n", serviceID, user)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":star: Serviço `%s` adicionado aos seus favoritos", name), false))
+		return
+	}
+
+	if !RemoveFavorite(user, serviceID) {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("O serviço `%s` não está nos seus favoritos", name), false))
+		return
+	}
+
+	log.Printf("[INFO] Serviço %s removido dos favoritos do usuário %s\n", serviceID, user)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Serviço `%s` removido dos seus favoritos", name), false))
+}
+
+func (s *SlackListener) sendFavoritesList(ev *slack.MessageEvent) {
+	userFavorites := UserFavorites(ev.Msg.User)
+	if len(userFavorites) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Você ainda não tem favoritos, adicione com @nome-do-bot %s add serviço", fav), false))
+		return
+	}
+
+	var names []string
+	for _, ID := range userFavorites {
+		names = append(names, fmt.Sprintf("`%s` (%s)", serviceIndex.Name(ID), ID))
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":star: *Seus favoritos:* %s", strings.Join(names, ", ")), false))
+}
+
+// slackFavorites envia os serviços favoritos do usuário, cada um com os
+// botões de info, logs e restart
+func (s *SlackListener) slackFavorites(ev *slack.MessageEvent) {
+	userFavorites := UserFavorites(ev.Msg.User)
+	if len(userFavorites) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Você ainda não tem favoritos, adicione com @nome-do-bot %s add serviço", fav), false))
+		return
+	}
+
+	var attachments []slack.Attachment
+	for _, ID := range userFavorites {
+		result := findResult{kind: "serviço", id: ID, name: serviceIndex.Name(ID)}
+
+		attachments = append(attachments, slack.Attachment{
+			Text:       fmt.Sprintf(":star: `%s` (%s)", result.name, result.id),
+			Color:      "#0C648A",
+			CallbackID: favorites,
+			Actions:    findActions(result),
+		})
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText("*Seus serviços favoritos:*", false), slack.MsgOptionAttachments(attachments...))
+}
@@ -0,0 +1,257 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	findCallback            = "find"
+	actionFindServiceLogs   = "find-service-logs"
+	actionFindStackServices = "find-stack-services"
+	actionContainerRestart  = "container-restart"
+
+	// findMaxResults é a quantidade máxima de resultados do find
+	findMaxResults = 10
+)
+
+// findResult é um recurso encontrado pelo find
+type findResult struct {
+	kind    string
+	id      string
+	name    string
+	details string
+	score   int
+}
+
+// fuzzyScore retorna o quanto o nome é parecido com a busca, quanto menor
+// melhor: nome igual, começo do nome, parte do nome, letras na mesma ordem
+// (ex.: "pay" em "payments-api") e nome parecido (erros de digitação)
+func fuzzyScore(name string, query string) (int, bool) {
+	name, query = strings.ToLower(name), strings.ToLower(query)
+
+	switch {
+	case name == query:
+		return 0, true
+	case strings.HasPrefix(name, query):
+		return 1, true
+	case strings.Contains(name, query):
+		return 2, true
+	case isSubsequence(query, name):
+		return 3, true
+	}
+
+	if distance := levenshtein(name, query); distance <= maxTypos(query) {
+		return 4 + distance, true
+	}
+
+	return 0, false
+}
+
+// isSubsequence verifica se as letras de a aparecem em b na mesma ordem
+func isSubsequence(a string, b string) bool {
+	ra := []rune(a)
+	if len(ra) == 0 {
+		return true
+	}
+
+	i := 0
+	for _, r := range b {
+		if r == ra[i] {
+			i++
+			if i == len(ra) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// FindResources busca a query nos nomes dos serviços e, no Rancher, dos
+// containers e stacks, retornando os mais parecidos primeiro
+func FindResources(query string) ([]findResult, error) {
+	services, err := orchestrator.ListServices()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []findResult
+	add := func(kind, id, name, details string) {
+		if score, ok := fuzzyScore(name, query); ok {
+			results = append(results, findResult{kind: kind, id: id, name: name, details: details, score: score})
+		}
+	}
+
+	for _, service := range services {
+		add("serviço", service.ID, service.Name, fmt.Sprintf("%s | %s instâncias | %s", service.State, formatReplicas(&service), service.Image))
+	}
+
+	if orchestrator.Name() == "rancher" {
+		containers, err := rancherListener.ListContainers()
+		CheckErr("Erro ao listar os containers para o find", err)
+		for _, container := range containers {
+			details := fmt.Sprintf("%s | %s", container.State, container.ImageUUID)
+			if uptime := uptimeSince(container.Created); uptime != "" && container.State == "running" {
+				details += " | " + uptime
+			}
+			add("container", container.ID, container.Name, details)
+		}
+
+		stacks, err := rancherListener.ListStacks()
+		CheckErr("Erro ao listar as stacks para o find", err)
+		for _, stack := range stacks {
+			add("stack", stack.ID, stack.Name, fmt.Sprintf("%s | %d serviços", stack.State, len(stack.ServiceIDs)))
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score < results[j].score
+		}
+		return results[i].name < results[j].name
+	})
+
+	return results, nil
+}
+
+// findActions retorna os botões de cada tipo de resultado
+func findActions(result findResult) []slack.AttachmentAction {
+	switch result.kind {
+	case "serviço":
+		return []slack.AttachmentAction{
+			{Name: actionServiceInfo, Text: "Info", Type: "button", Value: result.id},
+			{Name: actionFindServiceLogs, Text: "Logs", Type: "button", Value: result.id},
+			restartAction(actionServiceRestart, result, "todos os containers do serviço"),
+		}
+	case "container":
+		return []slack.AttachmentAction{
+			{Name: actionLogsRange, Text: "Logs", Type: "button", Value: result.id},
+			restartAction(actionContainerRestart, result, "o container"),
+		}
+	default:
+		return []slack.AttachmentAction{
+			{Name: actionFindStackServices, Text: "Serviços", Type: "button", Value: result.id},
+		}
+	}
+}
+
+func restartAction(name string, result findResult, what string) slack.AttachmentAction {
+	return slack.AttachmentAction{
+		Name:  name,
+		Text:  "Reiniciar",
+		Type:  "button",
+		Style: "danger",
+		Value: result.id,
+		Confirm: &slack.ConfirmationField{
+			Title:       "Tem certeza disso?",
+			Text:        fmt.Sprintf("Deseja mesmo reiniciar %s %s? :thinking_face:", what, result.name),
+			OkText:      "Sim",
+			DismissText: "Não",
+		},
+	}
+}
+
+func (s *SlackListener) slackFind(ev *slack.MessageEvent) {
+	args := strings.Fields(ev.Msg.Text)
+
+	if len(args) < 3 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s busca", find), false))
+		return
+	}
+
+	query := strings.Join(args[2:], " ")
+
+	results, err := FindResources(query)
+	if err != nil {
+		CheckErr("Erro na busca", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na busca: %s", err), false))
+		return
+	}
+
+	if len(results) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Nada encontrado para `%s` :mag:", query), false))
+		return
+	}
+
+	text := fmt.Sprintf(":mag: %d resultados para `%s`", len(results), query)
+	if len(results) > findMaxResults {
+		text += fmt.Sprintf(", mostrando os %d mais parecidos", findMaxResults)
+		results = results[:findMaxResults]
+	}
+
+	var attachments []slack.Attachment
+	for _, result := range results {
+		attachments = append(attachments, slack.Attachment{
+			Title:      fmt.Sprintf("%s %s", result.kind, result.name),
+			Text:       result.details,
+			Footer:     result.id,
+			Color:      "#0C648A",
+			CallbackID: findCallback,
+			Actions:    findActions(result),
+		})
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(text, false), slack.MsgOptionAttachments(attachments...))
+}
+
+func actionFindServiceLogsFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	serviceID := message.Actions[0].Value
+
+	job, err := EnqueueJobContext("logs do serviço "+serviceID, message.User.Name, func(ctx context.Context) error {
+		return UploadServiceLogs(ctx, serviceID, LogsOptions{Lines: defaultLogsLines}, nil)
+	})
+	interactionJob(w, job, err)
+	if err != nil {
+		sendMessage(queuedJobMessage(job, err))
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func actionContainerRestartFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	containerID := message.Actions[0].Value
+
+	if err := interactionRancher(w).RestartContainer(containerID); err != nil {
+		CheckErr("Erro ao reiniciar o container "+containerID, err)
+		interactionFailed(w)
+		sendMessage(fmt.Sprintf(":x: Erro ao reiniciar o container `%s`: %s", containerID, err))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	log.Printf("[INFO] Container %s reiniciado pelo usuário %s\n", containerID, message.User.Name)
+	sendMessage(fmt.Sprintf("Container `%s` reiniciado por @%s :arrows_counterclockwise:", containerID, message.User.Name))
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func actionFindStackServicesFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	stackID := message.Actions[0].Value
+
+	services, err := rancherListener.ListServices()
+	if err != nil {
+		sendMessage(fmt.Sprintf("Erro ao listar os serviços da stack `%s`: %s", stackID, err))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	msg := fmt.Sprintf("*Serviços da stack* `%s`:\n", stackID)
+	for _, service := range services {
+		if service.StackID == stackID {
+			msg += fmt.Sprintf("`%s | %s` %s\n", service.ID, service.Name, service.State)
+		}
+	}
+
+	sendMessage(msg)
+	w.WriteHeader(http.StatusOK)
+}
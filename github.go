@@ -0,0 +1,184 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	// GitHubToken é o token (PAT ou de GitHub App) usado para disparar os workflows
+	GitHubToken string
+
+	// GitHubAPIURL é a URL da API do GitHub (alterar para o GitHub Enterprise)
+	GitHubAPIURL = "https://api.github.com"
+
+	// GitHubDefaultRef é a branch/tag usada quando o ref não é informado
+	GitHubDefaultRef = "main"
+)
+
+func githubHeaders() map[string]string {
+	return map[string]string{
+		"Authorization": "Bearer " + GitHubToken,
+		"Accept":        "application/vnd.github+json",
+	}
+}
+
+// DispatchGitHubWorkflow dispara um workflow via workflow_dispatch
+func DispatchGitHubWorkflow(repo string, workflow string, ref string, inputs map[string]string) error {
+	url := fmt.Sprintf("%s/repos/%s/actions/workflows/%s/dispatches", GitHubAPIURL, repo, workflow)
+
+	_, err := HTTPSendJSONRequest(PostHTTP, url, githubHeaders(), map[string]interface{}{
+		"ref":    ref,
+		"inputs": inputs,
+	})
+
+	return err
+}
+
+// DispatchGitHubRepository envia um evento repository_dispatch para o repositório
+func DispatchGitHubRepository(repo string, eventType string, payload map[string]string) error {
+	url := fmt.Sprintf("%s/repos/%s/dispatches", GitHubAPIURL, repo)
+
+	_, err := HTTPSendJSONRequest(PostHTTP, url, githubHeaders(), map[string]interface{}{
+		"event_type":     eventType,
+		"client_payload": payload,
+	})
+
+	return err
+}
+
+// findGitHubRun procura o run criado pelo dispatch, já que a API do GitHub
+// não retorna o ID do run no disparo
+func findGitHubRun(repo string, workflow string, event string, ref string, since time.Time) (int64, error) {
+	query := url.Values{}
+	query.Set("event", event)
+	query.Set("per_page", "10")
+	if event == "workflow_dispatch" {
+		query.Set("branch", ref)
+	}
+
+	path := fmt.Sprintf("%s/repos/%s/actions/runs?%s", GitHubAPIURL, repo, query.Encode())
+	if workflow != "" {
+		path = fmt.Sprintf("%s/repos/%s/actions/workflows/%s/runs?%s", GitHubAPIURL, repo, workflow, query.Encode())
+	}
+
+	// O run pode demorar alguns segundos para aparecer na API
+	for i := 0; i < 12; i++ {
+		resp, err := HTTPSendJSONRequest(GetHTTP, path, githubHeaders(), nil)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, run := range gjson.Get(resp, "workflow_runs").Array() {
+			created, _ := time.Parse(time.RFC3339, run.Get("created_at").String())
+			if !created.Before(since.Add(-5 * time.Second)) {
+				return run.Get("id").Int(), nil
+			}
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	return 0, fmt.Errorf("run não encontrado no repositório %s", repo)
+}
+
+// GitHubRunStatus retorna o status do run e dos seus jobs
+func GitHubRunStatus(repo string, runID int64) (PipelineStatus, error) {
+	resp, err := HTTPSendJSONRequest(GetHTTP, fmt.Sprintf("%s/repos/%s/actions/runs/%d", GitHubAPIURL, repo, runID), githubHeaders(), nil)
+	if err != nil {
+		return PipelineStatus{}, err
+	}
+
+	status := PipelineStatus{
+		State: gjson.Get(resp, "status").String(),
+		URL:   gjson.Get(resp, "html_url").String(),
+		Jobs:  map[string]string{},
+	}
+
+	if status.State == "completed" {
+		conclusion := gjson.Get(resp, "conclusion").String()
+		status.State = conclusion
+		status.Finished = true
+		status.Success = conclusion == "success"
+	}
+
+	jobs, err := HTTPSendJSONRequest(GetHTTP, fmt.Sprintf("%s/repos/%s/actions/runs/%d/jobs", GitHubAPIURL, repo, runID), githubHeaders(), nil)
+	if err == nil {
+		for _, job := range gjson.Get(jobs, "jobs").Array() {
+			state := job.Get("status").String()
+			if state == "completed" {
+				state = job.Get("conclusion").String()
+			}
+			status.Jobs[job.Get("name").String()] = state
+		}
+	}
+
+	return status, nil
+}
+
+func (s *SlackListener) slackGitHubWorkflow(ev *slack.MessageEvent) {
+	values, args := parseKeyValueArgs(strings.Split(ev.Msg.Text, " ")[2:])
+
+	if len(args) != 2 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s dono/repositório workflow.yml|event:tipo [ref=branch] [environment=ambiente] [input=valor...]", githubWorkflow), false))
+		return
+	}
+
+	repo, workflow := args[0], args[1]
+
+	ref := values["ref"]
+	delete(values, "ref")
+	if ref == "" {
+		ref = GitHubDefaultRef
+	}
+
+	since := time.Now()
+	event := "workflow_dispatch"
+	var err error
+
+	if strings.HasPrefix(workflow, "event:") {
+		event = "repository_dispatch"
+		values["ref"] = ref
+		err = DispatchGitHubRepository(repo, strings.TrimPrefix(workflow, "event:"), values)
+		workflow = ""
+	} else {
+		err = DispatchGitHubWorkflow(repo, workflow, ref, values)
+	}
+
+	if err != nil {
+		CheckErr("Erro ao disparar workflow no GitHub", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao disparar o workflow no GitHub: %s", err), false))
+		return
+	}
+
+	log.Printf("[INFO] Workflow %s do repositório %s disparado pelo usuário %s\n", args[1], repo, ev.Msg.User)
+
+	title := fmt.Sprintf("GitHub Actions `%s` em `%s` (%s)", args[1], repo, ref)
+	channel, ts, err := s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(pipelineAttachment(title, PipelineStatus{State: "dispatched"})))
+	if err != nil {
+		CheckErr("Erro ao enviar mensagem do workflow", err)
+		return
+	}
+
+	go func() {
+		runID, err := findGitHubRun(repo, workflow, event, ref, since)
+		if err != nil {
+			CheckErr("Erro ao buscar o run do workflow", err)
+			s.client.PostMessage(channel, slack.MsgOptionText(fmt.Sprintf(":warning: O workflow foi disparado mas não consegui acompanhar: %s", err), false), slack.MsgOptionTS(ts))
+			return
+		}
+
+		TrackPipeline(channel, ts, title, func() (PipelineStatus, error) {
+			return GitHubRunStatus(repo, runID)
+		})
+	}()
+}
@@ -0,0 +1,121 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	// GitLabURL é a URL da instância do GitLab
+	GitLabURL = "https://gitlab.com"
+
+	// GitLabToken é o token de acesso (escopo api) usado para criar os pipelines
+	GitLabToken string
+
+	// GitLabDefaultRef é a branch usada quando o ref não é informado
+	GitLabDefaultRef = "main"
+)
+
+func gitlabHeaders() map[string]string {
+	return map[string]string{"PRIVATE-TOKEN": GitLabToken}
+}
+
+func gitlabProjectURL(project string) string {
+	return fmt.Sprintf("%s/api/v4/projects/%s", GitLabURL, url.PathEscape(project))
+}
+
+// CreateGitLabPipeline cria um pipeline no projeto (ID ou grupo/projeto),
+// retornando o ID e o link do pipeline
+func CreateGitLabPipeline(project string, ref string, variables map[string]string) (int64, string, error) {
+	vars := []map[string]string{}
+	for key, value := range variables {
+		vars = append(vars, map[string]string{"key": key, "value": value})
+	}
+
+	resp, err := HTTPSendJSONRequest(PostHTTP, gitlabProjectURL(project)+"/pipeline", gitlabHeaders(), map[string]interface{}{
+		"ref":       ref,
+		"variables": vars,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	return gjson.Get(resp, "id").Int(), gjson.Get(resp, "web_url").String(), nil
+}
+
+// GitLabPipelineStatus retorna o status do pipeline e dos seus jobs
+func GitLabPipelineStatus(project string, pipelineID int64) (PipelineStatus, error) {
+	resp, err := HTTPSendJSONRequest(GetHTTP, fmt.Sprintf("%s/pipelines/%d", gitlabProjectURL(project), pipelineID), gitlabHeaders(), nil)
+	if err != nil {
+		return PipelineStatus{}, err
+	}
+
+	state := gjson.Get(resp, "status").String()
+	status := PipelineStatus{
+		State: state,
+		URL:   gjson.Get(resp, "web_url").String(),
+		Jobs:  map[string]string{},
+	}
+
+	switch state {
+	case "success":
+		status.Finished = true
+		status.Success = true
+	case "failed", "canceled", "skipped":
+		status.Finished = true
+	}
+
+	jobs, err := HTTPSendJSONRequest(GetHTTP, fmt.Sprintf("%s/pipelines/%d/jobs?per_page=100", gitlabProjectURL(project), pipelineID), gitlabHeaders(), nil)
+	if err == nil {
+		for _, job := range gjson.Parse(jobs).Array() {
+			status.Jobs[fmt.Sprintf("%s/%s", job.Get("stage").String(), job.Get("name").String())] = job.Get("status").String()
+		}
+	}
+
+	return status, nil
+}
+
+func (s *SlackListener) slackGitLabPipeline(ev *slack.MessageEvent) {
+	variables, args := parseKeyValueArgs(strings.Split(ev.Msg.Text, " ")[2:])
+
+	if len(args) != 1 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s grupo/projeto [ref=branch] [VARIAVEL=valor...]", gitlabPipeline), false))
+		return
+	}
+
+	project := args[0]
+
+	ref := variables["ref"]
+	delete(variables, "ref")
+	if ref == "" {
+		ref = GitLabDefaultRef
+	}
+
+	pipelineID, webURL, err := CreateGitLabPipeline(project, ref, variables)
+	if err != nil {
+		CheckErr("Erro ao criar pipeline no GitLab", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao criar o pipeline no GitLab: %s", err), false))
+		return
+	}
+
+	log.Printf("[INFO] Pipeline %d do projeto %s criado pelo usuário %s\n", pipelineID, project, ev.Msg.User)
+
+	title := fmt.Sprintf("GitLab CI #%d `%s` (%s)", pipelineID, project, ref)
+	channel, ts, err := s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(pipelineAttachment(title, PipelineStatus{State: "created", URL: webURL})))
+	if err != nil {
+		CheckErr("Erro ao enviar mensagem do pipeline", err)
+		return
+	}
+
+	go TrackPipeline(channel, ts, title, func() (PipelineStatus, error) {
+		return GitLabPipelineStatus(project, pipelineID)
+	})
+}
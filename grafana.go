@@ -0,0 +1,182 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+const grafanaCallback = "grafana"
+
+var (
+	// GrafanaToken é o token que o Grafana deve enviar no webhook
+	GrafanaToken string
+
+	// GrafanaServiceMap é o mapeamento do nome do alerta (regra) do Grafana
+	// para o ID do serviço no Rancher, usado nos botões de ação
+	GrafanaServiceMap = map[string]string{}
+)
+
+// ParseServiceMap lê um mapeamento no formato "chave:id-serviço,chave2:id-serviço2"
+func ParseServiceMap(value string) map[string]string {
+	services := map[string]string{}
+
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(kv) == 2 && kv[0] != "" && kv[1] != "" {
+			services[kv[0]] = kv[1]
+		}
+	}
+
+	return services
+}
+
+// GrafanaWebhook é o end-point que recebe os webhooks de alerta do Grafana,
+// aceitando tanto o formato do alerting antigo quanto o do unified alerting
+func GrafanaWebhook(w http.ResponseWriter, r *http.Request) {
+	if !ValidWebhookToken(r, GrafanaToken) {
+		log.Println("[ERROR] Token inválido no webhook do Grafana")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil || !gjson.Valid(string(buf)) {
+		log.Printf("[ERROR] Erro ao ler o webhook do Grafana: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body := string(buf)
+
+	var attachments []slack.Attachment
+	var rules []string
+	if gjson.Get(body, "alerts").Exists() {
+		gjson.Get(body, "alerts").ForEach(func(key, alert gjson.Result) bool {
+			rules = append(rules, alert.Get("labels.alertname").String())
+			attachments = append(attachments, grafanaAttachment(
+				alert.Get("labels.alertname").String(),
+				alert.Get("status").String(),
+				alert.Get("annotations.summary").String()+"\n"+alert.Get("valueString").String(),
+				alert.Get("panelURL").String(),
+				alert.Get("imageURL").String(),
+			))
+			return true
+		})
+	} else {
+		var matches []string
+		gjson.Get(body, "evalMatches").ForEach(func(key, match gjson.Result) bool {
+			matches = append(matches, fmt.Sprintf("`%s`: %s", match.Get("metric").String(), match.Get("value").String()))
+			return true
+		})
+
+		rules = append(rules, gjson.Get(body, "ruleName").String())
+		attachments = append(attachments, grafanaAttachment(
+			gjson.Get(body, "ruleName").String(),
+			gjson.Get(body, "state").String(),
+			gjson.Get(body, "message").String()+"\n"+strings.Join(matches, "\n"),
+			gjson.Get(body, "ruleUrl").String(),
+			gjson.Get(body, "imageUrl").String(),
+		))
+	}
+
+	if len(attachments) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Alertas disparados mencionam quem está de plantão e são críticos
+	var options []slack.MsgOption
+	critical := false
+	for _, attachment := range attachments {
+		if attachment.Color == "#D50200" {
+			RecordDigestAlert("Grafana", attachment.Title)
+			critical = true
+		}
+	}
+	if critical {
+		options = withOncallMention(options...)
+	}
+
+	var titles []string
+	for _, attachment := range attachments {
+		titles = append(titles, attachment.Title)
+	}
+
+	// Os alertas são agrupados pelo serviço mapeado, ou pelo nome do alerta
+	group := GrafanaServiceMap[rules[0]]
+	if group == "" {
+		group = rules[0]
+	}
+
+	// O painel do serviço vai junto dos alertas que não foram resolvidos,
+	// apenas na mensagem principal do grupo
+	channel := getAPIConnection().channelID
+	if ts := PostAlert("grafana:"+group, strings.Join(titles, "|"), critical, attachments, options...); ts != "" {
+		if critical {
+			severity := gjson.Get(body, "alerts.0.labels.severity").String()
+			if severity == "" {
+				severity = "critical"
+			}
+			TrackEscalation("grafana:"+group, channel, ts, severity, strings.Join(titles, ", "))
+		}
+
+		posted := map[string]bool{}
+		for i, attachment := range attachments {
+			serviceID := GrafanaServiceMap[rules[i]]
+			if attachment.Color != "#36A64F" && serviceID != "" && !posted[serviceID] {
+				posted[serviceID] = true
+				go postGrafanaPanel(channel, serviceID)
+			}
+		}
+	}
+
+	// Os alertas resolvidos param o escalonamento do grupo
+	resolved := true
+	for _, attachment := range attachments {
+		resolved = resolved && attachment.Color == "#36A64F"
+	}
+	if resolved {
+		ResolveEscalation("grafana:" + group)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// grafanaAttachment monta a mensagem de um alerta do Grafana, com a imagem do
+// painel e os botões do serviço mapeado para o alerta
+func grafanaAttachment(rule string, state string, text string, link string, image string) slack.Attachment {
+	color := "#D50200"
+	switch strings.ToLower(state) {
+	case "ok", "resolved", "normal":
+		color = "#36A64F"
+	case "no_data", "pending", "paused":
+		color = "#FFA500"
+	}
+
+	attachment := slack.Attachment{
+		Title:      fmt.Sprintf("[%s] %s", strings.ToUpper(state), rule),
+		TitleLink:  link,
+		Text:       strings.TrimSpace(text),
+		ImageURL:   image,
+		Color:      color,
+		CallbackID: grafanaCallback,
+	}
+
+	if color == "#36A64F" {
+		return attachment
+	}
+
+	serviceID := GrafanaServiceMap[rule]
+	attachment.Actions = append(serviceQuickActionsIf(serviceID), alertActions(serviceID)...)
+
+	return attachment
+}
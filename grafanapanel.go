@@ -0,0 +1,151 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+var (
+	// GrafanaURL é o endereço do Grafana usado na render API dos painéis
+	GrafanaURL string
+
+	// GrafanaAPIKey é o token (API key ou service account) usado na render API
+	GrafanaAPIKey string
+
+	// GrafanaPanels é o mapeamento do serviço (ID ou nome) para o painel no
+	// formato uid-do-dashboard/id-do-painel, com as variáveis opcionais na
+	// query (ex.: payments:abc123/4?var-service=payments)
+	GrafanaPanels = map[string]string{}
+
+	// GrafanaPanelRange é o período mostrado na imagem do painel
+	GrafanaPanelRange = time.Hour
+)
+
+// grafanaPanelFor retorna o painel mapeado para o serviço, pelo ID ou pelo nome
+func grafanaPanelFor(serviceID string) (string, bool) {
+	if GrafanaURL == "" || serviceID == "" {
+		return "", false
+	}
+
+	if panel, ok := GrafanaPanels[serviceID]; ok {
+		return panel, true
+	}
+
+	panel, ok := GrafanaPanels[serviceIndex.Name(serviceID)]
+	return panel, ok
+}
+
+// grafanaPanelURLs monta a URL da render API (d-solo) e a do painel no
+// dashboard a partir do mapeamento uid/painel?variáveis
+func grafanaPanelURLs(panel string) (string, string, error) {
+	query := ""
+	if i := strings.Index(panel, "?"); i >= 0 {
+		panel, query = panel[:i], panel[i+1:]
+	}
+
+	parts := strings.SplitN(panel, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("painel `%s` inválido, use uid-do-dashboard/id-do-painel", panel)
+	}
+
+	values, err := neturl.ParseQuery(query)
+	if err != nil {
+		return "", "", fmt.Errorf("variáveis do painel `%s` inválidas: %s", panel, err)
+	}
+	values.Set("from", fmt.Sprintf("now-%dm", int(GrafanaPanelRange.Minutes())))
+	values.Set("to", "now")
+
+	base := strings.TrimSuffix(GrafanaURL, "/")
+	link := fmt.Sprintf("%s/d/%s/_?viewPanel=%s&%s", base, parts[0], parts[1], values.Encode())
+
+	values.Set("panelId", parts[1])
+	values.Set("width", "1000")
+	values.Set("height", "500")
+
+	// O fuso das mensagens, menos o Local, que o Grafana não conhece
+	if values.Get("tz") == "" && MessagesTimezone.String() != "Local" {
+		values.Set("tz", MessagesTimezone.String())
+	}
+
+	return fmt.Sprintf("%s/render/d-solo/%s/_?%s", base, parts[0], values.Encode()), link, nil
+}
+
+// RenderGrafanaPanel baixa a imagem (PNG) do painel pela render API do Grafana
+func RenderGrafanaPanel(renderURL string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, renderURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(botContext)
+
+	if GrafanaAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+GrafanaAPIKey)
+	}
+
+	resp, err := externalHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sem o plugin de render o Grafana responde com uma página de erro
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+		return nil, fmt.Errorf("a render API do Grafana respondeu %d (%s), verifique o plugin grafana-image-renderer", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	return content, nil
+}
+
+// postGrafanaPanel envia no canal a imagem do painel do Grafana do serviço,
+// quando ele está no GRAFANA_PANELS. Os erros vão só para o log, a imagem é
+// um complemento da mensagem
+func postGrafanaPanel(channel string, serviceID string) {
+	panel, ok := grafanaPanelFor(serviceID)
+	if !ok {
+		return
+	}
+
+	renderURL, link, err := grafanaPanelURLs(panel)
+	if err != nil {
+		CheckErr("Erro no painel do Grafana do serviço "+serviceID, err)
+		return
+	}
+
+	image, err := RenderGrafanaPanel(renderURL)
+	if err != nil {
+		CheckErr("Erro ao buscar a imagem do painel do Grafana do serviço "+serviceID, err)
+		return
+	}
+
+	name := serviceIndex.Name(serviceID)
+	_, err = getAPIConnection().client.UploadFile(slack.FileUploadParameters{
+		Reader:         bytes.NewReader(image),
+		Filetype:       "png",
+		Filename:       fmt.Sprintf("grafana-%s.png", name),
+		Title:          fmt.Sprintf("Grafana: %s (últimos %s)", name, formatDuration(GrafanaPanelRange)),
+		InitialComment: fmt.Sprintf(":chart_with_upwards_trend: <%s|Painel do serviço `%s` no Grafana>", link, name),
+		Channels:       []string{channel},
+	})
+	if err != nil {
+		CheckErr("Erro ao enviar a imagem do painel do Grafana do serviço "+serviceID, err)
+		return
+	}
+
+	log.Printf("[INFO] Painel do Grafana do serviço %s enviado no canal %s\n", serviceID, channel)
+}
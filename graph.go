@@ -0,0 +1,329 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-graphviz"
+	"github.com/goccy/go-graphviz/cgraph"
+	"github.com/nlopes/slack"
+)
+
+// graphEdge é uma dependência entre dois serviços: um link (com o alias) ou
+// uma regra de um LoadBalancer (com as portas)
+type graphEdge struct {
+	From   string
+	To     string
+	Labels []string
+	LB     bool
+}
+
+// ServiceGraph são os serviços da stack, os serviços de outras stacks
+// ligados a eles e as dependências entre eles
+type ServiceGraph struct {
+	Stack    string
+	Services map[string]Service
+	External map[string]bool
+	Edges    []*graphEdge
+
+	stackNames map[string]string
+}
+
+// nodeName é o nome do serviço no grafo, com a stack nos serviços externos
+func (g *ServiceGraph) nodeName(ID string) string {
+	service := g.Services[ID]
+	if g.External[ID] {
+		return g.stackNames[service.StackID] + "/" + service.Name
+	}
+
+	return service.Name
+}
+
+// Dependents são os serviços que dependem do serviço, direta ou indiretamente
+func (g *ServiceGraph) Dependents(ID string) []string {
+	seen := map[string]bool{ID: true}
+	queue := []string{ID}
+	var names []string
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, edge := range g.Edges {
+			if edge.To == current && !seen[edge.From] {
+				seen[edge.From] = true
+				queue = append(queue, edge.From)
+				names = append(names, g.nodeName(edge.From))
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// BuildServiceGraph monta o grafo da stack pelos links dos serviços
+// (linkedServices) e pelas regras dos LoadBalancers (portRules), incluindo os
+// serviços de outras stacks que dependem da stack ou dos quais ela depende
+func BuildServiceGraph(stackName string) (*ServiceGraph, error) {
+	stacks, err := rancherListener.ListStacks()
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &ServiceGraph{Stack: stackName, Services: map[string]Service{}, External: map[string]bool{}, stackNames: map[string]string{}}
+
+	stackID := ""
+	for _, stack := range stacks {
+		graph.stackNames[stack.ID] = stack.Name
+		if stack.Name == stackName {
+			stackID = stack.ID
+		}
+	}
+	if stackID == "" {
+		return nil, fmt.Errorf("stack `%s` não encontrada", stackName)
+	}
+
+	services, err := rancherListener.ListServices()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[string]Service{}
+	for _, service := range services {
+		byID[service.ID] = service
+		if service.StackID == stackID {
+			graph.Services[service.ID] = service
+		}
+	}
+
+	edges := map[string]*graphEdge{}
+	addEdge := func(from Service, toID string, label string, lb bool) {
+		to, ok := byID[toID]
+		if !ok || (from.StackID != stackID && to.StackID != stackID) {
+			return
+		}
+
+		for _, service := range []Service{from, to} {
+			if service.StackID != stackID {
+				graph.Services[service.ID] = service
+				graph.External[service.ID] = true
+			}
+		}
+
+		key := from.ID + ">" + toID
+		edge, ok := edges[key]
+		if !ok {
+			edge = &graphEdge{From: from.ID, To: toID, LB: lb}
+			edges[key] = edge
+			graph.Edges = append(graph.Edges, edge)
+		}
+		if label != "" && !containsString(edge.Labels, label) {
+			edge.Labels = append(edge.Labels, label)
+		}
+	}
+
+	for _, service := range services {
+		for alias, target := range service.LinkedServices {
+			if alias == byID[target].Name {
+				alias = ""
+			}
+			addEdge(service, target, alias, false)
+		}
+
+		for _, rule := range service.LbConfig.PortRules {
+			label := fmt.Sprintf(":%d", rule.SourcePort)
+			if rule.Hostname != "" || rule.Path != "" {
+				label = fmt.Sprintf("%s%s%s", rule.Hostname, rule.Path, label)
+			}
+			addEdge(service, rule.ServiceID, label, true)
+		}
+	}
+
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		a, b := graph.Edges[i], graph.Edges[j]
+		if a.From != b.From {
+			return graph.nodeName(a.From) < graph.nodeName(b.From)
+		}
+		return graph.nodeName(a.To) < graph.nodeName(b.To)
+	})
+
+	return graph, nil
+}
+
+// graphHealthColor é a cor do serviço no grafo, pela saúde
+func graphHealthColor(service Service) string {
+	switch {
+	case service.State != "active":
+		return "#e0e0e0"
+	case service.HealthState == "healthy":
+		return "#c8e6c9"
+	case service.HealthState == "unhealthy":
+		return "#ffcdd2"
+	}
+
+	return "#fff9c4"
+}
+
+// RenderServiceGraph desenha o grafo em PNG com o graphviz, da esquerda (quem
+// depende) para a direita. Os LoadBalancers são elipses e os serviços de
+// outras stacks ficam tracejados
+func RenderServiceGraph(graph *ServiceGraph) ([]byte, error) {
+	ctx := context.Background()
+
+	g, err := graphviz.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer g.Close()
+
+	dot, err := g.Graph()
+	if err != nil {
+		return nil, err
+	}
+	defer dot.Close()
+
+	dot.SetRankDir(cgraph.LRRank)
+	dot.SetLabel("Stack " + graph.Stack)
+
+	var IDs []string
+	for ID := range graph.Services {
+		IDs = append(IDs, ID)
+	}
+	sort.Slice(IDs, func(i, j int) bool { return graph.nodeName(IDs[i]) < graph.nodeName(IDs[j]) })
+
+	nodes := map[string]*cgraph.Node{}
+	for _, ID := range IDs {
+		service := graph.Services[ID]
+
+		node, err := dot.CreateNodeByName(graph.nodeName(ID))
+		if err != nil {
+			return nil, err
+		}
+		node.SetLabel(fmt.Sprintf("%s\n%d/%d", graph.nodeName(ID), service.CurrentScale, service.Scale))
+		node.SetShape(cgraph.BoxShape)
+		if service.Type == "loadBalancerService" {
+			node.SetShape(cgraph.EllipseShape)
+		}
+
+		if graph.External[ID] {
+			node.SetStyle(cgraph.DashedNodeStyle)
+		} else {
+			node.SetStyle(cgraph.FilledNodeStyle)
+			node.SetFillColor(graphHealthColor(service))
+		}
+
+		nodes[ID] = node
+	}
+
+	for i, edge := range graph.Edges {
+		e, err := dot.CreateEdgeByName(fmt.Sprintf("e%d", i), nodes[edge.From], nodes[edge.To])
+		if err != nil {
+			return nil, err
+		}
+		e.SetLabel(strings.Join(edge.Labels, "\n"))
+		if edge.LB {
+			e.SetStyle(cgraph.BoldEdgeStyle)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := g.Render(ctx, dot, graphviz.PNG, &buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// graphSummary lista os serviços da stack com dependentes, os mais
+// dependidos primeiro, para conferir antes de um restart
+func graphSummary(graph *ServiceGraph) string {
+	type dependents struct {
+		Name  string
+		Names []string
+	}
+
+	var list []dependents
+	for ID := range graph.Services {
+		if graph.External[ID] {
+			continue
+		}
+		if names := graph.Dependents(ID); len(names) > 0 {
+			list = append(list, dependents{Name: graph.nodeName(ID), Names: names})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if len(list[i].Names) != len(list[j].Names) {
+			return len(list[i].Names) > len(list[j].Names)
+		}
+		return list[i].Name < list[j].Name
+	})
+
+	var lines []string
+	for i, item := range list {
+		if i == digestListSize {
+			lines = append(lines, fmt.Sprintf("e mais %d", len(list)-digestListSize))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("`%s` ← %s", item.Name, strings.Join(item.Names, ", ")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// slackServiceGraph envia a imagem com o grafo de dependências da stack
+func (s *SlackListener) slackServiceGraph(ev *slack.MessageEvent) {
+	args := strings.Fields(ev.Msg.Text)
+	stack := args[2]
+
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", stackGraph), false))
+		return
+	}
+
+	graph, err := BuildServiceGraph(stack)
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(":x: "+err.Error(), false))
+		return
+	}
+
+	if len(graph.Edges) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Os %d serviços da stack `%s` não têm links nem LoadBalancers apontando para eles", len(graph.Services), stack), false))
+		return
+	}
+
+	image, err := RenderServiceGraph(graph)
+	if err != nil {
+		CheckErr("Erro ao desenhar o grafo da stack "+stack, err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao desenhar o grafo da stack `%s`: %s", stack, err), false))
+		return
+	}
+
+	comment := fmt.Sprintf(":spider_web: Dependências da stack `%s`: %d serviços, %d ligações. Tracejados são de outras stacks e as setas em negrito são dos LoadBalancers", stack, len(graph.Services)-len(graph.External), len(graph.Edges))
+	if summary := graphSummary(graph); summary != "" {
+		comment += "\n*Quem depende de quem:*\n" + summary
+	}
+
+	_, err = s.client.UploadFile(slack.FileUploadParameters{
+		Reader:         bytes.NewReader(image),
+		Filetype:       "png",
+		Filename:       fmt.Sprintf("graph-%s.png", stack),
+		Title:          "Grafo da stack " + stack,
+		InitialComment: comment,
+		Channels:       []string{ev.Channel},
+	})
+	if err != nil {
+		CheckErr("Erro ao enviar o grafo da stack "+stack, err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao enviar o grafo da stack `%s`: %s", stack, err), false))
+		return
+	}
+
+	log.Printf("[INFO] Grafo da stack %s enviado (%d serviços, %d ligações)\n", stack, len(graph.Services), len(graph.Edges))
+}
@@ -0,0 +1,275 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+// As mensagens e o serviço (controlplane.pb.go e controlplane_grpc.pb.go) são
+// gerados do proto/controlplane.proto com o protoc-gen-go e o
+// protoc-gen-go-grpc. Depois de alterar o proto rode o go generate
+//go:generate protoc --go_out=. --go_opt=module=github.com/pulberg/slack-bot --go-grpc_out=. --go-grpc_opt=module=github.com/pulberg/slack-bot proto/controlplane.proto
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+const (
+	auditSourceGRPC = "grpc"
+
+	// grpcJobPollInterval é o intervalo entre as verificações do status do
+	// job no StreamJobStatus
+	grpcJobPollInterval = time.Second
+)
+
+var (
+	// GRPCPort é a porta da API gRPC (proto/controlplane.proto). Vazio
+	// desliga a API
+	GRPCPort string
+
+	// GRPCTLSCert e GRPCTLSKey são o certificado e a chave do servidor gRPC
+	GRPCTLSCert string
+	GRPCTLSKey  string
+
+	// GRPCClientCA é a CA dos certificados aceitos dos clientes (mTLS)
+	GRPCClientCA string
+
+	// GRPCAllowedClients são os CNs dos certificados dos clientes aceitos.
+	// Vazio aceita qualquer certificado assinado pela GRPCClientCA
+	GRPCAllowedClients []string
+)
+
+// controlPlane é a implementação do ControlPlaneServer, usando o mesmo
+// executor da API admin (ExecuteRemoteCommand)
+type controlPlane struct {
+	UnimplementedControlPlaneServer
+}
+
+var grpcServer *grpc.Server
+
+// StartGRPCServer inicia a API gRPC com mTLS, quando o GRPC_PORT está
+// configurado. Sem os certificados a API não é iniciada
+func StartGRPCServer() {
+	if GRPCPort == "" {
+		return
+	}
+
+	tlsConfig, err := grpcTLSConfig()
+	if err != nil {
+		CheckErr("Erro ao carregar os certificados da API gRPC, API desligada", err)
+		return
+	}
+
+	listener, err := net.Listen("tcp", ":"+GRPCPort)
+	if err != nil {
+		CheckErr("Erro ao abrir a porta da API gRPC", err)
+		return
+	}
+
+	grpcServer = grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	RegisterControlPlaneServer(grpcServer, controlPlane{})
+
+	log.Printf("[INFO] API gRPC rodando na porta: %s\n", GRPCPort)
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			CheckErr("Erro na API gRPC", err)
+		}
+	}()
+}
+
+// StopGRPCServer espera as chamadas em andamento terminarem (até o ctx) e
+// desliga a API gRPC
+func StopGRPCServer(ctx context.Context) {
+	if grpcServer == nil {
+		return
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+	}
+}
+
+// grpcTLSConfig monta o TLS do servidor exigindo o certificado do cliente
+// assinado pela GRPCClientCA
+func grpcTLSConfig() (*tls.Config, error) {
+	if GRPCTLSCert == "" || GRPCTLSKey == "" || GRPCClientCA == "" {
+		return nil, errors.New("GRPC_TLS_CERT, GRPC_TLS_KEY e GRPC_CLIENT_CA são obrigatórios")
+	}
+
+	cert, err := tls.LoadX509KeyPair(GRPCTLSCert, GRPCTLSKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := ioutil.ReadFile(GRPCClientCA)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("nenhum certificado encontrado em %s", GRPCClientCA)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// grpcClient retorna o CN do certificado do cliente, recusando os CNs fora
+// do GRPCAllowedClients
+func grpcClient(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", grpcstatus.Error(codes.Unauthenticated, "cliente sem certificado")
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", grpcstatus.Error(codes.Unauthenticated, "cliente sem certificado")
+	}
+
+	client := info.State.VerifiedChains[0][0].Subject.CommonName
+	if len(GRPCAllowedClients) > 0 && !containsString(GRPCAllowedClients, client) {
+		log.Printf("[INFO] Cliente %s recusado na API gRPC\n", client)
+		return "", grpcstatus.Errorf(codes.PermissionDenied, "cliente %s sem permissão", client)
+	}
+
+	return client, nil
+}
+
+// grpcJobStatus converte o job para a mensagem do gRPC
+func grpcJobStatus(job *Job) *JobStatus {
+	j := adminJobFrom(job)
+
+	updatedAt := j.CreatedAt
+	if !j.FinishedAt.IsZero() {
+		updatedAt = j.FinishedAt
+	}
+
+	return &JobStatus{
+		JobId:     int64(j.ID),
+		Name:      j.Name,
+		User:      j.User,
+		Status:    j.Status,
+		Error:     j.Error,
+		Finished:  j.Status == jobDone || j.Status == jobFailed || j.Status == jobCanceled,
+		UpdatedAt: updatedAt.Unix(),
+	}
+}
+
+func (controlPlane) ExecuteCommand(ctx context.Context, req *ExecuteCommandRequest) (*JobStatus, error) {
+	client, err := grpcClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user := client
+	if req.User != "" {
+		user = fmt.Sprintf("%s (%s)", req.User, client)
+	}
+
+	job, err := ExecuteRemoteCommand(RemoteCommand{
+		Command: req.Command,
+		Args:    req.Args,
+		Env:     req.Env,
+		User:    user,
+		Source:  auditSourceGRPC,
+	})
+	if err != nil {
+		code := codes.Unavailable
+		if _, invalid := err.(*InvalidArgsError); invalid {
+			code = codes.InvalidArgument
+		} else if err == ErrMaintenance {
+			code = codes.FailedPrecondition
+		}
+
+		return nil, grpcstatus.Error(code, err.Error())
+	}
+
+	return grpcJobStatus(job), nil
+}
+
+func (controlPlane) StreamJobStatus(req *StreamJobStatusRequest, stream ControlPlane_StreamJobStatusServer) error {
+	if _, err := grpcClient(stream.Context()); err != nil {
+		return err
+	}
+
+	var last string
+	for {
+		job, ok := FindJob(int(req.JobId))
+		if !ok {
+			return grpcstatus.Errorf(codes.NotFound, "job #%d não encontrado", req.JobId)
+		}
+
+		current := grpcJobStatus(job)
+		if current.Status != last {
+			if err := stream.Send(current); err != nil {
+				return err
+			}
+			last = current.Status
+		}
+
+		if current.Finished {
+			return nil
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-time.After(grpcJobPollInterval):
+		}
+	}
+}
+
+func (controlPlane) QueryAudit(ctx context.Context, req *QueryAuditRequest) (*QueryAuditResponse, error) {
+	if _, err := grpcClient(ctx); err != nil {
+		return nil, err
+	}
+
+	filter := AuditFilter{User: req.User, Action: req.Action, Source: req.Source, Limit: int(req.Limit)}
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	if req.SinceSeconds > 0 {
+		filter.Since = time.Now().Add(-time.Duration(req.SinceSeconds) * time.Second)
+	}
+
+	resp := &QueryAuditResponse{}
+	for _, entry := range QueryAudit(filter) {
+		resp.Entries = append(resp.Entries, &AuditRecord{
+			At:      entry.At.Unix(),
+			Source:  entry.Source,
+			User:    entry.User,
+			Action:  entry.Action,
+			Value:   entry.Value,
+			Channel: entry.Channel,
+			Status:  int32(entry.Status),
+		})
+	}
+
+	return resp, nil
+}
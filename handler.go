@@ -3,185 +3,392 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"net/url"
-	"time"
+	"sync"
 
 	"github.com/nlopes/slack"
-	"github.com/tidwall/gjson"
 )
 
-type interactionHandler struct {
-	slackClient       *slack.Client
-	verificationToken string
-}
-
 const (
-	actionSelect = "select"
-	actionCancel = "cancel"
+	actionSelect         = "select"
+	actionCancel         = "cancel"
+	actionServiceInfo    = "service-info"
+	actionServiceRestart = "service-restart"
 )
 
-func (h interactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		log.Printf("[ERROR] Invalid method: %s", r.Method)
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
+// DialogSubmission é o envio de um dialog aberto pelo BOT
+type DialogSubmission struct {
+	CallbackID string            `json:"callback_id"`
+	State      string            `json:"state"`
+	User       slack.User        `json:"user"`
+	Channel    slack.Channel     `json:"channel"`
+	Submission map[string]string `json:"submission"`
+}
 
-	buf, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("[ERROR] Failed to read request body: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+// newInteractionDispatcher cria o Dispatcher das interações do Slack com os
+// middlewares e o handler de cada ação
+func newInteractionDispatcher(verificationToken string) *Dispatcher {
+	d := NewDispatcher()
+
+	d.Use(
+		RecoverMiddleware,
+		VerifyMiddleware(verificationToken),
+		SandboxRecordMiddleware,
+		MetricsMiddleware,
+		AuditMiddleware,
+		RateLimitMiddleware,
+		RBACMiddleware,
+		TenantMiddleware,
+		MaintenanceMiddleware,
+		RecentMiddleware,
+		EscalationMiddleware,
+		QuotaMiddleware,
+	)
+
+	d.HandleSelect(restartContainer, actionRestartContainerFunction)
+	d.HandleSelect(restartContainerDrain, actionDrainRestartContainerFunction)
+	d.HandleSelect(logsContainer, actionLogsContainerFunction)
+	d.HandleSelect(streamLogs, actionStreamLogs)
+	d.HandleSelect(serviceLogs, actionServiceLogs)
+	d.HandleSelect(getServiceInfo, actionGetServiceInfo)
+	d.HandleSelect(canaryActivate, actionEnableCanary)
+	d.HandleSelect(canaryDisable, actionDisableCanary)
+	d.HandleSelect(canaryInfo, actionInfoCanary)
+	d.HandleSelect(jenkinsBuild, actionJenkinsBuild)
+	d.HandleSelect(scanService, actionScanService)
+	d.HandleSelect(restartService, actionRestartServiceSelect)
+	d.HandleSelect(inspectContainer, actionInspectFunction)
+
+	d.HandleAction(actionServiceInfo, actionServiceInfoFunction)
+	d.HandleAction(actionServiceRestart, actionServiceRestartFunction)
+	d.HandleAction(actionPagerDutyAck, actionPagerDutyFunction)
+	d.HandleAction(actionPagerDutyResolve, actionPagerDutyFunction)
+	d.HandleAction(actionOpsgenieAck, actionOpsgenieFunction)
+	d.HandleAction(actionOpsgenieClose, actionOpsgenieFunction)
+	d.HandleAction(actionRegistryUpgrade, actionRegistryUpgradeFunction)
+	d.HandleAction(actionHostEvacuate, actionHostEvacuateFunction)
+	d.HandleAction(actionCrashLoopStop, actionCrashLoopStopFunction)
+	d.HandleAction(actionTerraformApply, actionTerraformApplyFunction)
+	d.HandleAction(actionTerraformDiscard, actionTerraformDiscardFunction)
+	d.HandleAction(actionOpenIncident, actionOpenIncidentFunction)
+	d.HandleAction(actionJiraTicket, actionJiraTicketFunction)
+	d.HandleAction(actionAlertAck, actionAlertAckFunction)
+	d.HandleAction(actionAlertSilence, actionAlertSilenceFunction)
+	d.HandleAction(actionAlertSilenceCustom, actionAlertSilenceCustomFunction)
+	d.HandleAction(actionSilenceExpire, actionSilenceExpireFunction)
+	d.HandleAction(actionAlertLogs, actionAlertLogsFunction)
+	d.HandleAction(actionAlertRestart, actionAlertRestartFunction)
+	d.HandleAction(actionLogsRange, actionLogsContainerFunction)
+	d.HandleAction(actionStopStream, actionStopStreamFunction)
+	d.HandleAction(actionUndo, actionUndoFunction)
+	d.HandleAction(actionCancel, actionCancelFunction)
+	d.HandleAction(actionHelp, actionHelpFunction)
+	d.HandleAction(actionFindServiceLogs, actionFindServiceLogsFunction)
+	d.HandleAction(actionFindStackServices, actionFindStackServicesFunction)
+	d.HandleAction(actionContainerRestart, actionContainerRestartFunction)
+	d.HandleAction(actionIntentRun, actionIntentRunFunction)
+	d.HandleAction(actionBatchSelect, actionBatchSelectFunction)
+	d.HandleAction(actionBatchRun, actionBatchRunFunction)
+	d.HandleAction(actionBatchCancel, actionBatchCancelFunction)
+	d.HandleAction(actionJobCancel, actionJobCancelFunction)
+	d.HandleAction(actionStatusRefresh, actionStatusRefreshFunction)
+	d.HandleAction(actionRecentSelect, actionRecentSelectFunction)
+	d.HandleAction(actionWizardService, actionWizardServiceFunction)
+	d.HandleAction(actionWizardTag, actionWizardTagFunction)
+	d.HandleAction(actionWizardStrategy, actionWizardStrategyFunction)
+	d.HandleAction(actionWizardConfirm, actionWizardConfirmFunction)
+	d.HandleAction(actionWizardBack, actionWizardBackFunction)
+	d.HandleAction(actionWizardCancel, actionWizardCancelFunction)
+	d.HandleAction(actionWizardScan, actionWizardScanFunction)
+	d.HandleAction(actionCanaryConfig, actionCanaryConfigFunction)
+	d.HandleAction(actionBlueGreenSwitch, actionBlueGreenSwitchFunction)
+	d.HandleAction(actionBlueGreenSwitchBack, actionBlueGreenSwitchBackFunction)
+	d.HandleAction(actionBlueGreenCleanup, actionBlueGreenCleanupFunction)
+	d.HandleAction(actionBlueGreenCancel, actionBlueGreenCancelFunction)
+	d.HandleAction(actionABNew, actionABNewFunction)
+	d.HandleAction(actionABApply, actionABApplyFunction)
+	d.HandleAction(actionABDiscard, actionABDiscardFunction)
+	d.HandleAction(actionABRemove, actionABRemoveFunction)
+	d.HandleAction(actionImageGCApply, actionImageGCApplyFunction)
+	d.HandleAction(actionImageGCDiscard, actionImageGCDiscardFunction)
+	d.HandleAction(actionInspectJSON, actionInspectJSONFunction)
+	d.HandleAction(actionComposeDeploy, actionComposeDeployFunction)
+	d.HandleAction(actionComposeDiscard, actionComposeDiscardFunction)
+	d.HandleAction(actionSnapshotRestore, actionSnapshotRestoreFunction)
+	d.HandleAction(actionSnapshotDiscard, actionSnapshotDiscardFunction)
+	d.HandleAction(actionCloneApply, actionCloneApplyFunction)
+	d.HandleAction(actionCloneEdit, actionCloneEditFunction)
+	d.HandleAction(actionCloneDiscard, actionCloneDiscardFunction)
+
+	return d
+}
 
-	jsonStr, err := url.QueryUnescape(string(buf)[8:])
-	if err != nil {
-		log.Printf("[ERROR] Failed to unespace request body: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+func actionCancelFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	title := fmt.Sprintf(":x: @%s cancelou a requisição", message.User.Name)
+	responseMessage(w, message.OriginalMessage, title, "")
+	getAPIConnection().client.DeleteMessage(message.Channel.ID, message.MessageTs)
+}
 
-	var message slack.AttachmentActionCallback
-	if err := json.Unmarshal([]byte(jsonStr), &message); err != nil {
-		log.Printf("[ERROR] Failed to decode json message from slack: %s", jsonStr)
+func handleDialogSubmission(jsonStr string, w http.ResponseWriter) {
+	var submission DialogSubmission
+	if err := json.Unmarshal([]byte(jsonStr), &submission); err != nil {
+		log.Printf("[ERROR] Failed to decode dialog submission from slack: %s", jsonStr)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	// Only accept message from slack with valid token
-	if message.Token != h.verificationToken {
-		log.Printf("[ERROR] Invalid token: %s", message.Token)
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	action := message.Actions[0]
-	switch action.Name {
-	case actionSelect:
-		switch message.CallbackID {
-		case restartContainer:
-			actionRestartContainerFunction(message, w)
-		case logsContainer:
-			actionLogsContainerFunction(message, w)
-		case getServiceInfo:
-			actionGetServiceInfo(message, w)
-		case canaryActivate:
-			actionEnableCanary(message, w)
-		case canaryDisable:
-			actionDisableCanary(message, w)
-		case canaryInfo:
-			actionInfoCanary(message, w)
-		default:
-			return
-		}
-	case actionCancel:
-		title := fmt.Sprintf(":x: @%s cancelou a requisição", message.User.Name)
-		responseMessage(w, message.OriginalMessage, title, "")
-		getAPIConnection().client.DeleteMessage(message.Channel.ID, message.MessageTs)
+	switch submission.CallbackID {
+	case jiraDialogCallback:
+		jiraDialogSubmission(submission, w)
+	case jenkinsDialogCallback:
+		jenkinsDialogSubmission(submission, w)
+	case abDialogCallback:
+		abDialogSubmission(submission, w)
+	case cloneDialogCallback:
+		cloneDialogSubmission(submission, w)
+	case silenceDialogCallback:
+		silenceDialogSubmission(submission, w)
 	default:
-		log.Printf("[ERROR] Ação inválida: %s", action.Name)
+		log.Printf("[ERROR] Dialog inválido: %s", submission.CallbackID)
 		w.WriteHeader(http.StatusInternalServerError)
-		return
 	}
 }
 
 func actionInfoCanary(message slack.AttachmentActionCallback, w http.ResponseWriter) {
 	value := message.Actions[0].SelectedOptions[0].Value
-	resp := rancherListener.GetHaproxyCfg(value)
-
-	lbConfig := gjson.Get(resp, "lbConfig.config").String()
+	lbConfig := interactionRancher(w).HaproxyConfig(value)
 
 	msg := fmt.Sprintf("Arquivo haproxy.cfg do LoadBalancer `%s`.\n```%s```", value, lbConfig)
 
 	sendMessage(msg)
 
-	getAPIConnection().client.DeleteMessage(message.Channel.ID, message.MessageTs)
+	getAPIConnection().client.DeleteMessageContext(interactionContext(w), message.Channel.ID, message.MessageTs)
 }
 
 func actionDisableCanary(message slack.AttachmentActionCallback, w http.ResponseWriter) {
-	value := message.Actions[0].SelectedOptions[0].Value
-	resp := rancherListener.DisableCanary(value)
+	value := selectedValue(message)
+	channel, ts := message.Channel.ID, message.MessageTs
 
-	msg := fmt.Sprintf("*Canary Deployment* do LB `%s` desativado.\n```%s```", value, resp)
+	job, err := EnqueueJob("desativar canary do LB "+value, message.User.Name, func() error {
+		if err := disableCanaryFunction(value); err != nil {
+			return err
+		}
 
-	sendMessage(msg)
+		getAPIConnection().client.DeleteMessage(channel, ts)
+		return nil
+	})
 
-	getAPIConnection().client.DeleteMessage(message.Channel.ID, message.MessageTs)
+	interactionJob(w, job, err)
+	responseMessage(w, message.OriginalMessage, queuedJobMessage(job, err), "")
+}
+
+// disableCanaryFunction desativa o Canary do LB, avisando no canal com o
+// botão de desfazer
+func disableCanaryFunction(lbID string) error {
+	resp := rancherListener.DisableCanary(lbID)
+	if resp == "error" {
+		return diagnoseCanaryError(lbID, canaryDisable)
+	}
+
+	msg := fmt.Sprintf("*Canary Deployment* do LB `%s` desativado.\n```%s```", lbID, resp)
+
+	sendMessageWithUndo(msg, undoCanaryDisable(lbID))
+
+	return nil
 }
 
 func actionEnableCanary(message slack.AttachmentActionCallback, w http.ResponseWriter) {
-	value := message.Actions[0].SelectedOptions[0].Value
-	resp := rancherListener.EnableCanary(value)
+	value := selectedValue(message)
+	channel, ts := message.Channel.ID, message.MessageTs
 
-	msg := fmt.Sprintf("*Canary Deployment* do LB `%s` ativado.\n```%s```", value, resp)
+	job, err := EnqueueJob("ativar canary do LB "+value, message.User.Name, func() error {
+		if err := enableCanaryFunction(value); err != nil {
+			return err
+		}
 
-	sendMessage(msg)
+		getAPIConnection().client.DeleteMessage(channel, ts)
+		return nil
+	})
 
-	getAPIConnection().client.DeleteMessage(message.Channel.ID, message.MessageTs)
+	interactionJob(w, job, err)
+	responseMessage(w, message.OriginalMessage, queuedJobMessage(job, err), "")
+}
+
+// enableCanaryFunction ativa o Canary do LB, avisando no canal com o botão
+// de desfazer
+func enableCanaryFunction(lbID string) error {
+	resp := rancherListener.EnableCanary(lbID)
+	if resp == "error" {
+		return diagnoseCanaryError(lbID, canaryActivate)
+	}
+
+	msg := fmt.Sprintf("*Canary Deployment* do LB `%s` ativado.\n```%s```", lbID, resp)
+
+	sendMessageWithUndo(msg, undoCanaryEnable(lbID))
+
+	return nil
 }
 
 func actionGetServiceInfo(message slack.AttachmentActionCallback, w http.ResponseWriter) {
 	value := message.Actions[0].SelectedOptions[0].Value
-	resp := rancherListener.GetService(value)
 
-	idService := gjson.Get(resp, "id").String()
-	nameService := gjson.Get(resp, "name").String()
-	imageService := gjson.Get(resp, "launchConfig.imageUuid").String()
-	stateService := gjson.Get(resp, "state").String()
-	createdDateService := gjson.Get(resp, "created").String()
+	sendMessage(serviceInfoMessage(value))
+	go postGrafanaPanel(getAPIConnection().channelID, value)
 
-	msg := fmt.Sprintf("*ID:* `%s`\n*Nome:* `%s`\n*Imagem:* `%s`\n*Status:* `%s`\n*Data de Criação:* `%s`", idService, nameService, imageService, stateService, createdDateService)
+	getAPIConnection().client.DeleteMessageContext(interactionContext(w), message.Channel.ID, message.MessageTs)
+}
 
-	sendMessage(msg)
+// serviceInfoMessage monta a mensagem com as informações do serviço
+func serviceInfoMessage(serviceID string) string {
+	service, err := orchestrator.GetService(serviceID)
+	if err != nil {
+		CheckErr("Erro ao buscar o serviço", err)
+		return fmt.Sprintf("Erro ao buscar o serviço `%s`: %s", serviceID, err)
+	}
 
-	getAPIConnection().client.DeleteMessage(message.Channel.ID, message.MessageTs)
+	return fmt.Sprintf("*ID:* `%s`\n*Nome:* `%s`\n*Imagem:* `%s`\n*Status:* `%s`\n*Instâncias:* `%s`\n*Data de Criação:* %s", service.ID, service.Name, service.Image, service.State, formatReplicas(service), formatTimestamp(service.Created))
+}
+
+// serviceQuickActions cria os botões de informações e restart de um serviço,
+// usados nas mensagens de alertas
+func serviceQuickActions(serviceID string) []slack.AttachmentAction {
+	return []slack.AttachmentAction{
+		{
+			Name:  actionServiceInfo,
+			Text:  "Info do serviço",
+			Type:  "button",
+			Value: serviceID,
+		},
+		{
+			Name:  actionServiceRestart,
+			Text:  "Reiniciar serviço",
+			Type:  "button",
+			Style: "danger",
+			Value: serviceID,
+			Confirm: &slack.ConfirmationField{
+				Title:       "Tem certeza disso?",
+				Text:        fmt.Sprintf("Deseja mesmo reiniciar todos os containers do serviço %s? :thinking_face:", serviceID),
+				OkText:      "Sim",
+				DismissText: "Não",
+			},
+		},
+	}
+}
+
+// alertActions retorna os botões comuns às mensagens de alerta: criar ticket
+// no Jira (caso configurado) e abrir incidente
+func alertActions(serviceID string) []slack.AttachmentAction {
+	var actions []slack.AttachmentAction
+	if JiraEnabled() {
+		actions = append(actions, jiraTicketAction())
+	}
+
+	return append(actions, openIncidentAction(serviceID))
+}
+
+func actionServiceInfoFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	sendMessage(serviceInfoMessage(message.Actions[0].Value))
+	go postGrafanaPanel(getAPIConnection().channelID, message.Actions[0].Value)
+}
+
+func actionServiceRestartFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	serviceID, user := message.Actions[0].Value, message.User.Name
+
+	job, err := EnqueueJob("restart do serviço "+serviceID, user, func() error {
+		return restartServiceFunction(serviceID, user)
+	})
+	interactionJob(w, job, err)
+	if err != nil {
+		sendMessage(queuedJobMessage(job, err))
+	}
+}
+
+func actionRestartServiceSelect(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	serviceID, user := selectedValue(message), message.User.Name
+	channel, ts := message.Channel.ID, message.MessageTs
+
+	job, err := EnqueueJob("restart do serviço "+serviceID, user, func() error {
+		defer getAPIConnection().client.DeleteMessage(channel, ts)
+		return restartServiceFunction(serviceID, user)
+	})
+
+	interactionJob(w, job, err)
+	responseMessage(w, message.OriginalMessage, queuedJobMessage(job, err), "")
+}
+
+func restartServiceFunction(serviceID string, user string) error {
+	return restartServiceIn(orchestrator, serviceID, user)
+}
+
+// restartServiceIn é o restartServiceFunction no orquestrador de um ambiente
+func restartServiceIn(o Orchestrator, serviceID string, user string) error {
+	if err := o.RestartService(serviceID); err != nil {
+		err = fmt.Errorf("erro ao reiniciar o serviço %s: %s", serviceID, err)
+
+		// O diagnóstico e o botão de tentar de novo usam o ambiente atual
+		if o != orchestrator {
+			return err
+		}
+		return diagnoseServiceError(serviceID, restartService, retryAction(serviceID), err)
+	}
+
+	log.Printf("[INFO] Serviço %s reiniciado pelo usuário %s\n", serviceID, user)
+	RecordChange(ChangeEvent{Kind: "restart", ServiceID: serviceID, User: user})
+	sendMessage(fmt.Sprintf("Serviço `%s` reiniciado por @%s :arrows_counterclockwise:", serviceID, user))
+
+	return nil
 }
 
 func actionRestartContainerFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
 	value := message.Actions[0].SelectedOptions[0].Value
-	rancherListener.RestartContainer(value)
+	if err := interactionRancher(w).RestartContainer(value); err != nil {
+		CheckErr("Erro ao reiniciar o container "+value, err)
+		interactionFailed(w)
+		sendMessage(fmt.Sprintf(":x: Erro ao reiniciar o container `%s`: %s", value, err))
+		return
+	}
 
 	title := fmt.Sprintf("Container de ID %s restartado por @%s com sucesso! :sunglasses:\n\n", value, message.User.Name)
 	sendMessage(title)
 
-	getAPIConnection().client.DeleteMessage(message.Channel.ID, message.MessageTs)
+	getAPIConnection().client.DeleteMessageContext(interactionContext(w), message.Channel.ID, message.MessageTs)
 }
 
 func actionLogsContainerFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
-	value := message.Actions[0].SelectedOptions[0].Value
-	fileName := rancherListener.LogsContainer(value)
-
-	time.Sleep(2 * time.Second)
+	var value string
+	if message.Actions[0].Name == actionLogsRange {
+		value = message.Actions[0].Value
+	} else {
+		value = message.Actions[0].SelectedOptions[0].Value
+	}
 
-	api := getAPIConnection()
+	value, opts := DecodeLogsValue(value)
 
-	file, err := api.client.UploadFile(slack.FileUploadParameters{
-		File:     fileName,
-		Filetype: "text",
-		Channels: []string{
-			api.channelID,
-		},
-	})
-	CheckErr("Erro ao fazer upload de arquivo de logs de container", err)
+	// Caso não tenha sido informado quanto de log buscar, pergunta ao usuário
+	if opts.IsEmpty() {
+		originalMessage := message.OriginalMessage
+		originalMessage.Attachments = []slack.Attachment{logsRangeAttachment(value)}
 
-	originalMessage := message.OriginalMessage
-	originalMessage.Files = []slack.File{
-		{
-			ID:       file.ID,
-			Title:    fmt.Sprintf("Logs do container: %s", value),
-			Filetype: "text",
-		},
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(&originalMessage)
+		return
 	}
-	originalMessage.Attachments = []slack.Attachment{}
 
-	w.Header().Add("Content-type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(&originalMessage)
+	channel, ts := message.Channel.ID, message.MessageTs
 
-	getAPIConnection().client.DeleteMessage(message.Channel.ID, message.MessageTs)
+	job, err := EnqueueJob("logs do container "+value, message.User.Name, func() error {
+		if _, err := UploadContainerLogs(value, opts); err != nil {
+			return fmt.Errorf("erro ao enviar os logs do container %s: %s", value, err)
+		}
+
+		getAPIConnection().client.DeleteMessage(channel, ts)
+		return nil
+	})
+
+	interactionJob(w, job, err)
+	responseMessage(w, message.OriginalMessage, queuedJobMessage(job, err), "")
 }
 
 func responseMessage(w http.ResponseWriter, original slack.Message, title, value string) {
@@ -208,14 +415,33 @@ func sendMessage(message string) {
 	}))
 }
 
+func sendMessageWithUndo(message string, undoID string) {
+	conn := getAPIConnection()
+
+	conn.client.PostMessage(conn.channelID, slack.MsgOptionAttachments(undoAttachment(message, undoID)))
+}
+
+// slackAPI é o listener (e o client do Slack) compartilhado por todos os
+// handlers, definido no main antes do BOT iniciar
+var (
+	slackAPI     *SlackListener
+	slackAPIOnce sync.Once
+)
+
+// getAPIConnection retorna o listener compartilhado, criando um caso o main
+// ainda não tenha definido
 func getAPIConnection() *SlackListener {
-	c := slack.New(SlackBotToken)
+	slackAPIOnce.Do(func() {
+		if slackAPI != nil {
+			return
+		}
 
-	s := &SlackListener{
-		client:    c,
-		botID:     SlackBotID,
-		channelID: SlackBotChannel,
-	}
+		slackAPI = &SlackListener{
+			client:    CreateSlackClient(),
+			botID:     SlackBotID,
+			channelID: SlackBotChannel,
+		}
+	})
 
-	return s
+	return slackAPI
 }
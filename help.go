@@ -0,0 +1,168 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	actionHelp   = "help"
+	helpCallback = "help"
+)
+
+// commandPermissions retorna os usuários que podem usar o comando, vazio
+// quando todos podem. Vem das permissões do plugin ou do
+// INTERACTION_PERMISSIONS (os menus usam o nome do comando como callback_id)
+func commandPermissions(name string) []string {
+	if p, ok := pluginByName(name); ok {
+		return p.Permissions()
+	}
+
+	if allowed, ok := InteractionPermissions[name]; ok {
+		return strings.Split(allowed, "|")
+	}
+
+	return nil
+}
+
+// commandExample monta o exemplo de uso do comando
+func commandExample(cmd Command) string {
+	return strings.Replace(cmd.Usage, "comando", cmd.Cmd, 1)
+}
+
+func formatPermissions(permissions []string) string {
+	if len(permissions) == 0 {
+		return "todos"
+	}
+
+	return "`" + strings.Join(permissions, "`, `") + "`"
+}
+
+// HelpMessage é a lista dos comandos ativos com a descrição, o exemplo de uso
+// e quem pode usar, gerada a partir do Commands
+func HelpMessage() string {
+	msg := "*Comandos disponíveis:*\n"
+
+	for _, cmd := range Commands {
+		if !cmd.IsActive {
+			continue
+		}
+
+		msg += fmt.Sprintf("\n• `%s` %s\n      _Ex.: %s_", cmd.Cmd, cmd.Description, commandExample(cmd))
+
+		if permissions := commandPermissions(cmd.Cmd); len(permissions) > 0 {
+			msg += fmt.Sprintf(" :lock: %s", formatPermissions(permissions))
+		}
+	}
+
+	msg += fmt.Sprintf("\n\n_Use *@bot %s comando* para ver os detalhes de um comando._", actionHelp)
+
+	return msg
+}
+
+// CommandHelpMessage é a ajuda detalhada de um comando, vazio caso o comando
+// não exista
+func CommandHelpMessage(name string) string {
+	for _, cmd := range Commands {
+		if cmd.Cmd == name {
+			return fmt.Sprintf("*Comando:* `%s`\n*Descrição:* _%s_\n*Uso:* _%s_\n*Dica:* _%s_\n*Permissão:* %s", cmd.Cmd, cmd.Description, commandExample(cmd), cmd.Lint, formatPermissions(commandPermissions(cmd.Cmd)))
+		}
+	}
+
+	return ""
+}
+
+// helpAttachment é a mensagem com o botão de ajuda
+func helpAttachment(text string) slack.Attachment {
+	return slack.Attachment{
+		Text:       text,
+		Color:      "#0C648A",
+		CallbackID: helpCallback,
+		Actions: []slack.AttachmentAction{
+			{
+				Name:  actionHelp,
+				Text:  "Ajuda",
+				Type:  "button",
+				Style: "primary",
+			},
+		},
+	}
+}
+
+func (s *SlackListener) slackHelp(ev *slack.MessageEvent) {
+	args := strings.Fields(ev.Msg.Text)
+
+	msg := HelpMessage()
+	if len(args) > 2 {
+		if msg = CommandHelpMessage(strings.Join(args[2:], " ")); msg == "" {
+			msg = fmt.Sprintf("Comando `%s` não encontrado.", strings.Join(args[2:], " "))
+		}
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(msg, false))
+}
+
+// slackUnknownCommand avisa que o comando não existe, com o botão de ajuda
+func (s *SlackListener) slackUnknownCommand(ev *slack.MessageEvent, command string) {
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(helpAttachment(fmt.Sprintf("Comando `%s` não encontrado :thinking_face:", command))))
+}
+
+func actionHelpFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	respondWithoutActions(w, message.OriginalMessage, "", HelpMessage())
+}
+
+// SlashCommand é a rota do slash command do BOT (ex.: /rancher help). Por
+// enquanto responde apenas a ajuda, só para quem chamou
+func SlashCommand(w http.ResponseWriter, r *http.Request) {
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	form, err := url.ParseQuery(string(buf))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	valid := form.Get("token") == SlackBotVerificationToken
+	if SlackSigningSecret != "" {
+		valid = validSlackSignature(r, buf)
+	}
+
+	if !valid {
+		log.Printf("[ERROR] Slash command %s sem assinatura válida", form.Get("command"))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	args := strings.Fields(form.Get("text"))
+
+	text := HelpMessage()
+	if len(args) > 1 && args[0] == actionHelp {
+		if text = CommandHelpMessage(strings.Join(args[1:], " ")); text == "" {
+			text = fmt.Sprintf("Comando `%s` não encontrado.", strings.Join(args[1:], " "))
+		}
+	} else if len(args) > 0 && args[0] != actionHelp {
+		text = fmt.Sprintf("Use `@bot %s` no canal do BOT. ", strings.Join(args, " ")) + text
+	}
+
+	log.Printf("[INFO] Slash command %s %s do usuário %s\n", form.Get("command"), form.Get("text"), form.Get("user_name"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"response_type": "ephemeral",
+		"text":          text,
+	})
+}
@@ -0,0 +1,197 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+// HooksFile é o arquivo JSON com os webhooks genéricos recebidos em /hooks/{nome}
+var HooksFile string
+
+// Hook é a configuração de um webhook genérico. Os campos de texto são
+// templates onde {{caminho}} é trocado pelo valor do caminho (sintaxe do
+// gjson) no JSON recebido
+type Hook struct {
+	Token   string            `json:"token"`
+	Channel string            `json:"channel"`
+	When    string            `json:"when"`
+	Pretext string            `json:"pretext"`
+	Title   string            `json:"title"`
+	Link    string            `json:"link"`
+	Text    string            `json:"text"`
+	Color   string            `json:"color"`
+	Colors  map[string]string `json:"colors"`
+	Fields  []HookField       `json:"fields"`
+	Footer  string            `json:"footer"`
+	Items   string            `json:"items"`
+}
+
+// HookField é um campo do attachment de um webhook genérico
+type HookField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+var (
+	hooks = map[string]Hook{}
+
+	hookTemplateRegex = regexp.MustCompile(`{{\s*([^}]+?)\s*}}`)
+)
+
+// LoadHooks lê os webhooks genéricos do arquivo configurado
+func LoadHooks() {
+	hooks = map[string]Hook{}
+
+	if HooksFile == "" {
+		return
+	}
+
+	content, err := ioutil.ReadFile(HooksFile)
+	if err != nil {
+		CheckErr("Erro ao abrir o arquivo de webhooks", err)
+		return
+	}
+
+	if err := json.Unmarshal(content, &hooks); err != nil {
+		CheckErr("Erro ao ler o arquivo de webhooks", err)
+		return
+	}
+
+	log.Printf("[INFO] %d webhooks genéricos carregados\n", len(hooks))
+}
+
+// renderHookTemplate troca os {{caminho}} do template pelos valores do JSON
+func renderHookTemplate(template string, data gjson.Result) string {
+	return hookTemplateRegex.ReplaceAllStringFunc(template, func(match string) string {
+		path := hookTemplateRegex.FindStringSubmatch(match)[1]
+		return data.Get(path).String()
+	})
+}
+
+// hookMatches valida a condição when do webhook: "caminho" (precisa existir e
+// não ser false/null), "caminho==valor" ou "caminho!=valor"
+func hookMatches(when string, data gjson.Result) bool {
+	if when == "" {
+		return true
+	}
+
+	if kv := strings.SplitN(when, "!=", 2); len(kv) == 2 {
+		return data.Get(strings.TrimSpace(kv[0])).String() != strings.TrimSpace(kv[1])
+	}
+
+	if kv := strings.SplitN(when, "==", 2); len(kv) == 2 {
+		return data.Get(strings.TrimSpace(kv[0])).String() == strings.TrimSpace(kv[1])
+	}
+
+	value := data.Get(when)
+
+	return value.Exists() && value.Type != gjson.Null && value.Type != gjson.False
+}
+
+// hookAttachment monta a mensagem de um item do webhook
+func hookAttachment(hook Hook, data gjson.Result) slack.Attachment {
+	attachment := slack.Attachment{
+		Pretext:   renderHookTemplate(hook.Pretext, data),
+		Title:     renderHookTemplate(hook.Title, data),
+		TitleLink: renderHookTemplate(hook.Link, data),
+		Text:      renderHookTemplate(hook.Text, data),
+		Footer:    renderHookTemplate(hook.Footer, data),
+	}
+
+	// A cor pode ser um valor do JSON traduzido pelo mapa de cores (ex.: level -> cor)
+	color := renderHookTemplate(hook.Color, data)
+	if mapped, ok := hook.Colors[strings.ToLower(color)]; ok {
+		color = mapped
+	}
+	attachment.Color = color
+
+	for _, field := range hook.Fields {
+		value := renderHookTemplate(field.Value, data)
+		if value == "" {
+			continue
+		}
+
+		attachment.Fields = append(attachment.Fields, slack.AttachmentField{
+			Title: renderHookTemplate(field.Title, data),
+			Value: value,
+			Short: field.Short,
+		})
+	}
+
+	return attachment
+}
+
+// HooksWebhook é o end-point que recebe webhooks de qualquer ferramenta e
+// envia a mensagem montada com o template configurado para o nome
+func HooksWebhook(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	hook, ok := hooks[name]
+	if !ok {
+		log.Printf("[ERROR] Webhook %s não configurado", name)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if !ValidWebhookToken(r, hook.Token) {
+		log.Printf("[ERROR] Token inválido no webhook %s", name)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil || !gjson.Valid(string(buf)) {
+		log.Printf("[ERROR] Erro ao ler o webhook %s: %s", name, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body := gjson.Parse(string(buf))
+
+	// Webhooks com uma lista de eventos (ex.: commits) geram um attachment por item
+	items := []gjson.Result{body}
+	if hook.Items != "" {
+		items = body.Get(hook.Items).Array()
+	}
+
+	var attachments []slack.Attachment
+	for _, item := range items {
+		if !hookMatches(hook.When, item) {
+			continue
+		}
+
+		attachments = append(attachments, hookAttachment(hook, item))
+	}
+
+	if len(attachments) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	api := getAPIConnection()
+
+	channel := hook.Channel
+	if channel == "" {
+		channel = api.channelID
+	}
+
+	if _, _, err := api.client.PostMessage(channel, slack.MsgOptionAttachments(attachments...)); err != nil {
+		CheckErr("Erro ao enviar a mensagem do webhook "+name, err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,284 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/rgamba/evtwebsocket"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	hostCallback       = "host-resources"
+	actionHostEvacuate = "host-evacuate"
+)
+
+var (
+	// HostMonitor define se o uso de recursos dos hosts do Rancher é monitorado
+	HostMonitor bool
+
+	// HostCPUThreshold é o uso de CPU (%) a partir do qual o host gera alerta
+	HostCPUThreshold = 90.0
+
+	// HostMemoryThreshold é o uso de memória (%) a partir do qual o host gera alerta
+	HostMemoryThreshold = 90.0
+
+	// HostDiskThreshold é o uso de disco (%) a partir do qual o host gera alerta
+	HostDiskThreshold = 85.0
+
+	// HostCheckInterval é o intervalo entre as verificações dos hosts
+	HostCheckInterval = 2 * time.Minute
+)
+
+// hostUsage é o uso de um recurso do host acima do limite
+type hostUsage struct {
+	Resource  string
+	Value     float64
+	Threshold float64
+	Detail    string
+}
+
+// containerUsage é o consumo de CPU e memória de um container do host
+type containerUsage struct {
+	Name   string
+	CPU    float64
+	Memory int64
+}
+
+// hostResourceUsage calcula o uso de CPU, memória e disco do host a partir do
+// info que o agente do Rancher envia
+func hostResourceUsage(host gjson.Result) []hostUsage {
+	info := host.Get("info")
+
+	var cpu float64
+	cores := info.Get("cpuInfo.cpuCoresPercentages").Array()
+	for _, core := range cores {
+		cpu += core.Float()
+	}
+	if len(cores) > 0 {
+		cpu /= float64(len(cores))
+	}
+
+	var memory float64
+	if total := info.Get("memoryInfo.memTotal").Float(); total > 0 {
+		memory = (total - info.Get("memoryInfo.memAvailable").Float()) / total * 100
+	}
+
+	usage := []hostUsage{
+		{Resource: "cpu", Value: cpu, Threshold: HostCPUThreshold},
+		{Resource: "memória", Value: memory, Threshold: HostMemoryThreshold},
+	}
+
+	// O disco considerado é o ponto de montagem mais cheio
+	disk := hostUsage{Resource: "disco", Threshold: HostDiskThreshold}
+	info.Get("diskInfo.mountPoints").ForEach(func(mount, value gjson.Result) bool {
+		if percentage := value.Get("percentage").Float(); percentage > disk.Value {
+			disk.Value = percentage
+			disk.Detail = mount.String()
+		}
+		return true
+	})
+
+	return append(usage, disk)
+}
+
+// hostTopContainers busca os containers que mais consomem CPU e memória no
+// host, usando duas amostras do WebSocket de estatísticas do Rancher
+func hostTopContainers(hostID string) []containerUsage {
+	names := map[string]string{}
+	for _, container := range gjson.Get(rancherListener.ListHostContainers(hostID), "data").Array() {
+		names[container.Get("externalId").String()] = container.Get("name").String()
+	}
+
+	var mutex sync.Mutex
+	var samples []gjson.Result
+	done := make(chan bool, 1)
+
+	conn := &evtwebsocket.Conn{
+		OnMessage: func(msg []byte, w *evtwebsocket.Conn) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			samples = append(samples, gjson.ParseBytes(msg))
+			if len(samples) == 2 {
+				done <- true
+			}
+		},
+
+		OnError: func(err error) {
+			log.Printf("[ERROR] Erro nas estatísticas do host %s: %s\n", hostID, err.Error())
+		},
+	}
+
+	if err := conn.Dial(rancherListener.ContainerStatsWebSocketURL(hostID), ""); err != nil {
+		CheckErr("Erro ao conectar no WebSocket de estatísticas", err)
+		return nil
+	}
+
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+	}
+	conn.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(samples) == 0 {
+		return nil
+	}
+
+	first := map[string]gjson.Result{}
+	for _, stat := range samples[0].Array() {
+		first[stat.Get("id").String()] = stat
+	}
+
+	// O uso de CPU é a diferença do tempo de CPU entre as amostras
+	var usage []containerUsage
+	for _, stat := range samples[len(samples)-1].Array() {
+		id := stat.Get("id").String()
+
+		name, ok := names[id]
+		if !ok {
+			continue
+		}
+
+		c := containerUsage{Name: name, Memory: stat.Get("memory.usage").Int()}
+
+		if previous, ok := first[id]; ok && len(samples) > 1 {
+			start, _ := time.Parse(time.RFC3339Nano, previous.Get("timestamp").String())
+			end, _ := time.Parse(time.RFC3339Nano, stat.Get("timestamp").String())
+
+			if elapsed := end.Sub(start); elapsed > 0 {
+				c.CPU = float64(stat.Get("cpu.usage.total").Int()-previous.Get("cpu.usage.total").Int()) / float64(elapsed.Nanoseconds()) * 100
+			}
+		}
+
+		usage = append(usage, c)
+	}
+
+	return usage
+}
+
+// formatTopContainers lista os 5 containers que mais consomem o recurso
+func formatTopContainers(usage []containerUsage, resource string) string {
+	if resource == "disco" || len(usage) == 0 {
+		return ""
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		if resource == "cpu" {
+			return usage[i].CPU > usage[j].CPU
+		}
+		return usage[i].Memory > usage[j].Memory
+	})
+
+	var lines []string
+	for i, c := range usage {
+		if i == 5 {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("`%s` - CPU %.1f%% - memória %d MiB", c.Name, c.CPU, c.Memory>>20))
+	}
+
+	return "*Maiores consumidores:*\n" + strings.Join(lines, "\n")
+}
+
+// WatchHostResources verifica o uso de CPU, memória e disco dos hosts e avisa
+// no canal quando algum passa do limite (e quando volta ao normal)
+func WatchHostResources() {
+	if !HostMonitor {
+		return
+	}
+
+	log.Printf("[INFO] Monitorando os recursos dos hosts a cada %s\n", HostCheckInterval)
+
+	alerting := map[string]bool{}
+
+	for {
+		for _, host := range gjson.Get(rancherListener.ListHosts(), "data").Array() {
+			if host.Get("state").String() != "active" {
+				continue
+			}
+
+			hostID := host.Get("id").String()
+			hostName := host.Get("hostname").String()
+
+			for _, usage := range hostResourceUsage(host) {
+				key := hostID + "/" + usage.Resource
+				above := usage.Value >= usage.Threshold
+
+				if above == alerting[key] {
+					continue
+				}
+				alerting[key] = above
+
+				if above {
+					sendHostAlert(hostID, hostName, usage)
+				} else {
+					sendMessage(fmt.Sprintf(":white_check_mark: Uso de %s do host `%s` voltou ao normal (%.1f%%)", usage.Resource, hostName, usage.Value))
+				}
+			}
+		}
+
+		time.Sleep(HostCheckInterval)
+	}
+}
+
+func sendHostAlert(hostID string, hostName string, usage hostUsage) {
+	text := fmt.Sprintf("Uso de %s em *%.1f%%* (limite de %.0f%%)", usage.Resource, usage.Value, usage.Threshold)
+	if usage.Detail != "" {
+		text += fmt.Sprintf(" em `%s`", usage.Detail)
+	}
+
+	if top := formatTopContainers(hostTopContainers(hostID), usage.Resource); top != "" {
+		text += "\n\n" + top
+	}
+
+	attachment := slack.Attachment{
+		Title:      fmt.Sprintf(":fire: Host %s com %s alto", hostName, usage.Resource),
+		Text:       text,
+		Color:      "#D50200",
+		CallbackID: hostCallback,
+		Actions: []slack.AttachmentAction{
+			{
+				Name:  actionHostEvacuate,
+				Text:  "Evacuar host",
+				Type:  "button",
+				Style: "danger",
+				Value: hostID,
+				Confirm: &slack.ConfirmationField{
+					Title:       "Tem certeza disso?",
+					Text:        fmt.Sprintf("Deseja mesmo evacuar o host %s? Todos os containers serão recriados nos outros hosts :thinking_face:", hostName),
+					OkText:      "Sim",
+					DismissText: "Não",
+				},
+			},
+		},
+	}
+
+	api := getAPIConnection()
+	api.client.PostMessage(api.channelID, slack.MsgOptionAttachments(attachment))
+}
+
+func actionHostEvacuateFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	hostID := message.Actions[0].Value
+
+	state := rancherListener.EvacuateHost(hostID)
+	if state == "" {
+		respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao evacuar o host `%s`", hostID), "")
+		return
+	}
+
+	log.Printf("[INFO] Host %s evacuado pelo usuário %s\n", hostID, message.User.Name)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":truck: Host evacuado por @%s", message.User.Name), fmt.Sprintf("Estado do host: `%s`", state))
+}
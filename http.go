@@ -2,10 +2,18 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"time"
+
+	"github.com/nlopes/slack"
 )
 
 const (
@@ -17,8 +25,40 @@ const (
 
 	// PutHTTP é a constante usada para requisições de verbo PUT
 	PutHTTP = "PUT"
+
+	// DeleteHTTP é a constante usada para requisições de verbo DELETE
+	DeleteHTTP = "DELETE"
+
+	// PatchHTTP é a constante usada para requisições de verbo PATCH
+	PatchHTTP = "PATCH"
 )
 
+var (
+	// RancherTimeout é o tempo máximo de cada chamada na API do Rancher
+	RancherTimeout = 15 * time.Second
+
+	// SlackTimeout é o tempo máximo de cada chamada na API do Slack
+	SlackTimeout = 10 * time.Second
+
+	// RancherRetries é a quantidade máxima de tentativas de cada chamada no Rancher
+	RancherRetries = 3
+
+	// RancherRetryBackoff é a espera antes da segunda tentativa, dobrando a cada nova tentativa
+	RancherRetryBackoff = 500 * time.Millisecond
+
+	// RancherRetryStatus são os status de resposta do Rancher que são repetidos
+	RancherRetryStatus = map[int]bool{502: true, 503: true, 504: true}
+)
+
+// botContext é o contexto raiz das chamadas externas, cancelado quando o BOT é
+// encerrado para não deixar requisições penduradas
+var botContext, stopBotContext = context.WithCancel(context.Background())
+
+// externalHTTPClient é o client usado nas requisições para as APIs externas
+// (Alertmanager, PagerDuty, Jira...), diferente do client do Rancher ele
+// verifica os certificados
+var externalHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
 // CreateHTTPClient é a função responsável por retornar um client para que possam ser
 // enviadas as requisições
 func CreateHTTPClient() *http.Client {
@@ -31,37 +71,191 @@ func CreateHTTPClient() *http.Client {
 	return client
 }
 
+// rancherHTTPClient é o client das chamadas no Rancher, um só para as
+// conexões com a API serem reutilizadas entre as chamadas
+var rancherHTTPClient = CreateHTTPClient()
+
+// CreateSlackClient retorna um client do Slack com o SlackTimeout em cada
+// chamada e um transport próprio, que mantém as conexões com a API abertas
+// para serem reutilizadas. O BOT usa um único client (ver getAPIConnection)
+func CreateSlackClient(options ...slack.Option) *slack.Client {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        20,
+		MaxIdleConnsPerHost: 20,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	client := &http.Client{Timeout: SlackTimeout, Transport: transport}
+	option := slack.OptionHTTPClient(client)
+
+	// No sandbox as chamadas do replay não chegam no Slack
+	if SandboxMode {
+		option = slack.OptionHTTPClient(sandboxSlackRequester{client: client})
+	}
+	options = append([]slack.Option{option}, options...)
+
+	return slack.New(SlackBotToken, options...)
+}
+
 // HTTPSendRancherRequest é a função que envia a requisição para a
 // API do Rancher e retorna o body do response já convertido em
-// String
+// String. Em caso de erro ou timeout retorna vazio, as funções que
+// retornam erro usam o HTTPSendRancherRequestContext para mostrar a causa
 func (rancherListener *RancherListener) HTTPSendRancherRequest(url string, method string, data string) string {
-	client := CreateHTTPClient()
+	resp, err := rancherListener.HTTPSendRancherRequestContext(rancherListener.context(), url, method, data)
+	CheckErr("[ERROR] Erro ao enviar requisição", err)
+
+	return resp
+}
+
+// HTTPSendRancherListRequest é a função que busca uma coleção do Rancher
+// seguindo os links de paginação (pagination.next), retornando o JSON da
+// primeira página com o data de todas as páginas
+func (rancherListener *RancherListener) HTTPSendRancherListRequest(url string) string {
+	resp, err := rancherListener.api().ListJSON(rancherListener.context(), url)
+	CheckErr("Erro ao buscar a listagem do Rancher", err)
+
+	return resp
+}
 
+// Request envia as chamadas do client do package rancher, com o contexto
+// recebido no lugar do contexto do listener
+func (rancherListener *RancherListener) Request(ctx context.Context, url string, method string, data string) (string, error) {
+	return rancherListener.HTTPSendRancherRequestContext(ctx, url, method, data)
+}
+
+// HTTPSendRancherRequestContext é igual a HTTPSendRancherRequest, mas
+// cancelando a requisição junto com o ctx ou após o RancherTimeout. Falhas
+// transitórias (timeouts, erros de conexão e os RancherRetryStatus) são
+// repetidas até RancherRetries vezes com backoff exponencial, e com o circuito
+// do endpoint aberto a chamada falha na hora com ErrRancherUnavailable
+func (rancherListener *RancherListener) HTTPSendRancherRequestContext(ctx context.Context, url string, method string, data string) (string, error) {
+	if method != GetHTTP && method != PostHTTP && method != PutHTTP {
+		log.Println("[INFO] Não possível criar requisição, método não encontrado.")
+		return "", fmt.Errorf("método %s não suportado", method)
+	}
+
+	// Em dry-run as alterações são registradas no lugar de enviadas
+	if rancherListener.dryRun != nil && method != GetHTTP {
+		return rancherListener.dryRun.recordRancher(rancherListener, url, method, data), nil
+	}
+
+	// No sandbox o Rancher não é chamado, as leituras vêm das gravações
+	if SandboxMode {
+		return sandboxRancherRequest(rancherListener, url, method, data)
+	}
+
+	endpoint := rancherListener.rancherEndpoint(url)
+	if !RancherBreakerAllow(endpoint) {
+		return "", ErrRancherUnavailable
+	}
+
+	// Os erros 5xx do Rancher também contam como falha, mesmo sem repetição
+	resp, status, err := rancherListener.sendRancherRequestWithRetry(ctx, url, method, data)
+	RancherBreakerRecord(endpoint, err == nil && status < http.StatusInternalServerError)
+
+	if err == nil && status < http.StatusInternalServerError && method == GetHTTP {
+		recordSandboxRancher(rancherListener, url, resp)
+	}
+
+	return resp, err
+}
+
+// sendRancherRequestWithRetry envia a requisição repetindo as falhas
+// transitórias, retornando o body e o status da última tentativa
+func (rancherListener *RancherListener) sendRancherRequestWithRetry(ctx context.Context, url string, method string, data string) (string, int, error) {
+	backoff := RancherRetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		resp, status, err := rancherListener.sendRancherRequest(ctx, rancherHTTPClient, url, method, data)
+		if !rancherRetryable(method, status, err) || ctx.Err() != nil {
+			return resp, status, err
+		}
+
+		if err == nil {
+			err = fmt.Errorf("%s %s retornou %d", method, url, status)
+		}
+
+		if attempt >= RancherRetries {
+			return resp, status, fmt.Errorf("falha após %d tentativas: %w", attempt, err)
+		}
+
+		log.Printf("[INFO] Tentativa %d de %s %s falhou (%s), repetindo em %s\n", attempt, method, url, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return resp, status, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (rancherListener *RancherListener) sendRancherRequest(ctx context.Context, client *http.Client, url string, method string, data string) (string, int, error) {
 	var payload io.Reader
-	if data != "" {
+	if data != "" && method != GetHTTP {
 		payload = bytes.NewBufferString(data)
 	}
 
-	var req *http.Request
-	var err error
-	switch method {
-	case "GET":
-		req, err = http.NewRequest(method, url, nil)
-	case "POST":
-		req, err = http.NewRequest(method, url, payload)
-	case "PUT":
-		req, err = http.NewRequest(method, url, payload)
-	default:
-		log.Println("[INFO] Não possível criar requisição, método não encontrado.")
+	req, err := http.NewRequest(method, url, payload)
+	if err != nil {
+		return "", 0, err
 	}
-	CheckErr("[ERROR] Erro ao criar requisição", err)
 
+	ctx, cancel := context.WithTimeout(ctx, RancherTimeout)
+	defer cancel()
+
+	req = req.WithContext(ctx)
 	rancherListener.RancherAuthAdd(req)
 
 	resp, err := client.Do(req)
-	CheckErr("[ERROR] Erro ao enviar requisição", err)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
 
-	return ConvertResponseToString(resp.Body)
+	return ConvertResponseToString(resp.Body), resp.StatusCode, nil
+}
+
+// rancherRetryable retorna se a chamada pode ser repetida. Só as leituras
+// (GET) são repetidas em qualquer falha transitória. As alterações (POST, PUT
+// e DELETE) só são repetidas quando não chegaram no Rancher (erro de conexão)
+// ou quando o Rancher recusou sem executar (502 e 503), para não executar
+// duas vezes
+func rancherRetryable(method string, status int, err error) bool {
+	if err != nil {
+		if method == GetHTTP {
+			return true
+		}
+
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+
+	if !RancherRetryStatus[status] {
+		return false
+	}
+
+	return method == GetHTTP || status == http.StatusBadGateway || status == http.StatusServiceUnavailable
+}
+
+// WithContext retorna uma cópia do listener que cancela as chamadas no Rancher
+// junto com o ctx (ex.: a requisição HTTP que originou a chamada)
+func (rancherListener *RancherListener) WithContext(ctx context.Context) *RancherListener {
+	listener := *rancherListener
+	listener.ctx = ctx
+
+	return &listener
+}
+
+func (rancherListener *RancherListener) context() context.Context {
+	if rancherListener.ctx != nil {
+		return rancherListener.ctx
+	}
+
+	return botContext
 }
 
 // RancherAuthAdd é a função que adiciona as credenciais na requisição que será feita
@@ -71,3 +265,87 @@ func (rancherListener *RancherListener) RancherAuthAdd(request *http.Request) {
 		request.SetBasicAuth(rancherListener.accessKey, rancherListener.secretKey)
 	}
 }
+
+// HTTPSendJSONRequest é a função que envia uma requisição para APIs externas,
+// convertendo o body para JSON (caso não seja string), e retorna o body da
+// resposta em String. Respostas fora da faixa 2xx retornam erro
+func HTTPSendJSONRequest(method string, url string, headers map[string]string, body interface{}) (string, error) {
+	return HTTPSendJSONRequestWithClient(externalHTTPClient, method, url, headers, body)
+}
+
+// HTTPSendJSONRequestWithClient é igual a HTTPSendJSONRequest, mas usando um
+// client próprio (ex.: com o CA do cluster Kubernetes)
+func HTTPSendJSONRequestWithClient(client *http.Client, method string, url string, headers map[string]string, body interface{}) (string, error) {
+	return HTTPSendJSONRequestContext(botContext, client, method, url, headers, body)
+}
+
+// HTTPSendJSONRequestContext é igual a HTTPSendJSONRequestWithClient, mas
+// cancelando a requisição junto com o ctx
+func HTTPSendJSONRequestContext(ctx context.Context, client *http.Client, method string, url string, headers map[string]string, body interface{}) (string, error) {
+	var payload io.Reader
+
+	switch data := body.(type) {
+	case nil:
+	case string:
+		payload = bytes.NewBufferString(data)
+	default:
+		buf, err := json.Marshal(data)
+		if err != nil {
+			return "", err
+		}
+		payload = bytes.NewBuffer(buf)
+	}
+
+	req, err := http.NewRequest(method, url, payload)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	response := ConvertResponseToString(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return response, &HTTPStatusError{Method: method, URL: url, Status: resp.StatusCode, Body: response}
+	}
+
+	return response, nil
+}
+
+// HTTPStatusError é a resposta fora dos 2xx, com o status para quem trata
+// algum deles (ex.: 404 e 409)
+type HTTPStatusError struct {
+	Method string
+	URL    string
+	Status int
+	Body   string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s %s retornou %d: %s", e.Method, e.URL, e.Status, e.Body)
+}
+
+// httpStatus retorna o status da resposta que causou o erro, 0 quando não
+// houve resposta (ex.: timeout)
+func httpStatus(err error) int {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Status
+	}
+
+	return 0
+}
@@ -0,0 +1,527 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	actionImageGCApply   = "image-gc-apply"
+	actionImageGCDiscard = "image-gc-discard"
+	imageGCCallback      = "image-gc"
+
+	// imageGCMarker é o prefixo das linhas do script nos logs do container
+	// auxiliar, que também trazem o stream e a data do Rancher
+	imageGCMarker = "slackbot-gc|"
+
+	// imageGCPendingTTL é o tempo que a listagem espera pela limpeza
+	imageGCPendingTTL = 30 * time.Minute
+
+	// imageGCPollInterval é o intervalo entre as verificações do container
+	// auxiliar
+	imageGCPollInterval = 3 * time.Second
+
+	// imageGCLogLines é o limite de linhas lidas dos logs do container auxiliar
+	imageGCLogLines = 10000
+
+	// imageGCHostImages é a quantidade de imagens listadas por host na mensagem
+	imageGCHostImages = 5
+)
+
+var (
+	// ImageGCAdmins são os usuários (IDs, nomes ou @papel do RBAC_ROLES) que
+	// podem listar e limpar as imagens dos hosts
+	ImageGCAdmins = []string{"@admin"}
+
+	// ImageGCHelperImage é a imagem do container auxiliar que roda o docker
+	// nos hosts, com o docker.sock do host montado
+	ImageGCHelperImage = "docker:stable"
+
+	// ImageGCTimeout é o tempo máximo do container auxiliar em cada host
+	ImageGCTimeout = 5 * time.Minute
+)
+
+var (
+	imageGCPending      = map[string]*imageGCRequest{}
+	imageGCPendingMutex sync.Mutex
+
+	dockerSizePattern = regexp.MustCompile(`^([0-9.]+)\s*([kKMGT]?)B$`)
+	dockerSizeUnits   = map[string]float64{"": 1, "K": 1e3, "M": 1e6, "G": 1e9, "T": 1e12}
+)
+
+// imageGCRequest é a listagem esperando a confirmação da limpeza
+type imageGCRequest struct {
+	Hosts    []*hostImages
+	Dangling bool
+	Created  time.Time
+}
+
+// unusedImage é uma imagem sem container (parado ou rodando) no host
+type unusedImage struct {
+	ID   string
+	Name string
+	Size int64
+}
+
+// hostImages são as imagens sem uso de um host e, depois da limpeza, o
+// espaço liberado
+type hostImages struct {
+	ID        string
+	Name      string
+	Images    []unusedImage
+	Reclaimed string
+	Err       error
+}
+
+// Size é a soma do tamanho das imagens sem uso. As camadas compartilhadas
+// entram em todas as imagens, então o espaço liberado pode ser menor
+func (h *hostImages) Size() int64 {
+	var size int64
+	for _, image := range h.Images {
+		size += image.Size
+	}
+
+	return size
+}
+
+// imageGCScript monta o script do container auxiliar: a listagem das imagens
+// sem uso (as dangling ou todas sem container) ou, com o prune, a limpeza
+func imageGCScript(dangling bool, prune bool) string {
+	format := `--format '{{.ID}}|{{.Repository}}:{{.Tag}}|{{.Size}}'`
+	mark := fmt.Sprintf("sed 's/^/%s/'", imageGCMarker)
+
+	switch {
+	case prune && dangling:
+		return "docker image prune -f | " + mark
+	case prune:
+		return "docker image prune -a -f | " + mark
+	case dangling:
+		return fmt.Sprintf("docker images -f dangling=true --no-trunc %s | %s", format, mark)
+	}
+
+	// As imagens dos containers (inclusive os parados) não são removidas pelo
+	// prune -a, então saem da listagem
+	return fmt.Sprintf("docker ps -aq | xargs -r docker inspect --format '{{.Image}}' | sort -u > /tmp/used; docker images --no-trunc %s | grep -v -F -f /tmp/used | %s", format, mark)
+}
+
+// parseDockerSize converte o tamanho do docker images (ex.: 1.2GB, 512kB),
+// em unidades decimais, para bytes
+func parseDockerSize(value string) int64 {
+	match := dockerSizePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0
+	}
+
+	size, _ := strconv.ParseFloat(match[1], 64)
+
+	return int64(size * dockerSizeUnits[strings.ToUpper(match[2])])
+}
+
+// formatDockerSize formata o tamanho em unidades decimais, como o docker
+func formatDockerSize(size int64) string {
+	switch {
+	case size >= 1000*1000*1000:
+		return fmt.Sprintf("%.2f GB", float64(size)/(1000*1000*1000))
+	case size >= 1000*1000:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1000*1000))
+	case size >= 1000:
+		return fmt.Sprintf("%.1f kB", float64(size)/1000)
+	}
+
+	return fmt.Sprintf("%d B", size)
+}
+
+// parseImageGCOutput lê as linhas do script nos logs do container auxiliar:
+// as imagens da listagem e o espaço liberado do prune
+func parseImageGCOutput(output string) ([]unusedImage, string) {
+	var images []unusedImage
+	reclaimed := ""
+
+	for _, line := range strings.Split(StripANSI(output), "\n") {
+		i := strings.Index(line, imageGCMarker)
+		if i < 0 {
+			continue
+		}
+		line = strings.TrimSpace(line[i+len(imageGCMarker):])
+
+		if strings.HasPrefix(line, "Total reclaimed space:") {
+			reclaimed = strings.TrimSpace(strings.TrimPrefix(line, "Total reclaimed space:"))
+			continue
+		}
+
+		fields := strings.Split(line, "|")
+		if len(fields) != 3 {
+			continue
+		}
+
+		name := fields[1]
+		if name == "<none>:<none>" {
+			name = "<dangling>"
+		}
+		images = append(images, unusedImage{ID: strings.TrimPrefix(fields[0], "sha256:"), Name: name, Size: parseDockerSize(fields[2])})
+	}
+
+	sort.Slice(images, func(i, j int) bool { return images[i].Size > images[j].Size })
+
+	return images, reclaimed
+}
+
+// RunHostCommand roda o script em um container avulso no host, com o
+// docker.sock do host montado, espera ele terminar e retorna os logs. O
+// container é removido no final
+func (ranchListener *RancherListener) RunHostCommand(ctx context.Context, hostID string, script string) (string, error) {
+	request := map[string]interface{}{
+		"type":            "container",
+		"name":            fmt.Sprintf("slackbot-image-gc-%s-%d", hostID, time.Now().Unix()),
+		"imageUuid":       "docker:" + ImageGCHelperImage,
+		"requestedHostId": hostID,
+		"command":         []string{"sh", "-c", script},
+		"startOnCreate":   true,
+		"restartPolicy":   map[string]string{"name": "no"},
+		"dataVolumes":     []string{"/var/run/docker.sock:/var/run/docker.sock"},
+	}
+
+	var container Container
+	if err := ranchListener.api().Post(ctx, "containers", request, &container); err != nil {
+		return "", err
+	}
+
+	defer func() {
+		err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("containers/%s?action=remove", container.ID), nil, &Container{})
+		CheckErr("Erro ao remover o container auxiliar "+container.ID, err)
+		ranchListener.invalidateCache(cacheContainers)
+	}()
+
+	deadline := time.Now().Add(ImageGCTimeout)
+	for {
+		var current Container
+		err := ranchListener.api().Get(ctx, "containers/"+container.ID, &current)
+		CheckErr("Erro ao buscar o container auxiliar "+container.ID, err)
+
+		if current.State == "stopped" {
+			break
+		}
+		if current.State == "error" || current.State == "removed" {
+			return "", fmt.Errorf("container auxiliar em %s: %s", current.State, current.TransitioningMessage)
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("o container auxiliar não terminou em %s", ImageGCTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("cancelado esperando o container auxiliar")
+		case <-time.After(imageGCPollInterval):
+		}
+	}
+
+	reader, err := ranchListener.ContainerLogsReader(container.ID, imageGCLogLines)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// imageGCHosts são os hosts ativos, ou apenas o host informado (nome ou ID)
+func imageGCHosts(filter string) ([]*hostImages, error) {
+	var hosts []*hostImages
+	for _, host := range gjson.Get(rancherListener.ListCachedHosts(), "data").Array() {
+		if host.Get("state").String() != "active" {
+			continue
+		}
+
+		h := &hostImages{ID: host.Get("id").String(), Name: host.Get("hostname").String()}
+		if filter == "" || filter == h.ID || filter == h.Name {
+			hosts = append(hosts, h)
+		}
+	}
+
+	if len(hosts) == 0 {
+		if filter != "" {
+			return nil, fmt.Errorf("host `%s` não encontrado entre os hosts ativos", filter)
+		}
+		return nil, fmt.Errorf("nenhum host ativo")
+	}
+
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+
+	return hosts, nil
+}
+
+// ListUnusedImages lista as imagens sem uso em cada host, em paralelo
+func ListUnusedImages(ctx context.Context, hosts []*hostImages, dangling bool) {
+	var wg sync.WaitGroup
+	for _, h := range hosts {
+		wg.Add(1)
+		go func(h *hostImages) {
+			defer wg.Done()
+
+			output, err := rancherListener.RunHostCommand(ctx, h.ID, imageGCScript(dangling, false))
+			if err != nil {
+				CheckErr("Erro ao listar as imagens do host "+h.Name, err)
+				h.Err = err
+				return
+			}
+			h.Images, _ = parseImageGCOutput(output)
+		}(h)
+	}
+	wg.Wait()
+}
+
+// PruneImages remove as imagens sem uso, um host de cada vez, guardando o
+// espaço liberado em cada host
+func PruneImages(ctx context.Context, hosts []*hostImages, dangling bool, progress *Progress) {
+	for i, h := range hosts {
+		progress.Update(i, len(hosts), "limpando o host "+h.Name)
+
+		if ctx.Err() != nil {
+			h.Err = fmt.Errorf("cancelado antes da limpeza")
+			continue
+		}
+
+		output, err := rancherListener.RunHostCommand(ctx, h.ID, imageGCScript(dangling, true))
+		if err != nil {
+			CheckErr("Erro ao limpar as imagens do host "+h.Name, err)
+			h.Err = err
+			continue
+		}
+		_, h.Reclaimed = parseImageGCOutput(output)
+
+		log.Printf("[INFO] Imagens sem uso removidas do host %s, %s liberados\n", h.Name, h.Reclaimed)
+	}
+}
+
+// imageGCKind é a descrição das imagens consideradas na limpeza
+func imageGCKind(dangling bool) string {
+	if dangling {
+		return "imagens dangling"
+	}
+
+	return "imagens sem container"
+}
+
+// ImageGCListAttachment monta a listagem de cada host, com as maiores
+// imagens, e os botões de limpar e descartar
+func ImageGCListAttachment(hosts []*hostImages, dangling bool, ID string) slack.Attachment {
+	attachment := slack.Attachment{
+		Title:      fmt.Sprintf(":wastebasket: %s por host (dry-run, nada foi removido)", strings.Title(imageGCKind(dangling))),
+		Color:      "#0C648A",
+		CallbackID: imageGCCallback,
+	}
+
+	var total int64
+	var count int
+	for _, h := range hosts {
+		field := slack.AttachmentField{Title: h.Name}
+
+		switch {
+		case h.Err != nil:
+			field.Value = ":x: " + h.Err.Error()
+		case len(h.Images) == 0:
+			field.Value = "Nenhuma imagem para remover"
+		default:
+			var lines []string
+			for i, image := range h.Images {
+				if i == imageGCHostImages {
+					lines = append(lines, fmt.Sprintf("e mais %d", len(h.Images)-imageGCHostImages))
+					break
+				}
+				lines = append(lines, fmt.Sprintf("`%s` %s", image.Name, formatDockerSize(image.Size)))
+			}
+
+			field.Title = fmt.Sprintf("%s: %d imagens, até %s", h.Name, len(h.Images), formatDockerSize(h.Size()))
+			field.Value = strings.Join(lines, "\n")
+		}
+
+		total += h.Size()
+		count += len(h.Images)
+		attachment.Fields = append(attachment.Fields, field)
+	}
+
+	if count == 0 {
+		attachment.Footer = "Nada para limpar"
+		return attachment
+	}
+
+	attachment.Text = fmt.Sprintf("%d imagens em %d hosts, até %s. As camadas compartilhadas entre imagens são contadas mais de uma vez", count, len(hosts), formatDockerSize(total))
+	attachment.Actions = []slack.AttachmentAction{
+		{
+			Name: actionImageGCApply, Text: "Limpar", Type: "button", Style: "danger", Value: ID,
+			Confirm: &slack.ConfirmationField{Title: "Limpar as imagens?", Text: "As imagens sem uso serão removidas dos hosts", OkText: "Limpar", DismissText: "Cancelar"},
+		},
+		{Name: actionImageGCDiscard, Text: "Descartar", Type: "button", Value: ID},
+	}
+
+	return attachment
+}
+
+// ImageGCReportAttachment monta o espaço liberado em cada host
+func ImageGCReportAttachment(hosts []*hostImages) slack.Attachment {
+	attachment := slack.Attachment{
+		Title: ":broom: Limpeza das imagens dos hosts",
+		Color: "good",
+	}
+
+	for _, h := range hosts {
+		value := h.Reclaimed + " liberados"
+		if h.Err != nil {
+			value = ":x: " + h.Err.Error()
+			attachment.Color = "warning"
+		}
+
+		attachment.Fields = append(attachment.Fields, slack.AttachmentField{Title: h.Name, Value: value, Short: true})
+	}
+
+	return attachment
+}
+
+// slackImageGC lista as imagens sem uso de cada host (ou do host informado),
+// sem remover nada, com o botão que faz a limpeza. Só para os ImageGCAdmins
+func (s *SlackListener) slackImageGC(ev *slack.MessageEvent) {
+	userName := ev.Msg.User
+	if info, err := s.client.GetUserInfo(ev.Msg.User); err == nil && info.Name != "" {
+		userName = info.Name
+	}
+
+	if !userAllowed(ImageGCAdmins, ev.Msg.User, userName) {
+		log.Printf("[INFO] Usuário %s sem permissão para limpar as imagens dos hosts\n", userName)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: @%s não tem permissão para `%s` (%s)", userName, imageGC, formatPermissions(ImageGCAdmins)), false))
+		return
+	}
+
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", imageGC), false))
+		return
+	}
+
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+	_, dangling := args.Options["dangling"]
+
+	filter := ""
+	if len(args.Positional) > 0 {
+		filter = args.Positional[0]
+	}
+
+	hosts, err := imageGCHosts(filter)
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(":x: "+err.Error(), false))
+		return
+	}
+
+	channel := ev.Channel
+	job, err := EnqueueJobContext("listagem das imagens sem uso", ev.Msg.User, func(ctx context.Context) error {
+		ListUnusedImages(ctx, hosts, dangling)
+
+		ID := fmt.Sprintf("%d", time.Now().UnixNano())
+
+		imageGCPendingMutex.Lock()
+		for key, pending := range imageGCPending {
+			if time.Since(pending.Created) > imageGCPendingTTL {
+				delete(imageGCPending, key)
+			}
+		}
+		imageGCPending[ID] = &imageGCRequest{Hosts: hosts, Dangling: dangling, Created: time.Now()}
+		imageGCPendingMutex.Unlock()
+
+		s.client.PostMessage(channel, slack.MsgOptionAttachments(ImageGCListAttachment(hosts, dangling, ID)))
+		return nil
+	})
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(queuedJobMessage(job, err), false))
+	}
+}
+
+// takeImageGCPending retira a listagem, nil quando ela não existe mais
+func takeImageGCPending(ID string) *imageGCRequest {
+	imageGCPendingMutex.Lock()
+	defer imageGCPendingMutex.Unlock()
+
+	pending, ok := imageGCPending[ID]
+	delete(imageGCPending, ID)
+	if !ok || time.Since(pending.Created) > imageGCPendingTTL {
+		return nil
+	}
+
+	return pending
+}
+
+// actionImageGCApplyFunction limpa os hosts da listagem que tinham imagens
+// sem uso, informando no final o espaço liberado em cada host
+func actionImageGCApplyFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	if !userAllowed(ImageGCAdmins, message.User.ID, message.User.Name) {
+		log.Printf("[INFO] Usuário %s sem permissão para limpar as imagens dos hosts\n", message.User.Name)
+		respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":no_entry: @%s não tem permissão para limpar as imagens (%s)", message.User.Name, formatPermissions(ImageGCAdmins)), "")
+		return
+	}
+
+	pending := takeImageGCPending(message.Actions[0].Value)
+	if pending == nil {
+		respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":hourglass: Essa listagem expirou, rode o `%s` de novo", imageGC), "")
+		return
+	}
+
+	var hosts []*hostImages
+	for _, h := range pending.Hosts {
+		if h.Err == nil && len(h.Images) > 0 {
+			hosts = append(hosts, &hostImages{ID: h.ID, Name: h.Name})
+		}
+	}
+
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":broom: Limpeza iniciada por @%s", message.User.Name), "")
+
+	channel, user := message.Channel.ID, message.User.Name
+	job, err := EnqueueJobContext("limpeza das imagens sem uso", user, func(ctx context.Context) error {
+		title := fmt.Sprintf("*Limpeza das %s* em %d hosts, por @%s", imageGCKind(pending.Dangling), len(hosts), user)
+		progress := StartProgress(channel, title, JobFromContext(ctx))
+
+		PruneImages(ctx, hosts, pending.Dangling, progress)
+
+		failed := 0
+		for _, h := range hosts {
+			if h.Err != nil {
+				failed++
+			}
+		}
+
+		log.Printf("[INFO] Limpeza das imagens de %d hosts feita pelo usuário %s\n", len(hosts), user)
+		progress.Finish(failed == 0, fmt.Sprintf("%d de %d hosts limpos", len(hosts)-failed, len(hosts)))
+		getAPIConnection().client.PostMessage(channel, slack.MsgOptionAttachments(ImageGCReportAttachment(hosts)))
+
+		if failed > 0 {
+			return fmt.Errorf("%d hosts não foram limpos", failed)
+		}
+		return nil
+	})
+	interactionJob(w, job, err)
+	if err != nil {
+		sendMessage(queuedJobMessage(job, err))
+	}
+}
+
+func actionImageGCDiscardFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	takeImageGCPending(message.Actions[0].Value)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Limpeza descartada por @%s", message.User.Name), "")
+}
@@ -0,0 +1,167 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const actionOpenIncident = "open-incident"
+
+var (
+	// IncidentOncallGroup é o ID do grupo de usuários do Slack (ex.: S0123ABCD)
+	// convidado para os canais de incidente
+	IncidentOncallGroup string
+
+	// IncidentChannelPrefix é o prefixo do nome dos canais de incidente
+	IncidentChannelPrefix = "inc"
+)
+
+var channelNameInvalid = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// incidentChannelName monta o nome do canal, que no Slack deve ter no máximo
+// 80 caracteres minúsculos, sem espaços nem pontos
+func incidentChannelName(name string) string {
+	slug := strings.Trim(channelNameInvalid.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if slug == "" {
+		slug = "geral"
+	}
+
+	channel := fmt.Sprintf("%s-%s-%s", IncidentChannelPrefix, time.Now().Format("20060102-1504"), slug)
+	if len(channel) > 80 {
+		channel = strings.TrimRight(channel[:80], "-")
+	}
+
+	return channel
+}
+
+// openIncidentAction é o botão de abrir incidente adicionado nas mensagens de alerta
+func openIncidentAction(serviceID string) slack.AttachmentAction {
+	return slack.AttachmentAction{
+		Name:  actionOpenIncident,
+		Text:  "Abrir incidente",
+		Type:  "button",
+		Style: "danger",
+		Value: serviceID,
+		Confirm: &slack.ConfirmationField{
+			Title:       "Abrir incidente?",
+			Text:        "Será criado um canal para o incidente, com o grupo de plantão convidado",
+			OkText:      "Sim",
+			DismissText: "Não",
+		},
+	}
+}
+
+// OpenIncident cria o canal do incidente, convida o grupo de plantão e quem
+// abriu o incidente, fixa o resumo com as informações do serviço e avisa no
+// canal de origem (na thread, caso originTs seja informado)
+func OpenIncident(serviceID string, summary string, user string, originChannel string, originTs string) (string, error) {
+	api := getAPIConnection()
+
+	name := summary
+	if serviceID != "" {
+		if service, err := orchestrator.GetService(serviceID); err == nil {
+			name = service.Name
+		}
+	}
+
+	channel, err := api.client.CreateConversation(incidentChannelName(name), false)
+	if err != nil {
+		return "", err
+	}
+
+	members := []string{user}
+	if IncidentOncallGroup != "" {
+		group, err := api.client.GetUserGroupMembers(IncidentOncallGroup)
+		if err != nil {
+			CheckErr("Erro ao buscar o grupo de plantão", err)
+		}
+		members = append(members, group...)
+	}
+
+	if _, err := api.client.InviteUsersToConversation(channel.ID, members...); err != nil {
+		CheckErr("Erro ao convidar usuários para o canal de incidente", err)
+	}
+
+	api.client.SetTopicOfConversation(channel.ID, truncate(summary, 250))
+
+	text := fmt.Sprintf(":rotating_light: *Incidente aberto por <@%s>*\n%s", user, summary)
+	if serviceID != "" {
+		text += "\n\n" + serviceInfoMessage(serviceID)
+	}
+
+	_, ts, err := api.client.PostMessage(channel.ID, slack.MsgOptionAttachments(slack.Attachment{
+		Text:    text,
+		Color:   "#D50200",
+		Actions: serviceQuickActionsIf(serviceID),
+	}))
+	if err == nil {
+		api.client.AddPin(channel.ID, slack.NewRefToMessage(channel.ID, ts))
+	}
+
+	log.Printf("[INFO] Canal de incidente %s aberto pelo usuário %s\n", channel.Name, user)
+
+	link := fmt.Sprintf(":rotating_light: Incidente aberto por <@%s> em <#%s>", user, channel.ID)
+	if originTs != "" {
+		api.client.PostMessage(originChannel, slack.MsgOptionText(link, false), slack.MsgOptionTS(originTs))
+	} else {
+		api.client.PostMessage(originChannel, slack.MsgOptionText(link, false))
+	}
+
+	return channel.ID, nil
+}
+
+// serviceQuickActionsIf retorna os botões do serviço, caso ele tenha sido informado
+func serviceQuickActionsIf(serviceID string) []slack.AttachmentAction {
+	if serviceID == "" {
+		return nil
+	}
+
+	return serviceQuickActions(serviceID)
+}
+
+func (s *SlackListener) slackOpenIncident(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) < 4 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s serviço|- descrição do incidente", openIncident), false))
+		return
+	}
+
+	serviceID := ""
+	if args[2] != "-" {
+		var ok bool
+		if serviceID, ok = s.resolveServiceArg(ev.Channel, args[2]); !ok {
+			return
+		}
+	}
+
+	if _, err := OpenIncident(serviceID, strings.Join(args[3:], " "), ev.Msg.User, ev.Channel, ""); err != nil {
+		CheckErr("Erro ao abrir canal de incidente", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao criar o canal do incidente: %s", err), false))
+	}
+}
+
+// actionOpenIncidentFunction abre o incidente a partir de uma mensagem de
+// alerta, usando o título do alerta como resumo. A mensagem original não é
+// alterada, o link do canal é enviado na thread
+func actionOpenIncidentFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	summary, _ := messageContext(message.OriginalMessage)
+
+	go func() {
+		if _, err := OpenIncident(message.Actions[0].Value, summary, message.User.ID, message.Channel.ID, message.MessageTs); err != nil {
+			CheckErr("Erro ao abrir canal de incidente", err)
+			getAPIConnection().client.PostMessage(message.Channel.ID, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao criar o canal do incidente: %s", err), false), slack.MsgOptionTS(message.MessageTs))
+		}
+	}()
+}
@@ -0,0 +1,261 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+// actionInspectJSON é o botão que envia o JSON do container como snippet
+const actionInspectJSON = "inspect-json"
+
+// ContainerJSON retorna o JSON original do container
+func (ranchListener *RancherListener) ContainerJSON(ID string) (string, error) {
+	var resource json.RawMessage
+	if err := ranchListener.api().Get(ranchListener.context(), "containers/"+ID, &resource); err != nil {
+		return "", err
+	}
+
+	return string(resource), nil
+}
+
+// findContainer busca o container pelo ID ou pelo nome (exato ou ignorando
+// maiúsculas)
+func findContainer(value string) (*Container, error) {
+	containers, err := rancherListener.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, container := range containers {
+		if container.ID == value || container.Name == value {
+			return &container, nil
+		}
+	}
+	for _, container := range containers {
+		if strings.EqualFold(container.Name, value) {
+			return &container, nil
+		}
+	}
+
+	return nil, fmt.Errorf("container `%s` não encontrado", value)
+}
+
+// inspectList formata os itens de um campo do inspect, um por linha
+func inspectList(items []string) string {
+	if len(items) == 0 {
+		return "-"
+	}
+
+	return "`" + strings.Join(items, "`\n`") + "`"
+}
+
+// inspectLinks são os links do container: os do serviço (linkedServices,
+// com o nome do serviço) e os do próprio container (instanceLinks)
+func inspectLinks(raw string, serviceID string) []string {
+	var links []string
+
+	if serviceID != "" {
+		if service, err := rancherListener.GetService(serviceID); err == nil {
+			for alias, ID := range service.LinkedServices {
+				links = append(links, fmt.Sprintf("%s -> %s (%s)", alias, serviceIndex.Name(ID), ID))
+			}
+		}
+	}
+
+	gjson.Get(raw, "instanceLinks").ForEach(func(alias, ID gjson.Result) bool {
+		links = append(links, fmt.Sprintf("%s -> %s", alias.String(), ID.String()))
+		return true
+	})
+	sort.Strings(links)
+
+	return links
+}
+
+// inspectHost é o host do container, com o nome e o IP do agente
+func inspectHost(hostID string) string {
+	for _, host := range gjson.Get(rancherListener.ListCachedHosts(), "data").Array() {
+		if host.Get("id").String() == hostID {
+			return fmt.Sprintf("%s (`%s`, %s)", host.Get("hostname").String(), hostID, host.Get("agentIpAddress").String())
+		}
+	}
+
+	return "`" + hostID + "`"
+}
+
+// inspectAttachment monta o inspect do container: portas, IPs, links,
+// labels, volumes e o host, com o botão do JSON
+func inspectAttachment(raw string) slack.Attachment {
+	var container Container
+	json.Unmarshal([]byte(raw), &container)
+
+	var ports []string
+	for _, port := range gjson.Get(raw, "ports").Array() {
+		ports = append(ports, port.String())
+	}
+	for _, endpoint := range gjson.Get(raw, "publicEndpoints").Array() {
+		ports = append(ports, fmt.Sprintf("%s:%d (público)", endpoint.Get("ipAddress").String(), endpoint.Get("port").Int()))
+	}
+
+	ips := []string{container.PrimaryIPAddress}
+	if mode := gjson.Get(raw, "networkMode").String(); mode != "" {
+		ips = append(ips, "rede "+mode)
+	}
+
+	var labels []string
+	gjson.Get(raw, "labels").ForEach(func(key, value gjson.Result) bool {
+		labels = append(labels, key.String()+"="+value.String())
+		return true
+	})
+	sort.Strings(labels)
+
+	var volumes []string
+	for _, volume := range gjson.Get(raw, "dataVolumes").Array() {
+		volumes = append(volumes, volume.String())
+	}
+	for _, from := range gjson.Get(raw, "dataVolumesFrom").Array() {
+		volumes = append(volumes, "volumes de "+from.String())
+	}
+
+	service := "-"
+	if container.ServiceID() != "" {
+		service = fmt.Sprintf("%s (`%s`)", serviceIndex.Name(container.ServiceID()), container.ServiceID())
+	}
+
+	return slack.Attachment{
+		Title:      fmt.Sprintf("Container %s (%s)", container.Name, container.ID),
+		Text:       fmt.Sprintf("*Imagem:* `%s`\n*Status:* `%s` | *Health:* `%s` | *Restarts:* %d", strings.TrimPrefix(container.ImageUUID, "docker:"), container.State, container.HealthState, container.StartCount),
+		Color:      "#0C648A",
+		CallbackID: actionInspectJSON,
+		Fields: []slack.AttachmentField{
+			{Title: "Host", Value: inspectHost(container.HostID), Short: true},
+			{Title: "Serviço", Value: service, Short: true},
+			{Title: "IPs", Value: inspectList(ips), Short: true},
+			{Title: "Portas", Value: inspectList(ports), Short: true},
+			{Title: "Links", Value: inspectList(inspectLinks(raw, container.ServiceID())), Short: false},
+			{Title: "Volumes", Value: inspectList(volumes), Short: false},
+			{Title: "Labels", Value: inspectList(labels), Short: false},
+		},
+		Actions: []slack.AttachmentAction{
+			{
+				Name:  actionInspectJSON,
+				Text:  "JSON",
+				Type:  "button",
+				Value: container.ID,
+			},
+		},
+	}
+}
+
+// inspectRawJSON é o JSON do container para o snippet, sem os links e ações
+// da API e com os valores das variáveis de ambiente escondidos
+func inspectRawJSON(raw string) string {
+	var resource map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &resource); err != nil {
+		return RedactText(raw)
+	}
+
+	delete(resource, "links")
+	delete(resource, "actions")
+	if environment, ok := resource["environment"].(map[string]interface{}); ok {
+		for key := range environment {
+			environment[key] = "***"
+		}
+	}
+
+	data, _ := json.MarshalIndent(resource, "", "  ")
+	return RedactText(string(data))
+}
+
+// slackInspect mostra as portas, IPs, links, labels, volumes e o host do
+// container, pelo ID ou nome, ou o menu com os containers
+func (s *SlackListener) slackInspect(ev *slack.MessageEvent) {
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", inspectContainer), false))
+		return
+	}
+
+	args := strings.Fields(ev.Msg.Text)[2:]
+	if len(args) == 0 {
+		s.createAndSendAttachment(ev, "Qual container deseja inspecionar? :mag:", inspectContainer, getContainers(), nil)
+		return
+	}
+
+	container, err := findContainer(args[0])
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(":mag: "+err.Error(), false))
+		return
+	}
+
+	if tenant := TenantForChannel(ev.Channel); tenant != nil && !tenant.AllowsTarget(container.ID) {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: `%s` não é de uma stack do time `%s`", container.Name, tenant.Name), false))
+		return
+	}
+
+	raw, err := rancherListener.ContainerJSON(container.ID)
+	if err != nil {
+		CheckErr("Erro ao inspecionar o container "+container.ID, err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao buscar o container `%s`: %s", container.ID, err), false))
+		return
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(inspectAttachment(raw)))
+}
+
+// actionInspectFunction mostra o inspect do container escolhido no menu
+func actionInspectFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	ID := message.Actions[0].SelectedOptions[0].Value
+
+	raw, err := rancherListener.ContainerJSON(ID)
+	if err != nil {
+		CheckErr("Erro ao inspecionar o container "+ID, err)
+		responseMessage(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao buscar o container `%s`", ID), err.Error())
+		return
+	}
+
+	originalMessage := message.OriginalMessage
+	originalMessage.Attachments = []slack.Attachment{inspectAttachment(raw)}
+
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&originalMessage)
+}
+
+// actionInspectJSONFunction envia o JSON do container como snippet, que o
+// Slack permite copiar e baixar
+func actionInspectJSONFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	ID := message.Actions[0].Value
+
+	raw, err := rancherListener.ContainerJSON(ID)
+	if err != nil {
+		CheckErr("Erro ao buscar o JSON do container "+ID, err)
+		respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao buscar o JSON do container `%s`", ID), err.Error())
+		return
+	}
+
+	_, err = getAPIConnection().client.UploadFile(slack.FileUploadParameters{
+		Content:         inspectRawJSON(raw),
+		Filetype:        "json",
+		Filename:        fmt.Sprintf("container-%s.json", ID),
+		Title:           fmt.Sprintf("Container %s", gjson.Get(raw, "name").String()),
+		Channels:        []string{message.Channel.ID},
+		ThreadTimestamp: message.MessageTs,
+	})
+	if err != nil {
+		CheckErr("Erro ao enviar o JSON do container "+ID, err)
+		respondWithoutActions(w, message.OriginalMessage, ":x: Erro ao enviar o JSON do container", err.Error())
+		return
+	}
+
+	log.Printf("[INFO] JSON do container %s enviado para %s\n", ID, message.User.Name)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,332 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	intentCallback  = "intent"
+	actionIntentRun = "intent-run"
+
+	intentParserRules = "rules"
+	intentParserHTTP  = "http"
+	intentParserOff   = "off"
+)
+
+var (
+	// IntentParserBackend é o parser das mensagens que não são comandos:
+	// "rules" (padrão), "http" (serviço externo de NLU/LLM) ou "off"
+	IntentParserBackend = intentParserRules
+
+	// IntentParserURL é a URL do serviço externo de NLU/LLM
+	IntentParserURL string
+
+	// IntentParserToken é o token (bearer) do serviço externo de NLU/LLM
+	IntentParserToken string
+)
+
+// Intent é o que o usuário pediu, já convertido para os comandos do BOT
+// (ex.: ["environment prod", "restart-service 1s42"])
+type Intent struct {
+	Commands []string `json:"commands"`
+}
+
+// IntentParser converte uma frase em comandos do BOT. Retorna nil quando não
+// entende a frase
+type IntentParser interface {
+	Parse(text string) (*Intent, error)
+}
+
+// intentParser retorna o parser configurado em INTENT_PARSER
+func intentParser() IntentParser {
+	switch IntentParserBackend {
+	case intentParserOff:
+		return nil
+	case intentParserHTTP:
+		return httpIntentParser{url: IntentParserURL, token: IntentParserToken}
+	default:
+		return ruleIntentParser{}
+	}
+}
+
+// intentRule é uma intenção reconhecida pelas palavras-chave
+type intentRule struct {
+	command  string
+	keywords []string
+	service  bool
+	number   bool
+	image    bool
+}
+
+var intentRules = []intentRule{
+	{command: scaleService, keywords: []string{"scale", "escala", "escalar", "escale"}, service: true, number: true},
+	{command: upgradeService, keywords: []string{"upgrade", "deploy", "atualiza", "atualizar", "atualize", "update"}, service: true, image: true},
+	{command: restartService, keywords: []string{"restart", "reinicia", "reiniciar", "reinicie", "reboot", "bounce"}, service: true},
+	{command: serviceLogs, keywords: []string{"logs", "log"}},
+	{command: listService, keywords: []string{"list", "lista", "listar", "liste"}},
+	{command: listJobs, keywords: []string{"jobs", "tarefas", "fila"}},
+	{command: find, keywords: []string{"find", "search", "procura", "procurar", "busca", "buscar", "onde", "where"}},
+}
+
+var intentWordRegex = regexp.MustCompile(`[^\p{L}\p{N}:/._@-]+`)
+
+// ruleIntentParser reconhece as intenções pelas palavras-chave e os
+// parâmetros pelos nomes dos serviços (índice de serviços), números, imagens
+// (com ":") e nomes dos ambientes configurados
+type ruleIntentParser struct{}
+
+func (ruleIntentParser) Parse(text string) (*Intent, error) {
+	words := intentWordRegex.Split(strings.ToLower(text), -1)
+
+	for _, rule := range intentRules {
+		at := -1
+		for i, word := range words {
+			for _, keyword := range rule.keywords {
+				if word == keyword {
+					at = i
+				}
+			}
+		}
+
+		if at < 0 {
+			continue
+		}
+
+		args := []string{rule.command}
+		rest := append(append([]string{}, words[:at]...), words[at+1:]...)
+
+		if rule.command == find {
+			query := strings.Join(intentContentWords(words[at+1:]), " ")
+			if query == "" {
+				return nil, nil
+			}
+			args = append(args, query)
+		}
+
+		if rule.service {
+			service, ok := intentService(rest)
+			if !ok {
+				return nil, nil
+			}
+			args = append(args, service.ID)
+		}
+
+		if rule.image {
+			image := intentImage(rest)
+			if image == "" {
+				return nil, nil
+			}
+			args = append(args, image)
+		}
+
+		if rule.number {
+			number := intentNumber(rest)
+			if number == "" {
+				return nil, nil
+			}
+			args = append(args, number)
+		}
+
+		intent := &Intent{Commands: []string{strings.Join(args, " ")}}
+
+		// "em prod", "in staging"... troca o ambiente antes do comando
+		for _, word := range words {
+			if _, ok := orchestrators[word]; ok && word != orchestratorEnvironment {
+				intent.Commands = append([]string{environment + " " + word}, intent.Commands...)
+			}
+		}
+
+		return intent, nil
+	}
+
+	return nil, nil
+}
+
+// intentStopWords são as palavras ignoradas na busca
+var intentStopWords = map[string]bool{
+	"o": true, "a": true, "os": true, "as": true, "do": true, "da": true, "de": true, "no": true, "na": true, "em": true, "por": true, "favor": true, "pode": true, "você": true, "voce": true, "está": true, "esta": true, "serviço": true, "servico": true, "container": true,
+	"the": true, "in": true, "on": true, "of": true, "is": true, "can": true, "you": true, "please": true, "for": true, "service": true, "": true,
+}
+
+func intentContentWords(words []string) []string {
+	var content []string
+	for _, word := range words {
+		if !intentStopWords[word] {
+			content = append(content, word)
+		}
+	}
+
+	return content
+}
+
+// intentService procura o nome de um serviço nas palavras, também juntando
+// palavras seguidas com "-" (ex.: "payments api" vira "payments-api")
+func intentService(words []string) (Workload, bool) {
+	for size := 3; size >= 1; size-- {
+		for i := 0; i+size <= len(words); i++ {
+			for _, sep := range []string{"-", "_", " "} {
+				if service, ok := serviceIndex.Match(strings.Join(words[i:i+size], sep)); ok {
+					return service, true
+				}
+			}
+		}
+	}
+
+	return Workload{}, false
+}
+
+func intentNumber(words []string) string {
+	for _, word := range words {
+		if n, err := strconv.Atoi(word); err == nil && n >= 0 {
+			return word
+		}
+	}
+
+	return ""
+}
+
+func intentImage(words []string) string {
+	for _, word := range words {
+		if strings.Contains(word, ":") && !strings.HasSuffix(word, ":") {
+			if !strings.HasPrefix(word, "docker:") {
+				word = "docker:" + word
+			}
+			return word
+		}
+	}
+
+	return ""
+}
+
+// httpIntentParser envia a frase e os comandos disponíveis para um serviço
+// externo (NLU ou LLM), que responde com os comandos, no formato do Intent
+type httpIntentParser struct {
+	url   string
+	token string
+}
+
+func (p httpIntentParser) Parse(text string) (*Intent, error) {
+	headers := map[string]string{}
+	if p.token != "" {
+		headers["Authorization"] = "Bearer " + p.token
+	}
+
+	resp, err := HTTPSendJSONRequest(PostHTTP, p.url, headers, map[string]interface{}{
+		"text":     text,
+		"commands": Commands,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var intent Intent
+	if err := json.Unmarshal([]byte(resp), &intent); err != nil {
+		return nil, fmt.Errorf("resposta inválida do parser de intenções: %s", err)
+	}
+
+	// Só aceita comandos que existem
+	for _, command := range intent.Commands {
+		if fields := strings.Fields(command); len(fields) == 0 || CommandHelpMessage(fields[0]) == "" {
+			return nil, fmt.Errorf("o parser de intenções retornou o comando desconhecido %s", command)
+		}
+	}
+
+	if len(intent.Commands) == 0 {
+		return nil, nil
+	}
+
+	return &intent, nil
+}
+
+// handleIntent tenta entender a mensagem que não é um comando, pedindo a
+// confirmação antes de executar. Retorna se a mensagem foi entendida
+func (s *SlackListener) handleIntent(ev *slack.MessageEvent) bool {
+	parser := intentParser()
+	if parser == nil {
+		return false
+	}
+
+	text := strings.TrimSpace(strings.Replace(ev.Msg.Text, fmt.Sprintf("<@%s>", s.botID), "", 1))
+
+	intent, err := parser.Parse(text)
+	if err != nil {
+		CheckErr("Erro ao interpretar a mensagem", err)
+		return false
+	}
+
+	if intent == nil || len(intent.Commands) == 0 {
+		return false
+	}
+
+	log.Printf("[INFO] Mensagem \"%s\" do usuário %s interpretada como %v\n", text, ev.Msg.User, intent.Commands)
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(slack.Attachment{
+		Text:       fmt.Sprintf("Entendi que você quer executar:\n```%s```", "@bot "+strings.Join(intent.Commands, "\n@bot ")),
+		Color:      "#0C648A",
+		CallbackID: intentCallback,
+		Actions: []slack.AttachmentAction{
+			{
+				Name:  actionIntentRun,
+				Text:  "Executar",
+				Type:  "button",
+				Style: "primary",
+				Value: ev.Msg.User + "\n" + strings.Join(intent.Commands, "\n"),
+			},
+			{
+				Name:  actionCancel,
+				Text:  "Cancelar",
+				Type:  "button",
+				Style: "danger",
+			},
+		},
+	}))
+
+	return true
+}
+
+// actionIntentRunFunction executa os comandos confirmados, como se o usuário
+// tivesse enviado cada um deles
+func actionIntentRunFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	lines := strings.Split(message.Actions[0].Value, "\n")
+	if len(lines) < 2 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	requester, commands := lines[0], lines[1:]
+
+	if message.User.ID != requester {
+		w.Header().Add("Content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"response_type":    "ephemeral",
+			"replace_original": false,
+			"text":             fmt.Sprintf("Só <@%s> pode confirmar este pedido", requester),
+		})
+		return
+	}
+
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":white_check_mark: Confirmado por @%s", message.User.Name), "")
+
+	api := getAPIConnection()
+
+	go func() {
+		for _, command := range commands {
+			api.handleMessageEvent(&slack.MessageEvent{Msg: slack.Msg{
+				Channel: message.Channel.ID,
+				User:    requester,
+				Text:    fmt.Sprintf("<@%s> %s", api.botID, command),
+			}})
+		}
+	}()
+}
@@ -0,0 +1,302 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	jenkinsDialogCallback = "jenkins-build"
+
+	// jenkinsMaxParameters é a quantidade máxima de campos de um dialog do Slack
+	jenkinsMaxParameters = 10
+)
+
+var (
+	// JenkinsURL é a URL do Jenkins
+	JenkinsURL string
+
+	// JenkinsUser é o usuário usado na API do Jenkins
+	JenkinsUser string
+
+	// JenkinsToken é o API token do usuário do Jenkins
+	JenkinsToken string
+
+	// JenkinsJobs são os jobs que podem ser disparados pelo BOT (ex.: deploy-api,infra/deploy-worker).
+	// Caso vazio, são listados todos os jobs da raiz do Jenkins
+	JenkinsJobs []string
+)
+
+// jenkinsJobPath converte o nome do job (com pastas separadas por /) para o caminho na URL
+func jenkinsJobPath(job string) string {
+	var parts []string
+	for _, name := range strings.Split(job, "/") {
+		parts = append(parts, "job", url.PathEscape(name))
+	}
+
+	return "/" + strings.Join(parts, "/")
+}
+
+// jenkinsRequest envia uma requisição para o Jenkins (path relativo ou URL
+// completa), retornando o body e o header Location da resposta
+func jenkinsRequest(method string, path string, form url.Values) (string, string, error) {
+	if !strings.HasPrefix(path, "http") {
+		path = JenkinsURL + path
+	}
+
+	body := strings.NewReader("")
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequest(method, path, body)
+	if err != nil {
+		return "", "", err
+	}
+
+	req.SetBasicAuth(JenkinsUser, JenkinsToken)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := externalHTTPClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	response := ConvertResponseToString(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return response, "", fmt.Errorf("%s %s retornou %d", method, path, resp.StatusCode)
+	}
+
+	return response, resp.Header.Get("Location"), nil
+}
+
+// ListJenkinsJobs retorna os jobs configurados, ou os jobs da raiz do Jenkins
+func ListJenkinsJobs() ([]string, error) {
+	if len(JenkinsJobs) > 0 {
+		return JenkinsJobs, nil
+	}
+
+	resp, _, err := jenkinsRequest(GetHTTP, "/api/json?tree=jobs[name]", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []string
+	for _, job := range gjson.Get(resp, "jobs.#.name").Array() {
+		jobs = append(jobs, job.String())
+	}
+
+	return jobs, nil
+}
+
+// JenkinsParameter é um parâmetro de build de um job
+type JenkinsParameter struct {
+	Name        string
+	Default     string
+	Description string
+}
+
+// GetJenkinsParameters retorna os parâmetros de build do job
+func GetJenkinsParameters(job string) ([]JenkinsParameter, error) {
+	resp, _, err := jenkinsRequest(GetHTTP, jenkinsJobPath(job)+"/api/json?tree=property[parameterDefinitions[name,description,defaultParameterValue[value]]]", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var params []JenkinsParameter
+	for _, def := range gjson.Get(resp, "property.#.parameterDefinitions|@flatten").Array() {
+		params = append(params, JenkinsParameter{
+			Name:        def.Get("name").String(),
+			Default:     def.Get("defaultParameterValue.value").String(),
+			Description: def.Get("description").String(),
+		})
+	}
+
+	return params, nil
+}
+
+// TriggerJenkinsBuild dispara o build do job, retornando a URL do item na fila
+func TriggerJenkinsBuild(job string, params map[string]string) (string, error) {
+	path := jenkinsJobPath(job) + "/build"
+
+	form := url.Values{}
+	if len(params) > 0 {
+		path = jenkinsJobPath(job) + "/buildWithParameters"
+		for key, value := range params {
+			form.Set(key, value)
+		}
+	}
+
+	_, location, err := jenkinsRequest(PostHTTP, path, form)
+
+	return location, err
+}
+
+// waitJenkinsBuild aguarda o item sair da fila, retornando a URL do build
+func waitJenkinsBuild(queueURL string) (string, error) {
+	deadline := time.Now().Add(PipelineTimeout)
+
+	for time.Now().Before(deadline) {
+		resp, _, err := jenkinsRequest(GetHTTP, strings.TrimSuffix(queueURL, "/")+"/api/json", nil)
+		if err != nil {
+			return "", err
+		}
+
+		if gjson.Get(resp, "cancelled").Bool() {
+			return "", fmt.Errorf("build cancelado na fila")
+		}
+
+		if buildURL := gjson.Get(resp, "executable.url").String(); buildURL != "" {
+			return buildURL, nil
+		}
+
+		time.Sleep(PipelinePollInterval)
+	}
+
+	return "", fmt.Errorf("build não saiu da fila após %s", PipelineTimeout)
+}
+
+// JenkinsBuildStatus retorna o status do build
+func JenkinsBuildStatus(buildURL string) (PipelineStatus, error) {
+	resp, _, err := jenkinsRequest(GetHTTP, strings.TrimSuffix(buildURL, "/")+"/api/json?tree=building,result", nil)
+	if err != nil {
+		return PipelineStatus{}, err
+	}
+
+	status := PipelineStatus{
+		State: "running",
+		URL:   strings.TrimSuffix(buildURL, "/") + "/console",
+	}
+
+	if !gjson.Get(resp, "building").Bool() && gjson.Get(resp, "result").String() != "" {
+		status.State = gjson.Get(resp, "result").String()
+		status.Finished = true
+		status.Success = status.State == "SUCCESS"
+	}
+
+	return status, nil
+}
+
+func (s *SlackListener) slackJenkinsBuild(ev *slack.MessageEvent) {
+	jobs, err := ListJenkinsJobs()
+	if err != nil {
+		CheckErr("Erro ao listar jobs do Jenkins", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao listar os jobs do Jenkins: %s", err), false))
+		return
+	}
+
+	var options []slack.AttachmentActionOption
+	for _, job := range jobs {
+		options = append(options, slack.AttachmentActionOption{Text: job, Value: job})
+	}
+
+	s.createAndSendAttachment(
+		ev,
+		"Qual job do Jenkins deseja executar? :hammer_and_wrench:",
+		jenkinsBuild,
+		options,
+		nil,
+	)
+}
+
+// actionJenkinsBuild abre o dialog com os parâmetros do job selecionado, ou
+// dispara o build direto caso o job não tenha parâmetros
+func actionJenkinsBuild(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	job := message.Actions[0].SelectedOptions[0].Value
+
+	params, err := GetJenkinsParameters(job)
+	if err != nil {
+		CheckErr("Erro ao buscar parâmetros do job do Jenkins", err)
+		responseMessage(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao buscar os parâmetros do job `%s`", job), err.Error())
+		return
+	}
+
+	if len(params) == 0 {
+		responseMessage(w, message.OriginalMessage, fmt.Sprintf("Job `%s` disparado por @%s", job, message.User.Name), "")
+		go startJenkinsBuild(message.Channel.ID, job, nil, message.User.Name)
+		return
+	}
+
+	if len(params) > jenkinsMaxParameters {
+		params = params[:jenkinsMaxParameters]
+	}
+
+	var elements []slack.DialogElement
+	for _, param := range params {
+		elements = append(elements, &slack.TextInputElement{
+			DialogInput: slack.DialogInput{Type: "text", Label: truncate(param.Name, 48), Name: param.Name, Optional: true},
+			Hint:        truncate(param.Description, dialogTextMaxLength),
+			Value:       param.Default,
+		})
+	}
+
+	dialog := slack.Dialog{
+		CallbackID:  jenkinsDialogCallback,
+		Title:       "Executar job",
+		SubmitLabel: "Executar",
+		State:       job,
+		Elements:    elements,
+	}
+
+	if err := getAPIConnection().client.OpenDialog(message.TriggerID, dialog); err != nil {
+		CheckErr("Erro ao abrir o dialog do Jenkins", err)
+		responseMessage(w, message.OriginalMessage, ":x: Erro ao abrir os parâmetros do job", err.Error())
+		return
+	}
+
+	responseMessage(w, message.OriginalMessage, fmt.Sprintf("Preenchendo os parâmetros do job `%s`...", job), "")
+}
+
+func jenkinsDialogSubmission(submission DialogSubmission, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	go startJenkinsBuild(submission.Channel.ID, submission.State, submission.Submission, submission.User.Name)
+}
+
+// startJenkinsBuild dispara o build e acompanha a execução até o resultado final
+func startJenkinsBuild(channel string, job string, params map[string]string, user string) {
+	api := getAPIConnection()
+
+	queueURL, err := TriggerJenkinsBuild(job, params)
+	if err != nil {
+		CheckErr("Erro ao disparar build no Jenkins", err)
+		api.client.PostMessage(channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao disparar o job `%s`: %s", job, err), false))
+		return
+	}
+
+	log.Printf("[INFO] Job %s do Jenkins disparado pelo usuário %s\n", job, user)
+
+	title := fmt.Sprintf("Jenkins `%s`", job)
+	channel, ts, err := api.client.PostMessage(channel, slack.MsgOptionAttachments(pipelineAttachment(title, PipelineStatus{State: "queued"})))
+	if err != nil {
+		CheckErr("Erro ao enviar mensagem do build", err)
+		return
+	}
+
+	buildURL, err := waitJenkinsBuild(queueURL)
+	if err != nil {
+		CheckErr("Erro ao aguardar build do Jenkins", err)
+		api.client.PostMessage(channel, slack.MsgOptionText(fmt.Sprintf(":warning: %s", err), false), slack.MsgOptionTS(ts))
+		return
+	}
+
+	api.client.PostMessage(channel, slack.MsgOptionText(fmt.Sprintf("Console: %sconsole", buildURL), false), slack.MsgOptionTS(ts))
+
+	TrackPipeline(channel, ts, title, func() (PipelineStatus, error) {
+		return JenkinsBuildStatus(buildURL)
+	})
+}
@@ -0,0 +1,181 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	jiraDialogCallback = "jira-ticket"
+
+	actionJiraTicket = "jira-ticket"
+
+	// Limites dos campos de texto dos dialogs do Slack
+	dialogTextMaxLength     = 150
+	dialogTextAreaMaxLength = 3000
+)
+
+var (
+	// JiraURL é a URL base do Jira (ex.: https://empresa.atlassian.net)
+	JiraURL string
+
+	// JiraUser é o usuário (e-mail no Jira Cloud) usado na API
+	JiraUser string
+
+	// JiraToken é o API token (ou senha) do usuário do Jira
+	JiraToken string
+
+	// JiraProject é a chave do projeto padrão onde os tickets são criados
+	JiraProject string
+
+	// JiraIssueType é o tipo das issues criadas pelo BOT
+	JiraIssueType = "Bug"
+)
+
+// JiraEnabled retorna se a integração com o Jira está configurada
+func JiraEnabled() bool {
+	return JiraURL != "" && JiraToken != ""
+}
+
+// jiraTicketAction é o botão de criar ticket adicionado nas mensagens de erro e alertas
+func jiraTicketAction() slack.AttachmentAction {
+	return slack.AttachmentAction{
+		Name: actionJiraTicket,
+		Text: "Criar ticket",
+		Type: "button",
+	}
+}
+
+// CreateJiraIssue cria uma issue no Jira, retornando a chave (ex.: OPS-123)
+func CreateJiraIssue(project string, summary string, description string) (string, error) {
+	auth := base64.StdEncoding.EncodeToString([]byte(JiraUser + ":" + JiraToken))
+
+	resp, err := HTTPSendJSONRequest(PostHTTP, JiraURL+"/rest/api/2/issue", map[string]string{"Authorization": "Basic " + auth}, map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": project},
+			"summary":     summary,
+			"description": description,
+			"issuetype":   map[string]string{"name": JiraIssueType},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return gjson.Get(resp, "key").String(), nil
+}
+
+// JiraIssueURL retorna o link da issue no Jira
+func JiraIssueURL(key string) string {
+	return fmt.Sprintf("%s/browse/%s", JiraURL, key)
+}
+
+// messageContext junta título, texto e rodapé dos attachments da mensagem,
+// usado para preencher o ticket com o contexto do incidente
+func messageContext(message slack.Message) (string, string) {
+	var title string
+	var lines []string
+
+	if message.Text != "" {
+		lines = append(lines, message.Text)
+	}
+
+	for _, attachment := range message.Attachments {
+		if title == "" {
+			title = attachment.Title
+		}
+
+		for _, text := range []string{attachment.Title, attachment.Text, attachment.Footer} {
+			if text != "" {
+				lines = append(lines, text)
+			}
+		}
+	}
+
+	if title == "" && len(lines) > 0 {
+		title = strings.SplitN(lines[0], "\n", 2)[0]
+	}
+
+	return title, strings.Join(lines, "\n")
+}
+
+func truncate(text string, maxLength int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+
+	return string(runes[:maxLength-3]) + "..."
+}
+
+// actionJiraTicketFunction abre o dialog de criação do ticket, já preenchido
+// com o contexto da mensagem
+func actionJiraTicketFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	summary, description := messageContext(message.OriginalMessage)
+	description = fmt.Sprintf("%s\n\nCriado pelo Slack por @%s", description, message.User.Name)
+
+	summaryInput := &slack.TextInputElement{
+		DialogInput: slack.DialogInput{Type: "text", Label: "Título", Name: "summary"},
+		MaxLength:   dialogTextMaxLength,
+		Value:       truncate(summary, dialogTextMaxLength),
+	}
+
+	projectInput := &slack.TextInputElement{
+		DialogInput: slack.DialogInput{Type: "text", Label: "Projeto", Name: "project"},
+		Value:       JiraProject,
+	}
+
+	descriptionInput := &slack.TextInputElement{
+		DialogInput: slack.DialogInput{Type: "textarea", Label: "Descrição", Name: "description"},
+		MaxLength:   dialogTextAreaMaxLength,
+		Value:       truncate(description, dialogTextAreaMaxLength),
+	}
+
+	dialog := slack.Dialog{
+		CallbackID:  jiraDialogCallback,
+		Title:       "Criar ticket no Jira",
+		SubmitLabel: "Criar",
+		State:       message.Channel.ID + "|" + message.MessageTs,
+		Elements:    []slack.DialogElement{summaryInput, projectInput, descriptionInput},
+	}
+
+	if err := getAPIConnection().client.OpenDialog(message.TriggerID, dialog); err != nil {
+		CheckErr("Erro ao abrir o dialog do Jira", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// jiraDialogSubmission cria a issue com os dados do dialog e responde na
+// thread da mensagem original com o link do ticket
+func jiraDialogSubmission(submission DialogSubmission, w http.ResponseWriter) {
+	// Responde logo ao Slack para o dialog ser fechado
+	w.WriteHeader(http.StatusOK)
+
+	state := strings.SplitN(submission.State, "|", 2)
+	channel, threadTs := state[0], ""
+	if len(state) == 2 {
+		threadTs = state[1]
+	}
+
+	api := getAPIConnection()
+
+	key, err := CreateJiraIssue(submission.Submission["project"], submission.Submission["summary"], submission.Submission["description"])
+	if err != nil {
+		CheckErr("Erro ao criar issue no Jira", err)
+		api.client.PostMessage(channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao criar o ticket no Jira: %s", err), false), slack.MsgOptionTS(threadTs))
+		return
+	}
+
+	log.Printf("[INFO] Issue %s criada no Jira pelo usuário %s\n", key, submission.User.Name)
+	api.client.PostMessage(channel, slack.MsgOptionText(fmt.Sprintf(":ticket: Ticket <%s|%s> criado por @%s", JiraIssueURL(key), key, submission.User.Name), false), slack.MsgOptionTS(threadTs))
+}
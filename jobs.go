@@ -0,0 +1,459 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	jobQueued   = "na fila"
+	jobRunning  = "executando"
+	jobDone     = "concluído"
+	jobFailed   = "falhou"
+	jobCanceled = "cancelado"
+
+	actionJobCancel = "job-cancel"
+
+	// jobsHistory é a quantidade de jobs finalizados mostrados no comando jobs
+	jobsHistory = 10
+)
+
+var (
+	// JobsWorkers é a quantidade de jobs executados ao mesmo tempo
+	JobsWorkers = 4
+
+	// JobsQueueSize é a quantidade máxima de jobs esperando na fila
+	JobsQueueSize = 100
+)
+
+// Job é uma ação demorada (logs, upgrades, canary) executada fora do handler
+// HTTP, para o Slack receber a resposta dentro dos 3 segundos
+type Job struct {
+	ID         int
+	Name       string
+	User       string
+	Status     string
+	Error      string
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+	CanceledBy string
+
+	// sandbox marca os jobs colocados na fila pelo replay do sandbox, que
+	// mantêm os stubs do Slack e do Rancher ligados até terminarem
+	sandbox bool
+
+	// cancelable indica se a ação recebe o ctx e para quando ele é cancelado.
+	// Os demais jobs só podem ser cancelados enquanto esperam na fila
+	cancelable bool
+
+	// charge são os usos da ação nas cotas do time, devolvidos se o job falhar
+	charge *QuotaCharge
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	run    func(ctx context.Context) error
+}
+
+var (
+	jobQueue   chan *Job
+	jobs       []*Job
+	jobsMutex  sync.Mutex
+	lastJobID  int
+	jobsWorker sync.Once
+)
+
+// StartJobWorkers inicia os workers que executam os jobs da fila
+func StartJobWorkers() {
+	jobsWorker.Do(func() {
+		jobQueue = make(chan *Job, JobsQueueSize)
+
+		for i := 0; i < JobsWorkers; i++ {
+			go jobWorker()
+		}
+
+		log.Printf("[INFO] %d workers de jobs iniciados\n", JobsWorkers)
+	})
+}
+
+func jobWorker() {
+	for job := range jobQueue {
+		processJob(job)
+	}
+}
+
+func processJob(job *Job) {
+	if job.sandbox {
+		defer sandboxRelease()
+	}
+
+	// Cancelado enquanto esperava na fila
+	if job.ctx.Err() != nil {
+		job.setStatus(jobCanceled, nil)
+		job.refund()
+		return
+	}
+
+	job.setStatus(jobRunning, nil)
+
+	err := runJob(job)
+	job.cancel()
+
+	if job.canceled() {
+		job.setStatus(jobCanceled, err)
+		job.refund()
+		msg := fmt.Sprintf(":no_entry_sign: Job #%d (%s) cancelado por @%s", job.ID, job.Name, job.CanceledBy)
+		if err != nil && err != context.Canceled {
+			msg += fmt.Sprintf(", resultado parcial: %s", err)
+		}
+		sendMessage(msg)
+		return
+	}
+
+	if err != nil {
+		job.setStatus(jobFailed, err)
+		job.refund()
+		CheckErr(fmt.Sprintf("Erro no job #%d (%s)", job.ID, job.Name), err)
+		sendActionError(fmt.Sprintf(":x: Job #%d (%s) de @%s falhou", job.ID, job.Name, job.User), err)
+		return
+	}
+
+	job.setStatus(jobDone, nil)
+	log.Printf("[INFO] Job #%d (%s) concluído em %s\n", job.ID, job.Name, job.FinishedAt.Sub(job.StartedAt))
+}
+
+// runJob executa o job sem derrubar o worker caso ele entre em panic
+func runJob(job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return job.run(job.ctx)
+}
+
+// canceled informa se o job foi cancelado por um usuário
+func (j *Job) canceled() bool {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	return j.CanceledBy != ""
+}
+
+func (j *Job) setStatus(status string, err error) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	j.Status = status
+	switch status {
+	case jobRunning:
+		j.StartedAt = time.Now()
+	case jobDone, jobFailed, jobCanceled:
+		j.FinishedAt = time.Now()
+	}
+
+	if err != nil {
+		j.Error = err.Error()
+	}
+}
+
+// refundOnFailure devolve os usos da cota se o job falhar ou for cancelado,
+// na hora quando ele já terminou assim
+func (j *Job) refundOnFailure(charge *QuotaCharge) {
+	jobsMutex.Lock()
+	finished := j.Status == jobFailed || j.Status == jobCanceled
+	if !finished {
+		j.charge = charge
+	}
+	jobsMutex.Unlock()
+
+	if finished {
+		charge.Refund()
+	}
+}
+
+// refund devolve os usos da cota do job que falhou
+func (j *Job) refund() {
+	jobsMutex.Lock()
+	charge := j.charge
+	j.charge = nil
+	jobsMutex.Unlock()
+
+	charge.Refund()
+}
+
+// EnqueueJob coloca a ação na fila dos workers, retornando o job criado. Com
+// a fila cheia o job não é criado e é retornado erro. A ação não recebe o ctx,
+// então o job só pode ser cancelado enquanto espera na fila
+func EnqueueJob(name string, user string, run func() error) (*Job, error) {
+	return enqueueJob(name, user, false, func(ctx context.Context) error {
+		return run()
+	})
+}
+
+// EnqueueJobContext é igual ao EnqueueJob, mas o ctx passado para a ação é
+// cancelado pelo CancelJob, também durante a execução. A ação deve parar
+// assim que possível, retornando o que já foi feito no erro (resultado
+// parcial)
+func EnqueueJobContext(name string, user string, run func(ctx context.Context) error) (*Job, error) {
+	return enqueueJob(name, user, true, run)
+}
+
+func enqueueJob(name string, user string, cancelable bool, run func(ctx context.Context) error) (*Job, error) {
+	if ShuttingDown() {
+		return nil, fmt.Errorf("o BOT está sendo desligado, tente novamente em instantes")
+	}
+
+	StartJobWorkers()
+
+	jobsMutex.Lock()
+	lastJobID++
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		ID:         lastJobID,
+		Name:       name,
+		User:       user,
+		Status:     jobQueued,
+		CreatedAt:  time.Now(),
+		cancel:     cancel,
+		run:        run,
+		cancelable: cancelable,
+		sandbox:    sandboxHold(),
+	}
+	job.ctx = context.WithValue(ctx, jobContextKey{}, job)
+	if job.sandbox {
+		job.ctx = context.WithValue(job.ctx, sandboxReplayKey{}, true)
+	}
+	jobsMutex.Unlock()
+
+	select {
+	case jobQueue <- job:
+	default:
+		cancel()
+		if job.sandbox {
+			sandboxRelease()
+		}
+		return nil, fmt.Errorf("fila de jobs cheia (%d jobs esperando)", JobsQueueSize)
+	}
+
+	jobsMutex.Lock()
+	jobs = append(jobs, job)
+	pruneJobs()
+	jobsMutex.Unlock()
+
+	log.Printf("[INFO] Job #%d (%s) de %s na fila\n", job.ID, name, user)
+
+	return job, nil
+}
+
+// DrainJobs espera os jobs na fila e em execução terminarem, até o ctx
+// expirar, retornando quantos não terminaram
+func DrainJobs(ctx context.Context) int {
+	for {
+		pending := pendingJobs()
+		if pending == 0 {
+			return 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return pending
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// jobContextKey é a chave do job no ctx passado para a ação
+type jobContextKey struct{}
+
+// JobFromContext retorna o job que está executando a ação
+func JobFromContext(ctx context.Context) *Job {
+	job, _ := ctx.Value(jobContextKey{}).(*Job)
+	return job
+}
+
+// FindJob busca o job pelo ID entre os jobs mantidos na lista
+func FindJob(ID int) (*Job, bool) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	for _, job := range jobs {
+		if job.ID == ID {
+			return job, true
+		}
+	}
+
+	return nil, false
+}
+
+// CancelJob cancela o job na fila ou em execução
+func CancelJob(ID int, user string) (*Job, error) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	for _, job := range jobs {
+		if job.ID != ID {
+			continue
+		}
+
+		if job.Status != jobQueued && job.Status != jobRunning {
+			return nil, fmt.Errorf("o job #%d já foi finalizado (%s)", ID, job.Status)
+		}
+
+		if job.Status == jobRunning && !job.cancelable {
+			return nil, fmt.Errorf("o job #%d (%s) não pode ser interrompido durante a execução", ID, job.Name)
+		}
+
+		if job.CanceledBy == "" {
+			job.CanceledBy = user
+			job.cancel()
+			log.Printf("[INFO] Job #%d (%s) cancelado pelo usuário %s\n", job.ID, job.Name, user)
+		}
+
+		return job, nil
+	}
+
+	return nil, fmt.Errorf("job #%d não encontrado", ID)
+}
+
+// cancelableIn retorna se o job pode ser cancelado no status: na fila todos
+// e em execução só os que recebem o ctx
+func (j *Job) cancelableIn(status string) bool {
+	return status == jobQueued || (status == jobRunning && j.cancelable)
+}
+
+// jobCancelButton é o botão que cancela o job
+func jobCancelButton(job *Job) slack.AttachmentAction {
+	return slack.AttachmentAction{
+		Name:  actionJobCancel,
+		Text:  fmt.Sprintf("Cancelar #%d", job.ID),
+		Type:  "button",
+		Style: "danger",
+		Value: strconv.Itoa(job.ID),
+	}
+}
+
+func actionJobCancelFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	api := getAPIConnection()
+
+	ID, err := strconv.Atoi(message.Actions[0].Value)
+	if err == nil {
+		_, err = CancelJob(ID, message.User.Name)
+	}
+
+	if err != nil {
+		api.client.PostEphemeral(message.Channel.ID, message.User.ID, slack.MsgOptionText(fmt.Sprintf(":x: %s", err), false))
+		return
+	}
+
+	postEphemeral(message.Channel.ID, message.User.ID, msgJobCanceling, ID)
+}
+
+func pendingJobs() int {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	pending := 0
+	for _, job := range jobs {
+		if job.Status == jobQueued || job.Status == jobRunning {
+			pending++
+		}
+	}
+
+	return pending
+}
+
+// pruneJobs remove os jobs finalizados mais antigos, mantendo o histórico.
+// Precisa ser chamada com o jobsMutex travado
+func pruneJobs() {
+	finished := 0
+	for i := len(jobs) - 1; i >= 0; i-- {
+		if jobs[i].Status != jobDone && jobs[i].Status != jobFailed && jobs[i].Status != jobCanceled {
+			continue
+		}
+
+		finished++
+		if finished > jobsHistory {
+			jobs = append(jobs[:i], jobs[i+1:]...)
+		}
+	}
+}
+
+// queuedJobMessage é o texto de resposta das ações enviadas para a fila
+func queuedJobMessage(job *Job, err error) string {
+	if err != nil {
+		return fmt.Sprintf(":x: %s", err)
+	}
+
+	return fmt.Sprintf(":hourglass_flowing_sand: %s na fila (job #%d), o resultado será enviado no canal", strings.Title(job.Name), job.ID)
+}
+
+// slackJobs lista os jobs na fila, em execução e os últimos finalizados
+func (s *SlackListener) slackJobs(ev *slack.MessageEvent) {
+	jobsMutex.Lock()
+	var lines []string
+	var buttons []slack.AttachmentAction
+	for i := len(jobs) - 1; i >= 0; i-- {
+		job := jobs[i]
+
+		icon := ":hourglass_flowing_sand:"
+		detail := fmt.Sprintf("há %s", formatDuration(time.Since(job.CreatedAt)))
+		switch job.Status {
+		case jobRunning:
+			icon = ":gear:"
+			detail = fmt.Sprintf("há %s", formatDuration(time.Since(job.StartedAt)))
+		case jobDone:
+			icon = ":white_check_mark:"
+			detail = fmt.Sprintf("em %s", formatDuration(job.FinishedAt.Sub(job.StartedAt)))
+		case jobFailed:
+			icon = ":x:"
+			detail = job.Error
+		case jobCanceled:
+			icon = ":no_entry_sign:"
+			detail = "por @" + job.CanceledBy
+		}
+
+		if job.cancelableIn(job.Status) && job.CanceledBy == "" {
+			buttons = append(buttons, jobCancelButton(job))
+		}
+
+		lines = append(lines, fmt.Sprintf("%s *#%d* %s - @%s - %s (%s)", icon, job.ID, job.Name, job.User, job.Status, detail))
+	}
+	jobsMutex.Unlock()
+
+	if len(lines) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText("Nenhum job na fila :sleeping:", false))
+		return
+	}
+
+	// O Slack aceita no máximo 5 botões por attachment
+	var attachments []slack.Attachment
+	for i := 0; i < len(buttons); i += 5 {
+		end := i + 5
+		if end > len(buttons) {
+			end = len(buttons)
+		}
+
+		attachments = append(attachments, slack.Attachment{
+			CallbackID: actionJobCancel,
+			Color:      "#AF0000",
+			Actions:    buttons[i:end],
+		})
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(strings.Join(lines, "\n"), false), slack.MsgOptionAttachments(attachments...))
+}
@@ -0,0 +1,293 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+var (
+	// KubernetesAPIURL é a URL da API do cluster. Caso vazio e o BOT esteja
+	// rodando dentro do cluster, é usada a service account do pod
+	KubernetesAPIURL string
+
+	// KubernetesToken é o token (bearer) de acesso à API do cluster
+	KubernetesToken string
+
+	// KubernetesNamespace é o namespace dos workloads
+	KubernetesNamespace string
+
+	// KubernetesCAFile é o certificado da CA do cluster
+	KubernetesCAFile string
+
+	// KubernetesInsecure desativa a verificação do certificado do cluster
+	KubernetesInsecure bool
+)
+
+// kubernetesKinds são os tipos de workload suportados e o recurso na API
+var kubernetesKinds = map[string]string{
+	"deployment":  "deployments",
+	"statefulset": "statefulsets",
+}
+
+// kubernetesOrchestrator é a implementação do Orchestrator para o
+// Kubernetes, usando a API REST do cluster. Os IDs dos serviços têm o
+// formato tipo/nome (ex.: deployment/api)
+type kubernetesOrchestrator struct {
+	client    *http.Client
+	apiURL    string
+	token     string
+	namespace string
+}
+
+func newKubernetesOrchestrator() (*kubernetesOrchestrator, error) {
+	k := &kubernetesOrchestrator{
+		apiURL:    KubernetesAPIURL,
+		token:     KubernetesToken,
+		namespace: KubernetesNamespace,
+	}
+
+	caFile := KubernetesCAFile
+
+	// Rodando dentro do cluster, usa a service account do pod
+	if k.apiURL == "" {
+		token, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/token")
+		if err != nil {
+			return nil, fmt.Errorf("K8S_API_URL não configurado e o BOT não está rodando no cluster: %s", err)
+		}
+
+		k.apiURL = "https://kubernetes.default.svc"
+		k.token = strings.TrimSpace(string(token))
+		caFile = kubernetesServiceAccountDir + "/ca.crt"
+
+		if k.namespace == "" {
+			namespace, _ := ioutil.ReadFile(kubernetesServiceAccountDir + "/namespace")
+			k.namespace = strings.TrimSpace(string(namespace))
+		}
+	}
+
+	if k.namespace == "" {
+		k.namespace = "default"
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: KubernetesInsecure}
+	if caFile != "" && !KubernetesInsecure {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(ca)
+	}
+
+	k.client = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	return k, nil
+}
+
+func (k *kubernetesOrchestrator) Name() string {
+	return "kubernetes"
+}
+
+func (k *kubernetesOrchestrator) request(method string, path string, contentType string, body interface{}) (string, error) {
+	headers := map[string]string{"Authorization": "Bearer " + k.token}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+
+	return HTTPSendJSONRequestWithClient(k.client, method, k.apiURL+path, headers, body)
+}
+
+// workloadPath converte o ID (tipo/nome) para o caminho do recurso na API
+func (k *kubernetesOrchestrator) workloadPath(ID string) (string, error) {
+	parts := strings.SplitN(ID, "/", 2)
+	if len(parts) != 2 {
+		parts = []string{"deployment", ID}
+	}
+
+	resource, ok := kubernetesKinds[strings.ToLower(parts[0])]
+	if !ok {
+		return "", fmt.Errorf("tipo de workload %s não suportado", parts[0])
+	}
+
+	return fmt.Sprintf("/apis/apps/v1/namespaces/%s/%s/%s", k.namespace, resource, parts[1]), nil
+}
+
+func kubernetesWorkload(kind string, item gjson.Result) Workload {
+	w := Workload{
+		ID:       kind + "/" + item.Get("metadata.name").String(),
+		Name:     item.Get("metadata.name").String(),
+		Image:    item.Get("spec.template.spec.containers.0.image").String(),
+		Replicas: int(item.Get("spec.replicas").Int()),
+		Ready:    int(item.Get("status.readyReplicas").Int()),
+		Created:  item.Get("metadata.creationTimestamp").String(),
+	}
+
+	switch {
+	case w.Replicas == 0:
+		w.State = "inactive"
+	case w.Ready == w.Replicas:
+		w.State = "active"
+	default:
+		w.State = "degraded"
+	}
+
+	return w
+}
+
+func (k *kubernetesOrchestrator) ListServices() ([]Workload, error) {
+	var services []Workload
+
+	for _, kind := range []string{"deployment", "statefulset"} {
+		resp, err := k.request(GetHTTP, fmt.Sprintf("/apis/apps/v1/namespaces/%s/%s", k.namespace, kubernetesKinds[kind]), "", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range gjson.Get(resp, "items").Array() {
+			services = append(services, kubernetesWorkload(kind, item))
+		}
+	}
+
+	return services, nil
+}
+
+func (k *kubernetesOrchestrator) GetService(ID string) (*Workload, error) {
+	path, err := k.workloadPath(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := k.request(GetHTTP, path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	w := kubernetesWorkload(strings.ToLower(gjson.Get(resp, "kind").String()), gjson.Parse(resp))
+
+	return &w, nil
+}
+
+// RestartService faz o mesmo que o "kubectl rollout restart", alterando a
+// annotation restartedAt do template dos pods
+func (k *kubernetesOrchestrator) RestartService(ID string) error {
+	path, err := k.workloadPath(ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = k.request(PatchHTTP, path, "application/strategic-merge-patch+json", map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{
+						"kubectl.kubernetes.io/restartedAt": time.Now().Format(time.RFC3339),
+					},
+				},
+			},
+		},
+	})
+
+	return err
+}
+
+func (k *kubernetesOrchestrator) ScaleService(ID string, replicas int) error {
+	path, err := k.workloadPath(ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = k.request(PatchHTTP, path+"/scale", "application/merge-patch+json", map[string]interface{}{
+		"spec": map[string]int{"replicas": replicas},
+	})
+
+	return err
+}
+
+// ServiceLogs busca ao mesmo tempo os logs de todos os pods do workload
+func (k *kubernetesOrchestrator) ServiceLogs(ID string, opts LogsOptions) ([]byte, int, error) {
+	path, err := k.workloadPath(ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := k.request(GetHTTP, path, "", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var selector []string
+	gjson.Get(resp, "spec.selector.matchLabels").ForEach(func(key, value gjson.Result) bool {
+		selector = append(selector, key.String()+"="+value.String())
+		return true
+	})
+	sort.Strings(selector)
+
+	pods, err := k.request(GetHTTP, fmt.Sprintf("/api/v1/namespaces/%s/pods?labelSelector=%s", k.namespace, url.QueryEscape(strings.Join(selector, ","))), "", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	names := gjson.Get(pods, "items.#.metadata.name").Array()
+	if len(names) == 0 {
+		return nil, 0, fmt.Errorf("nenhum pod encontrado para o workload %s", ID)
+	}
+
+	query := url.Values{}
+	query.Set("timestamps", "true")
+	query.Set("tailLines", fmt.Sprintf("%d", opts.RancherLines()))
+	if opts.Since > 0 {
+		query.Set("sinceSeconds", fmt.Sprintf("%d", int(opts.Since.Seconds())))
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var merged []serviceLogLine
+
+	for _, name := range names {
+		wg.Add(1)
+
+		go func(pod string) {
+			defer wg.Done()
+
+			content, err := k.request(GetHTTP, fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/log?%s", k.namespace, pod, query.Encode()), "", nil)
+			if err != nil {
+				CheckErr(fmt.Sprintf("Erro ao buscar os logs do pod %s", pod), err)
+				return
+			}
+
+			lines := prefixInstanceLogs(filterLogsContent(content, opts), pod)
+
+			mutex.Lock()
+			merged = append(merged, lines...)
+			mutex.Unlock()
+		}(name.String())
+	}
+
+	wg.Wait()
+
+	return mergeServiceLogs(merged), len(names), nil
+}
+
+// filterLogsContent aplica os filtros do FilterLogs em um texto
+func filterLogsContent(content string, opts LogsOptions) string {
+	return strings.Join(FilterLogs(content, opts), "\n")
+}
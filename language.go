@@ -0,0 +1,238 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	languageAuto = "auto"
+
+	msgBatchSelectTarget    = "batch-select-target"
+	msgJobCanceling         = "job-canceling"
+	msgTerraformNotApprover = "terraform-not-approver"
+	msgLanguageCurrent      = "language-current"
+	msgLanguageDetected     = "language-detected"
+	msgLanguageSet          = "language-set"
+	msgLanguageInvalid      = "language-invalid"
+	msgWizardExpired        = "wizard-expired"
+	msgWizardOwner          = "wizard-owner"
+)
+
+var (
+	// DefaultLanguage é o idioma das respostas para quem não escolheu um e
+	// não tem um idioma suportado no Slack
+	DefaultLanguage = "pt"
+
+	// UserLanguagesFile é o arquivo onde fica salvo o idioma escolhido por
+	// cada usuário
+	UserLanguagesFile = "languages.json"
+)
+
+// translations são as mensagens enviadas diretamente ao usuário (ex.: as
+// efêmeras) em cada idioma suportado. O português é usado quando falta a
+// tradução
+var translations = map[string]map[string]string{
+	"pt": {
+		msgBatchSelectTarget:    "Selecione pelo menos um item antes de executar",
+		msgJobCanceling:         ":no_entry_sign: Cancelando o job #%d, o resultado será enviado no canal",
+		msgTerraformNotApprover: "Você não pode aprovar esse plan :no_entry:",
+		msgLanguageCurrent:      ":speech_balloon: Seu idioma é `%s`, escolhido por você. Use `%s auto` para usar o idioma do Slack",
+		msgLanguageDetected:     ":speech_balloon: Seu idioma é `%s`, pelo idioma do Slack ou o padrão do BOT",
+		msgLanguageSet:          ":speech_balloon: Pronto, vou te responder em português",
+		msgLanguageInvalid:      "Idioma não suportado, use um de: %s",
+		msgWizardExpired:        ":hourglass: Esse upgrade guiado expirou, comece outro com o `%s`",
+		msgWizardOwner:          ":no_entry: Só quem iniciou o upgrade guiado pode continuar",
+	},
+	"en": {
+		msgBatchSelectTarget:    "Select at least one item before running",
+		msgJobCanceling:         ":no_entry_sign: Canceling job #%d, the result will be posted in the channel",
+		msgTerraformNotApprover: "You can't approve this plan :no_entry:",
+		msgLanguageCurrent:      ":speech_balloon: Your language is `%s`, chosen by you. Use `%s auto` to follow your Slack language",
+		msgLanguageDetected:     ":speech_balloon: Your language is `%s`, from your Slack language or the BOT default",
+		msgLanguageSet:          ":speech_balloon: Done, I'll answer you in English",
+		msgLanguageInvalid:      "Unsupported language, use one of: %s",
+		msgWizardExpired:        ":hourglass: This guided upgrade expired, start a new one with `%s`",
+		msgWizardOwner:          ":no_entry: Only who started the guided upgrade can continue it",
+	},
+	"es": {
+		msgBatchSelectTarget:    "Selecciona al menos un elemento antes de ejecutar",
+		msgJobCanceling:         ":no_entry_sign: Cancelando el job #%d, el resultado se enviará en el canal",
+		msgTerraformNotApprover: "No puedes aprobar este plan :no_entry:",
+		msgLanguageCurrent:      ":speech_balloon: Tu idioma es `%s`, elegido por ti. Usa `%s auto` para seguir el idioma de Slack",
+		msgLanguageDetected:     ":speech_balloon: Tu idioma es `%s`, por el idioma de Slack o el predeterminado del BOT",
+		msgLanguageSet:          ":speech_balloon: Listo, te responderé en español",
+		msgLanguageInvalid:      "Idioma no soportado, usa uno de: %s",
+		msgWizardExpired:        ":hourglass: Este upgrade guiado expiró, inicia otro con `%s`",
+		msgWizardOwner:          ":no_entry: Solo quien inició el upgrade guiado puede continuarlo",
+	},
+}
+
+var (
+	// userLanguages são os idiomas escolhidos pelos usuários com o comando
+	userLanguages       = map[string]string{}
+	userLanguagesLoaded bool
+
+	// detectedLanguages são os idiomas lidos do Slack, guardados só em memória
+	detectedLanguages = map[string]string{}
+
+	languagesMutex sync.Mutex
+)
+
+// supportedLanguages lista os idiomas com tradução, separados por vírgula
+func supportedLanguages() string {
+	return "`pt`, `en`, `es`"
+}
+
+// loadUserLanguages lê o arquivo de idiomas na primeira vez que ele é
+// usado. Deve ser chamada com o languagesMutex travado
+func loadUserLanguages() {
+	if userLanguagesLoaded {
+		return
+	}
+	userLanguagesLoaded = true
+
+	data, err := ioutil.ReadFile(UserLanguagesFile)
+	if os.IsNotExist(err) {
+		return
+	}
+	CheckErr("Erro ao ler o arquivo de idiomas", err)
+
+	err = json.Unmarshal(data, &userLanguages)
+	CheckErr("Erro ao converter o arquivo de idiomas", err)
+}
+
+// SetUserLanguage guarda o idioma do usuário, auto volta a usar o do Slack
+func SetUserLanguage(user string, lang string) {
+	languagesMutex.Lock()
+	defer languagesMutex.Unlock()
+
+	loadUserLanguages()
+
+	if lang == languageAuto {
+		delete(userLanguages, user)
+	} else {
+		userLanguages[user] = lang
+	}
+
+	data, err := json.MarshalIndent(userLanguages, "", "  ")
+	CheckErr("Erro ao converter os idiomas", err)
+
+	err = ioutil.WriteFile(UserLanguagesFile, data, 0644)
+	CheckErr("Erro ao salvar o arquivo de idiomas", err)
+}
+
+// chosenLanguage retorna o idioma escolhido pelo usuário com o comando
+func chosenLanguage(user string) (string, bool) {
+	languagesMutex.Lock()
+	defer languagesMutex.Unlock()
+
+	loadUserLanguages()
+
+	lang, ok := userLanguages[user]
+	return lang, ok
+}
+
+// languageFromLocale converte o locale do Slack (ex.: en-US) para um idioma
+// suportado, vazio quando não há tradução
+func languageFromLocale(locale string) string {
+	lang := strings.ToLower(strings.SplitN(locale, "-", 2)[0])
+	if _, ok := translations[lang]; ok {
+		return lang
+	}
+
+	return ""
+}
+
+// UserLanguage retorna o idioma do usuário: o escolhido com o comando, o
+// do Slack (lido uma vez e guardado) ou o DefaultLanguage
+func UserLanguage(user string) string {
+	if lang, ok := chosenLanguage(user); ok {
+		return lang
+	}
+
+	languagesMutex.Lock()
+	lang, ok := detectedLanguages[user]
+	languagesMutex.Unlock()
+
+	if !ok {
+		if info, err := getAPIConnection().client.GetUserInfo(user); err == nil {
+			lang = languageFromLocale(info.Locale)
+		} else {
+			CheckErr("Erro ao buscar o idioma do usuário no Slack", err)
+		}
+
+		languagesMutex.Lock()
+		detectedLanguages[user] = lang
+		languagesMutex.Unlock()
+	}
+
+	if lang == "" {
+		return DefaultLanguage
+	}
+
+	return lang
+}
+
+// T retorna a mensagem traduzida para o idioma, formatada com os args
+func T(lang string, key string, args ...interface{}) string {
+	text, ok := translations[lang][key]
+	if !ok {
+		text = translations["pt"][key]
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+
+	return text
+}
+
+// postEphemeral envia a mensagem traduzida visível apenas para o usuário
+func postEphemeral(channel string, user string, key string, args ...interface{}) {
+	getAPIConnection().client.PostEphemeral(channel, user, slack.MsgOptionText(T(UserLanguage(user), key, args...), false))
+}
+
+// slackLanguage mostra ou altera o idioma das respostas para o usuário
+func (s *SlackListener) slackLanguage(ev *slack.MessageEvent) {
+	args := strings.Fields(ev.Msg.Text)
+	user := ev.Msg.User
+
+	if len(args) < 3 {
+		if lang, ok := chosenLanguage(user); ok {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(T(lang, msgLanguageCurrent, lang, language), false))
+			return
+		}
+
+		lang := UserLanguage(user)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(T(lang, msgLanguageDetected, lang), false))
+		return
+	}
+
+	lang := strings.ToLower(args[2])
+	if _, ok := translations[lang]; !ok && lang != languageAuto {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(T(UserLanguage(user), msgLanguageInvalid, supportedLanguages()+", `auto`"), false))
+		return
+	}
+
+	SetUserLanguage(user, lang)
+	log.Printf("[INFO] Idioma do usuário %s alterado para %s\n", user, lang)
+
+	if lang == languageAuto {
+		lang = UserLanguage(user)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(T(lang, msgLanguageDetected, lang), false))
+		return
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(T(lang, msgLanguageSet), false))
+}
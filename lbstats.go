@@ -0,0 +1,334 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+var (
+	// HaproxyStatsPort é a porta da página de estatísticas do HAProxy nos
+	// containers do LB (seção listen stats do haproxy.cfg)
+	HaproxyStatsPort = "9000"
+
+	// HaproxyStatsPath é o caminho da página de estatísticas, o BOT pede o CSV
+	// adicionando ;csv
+	HaproxyStatsPath = "/haproxy?stats"
+
+	// HaproxyStatsTimeout é o tempo máximo da consulta em cada container do LB
+	HaproxyStatsTimeout = 5 * time.Second
+)
+
+// haproxyErrorRateWarning é a taxa de erro (%) a partir da qual o backend
+// aparece em amarelo
+const haproxyErrorRateWarning = 5.0
+
+// HaproxyStat é uma linha do CSV de estatísticas do HAProxy: um frontend, um
+// backend (Server BACKEND) ou um server de um backend
+type HaproxyStat struct {
+	Proxy          string
+	Server         string
+	Address        string
+	Status         string
+	Weight         int
+	Sessions       int
+	MaxSessions    int
+	TotalSessions  int
+	RequestErrors  int
+	ConnectErrors  int
+	ResponseErrors int
+	HTTP5xx        int
+}
+
+// Errors é a soma dos erros de conexão, de resposta e dos 5xx
+func (h *HaproxyStat) Errors() int {
+	return h.ConnectErrors + h.ResponseErrors + h.HTTP5xx
+}
+
+// ErrorRate é o percentual de sessões com erro
+func (h *HaproxyStat) ErrorRate() float64 {
+	if h.TotalSessions == 0 {
+		return 0
+	}
+
+	return float64(h.Errors()) * 100 / float64(h.TotalSessions)
+}
+
+// add soma as estatísticas de outro container do LB. O status fica o pior
+// entre os containers
+func (h *HaproxyStat) add(other HaproxyStat) {
+	h.Sessions += other.Sessions
+	h.TotalSessions += other.TotalSessions
+	h.RequestErrors += other.RequestErrors
+	h.ConnectErrors += other.ConnectErrors
+	h.ResponseErrors += other.ResponseErrors
+	h.HTTP5xx += other.HTTP5xx
+
+	if other.MaxSessions > h.MaxSessions {
+		h.MaxSessions = other.MaxSessions
+	}
+	if !strings.HasPrefix(other.Status, "UP") && other.Status != "OPEN" {
+		h.Status = other.Status
+	}
+}
+
+// ParseHaproxyStats lê o CSV de estatísticas do HAProxy (show stat), usando
+// o cabeçalho para achar as colunas
+func ParseHaproxyStats(content string) ([]HaproxyStat, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(content, "# ")))
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("estatísticas vazias")
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+
+	for _, name := range []string{"pxname", "svname", "status", "scur", "stot"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("coluna %s não encontrada, a URL não parece ser o CSV do HAProxy", name)
+		}
+	}
+
+	value := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+	number := func(record []string, name string) int {
+		n, _ := strconv.Atoi(value(record, name))
+		return n
+	}
+
+	var stats []HaproxyStat
+	for _, record := range records[1:] {
+		stats = append(stats, HaproxyStat{
+			Proxy:          value(record, "pxname"),
+			Server:         value(record, "svname"),
+			Address:        value(record, "addr"),
+			Status:         value(record, "status"),
+			Weight:         number(record, "weight"),
+			Sessions:       number(record, "scur"),
+			MaxSessions:    number(record, "smax"),
+			TotalSessions:  number(record, "stot"),
+			RequestErrors:  number(record, "ereq"),
+			ConnectErrors:  number(record, "econ"),
+			ResponseErrors: number(record, "eresp"),
+			HTTP5xx:        number(record, "hrsp_5xx"),
+		})
+	}
+
+	return stats, nil
+}
+
+// fetchHaproxyStats busca o CSV de estatísticas de um container do LB
+func fetchHaproxyStats(client *http.Client, ip string) ([]HaproxyStat, error) {
+	resp, err := client.Get(fmt.Sprintf("http://%s:%s%s;csv", ip, HaproxyStatsPort, HaproxyStatsPath))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("a página de estatísticas respondeu %d", resp.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseHaproxyStats(string(content))
+}
+
+// LoadBalancerStats busca as estatísticas do HAProxy em todos os containers
+// rodando do LB e soma por frontend, backend e server. Retorna também os
+// containers que não responderam
+func LoadBalancerStats(lbID string) ([]HaproxyStat, []string, error) {
+	instances, err := rancherListener.ListServiceInstances(lbID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client := &http.Client{Timeout: HaproxyStatsTimeout}
+
+	var order []string
+	merged := map[string]*HaproxyStat{}
+	var failed []string
+
+	for _, instance := range instances {
+		if instance.State != "running" {
+			continue
+		}
+
+		if instance.PrimaryIPAddress == "" {
+			failed = append(failed, instance.Name)
+			continue
+		}
+
+		stats, err := fetchHaproxyStats(client, instance.PrimaryIPAddress)
+		if err != nil {
+			CheckErr(fmt.Sprintf("Erro ao buscar as estatísticas do HAProxy no container %s", instance.Name), err)
+			failed = append(failed, instance.Name)
+			continue
+		}
+
+		for _, stat := range stats {
+			key := stat.Proxy + "/" + stat.Server
+			if current, ok := merged[key]; ok {
+				current.add(stat)
+				continue
+			}
+
+			stat := stat
+			merged[key] = &stat
+			order = append(order, key)
+		}
+	}
+
+	if len(order) == 0 {
+		if len(failed) == 0 {
+			return nil, nil, fmt.Errorf("nenhum container rodando no LB")
+		}
+		return nil, failed, fmt.Errorf("nenhum container do LB respondeu na porta %s", HaproxyStatsPort)
+	}
+
+	var result []HaproxyStat
+	for _, key := range order {
+		result = append(result, *merged[key])
+	}
+
+	return result, failed, nil
+}
+
+// haproxyStatusEmoji é o emoji do status do backend ou server
+func haproxyStatusEmoji(status string) string {
+	switch {
+	case strings.HasPrefix(status, "UP"), status == "OPEN":
+		return ":large_green_circle:"
+	case strings.HasPrefix(status, "DOWN"):
+		return ":red_circle:"
+	case status == "MAINT", status == "DRAIN", status == "NOLB":
+		return ":white_circle:"
+	default:
+		return ":large_yellow_circle:"
+	}
+}
+
+// LoadBalancerStatsAttachments monta uma mensagem por backend, com os
+// servers, as sessões e a taxa de erro. A página de estatísticas não aparece
+func LoadBalancerStatsAttachments(lbID string, stats []HaproxyStat, failed []string) []slack.Attachment {
+	servers := map[string][]HaproxyStat{}
+	var frontends []string
+	var backends []HaproxyStat
+
+	for _, stat := range stats {
+		if stat.Proxy == "stats" {
+			continue
+		}
+
+		switch stat.Server {
+		case "FRONTEND":
+			frontends = append(frontends, fmt.Sprintf("`%s` %s, %d sessões", stat.Proxy, stat.Status, stat.Sessions))
+		case "BACKEND":
+			backends = append(backends, stat)
+		default:
+			servers[stat.Proxy] = append(servers[stat.Proxy], stat)
+		}
+	}
+
+	header := slack.Attachment{
+		Title: fmt.Sprintf(":bar_chart: Estatísticas do HAProxy no LB `%s`", lbID),
+		Text:  strings.Join(frontends, "\n"),
+		Color: "#0C648A",
+	}
+	if len(failed) > 0 {
+		header.Footer = fmt.Sprintf("Sem resposta de %s, os números são dos demais containers", strings.Join(failed, ", "))
+	}
+
+	attachments := []slack.Attachment{header}
+
+	sort.Slice(backends, func(i, j int) bool { return backends[i].Proxy < backends[j].Proxy })
+
+	for _, backend := range backends {
+		attachment := slack.Attachment{
+			Title: fmt.Sprintf("%s %s", haproxyStatusEmoji(backend.Status), backend.Proxy),
+			Color: "good",
+			Fields: []slack.AttachmentField{
+				{Title: "Status", Value: backend.Status, Short: true},
+				{Title: "Sessões", Value: fmt.Sprintf("%d agora, %d máx., %d total", backend.Sessions, backend.MaxSessions, backend.TotalSessions), Short: true},
+				{Title: "Taxa de erro", Value: fmt.Sprintf("%.2f%% (%d erros)", backend.ErrorRate(), backend.Errors()), Short: true},
+				{Title: "5xx", Value: strconv.Itoa(backend.HTTP5xx), Short: true},
+			},
+		}
+
+		if backend.ErrorRate() >= haproxyErrorRateWarning {
+			attachment.Color = "warning"
+		}
+
+		var lines []string
+		for _, server := range servers[backend.Proxy] {
+			if !strings.HasPrefix(server.Status, "UP") && attachment.Color == "good" {
+				attachment.Color = "warning"
+			}
+			lines = append(lines, fmt.Sprintf("%s `%s` peso %d, %d sessões, %.2f%% de erro", haproxyStatusEmoji(server.Status), server.Server, server.Weight, server.Sessions, server.ErrorRate()))
+		}
+		attachment.Text = strings.Join(lines, "\n")
+
+		if !strings.HasPrefix(backend.Status, "UP") {
+			attachment.Color = "danger"
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments
+}
+
+// slackLBStats envia as estatísticas do HAProxy do LB, para acompanhar o
+// Canary e as regras de A/B pelo Slack
+func (s *SlackListener) slackLBStats(ev *slack.MessageEvent) {
+	args := strings.Fields(ev.Msg.Text)
+
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", lbStats), false))
+		return
+	}
+
+	lbID := args[len(args)-1]
+	if !s.allowTargetArg(ev.Channel, lbID) {
+		return
+	}
+
+	if _, err := rancherListener.GetLoadBalancer(lbID); err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: LoadBalancer `%s` não encontrado", lbID), false))
+		return
+	}
+
+	stats, failed, err := LoadBalancerStats(lbID)
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: Não foi possível buscar as estatísticas do LB `%s`: %s", lbID, err), false))
+		return
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(LoadBalancerStatsAttachments(lbID, stats, failed)...))
+}
@@ -0,0 +1,343 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	leaderRedis      = "redis"
+	leaderKubernetes = "kubernetes"
+)
+
+var (
+	// LeaderElection é o backend da eleição de líder (redis ou kubernetes).
+	// Vazio desliga a eleição e a réplica é sempre a líder
+	LeaderElection string
+
+	// LeaderKey é o nome da chave no Redis ou do Lease no Kubernetes
+	LeaderKey = "slack-bot-leader"
+
+	// LeaderLeaseDuration é o tempo que a liderança vale sem ser renovada
+	LeaderLeaseDuration = 15 * time.Second
+
+	// LeaderRedisAddr é o endereço (host:porta) do Redis usado na eleição
+	LeaderRedisAddr = "localhost:6379"
+
+	// LeaderRedisPassword é a senha do Redis, caso exista
+	LeaderRedisPassword string
+)
+
+// leaderIdentity identifica a réplica na eleição, o hostname (nome do pod ou
+// do container) e o PID
+var leaderIdentity = func() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}()
+
+var (
+	isLeader   int32
+	leaderHeld leaderLock
+)
+
+// IsLeader retorna se a réplica é a líder
+func IsLeader() bool {
+	return LeaderElection == "" || atomic.LoadInt32(&isLeader) == 1
+}
+
+// leaderLock é a trava usada na eleição de líder
+type leaderLock interface {
+	// Acquire pega a trava ou renova caso a réplica já seja a dona,
+	// retornando se a réplica é a líder
+	Acquire() (bool, error)
+	Release()
+}
+
+// RunAsLeader espera a réplica ser eleita para executar o start (monitores,
+// agendamentos e eventos) e renova a liderança em background. Caso a
+// liderança seja perdida o processo é encerrado, para voltar como réplica
+// reserva sem monitores duplicados
+func RunAsLeader(start func()) {
+	if LeaderElection == "" {
+		start()
+		return
+	}
+
+	var lock leaderLock
+	switch LeaderElection {
+	case leaderRedis:
+		lock = &redisLeaderLock{}
+	case leaderKubernetes:
+		k, err := newKubernetesOrchestrator()
+		if err != nil {
+			log.Fatalf("[ERROR] Erro ao iniciar a eleição de líder no Kubernetes: %s", err)
+		}
+		lock = &kubernetesLeaderLock{k: k}
+	default:
+		log.Fatalf("[ERROR] Eleição de líder %s não suportada", LeaderElection)
+	}
+
+	log.Printf("[INFO] Aguardando a eleição de líder (%s) como %s\n", LeaderElection, leaderIdentity)
+
+	renew := LeaderLeaseDuration / 3
+
+	for {
+		leader, err := lock.Acquire()
+		CheckErr("Erro na eleição de líder", err)
+
+		if leader {
+			break
+		}
+
+		time.Sleep(renew)
+	}
+
+	leaderHeld = lock
+	atomic.StoreInt32(&isLeader, 1)
+	log.Printf("[INFO] Réplica %s eleita líder\n", leaderIdentity)
+
+	go func() {
+		lastRenew := time.Now()
+
+		for {
+			time.Sleep(renew)
+
+			if botContext.Err() != nil {
+				return
+			}
+
+			leader, err := lock.Acquire()
+			if err != nil {
+				CheckErr("Erro ao renovar a liderança", err)
+
+				// Erros passageiros só derrubam a liderança quando ela expira
+				if time.Since(lastRenew) < LeaderLeaseDuration {
+					continue
+				}
+			}
+
+			if !leader {
+				log.Fatalf("[ERROR] Réplica %s perdeu a liderança, encerrando", leaderIdentity)
+			}
+
+			lastRenew = time.Now()
+		}
+	}()
+
+	start()
+}
+
+// ReleaseLeadership libera a liderança no desligamento, para uma réplica
+// reserva assumir sem esperar a liderança expirar
+func ReleaseLeadership() {
+	if LeaderElection == "" || !IsLeader() {
+		return
+	}
+
+	leaderHeld.Release()
+	log.Printf("[INFO] Liderança da réplica %s liberada\n", leaderIdentity)
+}
+
+// redisLeaderLock usa uma chave no Redis com expiração como trava
+type redisLeaderLock struct{}
+
+// redisRenewScript renova a expiração apenas se a chave for da réplica
+const redisRenewScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+
+// redisReleaseScript apaga a chave apenas se ela for da réplica
+const redisReleaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+func (r *redisLeaderLock) Acquire() (bool, error) {
+	ttl := strconv.FormatInt(int64(LeaderLeaseDuration/time.Millisecond), 10)
+
+	reply, err := redisCommand("SET", LeaderKey, leaderIdentity, "NX", "PX", ttl)
+	if err != nil {
+		return false, err
+	}
+
+	if reply == "OK" {
+		return true, nil
+	}
+
+	reply, err = redisCommand("EVAL", redisRenewScript, "1", LeaderKey, leaderIdentity, ttl)
+
+	return reply == "1", err
+}
+
+func (r *redisLeaderLock) Release() {
+	_, err := redisCommand("EVAL", redisReleaseScript, "1", LeaderKey, leaderIdentity)
+	CheckErr("Erro ao liberar a liderança no Redis", err)
+}
+
+// redisCommand envia um comando para o Redis no protocolo RESP, retornando a
+// resposta simples (status, inteiro ou string). Cada comando usa uma conexão
+// própria, já que a eleição só envia um comando a cada poucos segundos
+func redisCommand(args ...string) (string, error) {
+	conn, err := net.DialTimeout("tcp", LeaderRedisAddr, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	if LeaderRedisPassword != "" {
+		if _, err := redisRoundTrip(conn, reader, "AUTH", LeaderRedisPassword); err != nil {
+			return "", err
+		}
+	}
+
+	return redisRoundTrip(conn, reader, args...)
+}
+
+func redisRoundTrip(conn net.Conn, reader *bufio.Reader, args ...string) (string, error) {
+	command := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		command += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := conn.Write([]byte(command)); err != nil {
+		return "", err
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+
+	if line == "" {
+		return "", fmt.Errorf("resposta vazia do Redis")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("erro do Redis: %s", line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return "", err
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return "", err
+		}
+
+		return string(buf[:size]), nil
+	}
+
+	return "", fmt.Errorf("resposta do Redis não suportada: %s", line)
+}
+
+// kubernetesLeaderLock usa um Lease (coordination.k8s.io) como trava, com o
+// resourceVersion garantindo que duas réplicas não renovem ao mesmo tempo
+type kubernetesLeaderLock struct {
+	k *kubernetesOrchestrator
+}
+
+func (l *kubernetesLeaderLock) leasePath() string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", l.k.namespace)
+}
+
+func (l *kubernetesLeaderLock) leaseSpec(acquireTime string) map[string]interface{} {
+	return map[string]interface{}{
+		"holderIdentity":       leaderIdentity,
+		"leaseDurationSeconds": int(LeaderLeaseDuration / time.Second),
+		"acquireTime":          acquireTime,
+		"renewTime":            time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+	}
+}
+
+func (l *kubernetesLeaderLock) Acquire() (bool, error) {
+	now := time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+
+	resp, err := l.k.request(GetHTTP, l.leasePath()+"/"+LeaderKey, "", nil)
+	if httpStatus(err) == http.StatusNotFound {
+		// Sem o Lease a primeira réplica a criar vira a líder, as demais
+		// recebem o conflito
+		_, err = l.k.request(PostHTTP, l.leasePath(), "application/json", map[string]interface{}{
+			"apiVersion": "coordination.k8s.io/v1",
+			"kind":       "Lease",
+			"metadata":   map[string]interface{}{"name": LeaderKey},
+			"spec":       l.leaseSpec(now),
+		})
+		if httpStatus(err) == http.StatusConflict {
+			return false, nil
+		}
+
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	lease := gjson.Parse(resp)
+	holder := lease.Get("spec.holderIdentity").String()
+	acquireTime := lease.Get("spec.acquireTime").String()
+
+	if holder != leaderIdentity {
+		renewTime, _ := time.Parse(time.RFC3339Nano, lease.Get("spec.renewTime").String())
+		duration := time.Duration(lease.Get("spec.leaseDurationSeconds").Int()) * time.Second
+
+		if holder != "" && time.Since(renewTime) < duration {
+			return false, nil
+		}
+
+		acquireTime = now
+	}
+
+	_, err = l.k.request(PutHTTP, l.leasePath()+"/"+LeaderKey, "application/json", map[string]interface{}{
+		"apiVersion": "coordination.k8s.io/v1",
+		"kind":       "Lease",
+		"metadata": map[string]interface{}{
+			"name":            LeaderKey,
+			"resourceVersion": lease.Get("metadata.resourceVersion").String(),
+		},
+		"spec": l.leaseSpec(acquireTime),
+	})
+
+	// Conflito no resourceVersion: outra réplica alterou o Lease antes
+	if httpStatus(err) == http.StatusConflict {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (l *kubernetesLeaderLock) Release() {
+	resp, err := l.k.request(GetHTTP, l.leasePath()+"/"+LeaderKey, "", nil)
+	if err != nil || gjson.Get(resp, "spec.holderIdentity").String() != leaderIdentity {
+		return
+	}
+
+	_, err = l.k.request(PutHTTP, l.leasePath()+"/"+LeaderKey, "application/json", map[string]interface{}{
+		"apiVersion": "coordination.k8s.io/v1",
+		"kind":       "Lease",
+		"metadata": map[string]interface{}{
+			"name":            LeaderKey,
+			"resourceVersion": gjson.Get(resp, "metadata.resourceVersion").String(),
+		},
+		"spec": map[string]interface{}{
+			"leaseDurationSeconds": int(LeaderLeaseDuration / time.Second),
+		},
+	})
+	CheckErr("Erro ao liberar a liderança no Kubernetes", err)
+}
@@ -0,0 +1,55 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKubernetesLeaderAcquire(t *testing.T) {
+	tests := []struct {
+		name    string
+		get     int
+		post    int
+		leader  bool
+		err     bool
+		created bool
+	}{
+		{"sem o Lease cria e vira líder", http.StatusNotFound, http.StatusCreated, true, false, true},
+		{"outra réplica criou antes", http.StatusNotFound, http.StatusConflict, false, false, true},
+		{"erro ao criar", http.StatusNotFound, http.StatusInternalServerError, false, true, true},
+		{"erro da API não cria o Lease", http.StatusInternalServerError, 0, false, true, false},
+		{"sem permissão não cria o Lease", http.StatusForbidden, 0, false, true, false},
+	}
+
+	for _, test := range tests {
+		created := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == GetHTTP && r.URL.Path == "/apis/coordination.k8s.io/v1/namespaces/bots/leases/"+LeaderKey:
+				w.WriteHeader(test.get)
+			case r.Method == PostHTTP && r.URL.Path == "/apis/coordination.k8s.io/v1/namespaces/bots/leases":
+				created = true
+				w.WriteHeader(test.post)
+			default:
+				t.Errorf("%s: chamada inesperada %s %s", test.name, r.Method, r.URL.Path)
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			w.Write([]byte("{}"))
+		}))
+
+		lock := &kubernetesLeaderLock{k: &kubernetesOrchestrator{client: server.Client(), apiURL: server.URL, namespace: "bots"}}
+		leader, err := lock.Acquire()
+		server.Close()
+
+		if leader != test.leader || (err != nil) != test.err {
+			t.Errorf("%s: Acquire = %v, %v, esperado %v e erro %v", test.name, leader, err, test.leader, test.err)
+		}
+		if created != test.created {
+			t.Errorf("%s: Lease criado = %v, esperado %v", test.name, created, test.created)
+		}
+	}
+}
@@ -0,0 +1,617 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	actionLogsRange = "logs-range"
+
+	// defaultLogsLines é a quantidade de linhas buscadas quando nada é informado
+	defaultLogsLines = 50
+
+	// sinceLogsLines é a quantidade de linhas pedidas ao Rancher quando o filtro
+	// é por tempo, já que a API de logs do Rancher 1.6 só aceita quantidade de linhas
+	sinceLogsLines = 10000
+
+	// defaultLogsContext é a quantidade de linhas de contexto mostradas ao redor
+	// de cada linha encontrada pelo filtro
+	defaultLogsContext = 2
+
+	logsStdout = "stdout"
+	logsStderr = "stderr"
+	logsBoth   = "both"
+)
+
+// LogsTimezone é o fuso horário usado para interpretar os horários passados
+// nos comandos de logs (ex.: from 14:00 to 14:30)
+var LogsTimezone = time.Local
+
+// LogsOptions é a estrutura que guarda quanto de log o usuário quer buscar
+// e quais filtros devem ser aplicados
+type LogsOptions struct {
+	Lines   int
+	Since   time.Duration
+	Pattern string
+	Context int
+	From    time.Time
+	To      time.Time
+	Stream  string
+}
+
+// ParseLogsOptions é a função que lê os argumentos do comando de logs
+// no formato lines=200, since=15m e from 14:00 to 14:30
+func ParseLogsOptions(args []string) LogsOptions {
+	opts := LogsOptions{}
+	loc := LogsTimezone
+
+	// O fuso horário precisa ser lido antes dos horários
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "tz=") {
+			tz, err := time.LoadLocation(strings.TrimPrefix(arg, "tz="))
+			CheckErr("Fuso horário inválido no comando de logs", err)
+			if err == nil {
+				loc = tz
+			}
+		}
+	}
+
+	var from, to string
+	contextSet := false
+
+	for i := 0; i < len(args); i++ {
+		// Aceitando também o formato "from 14:00 to 14:30"
+		if (args[i] == "from" || args[i] == "to") && i+1 < len(args) {
+			args[i] = fmt.Sprintf("%s=%s", args[i], args[i+1])
+			args[i+1] = ""
+		}
+
+		kv := strings.SplitN(args[i], "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "from":
+			from = kv[1]
+		case "to":
+			to = kv[1]
+		case "lines", "tail":
+			lines, err := strconv.Atoi(kv[1])
+			if err == nil && lines > 0 {
+				opts.Lines = lines
+			}
+		case "since":
+			since, err := time.ParseDuration(kv[1])
+			if err == nil && since > 0 {
+				opts.Since = since
+			}
+		case "grep":
+			opts.Pattern = html.UnescapeString(kv[1])
+		case "stream":
+			if kv[1] == logsStdout || kv[1] == logsStderr || kv[1] == logsBoth {
+				opts.Stream = kv[1]
+			}
+		case "context":
+			context, err := strconv.Atoi(kv[1])
+			if err == nil && context >= 0 {
+				opts.Context, contextSet = context, true
+			}
+		}
+	}
+
+	// O contexto padrão só vale quando ele não foi informado, context=0
+	// mostra apenas as linhas encontradas
+	if opts.Pattern != "" && !contextSet {
+		opts.Context = defaultLogsContext
+	}
+
+	if from != "" {
+		opts.From, opts.To = parseLogsRange(from, to, loc)
+	}
+
+	return opts
+}
+
+// parseLogsTime converte o horário passado no comando, aceitando apenas a hora
+// (que será considerada como do dia atual) ou a data completa
+func parseLogsTime(value string, loc *time.Location) (time.Time, error) {
+	layouts := []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "15:04:05", "15:04"}
+
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, value, loc)
+		if err != nil {
+			continue
+		}
+
+		if !strings.Contains(layout, "2006") {
+			now := time.Now().In(loc)
+			t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+		}
+
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("horário inválido: %s", value)
+}
+
+// parseLogsRange converte o período de logs, caso o fim não seja informado
+// é usado o horário atual
+func parseLogsRange(from string, to string, loc *time.Location) (time.Time, time.Time) {
+	start, err := parseLogsTime(from, loc)
+	if err != nil {
+		CheckErr("Erro ao ler o início do período de logs", err)
+		return time.Time{}, time.Time{}
+	}
+
+	end := time.Now().In(loc)
+	if to != "" {
+		end, err = parseLogsTime(to, loc)
+		if err != nil {
+			CheckErr("Erro ao ler o fim do período de logs", err)
+			return time.Time{}, time.Time{}
+		}
+	}
+
+	// Período que passa da meia noite, ex.: from 23:30 to 00:30
+	if end.Before(start) {
+		start = start.Add(-24 * time.Hour)
+	}
+
+	return start, end
+}
+
+// IsEmpty retorna se nenhuma opção de logs foi informada
+func (o LogsOptions) IsEmpty() bool {
+	return o.Lines == 0 && o.Since == 0 && o.Pattern == "" && o.From.IsZero()
+}
+
+// RancherLines retorna a quantidade de linhas que será pedida ao Rancher
+func (o LogsOptions) RancherLines() int {
+	if o.Lines > 0 {
+		return o.Lines
+	}
+
+	if o.Since > 0 || o.Pattern != "" || !o.From.IsZero() {
+		return sinceLogsLines
+	}
+
+	return defaultLogsLines
+}
+
+// Filtered retorna se os logs são filtrados no BOT (período, grep ou saída),
+// sem os filtros eles podem ir direto do Rancher para o Slack
+func (o LogsOptions) Filtered() bool {
+	return o.Since > 0 || !o.From.IsZero() || o.Pattern != "" || o.Stream == logsStdout || o.Stream == logsStderr
+}
+
+// Describe retorna as opções em texto, usado no título do arquivo de logs
+func (o LogsOptions) Describe() string {
+	description := fmt.Sprintf("últimas %d linhas", o.RancherLines())
+	if o.Since > 0 {
+		description = fmt.Sprintf("últimos %s", o.Since)
+	}
+
+	if !o.From.IsZero() {
+		description = fmt.Sprintf("de %s a %s (%s)", o.From.Format("02/01 15:04"), o.To.Format("02/01 15:04"), o.From.Location())
+	}
+
+	if o.Pattern != "" {
+		description += fmt.Sprintf(", filtro \"%s\"", o.Pattern)
+	}
+
+	if o.Stream == logsStdout || o.Stream == logsStderr {
+		description += fmt.Sprintf(", apenas %s", o.Stream)
+	}
+
+	return description
+}
+
+// Matcher retorna a regex usada no filtro, caso o padrão passado não seja
+// uma regex válida ele é usado como texto simples
+func (o LogsOptions) Matcher() *regexp.Regexp {
+	if o.Pattern == "" {
+		return nil
+	}
+
+	re, err := regexp.Compile(o.Pattern)
+	if err != nil {
+		re = regexp.MustCompile(regexp.QuoteMeta(o.Pattern))
+	}
+
+	return re
+}
+
+// Encode transforma as opções em query string, para serem enviadas no valor
+// das opções e botões do Slack
+func (o LogsOptions) Encode() string {
+	values := url.Values{}
+
+	if o.Lines > 0 {
+		values.Set("lines", strconv.Itoa(o.Lines))
+	}
+
+	if o.Since > 0 {
+		values.Set("since", o.Since.String())
+	}
+
+	if o.Pattern != "" {
+		values.Set("grep", o.Pattern)
+		values.Set("context", strconv.Itoa(o.Context))
+	}
+
+	if !o.From.IsZero() {
+		values.Set("from", o.From.Format(time.RFC3339))
+		values.Set("to", o.To.Format(time.RFC3339))
+	}
+
+	if o.Stream != "" {
+		values.Set("stream", o.Stream)
+	}
+
+	return values.Encode()
+}
+
+// DecodeLogsValue separa o ID do container das opções de logs que
+// foram colocadas no valor da opção selecionada
+func DecodeLogsValue(value string) (string, LogsOptions) {
+	parts := strings.SplitN(value, "?", 2)
+	if len(parts) == 1 {
+		return parts[0], LogsOptions{}
+	}
+
+	values, err := url.ParseQuery(parts[1])
+	CheckErr("Erro ao ler as opções de logs", err)
+
+	var args []string
+	for key := range values {
+		args = append(args, fmt.Sprintf("%s=%s", key, values.Get(key)))
+	}
+
+	return parts[0], ParseLogsOptions(args)
+}
+
+// EncodeLogsValue junta o ID do container com as opções de logs
+func EncodeLogsValue(containerID string, opts LogsOptions) string {
+	if opts.IsEmpty() {
+		return containerID
+	}
+
+	return fmt.Sprintf("%s?%s", containerID, opts.Encode())
+}
+
+// withLogsOptions adiciona as opções de logs no valor de cada opção do select
+func withLogsOptions(options []slack.AttachmentActionOption, opts LogsOptions) []slack.AttachmentActionOption {
+	for i := range options {
+		options[i].Value = EncodeLogsValue(options[i].Value, opts)
+	}
+
+	return options
+}
+
+// logsRangeAttachment cria a mensagem com os botões de quanto de log buscar
+func logsRangeAttachment(containerID string) slack.Attachment {
+	presets := []struct {
+		text string
+		opts LogsOptions
+	}{
+		{"Últimas 50 linhas", LogsOptions{Lines: 50}},
+		{"Últimas 500 linhas", LogsOptions{Lines: 500}},
+		{"Últimos 5 minutos", LogsOptions{Since: 5 * time.Minute}},
+		{"Últimos 30 minutos", LogsOptions{Since: 30 * time.Minute}},
+	}
+
+	actions := []slack.AttachmentAction{}
+	for _, preset := range presets {
+		actions = append(actions, slack.AttachmentAction{
+			Name:  actionLogsRange,
+			Text:  preset.text,
+			Type:  "button",
+			Value: EncodeLogsValue(containerID, preset.opts),
+		})
+	}
+
+	actions = append(actions, slack.AttachmentAction{
+		Name:  actionCancel,
+		Text:  "Cancelar",
+		Type:  "button",
+		Style: "danger",
+	})
+
+	return slack.Attachment{
+		Text:       fmt.Sprintf("Quanto de log do container `%s` deseja baixar? :scroll:", containerID),
+		Color:      "#0C648A",
+		CallbackID: logsContainer,
+		Actions:    actions,
+	}
+}
+
+// ansiRegex encontra as sequências de escape ANSI (cores, cursor, títulos)
+var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07]*\x07|\x1b[@-_]`)
+
+// StripANSI remove as sequências de escape ANSI do texto
+func StripANSI(text string) string {
+	return ansiRegex.ReplaceAllString(text, "")
+}
+
+// logLineStream retorna de qual saída veio a linha de log, o Rancher envia
+// "01 " no início das linhas do stdout e "02 " nas do stderr
+func logLineStream(line string) (string, string) {
+	switch {
+	case strings.HasPrefix(line, "01 "):
+		return logsStdout, line[3:]
+	case strings.HasPrefix(line, "02 "):
+		return logsStderr, line[3:]
+	}
+
+	return "", line
+}
+
+// CleanLogLines remove os códigos ANSI, filtra as linhas pela saída escolhida
+// (stdout ou stderr) e identifica de qual saída cada linha veio
+func CleanLogLines(lines []string, stream string) []string {
+	var cleaned []string
+
+	for _, line := range lines {
+		lineStream, text := logLineStream(StripANSI(line))
+
+		if lineStream != "" && (stream == logsStdout || stream == logsStderr) {
+			if lineStream != stream {
+				continue
+			}
+
+			cleaned = append(cleaned, text)
+			continue
+		}
+
+		if lineStream != "" {
+			text = fmt.Sprintf("[%s] %s", lineStream, text)
+		}
+
+		cleaned = append(cleaned, text)
+	}
+
+	return cleaned
+}
+
+// parseLogLine separa a data do conteúdo de uma linha de log vinda do
+// WebSocket do Rancher, que vem no formato "01 2019-01-01T00:00:00.000Z conteúdo"
+func parseLogLine(line string) (time.Time, bool) {
+	_, line = logLineStream(line)
+	line = strings.TrimPrefix(strings.TrimPrefix(line, "[stdout] "), "[stderr] ")
+
+	fields := strings.SplitN(line, " ", 2)
+
+	t, err := time.Parse(time.RFC3339Nano, strings.Trim(fields[0], "[]"))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// logsMaxLineSize é o tamanho máximo de uma linha dos logs lida pelo scanner
+const logsMaxLineSize = 10 * 1024 * 1024
+
+// FilterLogs aplica nos logs os filtros que não são suportados pela API do
+// Rancher, como o tempo (since) e o padrão de busca (grep), e esconde os
+// segredos antes dos logs irem para o Slack
+func FilterLogs(content string, opts LogsOptions) []string {
+	var lines []string
+	scanLogs(strings.NewReader(content), opts, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+
+	return lines
+}
+
+// scanLogs lê os logs linha a linha, escondendo os segredos, limpando e
+// filtrando cada linha, e chama o emit com as linhas que ficam. No grep só as
+// linhas de contexto antes do próximo match ficam em memória
+func scanLogs(reader io.Reader, opts LogsOptions, emit func(line string) error) error {
+	var since time.Time
+	if opts.Since > 0 {
+		since = time.Now().Add(-opts.Since)
+	}
+	re := opts.Matcher()
+
+	// before são as linhas de contexto antes do próximo match, after quantas
+	// linhas ainda entram depois do último e last o índice da última enviada
+	var before []string
+	after, last, index := 0, -1, -1
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), logsMaxLineSize)
+	for scanner.Scan() {
+		cleaned := CleanLogLines([]string{RedactText(scanner.Text())}, opts.Stream)
+		if len(cleaned) == 0 {
+			continue
+		}
+		line := cleaned[0]
+
+		if !since.IsZero() && !logLineInRange(line, since, time.Time{}) {
+			continue
+		}
+		if !opts.From.IsZero() && !logLineInRange(line, opts.From, opts.To) {
+			continue
+		}
+		index++
+
+		var send []string
+		switch {
+		case re == nil:
+			send = []string{line}
+		case re.MatchString(line):
+			// Os blocos separados são divididos com "--" como no grep
+			if last >= 0 && index-len(before) > last+1 {
+				send = append(send, "--")
+			}
+			send = append(append(send, before...), line)
+			before, after, last = nil, opts.Context, index
+		case after > 0:
+			send = []string{line}
+			after, last = after-1, index
+		default:
+			before = append(before, line)
+			if len(before) > opts.Context {
+				before = before[1:]
+			}
+		}
+
+		for _, line := range send {
+			if err := emit(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// logLineInRange retorna se a data da linha está dentro do período, caso o
+// fim seja zero é considerado apenas o início. Linhas sem data são mantidas
+func logLineInRange(line string, from time.Time, to time.Time) bool {
+	t, ok := parseLogLine(line)
+	return !ok || (!t.Before(from) && (to.IsZero() || !t.After(to)))
+}
+
+// ContainerLogs lê os logs do container direto do WebSocket do Rancher e
+// aplica os filtros linha a linha, sem passar por arquivos em disco
+func ContainerLogs(containerID string, opts LogsOptions) (string, error) {
+	reader, err := rancherListener.ContainerLogsReader(containerID, opts.RancherLines())
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	var content strings.Builder
+	err = scanLogs(reader, opts, func(line string) error {
+		if content.Len() > 0 {
+			content.WriteString("\n")
+		}
+		content.WriteString(line)
+		return nil
+	})
+
+	return content.String(), err
+}
+
+// UploadContainerLogs busca os logs do container no Rancher, aplica os filtros
+// e faz o upload do arquivo no canal do BOT
+func UploadContainerLogs(containerID string, opts LogsOptions) ([]slack.File, error) {
+	if !opts.Filtered() {
+		return streamContainerLogs(containerID, opts)
+	}
+
+	content, err := ContainerLogs(containerID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fileName := fmt.Sprintf("logs-container-%s-%s.log", containerID, time.Now().Format("20060102150405"))
+	uploads, summary := PrepareLogsUpload(fileName, []byte(content), fmt.Sprintf("Logs do container: %s (%s)", containerID, opts.Describe()))
+
+	return uploadLogsFiles(uploads, summary)
+}
+
+// streamContainerLogs faz o upload dos logs sem filtros lidos do WebSocket
+// linha a linha, sem juntar em memória os logs maiores que o LogsMaxFileSize
+// (ver logsSpool). Como os filtrados, eles são compactados ou quebrados e, além
+// do LogsSlackMaxSize, enviados para o S3
+func streamContainerLogs(containerID string, opts LogsOptions) ([]slack.File, error) {
+	reader, err := rancherListener.ContainerLogsReader(containerID, opts.RancherLines())
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	fileName := fmt.Sprintf("logs-container-%s-%s.log", containerID, time.Now().Format("20060102150405"))
+	spool := newLogsSpool(fileName, fmt.Sprintf("Logs do container: %s (%s)", containerID, opts.Describe()))
+	defer spool.Remove()
+
+	if err := scanLogs(reader, opts, spool.WriteLine); err != nil {
+		return nil, err
+	}
+
+	uploads, summary, err := spool.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	return uploadLogsFiles(uploads, summary)
+}
+
+// uploadLogsFiles faz o upload dos arquivos de logs no canal do BOT, colocando
+// o resumo de tamanhos como comentário do primeiro arquivo
+func uploadLogsFiles(uploads []LogsUpload, summary string) ([]slack.File, error) {
+	api := getAPIConnection()
+
+	files := []slack.File{}
+
+	for i, upload := range uploads {
+		content, size, err := upload.open()
+		if err != nil {
+			return files, err
+		}
+
+		if size > LogsSlackMaxSize && S3Enabled() {
+			link, err := UploadLogsToS3(upload.Filename, content)
+			content.Close()
+			if err != nil {
+				CheckErr("Erro ao enviar arquivo de logs para o S3", err)
+				return files, err
+			}
+
+			msg := fmt.Sprintf("*%s*\nO arquivo tem %s e passa do limite do Slack, baixe pelo link (válido por %s):\n%s", upload.Title, FormatSize(size), LogsS3URLExpiry, link)
+			if i == 0 && summary != "" {
+				msg = fmt.Sprintf("%s\n_%s_", msg, summary)
+			}
+
+			api.client.PostMessage(api.channelID, slack.MsgOptionText(msg, false))
+			continue
+		}
+
+		params := slack.FileUploadParameters{
+			Reader:   content,
+			Filename: upload.Filename,
+			Filetype: upload.Filetype,
+			Title:    upload.Title,
+			Channels: []string{
+				api.channelID,
+			},
+		}
+
+		if i == 0 {
+			params.InitialComment = summary
+		}
+
+		file, err := api.client.UploadFile(params)
+		content.Close()
+		if err != nil {
+			CheckErr("Erro ao fazer upload de arquivo de logs de container", err)
+			return files, err
+		}
+
+		files = append(files, slack.File{
+			ID:       file.ID,
+			Title:    upload.Title,
+			Filetype: upload.Filetype,
+		})
+	}
+
+	return files, nil
+}
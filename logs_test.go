@@ -0,0 +1,160 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogsOptions(t *testing.T) {
+	tests := []struct {
+		args []string
+		opts LogsOptions
+	}{
+		{nil, LogsOptions{}},
+		{[]string{"lines=200"}, LogsOptions{Lines: 200}},
+		{[]string{"tail=30"}, LogsOptions{Lines: 30}},
+		{[]string{"lines=0", "lines=abc"}, LogsOptions{}},
+		{[]string{"since=15m"}, LogsOptions{Since: 15 * time.Minute}},
+		{[]string{"since=-1h"}, LogsOptions{}},
+		{[]string{"grep=timeout"}, LogsOptions{Pattern: "timeout", Context: defaultLogsContext}},
+		{[]string{"grep=a&amp;b", "context=0"}, LogsOptions{Pattern: "a&b"}},
+		{[]string{"grep=erro", "context=5"}, LogsOptions{Pattern: "erro", Context: 5}},
+		{[]string{"context=3"}, LogsOptions{Context: 3}},
+		{[]string{"stream=stderr"}, LogsOptions{Stream: logsStderr}},
+		{[]string{"stream=stdin"}, LogsOptions{}},
+	}
+
+	for _, test := range tests {
+		opts := ParseLogsOptions(test.args)
+		if !reflect.DeepEqual(opts, test.opts) {
+			t.Errorf("ParseLogsOptions(%v) = %+v, esperado %+v", test.args, opts, test.opts)
+		}
+	}
+}
+
+func TestParseLogsOptionsRange(t *testing.T) {
+	tests := []struct {
+		args     []string
+		from, to string
+	}{
+		{[]string{"from=2024-03-12T14:00", "to=2024-03-12T14:30"}, "2024-03-12T14:00:00Z", "2024-03-12T14:30:00Z"},
+		{[]string{"from", "2024-03-12T14:00", "to", "2024-03-12T14:30"}, "2024-03-12T14:00:00Z", "2024-03-12T14:30:00Z"},
+		{[]string{"tz=America/Sao_Paulo", "from=2024-03-12T14:00", "to=2024-03-12T14:30"}, "2024-03-12T17:00:00Z", "2024-03-12T17:30:00Z"},
+		{[]string{"from=ontem"}, "0001-01-01T00:00:00Z", "0001-01-01T00:00:00Z"},
+	}
+
+	defer func(loc *time.Location) { LogsTimezone = loc }(LogsTimezone)
+	LogsTimezone = time.UTC
+
+	for _, test := range tests {
+		opts := ParseLogsOptions(test.args)
+
+		from, to := opts.From.UTC().Format(time.RFC3339), opts.To.UTC().Format(time.RFC3339)
+		if from != test.from || to != test.to {
+			t.Errorf("ParseLogsOptions(%v): período %s a %s, esperado %s a %s", test.args, from, to, test.from, test.to)
+		}
+	}
+}
+
+func TestScanLogs(t *testing.T) {
+	logs := strings.Join([]string{
+		"01 2024-03-12T14:00:00Z iniciando",
+		"01 2024-03-12T14:00:01Z conectado",
+		"02 2024-03-12T14:00:02Z erro: timeout",
+		"01 2024-03-12T14:00:03Z tentando de novo",
+		"01 2024-03-12T14:00:04Z ok",
+		"01 2024-03-12T14:00:05Z aguardando",
+		"01 2024-03-12T14:00:06Z parado",
+		"02 2024-03-12T14:00:07Z erro: recusado",
+	}, "\n")
+
+	from, _ := time.Parse(time.RFC3339, "2024-03-12T14:00:04Z")
+	to, _ := time.Parse(time.RFC3339, "2024-03-12T14:00:05Z")
+
+	tests := []struct {
+		name  string
+		opts  LogsOptions
+		lines []string
+	}{
+		{"stderr", LogsOptions{Stream: logsStderr}, []string{
+			"2024-03-12T14:00:02Z erro: timeout",
+			"2024-03-12T14:00:07Z erro: recusado",
+		}},
+		{"grep sem contexto", LogsOptions{Pattern: "erro", Stream: logsStderr}, []string{
+			"2024-03-12T14:00:02Z erro: timeout",
+			"2024-03-12T14:00:07Z erro: recusado",
+		}},
+		{"grep com contexto", LogsOptions{Pattern: "erro", Context: 1}, []string{
+			"[stdout] 2024-03-12T14:00:01Z conectado",
+			"[stderr] 2024-03-12T14:00:02Z erro: timeout",
+			"[stdout] 2024-03-12T14:00:03Z tentando de novo",
+			"--",
+			"[stdout] 2024-03-12T14:00:06Z parado",
+			"[stderr] 2024-03-12T14:00:07Z erro: recusado",
+		}},
+		{"grep com contexto juntando os blocos", LogsOptions{Pattern: "timeout|parado", Context: 2}, []string{
+			"[stdout] 2024-03-12T14:00:00Z iniciando",
+			"[stdout] 2024-03-12T14:00:01Z conectado",
+			"[stderr] 2024-03-12T14:00:02Z erro: timeout",
+			"[stdout] 2024-03-12T14:00:03Z tentando de novo",
+			"[stdout] 2024-03-12T14:00:04Z ok",
+			"[stdout] 2024-03-12T14:00:05Z aguardando",
+			"[stdout] 2024-03-12T14:00:06Z parado",
+			"[stderr] 2024-03-12T14:00:07Z erro: recusado",
+		}},
+		{"período", LogsOptions{From: from, To: to, Stream: logsStdout}, []string{
+			"2024-03-12T14:00:04Z ok",
+			"2024-03-12T14:00:05Z aguardando",
+		}},
+		{"padrão inválido como texto", LogsOptions{Pattern: "erro: (", Stream: logsStderr}, nil},
+	}
+
+	for _, test := range tests {
+		var lines []string
+		err := scanLogs(strings.NewReader(logs), test.opts, func(line string) error {
+			lines = append(lines, line)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: scanLogs retornou %s", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(lines, test.lines) {
+			t.Errorf("%s: linhas\n%s\nesperado\n%s", test.name, strings.Join(lines, "\n"), strings.Join(test.lines, "\n"))
+		}
+	}
+}
+
+func TestScanLogsEmitError(t *testing.T) {
+	stop := errors.New("parou")
+	count := 0
+
+	err := scanLogs(strings.NewReader("a\nb\nc"), LogsOptions{}, func(line string) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Errorf("scanLogs retornou %v depois de %d linhas, esperado o erro do emit na primeira", err, count)
+	}
+}
+
+func TestScanLogsRedacts(t *testing.T) {
+	LoadRedactionRules()
+
+	var lines []string
+	scanLogs(strings.NewReader("01 conectando com password=hunter2"), LogsOptions{}, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+
+	if len(lines) != 1 || strings.Contains(lines[0], "hunter2") {
+		t.Errorf("scanLogs não escondeu o segredo: %v", lines)
+	}
+}
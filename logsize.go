@@ -0,0 +1,297 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// logsModeGzip compacta os arquivos grandes antes do upload
+	logsModeGzip = "gzip"
+
+	// logsModeSplit quebra os arquivos grandes em partes numeradas
+	logsModeSplit = "split"
+)
+
+var (
+	// LogsMaxFileSize é o tamanho a partir do qual os arquivos de logs são
+	// compactados ou quebrados em partes antes do upload
+	LogsMaxFileSize int64 = 5 << 20
+
+	// LogsLargeFileMode é o que será feito com os arquivos maiores que
+	// LogsMaxFileSize, podendo ser "gzip" ou "split"
+	LogsLargeFileMode = logsModeGzip
+)
+
+// LogsUpload é a estrutura que representa um arquivo que será enviado ao
+// Slack, com o conteúdo em memória ou, nos logs lidos em stream maiores que o
+// LogsMaxFileSize, no arquivo temporário Path
+type LogsUpload struct {
+	Filename string
+	Content  []byte
+	Path     string
+	Filetype string
+	Title    string
+}
+
+// open abre o conteúdo do arquivo para o upload, retornando o tamanho
+func (u LogsUpload) open() (io.ReadCloser, int64, error) {
+	if u.Path == "" {
+		return ioutil.NopCloser(bytes.NewReader(u.Content)), int64(len(u.Content)), nil
+	}
+
+	file, err := os.Open(u.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+
+	return file, info.Size(), nil
+}
+
+// PrepareLogsUpload é a função que verifica o tamanho dos logs e, caso passe
+// do limite, compacta ou quebra em partes. Retorna os arquivos que devem ser
+// enviados e um resumo dos tamanhos para ser mostrado ao usuário
+func PrepareLogsUpload(fileName string, content []byte, title string) ([]LogsUpload, string) {
+	original := []LogsUpload{{Filename: fileName, Content: content, Filetype: "text", Title: title}}
+
+	size := int64(len(content))
+	if size <= LogsMaxFileSize {
+		return original, ""
+	}
+
+	if LogsLargeFileMode == logsModeSplit {
+		parts := splitLogs(content, LogsMaxFileSize)
+
+		uploads := []LogsUpload{}
+		for i, part := range parts {
+			uploads = append(uploads, LogsUpload{
+				Filename: fmt.Sprintf("%s.part%d", fileName, i+1),
+				Content:  part,
+				Filetype: "text",
+				Title:    fmt.Sprintf("%s [parte %d/%d]", title, i+1, len(parts)),
+			})
+		}
+
+		return uploads, fmt.Sprintf("Arquivo de %s quebrado em %d partes", FormatSize(size), len(parts))
+	}
+
+	compressed, err := gzipLogs(content)
+	if err != nil {
+		CheckErr("Erro ao compactar os logs", err)
+		return original, ""
+	}
+
+	summary := fmt.Sprintf("Arquivo compactado de %s para %s", FormatSize(size), FormatSize(int64(len(compressed))))
+
+	return []LogsUpload{{Filename: fileName + ".gz", Content: compressed, Filetype: "gzip", Title: title + " (gzip)"}}, summary
+}
+
+// logsSpool junta os logs lidos em stream para o upload com o mesmo
+// tratamento do PrepareLogsUpload, sem guardar mais que o LogsMaxFileSize em
+// memória: passando dele os logs vão compactados para um arquivo temporário
+// (gzip) ou cada parte para o seu arquivo (split)
+type logsSpool struct {
+	fileName string
+	title    string
+	size     int64
+
+	buffer bytes.Buffer
+	parts  []string
+	file   *os.File
+	gz     *gzip.Writer
+}
+
+func newLogsSpool(fileName string, title string) *logsSpool {
+	return &logsSpool{fileName: fileName, title: title}
+}
+
+// WriteLine adiciona a linha aos logs
+func (s *logsSpool) WriteLine(line string) error {
+	size := int64(len(line) + 1)
+	s.size += size
+
+	if s.gz != nil {
+		_, err := io.WriteString(s.gz, line+"\n")
+		return err
+	}
+
+	if int64(s.buffer.Len())+size > LogsMaxFileSize && s.buffer.Len() > 0 {
+		var err error
+		if LogsLargeFileMode == logsModeSplit {
+			err = s.flushPart()
+		} else {
+			err = s.startGzip()
+		}
+		if err != nil {
+			return err
+		}
+
+		if s.gz != nil {
+			_, err := io.WriteString(s.gz, line+"\n")
+			return err
+		}
+	}
+
+	s.buffer.WriteString(line + "\n")
+	return nil
+}
+
+// flushPart grava a parte em memória no arquivo temporário dela
+func (s *logsSpool) flushPart() error {
+	file, err := ioutil.TempFile("", "slack-bot-logs-")
+	if err != nil {
+		return err
+	}
+	s.parts = append(s.parts, file.Name())
+
+	_, err = file.Write(s.buffer.Bytes())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	s.buffer.Reset()
+
+	return err
+}
+
+// startGzip passa a compactar os logs no arquivo temporário, a começar pelo
+// que já está em memória
+func (s *logsSpool) startGzip() error {
+	file, err := ioutil.TempFile("", "slack-bot-logs-")
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.gz = gzip.NewWriter(file)
+
+	_, err = s.gz.Write(s.buffer.Bytes())
+	s.buffer.Reset()
+
+	return err
+}
+
+// Finish termina os logs, retornando os arquivos do upload e o resumo dos
+// tamanhos, como o PrepareLogsUpload
+func (s *logsSpool) Finish() ([]LogsUpload, string, error) {
+	if s.gz != nil {
+		err := s.gz.Close()
+		if closeErr := s.file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		info, err := os.Stat(s.file.Name())
+		if err != nil {
+			return nil, "", err
+		}
+
+		summary := fmt.Sprintf("Arquivo compactado de %s para %s", FormatSize(s.size), FormatSize(info.Size()))
+		return []LogsUpload{{Filename: s.fileName + ".gz", Path: s.file.Name(), Filetype: "gzip", Title: s.title + " (gzip)"}}, summary, nil
+	}
+
+	if len(s.parts) == 0 {
+		return []LogsUpload{{Filename: s.fileName, Content: s.buffer.Bytes(), Filetype: "text", Title: s.title}}, "", nil
+	}
+
+	if s.buffer.Len() > 0 {
+		if err := s.flushPart(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	uploads := []LogsUpload{}
+	for i, path := range s.parts {
+		uploads = append(uploads, LogsUpload{
+			Filename: fmt.Sprintf("%s.part%d", s.fileName, i+1),
+			Path:     path,
+			Filetype: "text",
+			Title:    fmt.Sprintf("%s [parte %d/%d]", s.title, i+1, len(s.parts)),
+		})
+	}
+
+	return uploads, fmt.Sprintf("Arquivo de %s quebrado em %d partes", FormatSize(s.size), len(s.parts)), nil
+}
+
+// Remove apaga os arquivos temporários
+func (s *logsSpool) Remove() {
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.file.Name())
+	}
+
+	for _, path := range s.parts {
+		os.Remove(path)
+	}
+}
+
+// gzipLogs compacta os logs em memória
+func gzipLogs(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+
+	if _, err := gz.Write(content); err != nil {
+		return nil, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// splitLogs quebra os logs em partes de no máximo maxSize bytes, sem quebrar
+// as linhas no meio (a não ser que a linha sozinha passe do limite)
+func splitLogs(content []byte, maxSize int64) [][]byte {
+	var parts [][]byte
+	var part []byte
+
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n') + 1
+		if end == 0 {
+			end = len(content)
+		}
+		line := content[:end]
+		content = content[end:]
+
+		if len(part) > 0 && int64(len(part)+len(line)) > maxSize {
+			parts = append(parts, part)
+			part = nil
+		}
+
+		part = append(part, line...)
+	}
+
+	if len(part) > 0 {
+		parts = append(parts, part)
+	}
+
+	return parts
+}
+
+// formatBytes formata o tamanho em B, KB ou MB
+func formatBytes(size int) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	}
+
+	return fmt.Sprintf("%d B", size)
+}
@@ -0,0 +1,360 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/rgamba/evtwebsocket"
+)
+
+const (
+	actionStopStream = "stop-stream"
+
+	// logsStreamMaxChars é o tamanho máximo de cada mensagem enviada na thread
+	logsStreamMaxChars = 3500
+)
+
+var (
+	// LogsStreamTimeout é o tempo máximo que um stream de logs fica aberto
+	LogsStreamTimeout = 10 * time.Minute
+
+	// LogsStreamInterval é o intervalo entre cada envio de logs para a thread
+	LogsStreamInterval = 5 * time.Second
+
+	// LogsStreamMaxPerUser é a quantidade máxima de streams abertos por usuário
+	LogsStreamMaxPerUser = 2
+)
+
+// LogStream é a estrutura que representa um stream de logs de um container
+// que está sendo enviado para uma thread no Slack
+type LogStream struct {
+	ID          string
+	ContainerID string
+	Channel     string
+	ThreadTs    string
+	User        string
+	Duration    time.Duration
+	StartedAt   time.Time
+
+	conn     *evtwebsocket.Conn
+	buffer   []string
+	closed   bool
+	mutex    sync.Mutex
+	stop     chan string
+	stopOnce sync.Once
+}
+
+var (
+	logStreams      = map[string]*LogStream{}
+	logStreamsMutex sync.Mutex
+)
+
+// StartLogStream é a função que abre o WebSocket de logs do container e começa
+// a enviar os logs na thread da mensagem passada, até o tempo informado
+// (limitado pelo LogsStreamTimeout)
+func StartLogStream(containerID string, channel string, threadTs string, user string, duration time.Duration) *LogStream {
+	if duration <= 0 || duration > LogsStreamTimeout {
+		duration = LogsStreamTimeout
+	}
+
+	stream := &LogStream{
+		ID:          threadTs,
+		ContainerID: containerID,
+		Channel:     channel,
+		ThreadTs:    threadTs,
+		User:        user,
+		Duration:    duration,
+		StartedAt:   time.Now(),
+		stop:        make(chan string, 1),
+	}
+
+	stream.conn = &evtwebsocket.Conn{
+		OnConnected: func(w *evtwebsocket.Conn) {
+			log.Printf("[INFO] Stream de logs do container %s iniciado\n", containerID)
+		},
+
+		OnMessage: func(msg []byte, w *evtwebsocket.Conn) {
+			stream.mutex.Lock()
+			if !stream.closed {
+				stream.buffer = append(stream.buffer, CleanLogLines([]string{RedactText(string(msg))}, logsBoth)...)
+			}
+			stream.mutex.Unlock()
+		},
+
+		OnError: func(err error) {
+			// Depois do Close o WebSocket avisa o erro de conexão fechada
+			if stream.isClosed() {
+				return
+			}
+
+			log.Printf("[ERROR] Erro no stream de logs do container %s: %s\n", containerID, err.Error())
+			stream.Stop("erro na conexão com o Rancher")
+		},
+	}
+
+	logStreamsMutex.Lock()
+	logStreams[stream.ID] = stream
+	logStreamsMutex.Unlock()
+
+	err := stream.conn.Dial(rancherListener.LogsWebSocketURL(containerID, true, 50), "")
+	if err != nil {
+		CheckErr("Erro ao conectar no WebSocket de logs", err)
+		stream.Stop("erro na conexão com o Rancher")
+	}
+
+	go stream.run()
+
+	return stream
+}
+
+// StopLogStream é a função que para o stream de logs pelo seu ID
+func StopLogStream(id string, reason string) bool {
+	logStreamsMutex.Lock()
+	stream, ok := logStreams[id]
+	logStreamsMutex.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	stream.Stop(reason)
+
+	return true
+}
+
+// StopUserLogStreams é a função que para todos os streams abertos pelo usuário,
+// retornando quantos foram parados
+func StopUserLogStreams(user string, reason string) int {
+	streams := UserLogStreams(user)
+
+	for _, stream := range streams {
+		stream.Stop(reason)
+	}
+
+	return len(streams)
+}
+
+// StopAllLogStreams para todos os streams abertos e espera eles finalizarem
+// (até o ctx expirar), retornando quantos foram parados
+func StopAllLogStreams(ctx context.Context, reason string) int {
+	logStreamsMutex.Lock()
+	streams := []*LogStream{}
+	for _, stream := range logStreams {
+		streams = append(streams, stream)
+	}
+	logStreamsMutex.Unlock()
+
+	for _, stream := range streams {
+		stream.Stop(reason)
+	}
+
+	for {
+		logStreamsMutex.Lock()
+		open := len(logStreams)
+		logStreamsMutex.Unlock()
+
+		if open == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return len(streams)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	return len(streams)
+}
+
+// UserLogStreams retorna os streams de logs abertos pelo usuário
+func UserLogStreams(user string) []*LogStream {
+	logStreamsMutex.Lock()
+	defer logStreamsMutex.Unlock()
+
+	streams := []*LogStream{}
+	for _, stream := range logStreams {
+		if stream.User == user {
+			streams = append(streams, stream)
+		}
+	}
+
+	return streams
+}
+
+// Stop sinaliza o stream para que ele seja finalizado
+func (l *LogStream) Stop(reason string) {
+	l.stopOnce.Do(func() {
+		l.stop <- reason
+	})
+}
+
+func (l *LogStream) isClosed() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.closed
+}
+
+// close fecha o WebSocket com o Rancher, ignorando as mensagens que ainda chegarem
+func (l *LogStream) close() {
+	l.mutex.Lock()
+	l.closed = true
+	l.mutex.Unlock()
+
+	if err := l.conn.Close(); err != nil {
+		CheckErr(fmt.Sprintf("Erro ao fechar o WebSocket de logs do container %s", l.ContainerID), err)
+	}
+}
+
+func (l *LogStream) run() {
+	ticker := time.NewTicker(LogsStreamInterval)
+	defer ticker.Stop()
+
+	timeout := time.NewTimer(l.Duration)
+	defer timeout.Stop()
+
+	var reason string
+
+	for reason == "" {
+		select {
+		case <-ticker.C:
+			l.flush()
+		case <-timeout.C:
+			reason = fmt.Sprintf("tempo limite de %s atingido", l.Duration)
+		case reason = <-l.stop:
+		}
+	}
+
+	l.close()
+	l.flush()
+
+	logStreamsMutex.Lock()
+	delete(logStreams, l.ID)
+	logStreamsMutex.Unlock()
+
+	api := getAPIConnection()
+	api.client.UpdateMessage(l.Channel, l.ThreadTs, slack.MsgOptionAttachments(slack.Attachment{
+		Text:  fmt.Sprintf("Stream de logs do container `%s` finalizado: _%s_", l.ContainerID, reason),
+		Color: "#0C648A",
+	}))
+
+	log.Printf("[INFO] Stream de logs do container %s finalizado: %s\n", l.ContainerID, reason)
+}
+
+// flush envia o que estiver no buffer para a thread, quebrando em várias
+// mensagens caso passe do tamanho máximo
+func (l *LogStream) flush() {
+	l.mutex.Lock()
+	lines := l.buffer
+	l.buffer = nil
+	l.mutex.Unlock()
+
+	if len(lines) == 0 {
+		return
+	}
+
+	api := getAPIConnection()
+
+	for _, chunk := range splitLogChunks(lines, logsStreamMaxChars) {
+		api.client.PostMessage(l.Channel, slack.MsgOptionText(fmt.Sprintf("```%s```", chunk), false), slack.MsgOptionTS(l.ThreadTs))
+	}
+}
+
+// splitLogChunks junta as linhas de log em blocos de no máximo maxChars caracteres
+func splitLogChunks(lines []string, maxChars int) []string {
+	var chunks []string
+	var current strings.Builder
+
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\n")
+
+		if len(line) > maxChars {
+			line = line[:maxChars]
+		}
+
+		if current.Len()+len(line)+1 > maxChars {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+
+	return chunks
+}
+
+// EncodeStreamValue junta o ID do container com a duração do stream
+func EncodeStreamValue(containerID string, duration time.Duration) string {
+	if duration <= 0 {
+		return containerID
+	}
+
+	return fmt.Sprintf("%s?duration=%s", containerID, duration)
+}
+
+// DecodeStreamValue separa o ID do container da duração do stream
+func DecodeStreamValue(value string) (string, time.Duration) {
+	parts := strings.SplitN(value, "?duration=", 2)
+	if len(parts) == 1 {
+		return parts[0], 0
+	}
+
+	duration, err := time.ParseDuration(parts[1])
+	CheckErr("Erro ao ler a duração do stream de logs", err)
+
+	return parts[0], duration
+}
+
+func actionStreamLogs(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	value, duration := DecodeStreamValue(message.Actions[0].SelectedOptions[0].Value)
+
+	if len(UserLogStreams(message.User.ID)) >= LogsStreamMaxPerUser {
+		responseMessage(w, message.OriginalMessage, fmt.Sprintf(":no_entry: Você já tem %d streams de logs abertos, pare algum antes de abrir outro (`stop-stream`)", LogsStreamMaxPerUser), "")
+		return
+	}
+
+	api := getAPIConnection()
+
+	_, ts, err := api.client.PostMessage(message.Channel.ID, slack.MsgOptionAttachments(slack.Attachment{
+		Text:       fmt.Sprintf("Stream de logs do container `%s` iniciado por @%s :tv:", value, message.User.Name),
+		Color:      "#0C648A",
+		CallbackID: streamLogs,
+		Actions: []slack.AttachmentAction{
+			{
+				Name:  actionStopStream,
+				Text:  "Parar",
+				Type:  "button",
+				Style: "danger",
+			},
+		},
+	}))
+	if err != nil {
+		CheckErr("Erro ao enviar mensagem do stream de logs", err)
+		return
+	}
+
+	StartLogStream(value, message.Channel.ID, ts, message.User.ID, duration)
+
+	api.client.DeleteMessage(message.Channel.ID, message.MessageTs)
+}
+
+func actionStopStreamFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	if !StopLogStream(message.MessageTs, fmt.Sprintf("parado por @%s", message.User.Name)) {
+		responseMessage(w, message.OriginalMessage, "Esse stream de logs já foi finalizado", "")
+	}
+}
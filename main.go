@@ -10,7 +10,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -57,6 +60,11 @@ var (
 )
 
 func main() {
+	// Com argumentos o binário funciona como CLI da API admin
+	if len(os.Args) > 1 {
+		os.Exit(RunCLI(os.Args[1:]))
+	}
+
 	File := os.Getenv("FILE")
 
 	FileOpen, err := os.Open(File)
@@ -86,6 +94,8 @@ func main() {
 			RancherBaseURL = valor
 		case "RANCHER_PROJECT_ID":
 			RancherProjectID = valor
+		case "RANCHER_PROJECTS":
+			RancherProjects = ParseServiceMap(valor)
 		case "SLACK_BOT_TOKEN":
 			SlackBotToken = valor
 		case "SLACK_BOT_ID":
@@ -102,9 +112,504 @@ func main() {
 			SplunkPassword = valor
 		case "SPLUNK_BASE_URL":
 			SplunkBaseURL = valor
+		case "CANARY_STATE_FILE":
+			CanaryStateFile = valor
+		case "LOGS_TIMEZONE":
+			if loc, err := time.LoadLocation(valor); valor != "" && err == nil {
+				LogsTimezone = loc
+			} else {
+				CheckErr("Erro ao carregar o LOGS_TIMEZONE", err)
+			}
+		case "LOGS_MAX_FILE_SIZE":
+			LogsMaxFileSize = ParseSizeEnv(chave, valor, LogsMaxFileSize)
+		case "LOGS_LARGE_FILE_MODE":
+			if valor != "" {
+				LogsLargeFileMode = valor
+			}
+		case "LOGS_SLACK_MAX_SIZE":
+			LogsSlackMaxSize = ParseSizeEnv(chave, valor, LogsSlackMaxSize)
+		case "LOGS_S3_BUCKET":
+			LogsS3Bucket = valor
+		case "LOGS_S3_REGION":
+			if valor != "" {
+				LogsS3Region = valor
+			}
+		case "LOGS_S3_ENDPOINT":
+			LogsS3Endpoint = valor
+		case "LOGS_S3_ACCESS_KEY":
+			LogsS3AccessKey = valor
+		case "LOGS_S3_SECRET_KEY":
+			LogsS3SecretKey = valor
+		case "LOGS_S3_URL_EXPIRY":
+			LogsS3URLExpiry = ParseDurationEnv(chave, valor, LogsS3URLExpiry)
+		case "LOGS_REDACT_FILE":
+			LogsRedactFile = valor
+		case "LOGS_REDACT_DEFAULTS":
+			LogsRedactDefaults = valor != "false"
+		case "LOGS_STREAM_TIMEOUT":
+			LogsStreamTimeout = ParseDurationEnv(chave, valor, LogsStreamTimeout)
+		case "LOGS_STREAM_INTERVAL":
+			LogsStreamInterval = ParseDurationEnv(chave, valor, LogsStreamInterval)
+		case "LOGS_STREAM_MAX_PER_USER":
+			if maxStreams, err := strconv.Atoi(valor); err == nil && maxStreams > 0 {
+				LogsStreamMaxPerUser = maxStreams
+			}
+		case "ALERTMANAGER_URL":
+			AlertmanagerURL = strings.TrimSuffix(valor, "/")
+		case "ALERTMANAGER_TOKEN":
+			AlertmanagerToken = valor
+		case "ALERTMANAGER_SILENCE_DURATION":
+			AlertmanagerSilenceDuration = ParseDurationEnv(chave, valor, AlertmanagerSilenceDuration)
+		case "ALERTMANAGER_CONTAINER_LABEL":
+			if valor != "" {
+				AlertmanagerContainerLabel = valor
+			}
+		case "GRAFANA_TOKEN":
+			GrafanaToken = valor
+		case "GRAFANA_SERVICE_MAP":
+			GrafanaServiceMap = ParseServiceMap(valor)
+		case "GRAFANA_URL":
+			GrafanaURL = valor
+		case "GRAFANA_API_KEY":
+			GrafanaAPIKey = valor
+		case "GRAFANA_PANELS":
+			GrafanaPanels = ParseServiceMap(valor)
+		case "GRAFANA_PANEL_RANGE":
+			GrafanaPanelRange = ParseDurationEnv(chave, valor, GrafanaPanelRange)
+		case "ALERT_GROUP_WINDOW":
+			AlertGroupWindow = ParseDurationEnv(chave, valor, AlertGroupWindow)
+		case "ESCALATION_REMIND":
+			EscalationRemind = ParseEscalationDurations(chave, valor)
+		case "ESCALATION_PAGE":
+			EscalationPage = ParseEscalationDurations(chave, valor)
+		case "ESCALATION_GROUPS":
+			EscalationGroups = ParseServiceMap(valor)
+		case "PAGERDUTY_ROUTING_KEYS":
+			PagerDutyRoutingKeys = ParseServiceMap(valor)
+		case "PAGERDUTY_DEFAULT_ROUTING_KEY":
+			PagerDutyDefaultRoutingKey = valor
+		case "PAGERDUTY_AUTO_PAGE":
+			PagerDutyAutoPage = valor == "true"
+		case "OPSGENIE_API_KEY":
+			OpsgenieAPIKey = valor
+		case "OPSGENIE_API_URL":
+			if valor != "" {
+				OpsgenieAPIURL = strings.TrimSuffix(valor, "/")
+			}
+		case "OPSGENIE_TOKEN":
+			OpsgenieToken = valor
+		case "JIRA_URL":
+			JiraURL = strings.TrimSuffix(valor, "/")
+		case "JIRA_USER":
+			JiraUser = valor
+		case "JIRA_TOKEN":
+			JiraToken = valor
+		case "JIRA_PROJECT":
+			JiraProject = valor
+		case "JIRA_ISSUE_TYPE":
+			if valor != "" {
+				JiraIssueType = valor
+			}
+		case "GITHUB_TOKEN":
+			GitHubToken = valor
+		case "GITHUB_API_URL":
+			if valor != "" {
+				GitHubAPIURL = strings.TrimSuffix(valor, "/")
+			}
+		case "GITHUB_DEFAULT_REF":
+			if valor != "" {
+				GitHubDefaultRef = valor
+			}
+		case "GITLAB_URL":
+			if valor != "" {
+				GitLabURL = strings.TrimSuffix(valor, "/")
+			}
+		case "GITLAB_TOKEN":
+			GitLabToken = valor
+		case "GITLAB_DEFAULT_REF":
+			if valor != "" {
+				GitLabDefaultRef = valor
+			}
+		case "JENKINS_URL":
+			JenkinsURL = strings.TrimSuffix(valor, "/")
+		case "JENKINS_USER":
+			JenkinsUser = valor
+		case "JENKINS_TOKEN":
+			JenkinsToken = valor
+		case "JENKINS_JOBS":
+			if valor != "" {
+				JenkinsJobs = strings.Split(valor, ",")
+			}
+		case "PIPELINE_POLL_INTERVAL":
+			PipelinePollInterval = ParseDurationEnv(chave, valor, PipelinePollInterval)
+		case "PIPELINE_TIMEOUT":
+			PipelineTimeout = ParseDurationEnv(chave, valor, PipelineTimeout)
+		case "REGISTRY_TOKEN":
+			RegistryToken = valor
+		case "REGISTRY_USERNAME":
+			RegistryUsername = valor
+		case "REGISTRY_PASSWORD":
+			RegistryPassword = valor
+		case "REGISTRY_TRACKED_IMAGES":
+			if valor != "" {
+				RegistryTrackedImages = strings.Split(valor, ",")
+			}
+		case "HARBOR_URL":
+			HarborURL = strings.TrimSuffix(valor, "/")
+		case "HARBOR_USER":
+			HarborUser = valor
+		case "HARBOR_PASSWORD":
+			HarborPassword = valor
+		case "HARBOR_TOKEN":
+			HarborToken = valor
+		case "SCAN_BLOCK_SEVERITY":
+			ScanBlockSeverity = valor
+		case "SCAN_DENY_UNSCANNED":
+			ScanDenyUnscanned = valor == "true"
+		case "POLICY_REQUIRED_LABELS":
+			if valor != "" {
+				PolicyRequiredLabels = strings.Split(valor, ",")
+			}
+		case "POLICY_REQUIRE_LIMITS":
+			PolicyRequireLimits = valor == "true"
+		case "POLICY_DENY_LATEST":
+			PolicyDenyLatest = valor == "true"
+		case "POLICY_ALLOWED_REGISTRIES":
+			if valor != "" {
+				PolicyAllowedRegistries = strings.Split(valor, ",")
+			}
+		case "STATUSPAGE_API_KEY":
+			StatuspageAPIKey = valor
+		case "STATUSPAGE_PAGE_ID":
+			StatuspagePageID = valor
+		case "STATUSPAGE_COMPONENT_MAP":
+			StatuspageComponentMap = ParseServiceMap(valor)
+		case "STATUSPAGE_AUTO_UPDATE":
+			StatuspageAutoUpdate = valor == "true"
+		case "STATUSPAGE_CHECK_INTERVAL":
+			StatuspageCheckInterval = ParseDurationEnv(chave, valor, StatuspageCheckInterval)
+		case "INCIDENT_ONCALL_GROUP":
+			IncidentOncallGroup = valor
+		case "INCIDENT_CHANNEL_PREFIX":
+			if valor != "" {
+				IncidentChannelPrefix = valor
+			}
+		case "ONCALL_PROVIDER":
+			if valor != "" {
+				OncallProvider = valor
+			}
+		case "ONCALL_SCHEDULES":
+			OncallSchedules = ParseServiceMap(valor)
+		case "ONCALL_DEFAULT_ROTATION":
+			OncallDefaultRotation = valor
+		case "PAGERDUTY_API_KEY":
+			PagerDutyAPIKey = valor
+		case "TERRAFORM_DIR":
+			TerraformDir = valor
+		case "TERRAFORM_BIN":
+			if valor != "" {
+				TerraformBin = valor
+			}
+		case "TERRAFORM_APPROVERS":
+			if valor != "" {
+				TerraformApprovers = strings.Split(valor, ",")
+			}
+		case "ORCHESTRATOR":
+			if valor != "" {
+				OrchestratorBackend = valor
+			}
+		case "ORCHESTRATOR_ENVIRONMENTS":
+			OrchestratorEnvironments = ParseServiceMap(valor)
+		case "K8S_API_URL":
+			KubernetesAPIURL = strings.TrimSuffix(valor, "/")
+		case "K8S_TOKEN":
+			KubernetesToken = valor
+		case "K8S_NAMESPACE":
+			KubernetesNamespace = valor
+		case "K8S_CA_FILE":
+			KubernetesCAFile = valor
+		case "K8S_INSECURE":
+			KubernetesInsecure = valor == "true"
+		case "SWARM_HOST":
+			if valor != "" {
+				SwarmHost = valor
+			}
+		case "SWARM_CERT_PATH":
+			SwarmCertPath = valor
+		case "ECS_CLUSTER":
+			if valor != "" {
+				ECSCluster = valor
+			}
+		case "ECS_REGION":
+			if valor != "" {
+				ECSRegion = valor
+			}
+		case "ECS_ACCESS_KEY":
+			ECSAccessKey = valor
+		case "ECS_SECRET_KEY":
+			ECSSecretKey = valor
+		case "DATADOG_API_KEY":
+			DatadogAPIKey = valor
+		case "DATADOG_APP_KEY":
+			DatadogAppKey = valor
+		case "DATADOG_SITE":
+			if valor != "" {
+				DatadogSite = valor
+			}
+		case "DATADOG_TAGS":
+			if valor != "" {
+				DatadogTags = strings.Split(valor, ",")
+			}
+		case "DATADOG_SERVICE_MAP":
+			DatadogServiceMap = ParseServiceMap(valor)
+		case "DATADOG_MUTE_DURATION":
+			DatadogMuteDuration = ParseDurationEnv(chave, valor, DatadogMuteDuration)
+		case "NEWRELIC_API_KEY":
+			NewRelicAPIKey = valor
+		case "NEWRELIC_REGION":
+			if valor != "" {
+				NewRelicRegion = strings.ToLower(valor)
+			}
+		case "NEWRELIC_APPS":
+			NewRelicApps = ParseServiceMap(valor)
+		case "UPTIME_CHECKS":
+			UptimeChecks = ParseServiceMap(valor)
+		case "UPTIME_INTERVAL":
+			UptimeInterval = ParseDurationEnv(chave, valor, UptimeInterval)
+		case "UPTIME_TIMEOUT":
+			UptimeTimeout = ParseDurationEnv(chave, valor, UptimeTimeout)
+		case "UPTIME_LATENCY_THRESHOLD":
+			UptimeLatencyThreshold = ParseDurationEnv(chave, valor, UptimeLatencyThreshold)
+		case "UPTIME_FAILURES":
+			if n, err := strconv.Atoi(valor); err == nil && n > 0 {
+				UptimeFailures = n
+			}
+		case "TLS_HOSTS":
+			if valor != "" {
+				TLSHosts = strings.Split(valor, ",")
+			}
+		case "TLS_RANCHER_CERTIFICATES":
+			TLSRancherCertificates = valor != "false"
+		case "TLS_WARN_DAYS":
+			if n, err := strconv.Atoi(valor); err == nil && n > 0 {
+				TLSWarnDays = n
+			}
+		case "TLS_CHECK_INTERVAL":
+			TLSCheckInterval = ParseDurationEnv(chave, valor, TLSCheckInterval)
+		case "HOST_MONITOR":
+			HostMonitor = valor == "true"
+		case "HOST_CPU_THRESHOLD":
+			if n, err := strconv.ParseFloat(valor, 64); err == nil && n > 0 {
+				HostCPUThreshold = n
+			}
+		case "HOST_MEMORY_THRESHOLD":
+			if n, err := strconv.ParseFloat(valor, 64); err == nil && n > 0 {
+				HostMemoryThreshold = n
+			}
+		case "HOST_DISK_THRESHOLD":
+			if n, err := strconv.ParseFloat(valor, 64); err == nil && n > 0 {
+				HostDiskThreshold = n
+			}
+		case "HOST_CHECK_INTERVAL":
+			HostCheckInterval = ParseDurationEnv(chave, valor, HostCheckInterval)
+		case "CRASHLOOP_MONITOR":
+			CrashLoopMonitor = valor == "true"
+		case "CRASHLOOP_RESTARTS":
+			if n, err := strconv.Atoi(valor); err == nil && n > 0 {
+				CrashLoopRestarts = n
+			}
+		case "CRASHLOOP_WINDOW":
+			CrashLoopWindow = ParseDurationEnv(chave, valor, CrashLoopWindow)
+		case "CRASHLOOP_INTERVAL":
+			CrashLoopInterval = ParseDurationEnv(chave, valor, CrashLoopInterval)
+		case "RANCHER_EVENTS":
+			RancherEvents = valor == "true"
+		case "JOBS_WORKERS":
+			if n, err := strconv.Atoi(valor); err == nil && n > 0 {
+				JobsWorkers = n
+			}
+		case "JOBS_QUEUE_SIZE":
+			if n, err := strconv.Atoi(valor); err == nil && n > 0 {
+				JobsQueueSize = n
+			}
+		case "RANCHER_CACHE_TTL":
+			RancherCacheTTL = ParseDurationEnv(chave, valor, RancherCacheTTL)
+		case "RANCHER_TIMEOUT":
+			RancherTimeout = ParseDurationEnv(chave, valor, RancherTimeout)
+		case "SLACK_TIMEOUT":
+			SlackTimeout = ParseDurationEnv(chave, valor, SlackTimeout)
+		case "SHUTDOWN_TIMEOUT":
+			ShutdownTimeout = ParseDurationEnv(chave, valor, ShutdownTimeout)
+		case "RANCHER_RETRIES":
+			if n, err := strconv.Atoi(valor); err == nil && n > 0 {
+				RancherRetries = n
+			}
+		case "RANCHER_RETRY_BACKOFF":
+			RancherRetryBackoff = ParseDurationEnv(chave, valor, RancherRetryBackoff)
+		case "RANCHER_RETRY_STATUS":
+			if valor != "" {
+				RancherRetryStatus = map[int]bool{}
+				for _, status := range strings.Split(valor, ",") {
+					if code, err := strconv.Atoi(strings.TrimSpace(status)); err == nil {
+						RancherRetryStatus[code] = true
+					}
+				}
+			}
+		case "RANCHER_BREAKER_FAILURES":
+			if n, err := strconv.Atoi(valor); err == nil && n > 0 {
+				RancherBreakerFailures = n
+			}
+		case "RANCHER_BREAKER_COOLDOWN":
+			RancherBreakerCooldown = ParseDurationEnv(chave, valor, RancherBreakerCooldown)
+		case "LEADER_ELECTION":
+			LeaderElection = valor
+		case "LEADER_KEY":
+			if valor != "" {
+				LeaderKey = valor
+			}
+		case "LEADER_LEASE_DURATION":
+			LeaderLeaseDuration = ParseDurationEnv(chave, valor, LeaderLeaseDuration)
+		case "LEADER_REDIS_ADDR":
+			if valor != "" {
+				LeaderRedisAddr = valor
+			}
+		case "LEADER_REDIS_PASSWORD":
+			LeaderRedisPassword = valor
+		case "SLACK_SIGNING_SECRET":
+			SlackSigningSecret = valor
+		case "INTERACTION_RATE_LIMIT":
+			if n, err := strconv.Atoi(valor); err == nil && n >= 0 {
+				InteractionRateLimit = n
+			}
+		case "INTERACTION_PERMISSIONS":
+			InteractionPermissions = ParseServiceMap(valor)
+		case "HTTP_MAX_BODY_SIZE":
+			if n, err := strconv.ParseInt(valor, 10, 64); err == nil && n > 0 {
+				HTTPMaxBodySize = n
+			}
+		case "HTTP_READ_TIMEOUT":
+			HTTPReadTimeout = ParseDurationEnv(chave, valor, HTTPReadTimeout)
+		case "SERVICE_INDEX_INTERVAL":
+			ServiceIndexInterval = ParseDurationEnv(chave, valor, ServiceIndexInterval)
+		case "INTENT_PARSER":
+			IntentParserBackend = valor
+		case "INTENT_PARSER_URL":
+			IntentParserURL = valor
+		case "INTENT_PARSER_TOKEN":
+			IntentParserToken = valor
+		case "UPGRADE_PROGRESS_TIMEOUT":
+			UpgradeProgressTimeout = ParseDurationEnv(chave, valor, UpgradeProgressTimeout)
+		case "DRY_RUN_ENVIRONMENTS":
+			if valor != "" {
+				DryRunEnvironments = strings.Split(valor, ",")
+			}
+		case "SANDBOX_MODE":
+			SandboxMode = valor == "true"
+		case "SANDBOX_DIR":
+			SandboxDir = valor
+		case "TENANTS_FILE":
+			TenantsFile = valor
+		case "RBAC_ROLES":
+			RBACRoles = ParseServiceMap(valor)
+		case "FAVORITES_FILE":
+			FavoritesFile = valor
+		case "SNAPSHOTS_FILE":
+			SnapshotsFile = valor
+		case "SNAPSHOTS_KEEP":
+			if n, err := strconv.Atoi(valor); err == nil && n > 0 {
+				SnapshotsKeep = n
+			}
+		case "QUIET_HOURS":
+			QuietHours = ParseServiceMap(valor)
+		case "QUIET_HOURS_DIGEST":
+			QuietHoursDigest = valor != "false"
+		case "DEFAULT_LANGUAGE":
+			if _, ok := translations[valor]; ok {
+				DefaultLanguage = valor
+			}
+		case "USER_LANGUAGES_FILE":
+			UserLanguagesFile = valor
+		case "MESSAGES_TIMEZONE":
+			if loc, err := time.LoadLocation(valor); valor != "" && err == nil {
+				MessagesTimezone = loc
+			} else {
+				CheckErr("Erro ao carregar o MESSAGES_TIMEZONE", err)
+			}
+		case "SHORTHAND_PREFIX":
+			ShorthandPrefix = valor
+		case "ADMIN_API_TOKEN":
+			AdminAPIToken = valor
+		case "AUDIT_LOG_SIZE":
+			if n, err := strconv.Atoi(valor); err == nil && n > 0 {
+				AuditLogSize = n
+			}
+		case "GRPC_PORT":
+			GRPCPort = valor
+		case "GRPC_TLS_CERT":
+			GRPCTLSCert = valor
+		case "GRPC_TLS_KEY":
+			GRPCTLSKey = valor
+		case "GRPC_CLIENT_CA":
+			GRPCClientCA = valor
+		case "GRPC_ALLOWED_CLIENTS":
+			if valor != "" {
+				GRPCAllowedClients = strings.Split(valor, ",")
+			}
+		case "DIGEST_TIME":
+			DigestTime = valor
+		case "DIGEST_SECTIONS":
+			if valor != "" {
+				DigestSections = strings.Split(valor, ",")
+			}
+		case "WEEKLY_REPORT_TIME":
+			WeeklyReportTime = valor
+		case "WEEKLY_REPORT_DAY":
+			if day, ok := weekdays[strings.ToLower(valor)]; ok {
+				WeeklyReportDay = day
+			} else if valor != "" {
+				log.Printf("[ERROR] WEEKLY_REPORT_DAY inválido: %s\n", valor)
+			}
+		case "AUDIT_ADMINS":
+			if valor != "" {
+				AuditAdmins = strings.Split(valor, ",")
+			}
+		case "QUOTA_ADMINS":
+			if valor != "" {
+				QuotaAdmins = strings.Split(valor, ",")
+			}
+		case "IMAGE_GC_ADMINS":
+			if valor != "" {
+				ImageGCAdmins = strings.Split(valor, ",")
+			}
+		case "IMAGE_GC_IMAGE":
+			if valor != "" {
+				ImageGCHelperImage = valor
+			}
+		case "IMAGE_GC_TIMEOUT":
+			ImageGCTimeout = ParseDurationEnv(chave, valor, ImageGCTimeout)
+		case "STATS_DURATION":
+			StatsDuration = ParseDurationEnv(chave, valor, StatsDuration)
+		case "ROLLING_RESTART_BATCH":
+			if n, err := strconv.Atoi(valor); err == nil && n > 0 {
+				RollingRestartBatch = n
+			}
+		case "DRAIN_GRACE_PERIOD":
+			DrainGracePeriod = ParseDurationEnv(chave, valor, DrainGracePeriod)
+		case "HAPROXY_STATS_PORT":
+			if valor != "" {
+				HaproxyStatsPort = valor
+			}
+		case "HAPROXY_STATS_PATH":
+			if valor != "" {
+				HaproxyStatsPath = valor
+			}
+		case "HOOKS_FILE":
+			HooksFile = valor
+		case "UNDO_WINDOW":
+			UndoWindow = ParseDurationEnv(chave, valor, UndoWindow)
 		}
 
-		envs = append(envs, Env{Key: chave, Value: valor})
+		envs = append(envs, NewEnv(chave, valor))
 	}
 
 	t := time.Now()
@@ -122,12 +627,15 @@ func main() {
 
 	log.SetOutput(mw)
 
+	LoadRedactionRules()
+	LoadHooks()
+	LoadTenants()
+
 	log.Println("[INFO] Sincronizando comandos...")
 	CreateCommands()
 	log.Println("[INFO] Comandos sincronizados com sucesso!")
 
-	client := slack.New(
-		SlackBotToken,
+	client := CreateSlackClient(
 		slack.OptionDebug(true),
 		slack.OptionLog(log.New(mw, "SLfR: ", log.Lshortfile|log.LstdFlags)),
 	)
@@ -137,6 +645,7 @@ func main() {
 		botID:     SlackBotID,
 		channelID: SlackBotChannel,
 	}
+	slackAPI = slackListener
 
 	rancherListener := &RancherListener{
 		accessKey: RancherAccessKey,
@@ -145,19 +654,46 @@ func main() {
 		projectID: RancherProjectID,
 	}
 
+	SetupOrchestrator()
+	StartJobWorkers()
+
 	go slackListener.StartBot(rancherListener)
 
 	router := mux.NewRouter()
 
 	router.HandleFunc("/env", GetEnvs).Methods("GET")
 	router.HandleFunc("/commands", GetCommands).Methods("GET")
-	router.Handle("/interaction", interactionHandler{
-		verificationToken: SlackBotVerificationToken,
-	})
+	router.HandleFunc("/rancher/breakers", GetRancherBreakers).Methods("GET")
+	router.HandleFunc("/alertmanager", AlertmanagerWebhook).Methods("POST")
+	router.HandleFunc("/grafana", GrafanaWebhook).Methods("POST")
+	router.HandleFunc("/opsgenie", OpsgenieWebhook).Methods("POST")
+	router.HandleFunc("/registry", RegistryWebhook).Methods("POST")
+	router.HandleFunc("/harbor", HarborWebhook).Methods("POST")
+	router.HandleFunc("/hooks/{name}", HooksWebhook).Methods("POST")
+	router.HandleFunc("/slash", SlashCommand).Methods("POST")
+	router.HandleFunc("/options", OptionsLoad).Methods("POST")
+	router.HandleFunc("/interaction/metrics", GetInteractionMetrics).Methods("GET")
+	router.Handle("/interaction", newInteractionDispatcher(SlackBotVerificationToken)).Methods("POST")
+	RegisterAdminAPI(router)
+	StartGRPCServer()
+
+	server := NewServer(router)
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+		<-signals
+		Shutdown(server, fileOpen)
+		os.Exit(0)
+	}()
 
 	log.Printf("[INFO] Servidor rodando na porta: %s", Port)
-	if err := http.ListenAndServe(":"+Port, router); err != nil {
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Printf("[ERROR] %s", err)
 		os.Exit(1)
 	}
+
+	// Com o servidor fechado o processo espera o Shutdown terminar
+	select {}
 }
@@ -0,0 +1,135 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Maintenance é o modo de manutenção do BOT. Durante a manutenção as ações
+// que alteram o ambiente (maintenanceActions) são recusadas, as consultas
+// continuam funcionando
+type Maintenance struct {
+	Enabled bool      `json:"enabled"`
+	Reason  string    `json:"reason,omitempty"`
+	By      string    `json:"by,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+}
+
+// maintenanceActions são os comandos e ações (callback_id dos menus ou nome
+// dos botões) recusados durante a manutenção
+var maintenanceActions = []string{
+	restartContainer,
+	restartContainerDrain,
+	restartService,
+	rollingRestart,
+	upgradeService,
+	scaleService,
+	canaryUpdate,
+	canaryActivate,
+	canaryDisable,
+	actionServiceRestart,
+	actionContainerRestart,
+	actionAlertRestart,
+	actionRegistryUpgrade,
+	actionHostEvacuate,
+	actionCrashLoopStop,
+	actionTerraformApply,
+	actionBatchRun,
+	actionWizardConfirm,
+	actionUndo,
+	blueGreen,
+	actionBlueGreenSwitch,
+	actionBlueGreenSwitchBack,
+	actionBlueGreenCleanup,
+	actionBlueGreenCancel,
+	actionABApply,
+	actionABRemove,
+	actionImageGCApply,
+	actionComposeDeploy,
+	actionSnapshotRestore,
+	actionCloneApply,
+}
+
+var (
+	maintenance      Maintenance
+	maintenanceMutex sync.Mutex
+)
+
+// CurrentMaintenance retorna o estado do modo de manutenção
+func CurrentMaintenance() Maintenance {
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+
+	return maintenance
+}
+
+// SetMaintenance liga ou desliga o modo de manutenção, avisando no canal
+func SetMaintenance(enabled bool, reason string, by string) Maintenance {
+	maintenanceMutex.Lock()
+	changed := maintenance.Enabled != enabled
+	if enabled {
+		if changed {
+			maintenance.Since = time.Now()
+		}
+		maintenance = Maintenance{Enabled: true, Reason: reason, By: by, Since: maintenance.Since}
+	} else {
+		maintenance = Maintenance{}
+	}
+	current := maintenance
+	maintenanceMutex.Unlock()
+
+	if !changed {
+		return current
+	}
+
+	if enabled {
+		log.Printf("[INFO] Modo de manutenção ligado por %s: %s\n", by, reason)
+		msg := fmt.Sprintf(":construction: *Modo de manutenção* ligado por %s, as ações que alteram o ambiente estão bloqueadas", by)
+		if reason != "" {
+			msg += fmt.Sprintf("\n*Motivo:* %s", reason)
+		}
+		sendMessage(msg)
+	} else {
+		log.Printf("[INFO] Modo de manutenção desligado por %s\n", by)
+		sendMessage(fmt.Sprintf(":white_check_mark: *Modo de manutenção* desligado por %s", by))
+	}
+
+	return current
+}
+
+// MaintenanceBlocks informa se a ação está bloqueada pelo modo de manutenção
+func MaintenanceBlocks(action string) bool {
+	return CurrentMaintenance().Enabled && containsString(maintenanceActions, action)
+}
+
+// maintenanceMessage é a resposta das ações recusadas na manutenção
+func maintenanceMessage(action string) string {
+	current := CurrentMaintenance()
+
+	msg := fmt.Sprintf(":construction: `%s` bloqueado: o BOT está em modo de manutenção desde %s (por %s)", action, slackDate(current.Since), current.By)
+	if current.Reason != "" {
+		msg += fmt.Sprintf("\n*Motivo:* %s", current.Reason)
+	}
+
+	return msg
+}
+
+// MaintenanceMiddleware recusa as ações que alteram o ambiente durante o modo
+// de manutenção
+func MaintenanceMiddleware(next InteractionHandler) InteractionHandler {
+	return func(w http.ResponseWriter, in *Interaction) {
+		if !MaintenanceBlocks(in.Key()) {
+			next(w, in)
+			return
+		}
+
+		log.Printf("[INFO] Ação %s de %s recusada pelo modo de manutenção\n", in.Key(), in.Message.User.Name)
+		refuseInteraction(w, in, http.StatusLocked, maintenanceMessage(in.Key()))
+	}
+}
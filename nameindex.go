@@ -0,0 +1,263 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// ServiceIndexInterval é o intervalo de atualização do índice de nomes dos serviços
+var ServiceIndexInterval = time.Minute
+
+// ServiceIndex é o índice de nome para ID dos serviços, para os comandos
+// aceitarem o nome do serviço no lugar do ID
+type ServiceIndex struct {
+	mutex    sync.RWMutex
+	services []Workload
+}
+
+var serviceIndex = &ServiceIndex{}
+
+// RefreshServiceIndex atualiza o índice a cada ServiceIndexInterval
+func RefreshServiceIndex() {
+	for {
+		serviceIndex.Refresh()
+
+		select {
+		case <-botContext.Done():
+			return
+		case <-time.After(ServiceIndexInterval):
+		}
+	}
+}
+
+// Refresh busca os serviços no orquestrador. Em caso de erro mantém o índice
+// anterior
+func (idx *ServiceIndex) Refresh() {
+	services, err := orchestrator.ListServices()
+	if err != nil {
+		CheckErr("Erro ao atualizar o índice de serviços", err)
+		return
+	}
+
+	idx.mutex.Lock()
+	idx.services = services
+	idx.mutex.Unlock()
+}
+
+// Services retorna os serviços do índice
+func (idx *ServiceIndex) Services() []Workload {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	return idx.services
+}
+
+// Name retorna o nome do serviço com o ID, ou o próprio ID quando ele não
+// está no índice (ex.: serviço removido)
+func (idx *ServiceIndex) Name(ID string) string {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	for _, service := range idx.services {
+		if service.ID == ID {
+			return service.Name
+		}
+	}
+
+	return ID
+}
+
+// Resolve converte o nome (ou ID) do serviço informado pelo usuário para o ID,
+// tentando nessa ordem: ID, nome exato, nome sem diferenciar maiúsculas,
+// parte do nome e nome parecido (erros de digitação). Com o índice ainda vazio
+// o valor é usado como ID
+func (idx *ServiceIndex) Resolve(name string) (string, error) {
+	idx.mutex.RLock()
+	services := idx.services
+	idx.mutex.RUnlock()
+
+	if len(services) == 0 {
+		return name, nil
+	}
+
+	matchers := []func(Workload) bool{
+		func(w Workload) bool { return w.ID == name },
+		func(w Workload) bool { return w.Name == name },
+		func(w Workload) bool { return strings.EqualFold(w.Name, name) },
+		func(w Workload) bool { return strings.Contains(strings.ToLower(w.Name), strings.ToLower(name)) },
+	}
+
+	for _, match := range matchers {
+		var found []Workload
+		for _, service := range services {
+			if match(service) {
+				found = append(found, service)
+			}
+		}
+
+		if len(found) == 1 {
+			return found[0].ID, nil
+		}
+
+		if len(found) > 1 {
+			return "", fmt.Errorf("mais de um serviço com o nome `%s`: %s", name, describeServices(found))
+		}
+	}
+
+	return "", idx.suggest(services, name)
+}
+
+// Match retorna o serviço com o nome (sem diferenciar maiúsculas) ou, para
+// nomes maiores, com no máximo uma letra de diferença. Só aceita quando um
+// único serviço combina
+func (idx *ServiceIndex) Match(name string) (Workload, bool) {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	var found []Workload
+	for _, service := range idx.services {
+		if strings.EqualFold(service.Name, name) || len(name) >= 5 && levenshtein(strings.ToLower(service.Name), strings.ToLower(name)) <= 1 {
+			found = append(found, service)
+		}
+	}
+
+	if len(found) != 1 {
+		return Workload{}, false
+	}
+
+	return found[0], true
+}
+
+// suggest retorna o erro de serviço não encontrado com os nomes mais
+// parecidos. Caso só um seja próximo o bastante, ele é sugerido sozinho
+func (idx *ServiceIndex) suggest(services []Workload, name string) error {
+	type candidate struct {
+		service  Workload
+		distance int
+	}
+
+	var candidates []candidate
+	for _, service := range services {
+		distance := levenshtein(strings.ToLower(service.Name), strings.ToLower(name))
+		if distance <= maxTypos(name) {
+			candidates = append(candidates, candidate{service, distance})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return fmt.Errorf("serviço `%s` não encontrado", name)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	var similar []Workload
+	for i, c := range candidates {
+		if i == 3 {
+			break
+		}
+		similar = append(similar, c.service)
+	}
+
+	return fmt.Errorf("serviço `%s` não encontrado, você quis dizer %s?", name, describeServices(similar))
+}
+
+// maxTypos é a diferença máxima entre os nomes para serem sugeridos
+func maxTypos(name string) int {
+	if len(name) < 8 {
+		return 2
+	}
+
+	return len(name) / 4
+}
+
+func describeServices(services []Workload) string {
+	var names []string
+	for _, service := range services {
+		names = append(names, fmt.Sprintf("`%s` (%s)", service.Name, service.ID))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// levenshtein retorna a quantidade de letras que precisam ser inseridas,
+// removidas ou trocadas para que a fique igual a b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	previous := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current := make([]int, len(rb)+1)
+		current[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous = current
+	}
+
+	return previous[len(rb)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+
+	return min
+}
+
+// resolveServiceArg converte o nome do serviço do comando para o ID,
+// avisando no canal caso não seja encontrado
+func (s *SlackListener) resolveServiceArg(channel string, name string) (string, bool) {
+	serviceID, err := serviceIndex.Resolve(name)
+	if err != nil {
+		log.Printf("[INFO] Serviço %s não resolvido: %s\n", name, err)
+		s.client.PostMessage(channel, slack.MsgOptionText(":mag: "+err.Error(), false))
+		return "", false
+	}
+
+	// Nos canais dos times só os serviços das stacks do time
+	if tenant := TenantForChannel(channel); tenant != nil && !tenant.AllowsTarget(serviceID) {
+		log.Printf("[INFO] Serviço %s fora das stacks do time %s\n", name, tenant.Name)
+		s.client.PostMessage(channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: `%s` não é de uma stack do time `%s`", name, tenant.Name), false))
+		return "", false
+	}
+
+	return serviceID, true
+}
+
+// allowTargetArg verifica se o ID do container ou LB passado direto no
+// comando é de uma stack do time do canal, avisando no canal caso não seja
+func (s *SlackListener) allowTargetArg(channel string, ID string) bool {
+	if tenant := TenantForChannel(channel); tenant != nil && !tenant.AllowsTarget(ID) {
+		log.Printf("[INFO] Alvo %s fora das stacks do time %s\n", ID, tenant.Name)
+		s.client.PostMessage(channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: `%s` não é de uma stack do time `%s`", ID, tenant.Name), false))
+		return false
+	}
+
+	return true
+}
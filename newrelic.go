@@ -0,0 +1,62 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+)
+
+var (
+	// NewRelicAPIKey é a User API key usada para criar os deployment markers
+	NewRelicAPIKey string
+
+	// NewRelicRegion é a região da conta (us ou eu)
+	NewRelicRegion = "us"
+
+	// NewRelicApps é o mapeamento do ID do serviço para o ID da aplicação no APM
+	NewRelicApps = map[string]string{}
+)
+
+// NewRelicEnabled retorna se a integração com o New Relic está configurada
+func NewRelicEnabled() bool {
+	return NewRelicAPIKey != "" && len(NewRelicApps) > 0
+}
+
+func newRelicURL(path string) string {
+	if NewRelicRegion == "eu" {
+		return "https://api.eu.newrelic.com" + path
+	}
+
+	return "https://api.newrelic.com" + path
+}
+
+// SendNewRelicDeployment cria um deployment marker na aplicação do serviço,
+// para os gráficos do APM mostrarem quando a alteração aconteceu. Serviços
+// sem aplicação mapeada são ignorados
+func SendNewRelicDeployment(change ChangeEvent) error {
+	appID, ok := NewRelicApps[change.ServiceID]
+	if !ok {
+		return nil
+	}
+
+	// A revisão é a imagem no upgrade; no restart e no rollback fica o tipo da alteração
+	revision := change.Image
+	if revision == "" {
+		revision = change.Kind
+	}
+
+	deployment := map[string]interface{}{
+		"deployment": map[string]string{
+			"revision":    revision,
+			"description": change.Description(),
+			"user":        change.User,
+		},
+	}
+
+	_, err := HTTPSendJSONRequest(PostHTTP, newRelicURL(fmt.Sprintf("/v2/applications/%s/deployments.json", appID)), map[string]string{
+		"X-Api-Key": NewRelicAPIKey,
+	}, deployment)
+
+	return err
+}
@@ -0,0 +1,212 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	pagerDutyAPIURL = "https://api.pagerduty.com"
+
+	// oncallCacheTTL é o tempo que o plantão consultado fica em cache, para
+	// não consultar a API a cada alerta
+	oncallCacheTTL = 5 * time.Minute
+)
+
+var (
+	// OncallProvider é a ferramenta onde estão as escalas de plantão (pagerduty ou opsgenie)
+	OncallProvider = "pagerduty"
+
+	// OncallSchedules é o mapeamento do nome da rotação para o ID da escala no
+	// PagerDuty ou o nome da escala no Opsgenie
+	OncallSchedules = map[string]string{}
+
+	// OncallDefaultRotation é a rotação usada no comando sem argumentos e
+	// mencionada nos alertas críticos
+	OncallDefaultRotation string
+
+	// PagerDutyAPIKey é a API key (REST) do PagerDuty, usada para consultar as escalas
+	PagerDutyAPIKey string
+)
+
+// OncallPerson é uma pessoa de plantão
+type OncallPerson struct {
+	Name  string
+	Email string
+}
+
+type oncallCacheEntry struct {
+	people  []OncallPerson
+	expires time.Time
+}
+
+var (
+	oncallCache      = map[string]oncallCacheEntry{}
+	oncallCacheMutex sync.Mutex
+)
+
+// pagerDutyOncall retorna quem está de plantão na escala do PagerDuty
+func pagerDutyOncall(scheduleID string) ([]OncallPerson, error) {
+	query := url.Values{}
+	query.Set("schedule_ids[]", scheduleID)
+	query.Set("include[]", "users")
+	query.Set("earliest", "true")
+
+	resp, err := HTTPSendJSONRequest(GetHTTP, pagerDutyAPIURL+"/oncalls?"+query.Encode(), map[string]string{
+		"Authorization": "Token token=" + PagerDutyAPIKey,
+		"Accept":        "application/vnd.pagerduty+json;version=2",
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var people []OncallPerson
+	for _, oncall := range gjson.Get(resp, "oncalls").Array() {
+		people = append(people, OncallPerson{
+			Name:  oncall.Get("user.name").String(),
+			Email: oncall.Get("user.email").String(),
+		})
+	}
+
+	return people, nil
+}
+
+// opsgenieOncall retorna quem está de plantão na escala do Opsgenie
+func opsgenieOncall(schedule string) ([]OncallPerson, error) {
+	path := fmt.Sprintf("%s/v2/schedules/%s/on-calls?scheduleIdentifierType=name&flat=true", OpsgenieAPIURL, url.PathEscape(schedule))
+
+	resp, err := HTTPSendJSONRequest(GetHTTP, path, opsgenieHeaders(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var people []OncallPerson
+	for _, email := range gjson.Get(resp, "data.onCallRecipients").Array() {
+		people = append(people, OncallPerson{Name: email.String(), Email: email.String()})
+	}
+
+	return people, nil
+}
+
+// GetOncall retorna quem está de plantão na rotação
+func GetOncall(rotation string) ([]OncallPerson, error) {
+	schedule, ok := OncallSchedules[rotation]
+	if !ok {
+		return nil, fmt.Errorf("rotação %s não configurada", rotation)
+	}
+
+	oncallCacheMutex.Lock()
+	entry, cached := oncallCache[rotation]
+	oncallCacheMutex.Unlock()
+
+	if cached && time.Now().Before(entry.expires) {
+		return entry.people, nil
+	}
+
+	var people []OncallPerson
+	var err error
+
+	if OncallProvider == "opsgenie" {
+		people, err = opsgenieOncall(schedule)
+	} else {
+		people, err = pagerDutyOncall(schedule)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	oncallCacheMutex.Lock()
+	oncallCache[rotation] = oncallCacheEntry{people: people, expires: time.Now().Add(oncallCacheTTL)}
+	oncallCacheMutex.Unlock()
+
+	return people, nil
+}
+
+// slackMention retorna a menção do usuário no Slack pelo e-mail, ou o nome
+// caso o e-mail não seja de um usuário do workspace
+func slackMention(person OncallPerson) string {
+	if person.Email != "" {
+		if user, err := getAPIConnection().client.GetUserByEmail(person.Email); err == nil {
+			return fmt.Sprintf("<@%s>", user.ID)
+		}
+	}
+
+	return person.Name
+}
+
+// OncallMention retorna as menções de quem está de plantão na rotação
+// padrão, usado nos alertas críticos. Retorna vazio caso não configurado
+func OncallMention() string {
+	if OncallDefaultRotation == "" {
+		return ""
+	}
+
+	people, err := GetOncall(OncallDefaultRotation)
+	if err != nil {
+		CheckErr("Erro ao buscar o plantão", err)
+		return ""
+	}
+
+	var mentions []string
+	for _, person := range people {
+		mentions = append(mentions, slackMention(person))
+	}
+
+	return strings.Join(mentions, " ")
+}
+
+// withOncallMention adiciona a menção do plantão na mensagem, caso configurado
+func withOncallMention(options ...slack.MsgOption) []slack.MsgOption {
+	if mention := OncallMention(); mention != "" {
+		options = append(options, slack.MsgOptionText(fmt.Sprintf(":pager: %s", mention), false))
+	}
+
+	return options
+}
+
+func (s *SlackListener) slackOncall(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	rotation := OncallDefaultRotation
+	if len(args) > 2 && args[2] != "" {
+		rotation = args[2]
+	}
+
+	if rotation == "" {
+		var rotations []string
+		for name := range OncallSchedules {
+			rotations = append(rotations, fmt.Sprintf("`%s`", name))
+		}
+
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Informe a rotação: @nome-do-bot %s rotação\nRotações configuradas: %s", oncall, strings.Join(rotations, ", ")), false))
+		return
+	}
+
+	people, err := GetOncall(rotation)
+	if err != nil {
+		CheckErr("Erro ao buscar o plantão", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao buscar o plantão: %s", err), false))
+		return
+	}
+
+	if len(people) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Ninguém de plantão na rotação `%s` agora :scream:", rotation), false))
+		return
+	}
+
+	var names []string
+	for _, person := range people {
+		names = append(names, fmt.Sprintf("• %s", slackMention(person)))
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":pager: *De plantão na rotação `%s`:*\n%s", rotation, strings.Join(names, "\n")), false))
+}
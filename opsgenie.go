@@ -0,0 +1,213 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	opsgenieCallback = "opsgenie"
+
+	actionOpsgenieAck   = "og-ack"
+	actionOpsgenieClose = "og-close"
+)
+
+var (
+	// OpsgenieAPIKey é a chave da integração de API do Opsgenie
+	OpsgenieAPIKey string
+
+	// OpsgenieAPIURL é a URL da API do Opsgenie (https://api.eu.opsgenie.com para contas na Europa)
+	OpsgenieAPIURL = "https://api.opsgenie.com"
+
+	// OpsgenieToken é o token que o Opsgenie deve enviar no webhook
+	OpsgenieToken string
+)
+
+func opsgenieHeaders() map[string]string {
+	return map[string]string{"Authorization": "GenieKey " + OpsgenieAPIKey}
+}
+
+// CreateOpsgenieAlert cria um alerta no Opsgenie, retornando o ID da requisição
+func CreateOpsgenieAlert(message string, priority string, user string) (string, error) {
+	resp, err := HTTPSendJSONRequest(PostHTTP, OpsgenieAPIURL+"/v2/alerts", opsgenieHeaders(), map[string]interface{}{
+		"message":  message,
+		"priority": priority,
+		"source":   "slack-bot",
+		"user":     user,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return gjson.Get(resp, "requestId").String(), nil
+}
+
+// UpdateOpsgenieAlert executa uma ação (acknowledge ou close) em um alerta do
+// Opsgenie. O identificador pode ser o ID do alerta ou o tinyId (ex.: 42)
+func UpdateOpsgenieAlert(identifier string, action string, user string) error {
+	identifierType := "id"
+	if isTinyID(identifier) {
+		identifierType = "tiny"
+	}
+
+	url := fmt.Sprintf("%s/v2/alerts/%s/%s?identifierType=%s", OpsgenieAPIURL, identifier, action, identifierType)
+
+	_, err := HTTPSendJSONRequest(PostHTTP, url, opsgenieHeaders(), map[string]interface{}{
+		"user":   user,
+		"source": "slack-bot",
+	})
+
+	return err
+}
+
+func isTinyID(identifier string) bool {
+	for _, c := range identifier {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return identifier != ""
+}
+
+// OpsgenieWebhook é o end-point que recebe os webhooks do Opsgenie e espelha
+// os alertas no canal do BOT
+func OpsgenieWebhook(w http.ResponseWriter, r *http.Request) {
+	if !ValidWebhookToken(r, OpsgenieToken) {
+		log.Println("[ERROR] Token inválido no webhook do Opsgenie")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil || !gjson.Valid(string(buf)) {
+		log.Printf("[ERROR] Erro ao ler o webhook do Opsgenie: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body := string(buf)
+	action := gjson.Get(body, "action").String()
+	alert := gjson.Get(body, "alert")
+
+	attachment := opsgenieAttachment(
+		alert.Get("alertId").String(),
+		alert.Get("tinyId").String(),
+		alert.Get("message").String(),
+		alert.Get("priority").String(),
+	)
+
+	switch action {
+	case "Create":
+		RecordDigestAlert("Opsgenie", alert.Get("message").String())
+	case "Acknowledge":
+		attachment.Color = "#FFA500"
+		attachment.Actions = attachment.Actions[1:]
+		attachment.Fields = []slack.AttachmentField{{Title: fmt.Sprintf(":eyes: Reconhecido por %s", alert.Get("username").String())}}
+	case "Close":
+		attachment.Color = "#36A64F"
+		attachment.Actions = nil
+		attachment.Fields = []slack.AttachmentField{{Title: fmt.Sprintf(":white_check_mark: Fechado por %s", alert.Get("username").String())}}
+	default:
+		// As demais ações (notas, tags, etc.) não são enviadas para o canal
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	api := getAPIConnection()
+	api.client.PostMessage(api.channelID, slack.MsgOptionAttachments(attachment))
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// opsgenieAttachment monta a mensagem do alerta com os botões de reconhecer e fechar
+func opsgenieAttachment(alertID string, tinyID string, message string, priority string) slack.Attachment {
+	color := "#0C648A"
+	switch priority {
+	case "P1", "P2":
+		color = "#D50200"
+	case "P3":
+		color = "#FFA500"
+	}
+
+	return slack.Attachment{
+		Title:      fmt.Sprintf(":bell: [%s] Alerta #%s no Opsgenie", priority, tinyID),
+		Text:       message,
+		Color:      color,
+		CallbackID: opsgenieCallback,
+		Actions: append([]slack.AttachmentAction{
+			{Name: actionOpsgenieAck, Text: "Reconhecer", Type: "button", Style: "primary", Value: alertID},
+			{Name: actionOpsgenieClose, Text: "Fechar", Type: "button", Value: alertID},
+		}, alertActions("")...),
+	}
+}
+
+func (s *SlackListener) slackOpsgenieCreate(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) < 4 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s P1..P5 mensagem do alerta", opsgenieCreate), false))
+		return
+	}
+
+	priority := strings.ToUpper(args[2])
+	if len(priority) != 2 || priority[0] != 'P' || priority[1] < '1' || priority[1] > '5' {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText("Prioridade inválida, use de `P1` a `P5`", false))
+		return
+	}
+
+	message := strings.Join(args[3:], " ")
+
+	if _, err := CreateOpsgenieAlert(message, priority, ev.Msg.User); err != nil {
+		CheckErr("Erro ao criar alerta no Opsgenie", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao criar o alerta no Opsgenie: %s", err), false))
+		return
+	}
+
+	log.Printf("[INFO] Alerta criado no Opsgenie pelo usuário %s\n", ev.Msg.User)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Alerta `%s` criado no Opsgenie :bell:", message), false))
+}
+
+func (s *SlackListener) slackOpsgenieUpdate(ev *slack.MessageEvent, action string) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) != 3 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s id-alerta", args[1]), false))
+		return
+	}
+
+	if err := UpdateOpsgenieAlert(strings.TrimPrefix(args[2], "#"), action, ev.Msg.User); err != nil {
+		CheckErr("Erro ao atualizar alerta no Opsgenie", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao atualizar o alerta no Opsgenie: %s", err), false))
+		return
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Alerta `%s` atualizado no Opsgenie (%s) :white_check_mark:", args[2], action), false))
+}
+
+func actionOpsgenieFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	action := "acknowledge"
+	title := fmt.Sprintf(":eyes: Reconhecido no Opsgenie por @%s", message.User.Name)
+
+	if message.Actions[0].Name == actionOpsgenieClose {
+		action = "close"
+		title = fmt.Sprintf(":white_check_mark: Fechado no Opsgenie por @%s", message.User.Name)
+	}
+
+	if err := UpdateOpsgenieAlert(message.Actions[0].Value, action, message.User.Name); err != nil {
+		CheckErr("Erro ao atualizar alerta no Opsgenie", err)
+		respondWithoutActions(w, message.OriginalMessage, ":x: Erro ao atualizar o alerta no Opsgenie", err.Error())
+		return
+	}
+
+	respondWithoutActions(w, message.OriginalMessage, title, "")
+}
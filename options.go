@@ -0,0 +1,206 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	// optionsStaticLimit é a quantidade máxima de opções de um menu no Slack.
+	// Menus maiores buscam as opções enquanto o usuário digita
+	optionsStaticLimit = 100
+
+	optionsKindService      = "service"
+	optionsKindContainer    = "container"
+	optionsKindLoadBalancer = "lb"
+)
+
+// optionsKinds é o tipo de recurso de cada menu do BOT (callback_id)
+var optionsKinds = map[string]string{
+	restartContainer:      optionsKindContainer,
+	restartContainerDrain: optionsKindContainer,
+	logsContainer:         optionsKindContainer,
+	streamLogs:            optionsKindContainer,
+	canaryActivate:        optionsKindLoadBalancer,
+	canaryDisable:         optionsKindLoadBalancer,
+	canaryInfo:            optionsKindLoadBalancer,
+}
+
+// optionsRequest é o pedido de opções do Slack para menus com data_source
+// external (mensagens e dialogs) e para os selects external do Block Kit
+type optionsRequest struct {
+	Type       string `json:"type"`
+	Token      string `json:"token"`
+	Name       string `json:"name"`
+	Value      string `json:"value"`
+	CallbackID string `json:"callback_id"`
+	ActionID   string `json:"action_id"`
+	User       struct {
+		ID string `json:"id"`
+	} `json:"user"`
+}
+
+// kind retorna o tipo de recurso do menu pelo callback_id ou, nos dialogs e
+// blocks, pelo nome do campo (ex.: "container", "service-id")
+func (req optionsRequest) kind() string {
+	if kind, ok := optionsKinds[req.CallbackID]; ok {
+		return kind
+	}
+
+	field := strings.ToLower(req.Name + " " + req.ActionID)
+	switch {
+	case strings.Contains(field, "container"):
+		return optionsKindContainer
+	case strings.Contains(field, "lb") || strings.Contains(field, "loadbalancer"):
+		return optionsKindLoadBalancer
+	default:
+		return optionsKindService
+	}
+}
+
+// ResourceOptions retorna as opções do tipo de recurso que combinam com o que
+// o usuário digitou, as mais parecidas primeiro. Usa os dados em cache
+// (índice de serviços e cache do Rancher), sem chamadas extras na API
+func ResourceOptions(kind string, query string) []slack.AttachmentActionOption {
+	type option struct {
+		slack.AttachmentActionOption
+		score int
+	}
+
+	var options []option
+	add := func(id, name string) {
+		score := 0
+		if query != "" {
+			var ok bool
+			if score, ok = fuzzyScore(name, query); !ok && !strings.HasPrefix(id, query) {
+				return
+			}
+		}
+
+		options = append(options, option{slack.AttachmentActionOption{Text: fmt.Sprintf("%s | %s", id, name), Value: id}, score})
+	}
+
+	switch kind {
+	case optionsKindContainer:
+		containers, err := rancherListener.ListContainers()
+		CheckErr("Erro ao listar os containers para o autocomplete", err)
+		for _, container := range containers {
+			add(container.ID, container.Name)
+		}
+	case optionsKindLoadBalancer:
+		for _, lb := range rancherListener.GetLoadBalancers() {
+			add(lb.ID, lb.Name)
+		}
+	default:
+		for _, service := range serviceIndex.Services() {
+			add(service.ID, service.Name)
+		}
+	}
+
+	sort.SliceStable(options, func(i, j int) bool {
+		if options[i].score != options[j].score {
+			return options[i].score < options[j].score
+		}
+		return options[i].Text < options[j].Text
+	})
+
+	if len(options) > optionsStaticLimit {
+		options = options[:optionsStaticLimit]
+	}
+
+	result := []slack.AttachmentActionOption{}
+	for _, o := range options {
+		result = append(result, o.AttachmentActionOption)
+	}
+
+	return result
+}
+
+// OptionsLoad é a rota configurada como "Options Load URL" no app do Slack,
+// que responde as opções dos menus enquanto o usuário digita
+func OptionsLoad(w http.ResponseWriter, r *http.Request) {
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	form, err := url.ParseQuery(string(buf))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var req optionsRequest
+	if err := json.Unmarshal([]byte(form.Get("payload")), &req); err != nil {
+		log.Printf("[ERROR] Pedido de opções inválido: %s", form.Get("payload"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	valid := req.Token == SlackBotVerificationToken
+	if SlackSigningSecret != "" {
+		valid = validSlackSignature(r, buf)
+	}
+
+	if !valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	options := ResourceOptions(req.kind(), strings.TrimSpace(req.Value))
+	if req.kind() == optionsKindService {
+		options = favoritesFirst(req.User.ID, options)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// O Block Kit usa objetos de texto nas opções
+	if req.Type == "block_suggestion" {
+		type blockText struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		type blockOption struct {
+			Text  blockText `json:"text"`
+			Value string    `json:"value"`
+		}
+
+		blocks := []blockOption{}
+		for _, o := range options {
+			blocks = append(blocks, blockOption{Text: blockText{Type: "plain_text", Text: truncate(o.Text, 75)}, Value: o.Value})
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"options": blocks})
+		return
+	}
+
+	type dialogOption struct {
+		Label string `json:"label,omitempty"`
+		Text  string `json:"text,omitempty"`
+		Value string `json:"value"`
+	}
+
+	// Dialogs usam label e mensagens usam text
+	result := []dialogOption{}
+	for _, o := range options {
+		if req.Type == "dialog_suggestion" {
+			result = append(result, dialogOption{Label: o.Text, Value: o.Value})
+		} else {
+			result = append(result, dialogOption{Text: o.Text, Value: o.Value})
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"options": result})
+}
@@ -0,0 +1,215 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// Workload é um serviço do orquestrador (serviço do Rancher, Deployment do
+// Kubernetes, etc.)
+type Workload struct {
+	ID       string
+	Name     string
+	Image    string
+	State    string
+	Replicas int
+	Ready    int
+	Created  string
+}
+
+// Orchestrator é a interface dos orquestradores suportados pelos comandos de
+// serviço (info, lista, restart, scale e logs)
+type Orchestrator interface {
+	Name() string
+	ListServices() ([]Workload, error)
+	GetService(ID string) (*Workload, error)
+	RestartService(ID string) error
+	ScaleService(ID string, replicas int) error
+
+	// ServiceLogs junta os logs de todas as instâncias do serviço,
+	// retornando o conteúdo e a quantidade de instâncias
+	ServiceLogs(ID string, opts LogsOptions) ([]byte, int, error)
+}
+
+var (
+	// OrchestratorBackend é o orquestrador usado pelos comandos de serviço
+	OrchestratorBackend = "rancher"
+
+	// OrchestratorEnvironments é o mapeamento de ambiente para orquestrador
+	// (ex.: production:ecs,staging:kubernetes), trocado com o comando environment
+	OrchestratorEnvironments = map[string]string{}
+)
+
+// defaultEnvironment é o nome do ambiente do orquestrador configurado em ORCHESTRATOR
+const defaultEnvironment = "default"
+
+var (
+	orchestrator            Orchestrator
+	orchestrators           = map[string]Orchestrator{}
+	orchestratorEnvironment = defaultEnvironment
+)
+
+// NewOrchestrator cria o orquestrador configurado
+func NewOrchestrator(backend string) (Orchestrator, error) {
+	switch backend {
+	case "", "rancher":
+		return rancherOrchestrator{}, nil
+	case "kubernetes":
+		return newKubernetesOrchestrator()
+	case "swarm":
+		return newSwarmOrchestrator()
+	case "ecs":
+		return newECSOrchestrator()
+	}
+
+	return nil, fmt.Errorf("orquestrador %s não suportado", backend)
+}
+
+// SetupOrchestrator inicia o orquestrador configurado, voltando para o Rancher em caso de erro
+func SetupOrchestrator() {
+	var err error
+
+	orchestrator, err = NewOrchestrator(OrchestratorBackend)
+	if err != nil {
+		log.Printf("[ERROR] Erro ao iniciar o orquestrador %s, usando o Rancher: %s", OrchestratorBackend, err)
+		orchestrator = rancherOrchestrator{}
+	}
+
+	orchestrators[defaultEnvironment] = orchestrator
+	log.Printf("[INFO] Orquestrador: %s\n", orchestrator.Name())
+
+	for name, backend := range OrchestratorEnvironments {
+		o, err := NewOrchestrator(backend)
+		if err != nil {
+			log.Printf("[ERROR] Erro ao iniciar o orquestrador %s do ambiente %s: %s", backend, name, err)
+			continue
+		}
+
+		orchestrators[name] = o
+		log.Printf("[INFO] Orquestrador do ambiente %s: %s\n", name, o.Name())
+	}
+}
+
+// SetOrchestratorEnvironment troca o orquestrador usado pelos comandos de serviço
+func SetOrchestratorEnvironment(name string) error {
+	o, ok := orchestrators[name]
+	if !ok {
+		return fmt.Errorf("ambiente %s não configurado", name)
+	}
+
+	orchestrator = o
+	orchestratorEnvironment = name
+	log.Printf("[INFO] Ambiente alterado para %s (%s)\n", name, o.Name())
+
+	return nil
+}
+
+// slackEnvironment lista os ambientes configurados ou troca o ambiente atual
+func (s *SlackListener) slackEnvironment(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) > 2 && args[2] != "" {
+		if tenant := TenantForChannel(ev.Channel); tenant != nil && !tenant.AllowsEnvironment(args[2]) {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: O ambiente `%s` não é do time `%s`", args[2], tenant.Name), false))
+			return
+		}
+
+		if err := SetOrchestratorEnvironment(args[2]); err != nil {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao trocar o ambiente: %s", err), false))
+			return
+		}
+
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Ambiente alterado para `%s` (%s) :white_check_mark:", args[2], orchestrator.Name()), false))
+		return
+	}
+
+	var environments []string
+	for name, o := range orchestrators {
+		line := fmt.Sprintf("`%s`: %s", name, o.Name())
+		if name == orchestratorEnvironment {
+			line += " (atual)"
+		}
+
+		environments = append(environments, line)
+	}
+	sort.Strings(environments)
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Ambientes configurados:\n%s\nPara trocar: @nome-do-bot %s ambiente", strings.Join(environments, "\n"), environment), false))
+}
+
+// rancherOrchestrator é a implementação do Orchestrator para o Rancher 1.6
+type rancherOrchestrator struct{}
+
+func (rancherOrchestrator) Name() string {
+	return "rancher"
+}
+
+func rancherWorkload(service Service) Workload {
+	return Workload{
+		ID:       service.ID,
+		Name:     service.Name,
+		Image:    service.LaunchConfig.ImageUUID,
+		State:    service.State,
+		Replicas: service.Scale,
+		Ready:    service.CurrentScale,
+		Created:  service.Created,
+	}
+}
+
+func (rancherOrchestrator) ListServices() ([]Workload, error) {
+	data, err := rancherListener.ListServices()
+	if err != nil {
+		return nil, rancherFailure(cacheServices, err)
+	}
+
+	var services []Workload
+	for _, service := range data {
+		services = append(services, rancherWorkload(service))
+	}
+
+	return services, nil
+}
+
+func (rancherOrchestrator) GetService(ID string) (*Workload, error) {
+	service, err := rancherListener.GetService(ID)
+	if err != nil {
+		return nil, rancherFailure(cacheServices, fmt.Errorf("serviço %s não encontrado: %s", ID, err))
+	}
+
+	workload := rancherWorkload(*service)
+
+	return &workload, nil
+}
+
+func (rancherOrchestrator) RestartService(ID string) error {
+	if err := rancherListener.RestartService(ID); err != nil {
+		return rancherFailure(cacheServices, fmt.Errorf("erro ao reiniciar o serviço %s: %w", ID, err))
+	}
+
+	return nil
+}
+
+func (rancherOrchestrator) ScaleService(ID string, replicas int) error {
+	if rancherListener.ScaleService(ID, replicas) == "" {
+		return rancherFailure(cacheServices, fmt.Errorf("erro ao alterar a escala do serviço %s", ID))
+	}
+
+	return nil
+}
+
+func (rancherOrchestrator) ServiceLogs(ID string, opts LogsOptions) ([]byte, int, error) {
+	return collectServiceLogs(ID, opts)
+}
+
+// formatReplicas formata as réplicas prontas e desejadas (ex.: 2/3)
+func formatReplicas(w *Workload) string {
+	return strconv.Itoa(w.Ready) + "/" + strconv.Itoa(w.Replicas)
+}
@@ -0,0 +1,230 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	pagerDutyCallback  = "pagerduty"
+
+	actionPagerDutyAck     = "pd-ack"
+	actionPagerDutyResolve = "pd-resolve"
+)
+
+var (
+	// PagerDutyRoutingKeys é o mapeamento do ID do serviço no Rancher para a
+	// routing key da integração (Events API v2) no PagerDuty
+	PagerDutyRoutingKeys = map[string]string{}
+
+	// PagerDutyDefaultRoutingKey é a routing key usada quando o serviço não
+	// está no mapeamento
+	PagerDutyDefaultRoutingKey string
+
+	// PagerDutyAutoPage define se o BOT abre incidentes sozinho quando detecta
+	// problemas críticos (upgrades com erro, containers em crash loop)
+	PagerDutyAutoPage bool
+)
+
+// pagerDutyIncidents guarda a routing key usada em cada incidente aberto pelo
+// BOT, já que ela é necessária para reconhecer e resolver
+var (
+	pagerDutyIncidents      = map[string]string{}
+	pagerDutyIncidentsMutex sync.Mutex
+)
+
+// PagerDutyEnabled retorna se existe alguma routing key configurada
+func PagerDutyEnabled() bool {
+	return PagerDutyDefaultRoutingKey != "" || len(PagerDutyRoutingKeys) > 0
+}
+
+func pagerDutyRoutingKey(serviceID string) string {
+	if key, ok := PagerDutyRoutingKeys[serviceID]; ok {
+		return key
+	}
+
+	return PagerDutyDefaultRoutingKey
+}
+
+// sendPagerDutyEvent envia um evento para a Events API v2, retornando a dedup_key
+func sendPagerDutyEvent(routingKey string, action string, dedupKey string, payload map[string]interface{}) (string, error) {
+	if routingKey == "" {
+		return "", fmt.Errorf("nenhuma routing key do PagerDuty configurada")
+	}
+
+	event := map[string]interface{}{
+		"routing_key":  routingKey,
+		"event_action": action,
+	}
+
+	if dedupKey != "" {
+		event["dedup_key"] = dedupKey
+	}
+
+	if payload != nil {
+		event["payload"] = payload
+	}
+
+	resp, err := HTTPSendJSONRequest(PostHTTP, pagerDutyEventsURL, nil, event)
+	if err != nil {
+		return "", err
+	}
+
+	return gjson.Get(resp, "dedup_key").String(), nil
+}
+
+// TriggerPagerDuty abre um incidente no PagerDuty para o serviço
+func TriggerPagerDuty(serviceID string, summary string, severity string, details map[string]string) (string, error) {
+	routingKey := pagerDutyRoutingKey(serviceID)
+
+	dedupKey, err := sendPagerDutyEvent(routingKey, "trigger", "", map[string]interface{}{
+		"summary":        summary,
+		"source":         "slack-bot",
+		"severity":       severity,
+		"component":      serviceID,
+		"custom_details": details,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	pagerDutyIncidentsMutex.Lock()
+	pagerDutyIncidents[dedupKey] = routingKey
+	pagerDutyIncidentsMutex.Unlock()
+
+	return dedupKey, nil
+}
+
+// UpdatePagerDuty reconhece (acknowledge) ou resolve (resolve) um incidente
+func UpdatePagerDuty(dedupKey string, action string) error {
+	pagerDutyIncidentsMutex.Lock()
+	routingKey, ok := pagerDutyIncidents[dedupKey]
+	pagerDutyIncidentsMutex.Unlock()
+
+	if !ok {
+		routingKey = PagerDutyDefaultRoutingKey
+	}
+
+	_, err := sendPagerDutyEvent(routingKey, action, dedupKey, nil)
+
+	return err
+}
+
+// PageCritical é chamada quando o BOT detecta um problema crítico, abrindo o
+// incidente no PagerDuty (caso o PAGERDUTY_AUTO_PAGE esteja ativo) e avisando no canal
+func PageCritical(serviceID string, summary string, details map[string]string) {
+	if !PagerDutyAutoPage || !PagerDutyEnabled() {
+		return
+	}
+
+	dedupKey, err := TriggerPagerDuty(serviceID, summary, "critical", details)
+	if err != nil {
+		CheckErr("Erro ao abrir incidente no PagerDuty", err)
+		return
+	}
+
+	log.Printf("[INFO] Incidente %s aberto no PagerDuty: %s\n", dedupKey, summary)
+
+	api := getAPIConnection()
+	api.client.PostMessage(api.channelID, withOncallMention(slack.MsgOptionAttachments(pagerDutyAttachment(summary, dedupKey)))...)
+}
+
+// pagerDutyAttachment monta a mensagem do incidente com os botões de reconhecer e resolver
+func pagerDutyAttachment(summary string, dedupKey string) slack.Attachment {
+	return slack.Attachment{
+		Title:      ":rotating_light: Incidente aberto no PagerDuty",
+		Text:       summary,
+		Footer:     fmt.Sprintf("dedup_key: %s", dedupKey),
+		Color:      "#D50200",
+		CallbackID: pagerDutyCallback,
+		Actions: append([]slack.AttachmentAction{
+			{Name: actionPagerDutyAck, Text: "Reconhecer", Type: "button", Style: "primary", Value: dedupKey},
+			{Name: actionPagerDutyResolve, Text: "Resolver", Type: "button", Value: dedupKey},
+		}, alertActions("")...),
+	}
+}
+
+func (s *SlackListener) slackPagerDutyTrigger(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) < 4 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s serviço descrição do problema", pagerDutyTrigger), false))
+		return
+	}
+
+	serviceID, ok := s.resolveServiceArg(ev.Channel, args[2])
+	if !ok {
+		return
+	}
+	summary := strings.Join(args[3:], " ")
+
+	dedupKey, err := TriggerPagerDuty(serviceID, summary, "critical", map[string]string{"aberto_por": ev.Msg.User})
+	if err != nil {
+		CheckErr("Erro ao abrir incidente no PagerDuty", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao abrir o incidente no PagerDuty: %s", err), false))
+		return
+	}
+
+	log.Printf("[INFO] Incidente %s aberto no PagerDuty pelo usuário %s\n", dedupKey, ev.Msg.User)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(pagerDutyAttachment(fmt.Sprintf("`%s`: %s", serviceID, summary), dedupKey)))
+}
+
+func (s *SlackListener) slackPagerDutyUpdate(ev *slack.MessageEvent, action string) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) != 3 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s dedup-key", args[1]), false))
+		return
+	}
+
+	if err := UpdatePagerDuty(args[2], action); err != nil {
+		CheckErr("Erro ao atualizar incidente no PagerDuty", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao atualizar o incidente no PagerDuty: %s", err), false))
+		return
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Incidente `%s` atualizado no PagerDuty (%s) :white_check_mark:", args[2], action), false))
+}
+
+func actionPagerDutyFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	action := "acknowledge"
+	title := fmt.Sprintf(":eyes: Reconhecido no PagerDuty por @%s", message.User.Name)
+
+	if message.Actions[0].Name == actionPagerDutyResolve {
+		action = "resolve"
+		title = fmt.Sprintf(":white_check_mark: Resolvido no PagerDuty por @%s", message.User.Name)
+	}
+
+	if err := UpdatePagerDuty(message.Actions[0].Value, action); err != nil {
+		CheckErr("Erro ao atualizar incidente no PagerDuty", err)
+		respondWithoutActions(w, message.OriginalMessage, ":x: Erro ao atualizar o incidente no PagerDuty", err.Error())
+		return
+	}
+
+	// Depois de reconhecido ainda é possível resolver o incidente
+	if action == "acknowledge" {
+		original := message.OriginalMessage
+		original.Attachments[0].Actions = []slack.AttachmentAction{
+			{Name: actionPagerDutyResolve, Text: "Resolver", Type: "button", Value: message.Actions[0].Value},
+		}
+		original.Attachments[0].Fields = []slack.AttachmentField{{Title: title, Short: false}}
+
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(&original)
+		return
+	}
+
+	respondWithoutActions(w, message.OriginalMessage, title, "")
+}
@@ -0,0 +1,52 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// startedAt é o horário em que o processo do BOT foi iniciado
+var startedAt = time.Now()
+
+// pingPlugin responde com a réplica que recebeu o comando, se ela é a líder e
+// há quanto tempo está no ar. Serve também de exemplo de plugin
+type pingPlugin struct{}
+
+func init() {
+	RegisterPlugin(pingPlugin{})
+}
+
+func (pingPlugin) Name() string {
+	return "ping"
+}
+
+func (pingPlugin) CallbackID() string {
+	return ""
+}
+
+func (pingPlugin) Permissions() []string {
+	return nil
+}
+
+func (pingPlugin) Help() Command {
+	return Command{
+		Description: "Comando que mostra a réplica do BOT que respondeu e há quanto tempo ela está no ar",
+		Usage:       "@bot comando",
+		Lint:        "Útil para conferir qual réplica é a líder com a eleição de líder ativa",
+		IsActive:    true,
+	}
+}
+
+func (pingPlugin) Handle(req *PluginRequest) error {
+	role := "líder"
+	if !IsLeader() {
+		role = "reserva"
+	}
+
+	req.Reply(fmt.Sprintf(":ping_pong: pong de `%s` (%s), no ar há %s", leaderIdentity, role, formatDuration(time.Since(startedAt))))
+
+	return nil
+}
@@ -0,0 +1,163 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+var (
+	// PipelinePollInterval é o intervalo entre as consultas de status dos
+	// pipelines disparados pelo BOT
+	PipelinePollInterval = 15 * time.Second
+
+	// PipelineTimeout é o tempo máximo que o BOT acompanha um pipeline
+	PipelineTimeout = time.Hour
+)
+
+// PipelineStatus é o estado de uma execução de pipeline (workflow do GitHub
+// Actions, pipeline do GitLab, build do Jenkins)
+type PipelineStatus struct {
+	State    string
+	Finished bool
+	Success  bool
+	URL      string
+
+	// Jobs é o estado de cada job da execução, as mudanças são enviadas na thread
+	Jobs map[string]string
+}
+
+// pipelineColor retorna a cor da mensagem de acordo com o estado do pipeline
+func pipelineColor(status PipelineStatus) string {
+	if !status.Finished {
+		return "#FFA500"
+	}
+
+	if status.Success {
+		return "#36A64F"
+	}
+
+	return "#D50200"
+}
+
+func pipelineEmoji(status PipelineStatus) string {
+	if !status.Finished {
+		return ":hourglass_flowing_sand:"
+	}
+
+	if status.Success {
+		return ":white_check_mark:"
+	}
+
+	return ":x:"
+}
+
+// pipelineAttachment monta a mensagem com o estado atual do pipeline
+func pipelineAttachment(title string, status PipelineStatus) slack.Attachment {
+	attachment := slack.Attachment{
+		Title:     fmt.Sprintf("%s %s", pipelineEmoji(status), title),
+		TitleLink: status.URL,
+		Text:      fmt.Sprintf("*Status:* `%s`", status.State),
+		Color:     pipelineColor(status),
+	}
+
+	if len(status.Jobs) > 0 {
+		names := make([]string, 0, len(status.Jobs))
+		for name := range status.Jobs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var jobs []string
+		for _, name := range names {
+			jobs = append(jobs, fmt.Sprintf("• %s: `%s`", name, status.Jobs[name]))
+		}
+
+		attachment.Fields = []slack.AttachmentField{{Title: "Jobs", Value: strings.Join(jobs, "\n")}}
+	}
+
+	return attachment
+}
+
+// TrackPipeline consulta o status do pipeline até ele terminar (ou estourar o
+// PipelineTimeout), atualizando a mensagem original a cada mudança e enviando
+// as transições de estado (do pipeline e dos jobs) na thread da mensagem
+func TrackPipeline(channel string, ts string, title string, poll func() (PipelineStatus, error)) {
+	api := getAPIConnection()
+	deadline := time.Now().Add(PipelineTimeout)
+
+	var last PipelineStatus
+
+	for time.Now().Before(deadline) {
+		status, err := poll()
+		if err != nil {
+			log.Printf("[ERROR] Erro ao consultar o pipeline %s: %s", title, err)
+			time.Sleep(PipelinePollInterval)
+			continue
+		}
+
+		var transitions []string
+		for name, state := range status.Jobs {
+			if last.Jobs[name] != state {
+				transitions = append(transitions, fmt.Sprintf("Job *%s*: `%s` → `%s`", name, orDash(last.Jobs[name]), state))
+			}
+		}
+		sort.Strings(transitions)
+
+		if status.State != last.State {
+			transitions = append([]string{fmt.Sprintf("%s: `%s` → `%s`", title, orDash(last.State), status.State)}, transitions...)
+		}
+
+		if len(transitions) > 0 {
+			api.client.UpdateMessage(channel, ts, slack.MsgOptionAttachments(pipelineAttachment(title, status)))
+			api.client.PostMessage(channel, slack.MsgOptionText(strings.Join(transitions, "\n"), false), slack.MsgOptionTS(ts))
+		}
+
+		if status.Finished {
+			log.Printf("[INFO] Pipeline %s finalizado: %s\n", title, status.State)
+			return
+		}
+
+		last = status
+		time.Sleep(PipelinePollInterval)
+	}
+
+	api.client.PostMessage(channel, slack.MsgOptionText(fmt.Sprintf(":warning: Parei de acompanhar o pipeline após %s, o último status era `%s`", PipelineTimeout, last.State), false), slack.MsgOptionTS(ts))
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+// parseKeyValueArgs separa os argumentos no formato chave=valor dos demais
+func parseKeyValueArgs(args []string) (map[string]string, []string) {
+	values := map[string]string{}
+	var rest []string
+
+	for _, arg := range args {
+		if arg == "" {
+			continue
+		}
+
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) == 2 && kv[0] != "" {
+			values[kv[0]] = kv[1]
+			continue
+		}
+
+		rest = append(rest, arg)
+	}
+
+	return values, rest
+}
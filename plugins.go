@@ -0,0 +1,213 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nlopes/slack"
+)
+
+// Plugin é um comando (ou ação de botões e menus) registrado no BOT sem
+// alterar o handleMessageEvent e o ServeHTTP. Os plugins ficam em arquivos
+// próprios e se registram no init com RegisterPlugin
+type Plugin interface {
+	// Name é o comando que chama o plugin (@bot nome args...)
+	Name() string
+
+	// CallbackID é o callback_id dos botões e menus tratados pelo plugin,
+	// vazio caso o plugin não tenha interações
+	CallbackID() string
+
+	// Permissions são os usuários (ID ou nome) que podem usar o plugin,
+	// vazio libera para todos
+	Permissions() []string
+
+	// Handle executa o plugin, o erro retornado é mostrado ao usuário
+	Handle(req *PluginRequest) error
+}
+
+// PluginHelp é implementado pelos plugins que aparecem no comando comandos e
+// no "ajuda"
+type PluginHelp interface {
+	Help() Command
+}
+
+// PluginRequest é a chamada de um plugin, vinda de uma mensagem (Message) ou
+// de um botão/menu (Callback)
+type PluginRequest struct {
+	User     string
+	UserName string
+	Channel  string
+	Args     []string
+	Value    string
+
+	Message  *slack.MessageEvent
+	Callback *slack.AttachmentActionCallback
+
+	w       http.ResponseWriter
+	replied bool
+}
+
+// Reply responde a chamada: na mensagem envia no canal e na interação
+// substitui a mensagem original (só a primeira resposta, as demais vão para o
+// canal)
+func (r *PluginRequest) Reply(text string) {
+	if r.Callback != nil && !r.replied {
+		r.replied = true
+		respondWithoutActions(r.w, r.Callback.OriginalMessage, text, "")
+		return
+	}
+
+	api := getAPIConnection()
+	api.client.PostMessage(r.Channel, slack.MsgOptionText(text, false))
+}
+
+// Post envia a mensagem com attachments (ex.: botões com o CallbackID do
+// plugin) no canal da chamada
+func (r *PluginRequest) Post(options ...slack.MsgOption) {
+	api := getAPIConnection()
+	api.client.PostMessage(r.Channel, options...)
+}
+
+var (
+	plugins      = map[string]Plugin{}
+	pluginsMutex sync.RWMutex
+)
+
+// RegisterPlugin registra o plugin, um nome ou callback já usado por outro
+// plugin derruba o BOT na inicialização
+func RegisterPlugin(p Plugin) {
+	pluginsMutex.Lock()
+	defer pluginsMutex.Unlock()
+
+	for _, registered := range plugins {
+		if registered.Name() == p.Name() || (p.CallbackID() != "" && registered.CallbackID() == p.CallbackID()) {
+			log.Fatalf("[ERROR] Plugin %s em conflito com o plugin %s", p.Name(), registered.Name())
+		}
+	}
+
+	plugins[p.Name()] = p
+}
+
+// pluginByName retorna o plugin do comando
+func pluginByName(name string) (Plugin, bool) {
+	pluginsMutex.RLock()
+	defer pluginsMutex.RUnlock()
+
+	p, ok := plugins[name]
+
+	return p, ok
+}
+
+// pluginByCallback retorna o plugin que trata o callback_id
+func pluginByCallback(callbackID string) (Plugin, bool) {
+	pluginsMutex.RLock()
+	defer pluginsMutex.RUnlock()
+
+	for _, p := range plugins {
+		if p.CallbackID() != "" && p.CallbackID() == callbackID {
+			return p, true
+		}
+	}
+
+	return nil, false
+}
+
+// pluginCommands retorna a ajuda dos plugins, para a lista de comandos
+func pluginCommands() []Command {
+	pluginsMutex.RLock()
+	defer pluginsMutex.RUnlock()
+
+	var commands []Command
+	for _, p := range plugins {
+		if help, ok := p.(PluginHelp); ok {
+			command := help.Help()
+			command.Cmd = p.Name()
+			commands = append(commands, command)
+		}
+	}
+
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Cmd < commands[j].Cmd
+	})
+
+	return commands
+}
+
+// pluginAllowed verifica se o usuário está nas permissões do plugin
+func pluginAllowed(p Plugin, user string, userName string) bool {
+	return userAllowed(p.Permissions(), user, userName)
+}
+
+// runPlugin verifica as permissões e executa o plugin, respondendo os erros
+func runPlugin(p Plugin, req *PluginRequest) {
+	if !pluginAllowed(p, req.User, req.UserName) {
+		log.Printf("[INFO] Usuário %s sem permissão para o plugin %s\n", req.User, p.Name())
+		req.Reply(fmt.Sprintf(":no_entry: Você não tem permissão para usar o `%s`", p.Name()))
+		return
+	}
+
+	if err := p.Handle(req); err != nil {
+		CheckErr(fmt.Sprintf("Erro no plugin %s", p.Name()), err)
+		req.Reply(fmt.Sprintf(":x: %s", err))
+		return
+	}
+
+	// Interação sem resposta do plugin precisa de um 200 para o Slack
+	if req.Callback != nil && !req.replied {
+		req.w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handlePluginMessage executa o plugin do comando da mensagem, retornando se
+// algum plugin tratou a mensagem
+func (s *SlackListener) handlePluginMessage(ev *slack.MessageEvent, command string) bool {
+	p, ok := pluginByName(command)
+	if !ok {
+		return false
+	}
+
+	args := strings.Fields(ev.Msg.Text)[2:]
+
+	runPlugin(p, &PluginRequest{
+		User:    ev.Msg.User,
+		Channel: ev.Channel,
+		Args:    args,
+		Message: ev,
+	})
+
+	return true
+}
+
+// handlePluginInteraction executa o plugin do callback_id da interação,
+// retornando se algum plugin tratou a interação
+func handlePluginInteraction(message slack.AttachmentActionCallback, w http.ResponseWriter) bool {
+	p, ok := pluginByCallback(message.CallbackID)
+	if !ok {
+		return false
+	}
+
+	action := message.Actions[0]
+	value := action.Value
+	if len(action.SelectedOptions) > 0 {
+		value = action.SelectedOptions[0].Value
+	}
+
+	runPlugin(p, &PluginRequest{
+		User:     message.User.ID,
+		UserName: message.User.Name,
+		Channel:  message.Channel.ID,
+		Value:    value,
+		Callback: &message,
+		w:        w,
+	})
+
+	return true
+}
@@ -0,0 +1,249 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// dockerHubRegistry é o registry das imagens sem o host (ex.: nginx:1.25)
+const dockerHubRegistry = "docker.io"
+
+var (
+	// PolicyRequiredLabels são as labels obrigatórias nos serviços
+	PolicyRequiredLabels []string
+
+	// PolicyRequireLimits exige os limites de memória e CPU nos serviços
+	PolicyRequireLimits bool
+
+	// PolicyDenyLatest recusa as imagens com a tag latest ou sem tag
+	PolicyDenyLatest bool
+
+	// PolicyAllowedRegistries são os registries aceitos nas imagens, vazio
+	// aceita todos. As imagens do Docker Hub são o docker.io
+	PolicyAllowedRegistries []string
+)
+
+// PolicyWorkload é o que a política verifica: um serviço do compose ou a
+// configuração do serviço com a imagem do upgrade
+type PolicyWorkload struct {
+	Name           string
+	Image          string
+	Labels         map[string]string
+	HasMemoryLimit bool
+	HasCPULimit    bool
+}
+
+// PolicyEnabled retorna se alguma regra da política está configurada
+func PolicyEnabled() bool {
+	return len(PolicyRequiredLabels) > 0 || PolicyRequireLimits || PolicyDenyLatest || len(PolicyAllowedRegistries) > 0
+}
+
+// imageRegistry retorna o registry da imagem, docker.io para as do Docker Hub
+func imageRegistry(image string) string {
+	image = strings.TrimPrefix(image, "docker:")
+
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+
+	return dockerHubRegistry
+}
+
+// imageTag retorna a tag da imagem, latest quando ela não tem tag. Imagens
+// pelo digest (@sha256:...) retornam o digest
+func imageTag(image string) string {
+	image = strings.TrimPrefix(image, "docker:")
+
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+
+	return "latest"
+}
+
+// Violations retorna as regras da política que o serviço não cumpre
+func (w PolicyWorkload) Violations() []string {
+	var problems []string
+
+	if PolicyDenyLatest && imageTag(w.Image) == "latest" {
+		problems = append(problems, fmt.Sprintf("`%s`: a imagem `%s` usa a tag latest, use uma tag fixa", w.Name, w.Image))
+	}
+
+	if registry := imageRegistry(w.Image); len(PolicyAllowedRegistries) > 0 && !containsString(PolicyAllowedRegistries, registry) {
+		problems = append(problems, fmt.Sprintf("`%s`: o registry `%s` não é permitido (%s)", w.Name, registry, strings.Join(PolicyAllowedRegistries, ", ")))
+	}
+
+	var missing []string
+	for _, label := range PolicyRequiredLabels {
+		if w.Labels[label] == "" {
+			missing = append(missing, label)
+		}
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("`%s`: sem as labels obrigatórias %s", w.Name, strings.Join(missing, ", ")))
+	}
+
+	if PolicyRequireLimits && !w.HasMemoryLimit {
+		problems = append(problems, fmt.Sprintf("`%s`: sem o limite de memória", w.Name))
+	}
+	if PolicyRequireLimits && !w.HasCPULimit {
+		problems = append(problems, fmt.Sprintf("`%s`: sem o limite de CPU", w.Name))
+	}
+
+	return problems
+}
+
+// composeWorkloads retorna os serviços do compose para a política
+func composeWorkloads(compose *ComposeFile) []PolicyWorkload {
+	var workloads []PolicyWorkload
+	for _, name := range compose.ServiceNames() {
+		service := compose.Services[name]
+
+		workloads = append(workloads, PolicyWorkload{
+			Name:           name,
+			Image:          service.Image,
+			Labels:         service.LabelMap(),
+			HasMemoryLimit: composeValueSet(service.MemLimit),
+			HasCPULimit:    service.CPUQuota > 0 || service.CPUShares > 0 || composeValueSet(service.CPUs),
+		})
+	}
+
+	return workloads
+}
+
+// composeValueSet retorna se o campo do compose foi preenchido com algo
+// diferente de zero (ex.: mem_limit: 512m ou 536870912)
+func composeValueSet(value interface{}) bool {
+	text := strings.TrimSpace(fmt.Sprintf("%v", value))
+	return value != nil && text != "" && text != "0"
+}
+
+// ComposePolicyViolations retorna as regras da política que os serviços do
+// compose não cumprem
+func ComposePolicyViolations(compose *ComposeFile) []string {
+	var problems []string
+	for _, workload := range composeWorkloads(compose) {
+		problems = append(problems, workload.Violations()...)
+	}
+
+	return problems
+}
+
+// upgradeWorkload monta a configuração do serviço com a nova imagem. Fora do
+// Rancher só a imagem é conhecida
+func upgradeWorkload(serviceID string, image string) PolicyWorkload {
+	workload := PolicyWorkload{Name: serviceIndex.Name(serviceID), Image: image, Labels: map[string]string{}}
+	if orchestrator.Name() != "rancher" {
+		// Sem a configuração do serviço as regras dela não são verificadas
+		workload.HasMemoryLimit, workload.HasCPULimit = true, true
+		for _, label := range PolicyRequiredLabels {
+			workload.Labels[label] = "?"
+		}
+		return workload
+	}
+
+	service, err := rancherListener.GetService(serviceID)
+	if err != nil {
+		CheckErr("Erro ao buscar a configuração do serviço "+serviceID, err)
+		return workload
+	}
+
+	launchConfig := service.LaunchConfig
+	if image == "" {
+		workload.Image = launchConfig.ImageUUID
+	}
+	for key, value := range launchConfig.Labels {
+		workload.Labels[key] = value
+	}
+	workload.HasMemoryLimit = launchConfig.Memory > 0
+	workload.HasCPULimit = launchConfig.CPUQuota > 0 || launchConfig.CPUShares > 0 || launchConfig.MilliCPUReservation > 0
+
+	return workload
+}
+
+// CheckUpgradePolicy verifica se o upgrade do serviço para a imagem é
+// permitido: a política de vulnerabilidades e as regras da política
+func CheckUpgradePolicy(serviceID string, image string) error {
+	if err := CheckImagePolicy(image); err != nil {
+		return err
+	}
+
+	if !PolicyEnabled() {
+		return nil
+	}
+
+	if problems := upgradeWorkload(serviceID, image).Violations(); len(problems) > 0 {
+		return fmt.Errorf("a configuração não passa na política: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// policyResultMessage é a resposta da validação: as regras não cumpridas ou
+// a aprovação
+func policyResultMessage(target string, problems []string) string {
+	if len(problems) == 0 {
+		return fmt.Sprintf(":white_check_mark: %s passa na política", target)
+	}
+
+	return fmt.Sprintf(":x: %s não passa na política:\n• %s", target, strings.Join(problems, "\n• "))
+}
+
+// slackValidate verifica a configuração do upgrade do serviço (com a nova
+// imagem, quando informada) contra a política, sem alterar nada
+func (s *SlackListener) slackValidate(ev *slack.MessageEvent) {
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+
+	serviceID, ok := s.resolveServiceArg(ev.Channel, args.Positional[0])
+	if !ok {
+		return
+	}
+
+	image := ""
+	if len(args.Positional) > 1 {
+		image = args.Positional[1]
+	}
+
+	workload := upgradeWorkload(serviceID, image)
+	problems := workload.Violations()
+	if err := CheckImagePolicy(workload.Image); err != nil {
+		problems = append(problems, fmt.Sprintf("`%s`: %s", workload.Name, err))
+	}
+	sort.Strings(problems)
+
+	log.Printf("[INFO] Validação do serviço %s com a imagem %s: %d problemas\n", serviceID, workload.Image, len(problems))
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(policyResultMessage(fmt.Sprintf("O upgrade de `%s` para `%s`", workload.Name, workload.Image), problems), false))
+}
+
+// AdminValidateCompose valida o docker-compose.yml do body (formato e
+// política), para as pipelines validarem antes do upload no Slack
+func AdminValidateCompose(w http.ResponseWriter, r *http.Request) {
+	content, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, composeMaxSize))
+	if err != nil || len(bytes.TrimSpace(content)) == 0 {
+		adminError(w, http.StatusBadRequest, "body deve ser o docker-compose.yml")
+		return
+	}
+
+	compose, problems := ParseCompose(content)
+	if compose != nil {
+		problems = append(problems, ComposePolicyViolations(compose)...)
+	}
+
+	adminJSON(w, http.StatusOK, map[string]interface{}{"valid": len(problems) == 0, "problems": problems})
+}
@@ -0,0 +1,186 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	// progressInterval é o tempo mínimo entre duas edições da mensagem de
+	// progresso, para não passar do rate limit do chat.update
+	progressInterval = 3 * time.Second
+
+	// upgradePollInterval é o intervalo entre as verificações do upgrade
+	upgradePollInterval = 5 * time.Second
+)
+
+// UpgradeProgressTimeout é o tempo máximo acompanhando um upgrade
+var UpgradeProgressTimeout = 10 * time.Minute
+
+// Progress é uma mensagem enviada assim que a ação começa e editada com o
+// andamento (ex.: 3/7 serviços reiniciados) e o tempo decorrido, terminando
+// com o resumo. Os métodos podem ser chamados em um Progress nil
+type Progress struct {
+	channel string
+	ts      string
+	title   string
+	job     *Job
+	started time.Time
+
+	mutex      sync.Mutex
+	lastUpdate time.Time
+}
+
+// StartProgress envia a mensagem de progresso no canal. Com o job, a
+// mensagem tem o botão de cancelar enquanto a ação não termina
+func StartProgress(channel string, title string, job *Job) *Progress {
+	p := &Progress{channel: channel, title: title, job: job, started: time.Now()}
+
+	_, ts, err := getAPIConnection().client.PostMessage(channel, p.options(":hourglass_flowing_sand: iniciando", true)...)
+	if err != nil {
+		CheckErr("Erro ao enviar a mensagem de progresso", err)
+		return nil
+	}
+	p.ts = ts
+
+	return p
+}
+
+// ResumeProgress usa uma mensagem já enviada (ex.: a do botão clicado) como
+// mensagem de progresso
+func ResumeProgress(channel string, ts string, title string, job *Job) *Progress {
+	return &Progress{channel: channel, ts: ts, title: title, job: job, started: time.Now()}
+}
+
+// elapsed é o tempo desde o início, ex.: 1m 20s
+func (p *Progress) elapsed() string {
+	return formatDuration(time.Since(p.started))
+}
+
+func (p *Progress) options(status string, running bool) []slack.MsgOption {
+	attachment := slack.Attachment{
+		Text:  fmt.Sprintf("%s\n%s", p.title, status),
+		Color: "#0C648A",
+	}
+
+	if running && p.job != nil && p.job.cancelable {
+		attachment.CallbackID = actionJobCancel
+		attachment.Actions = []slack.AttachmentAction{jobCancelButton(p.job)}
+	}
+
+	return []slack.MsgOption{slack.MsgOptionText("", false), slack.MsgOptionAttachments(attachment), slack.MsgOptionBlocks([]slack.Block{}...)}
+}
+
+// Update edita a mensagem com o andamento, no máximo uma vez a cada
+// progressInterval
+func (p *Progress) Update(done int, total int, detail string) {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	if time.Since(p.lastUpdate) < progressInterval {
+		p.mutex.Unlock()
+		return
+	}
+	p.lastUpdate = time.Now()
+	p.mutex.Unlock()
+
+	status := fmt.Sprintf(":gear: %s (%s)", detail, p.elapsed())
+	if total > 0 {
+		status = fmt.Sprintf(":gear: %d/%d %s (%s)", done, total, detail, p.elapsed())
+	}
+
+	getAPIConnection().client.UpdateMessage(p.channel, p.ts, p.options(status, true)...)
+}
+
+// Finish edita a mensagem com o resumo e o tempo total, removendo o botão
+// de cancelar
+func (p *Progress) Finish(ok bool, summary string) {
+	if p == nil {
+		return
+	}
+
+	icon, color := ":white_check_mark:", "good"
+	if !ok {
+		icon, color = ":x:", "danger"
+	}
+
+	p.finish(slack.Attachment{Text: p.summary(icon, summary), Color: color})
+}
+
+// FinishWithUndo é igual ao Finish, com o botão de desfazer o que foi feito
+func (p *Progress) FinishWithUndo(ok bool, summary string, undoID string) {
+	if p == nil {
+		return
+	}
+
+	icon := ":white_check_mark:"
+	if !ok {
+		icon = ":x:"
+	}
+
+	p.finish(undoAttachment(p.summary(icon, summary), undoID))
+}
+
+func (p *Progress) summary(icon string, summary string) string {
+	return fmt.Sprintf("%s\n%s %s (%s)", p.title, icon, summary, p.elapsed())
+}
+
+func (p *Progress) finish(attachment slack.Attachment) {
+	getAPIConnection().client.UpdateMessage(p.channel, p.ts, slack.MsgOptionText("", false), slack.MsgOptionAttachments(attachment), slack.MsgOptionBlocks([]slack.Block{}...))
+}
+
+// WaitServiceUpgrade acompanha o upgrade do serviço no Rancher, contando as
+// instâncias já rodando com a nova imagem, até todas estarem atualizadas, o
+// ctx ser cancelado ou passar o UpgradeProgressTimeout
+func WaitServiceUpgrade(ctx context.Context, serviceID string, image string, progress *Progress) error {
+	deadline := time.Now().Add(UpgradeProgressTimeout)
+
+	for {
+		service, err := rancherListener.GetService(serviceID)
+		if err != nil {
+			return fmt.Errorf("erro ao buscar o serviço %s: %s", serviceID, err)
+		}
+
+		instances, err := rancherListener.ListServiceInstances(serviceID)
+		if err != nil {
+			return fmt.Errorf("erro ao buscar as instâncias do serviço %s: %s", serviceID, err)
+		}
+
+		updated := 0
+		for _, instance := range instances {
+			if instance.ImageUUID == image && instance.State == "running" {
+				updated++
+			}
+		}
+
+		total := service.Scale
+		if total == 0 {
+			total = len(instances)
+		}
+
+		if service.State != "upgrading" && updated >= total {
+			return nil
+		}
+
+		progress.Update(updated, total, "instâncias com a nova imagem")
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("o upgrade não terminou em %s, %d/%d instâncias com a nova imagem", UpgradeProgressTimeout, updated, total)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d/%d instâncias com a nova imagem", updated, total)
+		case <-time.After(upgradePollInterval):
+		}
+	}
+}
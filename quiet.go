@@ -0,0 +1,203 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	// quietCheckInterval é o intervalo entre as verificações do fim do
+	// horário silencioso, quando o resumo é enviado
+	quietCheckInterval = time.Minute
+
+	// quietDigestChunk é a quantidade de notificações em cada mensagem do
+	// resumo (o Slack recomenda no máximo 20 attachments)
+	quietDigestChunk = 20
+)
+
+var (
+	// QuietHours é o mapeamento do canal (ID do Slack, ou * para todos) para
+	// o horário silencioso no formato início-fim, ex.: C123:22:00-07:00
+	QuietHours = map[string]string{}
+
+	// QuietHoursDigest define se as notificações do horário silencioso são
+	// enviadas em um resumo ao fim dele ou descartadas
+	QuietHoursDigest = true
+)
+
+// quietNotification é uma notificação guardada durante o horário silencioso,
+// com as opções da mensagem (ex.: a thread) para o envio no resumo
+type quietNotification struct {
+	At          time.Time
+	Attachments []slack.Attachment
+	Options     []slack.MsgOption
+}
+
+var (
+	quietPending = map[string][]quietNotification{}
+	quietMutex   sync.Mutex
+)
+
+// parseClock converte o horário HH:MM para o tempo desde a meia-noite
+func parseClock(value string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+// InQuietHours informa se o canal está no horário silencioso, no
+// MessagesTimezone. O horário pode passar da meia-noite (ex.: 22:00-07:00)
+func InQuietHours(channel string, now time.Time) bool {
+	window, ok := QuietHours[channel]
+	if !ok {
+		if window, ok = QuietHours["*"]; !ok {
+			return false
+		}
+	}
+
+	parts := strings.SplitN(window, "-", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	start, err := parseClock(parts[0])
+	if err != nil {
+		CheckErr("Erro ao ler o início do horário silencioso", err)
+		return false
+	}
+
+	end, err := parseClock(parts[1])
+	if err != nil {
+		CheckErr("Erro ao ler o fim do horário silencioso", err)
+		return false
+	}
+
+	now = now.In(MessagesTimezone)
+	current := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	if start <= end {
+		return current >= start && current < end
+	}
+
+	return current >= start || current < end
+}
+
+// PostNotification envia uma notificação do BOT no canal. As notificações
+// informativas (critical false) no horário silencioso do canal são
+// guardadas para o resumo ou descartadas, as críticas são sempre enviadas
+func PostNotification(channel string, critical bool, attachments []slack.Attachment, options ...slack.MsgOption) {
+	if !critical && InQuietHours(channel, time.Now()) {
+		if !QuietHoursDigest {
+			log.Printf("[INFO] Notificação descartada no horário silencioso do canal %s\n", channel)
+			return
+		}
+
+		quietMutex.Lock()
+		quietPending[channel] = append(quietPending[channel], quietNotification{At: time.Now(), Attachments: attachments, Options: options})
+		quietMutex.Unlock()
+
+		log.Printf("[INFO] Notificação guardada para o resumo do horário silencioso do canal %s\n", channel)
+		return
+	}
+
+	options = append([]slack.MsgOption{slack.MsgOptionAttachments(attachments...)}, options...)
+	getAPIConnection().client.PostMessage(channel, options...)
+}
+
+// sendNotification é o sendMessage para as notificações informativas, que
+// respeitam o horário silencioso do canal do BOT
+func sendNotification(message string) {
+	PostNotification(getAPIConnection().channelID, false, []slack.Attachment{{
+		Text:  message,
+		Color: "#0C648A",
+	}})
+}
+
+// WatchQuietHours envia o resumo das notificações guardadas quando o
+// horário silencioso de cada canal termina
+func WatchQuietHours() {
+	if len(QuietHours) == 0 || !QuietHoursDigest {
+		return
+	}
+
+	for range time.Tick(quietCheckInterval) {
+		quietMutex.Lock()
+		digests := map[string][]quietNotification{}
+		for channel, pending := range quietPending {
+			if !InQuietHours(channel, time.Now()) {
+				digests[channel] = pending
+				delete(quietPending, channel)
+			}
+		}
+		quietMutex.Unlock()
+
+		for channel, pending := range digests {
+			sendQuietDigest(channel, pending)
+		}
+	}
+}
+
+// sendQuietDigest envia as notificações guardadas, em ordem, em mensagens
+// de no máximo quietDigestChunk notificações. As que têm opções (ex.: a
+// thread) vão em mensagens próprias, com as opções delas. Os botões são
+// removidos, as ações podem não valer mais horas depois
+func sendQuietDigest(channel string, pending []quietNotification) {
+	log.Printf("[INFO] Enviando o resumo do horário silencioso do canal %s com %d notificações\n", channel, len(pending))
+
+	api := getAPIConnection()
+	text := fmt.Sprintf(":sunrise: *Resumo do horário silencioso:* %d notificações entre %s e %s", len(pending), localTime(pending[0].At, "15:04"), localTime(pending[len(pending)-1].At, "15:04"))
+	api.client.PostMessage(channel, slack.MsgOptionText(text, false))
+
+	var attachments []slack.Attachment
+	flush := func() {
+		for start := 0; start < len(attachments); start += quietDigestChunk {
+			end := start + quietDigestChunk
+			if end > len(attachments) {
+				end = len(attachments)
+			}
+
+			api.client.PostMessage(channel, slack.MsgOptionAttachments(attachments[start:end]...))
+		}
+		attachments = nil
+	}
+
+	for _, notification := range pending {
+		digested := quietDigestAttachments(notification)
+		if len(notification.Options) == 0 {
+			attachments = append(attachments, digested...)
+			continue
+		}
+
+		flush()
+		options := append([]slack.MsgOption{slack.MsgOptionAttachments(digested...)}, notification.Options...)
+		api.client.PostMessage(channel, options...)
+	}
+	flush()
+}
+
+// quietDigestAttachments são os attachments da notificação no resumo: com o
+// horário em que ela chegou no rodapé e sem os botões
+func quietDigestAttachments(notification quietNotification) []slack.Attachment {
+	var attachments []slack.Attachment
+	for _, attachment := range notification.Attachments {
+		if attachment.Footer == "" {
+			attachment.Footer = localTime(notification.At, "15:04")
+		} else {
+			attachment.Footer = fmt.Sprintf("%s | %s", localTime(notification.At, "15:04"), attachment.Footer)
+		}
+		attachment.Actions = nil
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments
+}
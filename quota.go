@@ -0,0 +1,285 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// QuotaAdmins são os usuários (IDs, nomes ou @papel do RBAC_ROLES) que podem
+// liberar usos além das cotas dos times
+var QuotaAdmins = []string{"@admin"}
+
+// Quota é o máximo de execuções das ações por período em um time, ex.: 10
+// restarts por dia em produção. Sem Environments vale em todos os ambientes
+type Quota struct {
+	Name         string   `json:"name"`
+	Actions      []string `json:"actions"`
+	Environments []string `json:"environments"`
+	Limit        int      `json:"limit"`
+	Period       string   `json:"period"`
+
+	period time.Duration
+}
+
+// quotaUsage são as execuções da cota no período e os usos extras liberados
+// pelo override, válidos até o ExtraUntil
+type quotaUsage struct {
+	Uses       []time.Time
+	Extra      int
+	ExtraUntil time.Time
+}
+
+var (
+	quotaUsages      = map[string]*quotaUsage{}
+	quotaUsagesMutex sync.Mutex
+)
+
+// parseQuotas lê os períodos das cotas do time, padrão 24h. As cotas sem
+// ações ou sem limite são ignoradas
+func (t *Tenant) parseQuotas() {
+	var quotas []Quota
+	for _, quota := range t.Quotas {
+		quota.period = 24 * time.Hour
+		if quota.Period != "" {
+			period, err := time.ParseDuration(quota.Period)
+			if err != nil || period <= 0 {
+				log.Printf("[ERROR] Período inválido na cota %s do time %s: %s\n", quota.Name, t.Name, quota.Period)
+				continue
+			}
+			quota.period = period
+		}
+
+		if quota.Name == "" || len(quota.Actions) == 0 || quota.Limit <= 0 {
+			log.Printf("[ERROR] Cota %q do time %s sem nome, ações ou limite, ignorada\n", quota.Name, t.Name)
+			continue
+		}
+
+		quotas = append(quotas, quota)
+	}
+
+	t.Quotas = quotas
+}
+
+// applies retorna se alguma das ações no ambiente conta na cota
+func (q Quota) applies(actions []string, environment string) bool {
+	if len(q.Environments) > 0 && !containsString(q.Environments, environment) {
+		return false
+	}
+
+	for _, action := range actions {
+		if containsString(q.Actions, action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// usage retorna os usos da cota no período, já sem os vencidos. Deve ser
+// chamada com o quotaUsagesMutex
+func (q Quota) usage(tenant string, now time.Time) *quotaUsage {
+	key := tenant + "/" + q.Name
+	usage, ok := quotaUsages[key]
+	if !ok {
+		usage = &quotaUsage{}
+		quotaUsages[key] = usage
+	}
+
+	var uses []time.Time
+	for _, at := range usage.Uses {
+		if now.Sub(at) < q.period {
+			uses = append(uses, at)
+		}
+	}
+	usage.Uses = uses
+
+	if !usage.ExtraUntil.After(now) {
+		usage.Extra = 0
+	}
+
+	return usage
+}
+
+// status é a situação da cota, ex.: `prod-restarts`: 7/10 em 24h
+func (q Quota) status(usage *quotaUsage, now time.Time) string {
+	text := fmt.Sprintf("`%s`: %d/%d em %s", q.Name, len(usage.Uses), q.Limit, formatDuration(q.period))
+	if usage.Extra > 0 {
+		text += fmt.Sprintf(" (+%d liberados até %s)", usage.Extra, localTime(usage.ExtraUntil, "02/01 15:04"))
+	}
+	if len(usage.Uses) > 0 {
+		text += fmt.Sprintf(", próxima liberação às %s", localTime(usage.Uses[0].Add(q.period), "02/01 15:04"))
+	}
+
+	return text
+}
+
+// QuotaCharge são os usos contados pelo ConsumeQuota, devolvidos às cotas
+// pelo Refund quando a ação falha
+type QuotaCharge struct {
+	usages []*quotaUsage
+	uses   int
+	at     time.Time
+}
+
+// ConsumeQuota conta os usos da ação (ou das ações equivalentes) nas cotas do
+// time no ambiente atual, recusando quando alguma delas não tem usos
+// suficientes. Nada é contado quando a ação é recusada
+func (t *Tenant) ConsumeQuota(uses int, actions ...string) (*QuotaCharge, error) {
+	quotaUsagesMutex.Lock()
+	defer quotaUsagesMutex.Unlock()
+
+	now := time.Now()
+	var usages []*quotaUsage
+	for _, quota := range t.Quotas {
+		if !quota.applies(actions, orchestratorEnvironment) {
+			continue
+		}
+
+		usage := quota.usage(t.Name, now)
+		if remaining := quota.Limit + usage.Extra - len(usage.Uses); remaining < uses {
+			if uses > 1 && remaining > 0 {
+				return nil, fmt.Errorf("cota do time `%s` sem usos para os %d alvos, restam %d: %s. Os `QUOTA_ADMINS` podem liberar com `%s %s %s %d`", t.Name, uses, remaining, quota.status(usage, now), quotaOverride, t.Name, quota.Name, uses-remaining)
+			}
+			return nil, fmt.Errorf("cota do time `%s` esgotada, %s. Os `QUOTA_ADMINS` podem liberar com `%s %s %s %d`", t.Name, quota.status(usage, now), quotaOverride, t.Name, quota.Name, uses)
+		}
+		usages = append(usages, usage)
+	}
+
+	for _, usage := range usages {
+		for i := 0; i < uses; i++ {
+			usage.Uses = append(usage.Uses, now)
+		}
+	}
+
+	return &QuotaCharge{usages: usages, uses: uses, at: now}, nil
+}
+
+// Refund devolve os usos contados, uma única vez. Os usos já zerados pelo
+// override não são devolvidos de novo
+func (c *QuotaCharge) Refund() {
+	if c == nil {
+		return
+	}
+
+	quotaUsagesMutex.Lock()
+	defer quotaUsagesMutex.Unlock()
+
+	for _, usage := range c.usages {
+		refunded := 0
+		var uses []time.Time
+		for _, at := range usage.Uses {
+			if refunded < c.uses && at.Equal(c.at) {
+				refunded++
+				continue
+			}
+			uses = append(uses, at)
+		}
+		usage.Uses = uses
+	}
+	c.usages = nil
+}
+
+// OverrideQuota libera usos extras da cota até o fim do período ou, com
+// extra 0, zera os usos
+func OverrideQuota(tenantName string, quotaName string, extra int) (string, error) {
+	tenant := TenantByName(tenantName)
+	if tenant == nil {
+		return "", fmt.Errorf("time `%s` não encontrado", tenantName)
+	}
+
+	for _, quota := range tenant.Quotas {
+		if quota.Name != quotaName {
+			continue
+		}
+
+		quotaUsagesMutex.Lock()
+		defer quotaUsagesMutex.Unlock()
+
+		now := time.Now()
+		usage := quota.usage(tenant.Name, now)
+		if extra == 0 {
+			usage.Uses = nil
+		} else {
+			usage.Extra += extra
+			usage.ExtraUntil = now.Add(quota.period)
+		}
+
+		return quota.status(usage, now), nil
+	}
+
+	return "", fmt.Errorf("cota `%s` não encontrada no time `%s`", quotaName, tenant.Name)
+}
+
+// slackQuotaStatus mostra as cotas do time do canal ou, no canal do BOT, as
+// de todos os times
+func (s *SlackListener) slackQuotaStatus(ev *slack.MessageEvent) {
+	list := []*Tenant{TenantForChannel(ev.Channel)}
+	if list[0] == nil {
+		list = AllTenants()
+	}
+
+	quotaUsagesMutex.Lock()
+	now := time.Now()
+	var lines []string
+	for _, tenant := range list {
+		for _, quota := range tenant.Quotas {
+			line := fmt.Sprintf("*%s* %s | %s", tenant.Name, quota.status(quota.usage(tenant.Name, now), now), strings.Join(quota.Actions, ", "))
+			if len(quota.Environments) > 0 {
+				line += " em " + strings.Join(quota.Environments, ", ")
+			}
+			lines = append(lines, line)
+		}
+	}
+	quotaUsagesMutex.Unlock()
+
+	if len(lines) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText("Nenhuma cota configurada :shrug:", false))
+		return
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(":bar_chart: Cotas dos times:\n"+strings.Join(lines, "\n"), false))
+}
+
+// slackQuotaOverride libera usos extras ou zera a cota de um time. Só para os
+// QuotaAdmins
+func (s *SlackListener) slackQuotaOverride(ev *slack.MessageEvent) {
+	userName := ev.Msg.User
+	if info, err := s.client.GetUserInfo(ev.Msg.User); err == nil && info.Name != "" {
+		userName = info.Name
+	}
+
+	if !userAllowed(QuotaAdmins, ev.Msg.User, userName) {
+		log.Printf("[INFO] Usuário %s sem permissão para liberar cotas\n", userName)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: @%s não tem permissão para `%s` (%s)", userName, quotaOverride, formatPermissions(QuotaAdmins)), false))
+		return
+	}
+
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+	extra := 0
+	if amount := args.Positional[2]; amount != "reset" {
+		n, err := strconv.Atoi(amount)
+		if err != nil || n <= 0 {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Quantidade `%s` inválida, use um número maior que zero ou `reset`", amount), false))
+			return
+		}
+		extra = n
+	}
+
+	status, err := OverrideQuota(args.Positional[0], args.Positional[1], extra)
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	log.Printf("[INFO] Cota %s do time %s liberada (%s) por %s\n", args.Positional[1], args.Positional[0], args.Positional[2], userName)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":unlock: Cota do time `%s` liberada por @%s, %s", args.Positional[0], userName, status), false))
+}
@@ -0,0 +1,194 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+// testQuotaTenant cria um time com as cotas já lidas e sem usos anteriores
+func testQuotaTenant(name string, quotas ...Quota) *Tenant {
+	tenant := &Tenant{Name: name, Quotas: quotas}
+	tenant.parseQuotas()
+
+	quotaUsagesMutex.Lock()
+	for key := range quotaUsages {
+		if strings.HasPrefix(key, name+"/") {
+			delete(quotaUsages, key)
+		}
+	}
+	quotaUsagesMutex.Unlock()
+
+	return tenant
+}
+
+// quotaUses retorna os usos atuais da cota do time
+func quotaUses(tenant *Tenant, quota string) int {
+	quotaUsagesMutex.Lock()
+	defer quotaUsagesMutex.Unlock()
+
+	usage, ok := quotaUsages[tenant.Name+"/"+quota]
+	if !ok {
+		return 0
+	}
+
+	return len(usage.Uses)
+}
+
+func TestParseQuotas(t *testing.T) {
+	tenant := testQuotaTenant("parse",
+		Quota{Name: "restarts", Actions: []string{restartService}, Limit: 2},
+		Quota{Name: "hora", Actions: []string{restartService}, Limit: 2, Period: "1h"},
+		Quota{Name: "periodo-invalido", Actions: []string{restartService}, Limit: 2, Period: "amanhã"},
+		Quota{Name: "sem-acoes", Limit: 2},
+		Quota{Name: "sem-limite", Actions: []string{restartService}},
+		Quota{Actions: []string{restartService}, Limit: 2},
+	)
+
+	if len(tenant.Quotas) != 2 {
+		t.Fatalf("%d cotas lidas, esperado 2: %+v", len(tenant.Quotas), tenant.Quotas)
+	}
+	if tenant.Quotas[0].period.Hours() != 24 || tenant.Quotas[1].period.Hours() != 1 {
+		t.Errorf("períodos lidos %s e %s, esperado 24h e 1h", tenant.Quotas[0].period, tenant.Quotas[1].period)
+	}
+}
+
+func TestConsumeQuota(t *testing.T) {
+	defer func(env string) { orchestratorEnvironment = env }(orchestratorEnvironment)
+	orchestratorEnvironment = "production"
+
+	tests := []struct {
+		name    string
+		quota   Quota
+		uses    []int
+		actions []string
+		refused []bool
+		counted int
+	}{
+		{"dentro do limite", Quota{Name: "q", Actions: []string{restartService}, Limit: 2}, []int{1, 1}, []string{restartService}, []bool{false, false}, 2},
+		{"esgotada", Quota{Name: "q", Actions: []string{restartService}, Limit: 1}, []int{1, 1}, []string{restartService}, []bool{false, true}, 1},
+		{"batch maior que o restante", Quota{Name: "q", Actions: []string{restartService}, Limit: 3}, []int{2, 2}, []string{restartService}, []bool{false, true}, 2},
+		{"outra ação", Quota{Name: "q", Actions: []string{restartService}, Limit: 1}, []int{1, 1}, []string{scaleService}, []bool{false, false}, 0},
+		{"ação equivalente", Quota{Name: "q", Actions: []string{restartContainer}, Limit: 1}, []int{1, 1}, []string{restartContainerDrain, restartContainer}, []bool{false, true}, 1},
+		{"outro ambiente", Quota{Name: "q", Actions: []string{restartService}, Environments: []string{"staging"}, Limit: 1}, []int{1, 1}, []string{restartService}, []bool{false, false}, 0},
+	}
+
+	for _, test := range tests {
+		tenant := testQuotaTenant("consume", test.quota)
+
+		for i, uses := range test.uses {
+			_, err := tenant.ConsumeQuota(uses, test.actions...)
+			if (err != nil) != test.refused[i] {
+				t.Errorf("%s: uso %d retornou %v, recusado esperado %v", test.name, i+1, err, test.refused[i])
+			}
+		}
+
+		if counted := quotaUses(tenant, "q"); counted != test.counted {
+			t.Errorf("%s: %d usos contados, esperado %d", test.name, counted, test.counted)
+		}
+	}
+}
+
+func TestQuotaChargeRefund(t *testing.T) {
+	tenant := testQuotaTenant("refund",
+		Quota{Name: "restarts", Actions: []string{restartService}, Limit: 5},
+		Quota{Name: "todos", Actions: []string{restartService, scaleService}, Limit: 5},
+	)
+
+	kept, err := tenant.ConsumeQuota(1, restartService)
+	if err != nil {
+		t.Fatalf("ConsumeQuota: %s", err)
+	}
+	charge, err := tenant.ConsumeQuota(3, restartService)
+	if err != nil {
+		t.Fatalf("ConsumeQuota do batch: %s", err)
+	}
+
+	charge.Refund()
+	if quotaUses(tenant, "restarts") != 1 || quotaUses(tenant, "todos") != 1 {
+		t.Errorf("depois do Refund: %d e %d usos, esperado 1 em cada", quotaUses(tenant, "restarts"), quotaUses(tenant, "todos"))
+	}
+
+	// O Refund só devolve uma vez, e nunca os usos de outras cobranças
+	charge.Refund()
+	if quotaUses(tenant, "restarts") != 1 {
+		t.Errorf("o segundo Refund devolveu de novo: %d usos, esperado 1", quotaUses(tenant, "restarts"))
+	}
+
+	kept.Refund()
+	if quotaUses(tenant, "restarts") != 0 {
+		t.Errorf("depois de devolver todas as cobranças: %d usos, esperado 0", quotaUses(tenant, "restarts"))
+	}
+
+	var none *QuotaCharge
+	none.Refund()
+}
+
+func TestCommandCharged(t *testing.T) {
+	tests := []struct {
+		text    string
+		charged bool
+	}{
+		{"restart-service", false},
+		{"restart-service payments", true},
+		{"logs-container", false},
+		{"logs-container 1i5 lines=10", true},
+		{"info-canary", false},
+		{"info-canary lb-edge", false},
+		{"scale-service payments 3", true},
+		{"canary enable lb-edge 25%", true},
+	}
+
+	for _, test := range tests {
+		if charged := commandCharged(ParseCommandArgs(strings.Fields(test.text))); charged != test.charged {
+			t.Errorf("commandCharged(%q) = %v, esperado %v", test.text, charged, test.charged)
+		}
+	}
+}
+
+// testInteraction cria a interação do botão name ou, com o callbackID, da
+// opção escolhida no menu
+func testInteraction(callbackID string, name string, value string, selected ...string) *Interaction {
+	action := slack.AttachmentAction{Name: name, Value: value}
+	for _, option := range selected {
+		action.SelectedOptions = append(action.SelectedOptions, slack.AttachmentActionOption{Value: option})
+	}
+
+	return &Interaction{Message: slack.AttachmentActionCallback{CallbackID: callbackID, Actions: []slack.AttachmentAction{action}}}
+}
+
+func TestInteractionCharged(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      *Interaction
+		charged bool
+		uses    int
+		actions []string
+	}{
+		{"menu do restart", testInteraction(restartService, actionSelect, "", "1s5"), true, 1, []string{restartService}},
+		{"cancelar", testInteraction("", actionCancel, ""), false, 1, []string{actionCancel}},
+		{"seleção do batch", testInteraction("", actionBatchSelect, "", "1s5"), false, 1, []string{actionBatchSelect}},
+		{"menu de logs sem período", testInteraction(logsContainer, actionSelect, "", "1i5"), false, 1, []string{logsContainer}},
+		{"menu de logs com período", testInteraction(logsContainer, actionSelect, "", "1i5?lines=50"), true, 1, []string{logsContainer}},
+		{"período dos logs", testInteraction("", actionLogsRange, "1i5?since=15m"), true, 1, []string{actionLogsRange, logsContainer}},
+		{"restart com drain", testInteraction("", restartContainerDrain, "1i5?drain=30s"), true, 1, []string{restartContainerDrain, restartContainer}},
+		{"batch de restart", testInteraction("", actionBatchRun, batchRestart+"|"+batchServices, "1s5", "1s6", "1s7"), true, 3, []string{actionBatchRun, restartService}},
+		{"batch de logs", testInteraction("", actionBatchRun, batchLogs+"|"+batchContainers, "1i5"), true, 1, []string{actionBatchRun}},
+	}
+
+	for _, test := range tests {
+		if charged := interactionCharged(test.in); charged != test.charged {
+			t.Errorf("%s: interactionCharged = %v, esperado %v", test.name, charged, test.charged)
+		}
+		if uses := interactionUses(test.in); uses != test.uses {
+			t.Errorf("%s: interactionUses = %d, esperado %d", test.name, uses, test.uses)
+		}
+		if actions := interactionQuotaActions(test.in); strings.Join(actions, ",") != strings.Join(test.actions, ",") {
+			t.Errorf("%s: interactionQuotaActions = %v, esperado %v", test.name, actions, test.actions)
+		}
+	}
+}
@@ -5,18 +5,17 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/rgamba/evtwebsocket"
-	"github.com/tidwall/gjson"
-	"github.com/tidwall/sjson"
+	"github.com/gorilla/websocket"
+	"github.com/pulberg/slack-bot/rancher"
 )
 
 // RancherListener é uma estrutura onde ficam armazenados os dados de acesso ao Rancher API
@@ -25,184 +24,359 @@ type RancherListener struct {
 	secretKey string
 	baseURL   string
 	projectID string
+	ctx       context.Context
+	dryRun    *DryRun
 }
 
-// Container é uma estrutura que é usada para mostrar informações ao usuário
-type Container struct {
-	id        string
-	imageUUID string
-	name      string
-}
+// errNoHaproxyCfg é o erro das alterações do Canary em LoadBalancers sem o
+// Custom haproxy.cfg
+var errNoHaproxyCfg = errors.New("LoadBalancer sem Custom haproxy.cfg")
 
-// LoadBalancer é a estrutura que tem como objetivo representar um LoadBalancer do Rancher
-// de forma um pouco mais resumida (é usado na função GetLoadBalancers())
-type LoadBalancer struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+// api retorna o client do Rancher que envia as chamadas pelo listener, com o
+// contexto, o dry-run e as tentativas dele
+func (ranchListener *RancherListener) api() *rancher.Client {
+	return &rancher.Client{BaseURL: ranchListener.baseURL, ProjectID: ranchListener.projectID, Requester: ranchListener}
 }
 
 // RestartContainer : Função responsável por dar restart no container recebido por parâmetro
-func (ranchListener *RancherListener) RestartContainer(containerID string) {
-	url := fmt.Sprintf("%s/%s/containers/%s?action=restart", ranchListener.baseURL, ranchListener.projectID, containerID)
-	resp := ranchListener.HTTPSendRancherRequest(url, PostHTTP, "")
+func (ranchListener *RancherListener) RestartContainer(containerID string) error {
+	var container Container
+	err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("containers/%s?action=restart", containerID), nil, &container)
+	ranchListener.invalidateCache(cacheContainers)
+	if err != nil {
+		CheckErr("Erro ao reiniciar o container "+containerID, err)
+		return err
+	}
+
+	log.Println("[INFO] Container restartado! ID:", container.ID)
+
+	return nil
+}
+
+// StopContainer é a função que para o container, retornando o novo estado
+func (ranchListener *RancherListener) StopContainer(containerID string) (string, error) {
+	var container Container
+	err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("containers/%s?action=stop", containerID), `{"remove": false, "timeout": 10}`, &container)
+	ranchListener.invalidateCache(cacheContainers)
+	if err != nil {
+		CheckErr("Erro ao parar o container "+containerID, err)
+		return "", err
+	}
 
-	idValue := gjson.Get(resp, "id").String()
+	return container.State, nil
+}
+
+// StartContainer é a função que inicia o container parado
+func (ranchListener *RancherListener) StartContainer(containerID string) error {
+	err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("containers/%s?action=start", containerID), nil, &Container{})
+	ranchListener.invalidateCache(cacheContainers)
+	CheckErr("Erro ao iniciar o container "+containerID, err)
 
-	log.Println("[INFO] Container restartado! ID:", idValue)
+	return err
 }
 
 // ListContainers é uma função que retornará uma lista de todos os containers de um projeto/environment
-func (ranchListener *RancherListener) ListContainers() string {
-	url := fmt.Sprintf("%s/%s/containers", ranchListener.baseURL, ranchListener.projectID)
-	resp := ranchListener.HTTPSendRancherRequest(url, GetHTTP, "")
+func (ranchListener *RancherListener) ListContainers() ([]Container, error) {
+	var containers []Container
+	err := rancher.DecodeCollection(rancherCache.Get(ranchListener.cacheKey(cacheContainers), ranchListener.fetchContainers), &containers)
+
+	return containers, err
+}
+
+// FetchContainers é igual ao ListContainers, mas sempre busca na API, para
+// quem precisa do estado atual (ex.: detecção de crash loop)
+func (ranchListener *RancherListener) FetchContainers() ([]Container, error) {
+	var containers []Container
+	err := rancher.DecodeCollection(ranchListener.fetchContainers(), &containers)
+
+	return containers, err
+}
 
-	return resp
+func (ranchListener *RancherListener) fetchContainers() string {
+	return ranchListener.HTTPSendRancherListRequest(ranchListener.api().URL("containers"))
 }
 
-// GetService é uma função que retorna o JSON de uma requisição que busca
-// informações de um único serviço
-func (ranchListener *RancherListener) GetService(ID string) string {
-	url := fmt.Sprintf("%s/%s/services/%s", ranchListener.baseURL, ranchListener.projectID, ID)
-	resp := ranchListener.HTTPSendRancherRequest(url, GetHTTP, "")
+// GetService é uma função que busca as informações de um único serviço
+func (ranchListener *RancherListener) GetService(ID string) (*Service, error) {
+	service := &Service{}
+	if err := ranchListener.api().Get(ranchListener.context(), "services/"+ID, service); err != nil {
+		return nil, err
+	}
 
-	return resp
+	return service, nil
+}
+
+// ListServiceInstances é uma função que retorna todos os containers
+// (instâncias) de um serviço
+func (ranchListener *RancherListener) ListServiceInstances(ID string) ([]Container, error) {
+	url := ranchListener.api().URL("services/%s/instances", ID)
+
+	var containers []Container
+	err := rancher.DecodeCollection(ranchListener.HTTPSendRancherListRequest(url), &containers)
+
+	return containers, err
 }
 
 // UpgradeService é a função que faz o upgrade da imagem do serviço, recebendo
 // como parâmetro o ID do serviço e o nome da nova imagem do serviço
 func (ranchListener *RancherListener) UpgradeService(ID string, newImage string) string {
-	var data interface{}
-	var jsonRequest string
+	return ranchListener.UpgradeServiceWithStrategy(ID, newImage, defaultUpgradeStrategy)
+}
+
+// UpgradeServiceWithStrategy é o UpgradeService com a quantidade de
+// instâncias atualizadas por vez e o intervalo entre elas
+func (ranchListener *RancherListener) UpgradeServiceWithStrategy(ID string, newImage string, strategy UpgradeStrategy) string {
+	service, err := ranchListener.api().UpgradeService(ranchListener.context(), ID, newImage, strategy.BatchSize, strategy.Interval)
+	ranchListener.invalidateCache(cacheServices, cacheContainers)
+	if err != nil {
+		CheckErr("Erro ao fazer o upgrade do serviço "+ID, err)
+		return ""
+	}
 
-	originalServiceCfg := ranchListener.GetService(ID)
+	return service.LaunchConfig.ImageUUID
+}
 
-	originalServiceCfg, err := sjson.Set(originalServiceCfg, "launchConfig.imageUuid", newImage)
-	CheckErr("Erro ao setar valor de nova variável no JSON do serviço", err)
+// RollbackService é a função que volta o serviço para a configuração
+// anterior ao último upgrade, retornando a imagem que ficou ativa
+func (ranchListener *RancherListener) RollbackService(ID string) (string, error) {
+	var service Service
+	err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("services/%s?action=rollback", ID), nil, &service)
+	ranchListener.invalidateCache(cacheServices, cacheContainers)
+	if err != nil {
+		CheckErr("Erro ao fazer o rollback do serviço "+ID, err)
+		return "", err
+	}
 
-	launchConfigOri := gjson.Get(originalServiceCfg, "launchConfig").String()
+	return service.LaunchConfig.ImageUUID, nil
+}
 
-	json.Unmarshal([]byte(launchConfigOri), &data)
+// RestartService é a função que reinicia todos os containers do serviço,
+// um por vez
+func (ranchListener *RancherListener) RestartService(ID string) error {
+	err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("services/%s?action=restart", ID), `{"rollingRestartStrategy": {"batchSize": 1, "intervalMillis": 2000}}`, &Service{})
+	ranchListener.invalidateCache(cacheServices, cacheContainers)
+	CheckErr("Erro ao reiniciar o serviço "+ID, err)
 
-	jsonRequest, err = sjson.Set(jsonRequest, "inServiceStrategy.launchConfig", data)
-	CheckErr("Erro ao setar valor de nova variável no JSON do serviço", err)
+	return err
+}
 
-	url := fmt.Sprintf("%s/%s/services/%s?action=upgrade", ranchListener.baseURL, ranchListener.projectID, ID)
-	resp := ranchListener.HTTPSendRancherRequest(url, PostHTTP, jsonRequest)
+// DeactivateService é a função que para todos os containers do serviço
+func (ranchListener *RancherListener) DeactivateService(ID string) error {
+	err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("services/%s?action=deactivate", ID), nil, &Service{})
+	ranchListener.invalidateCache(cacheServices, cacheContainers)
+	CheckErr("Erro ao parar o serviço "+ID, err)
 
-	return gjson.Get(resp, "launchConfig.imageUuid").String()
+	return err
 }
 
-// ListServices é uma função que retorna o JSON (em string) de uma requisição que tem como
-// objetivo buscar todos os serviços do Environment
-func (ranchListener *RancherListener) ListServices() string {
-	url := fmt.Sprintf("%s/%s/services", ranchListener.baseURL, ranchListener.projectID)
-	resp := ranchListener.HTTPSendRancherRequest(url, GetHTTP, "")
+// ActivateService é a função que inicia de novo o serviço desativado
+func (ranchListener *RancherListener) ActivateService(ID string) error {
+	err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("services/%s?action=activate", ID), nil, &Service{})
+	ranchListener.invalidateCache(cacheServices, cacheContainers)
+	CheckErr("Erro ao ativar o serviço "+ID, err)
 
-	return resp
+	return err
 }
 
-// LogsContainer : Função responsável retornar os logs do container
-func (ranchListener *RancherListener) LogsContainer(containerID string) string {
-	data := &url.Values{}
-	data.Add("follow", "true")
-	data.Add("lines", "50")
+// CloneService cria na mesma stack um serviço com a configuração do serviço
+// (escala e launchConfig), com outro nome e outra imagem. Usado no blue/green
+func (ranchListener *RancherListener) CloneService(ID string, name string, image string) (*Service, error) {
+	service, err := ranchListener.api().CloneService(ranchListener.context(), ID, name, image)
+	ranchListener.invalidateCache(cacheServices, cacheContainers)
 
-	url := fmt.Sprintf("%s/%s/containers/%s?action=logs", ranchListener.baseURL, ranchListener.projectID, containerID)
+	return service, err
+}
 
-	resp := ranchListener.HTTPSendRancherRequest(url, PostHTTP, `{"follow": true, "lines": 50}`)
+// RemoveService é a função que remove o serviço e os seus containers
+func (ranchListener *RancherListener) RemoveService(ID string) error {
+	err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("services/%s?action=remove", ID), nil, &Service{})
+	ranchListener.invalidateCache(cacheServices, cacheContainers)
+	CheckErr("Erro ao remover o serviço "+ID, err)
 
-	tokenValue := gjson.Get(resp, "token").String()
-	urlValue := gjson.Get(resp, "url").String()
+	return err
+}
+
+// SetLoadBalancerTarget troca o serviço de destino das regras do
+// LoadBalancer de from para to em uma única alteração, retornando quantas
+// regras foram trocadas
+func (ranchListener *RancherListener) SetLoadBalancerTarget(ID string, from string, to string) (int, error) {
+	changed, err := ranchListener.api().SetLoadBalancerTarget(ranchListener.context(), ID, from, to)
+	ranchListener.invalidateCache(cacheLoadBalancers)
 
-	urlAndToken := fmt.Sprintf("%s?token=%s", urlValue, tokenValue)
+	return changed, err
+}
 
-	t := time.Now()
+// ScaleService é a função que altera a quantidade de containers do serviço,
+// retornando a nova escala
+func (ranchListener *RancherListener) ScaleService(ID string, scale int) string {
+	var service Service
+	err := ranchListener.api().Put(ranchListener.context(), "services/"+ID, fmt.Sprintf(`{"scale": %d}`, scale), &service)
+	ranchListener.invalidateCache(cacheServices, cacheContainers)
+	if err != nil {
+		CheckErr("Erro ao alterar a escala do serviço "+ID, err)
+		return ""
+	}
+
+	return strconv.Itoa(service.Scale)
+}
 
-	f, err := os.Create(fmt.Sprintf("/tmp/logs-container-%d%d%d%02d%02d%02d.log", t.Day(), t.Month(), t.Year(), t.Hour(), t.Minute(), t.Second()))
-	CheckErr("Erro na criação do arquivo de logs", err)
+// ListServices é uma função que busca todos os serviços do Environment
+func (ranchListener *RancherListener) ListServices() ([]Service, error) {
+	resp := rancherCache.Get(ranchListener.cacheKey(cacheServices), func() string {
+		return ranchListener.HTTPSendRancherListRequest(ranchListener.api().URL("services"))
+	})
 
-	socketConnectionLogsContainer(urlAndToken, f.Name())
+	var services []Service
+	err := rancher.DecodeCollection(resp, &services)
 
-	return f.Name()
+	return services, err
 }
 
-func socketConnectionLogsContainer(urlAndToken string, fileName string) {
-	conn := &evtwebsocket.Conn{
-		OnConnected: func(w *evtwebsocket.Conn) {
-			log.Println("[INFO] Conectado no WebSocket!")
-		},
+// ListStacks é uma função que busca as stacks do Environment
+func (ranchListener *RancherListener) ListStacks() ([]Stack, error) {
+	resp := rancherCache.Get(ranchListener.cacheKey(cacheStacks), func() string {
+		return ranchListener.HTTPSendRancherListRequest(ranchListener.api().URL("stacks"))
+	})
 
-		OnMessage: func(msg []byte, w *evtwebsocket.Conn) {
-			verifyExists, err := os.Open(fileName)
+	var stacks []Stack
+	err := rancher.DecodeCollection(resp, &stacks)
 
-			if err == nil {
-				WriteOnFile(fileName, string(msg))
-			}
+	return stacks, err
+}
 
-			defer verifyExists.Close()
-		},
+// ListCertificates é a função que retorna o JSON (em string) com os
+// certificados cadastrados no Environment
+func (ranchListener *RancherListener) ListCertificates() string {
+	return ranchListener.HTTPSendRancherListRequest(ranchListener.api().URL("certificates"))
+}
 
-		OnError: func(err error) {
-			log.Printf("[ERROR] %s\n", err.Error())
-			os.Exit(1)
-		},
-	}
+// ListHosts é a função que retorna o JSON (em string) com os hosts do
+// Environment, incluindo o uso de CPU, memória e disco em info
+func (ranchListener *RancherListener) ListHosts() string {
+	return ranchListener.HTTPSendRancherListRequest(ranchListener.api().URL("hosts"))
+}
 
-	conn.Dial(urlAndToken, "")
+// ListCachedHosts é igual ao ListHosts, mas usando o cache (ex.: no status,
+// que não precisa do uso de recursos atual)
+func (ranchListener *RancherListener) ListCachedHosts() string {
+	return rancherCache.Get(ranchListener.cacheKey(cacheHosts), ranchListener.ListHosts)
 }
 
-// DisableCanary é a função que envia a requisição para a API do
-// Rancher com a intenção de comentar todas as linhas do haproxy.cfg
-func (ranchListener *RancherListener) DisableCanary(ID string) string {
-	responseString := ranchListener.GetHaproxyCfg(ID)
-	actualLbConfig := gjson.Get(responseString, "lbConfig.config").String()
+// ListHostContainers é a função que retorna o JSON (em string) com os
+// containers em execução no host
+func (ranchListener *RancherListener) ListHostContainers(hostID string) string {
+	return ranchListener.HTTPSendRancherListRequest(ranchListener.api().URL("hosts/%s/instances?state=running", hostID))
+}
 
-	if actualLbConfig == "" {
-		return "error"
+// ContainerStatsWebSocketURL é a função que pede para o Rancher o acesso às
+// estatísticas dos containers do host, retornando a URL do WebSocket com o token
+func (ranchListener *RancherListener) ContainerStatsWebSocketURL(hostID string) string {
+	access, err := ranchListener.api().ContainerStats(ranchListener.context(), hostID)
+	if err != nil {
+		CheckErr("Erro ao pedir as estatísticas dos containers do host "+hostID, err)
+		return ""
 	}
 
-	scanner := bufio.NewScanner(strings.NewReader(actualLbConfig))
+	return access.WebSocketURL()
+}
 
-	newLbConfig := ""
+// EvacuateHost é a função que tira todos os containers do host, que são
+// recriados nos demais hosts, retornando o novo estado do host
+func (ranchListener *RancherListener) EvacuateHost(hostID string) string {
+	var host rancher.Host
+	err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("hosts/%s?action=evacuate", hostID), nil, &host)
+	ranchListener.invalidateCache(cacheContainers)
+	CheckErr("Erro ao evacuar o host "+hostID, err)
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	return host.State
+}
 
-		if strings.Contains(line, "#") {
-			newLbConfig += fmt.Sprintf("%s\n", line)
-		} else {
-			newLbConfig += fmt.Sprintf("#%s\n", line)
-		}
+// LogsWebSocketURL é a função que pede para o Rancher o acesso aos logs do container,
+// retornando a URL do WebSocket já com o token
+func (ranchListener *RancherListener) LogsWebSocketURL(containerID string, follow bool, lines int) string {
+	access, err := ranchListener.api().ContainerLogs(ranchListener.context(), containerID, follow, lines)
+	if err != nil {
+		CheckErr("Erro ao pedir os logs do container "+containerID, err)
+		return ""
 	}
 
-	responseString, err := sjson.Set(responseString, "lbConfig.config", newLbConfig)
-	CheckErr("Erro ao setar novo Custom haproxy.cfg no JSON", err)
+	return access.WebSocketURL()
+}
+
+// ContainerLogsReader abre o WebSocket de logs do container e retorna as
+// últimas linhas em um io.ReadCloser, que termina quando o Rancher fecha a
+// conexão depois da última linha. Fechar o reader fecha o WebSocket
+func (ranchListener *RancherListener) ContainerLogsReader(containerID string, lines int) (io.ReadCloser, error) {
+	urlAndToken := ranchListener.LogsWebSocketURL(containerID, false, lines)
 
-	url := fmt.Sprintf("%s/%s/loadBalancerServices/%s", ranchListener.baseURL, ranchListener.projectID, ID)
-	resp := ranchListener.HTTPSendRancherRequest(url, PutHTTP, responseString)
+	conn, _, err := websocket.DefaultDialer.DialContext(ranchListener.context(), urlAndToken, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	return gjson.Get(resp, "lbConfig.config").String()
+	reader, writer := io.Pipe()
+
+	go func() {
+		defer conn.Close()
+
+		for {
+			conn.SetReadDeadline(time.Now().Add(RancherTimeout))
+
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
+					writer.Close()
+				} else {
+					writer.CloseWithError(fmt.Errorf("erro nos logs do container %s: %s", containerID, err))
+				}
+				return
+			}
+
+			if _, err := writer.Write(msg); err != nil {
+				return
+			}
+		}
+	}()
+
+	return reader, nil
 }
 
-// EnableCanary é a função que retira os "#" de todo o haproxy.cfg
-// depois envia como PUT para a API do Rancher
-func (ranchListener *RancherListener) EnableCanary(ID string) string {
-	responseString := ranchListener.GetHaproxyCfg(ID)
-	actualLbConfig := gjson.Get(responseString, "lbConfig.config").String()
+// DisableCanary é a função que envia a requisição para a API do
+// Rancher com a intenção de comentar todas as linhas do haproxy.cfg
+func (ranchListener *RancherListener) DisableCanary(ID string) string {
+	return ranchListener.editHaproxyCfg(ID, func(actualLbConfig string) (string, error) {
+		if actualLbConfig == "" {
+			return "", errNoHaproxyCfg
+		}
 
-	if actualLbConfig == "" {
-		return "error"
-	}
+		scanner := bufio.NewScanner(strings.NewReader(actualLbConfig))
+
+		newLbConfig := ""
 
-	actualLbConfig = strings.Replace(actualLbConfig, "#", "", -1)
+		for scanner.Scan() {
+			line := scanner.Text()
 
-	responseString, err := sjson.Set(responseString, "lbConfig.config", actualLbConfig)
-	CheckErr("Erro ao setar novo Custom haproxy.cfg no JSON", err)
+			if strings.Contains(line, "#") {
+				newLbConfig += fmt.Sprintf("%s\n", line)
+			} else {
+				newLbConfig += fmt.Sprintf("#%s\n", line)
+			}
+		}
 
-	url := fmt.Sprintf("%s/%s/loadBalancerServices/%s", ranchListener.baseURL, ranchListener.projectID, ID)
-	resp := ranchListener.HTTPSendRancherRequest(url, PutHTTP, responseString)
+		return newLbConfig, nil
+	})
+}
+
+// EnableCanary é a função que retira os "#" de todo o haproxy.cfg
+// depois envia como PUT para a API do Rancher
+func (ranchListener *RancherListener) EnableCanary(ID string) string {
+	return ranchListener.editHaproxyCfg(ID, func(actualLbConfig string) (string, error) {
+		if actualLbConfig == "" {
+			return "", errNoHaproxyCfg
+		}
 
-	return gjson.Get(resp, "lbConfig.config").String()
+		return strings.Replace(actualLbConfig, "#", "", -1), nil
+	})
 }
 
 // UpdateCustomHaproxyCfg Edita o lbConfig.config do LB
@@ -215,73 +389,99 @@ func (ranchListener *RancherListener) UpdateCustomHaproxyCfg(ID string, newPerce
 	}
 
 	ranchListener.EnableCanary(ID)
-	responseString := ranchListener.GetHaproxyCfg(ID)
-	actualLbConfig := gjson.Get(responseString, "lbConfig.config").String()
 
-	if actualLbConfig == "" {
-		return "error"
-	}
-
-	scanner := bufio.NewScanner(strings.NewReader(actualLbConfig))
-
-	var firstWeight string
-	var secondWeight string
-	var newLbConfig string
+	return ranchListener.editHaproxyCfg(ID, func(actualLbConfig string) (string, error) {
+		if actualLbConfig == "" {
+			return "", errNoHaproxyCfg
+		}
 
-	for scanner.Scan() {
-		if line := strings.Split(scanner.Text(), "weight "); len(line) >= 2 {
-			if firstWeight == "" {
-				firstWeight = line[1]
-				newLbConfig = strings.Replace(actualLbConfig, fmt.Sprintf("weight %s", firstWeight), fmt.Sprintf("weightpeso01 %s", newPercent), 1)
-			} else {
-				secondWeight = line[1]
-				newLbConfig = strings.Replace(newLbConfig, fmt.Sprintf("weight %s", secondWeight), fmt.Sprintf("weightpeso02 %s", oldPercent), 1)
+		scanner := bufio.NewScanner(strings.NewReader(actualLbConfig))
+
+		var firstWeight string
+		var secondWeight string
+		var newLbConfig string
+
+		for scanner.Scan() {
+			if line := strings.Split(scanner.Text(), "weight "); len(line) >= 2 {
+				if firstWeight == "" {
+					firstWeight = line[1]
+					newLbConfig = strings.Replace(actualLbConfig, fmt.Sprintf("weight %s", firstWeight), fmt.Sprintf("weightpeso01 %s", newPercent), 1)
+				} else {
+					secondWeight = line[1]
+					newLbConfig = strings.Replace(newLbConfig, fmt.Sprintf("weight %s", secondWeight), fmt.Sprintf("weightpeso02 %s", oldPercent), 1)
+				}
 			}
 		}
-	}
 
-	newLbConfig = strings.Replace(newLbConfig, "weightpeso01", "weight", 1)
-	newLbConfig = strings.Replace(newLbConfig, "weightpeso02", "weight", 1)
+		newLbConfig = strings.Replace(newLbConfig, "weightpeso01", "weight", 1)
+		newLbConfig = strings.Replace(newLbConfig, "weightpeso02", "weight", 1)
 
-	responseString, err := sjson.Set(responseString, "lbConfig.config", newLbConfig)
-	CheckErr("Erro ao setar novo Custom haproxy.cfg no JSON", err)
+		return newLbConfig, nil
+	})
+}
 
-	url := fmt.Sprintf("%s/%s/loadBalancerServices/%s", ranchListener.baseURL, ranchListener.projectID, ID)
-	resp := ranchListener.HTTPSendRancherRequest(url, PutHTTP, responseString)
+// SetHaproxyCfg substitui todo o Custom haproxy.cfg do LoadBalancer pelo
+// conteúdo passado como parâmetro
+func (ranchListener *RancherListener) SetHaproxyCfg(ID string, config string) string {
+	return ranchListener.editHaproxyCfg(ID, func(string) (string, error) {
+		return config, nil
+	})
+}
 
-	return gjson.Get(resp, "lbConfig.config").String()
+// editHaproxyCfg troca o Custom haproxy.cfg do LoadBalancer pelo retorno do
+// edit e salva o estado do Canary, retornando o novo haproxy.cfg ou "error".
+// Só o SetHaproxyCfg aceita LoadBalancers sem haproxy.cfg, as alterações do
+// Canary precisam do bloco atual
+func (ranchListener *RancherListener) editHaproxyCfg(ID string, edit func(config string) (string, error)) string {
+	lb, err := ranchListener.api().SetLoadBalancerConfig(ranchListener.context(), ID, edit)
+	ranchListener.invalidateCache(cacheLoadBalancers)
+	if err != nil {
+		CheckErr("Erro ao alterar o Custom haproxy.cfg do LoadBalancer "+ID, err)
+		return "error"
+	}
+
+	ranchListener.saveCanaryState(ID, lb.LbConfig.Config)
+
+	return lb.LbConfig.Config
 }
 
-// GetHaproxyCfg Busca a Custom haproxy.cfg do LoadBalancer enviado como parâmetro
-func (ranchListener *RancherListener) GetHaproxyCfg(containerID string) string {
-	url := fmt.Sprintf(ranchListener.baseURL + "/" + ranchListener.projectID + "/loadBalancerServices/" + containerID)
-	resp := ranchListener.HTTPSendRancherRequest(url, GetHTTP, "")
+// GetLoadBalancer busca o LoadBalancer com o Custom haproxy.cfg
+func (ranchListener *RancherListener) GetLoadBalancer(ID string) (*LoadBalancer, error) {
+	lb := &LoadBalancer{}
+	if err := ranchListener.api().Get(ranchListener.context(), "loadBalancerServices/"+ID, lb); err != nil {
+		return nil, err
+	}
 
-	if gjson.Get(resp, "id").String() != containerID {
+	if lb.ID != ID {
+		return nil, fmt.Errorf("LoadBalancer %s não encontrado", ID)
+	}
+
+	return lb, nil
+}
+
+// HaproxyConfig retorna o Custom haproxy.cfg do LoadBalancer, vazio caso o
+// LoadBalancer não seja encontrado
+func (ranchListener *RancherListener) HaproxyConfig(ID string) string {
+	lb, err := ranchListener.GetLoadBalancer(ID)
+	if err != nil {
 		return ""
 	}
 
-	return resp
+	return lb.LbConfig.Config
 }
 
 // GetLoadBalancers é a função responsável por trazer um slice
 // de LoadBalancer, que pode ser usado para selects na interface
 // do BOT do Slack
 func (ranchListener *RancherListener) GetLoadBalancers() []*LoadBalancer {
-	url := fmt.Sprintf("%s/%s/loadBalancerServices", ranchListener.baseURL, ranchListener.projectID)
-	resp := ranchListener.HTTPSendRancherRequest(url, GetHTTP, "")
+	resp := rancherCache.Get(ranchListener.cacheKey(cacheLoadBalancers), func() string {
+		return ranchListener.HTTPSendRancherListRequest(ranchListener.api().URL("loadBalancerServices"))
+	})
 
 	loadBalancersSlice := []*LoadBalancer{}
-
-	data := gjson.Get(resp, "data")
-	data.ForEach(func(key, value gjson.Result) bool {
-		lb := new(LoadBalancer)
-		lb.ID = value.Get("id").String()
-		lb.Name = value.Get("name").String()
-		loadBalancersSlice = append(loadBalancersSlice, lb)
-
-		return true
-	})
+	if err := rancher.DecodeCollection(resp, &loadBalancersSlice); err != nil {
+		CheckErr("Erro ao listar os LoadBalancers", err)
+	}
 
 	return loadBalancersSlice
 }
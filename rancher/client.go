@@ -0,0 +1,340 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+// Package rancher é o client da API do Rancher usado pelo BOT: os tipos das
+// respostas, a conversão delas e as chamadas que alteram os recursos sem
+// perder os campos que o BOT não conhece
+package rancher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// MaxPages é o limite de páginas seguidas em uma listagem, para não entrar
+// em loop caso o Rancher retorne sempre o mesmo link
+const MaxPages = 100
+
+// Requester envia a requisição para a API do Rancher e retorna o body da
+// resposta. O BOT implementa com as tentativas, o circuit breaker, o dry-run e
+// o sandbox
+type Requester interface {
+	Request(ctx context.Context, url string, method string, data string) (string, error)
+}
+
+// Client são as chamadas na API do Rancher de um Environment (projeto)
+type Client struct {
+	BaseURL   string
+	ProjectID string
+	Requester Requester
+}
+
+// URL retorna a URL do recurso no Environment (ex.: services/1s5)
+func (c *Client) URL(format string, args ...interface{}) string {
+	return fmt.Sprintf("%s/%s/%s", c.BaseURL, c.ProjectID, fmt.Sprintf(format, args...))
+}
+
+// Get busca o recurso no path e converte para v
+func (c *Client) Get(ctx context.Context, path string, v interface{}) error {
+	return c.send(ctx, http.MethodGet, path, nil, v)
+}
+
+// Post envia a ação ou a criação no path (ex.: containers/1i5?action=stop) e
+// converte a resposta para v. O body pode ser a string do JSON ou o valor
+// convertido para JSON, nil envia sem body
+func (c *Client) Post(ctx context.Context, path string, body interface{}, v interface{}) error {
+	return c.send(ctx, http.MethodPost, path, body, v)
+}
+
+// Put altera o recurso no path e converte a resposta para v
+func (c *Client) Put(ctx context.Context, path string, body interface{}, v interface{}) error {
+	return c.send(ctx, http.MethodPut, path, body, v)
+}
+
+func (c *Client) send(ctx context.Context, method string, path string, body interface{}, v interface{}) error {
+	var data string
+
+	switch payload := body.(type) {
+	case nil:
+	case string:
+		data = payload
+	default:
+		buf, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		data = string(buf)
+	}
+
+	resp, err := c.Requester.Request(ctx, c.URL("%s", path), method, data)
+	if err != nil {
+		return err
+	}
+
+	return DecodeResource(resp, v)
+}
+
+// page é uma página de uma coleção
+type page struct {
+	Data       []json.RawMessage `json:"data"`
+	Pagination struct {
+		Next string `json:"next"`
+	} `json:"pagination"`
+}
+
+// ListJSON busca a coleção na url seguindo os links de paginação
+// (pagination.next), retornando o JSON da primeira página com o data de todas
+// as páginas. Respostas que não são coleções são retornadas como vieram
+func (c *Client) ListJSON(ctx context.Context, url string) (string, error) {
+	resp, err := c.Requester.Request(ctx, url, http.MethodGet, "")
+	if err != nil {
+		return resp, err
+	}
+
+	var first page
+	if json.Unmarshal([]byte(resp), &first) != nil || first.Data == nil || first.Pagination.Next == "" {
+		return resp, nil
+	}
+
+	items := first.Data
+	next := first.Pagination.Next
+	for pages := 1; next != ""; pages++ {
+		if pages == MaxPages {
+			log.Printf("[ERROR] Listagem %s passou de %d páginas, usando só as primeiras\n", url, MaxPages)
+			break
+		}
+
+		var current page
+		body, err := c.Requester.Request(ctx, next, http.MethodGet, "")
+		if err != nil || json.Unmarshal([]byte(body), &current) != nil || current.Data == nil {
+			log.Printf("[ERROR] Página %s da listagem %s inválida, usando só as anteriores\n", next, url)
+			break
+		}
+
+		items = append(items, current.Data...)
+		next = current.Pagination.Next
+	}
+
+	return mergePages(resp, items)
+}
+
+// mergePages troca o data da primeira página pelos itens de todas as
+// páginas, sem o link para a próxima
+func mergePages(resp string, items []json.RawMessage) (string, error) {
+	var collection map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(resp), &collection); err != nil {
+		return resp, err
+	}
+
+	var pagination map[string]json.RawMessage
+	if err := json.Unmarshal(collection["pagination"], &pagination); err != nil {
+		return resp, err
+	}
+	delete(pagination, "next")
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return resp, err
+	}
+	collection["data"] = data
+
+	if collection["pagination"], err = json.Marshal(pagination); err != nil {
+		return resp, err
+	}
+
+	merged, err := json.Marshal(collection)
+	if err != nil {
+		return resp, err
+	}
+
+	return string(merged), nil
+}
+
+// serviceConfig é o serviço com a configuração completa dos containers,
+// para as chamadas que enviam a configuração de volta ao Rancher
+type serviceConfig struct {
+	ID                     string                 `json:"id"`
+	StackID                string                 `json:"stackId"`
+	Scale                  int                    `json:"scale"`
+	LaunchConfig           map[string]interface{} `json:"launchConfig"`
+	SecondaryLaunchConfigs []interface{}          `json:"secondaryLaunchConfigs"`
+}
+
+func (c *Client) serviceConfig(ctx context.Context, ID string) (*serviceConfig, error) {
+	service := &serviceConfig{}
+	if err := c.Get(ctx, "services/"+ID, service); err != nil {
+		return nil, err
+	}
+
+	if service.ID != ID || service.LaunchConfig == nil {
+		return nil, fmt.Errorf("serviço %s não encontrado", ID)
+	}
+
+	return service, nil
+}
+
+// inServiceStrategy é o upgrade do serviço com a nova configuração, feito
+// batchSize containers por vez
+type inServiceStrategy struct {
+	LaunchConfig   map[string]interface{} `json:"launchConfig"`
+	BatchSize      int                    `json:"batchSize"`
+	IntervalMillis int64                  `json:"intervalMillis"`
+}
+
+// UpgradeService faz o upgrade do serviço para a imagem, mantendo o resto da
+// configuração dos containers, com batchSize containers por vez e o interval
+// entre eles
+func (c *Client) UpgradeService(ctx context.Context, ID string, image string, batchSize int, interval time.Duration) (*Service, error) {
+	original, err := c.serviceConfig(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	original.LaunchConfig["imageUuid"] = image
+
+	request := struct {
+		InServiceStrategy inServiceStrategy `json:"inServiceStrategy"`
+	}{inServiceStrategy{
+		LaunchConfig:   original.LaunchConfig,
+		BatchSize:      batchSize,
+		IntervalMillis: int64(interval / time.Millisecond),
+	}}
+
+	service := &Service{}
+	if err := c.Post(ctx, fmt.Sprintf("services/%s?action=upgrade", ID), request, service); err != nil {
+		return nil, err
+	}
+
+	return service, nil
+}
+
+// CloneService cria na mesma stack um serviço com a configuração do serviço
+// (escala e launchConfigs), com outro nome e outra imagem
+func (c *Client) CloneService(ctx context.Context, ID string, name string, image string) (*Service, error) {
+	original, err := c.serviceConfig(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	original.LaunchConfig["imageUuid"] = image
+
+	request := struct {
+		Type                   string                 `json:"type"`
+		Name                   string                 `json:"name"`
+		StackID                string                 `json:"stackId"`
+		Scale                  int                    `json:"scale"`
+		StartOnCreate          bool                   `json:"startOnCreate"`
+		LaunchConfig           map[string]interface{} `json:"launchConfig"`
+		SecondaryLaunchConfigs []interface{}          `json:"secondaryLaunchConfigs,omitempty"`
+	}{"service", name, original.StackID, original.Scale, true, original.LaunchConfig, original.SecondaryLaunchConfigs}
+
+	service := &Service{}
+	if err := c.Post(ctx, "services", request, service); err != nil {
+		return nil, err
+	}
+
+	return service, nil
+}
+
+// updateLoadBalancer aplica o update no lbConfig do LoadBalancer e envia o
+// LoadBalancer completo de volta, com os campos que o BOT não conhece
+func (c *Client) updateLoadBalancer(ctx context.Context, ID string, update func(lbConfig map[string]interface{}) error) (*LoadBalancer, error) {
+	var resource map[string]interface{}
+	if err := c.Get(ctx, "loadBalancerServices/"+ID, &resource); err != nil {
+		return nil, err
+	}
+
+	if resource["id"] != ID {
+		return nil, fmt.Errorf("LoadBalancer %s não encontrado", ID)
+	}
+
+	lbConfig, _ := resource["lbConfig"].(map[string]interface{})
+	if lbConfig == nil {
+		lbConfig = map[string]interface{}{}
+		resource["lbConfig"] = lbConfig
+	}
+
+	if err := update(lbConfig); err != nil {
+		return nil, err
+	}
+
+	lb := &LoadBalancer{}
+	if err := c.Put(ctx, "loadBalancerServices/"+ID, resource, lb); err != nil {
+		return nil, err
+	}
+
+	return lb, nil
+}
+
+// SetLoadBalancerConfig troca o Custom haproxy.cfg do LoadBalancer pelo
+// retorno do edit, que recebe o haproxy.cfg atual
+func (c *Client) SetLoadBalancerConfig(ctx context.Context, ID string, edit func(config string) (string, error)) (*LoadBalancer, error) {
+	return c.updateLoadBalancer(ctx, ID, func(lbConfig map[string]interface{}) error {
+		current, _ := lbConfig["config"].(string)
+
+		config, err := edit(current)
+		if err != nil {
+			return err
+		}
+		lbConfig["config"] = config
+
+		return nil
+	})
+}
+
+// SetLoadBalancerTarget troca o serviço de destino das regras do
+// LoadBalancer de from para to em uma única alteração, retornando quantas
+// regras foram trocadas
+func (c *Client) SetLoadBalancerTarget(ctx context.Context, ID string, from string, to string) (int, error) {
+	changed := 0
+
+	_, err := c.updateLoadBalancer(ctx, ID, func(lbConfig map[string]interface{}) error {
+		rules, _ := lbConfig["portRules"].([]interface{})
+		for _, item := range rules {
+			if rule, ok := item.(map[string]interface{}); ok && rule["serviceId"] == from {
+				rule["serviceId"] = to
+				changed++
+			}
+		}
+
+		if changed == 0 {
+			return fmt.Errorf("nenhuma regra do LoadBalancer %s aponta para o serviço %s", ID, from)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return changed, nil
+}
+
+// ContainerLogs pede o acesso ao WebSocket dos logs do container, com as
+// últimas lines linhas e, com o follow, as novas
+func (c *Client) ContainerLogs(ctx context.Context, containerID string, follow bool, lines int) (*HostAccess, error) {
+	request := struct {
+		Follow bool `json:"follow"`
+		Lines  int  `json:"lines"`
+	}{follow, lines}
+
+	access := &HostAccess{}
+	if err := c.Post(ctx, fmt.Sprintf("containers/%s?action=logs", containerID), request, access); err != nil {
+		return nil, err
+	}
+
+	return access, nil
+}
+
+// ContainerStats pede o acesso ao WebSocket das estatísticas dos containers
+// do host
+func (c *Client) ContainerStats(ctx context.Context, hostID string) (*HostAccess, error) {
+	access := &HostAccess{}
+	if err := c.Get(ctx, fmt.Sprintf("hosts/%s/containerstats", hostID), access); err != nil {
+		return nil, err
+	}
+
+	return access, nil
+}
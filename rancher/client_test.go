@@ -0,0 +1,176 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package rancher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeRequester responde com as respostas gravadas por método e URL e guarda
+// as requisições enviadas
+type fakeRequester struct {
+	responses map[string]string
+	sent      map[string]string
+}
+
+func (f *fakeRequester) Request(ctx context.Context, url string, method string, data string) (string, error) {
+	key := method + " " + url
+	if f.sent == nil {
+		f.sent = map[string]string{}
+	}
+	f.sent[key] = data
+
+	resp, ok := f.responses[key]
+	if !ok {
+		return "", fmt.Errorf("sem resposta para %s", key)
+	}
+
+	return resp, nil
+}
+
+func testClient(responses map[string]string) (*Client, *fakeRequester) {
+	requester := &fakeRequester{responses: responses}
+	return &Client{BaseURL: "http://rancher/v2-beta/projects", ProjectID: "1a5", Requester: requester}, requester
+}
+
+func TestListJSONPagination(t *testing.T) {
+	client, _ := testClient(map[string]string{
+		"GET http://rancher/v2-beta/projects/1a5/services": `{"type": "collection", "data": [{"id": "1s1"}],
+			"pagination": {"limit": 1, "next": "http://rancher/page2"}}`,
+		"GET http://rancher/page2": `{"type": "collection", "data": [{"id": "1s2"}], "pagination": {"limit": 1}}`,
+	})
+
+	resp, err := client.ListJSON(context.Background(), client.URL("services"))
+	if err != nil {
+		t.Fatalf("ListJSON: %s", err)
+	}
+
+	var services []Service
+	if err := DecodeCollection(resp, &services); err != nil {
+		t.Fatalf("DecodeCollection das páginas: %s", err)
+	}
+	if len(services) != 2 || services[0].ID != "1s1" || services[1].ID != "1s2" {
+		t.Errorf("páginas juntadas erradas: %+v", services)
+	}
+
+	var merged page
+	json.Unmarshal([]byte(resp), &merged)
+	if merged.Pagination.Next != "" {
+		t.Errorf("o JSON juntado manteve o pagination.next %s", merged.Pagination.Next)
+	}
+}
+
+func TestSetLoadBalancerTarget(t *testing.T) {
+	lb := `{"id": "1s20", "type": "loadBalancerService", "name": "lb", "scale": 2, "accountId": 9007199254740993,
+		"lbConfig": {"config": "global", "portRules": [
+			{"sourcePort": 80, "targetPort": 8080, "protocol": "http", "serviceId": "1s5"},
+			{"sourcePort": 443, "targetPort": 8443, "protocol": "https", "serviceId": "1s6"}]}}`
+
+	client, requester := testClient(map[string]string{
+		"GET http://rancher/v2-beta/projects/1a5/loadBalancerServices/1s20": lb,
+		"PUT http://rancher/v2-beta/projects/1a5/loadBalancerServices/1s20": lb,
+	})
+
+	changed, err := client.SetLoadBalancerTarget(context.Background(), "1s20", "1s5", "1s7")
+	if err != nil {
+		t.Fatalf("SetLoadBalancerTarget: %s", err)
+	}
+	if changed != 1 {
+		t.Errorf("regras trocadas = %d, esperado 1", changed)
+	}
+
+	var sent struct {
+		AccountID json.Number `json:"accountId"`
+		Scale     int         `json:"scale"`
+		LbConfig  struct {
+			Config    string `json:"config"`
+			PortRules []struct {
+				TargetPort int    `json:"targetPort"`
+				Protocol   string `json:"protocol"`
+				ServiceID  string `json:"serviceId"`
+			} `json:"portRules"`
+		} `json:"lbConfig"`
+	}
+	if err := json.Unmarshal([]byte(requester.sent["PUT http://rancher/v2-beta/projects/1a5/loadBalancerServices/1s20"]), &sent); err != nil {
+		t.Fatalf("PUT enviado inválido: %s", err)
+	}
+
+	rules := sent.LbConfig.PortRules
+	if len(rules) != 2 || rules[0].ServiceID != "1s7" || rules[1].ServiceID != "1s6" {
+		t.Errorf("regras enviadas erradas: %+v", rules)
+	}
+	if rules[0].TargetPort != 8080 || rules[0].Protocol != "http" || sent.LbConfig.Config != "global" || sent.Scale != 2 {
+		t.Errorf("o PUT perdeu os campos do LoadBalancer: %+v", sent)
+	}
+	if sent.AccountID != "9007199254740993" {
+		t.Errorf("accountId enviado %s, esperado 9007199254740993", sent.AccountID)
+	}
+}
+
+func TestSetLoadBalancerTargetWithoutRules(t *testing.T) {
+	client, requester := testClient(map[string]string{
+		"GET http://rancher/v2-beta/projects/1a5/loadBalancerServices/1s20": `{"id": "1s20", "type": "loadBalancerService",
+			"lbConfig": {"portRules": [{"sourcePort": 80, "serviceId": "1s6"}]}}`,
+	})
+
+	if _, err := client.SetLoadBalancerTarget(context.Background(), "1s20", "1s5", "1s7"); err == nil {
+		t.Fatal("SetLoadBalancerTarget sem regras para o serviço não retornou erro")
+	}
+	if _, sent := requester.sent["PUT http://rancher/v2-beta/projects/1a5/loadBalancerServices/1s20"]; sent {
+		t.Error("SetLoadBalancerTarget enviou o PUT sem nenhuma regra trocada")
+	}
+}
+
+func TestUpgradeService(t *testing.T) {
+	client, requester := testClient(map[string]string{
+		"GET http://rancher/v2-beta/projects/1a5/services/1s5": serviceResponse,
+		"POST http://rancher/v2-beta/projects/1a5/services/1s5?action=upgrade": `{"id": "1s5", "type": "service",
+			"state": "upgrading", "launchConfig": {"imageUuid": "docker:payments:1.5.0"}}`,
+	})
+
+	service, err := client.UpgradeService(context.Background(), "1s5", "docker:payments:1.5.0", 2, 3*time.Second)
+	if err != nil {
+		t.Fatalf("UpgradeService: %s", err)
+	}
+	if service.State != "upgrading" || service.LaunchConfig.ImageUUID != "docker:payments:1.5.0" {
+		t.Errorf("serviço retornado errado: %+v", service)
+	}
+
+	var sent struct {
+		InServiceStrategy struct {
+			LaunchConfig   LaunchConfig `json:"launchConfig"`
+			BatchSize      int          `json:"batchSize"`
+			IntervalMillis int64        `json:"intervalMillis"`
+		} `json:"inServiceStrategy"`
+	}
+	if err := json.Unmarshal([]byte(requester.sent["POST http://rancher/v2-beta/projects/1a5/services/1s5?action=upgrade"]), &sent); err != nil {
+		t.Fatalf("upgrade enviado inválido: %s", err)
+	}
+
+	strategy := sent.InServiceStrategy
+	if strategy.LaunchConfig.ImageUUID != "docker:payments:1.5.0" || strategy.LaunchConfig.Labels["team"] != "billing" || strategy.LaunchConfig.Memory != 536870912 {
+		t.Errorf("launchConfig enviado errado: %+v", strategy.LaunchConfig)
+	}
+	if strategy.BatchSize != 2 || strategy.IntervalMillis != 3000 {
+		t.Errorf("estratégia enviada errada: batchSize=%d intervalMillis=%d", strategy.BatchSize, strategy.IntervalMillis)
+	}
+}
+
+func TestContainerLogs(t *testing.T) {
+	client, _ := testClient(map[string]string{
+		"POST http://rancher/v2-beta/projects/1a5/containers/1i9?action=logs": `{"type": "hostAccess", "url": "ws://host/logs", "token": "abc"}`,
+	})
+
+	access, err := client.ContainerLogs(context.Background(), "1i9", false, 100)
+	if err != nil {
+		t.Fatalf("ContainerLogs: %s", err)
+	}
+	if access.WebSocketURL() != "ws://host/logs?token=abc" {
+		t.Errorf("URL do WebSocket %s", access.WebSocketURL())
+	}
+}
@@ -0,0 +1,98 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package rancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrEmptyResponse é o erro das chamadas que não tiveram resposta (timeout,
+// erro de conexão ou circuito aberto)
+var ErrEmptyResponse = errors.New("sem resposta do Rancher")
+
+// APIError é o erro retornado pela API do Rancher (type "error")
+type APIError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Detail  string `json:"detail"`
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Rancher retornou %d: %s", e.Status, e.Code)
+	}
+
+	return fmt.Sprintf("Rancher retornou %d: %s (%s)", e.Status, e.Code, e.Message)
+}
+
+// envelope são os campos comuns de todas as respostas do Rancher
+type envelope struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// DecodeResource converte a resposta de um recurso do Rancher (ex.: um
+// serviço) para v, retornando o erro da API caso a resposta seja um erro
+func DecodeResource(resp string, v interface{}) error {
+	env, err := decodeEnvelope(resp)
+	if err != nil {
+		return err
+	}
+
+	if env.Type == "collection" {
+		return errors.New("resposta do Rancher é uma coleção, não um recurso")
+	}
+
+	return decodeJSON([]byte(resp), v)
+}
+
+// DecodeCollection converte o data de uma coleção do Rancher (ex.: lista de
+// serviços) para v, que deve ser um ponteiro para slice
+func DecodeCollection(resp string, v interface{}) error {
+	env, err := decodeEnvelope(resp)
+	if err != nil {
+		return err
+	}
+
+	if env.Type != "collection" || len(env.Data) == 0 {
+		return fmt.Errorf("resposta do Rancher não é uma coleção: %s", env.Type)
+	}
+
+	return decodeJSON(env.Data, v)
+}
+
+func decodeEnvelope(resp string) (*envelope, error) {
+	if resp == "" {
+		return nil, ErrEmptyResponse
+	}
+
+	var env envelope
+	if err := json.Unmarshal([]byte(resp), &env); err != nil {
+		return nil, fmt.Errorf("resposta inválida do Rancher: %s", err)
+	}
+
+	if env.Type == "error" {
+		apiErr := &APIError{}
+		if err := json.Unmarshal([]byte(resp), apiErr); err != nil {
+			return nil, fmt.Errorf("resposta inválida do Rancher: %s", err)
+		}
+		return nil, apiErr
+	}
+
+	return &env, nil
+}
+
+// decodeJSON converte mantendo os números dos campos sem tipo como
+// json.Number, para os recursos enviados de volta ao Rancher não mudarem
+// (ex.: IDs e limites de memória grandes)
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	return decoder.Decode(v)
+}
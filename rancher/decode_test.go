@@ -0,0 +1,109 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package rancher
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	serviceResponse = `{"id": "1s5", "type": "service", "name": "payments", "state": "active", "scale": 2,
+		"launchConfig": {"imageUuid": "docker:payments:1.4.0", "labels": {"team": "billing"}, "memory": 536870912}}`
+
+	servicesResponse = `{"type": "collection", "resourceType": "service", "data": [
+		{"id": "1s5", "type": "service", "name": "payments"},
+		{"id": "1s6", "type": "service", "name": "orders"}]}`
+
+	errorResponse = `{"id": "1s9", "type": "error", "status": 404, "code": "NotFound", "message": "Service not found"}`
+)
+
+func TestDecodeResource(t *testing.T) {
+	var service Service
+	if err := DecodeResource(serviceResponse, &service); err != nil {
+		t.Fatalf("DecodeResource: %s", err)
+	}
+
+	if service.ID != "1s5" || service.Name != "payments" || service.Scale != 2 {
+		t.Errorf("serviço convertido errado: %+v", service)
+	}
+	if service.LaunchConfig.ImageUUID != "docker:payments:1.4.0" || service.LaunchConfig.Labels["team"] != "billing" {
+		t.Errorf("launchConfig convertido errado: %+v", service.LaunchConfig)
+	}
+	if service.LaunchConfig.Memory != 536870912 {
+		t.Errorf("memory = %d, esperado 536870912", service.LaunchConfig.Memory)
+	}
+}
+
+func TestDecodeResourceCollection(t *testing.T) {
+	var service Service
+	err := DecodeResource(servicesResponse, &service)
+	if err == nil || !strings.Contains(err.Error(), "coleção") {
+		t.Fatalf("DecodeResource de uma coleção retornou %v, esperado o erro da coleção", err)
+	}
+}
+
+func TestDecodeCollection(t *testing.T) {
+	var services []Service
+	if err := DecodeCollection(servicesResponse, &services); err != nil {
+		t.Fatalf("DecodeCollection: %s", err)
+	}
+
+	if len(services) != 2 || services[0].ID != "1s5" || services[1].Name != "orders" {
+		t.Errorf("coleção convertida errada: %+v", services)
+	}
+}
+
+func TestDecodeCollectionResource(t *testing.T) {
+	var services []Service
+	err := DecodeCollection(serviceResponse, &services)
+	if err == nil || !strings.Contains(err.Error(), "não é uma coleção: service") {
+		t.Fatalf("DecodeCollection de um recurso retornou %v, esperado o erro do recurso", err)
+	}
+}
+
+func TestDecodeErrorEnvelope(t *testing.T) {
+	decoders := map[string]func(string, interface{}) error{
+		"DecodeResource":   DecodeResource,
+		"DecodeCollection": DecodeCollection,
+	}
+
+	for name, decode := range decoders {
+		var service Service
+		err := decode(errorResponse, &service)
+
+		apiErr, ok := err.(*APIError)
+		if !ok {
+			t.Errorf("%s retornou %v, esperado o *APIError", name, err)
+			continue
+		}
+
+		if apiErr.Status != 404 || apiErr.Code != "NotFound" || apiErr.Message != "Service not found" {
+			t.Errorf("%s converteu o erro errado: %+v", name, apiErr)
+		}
+		if apiErr.Error() != "Rancher retornou 404: NotFound (Service not found)" {
+			t.Errorf("%s: mensagem do erro %q", name, apiErr.Error())
+		}
+	}
+}
+
+func TestDecodeEmptyResponse(t *testing.T) {
+	var service Service
+	if err := DecodeResource("", &service); err != ErrEmptyResponse {
+		t.Errorf("DecodeResource da resposta vazia retornou %v, esperado ErrEmptyResponse", err)
+	}
+
+	var services []Service
+	if err := DecodeCollection("", &services); err != ErrEmptyResponse {
+		t.Errorf("DecodeCollection da resposta vazia retornou %v, esperado ErrEmptyResponse", err)
+	}
+}
+
+func TestDecodeInvalidResponse(t *testing.T) {
+	var service Service
+	err := DecodeResource("<html>502 Bad Gateway</html>", &service)
+	if err == nil || !strings.Contains(err.Error(), "resposta inválida") {
+		t.Errorf("DecodeResource do HTML retornou %v, esperado resposta inválida", err)
+	}
+}
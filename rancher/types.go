@@ -0,0 +1,120 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package rancher
+
+import "fmt"
+
+// Service é um serviço do Rancher
+type Service struct {
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	Type           string            `json:"type"`
+	State          string            `json:"state"`
+	HealthState    string            `json:"healthState"`
+	StackID        string            `json:"stackId"`
+	Scale          int               `json:"scale"`
+	CurrentScale   int               `json:"currentScale"`
+	Created        string            `json:"created"`
+	LaunchConfig   LaunchConfig      `json:"launchConfig"`
+	LinkedServices map[string]string `json:"linkedServices"`
+	LbConfig       LbConfig          `json:"lbConfig"`
+}
+
+// LaunchConfig é a configuração dos containers de um serviço. Tem apenas os
+// campos usados pelo BOT, as ações que enviam a configuração de volta ao
+// Rancher (ex.: UpgradeService) usam o JSON original para não perder os demais
+type LaunchConfig struct {
+	ImageUUID           string            `json:"imageUuid"`
+	Labels              map[string]string `json:"labels"`
+	Environment         map[string]string `json:"environment"`
+	Memory              int64             `json:"memory"`
+	CPUQuota            int64             `json:"cpuQuota"`
+	CPUShares           int64             `json:"cpuShares"`
+	MilliCPUReservation int64             `json:"milliCpuReservation"`
+}
+
+// Container é um container do Rancher
+type Container struct {
+	ID                   string   `json:"id"`
+	Name                 string   `json:"name"`
+	State                string   `json:"state"`
+	HealthState          string   `json:"healthState"`
+	ImageUUID            string   `json:"imageUuid"`
+	ExternalID           string   `json:"externalId"`
+	HostID               string   `json:"hostId"`
+	PrimaryIPAddress     string   `json:"primaryIpAddress"`
+	MemoryReservation    int64    `json:"memoryReservation"`
+	MilliCPUReservation  int64    `json:"milliCpuReservation"`
+	ServiceIDs           []string `json:"serviceIds"`
+	StartCount           int64    `json:"startCount"`
+	Created              string   `json:"created"`
+	TransitioningMessage string   `json:"transitioningMessage"`
+}
+
+// ServiceID retorna o serviço do container, vazio para containers avulsos
+func (c Container) ServiceID() string {
+	if len(c.ServiceIDs) == 0 {
+		return ""
+	}
+
+	return c.ServiceIDs[0]
+}
+
+// LoadBalancer é um LoadBalancer do Rancher, com o Custom haproxy.cfg
+type LoadBalancer struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	State    string   `json:"state"`
+	LbConfig LbConfig `json:"lbConfig"`
+}
+
+// LbConfig é a configuração do LoadBalancer
+type LbConfig struct {
+	Config    string     `json:"config"`
+	PortRules []PortRule `json:"portRules"`
+}
+
+// PortRule é uma regra do LoadBalancer, que envia o tráfego da porta (e do
+// hostname e path, quando informados) para o serviço
+type PortRule struct {
+	SourcePort int    `json:"sourcePort"`
+	Hostname   string `json:"hostname"`
+	Path       string `json:"path"`
+	ServiceID  string `json:"serviceId"`
+}
+
+// Stack é uma stack do Rancher
+type Stack struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	State          string   `json:"state"`
+	HealthState    string   `json:"healthState"`
+	ServiceIDs     []string `json:"serviceIds"`
+	DockerCompose  string   `json:"dockerCompose"`
+	RancherCompose string   `json:"rancherCompose"`
+}
+
+// ComposeConfig é o docker-compose e o rancher-compose exportados da stack
+type ComposeConfig struct {
+	DockerComposeConfig  string `json:"dockerComposeConfig"`
+	RancherComposeConfig string `json:"rancherComposeConfig"`
+}
+
+// Host é um host do Rancher, com os campos retornados pelas ações
+type Host struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// HostAccess é o acesso a um WebSocket do Rancher (logs e estatísticas)
+type HostAccess struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+// WebSocketURL retorna a URL do WebSocket já com o token
+func (a HostAccess) WebSocketURL() string {
+	return fmt.Sprintf("%s?token=%s", a.URL, a.Token)
+}
@@ -0,0 +1,29 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import "github.com/pulberg/slack-bot/rancher"
+
+// Os tipos dos recursos ficam no package rancher. Os demais orquestradores
+// (ECS, Swarm e Kubernetes) retornam os mesmos tipos, usados pelos comandos
+// com os nomes abaixo
+type (
+	// Service é um serviço do Rancher
+	Service = rancher.Service
+
+	// LaunchConfig é a configuração dos containers de um serviço
+	LaunchConfig = rancher.LaunchConfig
+
+	// Container é um container do Rancher
+	Container = rancher.Container
+
+	// LoadBalancer é um LoadBalancer do Rancher, com o Custom haproxy.cfg
+	LoadBalancer = rancher.LoadBalancer
+
+	// LbConfig é a configuração do LoadBalancer
+	LbConfig = rancher.LbConfig
+
+	// Stack é uma stack do Rancher
+	Stack = rancher.Stack
+)
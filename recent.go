@@ -0,0 +1,184 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	actionRecentSelect = "recent-select"
+
+	// recentMaxTargets é a quantidade de alvos lembrados por usuário
+	recentMaxTargets = 10
+)
+
+// recentTargetKinds são as ações (callback_id dos menus ou nome dos botões)
+// que têm um serviço ou container como alvo, lembrados no menu do "recent"
+var recentTargetKinds = map[string]string{
+	restartContainer:       "container",
+	logsContainer:          "container",
+	streamLogs:             "container",
+	actionLogsRange:        "container",
+	actionContainerRestart: "container",
+	serviceLogs:            "serviço",
+	getServiceInfo:         "serviço",
+	scanService:            "serviço",
+	restartService:         "serviço",
+	actionServiceInfo:      "serviço",
+	actionServiceRestart:   "serviço",
+	actionFindServiceLogs:  "serviço",
+}
+
+// RecentTarget é um serviço ou container usado pelo usuário
+type RecentTarget struct {
+	Kind string
+	ID   string
+	At   time.Time
+}
+
+var (
+	recentTargets = map[string][]RecentTarget{}
+	recentMutex   sync.Mutex
+)
+
+// RecordRecentTarget coloca o alvo no topo da lista do usuário, guardando
+// no máximo recentMaxTargets
+func RecordRecentTarget(user string, kind string, ID string) {
+	recentMutex.Lock()
+	defer recentMutex.Unlock()
+
+	targets := []RecentTarget{{Kind: kind, ID: ID, At: time.Now()}}
+	for _, target := range recentTargets[user] {
+		if target.ID != ID && len(targets) < recentMaxTargets {
+			targets = append(targets, target)
+		}
+	}
+
+	recentTargets[user] = targets
+}
+
+// UserRecentTargets retorna os alvos usados pelo usuário, o mais recente
+// primeiro
+func UserRecentTargets(user string) []RecentTarget {
+	recentMutex.Lock()
+	defer recentMutex.Unlock()
+
+	return append([]RecentTarget{}, recentTargets[user]...)
+}
+
+// RecentMiddleware lembra o serviço ou container das ações executadas com
+// sucesso, para o menu do "recent"
+func RecentMiddleware(next InteractionHandler) InteractionHandler {
+	return func(w http.ResponseWriter, in *Interaction) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next(recorder, in)
+
+		kind, ok := recentTargetKinds[in.Key()]
+		if !ok || in.Refused != 0 || recorder.status >= http.StatusBadRequest || len(in.Message.Actions) == 0 {
+			return
+		}
+
+		value := in.Message.Actions[0].Value
+		if len(in.Message.Actions[0].SelectedOptions) > 0 {
+			value = in.Message.Actions[0].SelectedOptions[0].Value
+		}
+
+		// Os menus de logs levam as opções no valor (ex.: 1i123?lines=50)
+		ID, _ := DecodeLogsValue(value)
+		if ID != "" {
+			RecordRecentTarget(in.Message.User.ID, kind, ID)
+		}
+	}
+}
+
+// recentTargetName retorna o nome do alvo pelo índice de serviços ou pelo
+// cache de containers
+func recentTargetName(target RecentTarget) string {
+	if target.Kind == "serviço" {
+		return serviceIndex.Name(target.ID)
+	}
+
+	containers, err := rancherListener.ListContainers()
+	if err == nil {
+		for _, container := range containers {
+			if container.ID == target.ID {
+				return container.Name
+			}
+		}
+	}
+
+	return target.ID
+}
+
+// slackRecent envia o menu com os serviços e containers usados por último
+// pelo usuário, para repetir as ações sem buscar de novo nas listas
+func (s *SlackListener) slackRecent(ev *slack.MessageEvent) {
+	targets := UserRecentTargets(ev.Msg.User)
+	if len(targets) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText("Você ainda não usou nenhum serviço ou container pelos menus e botões do BOT", false))
+		return
+	}
+
+	var options []slack.AttachmentActionOption
+	for _, target := range targets {
+		options = append(options, slack.AttachmentActionOption{
+			Text:  truncateOption(fmt.Sprintf("%s %s (há %s)", target.Kind, recentTargetName(target), formatDuration(time.Since(target.At)))),
+			Value: target.Kind + "|" + target.ID,
+		})
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(slack.Attachment{
+		Text:       "Usados recentemente por você :clock3:",
+		Color:      "#0C648A",
+		CallbackID: recent,
+		Actions: []slack.AttachmentAction{
+			{
+				Name:    actionRecentSelect,
+				Text:    "Escolha",
+				Type:    "select",
+				Options: options,
+			},
+			{
+				Name:  actionCancel,
+				Text:  "Cancelar",
+				Type:  "button",
+				Style: "danger",
+			},
+		},
+	}))
+}
+
+// actionRecentSelectFunction troca o menu pelos botões de ação do alvo
+// escolhido, os mesmos do find
+func actionRecentSelectFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	if len(message.Actions[0].SelectedOptions) == 0 {
+		return
+	}
+
+	parts := strings.SplitN(message.Actions[0].SelectedOptions[0].Value, "|", 2)
+	if len(parts) != 2 {
+		return
+	}
+
+	result := findResult{kind: parts[0], id: parts[1]}
+	result.name = recentTargetName(RecentTarget{Kind: result.kind, ID: result.id})
+
+	getAPIConnection().client.UpdateMessage(message.Channel.ID, message.MessageTs, slack.MsgOptionAttachments(slack.Attachment{
+		Title:      fmt.Sprintf("%s %s", result.kind, result.name),
+		Footer:     result.id,
+		Color:      "#0C648A",
+		CallbackID: recent,
+		Actions:    findActions(result),
+	}))
+}
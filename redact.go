@@ -0,0 +1,105 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const redactedText = "[REDACTED]"
+
+var (
+	// LogsRedactFile é o arquivo com as regras de redação, uma regex por linha
+	LogsRedactFile string
+
+	// LogsRedactDefaults define se as regras padrão de redação são usadas
+	LogsRedactDefaults = true
+
+	// defaultRedactRules são as regras usadas para esconder os segredos mais
+	// comuns, quando existe o grupo "secret" apenas ele é substituído
+	defaultRedactRules = []string{
+		`(?i)(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key)["']?\s*[:=]\s*["']?(?P<secret>[^\s"'&,;]+)`,
+		`(?i)authorization:\s*(?:bearer|basic)\s+(?P<secret>[A-Za-z0-9\-._~+/=]+)`,
+		`\w+://[^:/\s]+:(?P<secret>[^@/\s]+)@`,
+		`AKIA[0-9A-Z]{16}`,
+		`xox[abprs]-[A-Za-z0-9-]+`,
+		`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`,
+	}
+
+	redactRules []*regexp.Regexp
+)
+
+// LoadRedactionRules é a função que compila as regras padrão e as regras do
+// arquivo configurado em LOGS_REDACT_FILE
+func LoadRedactionRules() {
+	var patterns []string
+
+	if LogsRedactDefaults {
+		patterns = append(patterns, defaultRedactRules...)
+	}
+
+	if LogsRedactFile != "" {
+		f, err := os.Open(LogsRedactFile)
+		CheckErr("Erro ao abrir o arquivo de regras de redação", err)
+
+		if err == nil {
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line != "" && !strings.HasPrefix(line, "#") {
+					patterns = append(patterns, line)
+				}
+			}
+			f.Close()
+		}
+	}
+
+	redactRules = nil
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			CheckErr("Regra de redação inválida: "+pattern, err)
+			continue
+		}
+
+		redactRules = append(redactRules, re)
+	}
+
+	log.Printf("[INFO] %d regras de redação de logs carregadas\n", len(redactRules))
+}
+
+// RedactText é a função que esconde os segredos encontrados no texto
+func RedactText(text string) string {
+	for _, re := range redactRules {
+		secret := re.SubexpIndex("secret")
+
+		if secret < 0 {
+			text = re.ReplaceAllString(text, redactedText)
+			continue
+		}
+
+		var result strings.Builder
+		last := 0
+
+		for _, match := range re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := match[2*secret], match[2*secret+1]
+			if start < 0 {
+				continue
+			}
+
+			result.WriteString(text[last:start])
+			result.WriteString(redactedText)
+			last = end
+		}
+
+		result.WriteString(text[last:])
+		text = result.String()
+	}
+
+	return text
+}
@@ -0,0 +1,367 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	registryCallback = "registry"
+
+	actionRegistryUpgrade = "registry-upgrade"
+)
+
+var (
+	// RegistryToken é o token que o registry deve enviar no webhook
+	RegistryToken string
+
+	// RegistryTrackedImages são as imagens (sem tag) acompanhadas pelo BOT.
+	// Caso vazio, qualquer imagem usada por um serviço do Rancher é acompanhada
+	RegistryTrackedImages []string
+
+	// RegistryUsername e RegistryPassword são as credenciais usadas para
+	// listar as tags das imagens nos registries privados
+	RegistryUsername string
+	RegistryPassword string
+)
+
+// registryMaxTags é a quantidade máxima de tags listadas de uma imagem
+const registryMaxTags = 100
+
+// UpgradeStrategy é quantas instâncias são atualizadas por vez no upgrade
+// e o intervalo entre cada lote
+type UpgradeStrategy struct {
+	BatchSize int
+	Interval  time.Duration
+}
+
+// defaultUpgradeStrategy é a estratégia padrão do Rancher
+var defaultUpgradeStrategy = UpgradeStrategy{BatchSize: 1, Interval: 2 * time.Second}
+
+// RegistryPush é uma nova tag enviada para o registry
+type RegistryPush struct {
+	Repository string
+	Tag        string
+	Pusher     string
+}
+
+// parseRegistryPushes lê os eventos de push do Docker Hub, do Harbor e do
+// Docker Registry (distribution)
+func parseRegistryPushes(body string) []RegistryPush {
+	var pushes []RegistryPush
+
+	switch {
+	case gjson.Get(body, "push_data").Exists():
+		// Docker Hub
+		pushes = append(pushes, RegistryPush{
+			Repository: gjson.Get(body, "repository.repo_name").String(),
+			Tag:        gjson.Get(body, "push_data.tag").String(),
+			Pusher:     gjson.Get(body, "push_data.pusher").String(),
+		})
+	case gjson.Get(body, "event_data").Exists():
+		// Harbor
+		if !strings.HasPrefix(gjson.Get(body, "type").String(), "PUSH") {
+			return nil
+		}
+
+		for _, resource := range gjson.Get(body, "event_data.resources").Array() {
+			repo := resource.Get("resource_url").String()
+			if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+				repo = repo[:i]
+			}
+
+			pushes = append(pushes, RegistryPush{
+				Repository: repo,
+				Tag:        resource.Get("tag").String(),
+				Pusher:     gjson.Get(body, "operator").String(),
+			})
+		}
+	default:
+		// Docker Registry (notifications)
+		for _, event := range gjson.Get(body, "events").Array() {
+			if event.Get("action").String() != "push" || event.Get("target.tag").String() == "" {
+				continue
+			}
+
+			pushes = append(pushes, RegistryPush{
+				Repository: event.Get("request.host").String() + "/" + event.Get("target.repository").String(),
+				Tag:        event.Get("target.tag").String(),
+				Pusher:     event.Get("actor.name").String(),
+			})
+		}
+	}
+
+	return pushes
+}
+
+// normalizeImage remove o prefixo "docker:", o registry padrão e a tag da
+// imagem, retornando a imagem e a tag separadas
+func normalizeImage(image string) (string, string) {
+	image = strings.TrimPrefix(image, "docker:")
+
+	tag := "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image, tag = image[:i], image[i+1:]
+	}
+
+	image = strings.TrimPrefix(image, "docker.io/")
+	image = strings.TrimPrefix(image, "index.docker.io/")
+	image = strings.TrimPrefix(image, "library/")
+
+	return image, tag
+}
+
+// imageWithTag troca a tag da imagem do serviço, mantendo o registry como está
+func imageWithTag(image string, tag string) string {
+	image = strings.TrimPrefix(image, "docker:")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+
+	return fmt.Sprintf("docker:%s:%s", image, tag)
+}
+
+// sameImage compara as imagens ignorando o host do registry quando apenas
+// uma delas o informa
+func sameImage(a string, b string) bool {
+	return a == b || strings.HasSuffix(a, "/"+b) || strings.HasSuffix(b, "/"+a)
+}
+
+func registryTracked(image string) bool {
+	if len(RegistryTrackedImages) == 0 {
+		return true
+	}
+
+	for _, tracked := range RegistryTrackedImages {
+		if trackedImage, _ := normalizeImage(tracked); sameImage(trackedImage, image) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ListImageTags lista as tags da imagem no registry, as mais novas primeiro
+// no Docker Hub. Nos registries privados (Docker Registry e Harbor) é usada a
+// API v2, que não informa as datas, então as tags são ordenadas pelo nome
+func ListImageTags(image string) ([]string, error) {
+	repo, _ := normalizeImage(image)
+
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		headers := map[string]string{}
+		if RegistryUsername != "" {
+			auth := base64.StdEncoding.EncodeToString([]byte(RegistryUsername + ":" + RegistryPassword))
+			headers["Authorization"] = "Basic " + auth
+		}
+
+		resp, err := HTTPSendJSONRequest(GetHTTP, fmt.Sprintf("https://%s/v2/%s/tags/list", parts[0], parts[1]), headers, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var tags []string
+		for _, tag := range gjson.Get(resp, "tags").Array() {
+			tags = append(tags, tag.String())
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(tags)))
+
+		if len(tags) > registryMaxTags {
+			tags = tags[:registryMaxTags]
+		}
+
+		return tags, nil
+	}
+
+	if !strings.Contains(repo, "/") {
+		repo = "library/" + repo
+	}
+
+	resp, err := HTTPSendJSONRequest(GetHTTP, fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/tags?page_size=%d&ordering=last_updated", repo, registryMaxTags), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, tag := range gjson.Get(resp, "results.#.name").Array() {
+		tags = append(tags, tag.String())
+	}
+
+	return tags, nil
+}
+
+// RegistryWebhook é o end-point que recebe os eventos de push do registry e
+// oferece o upgrade dos serviços do Rancher que usam a imagem
+func RegistryWebhook(w http.ResponseWriter, r *http.Request) {
+	if !ValidWebhookToken(r, RegistryToken) {
+		log.Println("[ERROR] Token inválido no webhook do registry")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil || !gjson.Valid(string(buf)) {
+		log.Printf("[ERROR] Erro ao ler o webhook do registry: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	pushes := parseRegistryPushes(string(buf))
+	if len(pushes) == 0 {
+		return
+	}
+
+	services, err := rancherListener.ListServices()
+	if err != nil {
+		CheckErr("Erro ao listar os serviços para o webhook do registry", err)
+		return
+	}
+
+	api := getAPIConnection()
+
+	for _, push := range pushes {
+		image, _ := normalizeImage(push.Repository)
+		if !registryTracked(image) {
+			continue
+		}
+
+		for _, service := range services {
+			current := service.LaunchConfig.ImageUUID
+			currentImage, currentTag := normalizeImage(current)
+
+			if !sameImage(currentImage, image) || currentTag == push.Tag {
+				continue
+			}
+
+			newImage := imageWithTag(current, push.Tag)
+
+			log.Printf("[INFO] Nova tag %s da imagem %s, usada pelo serviço %s\n", push.Tag, image, service.ID)
+			PostNotification(api.channelID, false, []slack.Attachment{registryAttachment(push, service.ID, service.Name, current, newImage)})
+		}
+	}
+}
+
+// registryAttachment monta a mensagem oferecendo o upgrade do serviço para a nova tag
+func registryAttachment(push RegistryPush, serviceID string, serviceName string, current string, newImage string) slack.Attachment {
+	text := fmt.Sprintf("O serviço *%s* (`%s`) usa `%s`", serviceName, serviceID, current)
+	if push.Pusher != "" {
+		text += fmt.Sprintf("\nEnviada por: %s", push.Pusher)
+	}
+
+	return slack.Attachment{
+		Title:      fmt.Sprintf(":whale: Nova imagem `%s:%s`", push.Repository, push.Tag),
+		Text:       text,
+		Color:      "#0C648A",
+		CallbackID: registryCallback,
+		Actions: []slack.AttachmentAction{
+			{
+				Name:  actionRegistryUpgrade,
+				Text:  fmt.Sprintf("Atualizar para %s", push.Tag),
+				Type:  "button",
+				Style: "primary",
+				Value: serviceID + "|" + newImage,
+				Confirm: &slack.ConfirmationField{
+					Title:       "Tem certeza disso?",
+					Text:        fmt.Sprintf("Deseja mesmo atualizar o serviço %s para a imagem %s? :thinking_face:", serviceName, newImage),
+					OkText:      "Sim",
+					DismissText: "Não",
+				},
+			},
+			{
+				Name:  actionCancel,
+				Text:  "Ignorar",
+				Type:  "button",
+				Style: "danger",
+			},
+		},
+	}
+}
+
+func actionRegistryUpgradeFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	value := strings.SplitN(message.Actions[0].Value, "|", 2)
+	if len(value) != 2 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	serviceID, newImage := value[0], value[1]
+
+	if err := CheckUpgradePolicy(serviceID, newImage); err != nil {
+		interactionFailed(w)
+		respondWithoutActions(w, message.OriginalMessage, ":no_entry: Upgrade bloqueado", err.Error())
+		return
+	}
+
+	user := message.User.Name
+
+	job, err := EnqueueServiceUpgrade(message.Channel.ID, serviceID, newImage, user)
+	interactionJob(w, job, err)
+	if err != nil {
+		respondWithoutActions(w, message.OriginalMessage, queuedJobMessage(job, err), "")
+		return
+	}
+
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":rocket: Upgrade iniciado por @%s", user), queuedJobMessage(job, nil))
+}
+
+// EnqueueServiceUpgrade coloca o upgrade do serviço na fila de jobs. O
+// andamento (instâncias já com a nova imagem) é mostrado em uma mensagem de
+// progresso no canal, que termina com o botão de desfazer
+func EnqueueServiceUpgrade(channel string, serviceID string, newImage string, user string) (*Job, error) {
+	return EnqueueServiceUpgradeStrategy(channel, "", serviceID, newImage, user, defaultUpgradeStrategy)
+}
+
+// EnqueueServiceUpgradeStrategy é o EnqueueServiceUpgrade com a estratégia
+// do upgrade. Com o ts, a mensagem já enviada é usada como progresso
+func EnqueueServiceUpgradeStrategy(channel string, ts string, serviceID string, newImage string, user string, strategy UpgradeStrategy) (*Job, error) {
+	return EnqueueJobContext("upgrade do serviço "+serviceID, user, func(ctx context.Context) (err error) {
+		started := time.Now()
+		defer func() {
+			RecordDeployAudit(auditDeploy, serviceID, newImage, user, started, err)
+		}()
+
+		title := fmt.Sprintf("*Upgrade* do serviço `%s` para `%s`, por @%s", serviceID, newImage, user)
+
+		var progress *Progress
+		if ts != "" {
+			progress = ResumeProgress(channel, ts, title, JobFromContext(ctx))
+		} else {
+			progress = StartProgress(channel, title, JobFromContext(ctx))
+		}
+
+		resp := rancherListener.UpgradeServiceWithStrategy(serviceID, newImage, strategy)
+		if resp == "" {
+			PageCritical(serviceID, fmt.Sprintf("Erro no upgrade do serviço %s para a imagem %s", serviceID, newImage), map[string]string{"usuario": user})
+			retry := slack.AttachmentAction{Name: actionRegistryUpgrade, Text: "Tentar de novo", Type: "button", Value: serviceID + "|" + newImage}
+			err := diagnoseServiceError(serviceID, registryCallback, retry, fmt.Errorf("erro no upgrade do serviço %s para a imagem %s", serviceID, newImage))
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		log.Printf("[INFO] Serviço %s atualizado para %s pelo usuário %s\n", serviceID, newImage, user)
+		RecordChange(ChangeEvent{Kind: "upgrade", ServiceID: serviceID, Image: resp, User: user})
+
+		if err := WaitServiceUpgrade(ctx, serviceID, resp, progress); err != nil {
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		progress.FinishWithUndo(true, fmt.Sprintf("Serviço atualizado com sucesso! A nova imagem é `%s`", resp), undoServiceUpgrade(serviceID))
+		return nil
+	})
+}
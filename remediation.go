@@ -0,0 +1,204 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+const actionCanaryConfig = "canary-config"
+
+// transitioningStates são os estados em que o Rancher não aceita novas
+// ações no serviço até a atual terminar
+var transitioningStates = []string{"upgrading", "restarting", "activating", "deactivating", "rolling-back", "updating-active", "updating-inactive", "removing"}
+
+// ActionError é a falha de uma ação com a causa encontrada, o que fazer e
+// as próximas ações sugeridas, enviadas como botões
+type ActionError struct {
+	Cause      string
+	Hint       string
+	CallbackID string
+	Actions    []slack.AttachmentAction
+}
+
+func (e *ActionError) Error() string {
+	return e.Cause
+}
+
+// Attachment monta a mensagem do erro com os botões sugeridos
+func (e *ActionError) Attachment(title string) slack.Attachment {
+	text := fmt.Sprintf("*Causa:* %s", e.Cause)
+	if e.Hint != "" {
+		text += fmt.Sprintf("\n*Sugestão:* %s", e.Hint)
+	}
+
+	return slack.Attachment{
+		Title:      title,
+		Text:       text,
+		Color:      "#D50200",
+		CallbackID: e.CallbackID,
+		Actions:    e.Actions,
+	}
+}
+
+// sendActionError envia a falha no canal do BOT, com a causa e os botões
+// quando o erro é um ActionError
+func sendActionError(title string, err error) {
+	if actionErr, ok := err.(*ActionError); ok {
+		api := getAPIConnection()
+		api.client.PostMessage(api.channelID, slack.MsgOptionAttachments(actionErr.Attachment(title)))
+		return
+	}
+
+	sendMessage(fmt.Sprintf("%s: %s", title, err))
+}
+
+// retryAction é o botão que repete a ação do menu (callback_id do
+// attachment) com o mesmo valor, passando pelas mesmas permissões
+func retryAction(value string) slack.AttachmentAction {
+	return slack.AttachmentAction{Name: actionSelect, Text: "Tentar de novo", Type: "button", Value: value}
+}
+
+// selectedValue retorna a opção escolhida no menu ou, no botão de tentar de
+// novo, o valor do botão
+func selectedValue(message slack.AttachmentActionCallback) string {
+	if len(message.Actions[0].SelectedOptions) > 0 {
+		return message.Actions[0].SelectedOptions[0].Value
+	}
+
+	return message.Actions[0].Value
+}
+
+// diagnoseServiceError descobre a causa da falha de uma ação no serviço
+// (Rancher fora do ar, serviço inexistente ou em transição) e sugere as
+// próximas ações: tentar de novo (retry, do menu callbackID), logs e info
+func diagnoseServiceError(serviceID string, callbackID string, retry slack.AttachmentAction, err error) error {
+	logs := slack.AttachmentAction{Name: actionFindServiceLogs, Text: "Ver logs", Type: "button", Value: serviceID}
+	info := slack.AttachmentAction{Name: actionServiceInfo, Text: "Info do serviço", Type: "button", Value: serviceID}
+
+	if err == ErrRancherUnavailable {
+		return &ActionError{
+			Cause:      err.Error(),
+			Hint:       "o canal é avisado quando o Rancher voltar a responder, tente de novo depois disso",
+			CallbackID: callbackID,
+			Actions:    []slack.AttachmentAction{retry},
+		}
+	}
+
+	service, getErr := orchestrator.GetService(serviceID)
+	if getErr != nil {
+		return &ActionError{
+			Cause: fmt.Sprintf("o serviço `%s` não foi encontrado (%s)", serviceID, getErr),
+			Hint:  fmt.Sprintf("procure o serviço pelo nome com o `%s`", find),
+		}
+	}
+
+	actionErr := &ActionError{
+		Cause:      fmt.Sprintf("%s (estado do serviço `%s`: `%s`)", errorText(err), service.Name, service.State),
+		Hint:       "veja os logs e as informações do serviço antes de tentar de novo",
+		CallbackID: callbackID,
+		Actions:    []slack.AttachmentAction{retry, logs, info},
+	}
+
+	switch {
+	case containsString(transitioningStates, service.State):
+		actionErr.Cause = fmt.Sprintf("o serviço `%s` está em `%s` e o Rancher não aceita outra ação até terminar", service.Name, service.State)
+		actionErr.Hint = "aguarde a ação atual terminar e tente de novo"
+	case service.State == "upgraded":
+		actionErr.Cause = fmt.Sprintf("o último upgrade do serviço `%s` não foi finalizado (estado `upgraded`)", service.Name)
+		actionErr.Hint = "finalize o upgrade no Rancher ou desfaça ele (botão desfazer da mensagem do upgrade) e tente de novo"
+	case service.State == "inactive":
+		actionErr.Cause = fmt.Sprintf("o serviço `%s` está inativo", service.Name)
+		actionErr.Hint = "ative o serviço no Rancher antes"
+		actionErr.Actions = []slack.AttachmentAction{info}
+	}
+
+	return actionErr
+}
+
+// errorText é o texto do erro, ou um texto genérico quando não há erro
+// (ex.: o Rancher respondeu vazio)
+func errorText(err error) string {
+	if err == nil {
+		return "o Rancher não aceitou a ação"
+	}
+
+	return err.Error()
+}
+
+// diagnoseCanaryError descobre a causa da falha no Canary do LB (Rancher fora
+// do ar, LB inexistente, sem o bloco do Canary ou pesos inválidos) e sugere as
+// próximas ações. Os pesos são verificados apenas quando informados
+func diagnoseCanaryError(lbID string, callbackID string, weights ...string) *ActionError {
+	config := slack.AttachmentAction{Name: actionCanaryConfig, Text: "Ver haproxy.cfg", Type: "button", Value: lbID}
+
+	var actions []slack.AttachmentAction
+	if callbackID != "" {
+		actions = append(actions, retryAction(lbID))
+	}
+
+	if endpoints := RancherUnavailableEndpoints(); len(endpoints) > 0 {
+		return &ActionError{
+			Cause:      ErrRancherUnavailable.Error(),
+			Hint:       "o canal é avisado quando o Rancher voltar a responder, tente de novo depois disso",
+			CallbackID: callbackID,
+			Actions:    actions,
+		}
+	}
+
+	if len(weights) == 2 {
+		newWeight, newErr := strconv.Atoi(weights[0])
+		oldWeight, oldErr := strconv.Atoi(weights[1])
+		if newErr != nil || oldErr != nil || newWeight+oldWeight != 100 {
+			return &ActionError{
+				Cause: fmt.Sprintf("os pesos `%s` e `%s` não somam 100", weights[0], weights[1]),
+				Hint:  fmt.Sprintf("use pesos que somem 100, ex.: `%s %s 10 90`", canaryUpdate, lbID),
+			}
+		}
+	}
+
+	lb, err := rancherListener.GetLoadBalancer(lbID)
+	if err != nil {
+		return &ActionError{
+			Cause: fmt.Sprintf("o LoadBalancer `%s` não foi encontrado", lbID),
+			Hint:  fmt.Sprintf("veja os IDs dos LoadBalancers com o `%s`", haproxyList),
+		}
+	}
+
+	lbConfig := lb.LbConfig.Config
+	if strings.TrimSpace(lbConfig) == "" {
+		return &ActionError{
+			Cause: fmt.Sprintf("o LoadBalancer `%s` não tem Custom haproxy.cfg, onde fica o bloco do Canary", lbID),
+			Hint:  "adicione no Custom haproxy.cfg do LB, no Rancher, o backend com as duas versões e o `weight` de cada uma",
+		}
+	}
+
+	if !strings.Contains(lbConfig, "weight ") {
+		return &ActionError{
+			Cause:   fmt.Sprintf("o Custom haproxy.cfg do LoadBalancer `%s` não tem o bloco do Canary (servidores com `weight`)", lbID),
+			Hint:    "adicione no Custom haproxy.cfg do LB o backend com as duas versões e o `weight` de cada uma",
+			Actions: []slack.AttachmentAction{config},
+		}
+	}
+
+	return &ActionError{
+		Cause:      fmt.Sprintf("o Rancher não aceitou a alteração do haproxy.cfg do LoadBalancer `%s`", lbID),
+		Hint:       "confira o haproxy.cfg atual e tente de novo",
+		CallbackID: callbackID,
+		Actions:    append(actions, config),
+	}
+}
+
+// actionCanaryConfigFunction envia o haproxy.cfg atual do LB
+func actionCanaryConfigFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	lbID := message.Actions[0].Value
+	sendMessage(fmt.Sprintf("Arquivo haproxy.cfg do LoadBalancer `%s`.\n```%s```", lbID, rancherListener.HaproxyConfig(lbID)))
+}
@@ -0,0 +1,280 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrMaintenance é o erro das ações recusadas pelo modo de manutenção
+var ErrMaintenance = errors.New("o BOT está em modo de manutenção")
+
+// InvalidArgsError é o erro de comando ou argumentos inválidos em um comando
+// remoto
+type InvalidArgsError struct {
+	Err error
+}
+
+func (e *InvalidArgsError) Error() string {
+	return e.Err.Error()
+}
+
+// RemoteCommand é um comando do BOT executado fora do Slack (API admin, gRPC
+// ou CLI), com os mesmos argumentos do comando no Slack
+type RemoteCommand struct {
+	Command string
+	Args    []string
+	Env     string
+	User    string
+	Source  string
+}
+
+// remoteCommandFunc executa o comando no orquestrador do ambiente, com os
+// argumentos já validados pelo commandSpecs
+type remoteCommandFunc func(o Orchestrator, args []string, user string) (*Job, error)
+
+// remoteCommands são os comandos do BOT que podem ser executados fora do
+// Slack. Todos viram jobs e o resultado é avisado no canal, como no Slack
+var remoteCommands = map[string]remoteCommandFunc{
+	restartService: remoteRestartService,
+	scaleService:   remoteScaleService,
+	upgradeService: remoteUpgradeService,
+	canaryActivate: remoteCanaryEnable,
+	canaryDisable:  remoteCanaryDisable,
+	canaryUpdate:   remoteCanaryUpdate,
+}
+
+// RemoteCommandNames retorna os comandos disponíveis fora do Slack
+func RemoteCommandNames() []string {
+	var names []string
+	for name := range remoteCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ExecuteRemoteCommand valida o comando com o commandSpecs (os mesmos
+// argumentos do Slack, inclusive os grupos como "canary enable"), respeita o
+// modo de manutenção, registra no audit e coloca a ação na fila de jobs,
+// avisando no canal quem pediu e por onde
+func ExecuteRemoteCommand(cmd RemoteCommand) (*Job, error) {
+	args := ParseCommandArgs(append([]string{cmd.Command}, cmd.Args...))
+
+	run, ok := remoteCommands[args.Command]
+	if !ok {
+		return nil, &InvalidArgsError{Err: fmt.Errorf("comando `%s` não disponível fora do Slack, use um de: %s", args.Command, strings.Join(RemoteCommandNames(), ", "))}
+	}
+
+	audit := AuditEntry{Source: cmd.Source, User: cmd.User, Action: args.Command, Value: strings.Join(args.Positional, " ")}
+
+	if err := args.Validate(); err != nil {
+		audit.Status = 400
+		RecordAudit(audit)
+		return nil, &InvalidArgsError{Err: err}
+	}
+
+	if MaintenanceBlocks(args.Command) {
+		audit.Status = 423
+		RecordAudit(audit)
+		return nil, ErrMaintenance
+	}
+
+	o, err := orchestratorFor(cmd.Env)
+	if err != nil {
+		return nil, &InvalidArgsError{Err: err}
+	}
+
+	job, err := run(o, args.Positional, cmd.User)
+	if err != nil {
+		audit.Status = 500
+		if _, invalid := err.(*InvalidArgsError); invalid {
+			audit.Status = 400
+		}
+		RecordAudit(audit)
+		return nil, err
+	}
+
+	audit.Status = 202
+	RecordAudit(audit)
+
+	log.Printf("[INFO] Comando %s pedido por %s via %s (job #%d)\n", args.Command, cmd.User, cmd.Source, job.ID)
+	sendMessage(fmt.Sprintf(":robot_face: %s pediu `%s %s` via %s (job #%d)", cmd.User, args.Command, strings.Join(args.Positional, " "), cmd.Source, job.ID))
+
+	return job, nil
+}
+
+// orchestratorFor retorna o orquestrador do ambiente, ou o atual quando o
+// ambiente não é informado
+func orchestratorFor(env string) (Orchestrator, error) {
+	if env == "" || env == orchestratorEnvironment {
+		return orchestrator, nil
+	}
+
+	o, ok := orchestrators[env]
+	if !ok {
+		return nil, fmt.Errorf("ambiente %s não configurado", env)
+	}
+
+	return o, nil
+}
+
+// resolveServiceIn busca o ID do serviço pelo nome ou ID no orquestrador. O
+// ambiente atual usa o índice de serviços, os demais a lista de serviços
+func resolveServiceIn(o Orchestrator, name string) (string, error) {
+	if o == orchestrator {
+		return serviceIndex.Resolve(name)
+	}
+
+	services, err := o.ListServices()
+	if err != nil {
+		return "", err
+	}
+
+	for _, service := range services {
+		if service.ID == name || strings.EqualFold(service.Name, name) {
+			return service.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("serviço `%s` não encontrado", name)
+}
+
+// remoteServiceArg resolve o serviço (nome ou ID) do primeiro argumento
+func remoteServiceArg(o Orchestrator, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", &InvalidArgsError{Err: errors.New("informe o serviço")}
+	}
+
+	serviceID, err := resolveServiceIn(o, args[0])
+	if err != nil {
+		return "", &InvalidArgsError{Err: err}
+	}
+
+	return serviceID, nil
+}
+
+// remoteRancherOnly recusa os comandos do Rancher em outros orquestradores
+func remoteRancherOnly(o Orchestrator, command string) error {
+	if o.Name() != "rancher" {
+		return &InvalidArgsError{Err: fmt.Errorf("`%s` só está disponível no Rancher", command)}
+	}
+
+	return nil
+}
+
+func remoteRestartService(o Orchestrator, args []string, user string) (*Job, error) {
+	serviceID, err := remoteServiceArg(o, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return EnqueueJob("restart do serviço "+serviceID, user, func() error {
+		return restartServiceIn(o, serviceID, user)
+	})
+}
+
+func remoteScaleService(o Orchestrator, args []string, user string) (*Job, error) {
+	serviceID, err := remoteServiceArg(o, args)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas, _ := strconv.Atoi(args[1])
+
+	return EnqueueJob("escala do serviço "+serviceID, user, func() error {
+		previous, err := o.GetService(serviceID)
+		CheckErr("Erro ao buscar a escala atual do serviço", err)
+
+		if err := o.ScaleService(serviceID, replicas); err != nil {
+			return fmt.Errorf("erro ao alterar a escala do serviço %s: %s", serviceID, err)
+		}
+
+		log.Printf("[INFO] Escala do serviço %s alterada para %d pelo usuário %s\n", serviceID, replicas, user)
+		RecordChange(ChangeEvent{Kind: "escala", ServiceID: serviceID, User: user})
+		msg := fmt.Sprintf("Serviço `%s` escalado para %d instâncias por %s :chart_with_upwards_trend:", serviceID, replicas, user)
+		if previous == nil {
+			sendMessage(msg)
+		} else {
+			sendMessageWithUndo(msg, undoServiceScale(o, serviceID, previous.Replicas))
+		}
+
+		return nil
+	})
+}
+
+func remoteUpgradeService(o Orchestrator, args []string, user string) (*Job, error) {
+	if err := remoteRancherOnly(o, upgradeService); err != nil {
+		return nil, err
+	}
+
+	serviceID, err := remoteServiceArg(o, args)
+	if err != nil {
+		return nil, err
+	}
+
+	image := args[1]
+	if !strings.HasPrefix(image, "docker:") {
+		return nil, &InvalidArgsError{Err: errors.New("o nome da imagem deve começar com 'docker:'. Ex.: docker:ubuntu:14.04")}
+	}
+
+	if err := CheckUpgradePolicy(serviceID, image); err != nil {
+		return nil, &InvalidArgsError{Err: fmt.Errorf("upgrade bloqueado: %s", err)}
+	}
+
+	return EnqueueServiceUpgrade(getAPIConnection().channelID, serviceID, image, user)
+}
+
+func remoteCanaryEnable(o Orchestrator, args []string, user string) (*Job, error) {
+	if err := remoteRancherOnly(o, canaryActivate); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, &InvalidArgsError{Err: errors.New("informe o ID do LoadBalancer")}
+	}
+
+	lbID := args[0]
+	return EnqueueJob("ativar canary do LB "+lbID, user, func() error {
+		return enableCanaryFunction(lbID)
+	})
+}
+
+func remoteCanaryDisable(o Orchestrator, args []string, user string) (*Job, error) {
+	if err := remoteRancherOnly(o, canaryDisable); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, &InvalidArgsError{Err: errors.New("informe o ID do LoadBalancer")}
+	}
+
+	lbID := args[0]
+	return EnqueueJob("desativar canary do LB "+lbID, user, func() error {
+		return disableCanaryFunction(lbID)
+	})
+}
+
+func remoteCanaryUpdate(o Orchestrator, args []string, user string) (*Job, error) {
+	if err := remoteRancherOnly(o, canaryUpdate); err != nil {
+		return nil, err
+	}
+
+	lbID, newWeight, oldWeight := args[0], args[1], args[2]
+	return EnqueueJob("pesos do canary do LB "+lbID, user, func() error {
+		previousCfg := rancherListener.HaproxyConfig(lbID)
+
+		resp := rancherListener.UpdateCustomHaproxyCfg(lbID, newWeight, oldWeight)
+		if resp == "error" {
+			return diagnoseCanaryError(lbID, "", newWeight, oldWeight)
+		}
+
+		sendMessageWithUndo(fmt.Sprintf("Arquivo 'haproxy.cfg' alterado por %s!\n```%s```", user, resp), undoHaproxyCfg(lbID, previousCfg))
+		return nil
+	})
+}
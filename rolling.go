@@ -0,0 +1,141 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// RollingRestartBatch é a quantidade de containers reiniciados por vez no
+// rolling restart, quando o batch=N não é informado
+var RollingRestartBatch = 1
+
+// rollingBatches divide os containers em lotes do tamanho informado
+func rollingBatches(containers []Container, size int) [][]Container {
+	var batches [][]Container
+	for size < len(containers) {
+		batches = append(batches, containers[:size])
+		containers = containers[size:]
+	}
+
+	return append(batches, containers)
+}
+
+// slackRollingRestart reinicia os containers do serviço em lotes, esperando
+// os healthchecks de cada lote antes do próximo
+func (s *SlackListener) slackRollingRestart(ev *slack.MessageEvent) {
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", rollingRestart), false))
+		return
+	}
+
+	size := RollingRestartBatch
+	if value, ok := args.Options["batch"]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`batch` deve ser um número maior que zero, recebido `%s`", value), false))
+			return
+		}
+		size = n
+	}
+
+	serviceID, ok := s.resolveServiceArg(ev.Channel, args.Positional[0])
+	if !ok {
+		return
+	}
+
+	instances, err := rancherListener.ListServiceInstances(serviceID)
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao buscar as instâncias do serviço `%s`: %s", serviceID, err), false))
+		return
+	}
+	if len(instances) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("O serviço `%s` não tem instâncias para reiniciar", serviceID), false))
+		return
+	}
+
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Name < instances[j].Name })
+
+	if s.dryRun != nil {
+		for _, instance := range instances {
+			s.rancher().RestartContainer(instance.ID)
+		}
+		s.finishDryRun(ev, rollingRestart)
+		return
+	}
+
+	channel, user := ev.Channel, ev.Msg.User
+	job, err := EnqueueJobContext("rolling restart do serviço "+serviceID, user, func(ctx context.Context) error {
+		return runRollingRestart(ctx, channel, serviceID, instances, size, user)
+	})
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(queuedJobMessage(job, err), false))
+	}
+}
+
+// runRollingRestart reinicia os lotes em sequência. O lote que não volta
+// saudável interrompe o restart, avisando no canal quais containers já
+// foram reiniciados
+func runRollingRestart(ctx context.Context, channel string, serviceID string, instances []Container, size int, user string) error {
+	name := serviceIndex.Name(serviceID)
+	batches := rollingBatches(instances, size)
+
+	title := fmt.Sprintf("*Rolling restart* do serviço `%s` em %d lotes de até %d containers, por @%s", name, len(batches), size, user)
+	progress := StartProgress(channel, title, JobFromContext(ctx))
+
+	restarted := 0
+	for i, batch := range batches {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("cancelado depois de %d/%d containers reiniciados", restarted, len(instances))
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		progress.Update(i, len(batches), "lotes reiniciados")
+
+		var names []string
+		for _, container := range batch {
+			names = append(names, container.Name)
+			if err := rancherListener.RestartContainer(container.ID); err != nil {
+				return abortRollingRestart(progress, serviceID, i+1, restarted, len(instances), fmt.Errorf("erro ao reiniciar o container %s: %s", container.Name, err))
+			}
+		}
+
+		for _, container := range batch {
+			if err := waitContainerRunning(ctx, container.ID); err != nil {
+				return abortRollingRestart(progress, serviceID, i+1, restarted, len(instances), err)
+			}
+			restarted++
+		}
+
+		log.Printf("[INFO] Rolling restart do serviço %s: lote %d/%d (%s) saudável\n", serviceID, i+1, len(batches), strings.Join(names, ", "))
+	}
+
+	RecordChange(ChangeEvent{Kind: "restart", ServiceID: serviceID, User: user})
+	log.Printf("[INFO] Rolling restart do serviço %s terminado pelo usuário %s\n", serviceID, user)
+	progress.Finish(true, fmt.Sprintf("%d containers reiniciados e saudáveis", restarted))
+
+	return nil
+}
+
+// abortRollingRestart interrompe o rolling restart, avisando no canal (e no
+// PagerDuty, quando configurado) o lote que não voltou
+func abortRollingRestart(progress *Progress, serviceID string, batch int, restarted int, total int, cause error) error {
+	err := fmt.Errorf("lote %d não voltou saudável, rolling restart interrompido com %d/%d containers reiniciados: %s", batch, restarted, total, cause)
+
+	PageCritical(serviceID, fmt.Sprintf("Rolling restart do serviço %s interrompido", serviceID), map[string]string{"erro": cause.Error()})
+	progress.Finish(false, err.Error())
+	sendMessage(fmt.Sprintf(":rotating_light: Rolling restart do serviço `%s` interrompido no lote %d: %s", serviceIndex.Name(serviceID), batch, cause))
+
+	return err
+}
@@ -0,0 +1,48 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRollingBatches(t *testing.T) {
+	containers := func(IDs ...string) []Container {
+		var list []Container
+		for _, ID := range IDs {
+			list = append(list, Container{ID: ID})
+		}
+		return list
+	}
+
+	tests := []struct {
+		containers []Container
+		size       int
+		batches    [][]string
+	}{
+		{containers("1i1"), 1, [][]string{{"1i1"}}},
+		{containers("1i1", "1i2", "1i3"), 1, [][]string{{"1i1"}, {"1i2"}, {"1i3"}}},
+		{containers("1i1", "1i2", "1i3", "1i4"), 2, [][]string{{"1i1", "1i2"}, {"1i3", "1i4"}}},
+		{containers("1i1", "1i2", "1i3", "1i4", "1i5"), 2, [][]string{{"1i1", "1i2"}, {"1i3", "1i4"}, {"1i5"}}},
+		{containers("1i1", "1i2"), 5, [][]string{{"1i1", "1i2"}}},
+	}
+
+	for _, test := range tests {
+		var batches [][]string
+		for _, batch := range rollingBatches(test.containers, test.size) {
+			var IDs []string
+			for _, container := range batch {
+				IDs = append(IDs, container.ID)
+			}
+			batches = append(batches, IDs)
+		}
+
+		name := fmt.Sprintf("%d containers em lotes de %d", len(test.containers), test.size)
+		if !reflect.DeepEqual(batches, test.batches) {
+			t.Errorf("%s: lotes %v, esperado %v", name, batches, test.batches)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+var (
+	// LogsS3Bucket é o bucket (S3 ou MinIO) onde ficam os logs grandes demais
+	// para o Slack, caso esteja vazio o envio para o S3 fica desativado
+	LogsS3Bucket string
+
+	// LogsS3Region é a região do bucket
+	LogsS3Region = "us-east-1"
+
+	// LogsS3Endpoint é o endereço do S3, usado para apontar para um MinIO
+	LogsS3Endpoint string
+
+	// LogsS3AccessKey é a chave de acesso ao bucket
+	LogsS3AccessKey string
+
+	// LogsS3SecretKey é a chave secreta de acesso ao bucket
+	LogsS3SecretKey string
+
+	// LogsS3URLExpiry é o tempo de validade do link gerado para o arquivo
+	LogsS3URLExpiry = 24 * time.Hour
+
+	// LogsSlackMaxSize é o tamanho máximo de arquivo enviado para o Slack, acima
+	// dele o arquivo vai para o bucket
+	LogsSlackMaxSize int64 = 100 << 20
+)
+
+// S3Enabled retorna se o envio de logs para o S3 está configurado
+func S3Enabled() bool {
+	return LogsS3Bucket != ""
+}
+
+func newS3Session() (*session.Session, error) {
+	config := &aws.Config{
+		Region: aws.String(LogsS3Region),
+	}
+
+	if LogsS3AccessKey != "" {
+		config.Credentials = credentials.NewStaticCredentials(LogsS3AccessKey, LogsS3SecretKey, "")
+	}
+
+	// O MinIO precisa do endpoint próprio e do bucket no path da URL
+	if LogsS3Endpoint != "" {
+		config.Endpoint = aws.String(LogsS3Endpoint)
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	return session.NewSession(config)
+}
+
+// UploadLogsToS3 é a função que envia o arquivo para o bucket e retorna um
+// link pré-assinado com a validade configurada
+func UploadLogsToS3(fileName string, body io.Reader) (string, error) {
+	sess, err := newS3Session()
+	if err != nil {
+		return "", err
+	}
+
+	key := fmt.Sprintf("logs/%s/%s", time.Now().Format("2006-01-02"), filepath.Base(fileName))
+
+	_, err = s3manager.NewUploader(sess).Upload(&s3manager.UploadInput{
+		Bucket: aws.String(LogsS3Bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, _ := s3.New(sess).GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(LogsS3Bucket),
+		Key:    aws.String(key),
+	})
+
+	return req.Presign(LogsS3URLExpiry)
+}
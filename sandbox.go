@@ -0,0 +1,394 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var (
+	// SandboxMode liga o sandbox: o BOT não chama o Rancher, as leituras são
+	// respondidas pelas gravações do SandboxDir e as alterações só registradas
+	SandboxMode bool
+
+	// SandboxDir é o diretório das gravações: as interações recebidas do Slack
+	// e as respostas do Rancher. Fora do sandbox, configurado, liga a gravação
+	SandboxDir string
+)
+
+// sandboxRancherFile é o arquivo, no SandboxDir, com as respostas do Rancher:
+// uma por linha, as mais novas valendo sobre as anteriores da mesma URL
+const sandboxRancherFile = "rancher.jsonl"
+
+// sandboxRancherEntry é uma linha do sandboxRancherFile
+type sandboxRancherEntry struct {
+	Key      string `json:"key"`
+	Response string `json:"response"`
+}
+
+// SandboxRecording é uma interação do Slack gravada para o replay
+type SandboxRecording struct {
+	ID         string    `json:"id"`
+	Key        string    `json:"key"`
+	User       string    `json:"user"`
+	ReceivedAt time.Time `json:"received_at"`
+	Body       string    `json:"body,omitempty"`
+}
+
+// sandboxReplayResult é a resposta do replay: a resposta do dispatcher, as
+// chamadas ao Rancher que alterariam algo e as chamadas à API do Slack
+type sandboxReplayResult struct {
+	Status     int           `json:"status"`
+	Response   string        `json:"response"`
+	Calls      []DryRunCall  `json:"rancher_calls"`
+	SlackCalls []string      `json:"slack_calls"`
+	Duration   time.Duration `json:"duration_ns"`
+}
+
+// sandboxReplayKey marca no contexto as requisições do replay, que não têm a
+// assinatura válida do Slack
+type sandboxReplayKey struct{}
+
+var (
+	sandboxRancher      map[string]string
+	sandboxRancherMutex sync.Mutex
+
+	// sandboxCalls registra as alterações feitas no sandbox, trocado a cada
+	// replay para responder só as chamadas dele
+	sandboxCalls      = &DryRun{}
+	sandboxCallsMutex sync.Mutex
+
+	sandboxReplayMutex sync.Mutex
+
+	// sandboxReplaying liga o stub do Slack enquanto o replay e os jobs
+	// colocados na fila por ele rodam, com as chamadas feitas nele em
+	// sandboxSlackCalls
+	sandboxReplaying  int32
+	sandboxSlackCalls []string
+	sandboxSlackMutex sync.Mutex
+)
+
+// sandboxRancherResponses carrega as respostas gravadas do Rancher
+func sandboxRancherResponses() map[string]string {
+	if sandboxRancher != nil {
+		return sandboxRancher
+	}
+
+	sandboxRancher = map[string]string{}
+	file, err := os.Open(filepath.Join(SandboxDir, sandboxRancherFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			CheckErr("Erro ao ler as respostas gravadas do Rancher", err)
+		}
+		return sandboxRancher
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry sandboxRancherEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			CheckErr("Erro ao ler uma resposta gravada do Rancher", err)
+			continue
+		}
+		sandboxRancher[entry.Key] = entry.Response
+	}
+	CheckErr("Erro ao ler as respostas gravadas do Rancher", scanner.Err())
+
+	return sandboxRancher
+}
+
+// recordSandboxRancher grava a resposta de uma leitura do Rancher, usada
+// depois pelo sandbox, no fim do arquivo quando ela mudou. As chaves são a URL
+// sem o endereço do Rancher
+func recordSandboxRancher(r *RancherListener, url string, resp string) {
+	if SandboxDir == "" || SandboxMode {
+		return
+	}
+
+	sandboxRancherMutex.Lock()
+	defer sandboxRancherMutex.Unlock()
+
+	responses := sandboxRancherResponses()
+	key := strings.TrimPrefix(url, r.baseURL)
+	if responses[key] == resp {
+		return
+	}
+	responses[key] = resp
+
+	line, err := json.Marshal(sandboxRancherEntry{Key: key, Response: resp})
+	if err != nil {
+		CheckErr("Erro ao gravar a resposta do Rancher", err)
+		return
+	}
+
+	file, err := os.OpenFile(filepath.Join(SandboxDir, sandboxRancherFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		CheckErr("Erro ao gravar a resposta do Rancher", err)
+		return
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	CheckErr("Erro ao gravar a resposta do Rancher", err)
+}
+
+// sandboxRancherRequest responde a requisição ao Rancher no sandbox: as
+// leituras com a resposta gravada e as alterações registradas como no dry-run
+func sandboxRancherRequest(r *RancherListener, url string, method string, data string) (string, error) {
+	if method != GetHTTP {
+		sandboxCallsMutex.Lock()
+		calls := sandboxCalls
+		sandboxCallsMutex.Unlock()
+
+		log.Printf("[INFO] Sandbox: %s %s não enviado ao Rancher\n", method, strings.TrimPrefix(url, r.baseURL))
+		return calls.recordRancher(r, url, method, data), nil
+	}
+
+	sandboxRancherMutex.Lock()
+	defer sandboxRancherMutex.Unlock()
+
+	key := strings.TrimPrefix(url, r.baseURL)
+	resp, ok := sandboxRancherResponses()[key]
+	if !ok {
+		return "", fmt.Errorf("sandbox sem resposta gravada para GET %s", key)
+	}
+
+	return resp, nil
+}
+
+// SandboxRecordMiddleware grava as interações recebidas do Slack no
+// SandboxDir, para serem repetidas depois pelo replay
+func SandboxRecordMiddleware(next InteractionHandler) InteractionHandler {
+	return func(w http.ResponseWriter, in *Interaction) {
+		if SandboxDir != "" && !sandboxReplay(in.Request) {
+			recording := SandboxRecording{
+				ID:         fmt.Sprintf("%d", time.Now().UnixNano()),
+				Key:        in.Key(),
+				User:       in.Message.User.Name,
+				ReceivedAt: time.Now(),
+				Body:       sandboxRecordBody(in.Body),
+			}
+
+			data, err := json.MarshalIndent(recording, "", "  ")
+			if err == nil {
+				err = ioutil.WriteFile(filepath.Join(SandboxDir, "interaction-"+recording.ID+".json"), data, 0644)
+			}
+			CheckErr("Erro ao gravar a interação "+recording.Key, err)
+		}
+
+		next(w, in)
+	}
+}
+
+// sandboxRecordBody é o body da interação sem o token de verificação do
+// Slack, que não é necessário no replay e não deve ficar nos arquivos
+func sandboxRecordBody(body []byte) string {
+	values, err := url.ParseQuery(string(body))
+	if err != nil || values.Get("payload") == "" {
+		return string(body)
+	}
+
+	payload, err := sjson.Delete(values.Get("payload"), "token")
+	if err != nil {
+		return string(body)
+	}
+	values.Set("payload", payload)
+
+	return values.Encode()
+}
+
+// sandboxSlackRequester é o client HTTP do Slack no sandbox: durante o replay
+// as chamadas não chegam no Slack, são respondidas com ok e registradas
+type sandboxSlackRequester struct {
+	client *http.Client
+}
+
+func (r sandboxSlackRequester) Do(req *http.Request) (*http.Response, error) {
+	if atomic.LoadInt32(&sandboxReplaying) == 0 {
+		return r.client.Do(req)
+	}
+
+	call := strings.TrimPrefix(req.URL.Path, "/api/")
+	if req.Body != nil {
+		body, _ := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if form, err := url.ParseQuery(string(body)); err == nil && form.Get("channel") != "" {
+			call += " " + form.Get("channel")
+		} else if channel := gjson.GetBytes(body, "channel").String(); channel != "" {
+			call += " " + channel
+		}
+	}
+
+	sandboxSlackMutex.Lock()
+	sandboxSlackCalls = append(sandboxSlackCalls, call)
+	sandboxSlackMutex.Unlock()
+	log.Printf("[INFO] Sandbox: %s não enviado ao Slack\n", call)
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"ok": true}`)),
+		Request:    req,
+	}, nil
+}
+
+// sandboxReplay retorna se a requisição é um replay do sandbox
+func sandboxReplay(r *http.Request) bool {
+	replay, _ := r.Context().Value(sandboxReplayKey{}).(bool)
+	return replay
+}
+
+// sandboxHold mantém os stubs ligados para um job colocado na fila durante o
+// replay, até o sandboxRelease no fim dele. Retorna false fora do replay
+func sandboxHold() bool {
+	for {
+		replaying := atomic.LoadInt32(&sandboxReplaying)
+		if replaying == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&sandboxReplaying, replaying, replaying+1) {
+			return true
+		}
+	}
+}
+
+// sandboxRelease libera os stubs do replay ou do job do replay que terminou
+func sandboxRelease() {
+	atomic.AddInt32(&sandboxReplaying, -1)
+}
+
+// loadSandboxRecording lê a interação gravada pelo ID
+func loadSandboxRecording(ID string) (*SandboxRecording, error) {
+	data, err := ioutil.ReadFile(filepath.Join(SandboxDir, "interaction-"+filepath.Base(ID)+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var recording SandboxRecording
+	if err := json.Unmarshal(data, &recording); err != nil {
+		return nil, err
+	}
+
+	return &recording, nil
+}
+
+// ReplaySandboxRecording envia a interação gravada para o dispatcher, com o
+// Rancher do sandbox. As chamadas retornadas são as feitas até o handler
+// responder, as dos jobs (que continuam no sandbox até terminarem) vão só
+// para o log
+func ReplaySandboxRecording(recording *SandboxRecording) sandboxReplayResult {
+	sandboxReplayMutex.Lock()
+	defer sandboxReplayMutex.Unlock()
+
+	calls := &DryRun{}
+	sandboxCallsMutex.Lock()
+	sandboxCalls = calls
+	sandboxCallsMutex.Unlock()
+
+	ctx := context.WithValue(context.Background(), sandboxReplayKey{}, true)
+	req := httptest.NewRequest(http.MethodPost, "/interaction", bytes.NewBufferString(recording.Body)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	sandboxSlackMutex.Lock()
+	sandboxSlackCalls = []string{}
+	sandboxSlackMutex.Unlock()
+
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	atomic.AddInt32(&sandboxReplaying, 1)
+	newInteractionDispatcher(SlackBotVerificationToken).ServeHTTP(recorder, req)
+	sandboxRelease()
+
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+	sandboxSlackMutex.Lock()
+	defer sandboxSlackMutex.Unlock()
+
+	return sandboxReplayResult{
+		Status:     recorder.Code,
+		Response:   recorder.Body.String(),
+		Calls:      append([]DryRunCall{}, calls.calls...),
+		SlackCalls: sandboxSlackCalls,
+		Duration:   time.Since(start),
+	}
+}
+
+// RegisterSandboxAPI adiciona as rotas das gravações na API admin
+func RegisterSandboxAPI(api *mux.Router) {
+	if SandboxDir == "" {
+		return
+	}
+
+	api.HandleFunc("/sandbox/recordings", AdminListSandboxRecordings).Methods("GET")
+	api.HandleFunc("/sandbox/recordings/{id}/replay", AdminReplaySandboxRecording).Methods("POST")
+}
+
+// AdminListSandboxRecordings lista as interações gravadas, sem o body
+func AdminListSandboxRecordings(w http.ResponseWriter, r *http.Request) {
+	files, err := filepath.Glob(filepath.Join(SandboxDir, "interaction-*.json"))
+	if err != nil {
+		adminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	recordings := []SandboxRecording{}
+	for _, file := range files {
+		ID := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "interaction-"), ".json")
+		recording, err := loadSandboxRecording(ID)
+		if err != nil {
+			CheckErr("Erro ao ler a gravação "+file, err)
+			continue
+		}
+		recording.Body = ""
+		recordings = append(recordings, *recording)
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].ReceivedAt.Before(recordings[j].ReceivedAt) })
+
+	adminJSON(w, http.StatusOK, recordings)
+}
+
+// AdminReplaySandboxRecording repete a interação gravada no dispatcher. Só
+// roda com o SANDBOX_MODE, para o replay não alterar o Rancher de verdade
+func AdminReplaySandboxRecording(w http.ResponseWriter, r *http.Request) {
+	ID := mux.Vars(r)["id"]
+
+	if !SandboxMode {
+		adminError(w, http.StatusConflict, "o replay só roda com o SANDBOX_MODE ativo")
+		return
+	}
+
+	recording, err := loadSandboxRecording(ID)
+	if err != nil {
+		adminError(w, http.StatusNotFound, fmt.Sprintf("gravação %s não encontrada", ID))
+		return
+	}
+
+	log.Printf("[INFO] Replay da interação %s (%s) pedido por %s\n", recording.ID, recording.Key, adminUser(r))
+	result := ReplaySandboxRecording(recording)
+	adminAudit(r, "sandbox replay", recording.ID, result.Status)
+
+	adminJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,340 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// scanTimeout é o tempo máximo esperando o scan da imagem terminar
+	scanTimeout = 10 * time.Minute
+
+	// scanPollInterval é o intervalo entre as consultas do resultado do scan
+	scanPollInterval = 10 * time.Second
+)
+
+// scanSeverities são as severidades do Trivy/Harbor, da mais grave para a menos grave
+var scanSeverities = []string{"Critical", "High", "Medium", "Low", "Unknown"}
+
+var (
+	// HarborURL é a URL do Harbor que guarda as imagens e executa os scans (Trivy/Clair)
+	HarborURL string
+
+	// HarborUser é o usuário (ou robot account) usado na API do Harbor
+	HarborUser string
+
+	// HarborPassword é a senha (ou secret do robot account) do usuário do Harbor
+	HarborPassword string
+
+	// HarborToken é o token que o Harbor deve enviar no webhook
+	HarborToken string
+
+	// ScanBlockSeverity é a severidade a partir da qual os upgrades são
+	// bloqueados (ex.: Critical ou High). Vazio desativa o bloqueio
+	ScanBlockSeverity string
+
+	// ScanDenyUnscanned bloqueia também as imagens do Harbor sem scan
+	// concluído com sucesso ou cujo scan não pôde ser consultado
+	ScanDenyUnscanned bool
+)
+
+// ScanResult é o resumo do scan de vulnerabilidades de uma imagem
+type ScanResult struct {
+	Image  string
+	Status string
+	Counts map[string]int64
+	URL    string
+}
+
+// harborArtifact separa a imagem no projeto, repositório e tag do Harbor.
+// Retorna false caso a imagem não esteja no Harbor configurado
+func harborArtifact(image string) (string, string, string, bool) {
+	u, err := url.Parse(HarborURL)
+	if HarborURL == "" || err != nil {
+		return "", "", "", false
+	}
+
+	image = strings.TrimPrefix(image, "docker:")
+	if !strings.HasPrefix(image, u.Host+"/") {
+		return "", "", "", false
+	}
+
+	image = strings.TrimPrefix(image, u.Host+"/")
+
+	tag := "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image, tag = image[:i], image[i+1:]
+	}
+
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) != 2 {
+		return "", "", "", false
+	}
+
+	return parts[0], parts[1], tag, true
+}
+
+func harborArtifactURL(project string, repo string, tag string) string {
+	// O Harbor exige o nome do repositório com as barras codificadas duas vezes
+	repo = url.PathEscape(url.PathEscape(repo))
+
+	return fmt.Sprintf("%s/api/v2.0/projects/%s/repositories/%s/artifacts/%s", HarborURL, project, repo, tag)
+}
+
+func harborHeaders() map[string]string {
+	auth := base64.StdEncoding.EncodeToString([]byte(HarborUser + ":" + HarborPassword))
+
+	return map[string]string{"Authorization": "Basic " + auth}
+}
+
+// ScanImage pede ao Harbor um novo scan da imagem
+func ScanImage(image string) error {
+	project, repo, tag, ok := harborArtifact(image)
+	if !ok {
+		return fmt.Errorf("a imagem %s não está no Harbor (%s)", image, HarborURL)
+	}
+
+	_, err := HTTPSendJSONRequest(PostHTTP, harborArtifactURL(project, repo, tag)+"/scan", harborHeaders(), nil)
+
+	return err
+}
+
+// GetScanResult busca no Harbor o resultado do último scan da imagem
+func GetScanResult(image string) (*ScanResult, error) {
+	project, repo, tag, ok := harborArtifact(image)
+	if !ok {
+		return nil, fmt.Errorf("a imagem %s não está no Harbor (%s)", image, HarborURL)
+	}
+
+	resp, err := HTTPSendJSONRequest(GetHTTP, harborArtifactURL(project, repo, tag)+"?with_scan_overview=true", harborHeaders(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScanResult{
+		Image:  strings.TrimPrefix(image, "docker:"),
+		Status: "Not Scanned",
+		Counts: map[string]int64{},
+		URL:    fmt.Sprintf("%s/harbor/projects/%s/repositories/%s", HarborURL, project, url.PathEscape(repo)),
+	}
+
+	// O scan_overview é indexado pelo mime type do relatório
+	gjson.Get(resp, "scan_overview").ForEach(func(key, report gjson.Result) bool {
+		result.Status = report.Get("scan_status").String()
+		report.Get("summary.summary").ForEach(func(severity, count gjson.Result) bool {
+			result.Counts[severity.String()] = count.Int()
+			return true
+		})
+		return false
+	})
+
+	return result, nil
+}
+
+// WaitScanResult espera o scan pedido pelo ScanImage terminar, por até
+// scanTimeout
+func WaitScanResult(image string) (*ScanResult, error) {
+	deadline := time.Now().Add(scanTimeout)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(scanPollInterval)
+
+		result, err := GetScanResult(image)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Finished() {
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("o scan da imagem %s não terminou em %s", image, formatDuration(scanTimeout))
+}
+
+// Finished retorna se o scan já terminou
+func (r *ScanResult) Finished() bool {
+	return r.Status == "Success" || r.Status == "Error" || r.Status == "Stopped"
+}
+
+// Summary retorna a quantidade de vulnerabilidades por severidade
+func (r *ScanResult) Summary() string {
+	var summary []string
+	for _, severity := range scanSeverities {
+		summary = append(summary, fmt.Sprintf("*%s:* %d", severity, r.Counts[severity]))
+	}
+
+	return strings.Join(summary, " | ")
+}
+
+// Blocked retorna se o resultado viola a política de ScanBlockSeverity
+func (r *ScanResult) Blocked() bool {
+	if ScanBlockSeverity == "" {
+		return false
+	}
+
+	for _, severity := range scanSeverities {
+		if r.Counts[severity] > 0 {
+			return true
+		}
+
+		if strings.EqualFold(severity, ScanBlockSeverity) {
+			break
+		}
+	}
+
+	return false
+}
+
+func (r *ScanResult) attachment() slack.Attachment {
+	color := "#36A64F"
+	switch {
+	case r.Blocked():
+		color = "#D50200"
+	case r.Counts["Critical"]+r.Counts["High"] > 0:
+		color = "#FFA500"
+	}
+
+	return slack.Attachment{
+		Title:     fmt.Sprintf(":mag: Scan da imagem `%s`: %s", r.Image, r.Status),
+		TitleLink: r.URL,
+		Text:      r.Summary(),
+		Color:     color,
+	}
+}
+
+// CheckImagePolicy verifica se o upgrade para a imagem é permitido pela
+// política de vulnerabilidades. Imagens fora do Harbor são liberadas, as sem
+// scan ou com erro na consulta só com o ScanDenyUnscanned desligado
+func CheckImagePolicy(image string) error {
+	if ScanBlockSeverity == "" {
+		return nil
+	}
+
+	if _, _, _, ok := harborArtifact(image); !ok {
+		return nil
+	}
+
+	result, err := GetScanResult(image)
+	if err != nil {
+		log.Printf("[ERROR] Erro ao buscar o scan da imagem %s: %s", image, err)
+		if ScanDenyUnscanned {
+			return fmt.Errorf("não foi possível consultar o scan da imagem `%s` no Harbor: %s", strings.TrimPrefix(image, "docker:"), err)
+		}
+		return nil
+	}
+
+	if ScanDenyUnscanned && result.Status != "Success" {
+		return fmt.Errorf("a imagem `%s` não tem um scan concluído no Harbor (%s), use o `%s` antes do upgrade", result.Image, result.Status, scanService)
+	}
+
+	if result.Blocked() {
+		return fmt.Errorf("a imagem `%s` tem vulnerabilidades de severidade %s ou maior (%s)", result.Image, ScanBlockSeverity, result.Summary())
+	}
+
+	return nil
+}
+
+func (s *SlackListener) slackScanService(ev *slack.MessageEvent) {
+	s.createAndSendAttachment(
+		ev,
+		"A imagem de qual serviço deseja escanear? :mag:",
+		scanService,
+		getServices(),
+		nil,
+	)
+}
+
+// actionScanService pede o scan da imagem atual do serviço e envia o
+// resultado quando o scan termina
+func actionScanService(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	serviceID := message.Actions[0].SelectedOptions[0].Value
+
+	service, err := orchestrator.GetService(serviceID)
+	if err != nil {
+		responseMessage(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao buscar o serviço `%s`", serviceID), err.Error())
+		return
+	}
+	image := service.Image
+
+	if err := ScanImage(image); err != nil {
+		CheckErr("Erro ao pedir scan da imagem", err)
+		responseMessage(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao escanear a imagem do serviço `%s`", serviceID), err.Error())
+		return
+	}
+
+	log.Printf("[INFO] Scan da imagem %s pedido pelo usuário %s\n", image, message.User.Name)
+	responseMessage(w, message.OriginalMessage, fmt.Sprintf(":mag: Escaneando a imagem `%s`...", strings.TrimPrefix(image, "docker:")), "")
+
+	go func() {
+		result, err := WaitScanResult(image)
+		if err != nil {
+			CheckErr("Erro ao buscar resultado do scan", err)
+			return
+		}
+
+		api := getAPIConnection()
+		api.client.PostMessage(message.Channel.ID, slack.MsgOptionAttachments(result.attachment()))
+	}()
+}
+
+// HarborWebhook é o end-point que recebe os eventos de scan concluído do
+// Harbor e envia o resumo das vulnerabilidades no canal do BOT
+func HarborWebhook(w http.ResponseWriter, r *http.Request) {
+	if !ValidWebhookToken(r, HarborToken) {
+		log.Println("[ERROR] Token inválido no webhook do Harbor")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil || !gjson.Valid(string(buf)) {
+		log.Printf("[ERROR] Erro ao ler o webhook do Harbor: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body := string(buf)
+	if gjson.Get(body, "type").String() != "SCANNING_COMPLETED" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var attachments []slack.Attachment
+	for _, resource := range gjson.Get(body, "event_data.resources").Array() {
+		result := &ScanResult{
+			Image:  resource.Get("resource_url").String(),
+			Status: "Success",
+			Counts: map[string]int64{},
+		}
+
+		resource.Get("scan_overview").ForEach(func(key, report gjson.Result) bool {
+			result.Status = report.Get("scan_status").String()
+			report.Get("summary.summary").ForEach(func(severity, count gjson.Result) bool {
+				result.Counts[severity.String()] = count.Int()
+				return true
+			})
+			return false
+		})
+
+		attachments = append(attachments, result.attachment())
+	}
+
+	if len(attachments) > 0 {
+		PostNotification(getAPIConnection().channelID, false, attachments)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,91 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	// HTTPMaxBodySize é o tamanho máximo do body das requisições recebidas
+	HTTPMaxBodySize int64 = 1 << 20
+
+	// HTTPReadTimeout é o tempo máximo para ler cada requisição recebida
+	HTTPReadTimeout = 30 * time.Second
+)
+
+// NewServer cria o servidor HTTP do BOT com os middlewares de recovery, log de
+// acesso e limite de body em todas as rotas
+func NewServer(router *mux.Router) *http.Server {
+	router.Use(RecoveryHTTPMiddleware, AccessLogMiddleware, MaxBodyMiddleware)
+
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logAccess(r, http.StatusNotFound, 0)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logAccess(r, http.StatusMethodNotAllowed, 0)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	})
+
+	return &http.Server{
+		Addr:              ":" + Port,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       HTTPReadTimeout,
+		MaxHeaderBytes:    1 << 16,
+	}
+}
+
+// AccessLogMiddleware registra no log cada requisição com o status e a latência
+func AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r)
+
+		logAccess(r, recorder.status, time.Since(start))
+	})
+}
+
+func logAccess(r *http.Request, status int, latency time.Duration) {
+	log.Printf("[INFO] %s %s %d %s %s\n", r.Method, r.URL.Path, status, latency.Round(time.Millisecond), r.RemoteAddr)
+}
+
+// RecoveryHTTPMiddleware responde 500 caso a rota entre em panic, sem derrubar
+// o BOT
+func RecoveryHTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("[ERROR] Panic em %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MaxBodyMiddleware recusa as requisições com body maior que HTTPMaxBodySize
+func MaxBodyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > HTTPMaxBodySize {
+			log.Printf("[ERROR] Body de %s %s maior que o limite (%s)\n", r.Method, r.URL.Path, FormatSize(r.ContentLength))
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// Sem Content-Length (chunked) a leitura falha ao passar do limite
+		r.Body = http.MaxBytesReader(w, r.Body, HTTPMaxBodySize)
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,159 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// serviceLogLine é uma linha de log de uma das instâncias do serviço
+type serviceLogLine struct {
+	time time.Time
+	text string
+}
+
+// collectServiceLogs busca ao mesmo tempo os logs de todas as instâncias do
+// serviço e junta em um único arquivo, ordenado pela data de cada linha
+func collectServiceLogs(serviceID string, opts LogsOptions) ([]byte, int, error) {
+	instances, err := rancherListener.ListServiceInstances(serviceID)
+	if err != nil {
+		return nil, 0, rancherFailure(cacheServices, fmt.Errorf("erro ao buscar as instâncias do serviço %s: %s", serviceID, err))
+	}
+
+	if len(instances) == 0 {
+		return nil, 0, fmt.Errorf("nenhuma instância encontrada para o serviço %s", serviceID)
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var merged []serviceLogLine
+
+	for _, instance := range instances {
+		wg.Add(1)
+
+		go func(containerID string, name string) {
+			defer wg.Done()
+
+			content, err := ContainerLogs(containerID, opts)
+			if err != nil {
+				CheckErr(fmt.Sprintf("Erro ao ler os logs do container %s", containerID), err)
+				return
+			}
+
+			lines := prefixInstanceLogs(content, name)
+
+			mutex.Lock()
+			merged = append(merged, lines...)
+			mutex.Unlock()
+		}(instance.ID, instance.Name)
+	}
+
+	wg.Wait()
+
+	return mergeServiceLogs(merged), len(instances), nil
+}
+
+// mergeServiceLogs ordena as linhas de todas as instâncias pela data, juntando
+// no conteúdo dos logs do serviço
+func mergeServiceLogs(merged []serviceLogLine) []byte {
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].time.Before(merged[j].time)
+	})
+
+	var buf bytes.Buffer
+	for _, line := range merged {
+		buf.WriteString(line.text + "\n")
+	}
+
+	return buf.Bytes()
+}
+
+// prefixInstanceLogs coloca o nome da instância no início de cada linha, as
+// linhas sem data (ex.: stack traces) ficam com a data da linha anterior
+// para não serem separadas na ordenação
+func prefixInstanceLogs(content string, name string) []serviceLogLine {
+	var lines []serviceLogLine
+	var last time.Time
+
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if t, ok := parseLogLine(line); ok {
+			last = t
+		}
+
+		lines = append(lines, serviceLogLine{
+			time: last,
+			text: fmt.Sprintf("[%s] %s", name, line),
+		})
+	}
+
+	return lines
+}
+
+func actionServiceLogs(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	value, opts := DecodeLogsValue(message.Actions[0].SelectedOptions[0].Value)
+
+	if opts.IsEmpty() {
+		opts.Lines = defaultLogsLines
+	}
+
+	channel, ts, user := message.Channel.ID, message.MessageTs, message.User.Name
+
+	job, err := EnqueueJobContext("logs do serviço "+value, user, func(ctx context.Context) error {
+		progress := ResumeProgress(channel, ts, fmt.Sprintf("*Logs* do serviço `%s` (%s), por @%s", value, opts.Describe(), user), JobFromContext(ctx))
+
+		if err := UploadServiceLogs(ctx, value, opts, progress); err != nil {
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		return nil
+	})
+
+	interactionJob(w, job, err)
+	responseMessage(w, message.OriginalMessage, queuedJobMessage(job, err), "")
+}
+
+// UploadServiceLogs busca os logs de todas as instâncias do serviço e envia
+// para o canal, mostrando as etapas no progress (que pode ser nil). Com o ctx
+// cancelado durante a busca os logs não são enviados
+func UploadServiceLogs(ctx context.Context, serviceID string, opts LogsOptions, progress *Progress) error {
+	progress.Update(0, 0, "buscando os logs das instâncias")
+
+	content, instances, err := orchestrator.ServiceLogs(serviceID, opts)
+	if err != nil {
+		return fmt.Errorf("erro ao buscar os logs do serviço %s: %s", serviceID, err)
+	}
+
+	if ctx.Err() != nil {
+		progress.Finish(false, "cancelado antes do envio dos logs")
+		return fmt.Errorf("logs de %d instâncias buscados, não enviados", instances)
+	}
+
+	fileName := fmt.Sprintf("logs-service-%s-%s.log", strings.Replace(serviceID, "/", "-", -1), time.Now().Format("20060102150405"))
+	title := fmt.Sprintf("Logs do serviço: %s - %d instâncias (%s)", serviceID, instances, opts.Describe())
+	uploads, summary := PrepareLogsUpload(fileName, content, title)
+
+	progress.Update(0, 0, fmt.Sprintf("enviando %s de logs de %d instâncias", formatBytes(len(content)), instances))
+
+	if _, err := uploadLogsFiles(uploads, summary); err != nil {
+		return fmt.Errorf("erro ao enviar os logs do serviço %s: %s", serviceID, err)
+	}
+
+	progress.Finish(true, fmt.Sprintf("%s de logs de %d instâncias enviados", formatBytes(len(content)), instances))
+
+	return nil
+}
@@ -0,0 +1,76 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShorthandPrefix é o prefixo dos atalhos digitados direto no canal, sem
+// mencionar o BOT (ex.: !restart payments). Vazio desliga os atalhos
+var ShorthandPrefix = "!"
+
+// shorthandCommands são os atalhos curtos dos comandos mais usados. Os nomes
+// completos dos comandos e os grupos do commandGroups também são aceitos com o
+// prefixo (ex.: !info-service, !canary enable lb-edge)
+var shorthandCommands = map[string]string{
+	"restart": restartService,
+	"logs":    serviceLogs,
+	"info":    getServiceInfo,
+	"scale":   scaleService,
+	"upgrade": upgradeService,
+	"stream":  streamLogs,
+}
+
+// shorthandGroupAliases mantêm os atalhos antigos com o nome de um grupo: sem
+// uma ação do grupo e com os argumentos do comando, o atalho segue para ele
+// (ex.: !canary lb-edge 25 75 é o update-canary)
+var shorthandGroupAliases = map[string]struct {
+	command string
+	args    int
+}{
+	"canary": {canaryUpdate, 3},
+}
+
+// expandShorthand converte o atalho no texto do comando mencionando o BOT,
+// como se tivesse sido digitado com a menção. Mensagens que não são atalhos
+// de comandos conhecidos (ex.: !importante) são ignoradas
+func expandShorthand(text string, botID string) (string, bool) {
+	if ShorthandPrefix == "" || !strings.HasPrefix(text, ShorthandPrefix) {
+		return "", false
+	}
+
+	args := strings.Fields(strings.TrimPrefix(text, ShorthandPrefix))
+	if len(args) == 0 {
+		return "", false
+	}
+
+	name := strings.ToLower(args[0])
+	command, ok := shorthandCommands[name]
+	if alias, aliased := shorthandGroupAliases[name]; aliased && len(args)-1 == alias.args {
+		if _, action := commandGroups[name][strings.ToLower(args[1])]; !action {
+			command, ok = alias.command, true
+		}
+	}
+	if !ok {
+		if _, group := commandGroups[name]; !group && !isCommand(name) {
+			return "", false
+		}
+		command = name
+	}
+
+	return fmt.Sprintf("<@%s> %s", botID, strings.Join(append([]string{command}, args[1:]...), " ")), true
+}
+
+// isCommand informa se o nome é de um comando ativo do BOT
+func isCommand(name string) bool {
+	for _, cmd := range Commands {
+		if cmd.Cmd == name && cmd.IsActive {
+			return true
+		}
+	}
+
+	return false
+}
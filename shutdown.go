@@ -0,0 +1,69 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ShutdownTimeout é o tempo máximo para terminar as ações em andamento quando
+// o BOT recebe o SIGTERM
+var ShutdownTimeout = 30 * time.Second
+
+var shuttingDown int32
+
+// ShuttingDown retorna se o BOT está sendo desligado, para não aceitar novas
+// interações
+func ShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+// Shutdown desliga o BOT sem interromper as ações em andamento: para de
+// aceitar interações, espera as requisições e os jobs terminarem (até o
+// ShutdownTimeout), fecha os streams de logs e os WebSockets e grava o arquivo
+// de log, que é o histórico das ações
+func Shutdown(server *http.Server, logFile *os.File) {
+	if !atomic.CompareAndSwapInt32(&shuttingDown, 0, 1) {
+		return
+	}
+
+	log.Printf("[INFO] Desligando o BOT, aguardando até %s pelas ações em andamento...\n", ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		CheckErr("Erro ao encerrar o servidor HTTP", err)
+	}
+
+	StopGRPCServer(ctx)
+
+	if pending := DrainJobs(ctx); pending > 0 {
+		log.Printf("[ERROR] %d jobs não terminaram antes do desligamento\n", pending)
+	}
+
+	if streams := StopAllLogStreams(ctx, "BOT desligado"); streams > 0 {
+		log.Printf("[INFO] %d streams de logs finalizados\n", streams)
+	}
+
+	ReleaseLeadership()
+
+	// Cancela as chamadas pendentes e fecha o WebSocket de eventos do Rancher
+	stopBotContext()
+
+	if IsLeader() {
+		sendMessage("Saindo para manutenção, volto já! :wave:")
+	}
+
+	log.Println("[INFO] BOT desligado")
+
+	if err := logFile.Sync(); err != nil {
+		CheckErr("Erro ao gravar o arquivo de log", err)
+	}
+}
@@ -0,0 +1,490 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	silencesCallback      = "alertmanager-silences"
+	silenceDialogCallback = "alertmanager-silence"
+
+	actionAlertSilenceCustom = "alert-silence-custom"
+	actionSilenceExpire      = "silence-expire"
+
+	// silenceMaxDuration é o tempo máximo aceito nos silences criados pelo Slack
+	silenceMaxDuration = 7 * 24 * time.Hour
+)
+
+// SilenceMatcher é um matcher de um silence do Alertmanager
+type SilenceMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual bool   `json:"isEqual"`
+}
+
+// String formata o matcher como no amtool (ex.: alertname=~"High.*")
+func (m SilenceMatcher) String() string {
+	operator := "="
+	if !m.IsEqual {
+		operator = "!"
+	}
+	if m.IsRegex {
+		operator += "~"
+	} else if !m.IsEqual {
+		operator += "="
+	}
+
+	return fmt.Sprintf("%s%s%s", m.Name, operator, m.Value)
+}
+
+// AlertmanagerSilence é um silence retornado pela API v2 do Alertmanager
+type AlertmanagerSilence struct {
+	ID        string           `json:"id"`
+	Matchers  []SilenceMatcher `json:"matchers"`
+	StartsAt  time.Time        `json:"startsAt"`
+	EndsAt    time.Time        `json:"endsAt"`
+	CreatedBy string           `json:"createdBy"`
+	Comment   string           `json:"comment"`
+	Status    struct {
+		State string `json:"state"`
+	} `json:"status"`
+}
+
+// ParseSilenceMatcher lê um matcher no formato do amtool: nome=valor,
+// nome!=valor, nome=~regex ou nome!~regex
+func ParseSilenceMatcher(text string) (SilenceMatcher, error) {
+	i := strings.IndexAny(text, "=!")
+	if i <= 0 {
+		return SilenceMatcher{}, fmt.Errorf("matcher `%s` inválido, use nome=valor, nome!=valor, nome=~regex ou nome!~regex", text)
+	}
+
+	matcher := SilenceMatcher{Name: text[:i], IsEqual: true}
+	operator := text[i:]
+	switch {
+	case strings.HasPrefix(operator, "=~"):
+		matcher.IsRegex = true
+		matcher.Value = operator[2:]
+	case strings.HasPrefix(operator, "!~"):
+		matcher.IsRegex, matcher.IsEqual = true, false
+		matcher.Value = operator[2:]
+	case strings.HasPrefix(operator, "!="):
+		matcher.IsEqual = false
+		matcher.Value = operator[2:]
+	case strings.HasPrefix(operator, "="):
+		matcher.Value = operator[1:]
+	default:
+		return SilenceMatcher{}, fmt.Errorf("matcher `%s` inválido, use nome=valor, nome!=valor, nome=~regex ou nome!~regex", text)
+	}
+
+	// Aceitando também o valor entre aspas, como no amtool
+	matcher.Value = strings.Trim(matcher.Value, `"“”`)
+	if matcher.Value == "" {
+		return SilenceMatcher{}, fmt.Errorf("matcher `%s` sem valor", text)
+	}
+
+	return matcher, nil
+}
+
+// parseSilenceDuration lê o tempo do silence, aceitando também dias (ex.: 2d)
+func parseSilenceDuration(value string) (time.Duration, error) {
+	var duration time.Duration
+	var err error
+
+	if strings.HasSuffix(value, "d") {
+		var days int
+		if _, err = fmt.Sscanf(value, "%dd", &days); err == nil {
+			duration = time.Duration(days) * 24 * time.Hour
+		}
+	} else {
+		duration, err = time.ParseDuration(value)
+	}
+
+	if err != nil || duration < time.Minute || duration > silenceMaxDuration {
+		return 0, fmt.Errorf("`duration` deve ser entre 1m e %s, recebido `%s`", formatDuration(silenceMaxDuration), value)
+	}
+
+	return duration, nil
+}
+
+// labelMatchers são os matchers de igualdade das labels, em ordem alfabética
+func labelMatchers(labels map[string]string) []SilenceMatcher {
+	var matchers []SilenceMatcher
+	for name, value := range labels {
+		matchers = append(matchers, SilenceMatcher{Name: name, Value: value, IsEqual: true})
+	}
+	sort.Slice(matchers, func(i, j int) bool { return matchers[i].Name < matchers[j].Name })
+
+	return matchers
+}
+
+// formatMatchers formata os matchers separados por vírgula
+func formatMatchers(matchers []SilenceMatcher) string {
+	var parts []string
+	for _, matcher := range matchers {
+		parts = append(parts, matcher.String())
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// CreateSilence cria um silence no Alertmanager com os matchers, retornando
+// o ID do silence
+func CreateSilence(matchers []SilenceMatcher, duration time.Duration, createdBy string, comment string) (string, error) {
+	if AlertmanagerURL == "" {
+		return "", fmt.Errorf("ALERTMANAGER_URL não configurada")
+	}
+
+	now := time.Now()
+	resp, err := HTTPSendJSONRequest(PostHTTP, AlertmanagerURL+"/api/v2/silences", nil, map[string]interface{}{
+		"matchers":  matchers,
+		"startsAt":  now.Format(time.RFC3339),
+		"endsAt":    now.Add(duration).Format(time.RFC3339),
+		"createdBy": createdBy,
+		"comment":   comment,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var silence struct {
+		SilenceID string `json:"silenceID"`
+	}
+	err = json.Unmarshal([]byte(resp), &silence)
+
+	return silence.SilenceID, err
+}
+
+// ListSilences busca os silences ativos e pendentes do Alertmanager,
+// filtrando pelos matchers quando informados, os que acabam antes primeiro
+func ListSilences(filters []SilenceMatcher) ([]AlertmanagerSilence, error) {
+	if AlertmanagerURL == "" {
+		return nil, fmt.Errorf("ALERTMANAGER_URL não configurada")
+	}
+
+	query := neturl.Values{}
+	for _, filter := range filters {
+		query.Add("filter", filter.String())
+	}
+
+	resp, err := HTTPSendJSONRequest(GetHTTP, AlertmanagerURL+"/api/v2/silences?"+query.Encode(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []AlertmanagerSilence
+	if err := json.Unmarshal([]byte(resp), &all); err != nil {
+		return nil, err
+	}
+
+	var silences []AlertmanagerSilence
+	for _, silence := range all {
+		if silence.Status.State != "expired" {
+			silences = append(silences, silence)
+		}
+	}
+	sort.Slice(silences, func(i, j int) bool { return silences[i].EndsAt.Before(silences[j].EndsAt) })
+
+	return silences, nil
+}
+
+// ExpireSilence expira o silence no Alertmanager
+func ExpireSilence(ID string) error {
+	if AlertmanagerURL == "" {
+		return fmt.Errorf("ALERTMANAGER_URL não configurada")
+	}
+
+	_, err := HTTPSendJSONRequest(DeleteHTTP, AlertmanagerURL+"/api/v2/silence/"+neturl.PathEscape(ID), nil, nil)
+	return err
+}
+
+// silenceAttachment é o attachment de um silence com o botão de expirar
+func silenceAttachment(silence AlertmanagerSilence) slack.Attachment {
+	state := fmt.Sprintf("até %s (faltam %s)", localTime(silence.EndsAt, "02/01 15:04"), formatDuration(time.Until(silence.EndsAt)))
+	if silence.Status.State == "pending" {
+		state = fmt.Sprintf("começa %s, %s", localTime(silence.StartsAt, "02/01 15:04"), state)
+	}
+
+	return slack.Attachment{
+		Title:      formatMatchers(silence.Matchers),
+		Text:       silence.Comment,
+		Color:      "#9E9E9E",
+		Footer:     fmt.Sprintf("%s | por %s | %s", silence.ID, silence.CreatedBy, state),
+		CallbackID: silencesCallback,
+		Actions: []slack.AttachmentAction{
+			{
+				Name:  actionSilenceExpire,
+				Text:  "Expirar",
+				Type:  "button",
+				Style: "danger",
+				Value: silence.ID,
+			},
+		},
+	}
+}
+
+// silenceCreatedAttachment é a resposta de um silence criado, com o botão de
+// expirar para desfazer
+func silenceCreatedAttachment(ID string, matchers []SilenceMatcher, duration time.Duration, user string, comment string) slack.Attachment {
+	return slack.Attachment{
+		Title:      fmt.Sprintf(":mute: Silence criado por @%s durante %s", user, formatDuration(duration)),
+		Text:       fmt.Sprintf("`%s`\n%s", formatMatchers(matchers), comment),
+		Color:      "#9E9E9E",
+		Footer:     "Silence " + ID,
+		CallbackID: silencesCallback,
+		Actions: []slack.AttachmentAction{
+			{Name: actionSilenceExpire, Text: "Expirar", Type: "button", Style: "danger", Value: ID},
+		},
+	}
+}
+
+// slackSilenceCreate cria um silence com os matchers da mensagem, ex.:
+// silence create alertname=HighCPU instance=~"web.*" duration=2h deploy do web
+func (s *SlackListener) slackSilenceCreate(ev *slack.MessageEvent) {
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+
+	duration := AlertmanagerSilenceDuration
+	if value, ok := args.Options["duration"]; ok {
+		parsed, err := parseSilenceDuration(value)
+		if err != nil {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(err.Error(), false))
+			return
+		}
+		duration = parsed
+	}
+
+	// As opções chave=valor que sobram são os matchers e os posicionais são o
+	// comentário, menos os matchers nome!~regex, que não têm o =
+	var matchers []SilenceMatcher
+	var words []string
+	for key, value := range args.Options {
+		if key == "duration" || key == "comment" {
+			continue
+		}
+		matcher, err := ParseSilenceMatcher(key + "=" + value)
+		if err != nil {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(err.Error(), false))
+			return
+		}
+		matchers = append(matchers, matcher)
+	}
+	for _, word := range args.Positional {
+		if matcher, err := ParseSilenceMatcher(word); err == nil {
+			matchers = append(matchers, matcher)
+			continue
+		}
+		words = append(words, word)
+	}
+	sort.Slice(matchers, func(i, j int) bool { return matchers[i].Name < matchers[j].Name })
+
+	if len(matchers) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Informe ao menos um matcher, ex.: `%s alertname=HighCPU instance=~\"web.*\" duration=2h deploy do web`", silenceCreate), false))
+		return
+	}
+
+	comment := strings.TrimSpace(args.Options["comment"] + " " + strings.Join(words, " "))
+	if comment == "" {
+		comment = "Silenciado pelo Slack"
+	}
+
+	userName := ev.Msg.User
+	if info, err := s.client.GetUserInfo(ev.Msg.User); err == nil && info.Name != "" {
+		userName = info.Name
+	}
+
+	ID, err := CreateSilence(matchers, duration, userName, comment)
+	if err != nil {
+		CheckErr("Erro ao criar silence no Alertmanager", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(":x: Erro ao criar o silence no Alertmanager: "+err.Error(), false))
+		return
+	}
+
+	log.Printf("[INFO] Silence %s criado pelo usuário %s (%s)\n", ID, userName, formatMatchers(matchers))
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(silenceCreatedAttachment(ID, matchers, duration, userName, comment)))
+}
+
+// slackSilenceList lista os silences ativos e pendentes, filtrando pelos
+// matchers informados, com o botão de expirar em cada um
+func (s *SlackListener) slackSilenceList(ev *slack.MessageEvent) {
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+
+	words := args.Positional
+	for key, value := range args.Options {
+		words = append(words, key+"="+value)
+	}
+
+	var filters []SilenceMatcher
+	for _, word := range words {
+		matcher, err := ParseSilenceMatcher(word)
+		if err != nil {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(err.Error(), false))
+			return
+		}
+		filters = append(filters, matcher)
+	}
+
+	silences, err := ListSilences(filters)
+	if err != nil {
+		CheckErr("Erro ao buscar os silences no Alertmanager", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(":x: Erro ao buscar os silences no Alertmanager: "+err.Error(), false))
+		return
+	}
+
+	if len(silences) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(":loud_sound: Nenhum silence ativo no Alertmanager", false))
+		return
+	}
+
+	var attachments []slack.Attachment
+	for i, silence := range silences {
+		if i == digestListSize {
+			attachments = append(attachments, slack.Attachment{Text: fmt.Sprintf("_... e mais %d silences, filtre pelos matchers_", len(silences)-digestListSize)})
+			break
+		}
+		attachments = append(attachments, silenceAttachment(silence))
+	}
+
+	s.client.PostMessage(ev.Channel,
+		slack.MsgOptionText(fmt.Sprintf(":mute: *%d silences* ativos no Alertmanager:", len(silences)), false),
+		slack.MsgOptionAttachments(attachments...),
+	)
+}
+
+// slackSilenceExpire expira o silence pelo ID
+func (s *SlackListener) slackSilenceExpire(ev *slack.MessageEvent) {
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+	ID := args.Positional[0]
+
+	if err := ExpireSilence(ID); err != nil {
+		CheckErr("Erro ao expirar o silence "+ID, err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao expirar o silence `%s`: %s", ID, err), false))
+		return
+	}
+
+	log.Printf("[INFO] Silence %s expirado pelo usuário %s\n", ID, ev.Msg.User)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":loud_sound: Silence `%s` expirado, os alertas voltam a ser enviados", ID), false))
+}
+
+func actionSilenceExpireFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	ID := message.Actions[0].Value
+
+	if err := ExpireSilence(ID); err != nil {
+		CheckErr("Erro ao expirar o silence "+ID, err)
+		respondWithoutActions(w, message.OriginalMessage, ":x: Erro ao expirar o silence", err.Error())
+		return
+	}
+
+	log.Printf("[INFO] Silence %s expirado pelo usuário %s\n", ID, message.User.Name)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":loud_sound: Silence `%s` expirado por @%s", ID, message.User.Name), "")
+}
+
+// actionAlertSilenceCustomFunction abre o formulário do silence preenchido
+// com as labels do grupo de alertas, para ajustar os matchers, o tempo e o
+// comentário
+func actionAlertSilenceCustomFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	payload := getAlertGroup(message.Actions[0].Value)
+	if payload == nil {
+		responseMessage(w, message.OriginalMessage, ":x: Grupo de alertas não encontrado, silencie pelo Alertmanager", "")
+		return
+	}
+
+	labels := payload.GroupLabels
+	if len(labels) == 0 {
+		labels = payload.CommonLabels
+	}
+
+	var lines []string
+	for _, matcher := range labelMatchers(labels) {
+		lines = append(lines, matcher.String())
+	}
+
+	dialog := slack.Dialog{
+		CallbackID:  silenceDialogCallback,
+		Title:       "Silenciar alertas",
+		SubmitLabel: "Silenciar",
+		Elements: []slack.DialogElement{
+			&slack.TextInputElement{
+				DialogInput: slack.DialogInput{Type: "textarea", Label: "Matchers", Name: "matchers"},
+				Hint:        "Um por linha: nome=valor, nome!=valor, nome=~regex ou nome!~regex",
+				Value:       strings.Join(lines, "\n"),
+			},
+			&slack.TextInputElement{
+				DialogInput: slack.DialogInput{Type: "text", Label: "Duração", Name: "duration"},
+				Hint:        "Ex.: 30m, 2h ou 1d",
+				Value:       formatDuration(AlertmanagerSilenceDuration),
+			},
+			&slack.TextInputElement{
+				DialogInput: slack.DialogInput{Type: "text", Label: "Comentário", Name: "comment", Placeholder: "Investigando o deploy do web"},
+			},
+		},
+	}
+
+	if err := getAPIConnection().client.OpenDialog(message.TriggerID, dialog); err != nil {
+		CheckErr("Erro ao abrir o dialog do silence", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// silenceDialogSubmission valida o formulário e cria o silence, respondendo
+// no canal com o botão de expirar
+func silenceDialogSubmission(submission DialogSubmission, w http.ResponseWriter) {
+	var errs []dialogError
+
+	var matchers []SilenceMatcher
+	for _, line := range strings.Split(submission.Submission["matchers"], "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		matcher, err := ParseSilenceMatcher(line)
+		if err != nil {
+			errs = append(errs, dialogError{Name: "matchers", Error: strings.Replace(err.Error(), "`", "", -1)})
+			break
+		}
+		matchers = append(matchers, matcher)
+	}
+	if len(matchers) == 0 && len(errs) == 0 {
+		errs = append(errs, dialogError{Name: "matchers", Error: "Informe ao menos um matcher"})
+	}
+
+	duration, err := parseSilenceDuration(strings.TrimSpace(submission.Submission["duration"]))
+	if err != nil {
+		errs = append(errs, dialogError{Name: "duration", Error: strings.Replace(err.Error(), "`", "", -1)})
+	}
+
+	if len(errs) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]dialogError{"errors": errs})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	comment := strings.TrimSpace(submission.Submission["comment"])
+	if comment == "" {
+		comment = "Silenciado pelo Slack"
+	}
+
+	api := getAPIConnection()
+
+	ID, err := CreateSilence(matchers, duration, submission.User.Name, comment)
+	if err != nil {
+		CheckErr("Erro ao criar silence no Alertmanager", err)
+		api.client.PostMessage(submission.Channel.ID, slack.MsgOptionText(":x: Erro ao criar o silence no Alertmanager: "+err.Error(), false))
+		return
+	}
+
+	log.Printf("[INFO] Silence %s criado pelo usuário %s (%s)\n", ID, submission.User.Name, formatMatchers(matchers))
+	api.client.PostMessage(submission.Channel.ID, slack.MsgOptionAttachments(silenceCreatedAttachment(ID, matchers, duration, submission.User.Name, comment)))
+}
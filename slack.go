@@ -4,12 +4,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nlopes/slack"
-	"github.com/tidwall/gjson"
 )
 
 const (
@@ -19,11 +21,68 @@ const (
 	canaryInfo       = "info-canary"
 	haproxyList      = "list-lb"
 	logsContainer    = "logs-container"
+	streamLogs       = "stream-logs"
+	stopStream       = "stop-stream"
+	serviceLogs      = "logs-service"
 	restartContainer = "restart-container"
 	getServiceInfo   = "info-service"
 	upgradeService   = "upgrade-service"
 	listService      = "list-service"
 	comandos         = "comandos"
+	pagerDutyTrigger = "pd-trigger"
+	pagerDutyAck     = "pd-ack"
+	pagerDutyResolve = "pd-resolve"
+	opsgenieCreate   = "og-create"
+	opsgenieAck      = "og-ack"
+	opsgenieClose    = "og-close"
+	githubWorkflow   = "gh-workflow"
+	gitlabPipeline   = "gl-pipeline"
+	jenkinsBuild     = "jenkins-build"
+	scanService      = "scan-service"
+	spComponent      = "sp-component"
+	spIncident       = "sp-incident"
+	spUpdate         = "sp-update"
+	openIncident     = "open-incident"
+	restartService   = "restart-service"
+	scaleService     = "scale-service"
+	oncall           = "oncall"
+	terraformPlan    = "terraform plan"
+	environment      = "environment"
+	datadogMute      = "dd-mute"
+	datadogUnmute    = "dd-unmute"
+	uptimeStatus     = "uptime"
+	listCerts        = "certs"
+	listJobs         = "jobs"
+	help             = "help"
+	find             = "find"
+	batch            = "batch"
+	whoami           = "whoami"
+	showStatus       = "status"
+	favorites        = "favorites"
+	fav              = "fav"
+	recent           = "recent"
+	language         = "language"
+	upgradeWizard    = "upgrade-wizard"
+	auditExport      = "audit export"
+	blueGreen        = "blue-green"
+	abSplit          = "ab-split"
+	lbStats          = "lb stats"
+	rollingRestart   = "rolling-restart"
+	compareEnvs      = "compare"
+	capacity         = "capacity"
+	imageGC          = "image-gc"
+	stackGraph       = "graph"
+	serviceStats     = "stats"
+	silenceCreate    = "silence create"
+	silenceList      = "silence list"
+	silenceExpire    = "silence expire"
+	quotaStatus      = "quota status"
+	quotaOverride    = "quota override"
+	inspectContainer = "inspect"
+	validateConfig   = "validate"
+	stackSnapshot    = "snapshot"
+	stackRestore     = "restore"
+	cloneStack       = "clone"
 )
 
 // SlackListener é a struct que armazena dados do BOT
@@ -31,6 +90,10 @@ type SlackListener struct {
 	client    *slack.Client
 	botID     string
 	channelID string
+
+	// dryRun é preenchido na cópia do listener usada por um comando
+	// chamado com o --dry-run
+	dryRun *DryRun
 }
 
 var rancherListener *RancherListener
@@ -41,6 +104,28 @@ func (s *SlackListener) StartBot(rList *RancherListener) {
 
 	rancherListener = rList
 
+	go RefreshRancherCache()
+	go RefreshServiceIndex()
+
+	// Monitores, agendamentos, eventos e comandos rodam só na réplica líder,
+	// as interações (botões e menus) são atendidas por todas
+	RunAsLeader(s.startLeader)
+}
+
+// startLeader inicia os monitores e a conexão RTM que recebe os comandos
+func (s *SlackListener) startLeader() {
+	go ResumeCanaries()
+	go WatchStatuspageComponents()
+	go WatchUptime()
+	go WatchCertificates()
+	go WatchHostResources()
+	go WatchCrashLoops()
+	go WatchQuietHours()
+	go WatchRancherEvents()
+	go WatchDailyDigest()
+	go WatchWeeklyReport()
+	go WatchEscalations()
+
 	rtm := s.client.NewRTM()
 	go rtm.ManageConnection()
 
@@ -53,13 +138,26 @@ func (s *SlackListener) StartBot(rList *RancherListener) {
 			log.Println("[INFO] BOT iniciado com sucesso!")
 		case *slack.MessageEvent:
 			s.handleMessageEvent(ev)
+		case *slack.FileSharedEvent:
+			go s.handleFileShared(ev)
+		case *slack.ReactionAddedEvent:
+			// Qualquer reação reconhece o alerta que está sendo escalonado
+			if ev.User != s.botID {
+				AcknowledgeEscalation(ev.Item.Timestamp, ev.User)
+			}
 		}
 	}
 }
 
 func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
-	// Parando a função caso a msg não venha do mesmo canal que o BOT está
-	if ev.Channel != s.channelID {
+	// Parando a função caso a msg não venha do canal do BOT ou de um time
+	tenant := TenantForChannel(ev.Channel)
+	if ev.Channel != s.channelID && tenant == nil {
+		return nil
+	}
+
+	// Parando a função caso o BOT esteja sendo desligado
+	if ShuttingDown() {
 		return nil
 	}
 
@@ -69,6 +167,11 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 		return nil
 	}
 
+	// Os atalhos (ex.: !restart payments) viram o comando com a menção
+	if text, ok := expandShorthand(ev.Msg.Text, s.botID); ok {
+		ev.Msg.Text = text
+	}
+
 	var isReminder bool
 	if strings.Contains(ev.Msg.Text, fmt.Sprintf("Reminder: <@%s", s.botID)) {
 		ev.Msg.Text = strings.Replace(ev.Msg.Text, "Reminder: ", "", 1)
@@ -81,20 +184,91 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 		return nil
 	}
 
-	// Tirando a menção ao BOT da mensagem e guardando em uma variável
-	message := strings.Split(strings.TrimSpace(ev.Msg.Text), " ")[1]
+	// Tirando a menção ao BOT da mensagem e separando o comando dos
+	// argumentos (ex.: canary enable lb-edge 25%)
+	words := strings.Fields(ev.Msg.Text)
+	if len(words) < 2 {
+		return nil
+	}
+	args := ParseCommandArgs(words[1:])
+	message := args.Command
 
 	if strings.Contains(ev.Msg.Text, "ajuda") {
 		s.slackCommandHelper(ev, message)
 		return nil
 	}
 
+	if _, ok := commandSpecs[message]; ok {
+		if err := args.Validate(); err != nil {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(err.Error(), false))
+			return nil
+		}
+		ev.Msg.Text = args.Text(s.botID)
+	} else if len(words) > 2 && message != words[1] {
+		ev.Msg.Text = strings.Join(append([]string{words[0], message}, words[3:]...), " ")
+	}
+
+	text, dryRun, byDefault := parseDryRun(ev.Msg.Text)
+	ev.Msg.Text = text
+	if dryRun {
+		listener, ok := s.withDryRun(ev, message, byDefault)
+		if !ok {
+			return nil
+		}
+		s = listener
+	}
+
+	// O audit usa o nome do usuário, como nas interações
+	userName := ev.Msg.User
+	if info, err := s.client.GetUserInfo(ev.Msg.User); err == nil && info.Name != "" {
+		userName = info.Name
+	}
+	audit := AuditEntry{
+		Source:  auditSourceSlack,
+		User:    userName,
+		Action:  message,
+		Value:   strings.Join(args.Positional, " "),
+		Channel: ev.Channel,
+	}
+
+	if s.dryRun == nil && MaintenanceBlocks(message) {
+		audit.Status = 423
+		RecordAudit(audit)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(maintenanceMessage(message), false))
+		return nil
+	}
+
+	if tenant != nil {
+		// Os comandos que só abrem o menu são contados na escolha do menu
+		err := tenant.Authorize(ev.Msg.User, userName, message)
+		status := 403
+		if err == nil && s.dryRun == nil && commandCharged(args) {
+			_, err = tenant.ConsumeQuota(1, message)
+			status = 429
+		}
+		if err != nil {
+			log.Printf("[INFO] Comando %s recusado no time %s: %s\n", message, tenant.Name, err)
+			audit.Status = status
+			RecordAudit(audit)
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(":no_entry: "+err.Error(), false))
+			return nil
+		}
+	}
+
+	RecordAudit(audit)
+
 	// Fazendo as verificações de mensagens e jogando
 	// para as devidas funções
 	if strings.HasPrefix(message, restartContainer) {
 		s.slackRestartContainer(ev)
 	} else if strings.HasPrefix(message, logsContainer) {
 		s.slackLogsContainer(ev)
+	} else if strings.HasPrefix(message, streamLogs) {
+		s.slackStreamLogs(ev)
+	} else if strings.HasPrefix(message, stopStream) {
+		s.slackStopStream(ev)
+	} else if strings.HasPrefix(message, serviceLogs) {
+		s.slackServiceLogs(ev)
 	} else if strings.HasPrefix(message, canaryUpdate) {
 		s.slackUpdateCanary(ev)
 	} else if strings.HasPrefix(message, haproxyList) {
@@ -113,6 +287,117 @@ func (s *SlackListener) handleMessageEvent(ev *slack.MessageEvent) error {
 		s.slackCanaryInfo(ev)
 	} else if strings.HasPrefix(message, comandos) {
 		s.slackHelper(ev)
+	} else if strings.HasPrefix(message, pagerDutyTrigger) {
+		s.slackPagerDutyTrigger(ev)
+	} else if strings.HasPrefix(message, pagerDutyAck) {
+		s.slackPagerDutyUpdate(ev, "acknowledge")
+	} else if strings.HasPrefix(message, pagerDutyResolve) {
+		s.slackPagerDutyUpdate(ev, "resolve")
+	} else if strings.HasPrefix(message, opsgenieCreate) {
+		s.slackOpsgenieCreate(ev)
+	} else if strings.HasPrefix(message, opsgenieAck) {
+		s.slackOpsgenieUpdate(ev, "acknowledge")
+	} else if strings.HasPrefix(message, opsgenieClose) {
+		s.slackOpsgenieUpdate(ev, "close")
+	} else if strings.HasPrefix(message, githubWorkflow) {
+		s.slackGitHubWorkflow(ev)
+	} else if strings.HasPrefix(message, gitlabPipeline) {
+		s.slackGitLabPipeline(ev)
+	} else if strings.HasPrefix(message, jenkinsBuild) {
+		s.slackJenkinsBuild(ev)
+	} else if strings.HasPrefix(message, scanService) {
+		s.slackScanService(ev)
+	} else if strings.HasPrefix(message, spComponent) {
+		s.slackStatuspageComponent(ev)
+	} else if strings.HasPrefix(message, spIncident) {
+		s.slackStatuspageIncident(ev)
+	} else if strings.HasPrefix(message, spUpdate) {
+		s.slackStatuspageUpdate(ev)
+	} else if strings.HasPrefix(message, openIncident) {
+		s.slackOpenIncident(ev)
+	} else if strings.HasPrefix(message, oncall) {
+		s.slackOncall(ev)
+	} else if strings.HasPrefix(message, restartService) {
+		s.slackRestartService(ev)
+	} else if strings.HasPrefix(message, scaleService) {
+		s.slackScaleService(ev)
+	} else if strings.HasPrefix(message, terraformPlan) {
+		// O plan pode demorar, então não trava o recebimento das demais mensagens
+		go s.slackTerraformPlan(ev)
+	} else if strings.HasPrefix(message, environment) {
+		s.slackEnvironment(ev)
+	} else if strings.HasPrefix(message, datadogMute) {
+		s.slackDatadogMute(ev)
+	} else if strings.HasPrefix(message, datadogUnmute) {
+		s.slackDatadogUnmute(ev)
+	} else if strings.HasPrefix(message, uptimeStatus) {
+		s.slackUptime(ev)
+	} else if strings.HasPrefix(message, listCerts) {
+		s.slackCerts(ev)
+	} else if strings.HasPrefix(message, listJobs) {
+		s.slackJobs(ev)
+	} else if strings.HasPrefix(message, help) {
+		s.slackHelp(ev)
+	} else if strings.HasPrefix(message, find) {
+		s.slackFind(ev)
+	} else if strings.HasPrefix(message, batch) {
+		s.slackBatch(ev)
+	} else if strings.HasPrefix(message, whoami) {
+		s.slackWhoami(ev)
+	} else if strings.HasPrefix(message, showStatus) {
+		s.slackStatus(ev)
+	} else if strings.HasPrefix(message, favorites) {
+		s.slackFavorites(ev)
+	} else if strings.HasPrefix(message, fav) {
+		s.slackFav(ev)
+	} else if strings.HasPrefix(message, recent) {
+		s.slackRecent(ev)
+	} else if strings.HasPrefix(message, language) {
+		s.slackLanguage(ev)
+	} else if strings.HasPrefix(message, upgradeWizard) {
+		s.slackUpgradeWizard(ev)
+	} else if strings.HasPrefix(message, auditExport) {
+		s.slackAuditExport(ev)
+	} else if strings.HasPrefix(message, blueGreen) {
+		s.slackBlueGreen(ev)
+	} else if strings.HasPrefix(message, abSplit) {
+		s.slackABSplit(ev)
+	} else if strings.HasPrefix(message, lbStats) {
+		s.slackLBStats(ev)
+	} else if strings.HasPrefix(message, rollingRestart) {
+		s.slackRollingRestart(ev)
+	} else if strings.HasPrefix(message, compareEnvs) {
+		s.slackCompare(ev)
+	} else if strings.HasPrefix(message, capacity) {
+		s.slackCapacity(ev)
+	} else if strings.HasPrefix(message, imageGC) {
+		s.slackImageGC(ev)
+	} else if strings.HasPrefix(message, stackGraph) {
+		s.slackServiceGraph(ev)
+	} else if strings.HasPrefix(message, serviceStats) {
+		s.slackStats(ev)
+	} else if strings.HasPrefix(message, silenceCreate) {
+		s.slackSilenceCreate(ev)
+	} else if strings.HasPrefix(message, silenceList) {
+		s.slackSilenceList(ev)
+	} else if strings.HasPrefix(message, silenceExpire) {
+		s.slackSilenceExpire(ev)
+	} else if strings.HasPrefix(message, quotaStatus) {
+		s.slackQuotaStatus(ev)
+	} else if strings.HasPrefix(message, quotaOverride) {
+		s.slackQuotaOverride(ev)
+	} else if strings.HasPrefix(message, inspectContainer) {
+		s.slackInspect(ev)
+	} else if strings.HasPrefix(message, validateConfig) {
+		s.slackValidate(ev)
+	} else if strings.HasPrefix(message, stackSnapshot) {
+		s.slackSnapshot(ev)
+	} else if strings.HasPrefix(message, stackRestore) {
+		s.slackRestore(ev)
+	} else if strings.HasPrefix(message, cloneStack) {
+		s.slackClone(ev)
+	} else if !s.handlePluginMessage(ev, message) && !s.handleIntent(ev) {
+		s.slackUnknownCommand(ev, message)
 	}
 
 	return nil
@@ -133,16 +418,28 @@ func (s *SlackListener) slackCanaryEnable(ev *slack.MessageEvent) {
 
 	if len(args) == 3 {
 		lb := args[2]
+		if !s.allowTargetArg(ev.Channel, lb) {
+			return
+		}
 
-		resp := rancherListener.EnableCanary(lb)
+		resp := s.rancher().EnableCanary(lb)
 
 		if resp == "error" {
 			s.client.PostMessage(ev.Channel, slack.MsgOptionText("Erro ao fazer update no haproxy.cfg, verifique se o ID passado está correto ou se o conteúdo do haproxy.cfg atual está em branco", false))
 			return
 		}
 
-		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Arquivo 'haproxy.cfg' alterado com sucesso! *Canary Deployment* ativado.\n```%s```", resp), false))
+		if s.finishDryRun(ev, canaryActivate) {
+			return
+		}
+
+		msg := fmt.Sprintf("Arquivo 'haproxy.cfg' alterado com sucesso! *Canary Deployment* ativado.\n```%s```", resp)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(undoAttachment(msg, undoCanaryEnable(lb))))
 	} else {
+		if s.requireDryRunArgs(ev, canaryActivate) {
+			return
+		}
+
 		s.createAndSendAttachment(
 			ev,
 			"Qual Load Balancer deseja ativar o Canary?",
@@ -164,16 +461,28 @@ func (s *SlackListener) slackCanaryDisable(ev *slack.MessageEvent) {
 
 	if len(args) == 3 {
 		lb := args[2]
+		if !s.allowTargetArg(ev.Channel, lb) {
+			return
+		}
 
-		resp := rancherListener.DisableCanary(lb)
+		resp := s.rancher().DisableCanary(lb)
 
 		if resp == "error" {
 			s.client.PostMessage(ev.Channel, slack.MsgOptionText("Erro ao fazer update no haproxy.cfg, verifique se o ID passado está correto ou se o conteúdo do haproxy.cfg atual está em branco", false))
 			return
 		}
 
-		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Arquivo 'haproxy.cfg' alterado com sucesso! *Canary Deployment* desativado.\n```%s```", resp), false))
+		if s.finishDryRun(ev, canaryDisable) {
+			return
+		}
+
+		msg := fmt.Sprintf("Arquivo 'haproxy.cfg' alterado com sucesso! *Canary Deployment* desativado.\n```%s```", resp)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(undoAttachment(msg, undoCanaryDisable(lb))))
 	} else {
+		if s.requireDryRunArgs(ev, canaryDisable) {
+			return
+		}
+
 		s.createAndSendAttachment(
 			ev,
 			"Qual Load Balancer deseja desativar o Canary?",
@@ -194,11 +503,14 @@ func (s *SlackListener) slackServiceUpgrade(ev *slack.MessageEvent) {
 	args := strings.Split(ev.Msg.Text, " ")
 
 	if len(args) != 4 {
-		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s id-serviço nova-imagem", upgradeService), false))
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s serviço nova-imagem", upgradeService), false))
 		return
 	}
 
-	serviceID := args[2]
+	serviceID, ok := s.resolveServiceArg(ev.Channel, args[2])
+	if !ok {
+		return
+	}
 	newServiceImage := args[3]
 
 	if !strings.HasPrefix(newServiceImage, "docker:") {
@@ -206,34 +518,134 @@ func (s *SlackListener) slackServiceUpgrade(ev *slack.MessageEvent) {
 		return
 	}
 
-	resp := rancherListener.UpgradeService(serviceID, newServiceImage)
-
-	if resp == "" {
-		s.client.PostMessage(ev.Channel, slack.MsgOptionText("Erro no upgrade do serviço. Você pode verificar:\n*- Se o ID do serviço que foi passado realmente existe*\n*- Se o serviço já não está passando por um processo de Upgrade*", false))
+	if err := CheckUpgradePolicy(serviceID, newServiceImage); err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: Upgrade bloqueado: %s", err), false))
 		return
 	}
 
-	msg := fmt.Sprintf("Serviço atualizado com sucesso! A nova imagem do serviço `%s` é `%s`", serviceID, resp)
+	if s.dryRun != nil {
+		s.rancher().UpgradeService(serviceID, newServiceImage)
+		s.finishDryRun(ev, upgradeService)
+		return
+	}
 
-	log.Printf("[INFO] Serviço %s atualizado pelo usuário %s\n", serviceID, ev.Msg.User)
-	s.client.PostMessage(ev.Channel, slack.MsgOptionText(msg, false))
+	if _, err := EnqueueServiceUpgrade(ev.Channel, serviceID, newServiceImage, ev.Msg.User); err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(queuedJobMessage(nil, err), false))
+	}
 }
 
 func (s *SlackListener) slackServicesList(ev *slack.MessageEvent) {
-	resp := rancherListener.ListServices()
+	services, err := orchestrator.ListServices()
+	if err != nil {
+		CheckErr("Erro ao listar os serviços", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao listar os serviços: %s", err), false))
+		return
+	}
 
 	msg := "*Lista de serviços:* \n\n"
 
-	data := gjson.Get(resp, "data")
-	data.ForEach(func(key, value gjson.Result) bool {
-		msg += fmt.Sprintf("`%s | %s`\n", value.Get("id").String(), value.Get("name").String())
-		return true
-	})
+	for _, service := range services {
+		msg += fmt.Sprintf("`%s | %s`\n", service.ID, service.Name)
+	}
 
 	s.client.PostMessage(ev.Channel, slack.MsgOptionText(msg, false))
 }
 
+func (s *SlackListener) slackRestartService(ev *slack.MessageEvent) {
+	// Com o serviço informado reinicia direto, sem o menu
+	if args := strings.Fields(ev.Msg.Text); len(args) > 2 {
+		serviceID, ok := s.resolveServiceArg(ev.Channel, args[2])
+		if !ok {
+			return
+		}
+
+		if s.dryRun != nil {
+			s.orchestrator().RestartService(serviceID)
+			s.finishDryRun(ev, restartService)
+			return
+		}
+
+		user := ev.Msg.User
+		_, err := EnqueueJob("restart do serviço "+serviceID, user, func() error {
+			return restartServiceFunction(serviceID, user)
+		})
+		if err != nil {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(queuedJobMessage(nil, err), false))
+		}
+		return
+	}
+
+	if s.requireDryRunArgs(ev, restartService) {
+		return
+	}
+
+	s.createAndSendAttachment(
+		ev,
+		"Qual serviço deseja reiniciar? :arrows_counterclockwise:",
+		restartService,
+		getServices(),
+		&slack.ConfirmationField{
+			Title:       "Tem certeza disso?",
+			Text:        "Todas as instâncias do serviço serão reiniciadas :thinking_face:",
+			OkText:      "Sim",
+			DismissText: "Não",
+		},
+	)
+}
+
+func (s *SlackListener) slackScaleService(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) != 4 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s serviço quantidade", scaleService), false))
+		return
+	}
+
+	replicas, err := strconv.Atoi(args[3])
+	if err != nil || replicas < 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText("A quantidade deve ser um número maior ou igual a zero", false))
+		return
+	}
+
+	serviceID, ok := s.resolveServiceArg(ev.Channel, args[2])
+	if !ok {
+		return
+	}
+
+	// A escala anterior é a volta do desfazer
+	previous, err := s.orchestrator().GetService(serviceID)
+	CheckErr("Erro ao buscar a escala atual do serviço", err)
+
+	if err := s.orchestrator().ScaleService(serviceID, replicas); err != nil {
+		CheckErr("Erro ao alterar a escala do serviço", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao alterar a escala do serviço `%s`: %s", serviceID, err), false))
+		return
+	}
+
+	if s.finishDryRun(ev, scaleService) {
+		return
+	}
+
+	log.Printf("[INFO] Escala do serviço %s alterada para %d pelo usuário %s\n", serviceID, replicas, ev.Msg.User)
+	RecordChange(ChangeEvent{Kind: "escala", ServiceID: serviceID, User: ev.Msg.User})
+	msg := fmt.Sprintf("Serviço `%s` escalado para %d instâncias :chart_with_upwards_trend:", serviceID, replicas)
+	if previous == nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(msg, false))
+		return
+	}
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(undoAttachment(msg, undoServiceScale(s.orchestrator(), serviceID, previous.Replicas))))
+}
+
 func (s *SlackListener) slackServiceInfo(ev *slack.MessageEvent) {
+	// Com o serviço informado as informações são enviadas direto, sem o menu
+	if args := strings.Fields(ev.Msg.Text); len(args) > 2 {
+		if serviceID, ok := s.resolveServiceArg(ev.Channel, args[2]); ok {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(serviceInfoMessage(serviceID), false))
+			go postGrafanaPanel(ev.Channel, serviceID)
+		}
+		return
+	}
+
 	s.createAndSendAttachment(
 		ev,
 		"Qual serviço deseja obter informações? :sunglasses:",
@@ -244,14 +656,7 @@ func (s *SlackListener) slackServiceInfo(ev *slack.MessageEvent) {
 }
 
 func (s *SlackListener) slackCommandHelper(ev *slack.MessageEvent, message string) {
-	var msg string
-
-	for _, cmd := range Commands {
-		if cmd.Cmd == message {
-			cmd.Usage = strings.Replace(cmd.Usage, "comando", cmd.Cmd, 1)
-			msg = fmt.Sprintf("*Comando:* `%s`\n*Descrição:* _%s_\n*Uso:* _%s_\n*Dica:* _%s_", cmd.Cmd, cmd.Description, cmd.Usage, cmd.Lint)
-		}
-	}
+	msg := CommandHelpMessage(message)
 
 	if msg == "" {
 		msg = "Comando não encontrado."
@@ -267,7 +672,7 @@ func (s *SlackListener) slackHelper(ev *slack.MessageEvent) {
 		msg += fmt.Sprintf("`%s` ", cmd.Cmd)
 	}
 
-	msg += "\n\n_*Obs.:* Caso queira informações mais detalhadas sobre um comando, você pode chamar este comando seguido de *ajuda*._\n_*Ex.:* @bot comando ajuda_"
+	msg += fmt.Sprintf("\n\n_*Obs.:* Caso queira informações mais detalhadas sobre um comando, você pode chamar este comando seguido de *ajuda*._\n_*Ex.:* @bot comando ajuda_\n_Use *@bot %s* para ver a descrição, o uso e as permissões de todos os comandos._", help)
 
 	s.client.PostMessage(ev.Channel, slack.MsgOptionText(msg, false))
 }
@@ -304,27 +709,170 @@ func (s *SlackListener) slackUpdateCanary(ev *slack.MessageEvent) {
 	newVersionPercent := args[3]
 	oldVersionPercent := args[4]
 
-	resp := rancherListener.UpdateCustomHaproxyCfg(lb, newVersionPercent, oldVersionPercent)
+	if !s.allowTargetArg(ev.Channel, lb) {
+		return
+	}
+
+	previousCfg := rancherListener.HaproxyConfig(lb)
+
+	resp := s.rancher().UpdateCustomHaproxyCfg(lb, newVersionPercent, oldVersionPercent)
 
 	if resp == "error" {
-		s.client.PostMessage(ev.Channel, slack.MsgOptionText("Erro ao fazer update no haproxy.cfg, verifique se o ID passado está correto, se o conteúdo do haproxy.cfg atual está em branco ou se os pesos passados não somam 100", false))
+		actionErr := diagnoseCanaryError(lb, "", newVersionPercent, oldVersionPercent)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(actionErr.Attachment("Erro ao fazer update no haproxy.cfg")))
+		return
+	}
+
+	if s.finishDryRun(ev, canaryUpdate) {
 		return
 	}
 	//v := strconv.FormatBool(resp)
-	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Arquivo 'haproxy.cfg' alterado com sucesso!\n```%s```", resp), false))
+	msg := fmt.Sprintf("Arquivo 'haproxy.cfg' alterado com sucesso!\n```%s```", resp)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(undoAttachment(msg, undoHaproxyCfg(lb, previousCfg))))
 }
 
 func (s *SlackListener) slackLogsContainer(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")[2:]
+
+	// Caso o ID do container seja passado no comando, os logs são enviados direto
+	if len(args) > 0 && !strings.Contains(args[0], "=") && args[0] != "from" {
+		containerID := args[0]
+		if !s.allowTargetArg(ev.Channel, containerID) {
+			return
+		}
+
+		opts := ParseLogsOptions(args[1:])
+
+		if opts.IsEmpty() {
+			opts.Lines = defaultLogsLines
+		}
+
+		if _, err := UploadContainerLogs(containerID, opts); err != nil {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao enviar os logs do container `%s`", containerID), false))
+		}
+		return
+	}
+
+	opts := ParseLogsOptions(args)
+
 	s.createAndSendAttachment(
 		ev,
 		"Qual container deseja baixar os logs? :yum:",
 		logsContainer,
-		getContainers(),
+		withLogsOptions(getContainers(), opts),
+		nil,
+	)
+}
+
+func (s *SlackListener) slackServiceLogs(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")[2:]
+
+	// Com o serviço informado os logs são enviados direto, sem o menu
+	if len(args) > 0 && !strings.Contains(args[0], "=") && args[0] != "from" {
+		serviceID, ok := s.resolveServiceArg(ev.Channel, args[0])
+		if !ok {
+			return
+		}
+
+		opts := ParseLogsOptions(args[1:])
+		if opts.IsEmpty() {
+			opts.Lines = defaultLogsLines
+		}
+
+		channel, user := ev.Channel, ev.Msg.User
+		_, err := EnqueueJobContext("logs do serviço "+serviceID, user, func(ctx context.Context) error {
+			progress := StartProgress(channel, fmt.Sprintf("*Logs* do serviço `%s` (%s), por <@%s>", serviceID, opts.Describe(), user), JobFromContext(ctx))
+
+			if err := UploadServiceLogs(ctx, serviceID, opts, progress); err != nil {
+				progress.Finish(false, err.Error())
+				return err
+			}
+
+			return nil
+		})
+		if err != nil {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(queuedJobMessage(nil, err), false))
+		}
+		return
+	}
+
+	opts := ParseLogsOptions(args)
+
+	s.createAndSendAttachment(
+		ev,
+		"De qual serviço deseja baixar os logs de todos os containers? :books:",
+		serviceLogs,
+		withLogsOptions(getServices(), opts),
+		nil,
+	)
+}
+
+func (s *SlackListener) slackStreamLogs(ev *slack.MessageEvent) {
+	var duration time.Duration
+	for _, arg := range strings.Split(ev.Msg.Text, " ")[2:] {
+		if strings.HasPrefix(arg, "duration=") {
+			duration = ParseDurationEnv("duration", strings.TrimPrefix(arg, "duration="), 0)
+		}
+	}
+
+	options := getContainers()
+	for i := range options {
+		options[i].Value = EncodeStreamValue(options[i].Value, duration)
+	}
+
+	s.createAndSendAttachment(
+		ev,
+		"Qual container deseja acompanhar os logs? :tv:",
+		streamLogs,
+		options,
 		nil,
 	)
 }
 
+func (s *SlackListener) slackStopStream(ev *slack.MessageEvent) {
+	stopped := StopUserLogStreams(ev.Msg.User, fmt.Sprintf("parado por <@%s>", ev.Msg.User))
+
+	if stopped == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText("Você não tem nenhum stream de logs aberto.", false))
+		return
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("%d stream(s) de logs finalizado(s) :white_check_mark:", stopped), false))
+}
+
 func (s *SlackListener) slackRestartContainer(ev *slack.MessageEvent) {
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+
+	// Com o drain o container sai dos LBs antes do restart
+	if value, ok := args.Options["drain"]; ok {
+		grace, err := drainGrace(value)
+		if err != nil {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(err.Error(), false))
+			return
+		}
+
+		if len(args.Positional) > 0 {
+			if !s.allowTargetArg(ev.Channel, args.Positional[0]) {
+				return
+			}
+
+			job, err := enqueueDrainRestart(ev.Channel, "", args.Positional[0], grace, ev.Msg.User)
+			if err != nil {
+				s.client.PostMessage(ev.Channel, slack.MsgOptionText(queuedJobMessage(job, err), false))
+			}
+			return
+		}
+
+		s.createAndSendAttachment(
+			ev,
+			fmt.Sprintf("Qual container deseja reiniciar com drain (grace de %s)? :yum:", formatDuration(grace)),
+			restartContainerDrain,
+			withDrainGrace(getContainers(), grace),
+			nil,
+		)
+		return
+	}
+
 	s.createAndSendAttachment(
 		ev,
 		"Qual container deseja reiniciar? :yum:",
@@ -335,17 +883,36 @@ func (s *SlackListener) slackRestartContainer(ev *slack.MessageEvent) {
 }
 
 func (s *SlackListener) createAndSendAttachment(ev *slack.MessageEvent, text string, callbackID string, options []slack.AttachmentActionOption, confirmation *slack.ConfirmationField) {
+	// Menu vazio com o Rancher fora do ar avisa em vez de mostrar o menu
+	if endpoints := RancherUnavailableEndpoints(); len(options) == 0 && len(endpoints) > 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: %s (endpoints: `%s`)", ErrRancherUnavailable, strings.Join(endpoints, "`, `")), false))
+		return
+	}
+
+	// Os serviços favoritos do usuário aparecem primeiro
+	options = favoritesFirst(ev.Msg.User, options)
+
+	selectAction := slack.AttachmentAction{
+		Name:    "select",
+		Type:    "select",
+		Options: options,
+		Confirm: confirmation,
+	}
+
+	// O Slack mostra no máximo 100 opções, nos maiores elas são buscadas
+	// enquanto o usuário digita (ver OptionsLoad)
+	if len(options) > optionsStaticLimit {
+		selectAction.Options = nil
+		selectAction.DataSource = "external"
+		selectAction.MinQueryLength = 1
+	}
+
 	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(slack.Attachment{
 		Text:       text,
 		Color:      "#0C648A",
 		CallbackID: callbackID,
 		Actions: []slack.AttachmentAction{
-			{
-				Name:    "select",
-				Type:    "select",
-				Options: options,
-				Confirm: confirmation,
-			},
+			selectAction,
 			{
 				Name:  "cancel",
 				Text:  "Cancelar",
@@ -358,23 +925,8 @@ func (s *SlackListener) createAndSendAttachment(ev *slack.MessageEvent, text str
 
 func getContainers() []slack.AttachmentActionOption {
 	// Pegando a lista de containers lá do rancher.go
-	containersList := rancherListener.ListContainers()
-
-	// Criando uma lista de estruturas
-	containers := []*Container{}
-
-	// Pegando a lista que veio da API do Rancher, convertendo pra String
-	// atribuindo à uma struct e adicionando na lista de structs
-	data := gjson.Get(containersList, "data")
-	data.ForEach(func(key, value gjson.Result) bool {
-		container := new(Container)
-		container.id = value.Get("id").String()
-		container.imageUUID = value.Get("imageUuid").String()
-		container.name = value.Get("name").String()
-		containers = append(containers, container)
-
-		return true
-	})
+	containers, err := rancherListener.ListContainers()
+	CheckErr("Erro ao listar os containers", err)
 
 	// Criando lista de opções, fazendo um ForEach na lista
 	// de structs de containers, criando opcao dentro do ForEach
@@ -382,8 +934,8 @@ func getContainers() []slack.AttachmentActionOption {
 	opcoes := []slack.AttachmentActionOption{}
 	for _, container := range containers {
 		opcoes = append(opcoes, slack.AttachmentActionOption{
-			Text:  fmt.Sprintf("%s | %s", container.id, container.name),
-			Value: container.id,
+			Text:  fmt.Sprintf("%s | %s", container.ID, container.Name),
+			Value: container.ID,
 		})
 	}
 
@@ -391,21 +943,17 @@ func getContainers() []slack.AttachmentActionOption {
 }
 
 func getServices() []slack.AttachmentActionOption {
-	servicesList := rancherListener.ListServices()
+	services, err := orchestrator.ListServices()
+	CheckErr("Erro ao listar os serviços", err)
 
 	opcoes := []slack.AttachmentActionOption{}
 
-	data := gjson.Get(servicesList, "data")
-	data.ForEach(func(key, value gjson.Result) bool {
-		serviceID := value.Get("id").String()
-		serviceName := value.Get("name").String()
+	for _, service := range services {
 		opcoes = append(opcoes, slack.AttachmentActionOption{
-			Text:  fmt.Sprintf("%s | %s", serviceID, serviceName),
-			Value: serviceID,
+			Text:  fmt.Sprintf("%s | %s", service.ID, service.Name),
+			Value: service.ID,
 		})
-
-		return true
-	})
+	}
 
 	return opcoes
 }
@@ -0,0 +1,510 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pulberg/slack-bot/rancher"
+)
+
+const (
+	actionSnapshotRestore = "snapshot-restore"
+	actionSnapshotDiscard = "snapshot-discard"
+
+	// snapshotPendingTTL é o tempo que a prévia do restore aguarda a confirmação
+	snapshotPendingTTL = 30 * time.Minute
+
+	// snapshotDiffMax é o tamanho máximo do diff mostrado na prévia
+	snapshotDiffMax = 2500
+)
+
+var (
+	// SnapshotsFile é o arquivo onde ficam salvos os snapshots das stacks
+	SnapshotsFile = "snapshots.json"
+
+	// SnapshotsKeep é a quantidade de snapshots mantidos por stack, os mais
+	// antigos são removidos
+	SnapshotsKeep = 10
+)
+
+// StackSnapshot é a definição completa de uma stack em um momento: o
+// docker-compose e o rancher-compose exportados pelo Rancher e a escala
+// de cada serviço
+type StackSnapshot struct {
+	ID             string         `json:"id"`
+	Stack          string         `json:"stack"`
+	Environment    string         `json:"environment"`
+	DockerCompose  string         `json:"docker_compose"`
+	RancherCompose string         `json:"rancher_compose"`
+	Scales         map[string]int `json:"scales"`
+	User           string         `json:"user"`
+	Created        time.Time      `json:"created"`
+}
+
+// snapshotRestore é o restore aguardando a confirmação na prévia
+type snapshotRestore struct {
+	Snapshot StackSnapshot
+	StackID  string
+	Created  time.Time
+}
+
+var (
+	stackSnapshots  []StackSnapshot
+	snapshotsLoaded bool
+	snapshotsMutex  sync.Mutex
+
+	snapshotPending      = map[string]*snapshotRestore{}
+	snapshotPendingMutex sync.Mutex
+)
+
+// loadSnapshots lê o arquivo de snapshots na primeira vez que eles são
+// usados. Deve ser chamada com o snapshotsMutex travado
+func loadSnapshots() {
+	if snapshotsLoaded {
+		return
+	}
+	snapshotsLoaded = true
+
+	data, err := ioutil.ReadFile(SnapshotsFile)
+	if os.IsNotExist(err) {
+		return
+	}
+	CheckErr("Erro ao ler o arquivo de snapshots", err)
+
+	err = json.Unmarshal(data, &stackSnapshots)
+	CheckErr("Erro ao converter o arquivo de snapshots", err)
+}
+
+// saveSnapshots persiste os snapshots no arquivo. Deve ser chamada com o
+// snapshotsMutex travado
+func saveSnapshots() {
+	data, err := json.MarshalIndent(stackSnapshots, "", "  ")
+	CheckErr("Erro ao converter os snapshots", err)
+
+	err = ioutil.WriteFile(SnapshotsFile, data, 0600)
+	CheckErr("Erro ao salvar o arquivo de snapshots", err)
+}
+
+// AddSnapshot salva o snapshot, mantendo só os SnapshotsKeep mais recentes
+// da stack no ambiente, e retorna o snapshot salvo. Quando já existe um
+// snapshot da stack com o mesmo ID (tirado no mesmo segundo), o ID recebe um
+// sufixo (-2, -3...) para o FindSnapshot não confundir os dois
+func AddSnapshot(snapshot StackSnapshot) StackSnapshot {
+	snapshotsMutex.Lock()
+	defer snapshotsMutex.Unlock()
+
+	loadSnapshots()
+
+	base := snapshot.ID
+	for n := 2; snapshotExists(snapshot); n++ {
+		snapshot.ID = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	stackSnapshots = append(stackSnapshots, snapshot)
+
+	var kept []StackSnapshot
+	count := 0
+	for i := len(stackSnapshots) - 1; i >= 0; i-- {
+		current := stackSnapshots[i]
+		if current.Stack == snapshot.Stack && current.Environment == snapshot.Environment {
+			count++
+			if count > SnapshotsKeep {
+				log.Printf("[INFO] Snapshot %s da stack %s removido, mais antigo que os %d mantidos\n", current.ID, current.Stack, SnapshotsKeep)
+				continue
+			}
+		}
+		kept = append([]StackSnapshot{current}, kept...)
+	}
+	stackSnapshots = kept
+
+	saveSnapshots()
+
+	return snapshot
+}
+
+// snapshotExists indica se já existe um snapshot com o ID na stack e no
+// ambiente do snapshot. Deve ser chamada com o snapshotsMutex travado
+func snapshotExists(snapshot StackSnapshot) bool {
+	for _, current := range stackSnapshots {
+		if current.ID == snapshot.ID && current.Stack == snapshot.Stack && current.Environment == snapshot.Environment {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StackSnapshots retorna os snapshots da stack no ambiente, do mais recente
+// para o mais antigo
+func StackSnapshots(stack string, environment string) []StackSnapshot {
+	snapshotsMutex.Lock()
+	defer snapshotsMutex.Unlock()
+
+	loadSnapshots()
+
+	var list []StackSnapshot
+	for _, snapshot := range stackSnapshots {
+		if snapshot.Stack == stack && snapshot.Environment == environment {
+			list = append(list, snapshot)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+
+	return list
+}
+
+// FindSnapshot busca o snapshot da stack no ambiente pelo ID
+func FindSnapshot(stack string, environment string, ID string) (*StackSnapshot, error) {
+	for _, snapshot := range StackSnapshots(stack, environment) {
+		if snapshot.ID == ID {
+			return &snapshot, nil
+		}
+	}
+
+	return nil, fmt.Errorf("snapshot `%s` da stack `%s` não encontrado no ambiente `%s`", ID, stack, environment)
+}
+
+// ExportStackConfig retorna o docker-compose e o rancher-compose da stack,
+// como o "Export Config" da interface do Rancher
+func (ranchListener *RancherListener) ExportStackConfig(ID string) (string, string, error) {
+	var config rancher.ComposeConfig
+	if err := ranchListener.api().Post(ranchListener.context(), fmt.Sprintf("stacks/%s?action=exportconfig", ID), "{}", &config); err != nil {
+		return "", "", err
+	}
+
+	return config.DockerComposeConfig, config.RancherComposeConfig, nil
+}
+
+// findStack busca a stack pelo nome, nil quando ela não existe
+func findStack(listener *RancherListener, name string) (*Stack, error) {
+	stacks, err := listener.ListStacks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stack := range stacks {
+		if stack.Name == name {
+			return &stack, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// stackScales retorna a escala de cada serviço da stack, pelo nome
+func stackScales(listener *RancherListener, stackName string) (map[string]int, error) {
+	services, err := stackServices(listener, stackName)
+	if err != nil {
+		return nil, err
+	}
+
+	scales := map[string]int{}
+	for name, service := range services {
+		scales[name] = service.Scale
+	}
+
+	return scales, nil
+}
+
+// TakeSnapshot exporta a definição atual da stack e salva o snapshot
+func TakeSnapshot(stackName string, user string) (*StackSnapshot, error) {
+	stack, err := findStack(rancherListener, stackName)
+	if err != nil {
+		return nil, err
+	}
+	if stack == nil {
+		return nil, fmt.Errorf("stack `%s` não encontrada", stackName)
+	}
+
+	dockerCompose, rancherCompose, err := rancherListener.ExportStackConfig(stack.ID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao exportar a stack `%s`: %s", stackName, err)
+	}
+
+	scales, err := stackScales(rancherListener, stackName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	snapshot := StackSnapshot{
+		ID:             localTime(now, "20060102-150405"),
+		Stack:          stackName,
+		Environment:    orchestratorEnvironment,
+		DockerCompose:  dockerCompose,
+		RancherCompose: rancherCompose,
+		Scales:         scales,
+		User:           user,
+		Created:        now,
+	}
+	snapshot = AddSnapshot(snapshot)
+
+	return &snapshot, nil
+}
+
+// scaleDiff lista os serviços com a escala diferente do snapshot
+func scaleDiff(current map[string]int, snapshot map[string]int) []string {
+	var lines []string
+	for name, scale := range snapshot {
+		if now, ok := current[name]; !ok {
+			lines = append(lines, fmt.Sprintf("`%s`: recriado com %d", name, scale))
+		} else if now != scale {
+			lines = append(lines, fmt.Sprintf("`%s`: %d -> %d", name, now, scale))
+		}
+	}
+	for name := range current {
+		if _, ok := snapshot[name]; !ok {
+			lines = append(lines, fmt.Sprintf("`%s`: não está no snapshot, é mantido", name))
+		}
+	}
+	sort.Strings(lines)
+
+	return lines
+}
+
+// snapshotPreviewAttachment é a prévia do restore: o diff do docker-compose,
+// do rancher-compose e das escalas atuais para o snapshot, com os botões
+func snapshotPreviewAttachment(restore *snapshotRestore, ID string) slack.Attachment {
+	snapshot := restore.Snapshot
+
+	attachment := slack.Attachment{
+		Title:      fmt.Sprintf(":rewind: Restore da stack `%s` para o snapshot `%s`", snapshot.Stack, snapshot.ID),
+		Text:       fmt.Sprintf("Snapshot de %s por @%s, ambiente `%s`", slackDate(snapshot.Created), snapshot.User, snapshot.Environment),
+		Color:      "#0C648A",
+		CallbackID: actionSnapshotRestore,
+	}
+
+	if restore.StackID == "" {
+		attachment.Text += fmt.Sprintf("\nA stack não existe mais e será criada com %d serviços", len(snapshot.Scales))
+	} else {
+		dockerCompose, rancherCompose, err := rancherListener.ExportStackConfig(restore.StackID)
+		if err != nil {
+			CheckErr("Erro ao exportar a stack "+restore.StackID, err)
+			attachment.Text += fmt.Sprintf("\n:warning: Erro ao buscar a definição atual, sem o diff: %s", err)
+		}
+
+		diff := strings.TrimSpace(lineDiff(dockerCompose, snapshot.DockerCompose) + "\n" + lineDiff(rancherCompose, snapshot.RancherCompose))
+		diff = RedactText(diff)
+		if diff == "" {
+			diff = "Sem diferenças no docker-compose e no rancher-compose"
+		} else {
+			diff = "```" + truncateText(diff, snapshotDiffMax) + "```"
+		}
+		attachment.Fields = append(attachment.Fields, slack.AttachmentField{Title: "Diff", Value: diff})
+
+		current, err := stackScales(rancherListener, snapshot.Stack)
+		CheckErr("Erro ao buscar as escalas da stack "+snapshot.Stack, err)
+		if lines := scaleDiff(current, snapshot.Scales); len(lines) > 0 {
+			attachment.Fields = append(attachment.Fields, slack.AttachmentField{Title: "Escala", Value: strings.Join(lines, "\n")})
+		}
+	}
+
+	attachment.Actions = []slack.AttachmentAction{
+		{
+			Name: actionSnapshotRestore, Text: "Restaurar", Type: "button", Style: "danger", Value: ID,
+			Confirm: &slack.ConfirmationField{Title: "Restaurar a stack?", Text: fmt.Sprintf("A stack %s volta para o snapshot %s", snapshot.Stack, snapshot.ID), OkText: "Restaurar", DismissText: "Cancelar"},
+		},
+		{Name: actionSnapshotDiscard, Text: "Descartar", Type: "button", Value: ID},
+	}
+
+	return attachment
+}
+
+// slackSnapshot salva a definição atual da stack (serviços, configurações e
+// escala)
+func (s *SlackListener) slackSnapshot(ev *slack.MessageEvent) {
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+	stackName := args.Positional[0]
+
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", stackSnapshot), false))
+		return
+	}
+
+	if tenant := TenantForChannel(ev.Channel); tenant != nil && !tenant.AllowsStack(stackName) {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: A stack `%s` não é do time `%s`", stackName, tenant.Name), false))
+		return
+	}
+
+	userName := ev.Msg.User
+	if info, err := s.client.GetUserInfo(ev.Msg.User); err == nil && info.Name != "" {
+		userName = info.Name
+	}
+
+	snapshot, err := TakeSnapshot(stackName, userName)
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(":x: "+err.Error(), false))
+		return
+	}
+
+	log.Printf("[INFO] Snapshot %s da stack %s salvo pelo usuário %s\n", snapshot.ID, stackName, userName)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":camera: Snapshot `%s` da stack `%s` salvo com %d serviços. Para voltar: `%s %s %s`", snapshot.ID, stackName, len(snapshot.Scales), stackRestore, stackName, snapshot.ID), false))
+}
+
+// slackRestore mostra a prévia do restore da stack para o snapshot ou, sem o
+// ID, os snapshots da stack
+func (s *SlackListener) slackRestore(ev *slack.MessageEvent) {
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+	stackName := args.Positional[0]
+
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", stackRestore), false))
+		return
+	}
+
+	if tenant := TenantForChannel(ev.Channel); tenant != nil && !tenant.AllowsStack(stackName) {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":no_entry: A stack `%s` não é do time `%s`", stackName, tenant.Name), false))
+		return
+	}
+
+	if len(args.Positional) < 2 {
+		snapshots := StackSnapshots(stackName, orchestratorEnvironment)
+		if len(snapshots) == 0 {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Nenhum snapshot da stack `%s` no ambiente `%s`, crie com `%s %s`", stackName, orchestratorEnvironment, stackSnapshot, stackName), false))
+			return
+		}
+
+		var lines []string
+		for _, snapshot := range snapshots {
+			lines = append(lines, fmt.Sprintf("`%s` %s por @%s, %d serviços", snapshot.ID, slackDate(snapshot.Created), snapshot.User, len(snapshot.Scales)))
+		}
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":camera: Snapshots da stack `%s`:\n%s", stackName, strings.Join(lines, "\n")), false))
+		return
+	}
+
+	snapshot, err := FindSnapshot(stackName, orchestratorEnvironment, args.Positional[1])
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(":x: "+err.Error(), false))
+		return
+	}
+
+	stack, err := findStack(rancherListener, stackName)
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao buscar as stacks: %s", err), false))
+		return
+	}
+
+	restore := &snapshotRestore{Snapshot: *snapshot, Created: time.Now()}
+	if stack != nil {
+		restore.StackID = stack.ID
+	}
+
+	ID := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	snapshotPendingMutex.Lock()
+	for key, pending := range snapshotPending {
+		if time.Since(pending.Created) > snapshotPendingTTL {
+			delete(snapshotPending, key)
+		}
+	}
+	snapshotPending[ID] = restore
+	snapshotPendingMutex.Unlock()
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(snapshotPreviewAttachment(restore, ID)))
+}
+
+// takeSnapshotPending retira o restore pendente, nil quando ele expirou
+func takeSnapshotPending(ID string) *snapshotRestore {
+	snapshotPendingMutex.Lock()
+	defer snapshotPendingMutex.Unlock()
+
+	pending, ok := snapshotPending[ID]
+	delete(snapshotPending, ID)
+	if !ok || time.Since(pending.Created) > snapshotPendingTTL {
+		return nil
+	}
+
+	return pending
+}
+
+// restoreScales volta as escalas dos serviços para as do snapshot, caso o
+// upgrade da stack não tenha alterado
+func restoreScales(snapshot StackSnapshot) error {
+	services, err := stackServices(rancherListener, snapshot.Stack)
+	if err != nil {
+		return err
+	}
+
+	for name, scale := range snapshot.Scales {
+		service, ok := services[name]
+		if !ok || service.Scale == scale {
+			continue
+		}
+
+		if rancherListener.ScaleService(service.ID, scale) == "" {
+			return fmt.Errorf("erro ao escalar o serviço `%s` para %d", name, scale)
+		}
+	}
+
+	return nil
+}
+
+// actionSnapshotRestoreFunction aplica o snapshot na stack, como job, criando
+// a stack quando ela não existe mais e voltando as escalas
+func actionSnapshotRestoreFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	restore := takeSnapshotPending(message.Actions[0].Value)
+	if restore == nil {
+		respondWithoutActions(w, message.OriginalMessage, ":hourglass: Essa prévia expirou, use o restore de novo", "")
+		return
+	}
+
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":rewind: Restore iniciado por @%s", message.User.Name), "")
+
+	snapshot := restore.Snapshot
+	channel, user := message.Channel.ID, message.User.Name
+	job, err := EnqueueJobContext("restore da stack "+snapshot.Stack, user, func(ctx context.Context) error {
+		progress := StartProgress(channel, fmt.Sprintf("*Restore* da stack `%s` para o snapshot `%s`, por @%s", snapshot.Stack, snapshot.ID, user), JobFromContext(ctx))
+
+		var stack *Stack
+		var err error
+		if restore.StackID == "" {
+			progress.Update(0, 0, "criando a stack")
+			stack, err = rancherListener.CreateStack(snapshot.Stack, snapshot.DockerCompose, snapshot.RancherCompose)
+		} else {
+			progress.Update(0, 0, "iniciando o upgrade")
+			stack, err = rancherListener.UpgradeStackConfig(restore.StackID, snapshot.DockerCompose, snapshot.RancherCompose)
+		}
+		if err != nil {
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		state, err := finishStack(ctx, rancherListener, stack.ID, progress)
+		if err != nil {
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		progress.Update(0, 0, "ajustando as escalas")
+		if err := restoreScales(snapshot); err != nil {
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		log.Printf("[INFO] Stack %s restaurada para o snapshot %s pelo usuário %s\n", snapshot.Stack, snapshot.ID, user)
+		progress.Finish(true, fmt.Sprintf("stack `%s` (%s) `%s` no snapshot `%s`", snapshot.Stack, stack.ID, state, snapshot.ID))
+		return nil
+	})
+	interactionJob(w, job, err)
+	if err != nil {
+		sendMessage(queuedJobMessage(job, err))
+	}
+}
+
+func actionSnapshotDiscardFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	takeSnapshotPending(message.Actions[0].Value)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":x: Restore descartado por @%s", message.User.Name), "")
+}
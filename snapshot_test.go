@@ -0,0 +1,30 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScaleDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  map[string]int
+		snapshot map[string]int
+		lines    []string
+	}{
+		{"iguais", map[string]int{"api": 2}, map[string]int{"api": 2}, nil},
+		{"escala alterada", map[string]int{"api": 4, "worker": 1}, map[string]int{"api": 2, "worker": 1}, []string{"`api`: 4 -> 2"}},
+		{"serviço removido", map[string]int{"api": 2}, map[string]int{"api": 2, "worker": 3}, []string{"`worker`: recriado com 3"}},
+		{"serviço novo", map[string]int{"api": 2, "cron": 1}, map[string]int{"api": 2}, []string{"`cron`: não está no snapshot, é mantido"}},
+		{"stack removida", nil, map[string]int{"worker": 1, "api": 2}, []string{"`api`: recriado com 2", "`worker`: recriado com 1"}},
+	}
+
+	for _, test := range tests {
+		if lines := scaleDiff(test.current, test.snapshot); !reflect.DeepEqual(lines, test.lines) {
+			t.Errorf("%s: scaleDiff = %v, esperado %v", test.name, lines, test.lines)
+		}
+	}
+}
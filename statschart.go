@@ -0,0 +1,311 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/rgamba/evtwebsocket"
+	"github.com/tidwall/gjson"
+	"github.com/wcharczuk/go-chart"
+)
+
+var (
+	// StatsDuration é o tempo de coleta das amostras do stats, quando o
+	// duration=N não é informado
+	StatsDuration = time.Minute
+
+	// StatsMaxDuration é o tempo máximo de coleta aceito no duration=N
+	StatsMaxDuration = 10 * time.Minute
+)
+
+// statsPoint é uma amostra de CPU (%) e memória (bytes) de um container
+type statsPoint struct {
+	Time   time.Time
+	CPU    float64
+	Memory int64
+}
+
+// collectHostStats coleta as amostras do WebSocket de estatísticas do host
+// até o fim do período ou do ctx, apenas dos containers informados (pelo
+// externalId). O uso de CPU é a diferença do tempo de CPU entre amostras
+func collectHostStats(ctx context.Context, hostID string, names map[string]string, duration time.Duration) (map[string][]statsPoint, error) {
+	var mutex sync.Mutex
+	series := map[string][]statsPoint{}
+	previous := map[string]gjson.Result{}
+
+	conn := &evtwebsocket.Conn{
+		OnMessage: func(msg []byte, w *evtwebsocket.Conn) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			for _, stat := range gjson.ParseBytes(msg).Array() {
+				id := stat.Get("id").String()
+
+				name, ok := names[id]
+				if !ok {
+					continue
+				}
+
+				last, ok := previous[id]
+				previous[id] = stat
+				if !ok {
+					continue
+				}
+
+				start, _ := time.Parse(time.RFC3339Nano, last.Get("timestamp").String())
+				end, _ := time.Parse(time.RFC3339Nano, stat.Get("timestamp").String())
+				elapsed := end.Sub(start)
+				if elapsed <= 0 {
+					continue
+				}
+
+				series[name] = append(series[name], statsPoint{
+					Time:   end,
+					CPU:    float64(stat.Get("cpu.usage.total").Int()-last.Get("cpu.usage.total").Int()) / float64(elapsed.Nanoseconds()) * 100,
+					Memory: stat.Get("memory.usage").Int(),
+				})
+			}
+		},
+
+		OnError: func(err error) {
+			log.Printf("[ERROR] Erro nas estatísticas do host %s: %s\n", hostID, err.Error())
+		},
+	}
+
+	if err := conn.Dial(rancherListener.ContainerStatsWebSocketURL(hostID), ""); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(duration):
+	}
+	conn.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return series, nil
+}
+
+// CollectServiceStats coleta as amostras dos containers rodando do serviço,
+// em paralelo nos hosts onde eles estão, pelo nome do container
+func CollectServiceStats(ctx context.Context, instances []Container, duration time.Duration) map[string][]statsPoint {
+	byHost := map[string]map[string]string{}
+	for _, container := range instances {
+		if container.State != "running" || container.ExternalID == "" {
+			continue
+		}
+		if byHost[container.HostID] == nil {
+			byHost[container.HostID] = map[string]string{}
+		}
+		byHost[container.HostID][container.ExternalID] = container.Name
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	series := map[string][]statsPoint{}
+
+	for hostID, names := range byHost {
+		wg.Add(1)
+		go func(hostID string, names map[string]string) {
+			defer wg.Done()
+
+			hostSeries, err := collectHostStats(ctx, hostID, names, duration)
+			if err != nil {
+				CheckErr("Erro ao conectar no WebSocket de estatísticas do host "+hostID, err)
+				return
+			}
+
+			mutex.Lock()
+			for name, points := range hostSeries {
+				series[name] = points
+			}
+			mutex.Unlock()
+		}(hostID, names)
+	}
+	wg.Wait()
+
+	return series
+}
+
+// RenderStatsChart desenha uma linha por container com o valor das amostras
+// (a CPU ou a memória) em um PNG
+func RenderStatsChart(title string, unit string, series map[string][]statsPoint, value func(statsPoint) float64) ([]byte, error) {
+	var names []string
+	for name := range series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	graph := chart.Chart{
+		Title:  title,
+		Width:  1024,
+		Height: 400,
+		XAxis:  chart.XAxis{Style: chart.Style{Show: true}, ValueFormatter: chart.TimeValueFormatterWithFormat("15:04:05")},
+		YAxis:  chart.YAxis{Name: unit, Style: chart.Style{Show: true}},
+	}
+
+	for _, name := range names {
+		line := chart.TimeSeries{Name: name}
+		for _, point := range series[name] {
+			line.XValues = append(line.XValues, point.Time)
+			line.YValues = append(line.YValues, value(point))
+		}
+
+		// O go-chart precisa de pelo menos dois pontos por linha
+		if len(line.XValues) > 1 {
+			graph.Series = append(graph.Series, line)
+		}
+	}
+	if len(graph.Series) == 0 {
+		return nil, fmt.Errorf("amostras insuficientes para o gráfico")
+	}
+
+	graph.Elements = []chart.Renderable{chart.Legend(&graph)}
+
+	var buf bytes.Buffer
+	if err := graph.Render(chart.PNG, &buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// statsSummary resume a última amostra e o pico de cada container
+func statsSummary(series map[string][]statsPoint) string {
+	var names []string
+	for name := range series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		points := series[name]
+		if len(points) == 0 {
+			continue
+		}
+
+		var maxCPU float64
+		var maxMemory int64
+		for _, point := range points {
+			if point.CPU > maxCPU {
+				maxCPU = point.CPU
+			}
+			if point.Memory > maxMemory {
+				maxMemory = point.Memory
+			}
+		}
+
+		last := points[len(points)-1]
+		lines = append(lines, fmt.Sprintf("`%s` CPU %.1f%% (pico %.1f%%), memória %d MiB (pico %d MiB)", name, last.CPU, maxCPU, last.Memory>>20, maxMemory>>20))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// uploadStatsCharts envia os gráficos de CPU e de memória no canal, com o
+// resumo no comentário do primeiro
+func uploadStatsCharts(channel string, serviceName string, series map[string][]statsPoint, duration time.Duration) error {
+	charts := []struct {
+		Name  string
+		Unit  string
+		Value func(statsPoint) float64
+	}{
+		{Name: "cpu", Unit: "CPU (%)", Value: func(p statsPoint) float64 { return p.CPU }},
+		{Name: "memoria", Unit: "Memória (MiB)", Value: func(p statsPoint) float64 { return float64(p.Memory) / (1024 * 1024) }},
+	}
+
+	api := getAPIConnection()
+	for i, c := range charts {
+		image, err := RenderStatsChart(fmt.Sprintf("%s - %s", serviceName, c.Unit), c.Unit, series, c.Value)
+		if err != nil {
+			return err
+		}
+
+		params := slack.FileUploadParameters{
+			Reader:   bytes.NewReader(image),
+			Filetype: "png",
+			Filename: fmt.Sprintf("stats-%s-%s.png", serviceName, c.Name),
+			Title:    fmt.Sprintf("%s do serviço %s", c.Unit, serviceName),
+			Channels: []string{channel},
+		}
+		if i == 0 {
+			params.InitialComment = fmt.Sprintf(":chart_with_upwards_trend: Estatísticas do serviço `%s` nos últimos %s:\n%s", serviceName, formatDuration(duration), statsSummary(series))
+		}
+
+		if _, err := api.client.UploadFile(params); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// slackStats coleta as estatísticas dos containers do serviço por um curto
+// período e envia os gráficos de CPU e de memória no canal
+func (s *SlackListener) slackStats(ev *slack.MessageEvent) {
+	args := ParseCommandArgs(strings.Fields(ev.Msg.Text)[1:])
+
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`%s` só está disponível no Rancher", serviceStats), false))
+		return
+	}
+
+	duration := StatsDuration
+	if value, ok := args.Options["duration"]; ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 10*time.Second || parsed > StatsMaxDuration {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("`duration` deve ser entre 10s e %s, recebido `%s`", formatDuration(StatsMaxDuration), value), false))
+			return
+		}
+		duration = parsed
+	}
+
+	serviceID, ok := s.resolveServiceArg(ev.Channel, args.Positional[0])
+	if !ok {
+		return
+	}
+
+	instances, err := rancherListener.ListServiceInstances(serviceID)
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao buscar as instâncias do serviço `%s`: %s", serviceID, err), false))
+		return
+	}
+
+	channel, name := ev.Channel, serviceIndex.Name(serviceID)
+	job, err := EnqueueJobContext("estatísticas do serviço "+serviceID, ev.Msg.User, func(ctx context.Context) error {
+		progress := StartProgress(channel, fmt.Sprintf("*Estatísticas* do serviço `%s`", name), JobFromContext(ctx))
+		progress.Update(0, 0, fmt.Sprintf("coletando as amostras por %s", formatDuration(duration)))
+
+		series := CollectServiceStats(ctx, instances, duration)
+		if len(series) == 0 {
+			err := fmt.Errorf("nenhuma amostra dos containers do serviço")
+			progress.Finish(false, err.Error())
+			return err
+		}
+
+		if err := uploadStatsCharts(channel, name, series, duration); err != nil {
+			CheckErr("Erro ao enviar os gráficos do serviço "+serviceID, err)
+			progress.Finish(false, "Erro ao enviar os gráficos: "+err.Error())
+			return err
+		}
+
+		progress.Finish(true, fmt.Sprintf("%d containers amostrados", len(series)))
+		return nil
+	})
+	if err != nil {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(queuedJobMessage(job, err), false))
+	}
+}
@@ -0,0 +1,217 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	statusCallback      = "status"
+	actionStatusRefresh = "status-refresh"
+
+	// statusMaxItems é a quantidade máxima de nomes listados em cada item
+	statusMaxItems = 5
+)
+
+// statusServiceStates são os estados de serviço mostrados no status, os
+// demais são somados em "outros"
+var statusServiceStates = []string{"active", "degraded", "upgrading", "upgraded", "inactive"}
+
+// statusList junta os nomes em uma lista curta, avisando quantos ficaram de fora
+func statusList(names []string) string {
+	sort.Strings(names)
+
+	if len(names) > statusMaxItems {
+		return fmt.Sprintf("`%s` e mais %d", strings.Join(names[:statusMaxItems], "`, `"), len(names)-statusMaxItems)
+	}
+
+	return "`" + strings.Join(names, "`, `") + "`"
+}
+
+// StatusAttachment monta o resumo do ambiente: serviços por estado,
+// containers com problema, hosts fora do ar e Canaries ativos. Usa o cache
+// do Rancher, então não gera chamadas na API a cada uso
+func StatusAttachment() slack.Attachment {
+	var fields []slack.AttachmentField
+	color := "good"
+
+	alert := func(level string) {
+		if level == "danger" || color == "good" {
+			color = level
+		}
+	}
+
+	services, err := statusServices()
+	if err != nil {
+		CheckErr("Erro ao listar os serviços no status", err)
+		fields = append(fields, slack.AttachmentField{Title: "Serviços", Value: fmt.Sprintf(":x: %s", err)})
+		alert("danger")
+	} else {
+		counts := map[string]int{}
+		byState := map[string][]string{}
+		for _, service := range services {
+			state := service.State
+			if !containsString(statusServiceStates, state) {
+				state = "outros"
+			}
+
+			counts[state]++
+			byState[state] = append(byState[state], service.Name)
+		}
+
+		var summary []string
+		for _, state := range append(statusServiceStates, "outros") {
+			if counts[state] > 0 {
+				summary = append(summary, fmt.Sprintf("%s: *%d*", state, counts[state]))
+			}
+		}
+
+		value := strings.Join(summary, " | ")
+		for _, state := range []string{"degraded", "upgrading", "upgraded"} {
+			if counts[state] > 0 {
+				value += fmt.Sprintf("\n%s: %s", state, statusList(byState[state]))
+				alert("warning")
+			}
+		}
+
+		fields = append(fields, slack.AttachmentField{Title: fmt.Sprintf("Serviços (%d)", len(services)), Value: value})
+	}
+
+	if orchestrator.Name() == "rancher" {
+		fields = append(fields, statusContainers(alert), statusHosts(alert), statusCanaries())
+	}
+
+	return slack.Attachment{
+		Title:      fmt.Sprintf("Status do ambiente %s (%s)", orchestratorEnvironment, orchestrator.Name()),
+		Color:      color,
+		Fields:     fields,
+		Footer:     fmt.Sprintf("Atualizado às %s", localTime(time.Now(), "15:04:05")),
+		CallbackID: statusCallback,
+		Actions: []slack.AttachmentAction{
+			{
+				Name: actionStatusRefresh,
+				Text: "Atualizar",
+				Type: "button",
+			},
+		},
+	}
+}
+
+// statusServices lista os serviços do orquestrador. No Rancher o estado não
+// indica a saúde, então os serviços ativos com health check falhando
+// aparecem como degraded
+func statusServices() ([]Workload, error) {
+	if orchestrator.Name() != "rancher" {
+		return orchestrator.ListServices()
+	}
+
+	data, err := rancherListener.ListServices()
+	if err != nil {
+		return nil, err
+	}
+
+	var services []Workload
+	for _, service := range data {
+		workload := rancherWorkload(service)
+		if service.State == "active" && (service.HealthState == "degraded" || service.HealthState == "unhealthy") {
+			workload.State = "degraded"
+		}
+		services = append(services, workload)
+	}
+
+	return services, nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// statusContainers lista os containers com health check falhando ou em erro
+func statusContainers(alert func(string)) slack.AttachmentField {
+	containers, err := rancherListener.ListContainers()
+	if err != nil {
+		alert("danger")
+		return slack.AttachmentField{Title: "Containers", Value: fmt.Sprintf(":x: %s", err)}
+	}
+
+	var unhealthy []string
+	for _, container := range containers {
+		if container.HealthState == "unhealthy" || container.State == "error" {
+			unhealthy = append(unhealthy, container.Name)
+		}
+	}
+
+	if len(unhealthy) == 0 {
+		return slack.AttachmentField{Title: fmt.Sprintf("Containers (%d)", len(containers)), Value: ":white_check_mark: nenhum com problema", Short: true}
+	}
+
+	alert("danger")
+	return slack.AttachmentField{Title: fmt.Sprintf("Containers com problema (%d de %d)", len(unhealthy), len(containers)), Value: statusList(unhealthy), Short: true}
+}
+
+// statusHosts lista os hosts que não estão ativos ou com o agente desconectado
+func statusHosts(alert func(string)) slack.AttachmentField {
+	hosts := gjson.Get(rancherListener.ListCachedHosts(), "data").Array()
+
+	var down []string
+	for _, host := range hosts {
+		agent := host.Get("agentState").String()
+		if host.Get("state").String() != "active" || (agent != "" && agent != "active") {
+			down = append(down, host.Get("hostname").String())
+		}
+	}
+
+	if len(down) == 0 {
+		return slack.AttachmentField{Title: fmt.Sprintf("Hosts (%d)", len(hosts)), Value: ":white_check_mark: todos no ar", Short: true}
+	}
+
+	alert("danger")
+	return slack.AttachmentField{Title: fmt.Sprintf("Hosts fora do ar (%d de %d)", len(down), len(hosts)), Value: statusList(down), Short: true}
+}
+
+// statusCanaries lista os LoadBalancers com o Canary ativo e os pesos
+func statusCanaries() slack.AttachmentField {
+	var active []string
+	for _, lb := range rancherListener.GetLoadBalancers() {
+		state := ParseCanaryState(lb.ID, lb.LbConfig.Config)
+		if state.Enabled && len(state.Weights) > 0 {
+			active = append(active, fmt.Sprintf("%s (%s)", lb.Name, strings.Join(state.Weights, "/")))
+		}
+	}
+
+	if len(active) == 0 {
+		return slack.AttachmentField{Title: "Canaries", Value: "nenhum ativo", Short: true}
+	}
+
+	return slack.AttachmentField{Title: fmt.Sprintf("Canaries ativos (%d)", len(active)), Value: statusList(active), Short: true}
+}
+
+// slackStatus envia o resumo do ambiente
+func (s *SlackListener) slackStatus(ev *slack.MessageEvent) {
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(StatusAttachment()))
+}
+
+// actionStatusRefreshFunction atualiza a mensagem do status com os dados
+// atuais, buscando de novo no Rancher
+func actionStatusRefreshFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	rancherListener.invalidateCache(cacheServices, cacheContainers, cacheHosts, cacheLoadBalancers)
+
+	getAPIConnection().client.UpdateMessage(message.Channel.ID, message.MessageTs, slack.MsgOptionAttachments(StatusAttachment()))
+}
@@ -0,0 +1,209 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/tidwall/gjson"
+)
+
+const statuspageAPIURL = "https://api.statuspage.io/v1"
+
+var (
+	// StatuspageAPIKey é a API key do Statuspage.io
+	StatuspageAPIKey string
+
+	// StatuspagePageID é o ID da página no Statuspage.io
+	StatuspagePageID string
+
+	// StatuspageComponentMap é o mapeamento do ID do serviço no Rancher para o
+	// ID do componente no Statuspage, usado na atualização automática
+	StatuspageComponentMap = map[string]string{}
+
+	// StatuspageAutoUpdate define se os componentes mapeados são atualizados
+	// sozinhos de acordo com a saúde dos serviços no Rancher
+	StatuspageAutoUpdate bool
+
+	// StatuspageCheckInterval é o intervalo entre as verificações dos serviços
+	StatuspageCheckInterval = time.Minute
+)
+
+var (
+	statuspageComponentStatus = []string{"operational", "degraded_performance", "partial_outage", "major_outage", "under_maintenance"}
+	statuspageIncidentStatus  = []string{"investigating", "identified", "monitoring", "resolved"}
+)
+
+func statuspageHeaders() map[string]string {
+	return map[string]string{"Authorization": "OAuth " + StatuspageAPIKey}
+}
+
+func validStatus(status string, valid []string) bool {
+	for _, v := range valid {
+		if status == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UpdateStatuspageComponent altera o status de um componente
+func UpdateStatuspageComponent(componentID string, status string) error {
+	url := fmt.Sprintf("%s/pages/%s/components/%s", statuspageAPIURL, StatuspagePageID, componentID)
+
+	_, err := HTTPSendJSONRequest(PatchHTTP, url, statuspageHeaders(), map[string]interface{}{
+		"component": map[string]string{"status": status},
+	})
+
+	return err
+}
+
+// CreateStatuspageIncident cria um incidente, retornando o ID e o link do incidente
+func CreateStatuspageIncident(name string, status string, body string) (string, string, error) {
+	url := fmt.Sprintf("%s/pages/%s/incidents", statuspageAPIURL, StatuspagePageID)
+
+	resp, err := HTTPSendJSONRequest(PostHTTP, url, statuspageHeaders(), map[string]interface{}{
+		"incident": map[string]string{"name": name, "status": status, "body": body},
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return gjson.Get(resp, "id").String(), gjson.Get(resp, "shortlink").String(), nil
+}
+
+// UpdateStatuspageIncident altera o status de um incidente, com uma nova mensagem
+func UpdateStatuspageIncident(incidentID string, status string, body string) error {
+	url := fmt.Sprintf("%s/pages/%s/incidents/%s", statuspageAPIURL, StatuspagePageID, incidentID)
+
+	_, err := HTTPSendJSONRequest(PatchHTTP, url, statuspageHeaders(), map[string]interface{}{
+		"incident": map[string]string{"status": status, "body": body},
+	})
+
+	return err
+}
+
+// healthToComponentStatus converte o healthState do serviço no Rancher para
+// o status do componente no Statuspage
+func healthToComponentStatus(health string) string {
+	switch health {
+	case "healthy":
+		return "operational"
+	case "degraded":
+		return "partial_outage"
+	case "unhealthy":
+		return "major_outage"
+	}
+
+	return ""
+}
+
+// WatchStatuspageComponents verifica a saúde dos serviços mapeados no
+// StatuspageComponentMap e atualiza os componentes quando ela muda
+func WatchStatuspageComponents() {
+	if !StatuspageAutoUpdate || len(StatuspageComponentMap) == 0 {
+		return
+	}
+
+	log.Printf("[INFO] Atualizando automaticamente %d componentes do Statuspage\n", len(StatuspageComponentMap))
+
+	last := map[string]string{}
+
+	for {
+		for serviceID, componentID := range StatuspageComponentMap {
+			service, err := rancherListener.GetService(serviceID)
+			if err != nil {
+				CheckErr("Erro ao buscar o serviço "+serviceID, err)
+				continue
+			}
+
+			status := healthToComponentStatus(service.HealthState)
+
+			if status == "" || status == last[serviceID] {
+				continue
+			}
+
+			if err := UpdateStatuspageComponent(componentID, status); err != nil {
+				CheckErr("Erro ao atualizar componente do Statuspage", err)
+				continue
+			}
+
+			// Na primeira verificação só guarda o status, sem avisar no canal
+			if last[serviceID] != "" {
+				sendNotification(fmt.Sprintf(":satellite: Componente do serviço `%s` no Statuspage alterado para `%s`", service.Name, status))
+			}
+
+			last[serviceID] = status
+		}
+
+		time.Sleep(StatuspageCheckInterval)
+	}
+}
+
+func (s *SlackListener) slackStatuspageComponent(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) != 4 || !validStatus(args[3], statuspageComponentStatus) {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s id-componente|id-serviço %s", spComponent, strings.Join(statuspageComponentStatus, "|")), false))
+		return
+	}
+
+	componentID := args[2]
+	if mapped, ok := StatuspageComponentMap[componentID]; ok {
+		componentID = mapped
+	}
+
+	if err := UpdateStatuspageComponent(componentID, args[3]); err != nil {
+		CheckErr("Erro ao atualizar componente do Statuspage", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao atualizar o componente no Statuspage: %s", err), false))
+		return
+	}
+
+	log.Printf("[INFO] Componente %s do Statuspage alterado para %s pelo usuário %s\n", componentID, args[3], ev.Msg.User)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Componente `%s` alterado para `%s` no Statuspage :satellite:", args[2], args[3]), false))
+}
+
+func (s *SlackListener) slackStatuspageIncident(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) < 4 || !validStatus(args[2], statuspageIncidentStatus) {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s %s título do incidente", spIncident, strings.Join(statuspageIncidentStatus, "|")), false))
+		return
+	}
+
+	name := strings.Join(args[3:], " ")
+
+	id, link, err := CreateStatuspageIncident(name, args[2], "")
+	if err != nil {
+		CheckErr("Erro ao criar incidente no Statuspage", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao criar o incidente no Statuspage: %s", err), false))
+		return
+	}
+
+	log.Printf("[INFO] Incidente %s criado no Statuspage pelo usuário %s\n", id, ev.Msg.User)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Incidente `%s` criado no Statuspage: %s\nPara atualizar: `%s %s status mensagem`", name, link, spUpdate, id), false))
+}
+
+func (s *SlackListener) slackStatuspageUpdate(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) < 4 || !validStatus(args[3], statuspageIncidentStatus) {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s id-incidente %s mensagem", spUpdate, strings.Join(statuspageIncidentStatus, "|")), false))
+		return
+	}
+
+	if err := UpdateStatuspageIncident(args[2], args[3], strings.Join(args[4:], " ")); err != nil {
+		CheckErr("Erro ao atualizar incidente no Statuspage", err)
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro ao atualizar o incidente no Statuspage: %s", err), false))
+		return
+	}
+
+	log.Printf("[INFO] Incidente %s do Statuspage atualizado pelo usuário %s\n", args[2], ev.Msg.User)
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Incidente `%s` atualizado para `%s` no Statuspage :satellite:", args[2], args[3]), false))
+}
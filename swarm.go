@@ -0,0 +1,277 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var (
+	// SwarmHost é o endereço da API do Docker de um manager do Swarm
+	// (unix:///var/run/docker.sock ou tcp://host:2376)
+	SwarmHost = "unix:///var/run/docker.sock"
+
+	// SwarmCertPath é o diretório com ca.pem, cert.pem e key.pem para acessar
+	// a API do Docker via TCP com TLS
+	SwarmCertPath string
+)
+
+// swarmOrchestrator é a implementação do Orchestrator para o Docker Swarm,
+// usando a API do Docker Engine. Os IDs são os IDs (ou nomes) dos serviços
+type swarmOrchestrator struct {
+	client  *http.Client
+	baseURL string
+}
+
+func newSwarmOrchestrator() (*swarmOrchestrator, error) {
+	u, err := url.Parse(SwarmHost)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{}
+	s := &swarmOrchestrator{client: &http.Client{Timeout: 60 * time.Second, Transport: transport}}
+
+	switch u.Scheme {
+	case "unix":
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", u.Path)
+		}
+		s.baseURL = "http://docker"
+	case "tcp":
+		s.baseURL = "http://" + u.Host
+
+		if SwarmCertPath != "" {
+			cert, err := tls.LoadX509KeyPair(SwarmCertPath+"/cert.pem", SwarmCertPath+"/key.pem")
+			if err != nil {
+				return nil, err
+			}
+
+			ca, err := ioutil.ReadFile(SwarmCertPath + "/ca.pem")
+			if err != nil {
+				return nil, err
+			}
+
+			pool := x509.NewCertPool()
+			pool.AppendCertsFromPEM(ca)
+
+			transport.TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool}
+			s.baseURL = "https://" + u.Host
+		}
+	default:
+		return nil, fmt.Errorf("endereço do Docker %s não suportado", SwarmHost)
+	}
+
+	return s, nil
+}
+
+func (s *swarmOrchestrator) Name() string {
+	return "swarm"
+}
+
+func (s *swarmOrchestrator) request(method string, path string, body interface{}) (string, error) {
+	return HTTPSendJSONRequestWithClient(s.client, method, s.baseURL+path, nil, body)
+}
+
+// runningTasks retorna as tasks em execução do serviço
+func (s *swarmOrchestrator) runningTasks(serviceID string) ([]gjson.Result, error) {
+	filters := url.QueryEscape(fmt.Sprintf(`{"service":["%s"],"desired-state":["running"]}`, serviceID))
+
+	resp, err := s.request(GetHTTP, "/tasks?filters="+filters, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return gjson.Parse(resp).Array(), nil
+}
+
+func (s *swarmOrchestrator) workload(service gjson.Result) Workload {
+	w := Workload{
+		ID:       service.Get("ID").String(),
+		Name:     service.Get("Spec.Name").String(),
+		Image:    strings.SplitN(service.Get("Spec.TaskTemplate.ContainerSpec.Image").String(), "@", 2)[0],
+		Replicas: int(service.Get("Spec.Mode.Replicated.Replicas").Int()),
+		Created:  service.Get("CreatedAt").String(),
+	}
+
+	if tasks, err := s.runningTasks(w.ID); err == nil {
+		for _, task := range tasks {
+			if task.Get("Status.State").String() == "running" {
+				w.Ready++
+			}
+		}
+
+		// Serviços globais rodam uma task por nó
+		if !service.Get("Spec.Mode.Replicated").Exists() {
+			w.Replicas = len(tasks)
+		}
+	}
+
+	switch {
+	case w.Replicas == 0:
+		w.State = "inactive"
+	case w.Ready == w.Replicas:
+		w.State = "active"
+	default:
+		w.State = "degraded"
+	}
+
+	if service.Get("UpdateStatus.State").String() == "updating" {
+		w.State = "updating"
+	}
+
+	return w
+}
+
+func (s *swarmOrchestrator) ListServices() ([]Workload, error) {
+	resp, err := s.request(GetHTTP, "/services", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var services []Workload
+	for _, service := range gjson.Parse(resp).Array() {
+		services = append(services, s.workload(service))
+	}
+
+	return services, nil
+}
+
+func (s *swarmOrchestrator) GetService(ID string) (*Workload, error) {
+	resp, err := s.request(GetHTTP, "/services/"+url.PathEscape(ID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	w := s.workload(gjson.Parse(resp))
+
+	return &w, nil
+}
+
+// updateSpec altera a spec do serviço e envia o update, como o "docker service update"
+func (s *swarmOrchestrator) updateSpec(ID string, change func(spec string) (string, error)) error {
+	resp, err := s.request(GetHTTP, "/services/"+url.PathEscape(ID), nil)
+	if err != nil {
+		return err
+	}
+
+	spec, err := change(gjson.Get(resp, "Spec").Raw)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/services/%s/update?version=%d", url.PathEscape(ID), gjson.Get(resp, "Version.Index").Int())
+	_, err = s.request(PostHTTP, path, spec)
+
+	return err
+}
+
+// RestartService faz o mesmo que o "docker service update --force"
+func (s *swarmOrchestrator) RestartService(ID string) error {
+	return s.updateSpec(ID, func(spec string) (string, error) {
+		return sjson.Set(spec, "TaskTemplate.ForceUpdate", gjson.Get(spec, "TaskTemplate.ForceUpdate").Int()+1)
+	})
+}
+
+func (s *swarmOrchestrator) ScaleService(ID string, replicas int) error {
+	return s.updateSpec(ID, func(spec string) (string, error) {
+		if !gjson.Get(spec, "Mode.Replicated").Exists() {
+			return "", fmt.Errorf("o serviço %s é global, não pode ser escalado", ID)
+		}
+
+		return sjson.Set(spec, "Mode.Replicated.Replicas", replicas)
+	})
+}
+
+// ServiceLogs busca ao mesmo tempo os logs de todas as tasks em execução do serviço
+func (s *swarmOrchestrator) ServiceLogs(ID string, opts LogsOptions) ([]byte, int, error) {
+	service, err := s.request(GetHTTP, "/services/"+url.PathEscape(ID), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	name := gjson.Get(service, "Spec.Name").String()
+
+	tasks, err := s.runningTasks(gjson.Get(service, "ID").String())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(tasks) == 0 {
+		return nil, 0, fmt.Errorf("nenhuma task em execução para o serviço %s", ID)
+	}
+
+	query := url.Values{}
+	query.Set("stdout", "1")
+	query.Set("stderr", "1")
+	query.Set("timestamps", "1")
+	query.Set("tail", fmt.Sprintf("%d", opts.RancherLines()))
+	if opts.Since > 0 {
+		query.Set("since", fmt.Sprintf("%d", time.Now().Add(-opts.Since).Unix()))
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var merged []serviceLogLine
+
+	for _, task := range tasks {
+		wg.Add(1)
+
+		go func(taskID string, taskName string) {
+			defer wg.Done()
+
+			content, err := s.request(GetHTTP, fmt.Sprintf("/tasks/%s/logs?%s", taskID, query.Encode()), nil)
+			if err != nil {
+				CheckErr(fmt.Sprintf("Erro ao buscar os logs da task %s", taskName), err)
+				return
+			}
+
+			lines := prefixInstanceLogs(filterLogsContent(demuxDockerLogs(content), opts), taskName)
+
+			mutex.Lock()
+			merged = append(merged, lines...)
+			mutex.Unlock()
+		}(task.Get("ID").String(), fmt.Sprintf("%s.%d", name, task.Get("Slot").Int()))
+	}
+
+	wg.Wait()
+
+	return mergeServiceLogs(merged), len(tasks), nil
+}
+
+// demuxDockerLogs separa a saída multiplexada da API de logs do Docker, onde
+// cada bloco tem um cabeçalho de 8 bytes (stream e tamanho). Containers com
+// TTY não têm os cabeçalhos e a saída é retornada como veio
+func demuxDockerLogs(content string) string {
+	data := []byte(content)
+
+	var out strings.Builder
+	for len(data) >= 8 {
+		stream := data[0]
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+
+		if stream > 2 || data[1] != 0 || data[2] != 0 || data[3] != 0 || 8+size > len(data) {
+			return content
+		}
+
+		out.Write(data[8 : 8+size])
+		data = data[8+size:]
+	}
+
+	return out.String()
+}
@@ -0,0 +1,555 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TenantsFile é o arquivo JSON com os times que usam o BOT nos próprios
+// canais. Vazio deixa o BOT com um único time, só no canal principal
+var TenantsFile string
+
+// Tenant é um time com os próprios canais, as stacks e ambientes que pode
+// alterar, os papéis e as permissões das ações. Listas vazias não restringem
+type Tenant struct {
+	Name         string              `json:"-"`
+	Channels     []string            `json:"channels"`
+	Stacks       []string            `json:"stacks"`
+	Environments []string            `json:"environments"`
+	Members      []string            `json:"members"`
+	Roles        map[string][]string `json:"roles"`
+	Permissions  map[string][]string `json:"permissions"`
+	Quotas       []Quota             `json:"quotas"`
+}
+
+var (
+	tenants      = map[string]*Tenant{}
+	tenantsMutex sync.RWMutex
+)
+
+// LoadTenants lê os times do arquivo configurado
+func LoadTenants() {
+	loaded := map[string]*Tenant{}
+
+	if TenantsFile != "" {
+		content, err := ioutil.ReadFile(TenantsFile)
+		if err != nil {
+			CheckErr("Erro ao abrir o arquivo de times", err)
+			return
+		}
+
+		if err := json.Unmarshal(content, &loaded); err != nil {
+			CheckErr("Erro ao ler o arquivo de times", err)
+			return
+		}
+	}
+
+	channels := map[string]string{}
+	for name, tenant := range loaded {
+		tenant.Name = name
+		tenant.parseQuotas()
+		for _, channel := range tenant.Channels {
+			if other, ok := channels[channel]; ok {
+				log.Printf("[ERROR] Canal %s está nos times %s e %s, usando o %s\n", channel, other, name, other)
+				continue
+			}
+			channels[channel] = name
+		}
+	}
+
+	tenantsMutex.Lock()
+	tenants = loaded
+	tenantsMutex.Unlock()
+
+	if len(loaded) > 0 {
+		log.Printf("[INFO] %d times carregados\n", len(loaded))
+	}
+}
+
+// TenantForChannel retorna o time dono do canal, ou nil para os canais sem
+// time (ex.: o canal principal do BOT)
+func TenantForChannel(channel string) *Tenant {
+	tenantsMutex.RLock()
+	defer tenantsMutex.RUnlock()
+
+	var names []string
+	for name := range tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if containsString(tenants[name].Channels, channel) {
+			return tenants[name]
+		}
+	}
+
+	return nil
+}
+
+// TenantByName retorna o time pelo nome, ou nil
+func TenantByName(name string) *Tenant {
+	tenantsMutex.RLock()
+	defer tenantsMutex.RUnlock()
+
+	return tenants[name]
+}
+
+// AllTenants retorna os times em ordem alfabética
+func AllTenants() []*Tenant {
+	tenantsMutex.RLock()
+	defer tenantsMutex.RUnlock()
+
+	var list []*Tenant
+	for _, tenant := range tenants {
+		list = append(list, tenant)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// userRoles retorna os papéis do usuário no time, em ordem alfabética
+func (t *Tenant) userRoles(user string, userName string) []string {
+	var roles []string
+	for role, members := range t.Roles {
+		if containsString(members, user) || containsString(members, userName) {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+
+	return roles
+}
+
+// Allowed é o userAllowed com os papéis do time, além dos papéis globais do
+// RBAC_ROLES
+func (t *Tenant) Allowed(permissions []string, user string, userName string) bool {
+	if userAllowed(permissions, user, userName) {
+		return true
+	}
+
+	for _, role := range t.userRoles(user, userName) {
+		if containsString(permissions, "@"+role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsEnvironment retorna se o time pode alterar o ambiente
+func (t *Tenant) AllowsEnvironment(name string) bool {
+	return len(t.Environments) == 0 || containsString(t.Environments, name)
+}
+
+// AllowsStack retorna se o time pode alterar a stack
+func (t *Tenant) AllowsStack(name string) bool {
+	return len(t.Stacks) == 0 || containsString(t.Stacks, name)
+}
+
+// AllowsTarget retorna se o serviço, container, LB ou stack é de uma stack
+// do time. Os IDs que não são encontrados no Rancher são recusados, fora dele
+// (sem stacks) todos são aceitos
+func (t *Tenant) AllowsTarget(ID string) bool {
+	if len(t.Stacks) == 0 || orchestrator.Name() != "rancher" {
+		return true
+	}
+
+	stack, ok := rancherStackOf(ID)
+	return ok && t.AllowsStack(stack)
+}
+
+// Authorize verifica se o usuário pode executar a ação (comando, nome do
+// botão ou callback_id do menu) nos canais do time
+func (t *Tenant) Authorize(user string, userName string, action string) error {
+	if len(t.Members) > 0 && !t.Allowed(t.Members, user, userName) {
+		return fmt.Errorf("@%s não faz parte do time `%s`", userName, t.Name)
+	}
+
+	if permissions, ok := t.Permissions[action]; ok && !t.Allowed(permissions, user, userName) {
+		return fmt.Errorf("@%s não tem permissão para `%s` no time `%s` (%s)", userName, action, t.Name, formatPermissions(permissions))
+	}
+
+	// As ações que alteram o ambiente só rodam nos ambientes do time
+	if containsString(maintenanceActions, action) && !t.AllowsEnvironment(orchestratorEnvironment) {
+		return fmt.Errorf("o ambiente atual `%s` não é do time `%s` (%s)", orchestratorEnvironment, t.Name, strings.Join(t.Environments, ", "))
+	}
+
+	return nil
+}
+
+// rancherStackOf retorna o nome da stack do serviço, do container ou da
+// própria stack
+func rancherStackOf(ID string) (string, bool) {
+	if ID == "" {
+		return "", false
+	}
+
+	stacks, err := rancherListener.ListStacks()
+	if err != nil {
+		return "", false
+	}
+
+	for _, stack := range stacks {
+		if stack.ID == ID {
+			return stack.Name, true
+		}
+	}
+
+	services, err := rancherListener.ListServices()
+	if err != nil {
+		return "", false
+	}
+
+	serviceID := ID
+	if !rancherHasService(services, ID) {
+		containers, err := rancherListener.ListContainers()
+		if err != nil {
+			return "", false
+		}
+
+		serviceID = ""
+		for _, container := range containers {
+			if container.ID == ID {
+				serviceID = container.ServiceID()
+			}
+		}
+	}
+
+	stackID := ""
+	for _, service := range services {
+		if service.ID == serviceID {
+			stackID = service.StackID
+		}
+	}
+	if stackID == "" {
+		return "", false
+	}
+
+	for _, stack := range stacks {
+		if stack.ID == stackID {
+			return stack.Name, true
+		}
+	}
+
+	return "", false
+}
+
+func rancherHasService(services []Service, ID string) bool {
+	for _, service := range services {
+		if service.ID == ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// interactionTargets são os valores da ação: as opções escolhidas nos menus
+// (todas, no multi-select dos batches) ou o valor do botão
+func interactionTargets(in *Interaction) []string {
+	if len(in.Message.Actions) == 0 {
+		return nil
+	}
+
+	action := in.Message.Actions[0]
+	if len(action.SelectedOptions) == 0 {
+		return []string{action.Value}
+	}
+
+	var values []string
+	for _, option := range action.SelectedOptions {
+		values = append(values, option.Value)
+	}
+
+	return values
+}
+
+// targetID é o ID no valor da ação, sem as opções (ex.: 1i123?lines=50 ou
+// 1i123?drain=30s) e sem os demais campos (ex.: 1s5|nginx:1.19)
+func targetID(value string) string {
+	value = strings.SplitN(value, "?", 2)[0]
+	return strings.SplitN(value, "|", 2)[0]
+}
+
+// allowsTargetID verifica o ID de serviço, container, LB ou stack no valor
+func allowsTargetID(t *Tenant, value string) bool {
+	return t.AllowsTarget(targetID(value))
+}
+
+// tenantTargets são as ações com um alvo no Rancher, com a verificação do
+// valor delas: os IDs ou, nas revisões pendentes, a stack do compose, do
+// snapshot e do clone e o LB do A/B e do blue/green. As demais ações não têm
+// alvo no Rancher (ex.: jobs, alertas, incidentes)
+var tenantTargets = map[string]func(t *Tenant, value string) bool{
+	restartContainer:          allowsTargetID,
+	restartContainerDrain:     allowsTargetID,
+	logsContainer:             allowsTargetID,
+	streamLogs:                allowsTargetID,
+	serviceLogs:               allowsTargetID,
+	getServiceInfo:            allowsTargetID,
+	canaryActivate:            allowsTargetID,
+	canaryDisable:             allowsTargetID,
+	canaryInfo:                allowsTargetID,
+	scanService:               allowsTargetID,
+	restartService:            allowsTargetID,
+	inspectContainer:          allowsTargetID,
+	actionServiceInfo:         allowsTargetID,
+	actionServiceRestart:      allowsTargetID,
+	actionRegistryUpgrade:     allowsTargetID,
+	actionCrashLoopStop:       allowsTargetID,
+	actionOpenIncident:        allowsTargetID,
+	actionAlertLogs:           allowsTargetID,
+	actionAlertRestart:        allowsTargetID,
+	actionLogsRange:           allowsTargetID,
+	actionFindServiceLogs:     allowsTargetID,
+	actionFindStackServices:   allowsTargetID,
+	actionContainerRestart:    allowsTargetID,
+	actionBatchRun:            allowsTargetID,
+	actionInspectJSON:         allowsTargetID,
+	actionCanaryConfig:        allowsTargetID,
+	actionABNew:               allowsTargetID,
+	actionABRemove:            allowsTargetID,
+	actionABApply:             allowsABPending,
+	actionBlueGreenSwitch:     allowsBlueGreen,
+	actionBlueGreenSwitchBack: allowsBlueGreen,
+	actionBlueGreenCleanup:    allowsBlueGreen,
+	actionComposeDeploy:       allowsComposePending,
+	actionSnapshotRestore:     allowsSnapshotPending,
+	actionCloneApply:          allowsClonePending,
+}
+
+// allowsComposePending verifica a stack do deploy pendente do compose
+func allowsComposePending(t *Tenant, ID string) bool {
+	composePendingMutex.Lock()
+	pending, ok := composePending[ID]
+	composePendingMutex.Unlock()
+
+	return ok && t.AllowsStack(pending.Stack)
+}
+
+// allowsSnapshotPending verifica a stack do restore pendente do snapshot
+func allowsSnapshotPending(t *Tenant, ID string) bool {
+	snapshotPendingMutex.Lock()
+	pending, ok := snapshotPending[ID]
+	snapshotPendingMutex.Unlock()
+
+	return ok && t.AllowsStack(pending.Snapshot.Stack)
+}
+
+// allowsClonePending verifica a stack criada pelo clone pendente
+func allowsClonePending(t *Tenant, ID string) bool {
+	pending := getClonePending(ID, false)
+	return pending != nil && t.AllowsEnvironment(pending.Target) && t.AllowsStack(pending.Name)
+}
+
+// allowsABPending verifica o LB da regra de A/B pendente
+func allowsABPending(t *Tenant, ID string) bool {
+	abPendingMutex.Lock()
+	pending, ok := abPendingRules[ID]
+	abPendingMutex.Unlock()
+
+	return ok && t.AllowsTarget(pending.LB)
+}
+
+// allowsBlueGreen verifica o LB do blue/green
+func allowsBlueGreen(t *Tenant, ID string) bool {
+	blueGreensMutex.Lock()
+	bg, ok := blueGreens[ID]
+	var lb string
+	if ok {
+		lb = bg.LB
+	}
+	blueGreensMutex.Unlock()
+
+	return ok && t.AllowsTarget(lb)
+}
+
+// interactionUses é quanto a interação conta nas cotas: um uso por alvo
+// escolhido nos batches e um nas demais ações
+func interactionUses(in *Interaction) int {
+	if in.Key() == actionBatchRun && len(in.Message.Actions[0].SelectedOptions) > 0 {
+		return len(in.Message.Actions[0].SelectedOptions)
+	}
+
+	return 1
+}
+
+// quotaFreeActions são os botões que não executam a ação (cancelar, descartar
+// e os passos dos menus e do wizard), nunca contados nas cotas
+var quotaFreeActions = []string{
+	actionCancel,
+	actionJobCancel,
+	actionBatchSelect,
+	actionBatchCancel,
+	actionWizardService,
+	actionWizardTag,
+	actionWizardStrategy,
+	actionWizardBack,
+	actionWizardCancel,
+	actionBlueGreenCancel,
+	actionTerraformDiscard,
+	actionABDiscard,
+	actionImageGCDiscard,
+	actionComposeDiscard,
+	actionSnapshotDiscard,
+	actionCloneEdit,
+	actionCloneDiscard,
+}
+
+// interactionCharged retorna se a interação executa a ação e conta nas cotas.
+// O menu de logs sem o período só mostra os botões do actionLogsRange, que
+// são contados no lugar dele
+func interactionCharged(in *Interaction) bool {
+	if len(in.Message.Actions) == 0 || containsString(quotaFreeActions, in.Key()) {
+		return false
+	}
+
+	if in.Key() == logsContainer && len(in.Message.Actions[0].SelectedOptions) > 0 {
+		_, opts := DecodeLogsValue(in.Message.Actions[0].SelectedOptions[0].Value)
+		return !opts.IsEmpty()
+	}
+
+	return true
+}
+
+// interactionQuotaActions são as ações da interação nas cotas. O restart em
+// batch, o restart com drain e os botões do período dos logs também contam
+// nas cotas do comando equivalente
+func interactionQuotaActions(in *Interaction) []string {
+	actions := []string{in.Key()}
+
+	switch in.Key() {
+	case restartContainerDrain:
+		actions = append(actions, restartContainer)
+	case actionLogsRange:
+		actions = append(actions, logsContainer)
+	case actionBatchRun:
+		switch in.Message.Actions[0].Value {
+		case batchRestart + "|" + batchServices:
+			actions = append(actions, restartService)
+		case batchRestart + "|" + batchContainers:
+			actions = append(actions, restartContainer)
+		}
+	}
+
+	return actions
+}
+
+// menuCommands são os comandos que abrem um menu com o próprio callback_id:
+// true nos que só abrem o menu sem o alvo, false nos que sempre abrem
+var menuCommands = map[string]bool{
+	restartContainer: true,
+	restartService:   true,
+	logsContainer:    true,
+	serviceLogs:      true,
+	getServiceInfo:   true,
+	inspectContainer: true,
+	canaryActivate:   true,
+	canaryDisable:    true,
+	canaryInfo:       false,
+	streamLogs:       false,
+	jenkinsBuild:     false,
+	scanService:      false,
+}
+
+// commandCharged retorna se o comando executa a ação e conta nas cotas. Os
+// que só abrem o menu são contados na escolha do menu
+func commandCharged(args CommandArgs) bool {
+	withTarget, ok := menuCommands[args.Command]
+	if !ok {
+		return true
+	}
+
+	return withTarget && len(args.Positional) > 0
+}
+
+// TenantMiddleware resolve o time pelo canal da interação e recusa as ações
+// de quem não é do time, sem permissão ou em serviços de outras stacks
+func TenantMiddleware(next InteractionHandler) InteractionHandler {
+	return func(w http.ResponseWriter, in *Interaction) {
+		in.Tenant = TenantForChannel(in.Message.Channel.ID)
+		if in.Tenant == nil {
+			next(w, in)
+			return
+		}
+
+		err := in.Tenant.Authorize(in.Message.User.ID, in.Message.User.Name, in.Key())
+		if allows, ok := tenantTargets[in.Key()]; ok && err == nil {
+			// Os batches levam todos os alvos escolhidos, basta um de outro
+			// time (ou não encontrado) para recusar a interação inteira
+			for _, value := range interactionTargets(in) {
+				if !allows(in.Tenant, value) {
+					err = fmt.Errorf("`%s` não é de uma stack do time `%s`", targetID(value), in.Tenant.Name)
+					break
+				}
+			}
+		}
+
+		if err != nil {
+			log.Printf("[INFO] Ação %s recusada no time %s: %s\n", in.Key(), in.Tenant.Name, err)
+			refuseInteraction(w, in, http.StatusForbidden, ":no_entry: "+err.Error())
+			return
+		}
+
+		next(w, in)
+	}
+}
+
+// QuotaMiddleware conta a ação nas cotas do time logo antes do handler, depois
+// da manutenção e das confirmações, e recusa as ações além das cotas. Os usos
+// voltam para as cotas quando o handler informa a falha (interactionFailed)
+// ou o job da ação falha
+func QuotaMiddleware(next InteractionHandler) InteractionHandler {
+	return func(w http.ResponseWriter, in *Interaction) {
+		if in.Tenant == nil || !interactionCharged(in) {
+			next(w, in)
+			return
+		}
+
+		charge, err := in.Tenant.ConsumeQuota(interactionUses(in), interactionQuotaActions(in)...)
+		if err != nil {
+			log.Printf("[INFO] Ação %s recusada no time %s: %s\n", in.Key(), in.Tenant.Name, err)
+			refuseInteraction(w, in, http.StatusTooManyRequests, ":no_entry: "+err.Error())
+			return
+		}
+		in.QuotaCharge = charge
+
+		next(w, in)
+	}
+}
+
+// interactionFailed devolve às cotas os usos da interação cuja ação falhou
+func interactionFailed(w http.ResponseWriter) {
+	if iw, ok := w.(*interactionWriter); ok {
+		iw.charge.Refund()
+		iw.charge = nil
+	}
+}
+
+// interactionJob liga o job da ação aos usos da interação nas cotas, que
+// voltam para elas quando o job não entra na fila (err) ou falha
+func interactionJob(w http.ResponseWriter, job *Job, err error) {
+	iw, ok := w.(*interactionWriter)
+	if !ok || iw.charge == nil {
+		return
+	}
+
+	if err != nil {
+		interactionFailed(w)
+		return
+	}
+
+	job.refundOnFailure(iw.charge)
+	iw.charge = nil
+}
@@ -0,0 +1,110 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testOrchestrator é um orquestrador que só tem o nome, para os testes que
+// não podem chamar o Rancher
+type testOrchestrator struct {
+	Orchestrator
+	name string
+}
+
+func (o testOrchestrator) Name() string {
+	return o.name
+}
+
+// testRancher coloca as listas do Rancher no cache do projeto, para o
+// rancherStackOf não chamar a API. Uma lista vazia é o Rancher sem resposta
+func testRancher(stacks string, services string, containers string) func() {
+	listener, previous := &RancherListener{projectID: "1a5"}, rancherListener
+	rancherListener = listener
+
+	lists := map[string]string{cacheStacks: stacks, cacheServices: services, cacheContainers: containers}
+	rancherCache.mutex.Lock()
+	for resource, value := range lists {
+		rancherCache.entries[listener.cacheKey(resource)] = &cacheEntry{value: value, fetchedAt: time.Now(), usedAt: time.Now()}
+	}
+	rancherCache.mutex.Unlock()
+
+	return func() {
+		listener.invalidateCache(cacheStacks, cacheServices, cacheContainers)
+		rancherListener = previous
+	}
+}
+
+func TestTargetID(t *testing.T) {
+	tests := map[string]string{
+		"1s5":               "1s5",
+		"1i5?lines=50":      "1i5",
+		"1s5|payments":      "1s5",
+		"1i5|api?drain=30s": "1i5",
+		"":                  "",
+	}
+
+	for value, ID := range tests {
+		if got := targetID(value); got != ID {
+			t.Errorf("targetID(%q) = %q, esperado %q", value, got, ID)
+		}
+	}
+}
+
+func TestAllowsTarget(t *testing.T) {
+	defer func(o Orchestrator) { orchestrator = o }(orchestrator)
+	orchestrator = rancherOrchestrator{}
+
+	defer testRancher(
+		`{"type":"collection","data":[{"id":"1st1","name":"payments"},{"id":"1st2","name":"billing"}]}`,
+		`{"type":"collection","data":[{"id":"1s1","stackId":"1st1"},{"id":"1s2","stackId":"1st2"}]}`,
+		`{"type":"collection","data":[{"id":"1i1","serviceIds":["1s1"]},{"id":"1i2","serviceIds":["1s2"]},{"id":"1i3"}]}`,
+	)()
+
+	tenant := &Tenant{Name: "pagamentos", Stacks: []string{"payments"}}
+
+	tests := []struct {
+		ID      string
+		allowed bool
+	}{
+		{"1st1", true},
+		{"1st2", false},
+		{"1s1", true},
+		{"1s2", false},
+		{"1i1", true},
+		{"1i2", false},
+		{"1i3", false},
+		{"1s9", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if allowed := tenant.AllowsTarget(test.ID); allowed != test.allowed {
+			t.Errorf("AllowsTarget(%q) = %v, esperado %v", test.ID, allowed, test.allowed)
+		}
+	}
+
+	if !(&Tenant{Name: "todos"}).AllowsTarget("1s9") {
+		t.Error("time sem stacks recusou um alvo")
+	}
+}
+
+func TestAllowsTargetFailsClosed(t *testing.T) {
+	defer func(o Orchestrator) { orchestrator = o }(orchestrator)
+	orchestrator = rancherOrchestrator{}
+
+	defer testRancher("", "", "")()
+
+	tenant := &Tenant{Name: "pagamentos", Stacks: []string{"payments"}}
+	if tenant.AllowsTarget("1s1") {
+		t.Error("AllowsTarget aceitou o alvo sem resposta do Rancher")
+	}
+
+	orchestrator = testOrchestrator{name: "kubernetes"}
+	if !tenant.AllowsTarget("1s1") {
+		t.Error("AllowsTarget recusou o alvo fora do Rancher")
+	}
+}
@@ -0,0 +1,324 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	terraformCallback = "terraform"
+
+	actionTerraformApply   = "terraform-apply"
+	actionTerraformDiscard = "terraform-discard"
+
+	// terraformPlanTTL é o tempo que um plan pode ser aplicado, depois disso
+	// é preciso gerar outro
+	terraformPlanTTL = time.Hour
+)
+
+var (
+	// TerraformDir é o diretório com o código Terraform
+	TerraformDir string
+
+	// TerraformBin é o executável do Terraform
+	TerraformBin = "terraform"
+
+	// TerraformApprovers são os usuários do Slack que podem aprovar o apply.
+	// Caso vazio, qualquer usuário diferente de quem gerou o plan pode aprovar
+	TerraformApprovers []string
+)
+
+var (
+	terraformWorkspaceName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	terraformPlanSummary   = regexp.MustCompile(`Plan: \d+ to add, \d+ to change, \d+ to destroy`)
+)
+
+// TerraformPlan é um plan gerado pelo BOT esperando aprovação
+type TerraformPlan struct {
+	Workspace string
+	File      string
+	User      string
+	Created   time.Time
+}
+
+var (
+	terraformPlans      = map[string]*TerraformPlan{}
+	terraformPlansMutex sync.Mutex
+
+	// terraformLocks evita dois plans/applies ao mesmo tempo no mesmo workspace
+	terraformLocks      = map[string]*sync.Mutex{}
+	terraformLocksMutex sync.Mutex
+)
+
+func terraformLock(workspace string) *sync.Mutex {
+	terraformLocksMutex.Lock()
+	defer terraformLocksMutex.Unlock()
+
+	if _, ok := terraformLocks[workspace]; !ok {
+		terraformLocks[workspace] = &sync.Mutex{}
+	}
+
+	return terraformLocks[workspace]
+}
+
+func terraformCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command(TerraformBin, args...)
+	cmd.Dir = TerraformDir
+	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1")
+
+	return cmd
+}
+
+// TerraformRunPlan seleciona o workspace e gera o plan, retornando a saída,
+// o arquivo do plan e se existem mudanças a aplicar
+func TerraformRunPlan(workspace string) (string, string, bool, error) {
+	if out, err := terraformCommand("workspace", "select", "-no-color", workspace).CombinedOutput(); err != nil {
+		return string(out), "", false, err
+	}
+
+	file := filepath.Join(os.TempDir(), fmt.Sprintf("slack-bot-%s-%d.tfplan", workspace, time.Now().UnixNano()))
+
+	cmd := terraformCommand("plan", "-no-color", "-input=false", "-detailed-exitcode", "-out="+file)
+	out, err := cmd.CombinedOutput()
+
+	// Com -detailed-exitcode o código 2 indica que o plan tem mudanças
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 2 {
+		return string(out), file, true, nil
+	}
+
+	os.Remove(file)
+
+	return string(out), "", false, err
+}
+
+func canApproveTerraform(user string, userName string, plan *TerraformPlan) bool {
+	if len(TerraformApprovers) == 0 {
+		return user != plan.User
+	}
+
+	return userAllowed(TerraformApprovers, user, userName)
+}
+
+func (s *SlackListener) slackTerraformPlan(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) != 4 || !terraformWorkspaceName.MatchString(args[3]) {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s workspace", terraformPlan), false))
+		return
+	}
+
+	workspace := args[3]
+
+	lock := terraformLock(workspace)
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":hourglass_flowing_sand: Gerando o plan do workspace `%s`...", workspace), false))
+
+	out, file, changes, err := TerraformRunPlan(workspace)
+	if err != nil {
+		CheckErr("Erro ao gerar o plan do Terraform", err)
+		s.client.UploadFile(slack.FileUploadParameters{
+			Content:        RedactText(out),
+			Filetype:       "text",
+			Filename:       fmt.Sprintf("plan-%s.txt", workspace),
+			Title:          fmt.Sprintf("Erro no plan do workspace %s", workspace),
+			InitialComment: fmt.Sprintf(":x: Erro ao gerar o plan do workspace `%s`", workspace),
+			Channels:       []string{ev.Channel},
+		})
+		return
+	}
+
+	if !changes {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":white_check_mark: Nenhuma mudança no workspace `%s`", workspace), false))
+		return
+	}
+
+	summary := terraformPlanSummary.FindString(out)
+
+	s.client.UploadFile(slack.FileUploadParameters{
+		Content:  RedactText(out),
+		Filetype: "text",
+		Filename: fmt.Sprintf("plan-%s.txt", workspace),
+		Title:    fmt.Sprintf("Plan do workspace %s", workspace),
+		Channels: []string{ev.Channel},
+	})
+
+	id := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	terraformPlansMutex.Lock()
+	terraformPlans[id] = &TerraformPlan{Workspace: workspace, File: file, User: ev.Msg.User, Created: time.Now()}
+	terraformPlansMutex.Unlock()
+
+	// O plan expirado sai da memória e do disco mesmo sem ninguém clicar
+	time.AfterFunc(terraformPlanTTL, func() {
+		if discardTerraformPlan(id) {
+			log.Printf("[INFO] Plan do workspace %s expirado e removido\n", workspace)
+		}
+	})
+
+	log.Printf("[INFO] Plan do workspace %s gerado pelo usuário %s: %s\n", workspace, ev.Msg.User, summary)
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionAttachments(slack.Attachment{
+		Title:      fmt.Sprintf(":building_construction: Terraform `%s`", workspace),
+		Text:       fmt.Sprintf("*%s*\nPlan gerado por <@%s>, precisa da aprovação de outra pessoa para ser aplicado (válido por %s)", summary, ev.Msg.User, terraformPlanTTL),
+		Color:      "#FFA500",
+		CallbackID: terraformCallback,
+		Actions: []slack.AttachmentAction{
+			{
+				Name:  actionTerraformApply,
+				Text:  "Aprovar e aplicar",
+				Type:  "button",
+				Style: "danger",
+				Value: id,
+				Confirm: &slack.ConfirmationField{
+					Title:       "Tem certeza disso?",
+					Text:        fmt.Sprintf("Deseja mesmo aplicar o plan no workspace %s? (%s)", workspace, summary),
+					OkText:      "Sim",
+					DismissText: "Não",
+				},
+			},
+			{
+				Name:  actionTerraformDiscard,
+				Text:  "Descartar",
+				Type:  "button",
+				Value: id,
+			},
+		},
+	}))
+}
+
+// actionTerraformApplyFunction aplica o plan aprovado, enviando a saída do
+// apply na thread da mensagem
+func actionTerraformApplyFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	id := message.Actions[0].Value
+
+	terraformPlansMutex.Lock()
+	plan, ok := terraformPlans[id]
+	if ok && canApproveTerraform(message.User.ID, message.User.Name, plan) {
+		delete(terraformPlans, id)
+	}
+	terraformPlansMutex.Unlock()
+
+	if !ok || time.Since(plan.Created) > terraformPlanTTL {
+		discardTerraformPlan(id)
+		respondWithoutActions(w, message.OriginalMessage, ":hourglass: Plan expirado, gere um novo plan", "")
+		return
+	}
+
+	if !canApproveTerraform(message.User.ID, message.User.Name, plan) {
+		postEphemeral(message.Channel.ID, message.User.ID, msgTerraformNotApprover)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	log.Printf("[INFO] Apply do workspace %s aprovado pelo usuário %s\n", plan.Workspace, message.User.Name)
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":rocket: Apply aprovado por @%s", message.User.Name), "")
+
+	go runTerraformApply(plan, message.Channel.ID, message.MessageTs)
+}
+
+// discardTerraformPlan remove o plan pendente e o arquivo dele, retornando
+// se ele ainda estava pendente
+func discardTerraformPlan(id string) bool {
+	terraformPlansMutex.Lock()
+	plan, ok := terraformPlans[id]
+	delete(terraformPlans, id)
+	terraformPlansMutex.Unlock()
+
+	if ok {
+		os.Remove(plan.File)
+	}
+
+	return ok
+}
+
+// actionTerraformDiscardFunction descarta o plan sem aplicar
+func actionTerraformDiscardFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	if discardTerraformPlan(message.Actions[0].Value) {
+		log.Printf("[INFO] Plan descartado pelo usuário %s\n", message.User.Name)
+	}
+
+	respondWithoutActions(w, message.OriginalMessage, fmt.Sprintf(":wastebasket: Plan descartado por @%s", message.User.Name), "")
+}
+
+func runTerraformApply(plan *TerraformPlan, channel string, threadTs string) {
+	api := getAPIConnection()
+	defer os.Remove(plan.File)
+
+	lock := terraformLock(plan.Workspace)
+	lock.Lock()
+	defer lock.Unlock()
+
+	post := func(text string) {
+		api.client.PostMessage(channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(threadTs))
+	}
+
+	if out, err := terraformCommand("workspace", "select", "-no-color", plan.Workspace).CombinedOutput(); err != nil {
+		post(fmt.Sprintf(":x: Erro ao selecionar o workspace:\n```%s```", out))
+		return
+	}
+
+	cmd := terraformCommand("apply", "-no-color", "-input=false", plan.File)
+
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	if err := cmd.Start(); err != nil {
+		post(fmt.Sprintf(":x: Erro ao iniciar o apply: %s", err))
+		return
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+		writer.Close()
+	}()
+
+	// A saída é enviada em blocos a cada poucos segundos, para não estourar o
+	// limite de mensagens do Slack
+	var lines []string
+	flush := func() {
+		for _, chunk := range splitLogChunks(lines, 3500) {
+			post(fmt.Sprintf("```%s```", RedactText(chunk)))
+		}
+		lines = nil
+	}
+
+	lastFlush := time.Now()
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+
+		if time.Since(lastFlush) > LogsStreamInterval {
+			flush()
+			lastFlush = time.Now()
+		}
+	}
+	flush()
+
+	if err := <-done; err != nil {
+		CheckErr("Erro no apply do Terraform", err)
+		post(fmt.Sprintf(":x: Apply do workspace `%s` falhou", plan.Workspace))
+		return
+	}
+
+	log.Printf("[INFO] Apply do workspace %s finalizado\n", plan.Workspace)
+	post(fmt.Sprintf(":white_check_mark: Apply do workspace `%s` finalizado", plan.Workspace))
+}
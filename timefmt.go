@@ -0,0 +1,100 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MessagesTimezone é o fuso horário dos horários nas mensagens quando o
+// Slack não converte para o fuso de quem lê (ex.: rodapés e opções de
+// menus) e no texto alternativo das datas
+var MessagesTimezone = time.Local
+
+// localTime formata o horário no MessagesTimezone
+func localTime(t time.Time, layout string) string {
+	return t.In(MessagesTimezone).Format(layout)
+}
+
+// slackDate formata a data e hora com os tokens do Slack, que mostram o
+// horário no fuso de quem lê a mensagem
+func slackDate(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_num} {time}|%s>", t.Unix(), localTime(t, "02/01/2006 15:04 MST"))
+}
+
+// slackDay é o slackDate só com a data
+func slackDay(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_num}|%s>", t.Unix(), localTime(t, "02/01/2006"))
+}
+
+// formatDuration mostra a duração com as duas maiores unidades, ex.: 3d 4h,
+// 5h 10m, 2m 30s
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+
+	var parts []string
+	for _, unit := range units {
+		if d >= unit.size || (len(parts) == 0 && unit.suffix == "s") {
+			parts = append(parts, fmt.Sprintf("%d%s", d/unit.size, unit.suffix))
+			d %= unit.size
+		} else if len(parts) > 0 {
+			break
+		}
+
+		if len(parts) == 2 {
+			break
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// parseTimestamp lê os horários das APIs (ISO 8601, como o created do
+// Rancher), com ou sem frações de segundo
+func parseTimestamp(raw string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, time.RFC3339, "2006-01-02 15:04:05.999999999 -0700 MST"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// formatTimestamp mostra o horário da API com a data no fuso de quem lê e
+// há quanto tempo foi (ex.: 12/03/2024 14:00 (há 3d 4h)). Horários que não
+// são reconhecidos são mostrados como vieram
+func formatTimestamp(raw string) string {
+	t, ok := parseTimestamp(raw)
+	if !ok {
+		return fmt.Sprintf("`%s`", raw)
+	}
+
+	return fmt.Sprintf("%s (há %s)", slackDate(t), formatDuration(time.Since(t)))
+}
+
+// uptimeSince mostra há quanto tempo o recurso está no ar pelo horário de
+// criação, vazio quando o horário não é reconhecido
+func uptimeSince(raw string) string {
+	t, ok := parseTimestamp(raw)
+	if !ok {
+		return ""
+	}
+
+	return "no ar há " + formatDuration(time.Since(t))
+}
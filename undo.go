@@ -0,0 +1,219 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	actionUndo   = "undo"
+	undoCallback = "undo-action"
+)
+
+// UndoWindow é o tempo em que o botão de "Desfazer" continua válido
+var UndoWindow = 10 * time.Minute
+
+// UndoAction é a estrutura que guarda a ação inversa de algo que foi
+// feito pelo BOT, para que possa ser desfeito pelo botão de Undo. O Revert
+// recebe quem clicou no botão
+type UndoAction struct {
+	ID          string
+	Description string
+	Expires     time.Time
+	Revert      func(user string) string
+}
+
+var (
+	undoActions = map[string]*UndoAction{}
+	undoMutex   sync.Mutex
+)
+
+// RegisterUndo é a função que guarda a ação inversa e retorna o ID
+// que será usado como valor do botão de Undo
+func RegisterUndo(description string, revert func(user string) string) string {
+	undoMutex.Lock()
+	defer undoMutex.Unlock()
+
+	now := time.Now()
+
+	// Limpando as ações que já passaram da janela de Undo
+	for id, undo := range undoActions {
+		if now.After(undo.Expires) {
+			delete(undoActions, id)
+		}
+	}
+
+	id := fmt.Sprintf("%d", now.UnixNano())
+	undoActions[id] = &UndoAction{
+		ID:          id,
+		Description: description,
+		Expires:     now.Add(UndoWindow),
+		Revert:      revert,
+	}
+
+	return id
+}
+
+// TakeUndo é a função que retira a ação da lista, retornando nil caso
+// ela não exista ou já tenha expirado
+func TakeUndo(id string) *UndoAction {
+	undoMutex.Lock()
+	defer undoMutex.Unlock()
+
+	undo, ok := undoActions[id]
+	if !ok {
+		return nil
+	}
+
+	delete(undoActions, id)
+
+	if time.Now().After(undo.Expires) {
+		return nil
+	}
+
+	return undo
+}
+
+// undoAttachment cria a mensagem de resultado com o botão de "Desfazer"
+func undoAttachment(text string, undoID string) slack.Attachment {
+	return slack.Attachment{
+		Text:       text,
+		Color:      "#0C648A",
+		CallbackID: undoCallback,
+		Actions: []slack.AttachmentAction{
+			{
+				Name:  actionUndo,
+				Text:  "Desfazer",
+				Type:  "button",
+				Value: undoID,
+				Confirm: &slack.ConfirmationField{
+					Title:       "Tem certeza disso?",
+					Text:        "Deseja mesmo desfazer essa ação? :rewind:",
+					OkText:      "Sim",
+					DismissText: "Não",
+				},
+			},
+		},
+	}
+}
+
+// undoCanaryEnable registra como inverso de ativar o Canary a sua desativação
+func undoCanaryEnable(lb string) string {
+	return RegisterUndo(fmt.Sprintf("ativação do Canary no LB `%s`", lb), func(user string) string {
+		return rancherListener.DisableCanary(lb)
+	})
+}
+
+// undoCanaryDisable registra como inverso de desativar o Canary a sua ativação
+func undoCanaryDisable(lb string) string {
+	return RegisterUndo(fmt.Sprintf("desativação do Canary no LB `%s`", lb), func(user string) string {
+		return rancherListener.EnableCanary(lb)
+	})
+}
+
+// undoHaproxyCfg registra como inverso de uma alteração no haproxy.cfg
+// (pesos do Canary ou regras de A/B) a volta do conteúdo que estava antes
+func undoHaproxyCfg(lb string, previousCfg string) string {
+	return RegisterUndo(fmt.Sprintf("alteração do haproxy.cfg no LB `%s`", lb), func(user string) string {
+		return rancherListener.SetHaproxyCfg(lb, previousCfg)
+	})
+}
+
+// undoServiceUpgrade registra como inverso do upgrade de um serviço o rollback
+func undoServiceUpgrade(serviceID string) string {
+	return RegisterUndo(fmt.Sprintf("upgrade do serviço `%s`", serviceID), func(user string) string {
+		started := time.Now()
+
+		resp, err := rancherListener.RollbackService(serviceID)
+		if err != nil {
+			RecordDeployAudit(auditRollback, serviceID, "", user, started, err)
+			return ""
+		}
+
+		RecordChange(ChangeEvent{Kind: "rollback", ServiceID: serviceID, User: user})
+		RecordDeployAudit(auditRollback, serviceID, "", user, started, nil)
+
+		return resp
+	})
+}
+
+// undoServiceScale registra como inverso da alteração de escala de um
+// serviço a volta para a escala anterior
+func undoServiceScale(o Orchestrator, serviceID string, previous int) string {
+	return RegisterUndo(fmt.Sprintf("escala do serviço `%s`", serviceID), func(user string) string {
+		if err := o.ScaleService(serviceID, previous); err != nil {
+			CheckErr("Erro ao voltar a escala do serviço "+serviceID, err)
+			return ""
+		}
+
+		RecordChange(ChangeEvent{Kind: "escala", ServiceID: serviceID, User: user})
+
+		return fmt.Sprintf("Serviço %s de volta com %d instâncias", serviceID, previous)
+	})
+}
+
+// undoBatchDeactivate registra como inverso da desativação em batch a volta
+// dos serviços (activate) ou containers (start) desativados. Desfaz o que
+// conseguir, falhando só quando nenhum volta
+func undoBatchDeactivate(kind string, targets []string) string {
+	description := fmt.Sprintf("desativação de %d %s", len(targets), map[string]string{batchServices: "serviços", batchContainers: "containers"}[kind])
+
+	return RegisterUndo(description, func(user string) string {
+		var lines []string
+		done := 0
+
+		for _, ID := range targets {
+			var err error
+			if kind == batchServices {
+				err = rancherListener.ActivateService(ID)
+			} else {
+				err = rancherListener.StartContainer(ID)
+			}
+
+			if err != nil {
+				lines = append(lines, fmt.Sprintf("%s: erro, %s", ID, err))
+				continue
+			}
+
+			if kind == batchServices {
+				RecordChange(ChangeEvent{Kind: "activate", ServiceID: ID, User: user})
+			}
+			lines = append(lines, ID+": ativado")
+			done++
+		}
+
+		if done == 0 {
+			return ""
+		}
+
+		return strings.Join(lines, "\n")
+	})
+}
+
+func actionUndoFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	undo := TakeUndo(message.Actions[0].Value)
+
+	if undo == nil {
+		responseMessage(w, message.OriginalMessage, ":hourglass: Não é mais possível desfazer essa ação", "")
+		return
+	}
+
+	resp := undo.Revert(message.User.Name)
+
+	if resp == "" || resp == "error" {
+		responseMessage(w, message.OriginalMessage, fmt.Sprintf(":x: Erro ao desfazer a %s", undo.Description), "")
+		return
+	}
+
+	log.Printf("[INFO] %s desfeita pelo usuário %s\n", undo.Description, message.User.Name)
+	responseMessage(w, message.OriginalMessage, fmt.Sprintf(":rewind: @%s desfez a %s", message.User.Name, undo.Description), fmt.Sprintf("```%s```", resp))
+}
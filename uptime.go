@@ -0,0 +1,265 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	uptimeUp       = "up"
+	uptimeDown     = "down"
+	uptimeDegraded = "degraded"
+)
+
+var (
+	// UptimeChecks é o mapeamento do nome da verificação para a URL testada
+	// (ex.: api:https://api.exemplo.com/health)
+	UptimeChecks = map[string]string{}
+
+	// UptimeInterval é o intervalo entre as verificações
+	UptimeInterval = time.Minute
+
+	// UptimeTimeout é o tempo máximo de resposta de cada verificação
+	UptimeTimeout = 10 * time.Second
+
+	// UptimeLatencyThreshold é o tempo de resposta a partir do qual a URL é
+	// considerada lenta
+	UptimeLatencyThreshold = 2 * time.Second
+
+	// UptimeFailures é a quantidade de falhas seguidas para considerar a URL fora do ar
+	UptimeFailures = 2
+)
+
+// UptimeState é o estado atual de uma verificação
+type UptimeState struct {
+	Name     string
+	URL      string
+	Status   string
+	Since    time.Time
+	Latency  time.Duration
+	Error    string
+	Paused   bool
+	failures int
+}
+
+var (
+	uptimeStates      = map[string]*UptimeState{}
+	uptimeStatesMutex sync.Mutex
+)
+
+// uptimeProbe faz a requisição na URL, retornando o tempo de resposta
+func uptimeProbe(client *http.Client, url string) (time.Duration, error) {
+	start := time.Now()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	latency := time.Since(start)
+
+	if resp.StatusCode >= 400 {
+		return latency, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	return latency, nil
+}
+
+// WatchUptime verifica as URLs configuradas e avisa no canal quando o estado
+// de alguma delas muda (fora do ar, no ar ou lenta)
+func WatchUptime() {
+	if len(UptimeChecks) == 0 {
+		return
+	}
+
+	log.Printf("[INFO] Monitorando %d URLs\n", len(UptimeChecks))
+
+	uptimeStatesMutex.Lock()
+	for name, url := range UptimeChecks {
+		uptimeStates[name] = &UptimeState{Name: name, URL: url}
+	}
+	uptimeStatesMutex.Unlock()
+
+	client := &http.Client{Timeout: UptimeTimeout}
+
+	for {
+		var wg sync.WaitGroup
+
+		uptimeStatesMutex.Lock()
+		for _, state := range uptimeStates {
+			if state.Paused {
+				continue
+			}
+
+			wg.Add(1)
+			go func(state *UptimeState) {
+				defer wg.Done()
+
+				latency, err := uptimeProbe(client, state.URL)
+				checkUptimeState(state, latency, err)
+			}(state)
+		}
+		uptimeStatesMutex.Unlock()
+
+		wg.Wait()
+		time.Sleep(UptimeInterval)
+	}
+}
+
+// checkUptimeState atualiza o estado da verificação com o resultado e avisa
+// no canal quando ele muda
+func checkUptimeState(state *UptimeState, latency time.Duration, err error) {
+	uptimeStatesMutex.Lock()
+
+	status := uptimeUp
+	state.Error = ""
+
+	switch {
+	case err != nil:
+		state.failures++
+		state.Error = err.Error()
+
+		// Uma falha isolada não derruba a verificação
+		if state.failures < UptimeFailures {
+			uptimeStatesMutex.Unlock()
+			return
+		}
+		status = uptimeDown
+	case latency > UptimeLatencyThreshold:
+		state.failures = 0
+		status = uptimeDegraded
+	default:
+		state.failures = 0
+	}
+
+	state.Latency = latency
+
+	if status == state.Status {
+		uptimeStatesMutex.Unlock()
+		return
+	}
+
+	previous, since := state.Status, state.Since
+	state.Status = status
+	state.Since = time.Now()
+	current := *state
+
+	uptimeStatesMutex.Unlock()
+
+	// Na primeira verificação só avisa se a URL já estiver com problema
+	if previous == "" && status == uptimeUp {
+		return
+	}
+
+	sendUptimeAlert(current, previous, current.Since.Sub(since))
+}
+
+// sendUptimeAlert envia para o canal a mudança de estado da verificação
+func sendUptimeAlert(state UptimeState, previous string, duration time.Duration) {
+	attachment := slack.Attachment{
+		Title:     fmt.Sprintf("[%s] %s", strings.ToUpper(state.Status), state.Name),
+		TitleLink: state.URL,
+	}
+
+	switch state.Status {
+	case uptimeDown:
+		RecordDigestAlert("uptime", fmt.Sprintf("%s fora do ar", state.Name))
+		attachment.Color = "#D50200"
+		attachment.Text = fmt.Sprintf(":red_circle: `%s` está fora do ar: %s", state.URL, state.Error)
+	case uptimeDegraded:
+		attachment.Color = "#FFA500"
+		attachment.Text = fmt.Sprintf(":warning: `%s` está lenta: %s (limite de %s)", state.URL, state.Latency.Round(time.Millisecond), UptimeLatencyThreshold)
+	default:
+		attachment.Color = "#36A64F"
+		attachment.Text = fmt.Sprintf(":large_green_circle: `%s` voltou ao normal (%s)", state.URL, state.Latency.Round(time.Millisecond))
+	}
+
+	if previous != "" && previous != uptimeUp {
+		attachment.Footer = fmt.Sprintf("%s por %s", previous, formatDuration(duration))
+	}
+
+	// Só a queda é crítica, lentidão e volta respeitam o horário silencioso
+	PostNotification(getAPIConnection().channelID, state.Status == uptimeDown, []slack.Attachment{attachment})
+}
+
+// slackUptime mostra o estado das verificações ou pausa/retoma uma delas
+func (s *SlackListener) slackUptime(ev *slack.MessageEvent) {
+	args := strings.Split(ev.Msg.Text, " ")
+
+	if len(args) == 4 && (args[2] == "pause" || args[2] == "resume") {
+		uptimeStatesMutex.Lock()
+		state, ok := uptimeStates[args[3]]
+		if ok {
+			state.Paused = args[2] == "pause"
+			state.failures = 0
+		}
+		uptimeStatesMutex.Unlock()
+
+		if !ok {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Verificação `%s` não encontrada", args[3]), false))
+			return
+		}
+
+		log.Printf("[INFO] Verificação %s alterada (%s) pelo usuário %s\n", args[3], args[2], ev.Msg.User)
+		if args[2] == "pause" {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":double_vertical_bar: Verificação `%s` pausada", args[3]), false))
+		} else {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":arrow_forward: Verificação `%s` retomada", args[3]), false))
+		}
+		return
+	}
+
+	if len(args) > 2 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Erro na chamada do comando, sintaxe correta: @nome-do-bot %s [pause|resume nome]", uptimeStatus), false))
+		return
+	}
+
+	uptimeStatesMutex.Lock()
+	var names []string
+	for name := range uptimeStates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		state := uptimeStates[name]
+
+		icon := ":large_green_circle:"
+		switch {
+		case state.Paused:
+			icon = ":double_vertical_bar:"
+		case state.Status == uptimeDown:
+			icon = ":red_circle:"
+		case state.Status == uptimeDegraded:
+			icon = ":warning:"
+		case state.Status == "":
+			icon = ":grey_question:"
+		}
+
+		line := fmt.Sprintf("%s *%s* `%s` %s", icon, state.Name, state.URL, state.Latency.Round(time.Millisecond))
+		if !state.Since.IsZero() {
+			line += fmt.Sprintf(" - %s desde %s (há %s)", state.Status, slackDate(state.Since), formatDuration(time.Since(state.Since)))
+		}
+		lines = append(lines, line)
+	}
+	uptimeStatesMutex.Unlock()
+
+	if len(lines) == 0 {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText("Nenhuma URL monitorada, configure o UPTIME_CHECKS", false))
+		return
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(strings.Join(lines, "\n"), false))
+}
@@ -5,9 +5,13 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // CheckErr : Função feita para checar os erros
@@ -57,3 +61,68 @@ func RemoveLastCharacter(s string) string {
 
 	return s
 }
+
+// ParseDurationEnv converte o valor de uma env em time.Duration, retornando
+// o valor padrão caso a env esteja vazia ou inválida
+func ParseDurationEnv(key string, value string, defaultValue time.Duration) time.Duration {
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		CheckErr(fmt.Sprintf("Valor inválido na env %s", key), err)
+		return defaultValue
+	}
+
+	return duration
+}
+
+// ParseSizeEnv converte o valor de uma env de tamanho (ex.: 512KB, 10MB ou
+// apenas bytes) retornando o valor padrão caso a env esteja vazia ou inválida
+func ParseSizeEnv(key string, value string, defaultValue int64) int64 {
+	if value == "" {
+		return defaultValue
+	}
+
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+
+	number := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number = strings.TrimSuffix(number, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if err != nil {
+		CheckErr(fmt.Sprintf("Valor inválido na env %s", key), err)
+		return defaultValue
+	}
+
+	return size * multiplier
+}
+
+// FormatSize formata um tamanho em bytes para exibição
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
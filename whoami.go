@@ -0,0 +1,137 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// RBACRoles é o mapeamento do papel para os usuários (IDs ou nomes do
+// Slack, separados por |), ex.: admin:U123|fulano. Nas listas de permissões
+// o papel é usado como @papel
+var RBACRoles = map[string]string{}
+
+// userRoles retorna os papéis do usuário, em ordem alfabética
+func userRoles(user string, userName string) []string {
+	var roles []string
+	for role, members := range RBACRoles {
+		for _, member := range strings.Split(members, "|") {
+			if member == user || member == userName {
+				roles = append(roles, role)
+				break
+			}
+		}
+	}
+
+	sort.Strings(roles)
+
+	return roles
+}
+
+// userAllowed verifica se o usuário está na lista de permissões, pelo ID,
+// pelo nome ou por um dos seus papéis (@papel). Lista vazia permite todos
+func userAllowed(permissions []string, user string, userName string) bool {
+	if len(permissions) == 0 {
+		return true
+	}
+
+	roles := userRoles(user, userName)
+	for _, allowed := range permissions {
+		if allowed == user || allowed == userName {
+			return true
+		}
+
+		for _, role := range roles {
+			if allowed == "@"+role {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// slackWhoami mostra ao usuário os papéis, o ambiente atual e os comandos
+// que ele pode ou não usar
+func (s *SlackListener) slackWhoami(ev *slack.MessageEvent) {
+	user, userName := ev.Msg.User, ev.Msg.User
+	if info, err := s.client.GetUserInfo(user); err == nil && info.Name != "" {
+		userName = info.Name
+	}
+
+	roles := userRoles(user, userName)
+	rolesText := "nenhum"
+	if len(roles) > 0 {
+		rolesText = "`" + strings.Join(roles, "`, `") + "`"
+	}
+
+	env := fmt.Sprintf("`%s` (%s)", orchestratorEnvironment, orchestrator.Name())
+	if dryRunByDefault() {
+		env += fmt.Sprintf(", comandos que alteram algo rodam em dry-run (use o %s)", flagApply)
+	}
+
+	var allowed, denied []string
+	for _, cmd := range Commands {
+		if !cmd.IsActive {
+			continue
+		}
+
+		permissions := commandPermissions(cmd.Cmd)
+		if userAllowed(permissions, user, userName) {
+			allowed = append(allowed, fmt.Sprintf("`%s`", cmd.Cmd))
+		} else {
+			denied = append(denied, fmt.Sprintf("`%s` (%s)", cmd.Cmd, formatPermissions(permissions)))
+		}
+	}
+
+	// Os botões e menus que não são comandos
+	var actions []string
+	for action, permissions := range InteractionPermissions {
+		if _, isCommand := commandByName(action); isCommand {
+			continue
+		}
+
+		icon := ":white_check_mark:"
+		if !userAllowed(strings.Split(permissions, "|"), user, userName) {
+			icon = ":no_entry:"
+		}
+		actions = append(actions, fmt.Sprintf("%s `%s`", icon, action))
+	}
+	sort.Strings(actions)
+
+	msg := fmt.Sprintf(":bust_in_silhouette: *@%s* (`%s`)\n*Papéis:* %s\n*Ambiente:* %s", userName, user, rolesText, env)
+
+	if len(TerraformApprovers) > 0 {
+		approver := "não"
+		if userAllowed(TerraformApprovers, user, userName) {
+			approver = "sim"
+		}
+		msg += fmt.Sprintf("\n*Aprova o Terraform:* %s", approver)
+	}
+
+	msg += fmt.Sprintf("\n*Comandos permitidos:* %s", strings.Join(allowed, " "))
+	if len(denied) > 0 {
+		msg += fmt.Sprintf("\n*Comandos restritos:* %s", strings.Join(denied, ", "))
+	}
+	if len(actions) > 0 {
+		msg += fmt.Sprintf("\n*Botões restritos:* %s", strings.Join(actions, ", "))
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText(msg, false))
+}
+
+// commandByName busca o comando na lista de comandos
+func commandByName(name string) (Command, bool) {
+	for _, cmd := range Commands {
+		if cmd.Cmd == name {
+			return cmd, true
+		}
+	}
+
+	return Command{}, false
+}
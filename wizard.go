@@ -0,0 +1,452 @@
+// Slack BOT for Rancher API
+// Created by: https://github.com/magnonta and https://github.com/cayohollanda
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	actionWizardService  = "wizard-service"
+	actionWizardTag      = "wizard-tag"
+	actionWizardStrategy = "wizard-strategy"
+	actionWizardConfirm  = "wizard-confirm"
+	actionWizardBack     = "wizard-back"
+	actionWizardCancel   = "wizard-cancel"
+	actionWizardScan     = "wizard-scan"
+
+	wizardStepService  = 1
+	wizardStepTag      = 2
+	wizardStepStrategy = 3
+	wizardStepReview   = 4
+
+	// wizardTTL é o tempo que o wizard fica disponível sem ser concluído
+	wizardTTL = 30 * time.Minute
+)
+
+// wizardStrategies são os ritmos de upgrade oferecidos no wizard
+var wizardStrategies = []UpgradeStrategy{
+	{BatchSize: 1, Interval: 2 * time.Second},
+	{BatchSize: 1, Interval: 30 * time.Second},
+	{BatchSize: 2, Interval: 10 * time.Second},
+	{BatchSize: 5, Interval: 10 * time.Second},
+}
+
+// wizardState é o estado de um upgrade guiado, editado a cada passo na
+// mesma mensagem
+type wizardState struct {
+	ID        string
+	User      string
+	Step      int
+	ServiceID string
+	Current   string
+	Image     string
+	Strategy  UpgradeStrategy
+	Created   time.Time
+
+	// Scan é o último scan da nova imagem no Harbor, mostrado na revisão
+	Scan     *ScanResult
+	Scanning bool
+}
+
+var (
+	upgradeWizards      = map[string]*wizardState{}
+	upgradeWizardsMutex sync.Mutex
+	upgradeWizardsSeq   int
+)
+
+// describeStrategy descreve a estratégia do upgrade, ex.: 2 instâncias por
+// vez, a cada 10s
+func describeStrategy(strategy UpgradeStrategy) string {
+	instances := "instância"
+	if strategy.BatchSize > 1 {
+		instances = "instâncias"
+	}
+
+	return fmt.Sprintf("%d %s por vez, a cada %s", strategy.BatchSize, instances, formatDuration(strategy.Interval))
+}
+
+// wizardSelect monta o bloco com o texto do passo e o menu das opções
+func wizardSelect(text string, actionID string, options []map[string]interface{}) kitBlock {
+	block := kitBlock{
+		"type": "section",
+		"text": map[string]interface{}{"type": "mrkdwn", "text": text},
+	}
+
+	if len(options) > 0 {
+		block["accessory"] = map[string]interface{}{
+			"type":        "static_select",
+			"action_id":   actionID,
+			"placeholder": plainText("Selecione"),
+			"options":     options,
+		}
+	}
+
+	return block
+}
+
+// option cria a opção do menu, levando o ID do wizard no valor
+func (wz *wizardState) option(text string, value string) map[string]interface{} {
+	return map[string]interface{}{"text": plainText(truncateOption(text)), "value": wz.ID + "|" + value}
+}
+
+// blocks monta a mensagem do passo atual do wizard
+func (wz *wizardState) blocks() []slack.Block {
+	title := fmt.Sprintf("*Upgrade guiado* (%d/4)", wz.Step)
+	var blocks []slack.Block
+
+	switch wz.Step {
+	case wizardStepService:
+		var options []map[string]interface{}
+		for _, option := range favoritesFirst(wz.User, getServices()) {
+			if len(options) < batchMaxOptions {
+				options = append(options, wz.option(option.Text, option.Value))
+			}
+		}
+
+		text := title + "\nEscolha o serviço"
+		if len(options) == batchMaxOptions {
+			text += fmt.Sprintf(" (mostrando %d, informe o serviço no comando para pular este passo)", batchMaxOptions)
+		}
+		blocks = append(blocks, wizardSelect(text, actionWizardService, options))
+	case wizardStepTag:
+		text := fmt.Sprintf("%s\nServiço `%s`, imagem atual `%s`\nEscolha a nova tag", title, serviceIndex.Name(wz.ServiceID), wz.Current)
+
+		var options []map[string]interface{}
+		tags, err := ListImageTags(wz.Current)
+		if err != nil {
+			CheckErr("Erro ao listar as tags no registry", err)
+			text = fmt.Sprintf("%s\nServiço `%s`, imagem atual `%s`\n:x: Erro ao listar as tags no registry: %s\nUse o `%s %s docker:imagem:tag`", title, serviceIndex.Name(wz.ServiceID), wz.Current, err, upgradeService, wz.ServiceID)
+		}
+
+		_, currentTag := normalizeImage(wz.Current)
+		for _, tag := range tags {
+			if tag != currentTag && len(options) < batchMaxOptions {
+				options = append(options, wz.option(tag, tag))
+			}
+		}
+
+		if err == nil && len(options) == 0 {
+			text += "\n:warning: Nenhuma outra tag encontrada no registry"
+		}
+		blocks = append(blocks, wizardSelect(text, actionWizardTag, options))
+	case wizardStepStrategy:
+		var options []map[string]interface{}
+		for i, strategy := range wizardStrategies {
+			options = append(options, wz.option(describeStrategy(strategy), strconv.Itoa(i)))
+		}
+
+		text := fmt.Sprintf("%s\nServiço `%s`: `%s` -> `%s`\nEscolha o ritmo do upgrade", title, serviceIndex.Name(wz.ServiceID), wz.Current, wz.Image)
+		blocks = append(blocks, wizardSelect(text, actionWizardStrategy, options))
+	case wizardStepReview:
+		dry := &DryRun{}
+		rancherListener.WithDryRun(dry).UpgradeServiceWithStrategy(wz.ServiceID, wz.Image, wz.Strategy)
+
+		text := fmt.Sprintf("%s\nServiço `%s`: `%s` -> `%s`\n%s%s\n\n%s", title, serviceIndex.Name(wz.ServiceID), wz.Current, wz.Image, describeStrategy(wz.Strategy), wz.scanText(), dry.Message(upgradeService))
+		blocks = append(blocks, wizardSelect(truncateText(text, 2900), "", nil))
+	}
+
+	var buttons []map[string]interface{}
+	if wz.Step == wizardStepReview && !wz.scanBlocked() {
+		buttons = append(buttons, map[string]interface{}{
+			"type":      "button",
+			"action_id": actionWizardConfirm,
+			"text":      plainText("Confirmar upgrade"),
+			"style":     "danger",
+			"value":     wz.ID,
+			"confirm": map[string]interface{}{
+				"title":   plainText("Tem certeza?"),
+				"text":    plainText(fmt.Sprintf("O serviço será atualizado para %s", wz.Image)),
+				"confirm": plainText("Sim"),
+				"deny":    plainText("Não"),
+			},
+		})
+	}
+	if _, _, _, ok := harborArtifact(wz.Image); ok && wz.Step == wizardStepReview && !wz.Scanning {
+		text := "Escanear imagem"
+		if wz.Scan != nil && wz.Scan.Finished() {
+			text = "Escanear de novo"
+		}
+		buttons = append(buttons, map[string]interface{}{"type": "button", "action_id": actionWizardScan, "text": plainText(text), "value": wz.ID})
+	}
+	if wz.Step > wizardStepService {
+		buttons = append(buttons, map[string]interface{}{"type": "button", "action_id": actionWizardBack, "text": plainText("Voltar"), "value": wz.ID})
+	}
+	buttons = append(buttons, map[string]interface{}{"type": "button", "action_id": actionWizardCancel, "text": plainText("Cancelar"), "value": wz.ID})
+
+	return append(blocks, kitBlock{"type": "actions", "elements": buttons})
+}
+
+// scanText é o resumo do scan da nova imagem na revisão, vazio quando a
+// imagem não está no Harbor
+func (wz *wizardState) scanText() string {
+	if _, _, _, ok := harborArtifact(wz.Image); !ok {
+		return ""
+	}
+
+	switch {
+	case wz.Scanning:
+		return "\n:hourglass_flowing_sand: Escaneando a imagem..."
+	case wz.Scan == nil || !wz.Scan.Finished():
+		return "\n:grey_question: Imagem ainda não escaneada"
+	case wz.Scan.Blocked():
+		return fmt.Sprintf("\n:no_entry: Scan: %s\nUpgrade bloqueado pela política (severidade %s ou maior)", wz.Scan.Summary(), ScanBlockSeverity)
+	}
+
+	return fmt.Sprintf("\n:mag: Scan: %s", wz.Scan.Summary())
+}
+
+// scanBlocked retorna se o upgrade não pode ser confirmado: o scan está em
+// andamento ou violou a política
+func (wz *wizardState) scanBlocked() bool {
+	return wz.Scanning || (wz.Scan != nil && wz.Scan.Blocked())
+}
+
+// loadScan busca o último scan da nova imagem para a revisão
+func (wz *wizardState) loadScan() {
+	wz.Scan = nil
+	if _, _, _, ok := harborArtifact(wz.Image); !ok {
+		return
+	}
+
+	result, err := GetScanResult(wz.Image)
+	if err != nil {
+		CheckErr("Erro ao buscar o scan da imagem "+wz.Image, err)
+		return
+	}
+	wz.Scan = result
+}
+
+// slackUpgradeWizard inicia o upgrade guiado. Com o serviço no comando o
+// wizard começa na escolha da tag
+func (s *SlackListener) slackUpgradeWizard(ev *slack.MessageEvent) {
+	if orchestrator.Name() != "rancher" {
+		s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("O upgrade guiado só está disponível no Rancher, use o `%s`", upgradeService), false))
+		return
+	}
+
+	upgradeWizardsMutex.Lock()
+	upgradeWizardsSeq++
+	wz := &wizardState{ID: strconv.Itoa(upgradeWizardsSeq), User: ev.Msg.User, Step: wizardStepService, Created: time.Now()}
+	for ID, old := range upgradeWizards {
+		if time.Since(old.Created) > wizardTTL {
+			delete(upgradeWizards, ID)
+		}
+	}
+	upgradeWizards[wz.ID] = wz
+	upgradeWizardsMutex.Unlock()
+
+	if args := strings.Fields(ev.Msg.Text); len(args) > 2 {
+		serviceID, ok := s.resolveServiceArg(ev.Channel, args[2])
+		if !ok {
+			return
+		}
+
+		if err := wz.selectService(serviceID); err != nil {
+			s.client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf(":x: %s", err), false))
+			return
+		}
+	}
+
+	s.client.PostMessage(ev.Channel, slack.MsgOptionText("Upgrade guiado", false), slack.MsgOptionBlocks(wz.blocks()...))
+}
+
+// selectService guarda o serviço e a imagem atual e avança para a tag
+func (wz *wizardState) selectService(serviceID string) error {
+	service, err := rancherListener.GetService(serviceID)
+	if err != nil {
+		return fmt.Errorf("erro ao buscar o serviço %s: %s", serviceID, err)
+	}
+
+	wz.ServiceID = serviceID
+	wz.Current = service.LaunchConfig.ImageUUID
+	wz.Step = wizardStepTag
+
+	return nil
+}
+
+// wizardFromAction busca o wizard da ação, avisando o usuário quando ele
+// expirou ou foi iniciado por outra pessoa. Retorna também o valor escolhido
+func wizardFromAction(message slack.AttachmentActionCallback) (*wizardState, string) {
+	value := message.Actions[0].Value
+	if len(message.Actions[0].SelectedOptions) > 0 {
+		value = message.Actions[0].SelectedOptions[0].Value
+	}
+
+	parts := strings.SplitN(value, "|", 2)
+	if len(parts) == 1 {
+		parts = append(parts, "")
+	}
+
+	upgradeWizardsMutex.Lock()
+	wz, ok := upgradeWizards[parts[0]]
+	upgradeWizardsMutex.Unlock()
+
+	if !ok || time.Since(wz.Created) > wizardTTL {
+		postEphemeral(message.Channel.ID, message.User.ID, msgWizardExpired, upgradeWizard)
+		return nil, ""
+	}
+
+	if wz.User != message.User.ID {
+		postEphemeral(message.Channel.ID, message.User.ID, msgWizardOwner)
+		return nil, ""
+	}
+
+	return wz, parts[1]
+}
+
+// updateWizard edita a mensagem com o passo atual do wizard
+func updateWizard(message slack.AttachmentActionCallback, wz *wizardState) {
+	getAPIConnection().client.UpdateMessage(message.Channel.ID, message.MessageTs, slack.MsgOptionText("Upgrade guiado", false), slack.MsgOptionBlocks(wz.blocks()...))
+}
+
+func actionWizardServiceFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	wz, serviceID := wizardFromAction(message)
+	if wz == nil {
+		return
+	}
+
+	if err := wz.selectService(serviceID); err != nil {
+		getAPIConnection().client.PostEphemeral(message.Channel.ID, message.User.ID, slack.MsgOptionText(fmt.Sprintf(":x: %s", err), false))
+		return
+	}
+
+	updateWizard(message, wz)
+}
+
+func actionWizardTagFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	wz, tag := wizardFromAction(message)
+	if wz == nil {
+		return
+	}
+
+	image := imageWithTag(wz.Current, tag)
+	if err := CheckUpgradePolicy(wz.ServiceID, image); err != nil {
+		getAPIConnection().client.PostEphemeral(message.Channel.ID, message.User.ID, slack.MsgOptionText(fmt.Sprintf(":no_entry: Upgrade bloqueado: %s", err), false))
+		return
+	}
+
+	wz.Image = image
+	wz.Step = wizardStepStrategy
+	updateWizard(message, wz)
+}
+
+func actionWizardStrategyFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	wz, value := wizardFromAction(message)
+	if wz == nil {
+		return
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 || i >= len(wizardStrategies) {
+		return
+	}
+
+	wz.Strategy = wizardStrategies[i]
+	wz.Step = wizardStepReview
+	wz.loadScan()
+	updateWizard(message, wz)
+}
+
+// actionWizardScanFunction pede o scan da nova imagem no Harbor, mostrando o
+// resultado na revisão quando ele termina
+func actionWizardScanFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	wz, _ := wizardFromAction(message)
+	if wz == nil || wz.Step != wizardStepReview || wz.Scanning {
+		return
+	}
+
+	if err := ScanImage(wz.Image); err != nil {
+		CheckErr("Erro ao pedir scan da imagem", err)
+		getAPIConnection().client.PostEphemeral(message.Channel.ID, message.User.ID, slack.MsgOptionText(fmt.Sprintf(":x: Erro ao escanear a imagem `%s`: %s", wz.Image, err), false))
+		return
+	}
+
+	log.Printf("[INFO] Scan da imagem %s pedido no upgrade guiado pelo usuário %s\n", wz.Image, message.User.Name)
+	wz.Scanning = true
+	updateWizard(message, wz)
+
+	go func() {
+		result, err := WaitScanResult(wz.Image)
+		if err != nil {
+			CheckErr("Erro ao buscar resultado do scan", err)
+		}
+
+		wz.Scan, wz.Scanning = result, false
+		updateWizard(message, wz)
+	}()
+}
+
+func actionWizardBackFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	wz, _ := wizardFromAction(message)
+	if wz == nil || wz.Step == wizardStepService {
+		return
+	}
+
+	wz.Step--
+	updateWizard(message, wz)
+}
+
+func actionWizardCancelFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	wz, _ := wizardFromAction(message)
+	if wz == nil {
+		return
+	}
+
+	upgradeWizardsMutex.Lock()
+	delete(upgradeWizards, wz.ID)
+	upgradeWizardsMutex.Unlock()
+
+	getAPIConnection().client.DeleteMessage(message.Channel.ID, message.MessageTs)
+}
+
+// actionWizardConfirmFunction coloca o upgrade na fila, acompanhando o
+// andamento na própria mensagem do wizard
+func actionWizardConfirmFunction(message slack.AttachmentActionCallback, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+
+	wz, _ := wizardFromAction(message)
+	if wz == nil || wz.Step != wizardStepReview {
+		return
+	}
+
+	upgradeWizardsMutex.Lock()
+	delete(upgradeWizards, wz.ID)
+	upgradeWizardsMutex.Unlock()
+
+	// A política (ou o scan) pode ter mudado desde a escolha da tag
+	if err := CheckUpgradePolicy(wz.ServiceID, wz.Image); err != nil {
+		interactionFailed(w)
+		getAPIConnection().client.UpdateMessage(message.Channel.ID, message.MessageTs, slack.MsgOptionText(fmt.Sprintf(":no_entry: Upgrade bloqueado: %s", err), false), slack.MsgOptionBlocks([]slack.Block{}...))
+		return
+	}
+
+	log.Printf("[INFO] Upgrade guiado do serviço %s para %s confirmado pelo usuário %s (%s)\n", wz.ServiceID, wz.Image, message.User.Name, describeStrategy(wz.Strategy))
+
+	job, err := EnqueueServiceUpgradeStrategy(message.Channel.ID, message.MessageTs, wz.ServiceID, wz.Image, message.User.Name, wz.Strategy)
+	interactionJob(w, job, err)
+	if err != nil {
+		getAPIConnection().client.UpdateMessage(message.Channel.ID, message.MessageTs, slack.MsgOptionText(queuedJobMessage(job, err), false), slack.MsgOptionBlocks([]slack.Block{}...))
+	}
+}